@@ -0,0 +1,178 @@
+#!/usr/bin/env bats
+
+load _helpers
+
+@test "aclTokenRotation/CronJob: disabled by default" {
+  cd `chart_dir`
+  assert_empty helm template \
+      -s templates/acl-token-rotation-cronjob.yaml  \
+      .
+}
+
+@test "aclTokenRotation/CronJob: disabled with global.acls.manageSystemACLs=true" {
+  cd `chart_dir`
+  assert_empty helm template \
+      -s templates/acl-token-rotation-cronjob.yaml  \
+      --set 'global.acls.manageSystemACLs=true' \
+      .
+}
+
+@test "aclTokenRotation/CronJob: enabled with global.acls.tokenRotation.enabled=true" {
+  cd `chart_dir`
+  local actual=$(helm template \
+      -s templates/acl-token-rotation-cronjob.yaml  \
+      --set 'global.acls.manageSystemACLs=true' \
+      --set 'global.acls.tokenRotation.enabled=true' \
+      --set 'global.acls.tokenRotation.tokens[0]=partitions' \
+      . | tee /dev/stderr |
+      yq 'length > 0' | tee /dev/stderr)
+  [ "${actual}" = "true" ]
+}
+
+@test "aclTokenRotation/CronJob: disabled with server=false" {
+  cd `chart_dir`
+  assert_empty helm template \
+      -s templates/acl-token-rotation-cronjob.yaml  \
+      --set 'global.acls.manageSystemACLs=true' \
+      --set 'global.acls.tokenRotation.enabled=true' \
+      --set 'global.acls.tokenRotation.tokens[0]=partitions' \
+      --set 'server.enabled=false' \
+      .
+}
+
+@test "aclTokenRotation/CronJob: fails without global.acls.manageSystemACLs" {
+  cd `chart_dir`
+  run helm template \
+      -s templates/acl-token-rotation-cronjob.yaml  \
+      --set 'global.acls.tokenRotation.enabled=true' \
+      --set 'global.acls.tokenRotation.tokens[0]=partitions' .
+  [ "$status" -eq 1 ]
+  [[ "$output" =~ "global.acls.manageSystemACLs must be true if global.acls.tokenRotation.enabled is true" ]]
+}
+
+@test "aclTokenRotation/CronJob: fails without tokens" {
+  cd `chart_dir`
+  run helm template \
+      -s templates/acl-token-rotation-cronjob.yaml  \
+      --set 'global.acls.manageSystemACLs=true' \
+      --set 'global.acls.tokenRotation.enabled=true' .
+  [ "$status" -eq 1 ]
+  [[ "$output" =~ "global.acls.tokenRotation.tokens must be set if global.acls.tokenRotation.enabled is true" ]]
+}
+
+@test "aclTokenRotation/CronJob: fails with the Vault secrets backend" {
+  cd `chart_dir`
+  run helm template \
+      -s templates/acl-token-rotation-cronjob.yaml  \
+      --set 'global.acls.manageSystemACLs=true' \
+      --set 'global.acls.tokenRotation.enabled=true' \
+      --set 'global.acls.tokenRotation.tokens[0]=partitions' \
+      --set 'global.secretsBackend.vault.enabled=true' \
+      --set 'global.secretsBackend.vault.consulClientRole=foo' \
+      --set 'global.secretsBackend.vault.consulServerRole=bar' \
+      --set 'global.secretsBackend.vault.manageSystemACLsRole=baz' \
+      --set 'global.acls.bootstrapToken.secretName=acl-bootstrap-token' \
+      --set 'global.acls.bootstrapToken.secretKey=token' .
+  [ "$status" -eq 1 ]
+  [[ "$output" =~ "global.acls.tokenRotation.enabled is not supported with global.secretsBackend.vault.enabled" ]]
+}
+
+@test "aclTokenRotation/CronJob: runs on the schedule and one at a time" {
+  cd `chart_dir`
+  local object=$(helm template \
+      -s templates/acl-token-rotation-cronjob.yaml  \
+      --set 'global.acls.manageSystemACLs=true' \
+      --set 'global.acls.tokenRotation.enabled=true' \
+      --set 'global.acls.tokenRotation.tokens[0]=partitions' \
+      --set 'global.acls.tokenRotation.schedule=0 0 * * 0' \
+      . | tee /dev/stderr |
+      yq -r '.spec' | tee /dev/stderr)
+
+  local actual=$(echo $object | yq -r '.schedule' | tee /dev/stderr)
+  [ "${actual}" = "0 0 * * 0" ]
+
+  local actual=$(echo $object | yq -r '.concurrencyPolicy' | tee /dev/stderr)
+  [ "${actual}" = "Forbid" ]
+}
+
+@test "aclTokenRotation/CronJob: rotate-acl-tokens is called with the tokens and rollouts" {
+  cd `chart_dir`
+  local command=$(helm template \
+      -s templates/acl-token-rotation-cronjob.yaml  \
+      --set 'global.acls.manageSystemACLs=true' \
+      --set 'global.acls.tokenRotation.enabled=true' \
+      --set 'global.acls.tokenRotation.tokens[0]=partitions' \
+      --set 'global.acls.tokenRotation.tokens[1]=acl-replication' \
+      --set 'global.acls.tokenRotation.rollouts[0]=deployment/foo' \
+      --set 'global.acls.tokenRotation.minTokenAge=2160h' \
+      . | tee /dev/stderr |
+      yq -r '.spec.jobTemplate.spec.template.spec.containers[0].command[2]' | tee /dev/stderr)
+
+  local actual=$(echo "$command" | grep -c 'consul-k8s-control-plane rotate-acl-tokens' | tee /dev/stderr)
+  [ "${actual}" = "1" ]
+
+  local actual=$(echo "$command" | grep -c -- '-resource-prefix=release-name-consul' | tee /dev/stderr)
+  [ "${actual}" = "1" ]
+
+  local actual=$(echo "$command" | grep -c -- '-secrets-backend=kubernetes' | tee /dev/stderr)
+  [ "${actual}" = "1" ]
+
+  local actual=$(echo "$command" | grep -c -- '-token-name="partitions"' | tee /dev/stderr)
+  [ "${actual}" = "1" ]
+
+  local actual=$(echo "$command" | grep -c -- '-token-name="acl-replication"' | tee /dev/stderr)
+  [ "${actual}" = "1" ]
+
+  local actual=$(echo "$command" | grep -c -- '-rollout="deployment/foo"' | tee /dev/stderr)
+  [ "${actual}" = "1" ]
+
+  local actual=$(echo "$command" | grep -c -- '-min-token-age=2160h' | tee /dev/stderr)
+  [ "${actual}" = "1" ]
+
+  local actual=$(echo "$command" | grep -c -- '-propagation-wait=2m' | tee /dev/stderr)
+  [ "${actual}" = "1" ]
+}
+
+@test "aclTokenRotation/CronJob: uses the bootstrap token" {
+  cd `chart_dir`
+  local actual=$(helm template \
+      -s templates/acl-token-rotation-cronjob.yaml  \
+      --set 'global.acls.manageSystemACLs=true' \
+      --set 'global.acls.tokenRotation.enabled=true' \
+      --set 'global.acls.tokenRotation.tokens[0]=partitions' \
+      . | tee /dev/stderr |
+      yq -c '.spec.jobTemplate.spec.template.spec.containers[0].env[] | select(.name == "CONSUL_ACL_TOKEN") | .valueFrom.secretKeyRef' | tee /dev/stderr)
+  [ "${actual}" = '{"name":"release-name-consul-bootstrap-acl-token","key":"token"}' ]
+}
+
+@test "aclTokenRotation/CronJob: uses the bootstrap token from global.acls.bootstrapToken" {
+  cd `chart_dir`
+  local actual=$(helm template \
+      -s templates/acl-token-rotation-cronjob.yaml  \
+      --set 'global.acls.manageSystemACLs=true' \
+      --set 'global.acls.tokenRotation.enabled=true' \
+      --set 'global.acls.tokenRotation.tokens[0]=partitions' \
+      --set 'global.acls.bootstrapToken.secretName=my-token' \
+      --set 'global.acls.bootstrapToken.secretKey=key' \
+      . | tee /dev/stderr |
+      yq -c '.spec.jobTemplate.spec.template.spec.containers[0].env[] | select(.name == "CONSUL_ACL_TOKEN") | .valueFrom.secretKeyRef' | tee /dev/stderr)
+  [ "${actual}" = '{"name":"my-token","key":"key"}' ]
+}
+
+@test "aclTokenRotation/CronJob: mounts the CA certificate with global.tls.enabled=true" {
+  cd `chart_dir`
+  local object=$(helm template \
+      -s templates/acl-token-rotation-cronjob.yaml  \
+      --set 'global.acls.manageSystemACLs=true' \
+      --set 'global.acls.tokenRotation.enabled=true' \
+      --set 'global.acls.tokenRotation.tokens[0]=partitions' \
+      --set 'global.tls.enabled=true' \
+      . | tee /dev/stderr |
+      yq -r '.spec.jobTemplate.spec.template.spec' | tee /dev/stderr)
+
+  local actual=$(echo $object | yq -r '.volumes[0].secret.secretName' | tee /dev/stderr)
+  [ "${actual}" = "release-name-consul-ca-cert" ]
+
+  local actual=$(echo $object | yq -r '.containers[0].volumeMounts[0].mountPath' | tee /dev/stderr)
+  [ "${actual}" = "/consul/tls/ca" ]
+}
@@ -0,0 +1,57 @@
+#!/usr/bin/env bats
+
+load _helpers
+
+@test "aclTokenRotation/Role: disabled by default" {
+  cd `chart_dir`
+  assert_empty helm template \
+      -s templates/acl-token-rotation-role.yaml  \
+      .
+}
+
+@test "aclTokenRotation/Role: enabled with global.acls.tokenRotation.enabled=true" {
+  cd `chart_dir`
+  local actual=$(helm template \
+      -s templates/acl-token-rotation-role.yaml  \
+      --set 'global.acls.manageSystemACLs=true' \
+      --set 'global.acls.tokenRotation.enabled=true' \
+      --set 'global.acls.tokenRotation.tokens[0]=partitions' \
+      . | tee /dev/stderr |
+      yq -r '.rules | map(select(.resources[0] == "secrets")) | .[0].verbs | join(",")' | tee /dev/stderr)
+  [ "${actual}" = "get,update" ]
+}
+
+@test "aclTokenRotation/Role: allows restarting workloads with global.acls.tokenRotation.rollouts" {
+  cd `chart_dir`
+  local actual=$(helm template \
+      -s templates/acl-token-rotation-role.yaml  \
+      --set 'global.acls.manageSystemACLs=true' \
+      --set 'global.acls.tokenRotation.enabled=true' \
+      --set 'global.acls.tokenRotation.tokens[0]=partitions' \
+      . | tee /dev/stderr |
+      yq -r '.rules | map(select(.apiGroups[0] == "apps")) | length' | tee /dev/stderr)
+  [ "${actual}" = "0" ]
+
+  local actual=$(helm template \
+      -s templates/acl-token-rotation-role.yaml  \
+      --set 'global.acls.manageSystemACLs=true' \
+      --set 'global.acls.tokenRotation.enabled=true' \
+      --set 'global.acls.tokenRotation.tokens[0]=partitions' \
+      --set 'global.acls.tokenRotation.rollouts[0]=deployment/foo' \
+      . | tee /dev/stderr |
+      yq -r '.rules | map(select(.apiGroups[0] == "apps")) | .[0].verbs | join(",")' | tee /dev/stderr)
+  [ "${actual}" = "get,patch" ]
+}
+
+@test "aclTokenRotation/Role: allows podsecuritypolicies access with global.enablePodSecurityPolicies=true" {
+  cd `chart_dir`
+  local actual=$(helm template \
+      -s templates/acl-token-rotation-role.yaml  \
+      --set 'global.acls.manageSystemACLs=true' \
+      --set 'global.acls.tokenRotation.enabled=true' \
+      --set 'global.acls.tokenRotation.tokens[0]=partitions' \
+      --set 'global.enablePodSecurityPolicies=true' \
+      . | tee /dev/stderr |
+      yq -r '.rules | map(select(.resources[0] == "podsecuritypolicies")) | length' | tee /dev/stderr)
+  [ "${actual}" = "1" ]
+}
@@ -0,0 +1,23 @@
+#!/usr/bin/env bats
+
+load _helpers
+
+@test "aclTokenRotation/RoleBinding: disabled by default" {
+  cd `chart_dir`
+  assert_empty helm template \
+      -s templates/acl-token-rotation-rolebinding.yaml  \
+      --set 'global.acls.manageSystemACLs=true' \
+      .
+}
+
+@test "aclTokenRotation/RoleBinding: enabled with global.acls.tokenRotation.enabled=true" {
+  cd `chart_dir`
+  local actual=$(helm template \
+      -s templates/acl-token-rotation-rolebinding.yaml  \
+      --set 'global.acls.manageSystemACLs=true' \
+      --set 'global.acls.tokenRotation.enabled=true' \
+      --set 'global.acls.tokenRotation.tokens[0]=partitions' \
+      . | tee /dev/stderr |
+      yq 'length > 0' | tee /dev/stderr)
+  [ "${actual}" = "true" ]
+}
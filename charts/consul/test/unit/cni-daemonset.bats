@@ -90,6 +90,82 @@ load _helpers
   local actual=$(echo "$cmd" |
     yq 'any(contains("multus=false"))' | tee /dev/stderr)
   [ "${actual}" = "true" ]
+
+  local actual=$(echo "$cmd" |
+    yq 'any(contains("redirect-backend"))' | tee /dev/stderr)
+  [ "${actual}" = "false" ]
+}
+
+@test "cni/DaemonSet: redirect backend can be set" {
+  cd `chart_dir`
+  local actual=$(helm template \
+      -s templates/cni-daemonset.yaml  \
+      --set 'connectInject.cni.enabled=true' \
+      --set 'connectInject.enabled=true' \
+      --set 'connectInject.cni.redirectBackend=nftables' \
+      . | tee /dev/stderr |
+      yq '.spec.template.spec.containers[0].command | any(contains("-redirect-backend=nftables"))' | tee /dev/stderr)
+  [ "${actual}" = "true" ]
+}
+
+@test "cni/DaemonSet: cni config priority is not set by default" {
+  cd `chart_dir`
+  local actual=$(helm template \
+      -s templates/cni-daemonset.yaml  \
+      --set 'connectInject.cni.enabled=true' \
+      --set 'connectInject.enabled=true' \
+      . | tee /dev/stderr |
+      yq '.spec.template.spec.containers[0].command | any(contains("-cni-config-priority"))' | tee /dev/stderr)
+  [ "${actual}" = "false" ]
+}
+
+@test "cni/DaemonSet: cni config priority can be set" {
+  cd `chart_dir`
+  local actual=$(helm template \
+      -s templates/cni-daemonset.yaml  \
+      --set 'connectInject.cni.enabled=true' \
+      --set 'connectInject.enabled=true' \
+      --set 'connectInject.cni.cniConfigPriority[0]=05-cilium.conflist' \
+      --set 'connectInject.cni.cniConfigPriority[1]=10-*.conflist' \
+      . | tee /dev/stderr |
+      yq '.spec.template.spec.containers[0].command | any(contains("-cni-config-priority=05-cilium.conflist,10-*.conflist"))' | tee /dev/stderr)
+  [ "${actual}" = "true" ]
+}
+
+#--------------------------------------------------------------------
+# health
+
+@test "cni/DaemonSet: readiness probe uses the health endpoint" {
+  cd `chart_dir`
+  local object=$(helm template \
+      -s templates/cni-daemonset.yaml  \
+      --set 'connectInject.cni.enabled=true' \
+      --set 'connectInject.enabled=true' \
+      . | tee /dev/stderr |
+      yq '.spec.template.spec.containers[0]' | tee /dev/stderr)
+
+  local actual=$(echo "$object" |
+    yq '.command | any(contains("-health-addr=:8080"))' | tee /dev/stderr)
+  [ "${actual}" = "true" ]
+
+  local actual=$(echo "$object" |
+    yq -r '.readinessProbe.httpGet.path' | tee /dev/stderr)
+  [ "${actual}" = "/health" ]
+
+  local actual=$(echo "$object" |
+    yq -r '.readinessProbe.httpGet.port' | tee /dev/stderr)
+  [ "${actual}" = "8080" ]
+}
+
+@test "cni/DaemonSet: NODE_NAME is set from the downward API" {
+  cd `chart_dir`
+  local actual=$(helm template \
+      -s templates/cni-daemonset.yaml  \
+      --set 'connectInject.cni.enabled=true' \
+      --set 'connectInject.enabled=true' \
+      . | tee /dev/stderr |
+      yq -r '.spec.template.spec.containers[0].env[] | select(.name == "NODE_NAME") | .valueFrom.fieldRef.fieldPath' | tee /dev/stderr)
+  [ "${actual}" = "spec.nodeName" ]
 }
 
 #--------------------------------------------------------------------
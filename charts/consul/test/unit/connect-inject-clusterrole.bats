@@ -127,6 +127,24 @@ load _helpers
   [ "${actual}" != null ]
 }
 
+@test "connectInject/ClusterRole: sets create and patch access to events in all api groups" {
+  cd `chart_dir`
+  local object=$(helm template \
+      -s templates/connect-inject-clusterrole.yaml  \
+      --set 'connectInject.enabled=true' \
+      . | tee /dev/stderr |
+      yq -r '.rules[] | select(.resources[0] == "events")' | tee /dev/stderr)
+
+  local actual=$(echo $object | yq -r '.apiGroups[0]' | tee /dev/stderr)
+  [ "${actual}" = "" ]
+
+  local actual=$(echo $object | yq -r '.verbs | index("create")' | tee /dev/stderr)
+  [ "${actual}" != null ]
+
+  local actual=$(echo $object | yq -r '.verbs | index("patch")' | tee /dev/stderr)
+  [ "${actual}" != null ]
+}
+
 @test "connectInject/ClusterRole: sets get access to serviceaccounts and secrets when manageSystemACLSis true" {
   cd `chart_dir`
   local object=$(helm template \
@@ -1434,6 +1434,40 @@ load _helpers
   [ "${actual}" = "true" ]
 }
 
+@test "connectInject/Deployment: cni node affinity is disabled by default" {
+  cd `chart_dir`
+  local actual=$(helm template \
+      -s templates/connect-inject-deployment.yaml  \
+      --set 'connectInject.enabled=true' \
+      --set 'connectInject.cni.enabled=true' \
+      . | tee /dev/stderr |
+      yq '.spec.template.spec.containers[0].command | any(contains("-enable-cni-node-affinity"))' | tee /dev/stderr)
+  [ "${actual}" = "false" ]
+}
+
+@test "connectInject/Deployment: cni node affinity can be enabled by setting connectInject.cni.nodeAffinity=true" {
+  cd `chart_dir`
+  local actual=$(helm template \
+      -s templates/connect-inject-deployment.yaml  \
+      --set 'connectInject.enabled=true' \
+      --set 'connectInject.cni.enabled=true' \
+      --set 'connectInject.cni.nodeAffinity=true' \
+      . | tee /dev/stderr |
+      yq '.spec.template.spec.containers[0].command | any(contains("-enable-cni-node-affinity=true"))' | tee /dev/stderr)
+  [ "${actual}" = "true" ]
+}
+
+@test "connectInject/Deployment: cni node affinity is not set when cni is disabled" {
+  cd `chart_dir`
+  local actual=$(helm template \
+      -s templates/connect-inject-deployment.yaml  \
+      --set 'connectInject.enabled=true' \
+      --set 'connectInject.cni.nodeAffinity=true' \
+      . | tee /dev/stderr |
+      yq '.spec.template.spec.containers[0].command | any(contains("-enable-cni-node-affinity"))' | tee /dev/stderr)
+  [ "${actual}" = "false" ]
+}
+
 #--------------------------------------------------------------------
 # peering
 
@@ -1494,6 +1528,205 @@ load _helpers
   [[ "$output" =~ "setting global.peering.enabled to true requires meshGateway.enabled to be true" ]]
 }
 
+@test "connectInject/Deployment: peering Vault secret backend flags are not set by default" {
+  cd `chart_dir`
+  local actual=$(helm template \
+      -s templates/connect-inject-deployment.yaml  \
+      --set 'connectInject.enabled=true' \
+      --set 'global.peering.enabled=true' \
+      --set 'meshGateway.enabled=true' \
+      --set 'global.tls.enabled=true' \
+      . | tee /dev/stderr |
+      yq '.spec.template.spec.containers[0].command | any(contains("-peering-vault-address"))' | tee /dev/stderr)
+
+  [ "${actual}" = "false" ]
+}
+
+@test "connectInject/Deployment: peering Vault secret backend flags are set when global.secretsBackend.vault.peering.enabled is true" {
+  cd `chart_dir`
+  local cmd=$(helm template \
+      -s templates/connect-inject-deployment.yaml  \
+      --set 'connectInject.enabled=true' \
+      --set 'global.peering.enabled=true' \
+      --set 'meshGateway.enabled=true' \
+      --set 'global.tls.enabled=true' \
+      --set 'global.secretsBackend.vault.connectInjectRole=inject-role' \
+      --set 'global.secretsBackend.vault.peering.enabled=true' \
+      --set 'global.secretsBackend.vault.peering.address=https://vault:8200' \
+      --set 'global.secretsBackend.vault.peering.kvMount=consul-kv' \
+      --set 'global.secretsBackend.vault.peering.authMethodPath=k8s' \
+      --set 'global.secretsBackend.vault.peering.pollInterval=30s' \
+      . | tee /dev/stderr |
+      yq '.spec.template.spec.containers[0].command' | tee /dev/stderr)
+
+  local actual=$(echo "$cmd" | yq 'any(contains("-peering-vault-address=https://vault:8200"))' | tee /dev/stderr)
+  [ "${actual}" = "true" ]
+
+  actual=$(echo "$cmd" | yq 'any(contains("-peering-vault-kv-mount=consul-kv"))' | tee /dev/stderr)
+  [ "${actual}" = "true" ]
+
+  actual=$(echo "$cmd" | yq 'any(contains("-peering-vault-auth-method-path=k8s"))' | tee /dev/stderr)
+  [ "${actual}" = "true" ]
+
+  actual=$(echo "$cmd" | yq 'any(contains("-peering-vault-role=inject-role"))' | tee /dev/stderr)
+  [ "${actual}" = "true" ]
+
+  actual=$(echo "$cmd" | yq 'any(contains("-peering-secret-poll-interval=30s"))' | tee /dev/stderr)
+  [ "${actual}" = "true" ]
+}
+
+@test "connectInject/Deployment: peering Vault secret backend does not use a Vault CA by default" {
+  cd `chart_dir`
+  local object=$(helm template \
+      -s templates/connect-inject-deployment.yaml  \
+      --set 'connectInject.enabled=true' \
+      --set 'global.peering.enabled=true' \
+      --set 'meshGateway.enabled=true' \
+      --set 'global.tls.enabled=true' \
+      --set 'global.secretsBackend.vault.peering.enabled=true' \
+      --set 'global.secretsBackend.vault.peering.address=https://vault:8200' \
+      . | tee /dev/stderr |
+      yq '.spec.template.spec' | tee /dev/stderr)
+
+  local actual=$(echo "$object" | yq '.containers[0].command | any(contains("-peering-vault-ca-cert-file"))' | tee /dev/stderr)
+  [ "${actual}" = "false" ]
+
+  actual=$(echo "$object" | yq '.volumes | map(select(.name == "vault-ca")) | length' | tee /dev/stderr)
+  [ "${actual}" = "0" ]
+}
+
+@test "connectInject/Deployment: peering Vault secret backend uses the Vault CA when global.secretsBackend.vault.ca is set" {
+  cd `chart_dir`
+  local object=$(helm template \
+      -s templates/connect-inject-deployment.yaml  \
+      --set 'connectInject.enabled=true' \
+      --set 'global.peering.enabled=true' \
+      --set 'meshGateway.enabled=true' \
+      --set 'global.tls.enabled=true' \
+      --set 'global.secretsBackend.vault.peering.enabled=true' \
+      --set 'global.secretsBackend.vault.peering.address=https://vault:8200' \
+      --set 'global.secretsBackend.vault.ca.secretName=vault-ca-secret' \
+      --set 'global.secretsBackend.vault.ca.secretKey=ca.crt' \
+      . | tee /dev/stderr |
+      yq '.spec.template.spec' | tee /dev/stderr)
+
+  local actual=$(echo "$object" | yq '.containers[0].command | any(contains("-peering-vault-ca-cert-file=/consul/vault-ca/tls.crt"))' | tee /dev/stderr)
+  [ "${actual}" = "true" ]
+
+  actual=$(echo "$object" | yq -r '.volumes[] | select(.name == "vault-ca") | .secret.secretName' | tee /dev/stderr)
+  [ "${actual}" = "vault-ca-secret" ]
+
+  actual=$(echo "$object" | yq -r '.volumes[] | select(.name == "vault-ca") | .secret.items[0].key' | tee /dev/stderr)
+  [ "${actual}" = "ca.crt" ]
+
+  actual=$(echo "$object" | yq -r '.containers[0].volumeMounts[] | select(.name == "vault-ca") | .mountPath' | tee /dev/stderr)
+  [ "${actual}" = "/consul/vault-ca/" ]
+}
+
+@test "connectInject/Deployment: fails if the peering Vault secret backend is enabled without an address" {
+  cd `chart_dir`
+  run helm template \
+      -s templates/connect-inject-deployment.yaml  \
+      --set 'connectInject.enabled=true' \
+      --set 'global.peering.enabled=true' \
+      --set 'meshGateway.enabled=true' \
+      --set 'global.tls.enabled=true' \
+      --set 'global.secretsBackend.vault.peering.enabled=true' .
+  [ "$status" -eq 1 ]
+  [[ "$output" =~ "global.secretsBackend.vault.peering.address must be set if global.secretsBackend.vault.peering.enabled is true" ]]
+}
+
+@test "connectInject/Deployment: peering health and auto redial flags are set with defaults when global.peering.enabled is true" {
+  cd `chart_dir`
+  local cmd=$(helm template \
+      -s templates/connect-inject-deployment.yaml  \
+      --set 'connectInject.enabled=true' \
+      --set 'global.peering.enabled=true' \
+      --set 'meshGateway.enabled=true' \
+      --set 'global.tls.enabled=true' \
+      . | tee /dev/stderr |
+      yq '.spec.template.spec.containers[0].command' | tee /dev/stderr)
+
+  local actual=$(echo "$cmd" | yq 'any(contains("-peering-health-check-interval=30s"))' | tee /dev/stderr)
+  [ "${actual}" = "true" ]
+
+  actual=$(echo "$cmd" | yq 'any(contains("-enable-peering-auto-redial=true"))' | tee /dev/stderr)
+  [ "${actual}" = "true" ]
+
+  actual=$(echo "$cmd" | yq 'any(contains("-peering-redial-backoff=10s"))' | tee /dev/stderr)
+  [ "${actual}" = "true" ]
+
+  actual=$(echo "$cmd" | yq 'any(contains("-peering-max-redial-backoff=5m"))' | tee /dev/stderr)
+  [ "${actual}" = "true" ]
+}
+
+@test "connectInject/Deployment: peering health and auto redial flags can be configured" {
+  cd `chart_dir`
+  local cmd=$(helm template \
+      -s templates/connect-inject-deployment.yaml  \
+      --set 'connectInject.enabled=true' \
+      --set 'global.peering.enabled=true' \
+      --set 'meshGateway.enabled=true' \
+      --set 'global.tls.enabled=true' \
+      --set 'global.peering.healthCheckInterval=1m' \
+      --set 'global.peering.autoRedial.enabled=false' \
+      --set 'global.peering.autoRedial.backoff=30s' \
+      --set 'global.peering.autoRedial.maxBackoff=10m' \
+      . | tee /dev/stderr |
+      yq '.spec.template.spec.containers[0].command' | tee /dev/stderr)
+
+  local actual=$(echo "$cmd" | yq 'any(contains("-peering-health-check-interval=1m"))' | tee /dev/stderr)
+  [ "${actual}" = "true" ]
+
+  actual=$(echo "$cmd" | yq 'any(contains("-enable-peering-auto-redial=false"))' | tee /dev/stderr)
+  [ "${actual}" = "true" ]
+
+  actual=$(echo "$cmd" | yq 'any(contains("-peering-redial-backoff=30s"))' | tee /dev/stderr)
+  [ "${actual}" = "true" ]
+
+  actual=$(echo "$cmd" | yq 'any(contains("-peering-max-redial-backoff=10m"))' | tee /dev/stderr)
+  [ "${actual}" = "true" ]
+}
+
+#--------------------------------------------------------------------
+# configEntryOrphanSweeper
+
+@test "connectInject/Deployment: orphaned config entry sweeper is disabled by default" {
+  cd `chart_dir`
+  local actual=$(helm template \
+      -s templates/connect-inject-deployment.yaml  \
+      --set 'connectInject.enabled=true' \
+      . | tee /dev/stderr |
+      yq '.spec.template.spec.containers[0].command | any(contains("-config-entry-orphan-sweep-interval"))' | tee /dev/stderr)
+
+  [ "${actual}" = "false" ]
+}
+
+@test "connectInject/Deployment: orphaned config entry sweeper flags are set when connectInject.configEntryOrphanSweeper.enabled is true" {
+  cd `chart_dir`
+  local cmd=$(helm template \
+      -s templates/connect-inject-deployment.yaml  \
+      --set 'connectInject.enabled=true' \
+      --set 'connectInject.configEntryOrphanSweeper.enabled=true' \
+      --set 'connectInject.configEntryOrphanSweeper.interval=5m' \
+      --set 'connectInject.configEntryOrphanSweeper.gracePeriod=1h' \
+      --set 'connectInject.configEntryOrphanSweeper.dryRun=true' \
+      . | tee /dev/stderr |
+      yq '.spec.template.spec.containers[0].command' | tee /dev/stderr)
+
+  local actual=$(echo "$cmd" |
+    yq 'any(contains("-config-entry-orphan-sweep-interval=5m"))' | tee /dev/stderr)
+  [ "${actual}" = "true" ]
+
+  local actual=$(echo "$cmd" |
+    yq 'any(contains("-config-entry-orphan-sweep-grace-period=1h"))' | tee /dev/stderr)
+  [ "${actual}" = "true" ]
+
+  local actual=$(echo "$cmd" |
+    yq 'any(contains("-config-entry-orphan-sweep-dry-run=true"))' | tee /dev/stderr)
+  [ "${actual}" = "true" ]
+}
+
 #--------------------------------------------------------------------
 # openshift
 
@@ -0,0 +1,178 @@
+#!/usr/bin/env bats
+
+load _helpers
+
+@test "createFederationSecret/Deployment: disabled by default" {
+  cd `chart_dir`
+  assert_empty helm template \
+      -s templates/create-federation-secret-deployment.yaml  \
+      .
+}
+
+@test "createFederationSecret/Deployment: disabled with global.federation.createFederationSecret=true" {
+  cd `chart_dir`
+  assert_empty helm template \
+      -s templates/create-federation-secret-deployment.yaml  \
+      --set 'global.federation.enabled=true' \
+      --set 'meshGateway.enabled=true' \
+      --set 'connectInject.enabled=true' \
+      --set 'global.tls.enabled=true' \
+      --set 'global.federation.createFederationSecret=true' \
+      .
+}
+
+@test "createFederationSecret/Deployment: enabled with global.federation.watchFederationSecret.enabled=true" {
+  cd `chart_dir`
+  local actual=$(helm template \
+      -s templates/create-federation-secret-deployment.yaml  \
+      --set 'global.federation.enabled=true' \
+      --set 'meshGateway.enabled=true' \
+      --set 'connectInject.enabled=true' \
+      --set 'global.tls.enabled=true' \
+      --set 'global.federation.createFederationSecret=true' \
+      --set 'global.federation.watchFederationSecret.enabled=true' \
+      . | tee /dev/stderr |
+      yq 'length > 0' | tee /dev/stderr)
+  [ "${actual}" = "true" ]
+}
+
+@test "createFederationSecret/Deployment: fails when global.federation.enabled=false" {
+  cd `chart_dir`
+  run helm template \
+      -s templates/create-federation-secret-deployment.yaml  \
+      --set 'global.federation.createFederationSecret=true' \
+      --set 'global.federation.watchFederationSecret.enabled=true' .
+  [ "$status" -eq 1 ]
+  [[ "$output" =~ "global.federation.enabled must be true when global.federation.createFederationSecret is true" ]]
+}
+
+@test "createFederationSecret/Deployment: is not a hook" {
+  cd `chart_dir`
+  local actual=$(helm template \
+      -s templates/create-federation-secret-deployment.yaml  \
+      --set 'global.federation.enabled=true' \
+      --set 'meshGateway.enabled=true' \
+      --set 'connectInject.enabled=true' \
+      --set 'global.tls.enabled=true' \
+      --set 'global.federation.createFederationSecret=true' \
+      --set 'global.federation.watchFederationSecret.enabled=true' \
+      . | tee /dev/stderr |
+      yq '.metadata | has("annotations")' | tee /dev/stderr)
+  [ "${actual}" = "false" ]
+}
+
+#--------------------------------------------------------------------
+# command
+
+@test "createFederationSecret/Deployment: sets -watch and -resync-interval" {
+  cd `chart_dir`
+  local cmd=$(helm template \
+      -s templates/create-federation-secret-deployment.yaml  \
+      --set 'global.federation.enabled=true' \
+      --set 'meshGateway.enabled=true' \
+      --set 'connectInject.enabled=true' \
+      --set 'global.tls.enabled=true' \
+      --set 'global.federation.createFederationSecret=true' \
+      --set 'global.federation.watchFederationSecret.enabled=true' \
+      --set 'global.federation.watchFederationSecret.resyncInterval=5m' \
+      . | tee /dev/stderr | yq -c '.spec.template.spec.containers[0].command')
+
+  local actual=$(echo $cmd | yq 'any(contains("-watch"))' | tee /dev/stderr)
+  [ "${actual}" = "true" ]
+
+  local actual=$(echo $cmd | yq 'any(contains("-resync-interval=5m"))' | tee /dev/stderr)
+  [ "${actual}" = "true" ]
+}
+
+@test "createFederationSecret/Deployment: sets -secondary-kubeconfig-secret and -secondary-k8s-namespace" {
+  cd `chart_dir`
+  local cmd=$(helm template \
+      -s templates/create-federation-secret-deployment.yaml  \
+      --set 'global.federation.enabled=true' \
+      --set 'meshGateway.enabled=true' \
+      --set 'connectInject.enabled=true' \
+      --set 'global.tls.enabled=true' \
+      --set 'global.federation.createFederationSecret=true' \
+      --set 'global.federation.watchFederationSecret.enabled=true' \
+      --set 'global.federation.secondaryKubeconfigSecrets[0]=dc2-kubeconfig' \
+      --set 'global.federation.secondaryK8sNamespace=consul' \
+      . | tee /dev/stderr | yq -c '.spec.template.spec.containers[0].command')
+
+  local actual=$(echo $cmd | yq 'any(contains("-secondary-kubeconfig-secret=\"dc2-kubeconfig\""))' | tee /dev/stderr)
+  [ "${actual}" = "true" ]
+
+  local actual=$(echo $cmd | yq 'any(contains("-secondary-k8s-namespace=\"consul\""))' | tee /dev/stderr)
+  [ "${actual}" = "true" ]
+}
+
+@test "createFederationSecret/Deployment: sets -export-replication-token with global.acls.createReplicationToken=true" {
+  cd `chart_dir`
+  local actual=$(helm template \
+      -s templates/create-federation-secret-deployment.yaml  \
+      --set 'global.federation.enabled=true' \
+      --set 'meshGateway.enabled=true' \
+      --set 'connectInject.enabled=true' \
+      --set 'global.tls.enabled=true' \
+      --set 'global.acls.manageSystemACLs=true' \
+      --set 'global.acls.createReplicationToken=true' \
+      --set 'global.federation.createFederationSecret=true' \
+      --set 'global.federation.watchFederationSecret.enabled=true' \
+      . | tee /dev/stderr | yq '.spec.template.spec.containers[0].command | any(contains("-export-replication-token=true"))')
+  [ "${actual}" = "true" ]
+}
+
+#--------------------------------------------------------------------
+# resources
+
+@test "createFederationSecret/Deployment: default resources" {
+  cd `chart_dir`
+  local actual=$(helm template \
+      -s templates/create-federation-secret-deployment.yaml  \
+      --set 'global.federation.enabled=true' \
+      --set 'meshGateway.enabled=true' \
+      --set 'connectInject.enabled=true' \
+      --set 'global.tls.enabled=true' \
+      --set 'global.federation.createFederationSecret=true' \
+      --set 'global.federation.watchFederationSecret.enabled=true' \
+      . | tee /dev/stderr |
+      yq -rc '.spec.template.spec.containers[0].resources' | tee /dev/stderr)
+  [ "${actual}" = '{"limits":{"cpu":"50m","memory":"50Mi"},"requests":{"cpu":"50m","memory":"50Mi"}}' ]
+}
+
+@test "createFederationSecret/Deployment: can set resources" {
+  cd `chart_dir`
+  local actual=$(helm template \
+      -s templates/create-federation-secret-deployment.yaml  \
+      --set 'global.federation.enabled=true' \
+      --set 'meshGateway.enabled=true' \
+      --set 'connectInject.enabled=true' \
+      --set 'global.tls.enabled=true' \
+      --set 'global.federation.createFederationSecret=true' \
+      --set 'global.federation.watchFederationSecret.enabled=true' \
+      --set 'global.federation.watchFederationSecret.resources.requests.memory=100Mi' \
+      --set 'global.federation.watchFederationSecret.resources.requests.cpu=100m' \
+      --set 'global.federation.watchFederationSecret.resources.limits.memory=200Mi' \
+      --set 'global.federation.watchFederationSecret.resources.limits.cpu=200m' \
+      . | tee /dev/stderr |
+      yq -rc '.spec.template.spec.containers[0].resources' | tee /dev/stderr)
+  [ "${actual}" = '{"limits":{"cpu":"200m","memory":"200Mi"},"requests":{"cpu":"100m","memory":"100Mi"}}' ]
+}
+
+#--------------------------------------------------------------------
+# volumes
+
+@test "createFederationSecret/Deployment: mounts the gossip encryption key when autogenerated" {
+  cd `chart_dir`
+  local actual=$(helm template \
+      -s templates/create-federation-secret-deployment.yaml  \
+      --set 'global.federation.enabled=true' \
+      --set 'meshGateway.enabled=true' \
+      --set 'connectInject.enabled=true' \
+      --set 'global.tls.enabled=true' \
+      --set 'global.gossipEncryption.autoGenerate=true' \
+      --set 'global.federation.createFederationSecret=true' \
+      --set 'global.federation.watchFederationSecret.enabled=true' \
+      . | tee /dev/stderr |
+      yq -r '.spec.template.spec.containers[0].volumeMounts[] | select(.name == "gossip-encryption-key") | .mountPath' | tee /dev/stderr)
+  [ "${actual}" = "/consul/gossip" ]
+}
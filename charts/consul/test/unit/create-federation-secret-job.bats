@@ -9,6 +9,19 @@ load _helpers
       .
 }
 
+@test "createFederationSecret/Job: disabled with global.federation.watchFederationSecret.enabled=true" {
+  cd `chart_dir`
+  assert_empty helm template \
+      -s templates/create-federation-secret-job.yaml  \
+      --set 'global.federation.enabled=true' \
+      --set 'meshGateway.enabled=true' \
+      --set 'connectInject.enabled=true' \
+      --set 'global.tls.enabled=true' \
+      --set 'global.federation.createFederationSecret=true' \
+      --set 'global.federation.watchFederationSecret.enabled=true' \
+      .
+}
+
 @test "createFederationSecret/Job: fails when global.federation.enabled=false" {
   cd `chart_dir`
   run helm template \
@@ -267,6 +280,46 @@ load _helpers
   [ "${actual}" = "true" ]
 }
 
+#--------------------------------------------------------------------
+# global.federation.secondaryKubeconfigSecrets
+
+@test "createFederationSecret/Job: does not set -secondary-kubeconfig-secret by default" {
+  cd `chart_dir`
+  local actual=$(helm template \
+      -s templates/create-federation-secret-job.yaml  \
+      --set 'global.federation.enabled=true' \
+      --set 'meshGateway.enabled=true' \
+      --set 'connectInject.enabled=true' \
+      --set 'global.tls.enabled=true' \
+      --set 'global.federation.createFederationSecret=true' \
+      . | tee /dev/stderr | yq '.spec.template.spec.containers[0].command | any(contains("-secondary-"))')
+  [ "${actual}" = "false" ]
+}
+
+@test "createFederationSecret/Job: sets -secondary-kubeconfig-secret and -secondary-k8s-namespace" {
+  cd `chart_dir`
+  local cmd=$(helm template \
+      -s templates/create-federation-secret-job.yaml  \
+      --set 'global.federation.enabled=true' \
+      --set 'meshGateway.enabled=true' \
+      --set 'connectInject.enabled=true' \
+      --set 'global.tls.enabled=true' \
+      --set 'global.federation.createFederationSecret=true' \
+      --set 'global.federation.secondaryKubeconfigSecrets[0]=dc2-kubeconfig' \
+      --set 'global.federation.secondaryKubeconfigSecrets[1]=dc3-kubeconfig' \
+      --set 'global.federation.secondaryK8sNamespace=consul' \
+      . | tee /dev/stderr | yq -c '.spec.template.spec.containers[0].command')
+
+  local actual=$(echo $cmd | yq 'any(contains("-secondary-kubeconfig-secret=\"dc2-kubeconfig\""))' | tee /dev/stderr)
+  [ "${actual}" = "true" ]
+
+  local actual=$(echo $cmd | yq 'any(contains("-secondary-kubeconfig-secret=\"dc3-kubeconfig\""))' | tee /dev/stderr)
+  [ "${actual}" = "true" ]
+
+  local actual=$(echo $cmd | yq 'any(contains("-secondary-k8s-namespace=\"consul\""))' | tee /dev/stderr)
+  [ "${actual}" = "true" ]
+}
+
 #--------------------------------------------------------------------
 # tolerations
 
@@ -23,6 +23,59 @@ load _helpers
   [ "${actual}" = "true" ]
 }
 
+@test "createFederationSecret/Role: is a hook by default" {
+  cd `chart_dir`
+  local actual=$(helm template \
+      -s templates/create-federation-secret-role.yaml  \
+      --set 'global.federation.createFederationSecret=true' \
+      --set 'global.federation.enabled=true' \
+      --set 'global.tls.enabled=true' \
+      --set 'meshGateway.enabled=true' \
+      --set 'connectInject.enabled=true' \
+      . | tee /dev/stderr |
+      yq -r '.metadata.annotations["helm.sh/hook"]' | tee /dev/stderr)
+  [ "${actual}" = "post-install,post-upgrade" ]
+}
+
+@test "createFederationSecret/Role: is not a hook with global.federation.watchFederationSecret.enabled=true" {
+  cd `chart_dir`
+  local actual=$(helm template \
+      -s templates/create-federation-secret-role.yaml  \
+      --set 'global.federation.createFederationSecret=true' \
+      --set 'global.federation.watchFederationSecret.enabled=true' \
+      --set 'global.federation.enabled=true' \
+      --set 'global.tls.enabled=true' \
+      --set 'meshGateway.enabled=true' \
+      --set 'connectInject.enabled=true' \
+      . | tee /dev/stderr |
+      yq '.metadata | has("annotations")' | tee /dev/stderr)
+  [ "${actual}" = "false" ]
+}
+
+#--------------------------------------------------------------------
+# global.federation.secondaryKubeconfigSecrets
+
+@test "createFederationSecret/Role: allows read access for secondary kubeconfig secrets" {
+  cd `chart_dir`
+  local actual=$(helm template \
+      -s templates/create-federation-secret-role.yaml  \
+      --set 'global.federation.createFederationSecret=true' \
+      --set 'global.federation.enabled=true' \
+      --set 'global.tls.enabled=true' \
+      --set 'meshGateway.enabled=true' \
+      --set 'connectInject.enabled=true' \
+      --set 'global.federation.secondaryKubeconfigSecrets[0]=dc2-kubeconfig' \
+      --set 'global.federation.secondaryKubeconfigSecrets[1]=dc3-kubeconfig' \
+      . | tee /dev/stderr |
+      yq -c '.rules | map(select(.resourceNames[0] == "dc2-kubeconfig")) | .[0]' | tee /dev/stderr)
+
+  local names=$(echo $actual | yq -r '.resourceNames | join(",")' | tee /dev/stderr)
+  [ "${names}" = "dc2-kubeconfig,dc3-kubeconfig" ]
+
+  local verbs=$(echo $actual | yq -r '.verbs | join(",")' | tee /dev/stderr)
+  [ "${verbs}" = "get" ]
+}
+
 #--------------------------------------------------------------------
 # global.acls.manageSystemACLs
 
@@ -22,3 +22,18 @@ load _helpers
       yq 'length > 0' | tee /dev/stderr)
   [ "${actual}" = "true" ]
 }
+
+@test "createFederationSecret/RoleBinding: is not a hook with global.federation.watchFederationSecret.enabled=true" {
+  cd `chart_dir`
+  local actual=$(helm template \
+      -s templates/create-federation-secret-rolebinding.yaml  \
+      --set 'global.federation.createFederationSecret=true' \
+      --set 'global.federation.watchFederationSecret.enabled=true' \
+      --set 'global.federation.enabled=true' \
+      --set 'global.tls.enabled=true' \
+      --set 'meshGateway.enabled=true' \
+      --set 'connectInject.enabled=true' \
+      . | tee /dev/stderr |
+      yq '.metadata | has("annotations")' | tee /dev/stderr)
+  [ "${actual}" = "false" ]
+}
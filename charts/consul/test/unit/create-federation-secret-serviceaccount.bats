@@ -47,3 +47,18 @@ load _helpers
       yq -r '.imagePullSecrets[1].name' | tee /dev/stderr)
   [ "${actual}" = "my-secret2" ]
 }
+
+@test "createFederationSecret/ServiceAccount: is not a hook with global.federation.watchFederationSecret.enabled=true" {
+  cd `chart_dir`
+  local actual=$(helm template \
+      -s templates/create-federation-secret-serviceaccount.yaml  \
+      --set 'global.federation.createFederationSecret=true' \
+      --set 'global.federation.watchFederationSecret.enabled=true' \
+      --set 'global.federation.enabled=true' \
+      --set 'global.tls.enabled=true' \
+      --set 'meshGateway.enabled=true' \
+      --set 'connectInject.enabled=true' \
+      . | tee /dev/stderr |
+      yq '.metadata | has("annotations")' | tee /dev/stderr)
+  [ "${actual}" = "false" ]
+}
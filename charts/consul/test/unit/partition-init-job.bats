@@ -938,3 +938,54 @@ reservedNameTest() {
   [ "${actualTemplateFoo}" = "bar" ]
   [ "${actualTemplateBaz}" = "qux" ]
 }
+
+#--------------------------------------------------------------------
+# global.adminPartitions.config
+
+@test "partitionInit/Job: partition config is not set by default" {
+  cd `chart_dir`
+  local object=$(helm template \
+      -s templates/partition-init-job.yaml \
+      --set 'global.adminPartitions.enabled=true' \
+      --set 'global.enableConsulNamespaces=true' \
+      --set 'server.enabled=false' \
+      --set 'global.adminPartitions.name=bar' \
+      --set 'externalServers.enabled=true' \
+      --set 'externalServers.hosts[0]=foo' \
+      . | tee /dev/stderr)
+
+  local actual=$(echo "$object" |
+    yq -r '.metadata.annotations["helm.sh/hook"]' | tee /dev/stderr)
+  [ "${actual}" = "pre-install" ]
+
+  actual=$(echo "$object" |
+    yq '.spec.template.spec.containers[0].command | any(contains("-config-file"))' | tee /dev/stderr)
+  [ "${actual}" = "false" ]
+}
+
+@test "partitionInit/Job: partition config is written to a file and the job runs on upgrade when global.adminPartitions.config is set" {
+  cd `chart_dir`
+  local object=$(helm template \
+      -s templates/partition-init-job.yaml \
+      --set 'global.adminPartitions.enabled=true' \
+      --set 'global.enableConsulNamespaces=true' \
+      --set 'server.enabled=false' \
+      --set 'global.adminPartitions.name=bar' \
+      --set 'externalServers.enabled=true' \
+      --set 'externalServers.hosts[0]=foo' \
+      --set 'global.adminPartitions.config.description=Team A' \
+      --set 'global.adminPartitions.config.namespaces[0].name=web' \
+      . | tee /dev/stderr)
+
+  local actual=$(echo "$object" |
+    yq -r '.metadata.annotations["helm.sh/hook"]' | tee /dev/stderr)
+  [ "${actual}" = "pre-install,pre-upgrade" ]
+
+  actual=$(echo "$object" |
+    yq '.spec.template.spec.containers[0].command | any(contains("-config-file=/tmp/partition-config.json"))' | tee /dev/stderr)
+  [ "${actual}" = "true" ]
+
+  actual=$(echo "$object" |
+    yq '.spec.template.spec.containers[0].command | any(contains("{\"description\":\"Team A\",\"namespaces\":[{\"name\":\"web\"}]}"))' | tee /dev/stderr)
+  [ "${actual}" = "true" ]
+}
@@ -1946,6 +1946,83 @@ load _helpers
   [ "${actual}" = "true" ]
 }
 
+#--------------------------------------------------------------------
+# global.acls.policyOverrides
+
+@test "serverACLInit/Job: policy overrides are not configured by default" {
+  cd `chart_dir`
+  local object=$(helm template \
+      -s templates/server-acl-init-job.yaml  \
+      --set 'global.acls.manageSystemACLs=true' \
+      . | tee /dev/stderr |
+      yq '.spec.template.spec' | tee /dev/stderr)
+
+  local actual=$(echo "$object" |
+    yq '.containers[0].command | any(contains("-policy-overrides-dir"))' | tee /dev/stderr)
+  [ "${actual}" = "false" ]
+
+  actual=$(echo "$object" |
+    yq '.containers[0].command | any(contains("-policy-allowlist-file"))' | tee /dev/stderr)
+  [ "${actual}" = "false" ]
+
+  actual=$(echo "$object" | yq '.volumes' | tee /dev/stderr)
+  [ "${actual}" = "null" ]
+}
+
+@test "serverACLInit/Job: policy overrides ConfigMap is mounted when global.acls.policyOverrides.configMapName is set" {
+  cd `chart_dir`
+  local object=$(helm template \
+      -s templates/server-acl-init-job.yaml  \
+      --set 'global.acls.manageSystemACLs=true' \
+      --set 'global.acls.policyOverrides.configMapName=overrides' \
+      . | tee /dev/stderr |
+      yq '.spec.template.spec' | tee /dev/stderr)
+
+  local actual=$(echo "$object" |
+    yq '.volumes[] | select(.name == "policy-overrides") | .configMap.name' | tee /dev/stderr)
+  [ "${actual}" = "overrides" ]
+
+  actual=$(echo "$object" |
+    yq '.containers[0].volumeMounts[] | select(.name == "policy-overrides") | .mountPath' | tee /dev/stderr)
+  [ "${actual}" = "/consul/acl/policy-overrides" ]
+
+  actual=$(echo "$object" |
+    yq '.containers[0].command | any(contains("-policy-overrides-dir=/consul/acl/policy-overrides"))' | tee /dev/stderr)
+  [ "${actual}" = "true" ]
+}
+
+@test "serverACLInit/Job: policy allowlist ConfigMap is mounted when global.acls.policyAllowlist.configMapName is set" {
+  cd `chart_dir`
+  local object=$(helm template \
+      -s templates/server-acl-init-job.yaml  \
+      --set 'global.acls.manageSystemACLs=true' \
+      --set 'global.acls.policyAllowlist.configMapName=allowlist' \
+      --set 'global.acls.policyAllowlist.configMapKey=rules.hcl' \
+      --set 'global.acls.policyAllowlist.strict=true' \
+      . | tee /dev/stderr |
+      yq '.spec.template.spec' | tee /dev/stderr)
+
+  local actual=$(echo "$object" |
+    yq '.volumes[] | select(.name == "policy-allowlist") | .configMap.name' | tee /dev/stderr)
+  [ "${actual}" = "allowlist" ]
+
+  actual=$(echo "$object" |
+    yq '.volumes[] | select(.name == "policy-allowlist") | .configMap.items[0].key' | tee /dev/stderr)
+  [ "${actual}" = "rules.hcl" ]
+
+  actual=$(echo "$object" |
+    yq '.containers[0].volumeMounts[] | select(.name == "policy-allowlist") | .mountPath' | tee /dev/stderr)
+  [ "${actual}" = "/consul/acl/policy-allowlist" ]
+
+  actual=$(echo "$object" |
+    yq '.containers[0].command | any(contains("-policy-allowlist-file=/consul/acl/policy-allowlist/allowlist.hcl"))' | tee /dev/stderr)
+  [ "${actual}" = "true" ]
+
+  actual=$(echo "$object" |
+    yq '.containers[0].command | any(contains("-strict-policy-allowlist=true"))' | tee /dev/stderr)
+  [ "${actual}" = "true" ]
+}
+
 #--------------------------------------------------------------------
 # global.cloud
 
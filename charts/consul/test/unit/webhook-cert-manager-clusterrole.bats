@@ -24,7 +24,7 @@ load _helpers
 #--------------------------------------------------------------------
 # rules
 
-@test "webhookCertManager/ClusterRole: sets full access to secrets" {
+@test "webhookCertManager/ClusterRole: sets create access to secrets" {
   cd `chart_dir`
   local object=$(helm template \
       -s templates/webhook-cert-manager-clusterrole.yaml  \
@@ -38,26 +38,42 @@ load _helpers
   local actual=$(echo $object | yq -r '.apiGroups[0]' | tee /dev/stderr)
   [ "${actual}" = "" ]
 
-  local actual=$(echo $object | yq -r '.verbs | index("create")' | tee /dev/stderr)
-  [ "${actual}" != null ]
-
-  local actual=$(echo $object | yq -r '.verbs | index("delete")' | tee /dev/stderr)
-  [ "${actual}" != null ]
+  local actual=$(echo $object | yq -r '.verbs | join(",")' | tee /dev/stderr)
+  [ "${actual}" = "create" ]
+}
 
-  local actual=$(echo $object | yq -r '.verbs | index("get")' | tee /dev/stderr)
-  [ "${actual}" != null ]
+@test "webhookCertManager/ClusterRole: scopes the other access to secrets to the webhook certificate secrets" {
+  cd `chart_dir`
+  local object=$(helm template \
+      -s templates/webhook-cert-manager-clusterrole.yaml  \
+      --set 'connectInject.enabled=true' \
+      . | tee /dev/stderr |
+      yq -r '.rules[1]' | tee /dev/stderr)
 
-  local actual=$(echo $object | yq -r '.verbs | index("list")' | tee /dev/stderr)
-  [ "${actual}" != null ]
+  local actual=$(echo $object | yq -r '.resources[0]' | tee /dev/stderr)
+  [ "${actual}" = "secrets" ]
 
-  local actual=$(echo $object | yq -r '.verbs | index("patch")' | tee /dev/stderr)
-  [ "${actual}" != null ]
+  local actual=$(echo $object | yq -r '.resourceNames | join(",")' | tee /dev/stderr)
+  [ "${actual}" = "release-name-consul-connect-inject-webhook-cert" ]
 
-  local actual=$(echo $object | yq -r '.verbs | index("update")' | tee /dev/stderr)
-  [ "${actual}" != null ]
+  local actual=$(echo $object | yq -r '.verbs | join(",")' | tee /dev/stderr)
+  [ "${actual}" = "delete,get,list,patch,update,watch" ]
+}
 
-  local actual=$(echo $object | yq -r '.verbs | index("watch")' | tee /dev/stderr)
-  [ "${actual}" != null ]
+@test "webhookCertManager/ClusterRole: allows access to the cert-manager and extra webhook secrets" {
+  cd `chart_dir`
+  local actual=$(helm template \
+      -s templates/webhook-cert-manager-clusterrole.yaml  \
+      --set 'connectInject.enabled=true' \
+      --set 'webhookCertManager.certSource.type=cert-manager' \
+      --set 'webhookCertManager.certSource.certManager.secretName=inject-cert' \
+      --set 'webhookCertManager.extraWebhooks[0].name=foo' \
+      --set 'webhookCertManager.extraWebhooks[0].secretName=foo-cert' \
+      --set 'webhookCertManager.extraWebhooks[0].source.type=cert-manager' \
+      --set 'webhookCertManager.extraWebhooks[0].source.certManager.secretName=foo-issued-cert' \
+      . | tee /dev/stderr |
+      yq -r '.rules[1].resourceNames | join(",")' | tee /dev/stderr)
+  [ "${actual}" = "release-name-consul-connect-inject-webhook-cert,inject-cert,foo-cert,foo-issued-cert" ]
 }
 
 @test "webhookCertManager/ClusterRole: sets get, list, watch, and patch access to mutatingwebhookconfigurations" {
@@ -66,7 +82,7 @@ load _helpers
       -s templates/webhook-cert-manager-clusterrole.yaml  \
       --set 'connectInject.enabled=true' \
       . | tee /dev/stderr |
-      yq -r '.rules[1]' | tee /dev/stderr)
+      yq -r '.rules[2]' | tee /dev/stderr)
 
   local actual=$(echo $object | yq -r '.resources[0]' | tee /dev/stderr)
   [ "${actual}" = "mutatingwebhookconfigurations" ]
@@ -87,13 +103,49 @@ load _helpers
   [ "${actual}" != null ]
 }
 
+@test "webhookCertManager/ClusterRole: sets get, list, watch, and patch access to validatingwebhookconfigurations" {
+  cd `chart_dir`
+  local object=$(helm template \
+      -s templates/webhook-cert-manager-clusterrole.yaml  \
+      --set 'connectInject.enabled=true' \
+      . | tee /dev/stderr |
+      yq -r '.rules[3]' | tee /dev/stderr)
+
+  local actual=$(echo $object | yq -r '.resources[0]' | tee /dev/stderr)
+  [ "${actual}" = "validatingwebhookconfigurations" ]
+
+  local actual=$(echo $object | yq -r '.apiGroups[0]' | tee /dev/stderr)
+  [ "${actual}" = "admissionregistration.k8s.io" ]
+
+  local actual=$(echo $object | yq -r '.verbs | join(",")' | tee /dev/stderr)
+  [ "${actual}" = "get,list,watch,patch" ]
+}
+
+@test "webhookCertManager/ClusterRole: sets get and patch access to customresourcedefinitions" {
+  cd `chart_dir`
+  local object=$(helm template \
+      -s templates/webhook-cert-manager-clusterrole.yaml  \
+      --set 'connectInject.enabled=true' \
+      . | tee /dev/stderr |
+      yq -r '.rules[4]' | tee /dev/stderr)
+
+  local actual=$(echo $object | yq -r '.resources[0]' | tee /dev/stderr)
+  [ "${actual}" = "customresourcedefinitions" ]
+
+  local actual=$(echo $object | yq -r '.apiGroups[0]' | tee /dev/stderr)
+  [ "${actual}" = "apiextensions.k8s.io" ]
+
+  local actual=$(echo $object | yq -r '.verbs | join(",")' | tee /dev/stderr)
+  [ "${actual}" = "get,patch" ]
+}
+
 @test "webhookCertManager/ClusterRole: sets get access to deployments" {
   cd `chart_dir`
   local object=$(helm template \
       -s templates/webhook-cert-manager-clusterrole.yaml  \
       --set 'connectInject.enabled=true' \
       . | tee /dev/stderr |
-      yq -r '.rules[2]' | tee /dev/stderr)
+      yq -r '.rules[5]' | tee /dev/stderr)
 
   local actual=$(echo $object | yq -r '.resources[0]' | tee /dev/stderr)
   [ "${actual}" = "deployments" ]
@@ -118,7 +170,7 @@ load _helpers
       --set 'connectInject.enabled=true' \
       --set 'global.enablePodSecurityPolicies=true' \
       . | tee /dev/stderr |
-      yq -r '.rules[3]' | tee /dev/stderr)
+      yq -r '.rules[6]' | tee /dev/stderr)
 
   local actual=$(echo $object | yq -r '.resources[0]' | tee /dev/stderr)
   [ "${actual}" = "podsecuritypolicies" ]
@@ -41,3 +41,169 @@ load _helpers
       --set 'global.secretsBackend.vault.consulCARole=test2' \
       .
 }
+
+#--------------------------------------------------------------------
+# certSource
+
+@test "webhookCertManager/Configmap: no source by default" {
+  cd `chart_dir`
+  local actual=$(helm template \
+      -s templates/webhook-cert-manager-configmap.yaml  \
+      . | tee /dev/stderr |
+      yq -r '.data["webhook-config.json"]' | yq '.[0] | has("source")' | tee /dev/stderr)
+  [ "${actual}" = "false" ]
+}
+
+@test "webhookCertManager/Configmap: fails with an invalid certSource.type" {
+  cd `chart_dir`
+  run helm template \
+      -s templates/webhook-cert-manager-configmap.yaml  \
+      --set 'webhookCertManager.certSource.type=foo' .
+  [ "$status" -eq 1 ]
+  [[ "$output" =~ "webhookCertManager.certSource.type must be one of \"self-signed\", \"cert-manager\", \"vault\" or \"file\"" ]]
+}
+
+@test "webhookCertManager/Configmap: fails with certSource.type=cert-manager and no secretName" {
+  cd `chart_dir`
+  run helm template \
+      -s templates/webhook-cert-manager-configmap.yaml  \
+      --set 'webhookCertManager.certSource.type=cert-manager' .
+  [ "$status" -eq 1 ]
+  [[ "$output" =~ "webhookCertManager.certSource.certManager.secretName must be set if webhookCertManager.certSource.type is cert-manager" ]]
+}
+
+@test "webhookCertManager/Configmap: sets a cert-manager source" {
+  cd `chart_dir`
+  local object=$(helm template \
+      -s templates/webhook-cert-manager-configmap.yaml  \
+      --set 'webhookCertManager.certSource.type=cert-manager' \
+      --set 'webhookCertManager.certSource.certManager.secretName=inject-cert' \
+      . | tee /dev/stderr |
+      yq -r '.data["webhook-config.json"]' | yq -c '.[0].source' | tee /dev/stderr)
+
+  local actual=$(echo $object | yq -r '.type' | tee /dev/stderr)
+  [ "${actual}" = "cert-manager" ]
+
+  local actual=$(echo $object | yq -r '.certManager.secretName' | tee /dev/stderr)
+  [ "${actual}" = "inject-cert" ]
+
+  local actual=$(echo $object | yq -r '.certManager.secretNamespace' | tee /dev/stderr)
+  [ "${actual}" = "default" ]
+}
+
+@test "webhookCertManager/Configmap: fails with certSource.type=vault and no address or pkiRole" {
+  cd `chart_dir`
+  run helm template \
+      -s templates/webhook-cert-manager-configmap.yaml  \
+      --set 'webhookCertManager.certSource.type=vault' \
+      --set 'webhookCertManager.certSource.vault.address=https://vault:8200' .
+  [ "$status" -eq 1 ]
+  [[ "$output" =~ "webhookCertManager.certSource.vault.address and webhookCertManager.certSource.vault.pkiRole must be set if webhookCertManager.certSource.type is vault" ]]
+}
+
+@test "webhookCertManager/Configmap: sets a vault source" {
+  cd `chart_dir`
+  local object=$(helm template \
+      -s templates/webhook-cert-manager-configmap.yaml  \
+      --set 'webhookCertManager.certSource.type=vault' \
+      --set 'webhookCertManager.certSource.vault.address=https://vault:8200' \
+      --set 'webhookCertManager.certSource.vault.role=webhook' \
+      --set 'webhookCertManager.certSource.vault.pkiRole=webhook-cert' \
+      . | tee /dev/stderr |
+      yq -r '.data["webhook-config.json"]' | yq -c '.[0].source' | tee /dev/stderr)
+
+  local actual=$(echo $object | yq -r '.type' | tee /dev/stderr)
+  [ "${actual}" = "vault" ]
+
+  local actual=$(echo $object | yq -r '.vault.address' | tee /dev/stderr)
+  [ "${actual}" = "https://vault:8200" ]
+
+  local actual=$(echo $object | yq -r '.vault.authMethodPath' | tee /dev/stderr)
+  [ "${actual}" = "kubernetes" ]
+
+  local actual=$(echo $object | yq -r '.vault.role' | tee /dev/stderr)
+  [ "${actual}" = "webhook" ]
+
+  local actual=$(echo $object | yq -r '.vault.pkiPath' | tee /dev/stderr)
+  [ "${actual}" = "pki" ]
+
+  local actual=$(echo $object | yq -r '.vault.pkiRole' | tee /dev/stderr)
+  [ "${actual}" = "webhook-cert" ]
+
+  local actual=$(echo $object | yq -r '.vault.caCertFile' | tee /dev/stderr)
+  [ "${actual}" = "" ]
+}
+
+@test "webhookCertManager/Configmap: sets the vault source CA file when global.secretsBackend.vault.ca is set" {
+  cd `chart_dir`
+  local actual=$(helm template \
+      -s templates/webhook-cert-manager-configmap.yaml  \
+      --set 'webhookCertManager.certSource.type=vault' \
+      --set 'webhookCertManager.certSource.vault.address=https://vault:8200' \
+      --set 'webhookCertManager.certSource.vault.pkiRole=webhook-cert' \
+      --set 'global.secretsBackend.vault.ca.secretName=vault-ca' \
+      --set 'global.secretsBackend.vault.ca.secretKey=ca.crt' \
+      . | tee /dev/stderr |
+      yq -r '.data["webhook-config.json"]' | yq -r '.[0].source.vault.caCertFile' | tee /dev/stderr)
+  [ "${actual}" = "/consul/vault-ca/tls.crt" ]
+}
+
+@test "webhookCertManager/Configmap: fails with certSource.type=file and missing files" {
+  cd `chart_dir`
+  run helm template \
+      -s templates/webhook-cert-manager-configmap.yaml  \
+      --set 'webhookCertManager.certSource.type=file' \
+      --set 'webhookCertManager.certSource.file.certFile=/consul/userconfig/certs/tls.crt' .
+  [ "$status" -eq 1 ]
+  [[ "$output" =~ "webhookCertManager.certSource.file.certFile, keyFile and caFile must be set if webhookCertManager.certSource.type is file" ]]
+}
+
+@test "webhookCertManager/Configmap: sets a file source" {
+  cd `chart_dir`
+  local object=$(helm template \
+      -s templates/webhook-cert-manager-configmap.yaml  \
+      --set 'webhookCertManager.certSource.type=file' \
+      --set 'webhookCertManager.certSource.file.certFile=/consul/userconfig/certs/tls.crt' \
+      --set 'webhookCertManager.certSource.file.keyFile=/consul/userconfig/certs/tls.key' \
+      --set 'webhookCertManager.certSource.file.caFile=/consul/userconfig/certs/ca.crt' \
+      . | tee /dev/stderr |
+      yq -r '.data["webhook-config.json"]' | yq -c '.[0].source' | tee /dev/stderr)
+
+  local actual=$(echo $object | yq -r '.type' | tee /dev/stderr)
+  [ "${actual}" = "file" ]
+
+  local actual=$(echo $object | yq -r '.file.certFile' | tee /dev/stderr)
+  [ "${actual}" = "/consul/userconfig/certs/tls.crt" ]
+
+  local actual=$(echo $object | yq -r '.file.keyFile' | tee /dev/stderr)
+  [ "${actual}" = "/consul/userconfig/certs/tls.key" ]
+
+  local actual=$(echo $object | yq -r '.file.caFile' | tee /dev/stderr)
+  [ "${actual}" = "/consul/userconfig/certs/ca.crt" ]
+}
+
+#--------------------------------------------------------------------
+# extraWebhooks
+
+@test "webhookCertManager/Configmap: adds extraWebhooks" {
+  cd `chart_dir`
+  local object=$(helm template \
+      -s templates/webhook-cert-manager-configmap.yaml  \
+      --set 'webhookCertManager.extraWebhooks[0].name=foo' \
+      --set 'webhookCertManager.extraWebhooks[0].secretName=foo-cert' \
+      --set 'webhookCertManager.extraWebhooks[0].secretNamespace=bar' \
+      . | tee /dev/stderr |
+      yq -r '.data["webhook-config.json"]' | tee /dev/stderr)
+
+  local actual=$(echo $object | yq 'length' | tee /dev/stderr)
+  [ "${actual}" = "2" ]
+
+  local actual=$(echo $object | yq -r '.[1].name' | tee /dev/stderr)
+  [ "${actual}" = "foo" ]
+
+  local actual=$(echo $object | yq -r '.[1].secretName' | tee /dev/stderr)
+  [ "${actual}" = "foo-cert" ]
+
+  local actual=$(echo $object | yq -r '.[1].secretNamespace' | tee /dev/stderr)
+  [ "${actual}" = "bar" ]
+}
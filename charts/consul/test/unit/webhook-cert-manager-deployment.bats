@@ -124,3 +124,55 @@ load _helpers
   [ "${actualTemplateFoo}" = "bar" ]
   [ "${actualTemplateBaz}" = "qux" ]
 }
+
+#--------------------------------------------------------------------
+# certSource
+
+@test "webhookCertManager/Deployment: no vault-ca volume by default" {
+  cd `chart_dir`
+  local actual=$(helm template \
+      -s templates/webhook-cert-manager-deployment.yaml  \
+      --set 'global.secretsBackend.vault.ca.secretName=vault-ca' \
+      --set 'global.secretsBackend.vault.ca.secretKey=ca.crt' \
+      . | tee /dev/stderr |
+      yq '.spec.template.spec.volumes[] | select(.name == "vault-ca")' | tee /dev/stderr)
+  [ "${actual}" = "" ]
+}
+
+@test "webhookCertManager/Deployment: mounts the vault-ca volume with certSource.type=vault" {
+  cd `chart_dir`
+  local object=$(helm template \
+      -s templates/webhook-cert-manager-deployment.yaml  \
+      --set 'webhookCertManager.certSource.type=vault' \
+      --set 'webhookCertManager.certSource.vault.address=https://vault:8200' \
+      --set 'webhookCertManager.certSource.vault.pkiRole=webhook-cert' \
+      --set 'global.secretsBackend.vault.ca.secretName=vault-ca' \
+      --set 'global.secretsBackend.vault.ca.secretKey=ca.crt' \
+      . | tee /dev/stderr |
+      yq -c '.spec.template.spec' | tee /dev/stderr)
+
+  local actual=$(echo $object | yq -r '.volumes[] | select(.name == "vault-ca") | .secret.secretName' | tee /dev/stderr)
+  [ "${actual}" = "vault-ca" ]
+
+  local actual=$(echo $object | yq -r '.volumes[] | select(.name == "vault-ca") | .secret.items[0].key' | tee /dev/stderr)
+  [ "${actual}" = "ca.crt" ]
+
+  local actual=$(echo $object | yq -r '.containers[0].volumeMounts[] | select(.name == "vault-ca") | .mountPath' | tee /dev/stderr)
+  [ "${actual}" = "/consul/vault-ca/" ]
+}
+
+@test "webhookCertManager/Deployment: adds extra volumes" {
+  cd `chart_dir`
+  local object=$(helm template \
+      -s templates/webhook-cert-manager-deployment.yaml  \
+      --set 'webhookCertManager.extraVolumes[0].type=secret' \
+      --set 'webhookCertManager.extraVolumes[0].name=certs' \
+      . | tee /dev/stderr |
+      yq -c '.spec.template.spec' | tee /dev/stderr)
+
+  local actual=$(echo $object | yq -r '.volumes[] | select(.name == "userconfig-certs") | .secret.secretName' | tee /dev/stderr)
+  [ "${actual}" = "certs" ]
+
+  local actual=$(echo $object | yq -r '.containers[0].volumeMounts[] | select(.name == "userconfig-certs") | .mountPath' | tee /dev/stderr)
+  [ "${actual}" = "/consul/userconfig/certs" ]
+}
@@ -18,6 +18,7 @@ import (
 )
 
 const (
+	flagNameOutput      = "output"
 	flagNameKubeConfig  = "kubeconfig"
 	flagNameKubeContext = "context"
 )
@@ -31,6 +32,8 @@ type ReadCommand struct {
 
 	set *flag.Sets
 
+	flagOutput string
+
 	flagKubeConfig  string
 	flagKubeContext string
 
@@ -41,7 +44,16 @@ type ReadCommand struct {
 func (c *ReadCommand) init() {
 	c.set = flag.NewSets()
 
-	f := c.set.NewSet("Global Options")
+	f := c.set.NewSet("Command Options")
+	f.StringVar(&flag.StringVar{
+		Name:    flagNameOutput,
+		Target:  &c.flagOutput,
+		Default: terminal.FormatTable,
+		Usage:   terminal.OutputUsage("the config") + " The table format is the config as YAML.",
+		Aliases: []string{"o"},
+	})
+
+	f = c.set.NewSet("Global Options")
 	f.StringVar(&flag.StringVar{
 		Name:    "kubeconfig",
 		Aliases: []string{"c"},
@@ -93,11 +105,17 @@ func (c *ReadCommand) Run(args []string) int {
 		return 1
 	}
 
-	// Setup logger to stream Helm library logs.
+	// Setup logger to stream Helm library logs. Structured output is kept parseable
+	// by sending them to the debug log instead.
 	var uiLogger = func(s string, args ...interface{}) {
 		logMsg := fmt.Sprintf(s, args...)
 		c.UI.Output(logMsg, terminal.WithLibraryStyle())
 	}
+	if terminal.Structured(c.flagOutput) {
+		uiLogger = func(s string, args ...interface{}) {
+			c.Log.Debug(fmt.Sprintf(s, args...))
+		}
+	}
 
 	_, releaseName, namespace, err := c.helmActionsRunner.CheckForInstallations(&helm.CheckForInstallationsOptions{
 		Settings:    settings,
@@ -122,7 +140,7 @@ func (c *ReadCommand) validateFlags() error {
 	if len(c.set.Args()) > 0 {
 		return errors.New("should have no non-flag arguments")
 	}
-	return nil
+	return terminal.ValidateFormat(c.flagOutput)
 }
 
 // AutocompleteFlags returns a mapping of supported flags and autocomplete
@@ -130,6 +148,7 @@ func (c *ReadCommand) validateFlags() error {
 // complete flag such as "-foo" or "--foo".
 func (c *ReadCommand) AutocompleteFlags() complete.Flags {
 	return complete.Flags{
+		fmt.Sprintf("-%s", flagNameOutput):      complete.PredictSet(terminal.Formats...),
 		fmt.Sprintf("-%s", flagNameKubeConfig):  complete.PredictFiles("*"),
 		fmt.Sprintf("-%s", flagNameKubeContext): complete.PredictNothing,
 	}
@@ -162,9 +181,12 @@ func (c *ReadCommand) checkHelmInstallation(settings *helmCLI.EnvSettings, uiLog
 	if err != nil {
 		return err
 	}
-	c.UI.Output(string(valuesYaml))
 
-	return nil
+	values := rel.Config
+	if values == nil {
+		values = map[string]interface{}{}
+	}
+	return terminal.Render(c.UI, c.flagOutput, values, func() { c.UI.Output(string(valuesYaml)) })
 }
 
 // setupKubeClient to use for non Helm SDK calls to the Kubernetes API The Helm SDK will use
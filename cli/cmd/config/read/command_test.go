@@ -92,6 +92,50 @@ func TestConfigRead(t *testing.T) {
 	}
 }
 
+func TestConfigReadOutput(t *testing.T) {
+	cases := map[string]struct {
+		config   map[string]interface{}
+		output   string
+		expected string
+	}{
+		"json": {
+			config:   map[string]interface{}{"global": map[string]interface{}{"name": "consul"}},
+			output:   "json",
+			expected: "{\n\t\"global\": {\n\t\t\"name\": \"consul\"\n\t}\n}\n",
+		},
+		"json with no config": {
+			output:   "json",
+			expected: "{}\n",
+		},
+		"template": {
+			config:   map[string]interface{}{"global": map[string]interface{}{"name": "consul"}},
+			output:   "template={{.global.name}}",
+			expected: "consul\n",
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			buf := new(bytes.Buffer)
+			c := getInitializedCommand(t, buf)
+			c.kubernetes = fake.NewSimpleClientset()
+			c.helmActionsRunner = &helm.MockActionRunner{
+				GetStatusFunc: func(status *action.Status, name string) (*helmRelease.Release, error) {
+					return &helmRelease.Release{Name: "consul", Namespace: "consul", Config: tc.config}, nil
+				},
+			}
+			require.Equal(t, 0, c.Run([]string{"-output", tc.output}))
+			require.Equal(t, tc.expected, buf.String())
+		})
+	}
+}
+
+func TestConfigReadInvalidOutput(t *testing.T) {
+	buf := new(bytes.Buffer)
+	c := getInitializedCommand(t, buf)
+	require.Equal(t, 1, c.Run([]string{"-output", "xml"}))
+	require.Contains(t, buf.String(), "-output must be one of table, json, yaml, or template=<template>")
+}
+
 func TestTaskCreateCommand_AutocompleteFlags(t *testing.T) {
 	t.Parallel()
 	cmd := getInitializedCommand(t, nil)
@@ -0,0 +1,44 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package validate
+
+import (
+	"github.com/hashicorp/consul-k8s/cli/common"
+)
+
+// subcommand is the consul-k8s-control-plane subcommand that validates the
+// manifests.
+var subcommand = []string{"config", "validate"}
+
+// ValidateCommand validates Consul custom resource manifests by running the
+// consul-k8s-control-plane binary, which has the admission webhooks'
+// validation. Go programs that depend on the control-plane module can run the
+// same validation with its api/validate package instead.
+type ValidateCommand struct {
+	*common.BaseCommand
+}
+
+// Run validates the manifests. The flags are passed to
+// consul-k8s-control-plane and its exit code is returned.
+func (c *ValidateCommand) Run(args []string) int {
+	c.Log.ResetNamed("config validate")
+	defer common.CloseWithError(c.BaseCommand)
+
+	return common.RunControlPlane(c.Ctx, c.UI, subcommand, args)
+}
+
+// Help returns the help of the consul-k8s-control-plane command.
+func (c *ValidateCommand) Help() string {
+	return common.ControlPlaneHelp(subcommand, "consul-k8s config validate", help)
+}
+
+// Synopsis returns a one-line command summary.
+func (c *ValidateCommand) Synopsis() string {
+	return "Validate Consul custom resource manifests."
+}
+
+const help = `Usage: consul-k8s config validate -f <path> [options]
+
+  Validates the Consul custom resources in Kubernetes manifests the same way
+  the admission webhooks do, without a Kubernetes cluster or Consul servers.`
@@ -0,0 +1,36 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package validate
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hashicorp/consul-k8s/cli/common"
+	"github.com/hashicorp/consul-k8s/cli/common/terminal"
+)
+
+func TestRun_ControlPlaneNotInstalled(t *testing.T) {
+	t.Setenv(common.EnvControlPlanePath, "")
+	t.Setenv("PATH", t.TempDir())
+	buf := &bytes.Buffer{}
+	c := &ValidateCommand{
+		BaseCommand: &common.BaseCommand{
+			Log: hclog.NewNullLogger(),
+			UI:  terminal.NewUI(context.Background(), buf),
+		},
+	}
+
+	require.Equal(t, 1, c.Run([]string{"-f", "manifests"}))
+	require.Contains(t, buf.String(), "consul-k8s config validate requires consul-k8s-control-plane")
+	require.Contains(t, buf.String(), common.EnvControlPlanePath)
+
+	help := c.Help()
+	require.Contains(t, help, "Usage: consul-k8s config validate")
+	require.Contains(t, help, "consul-k8s config validate requires the consul-k8s-control-plane binary")
+}
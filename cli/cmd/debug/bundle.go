@@ -0,0 +1,189 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package debug
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+// manifestFileName is the name of the file in the bundle that describes its
+// contents.
+const manifestFileName = "manifest.json"
+
+// bundle holds the files of a debug bundle in memory until it is written out
+// as a tarball. Files are redacted as they are added, and are truncated or
+// skipped once the bundle reaches its maximum size. It is safe to add files
+// concurrently.
+type bundle struct {
+	mu sync.Mutex
+
+	maxSize int64
+	size    int64
+	files   map[string][]byte
+
+	manifest manifest
+}
+
+// manifest describes the contents of a bundle and how it was collected.
+type manifest struct {
+	CreatedAt  time.Time     `json:"createdAt"`
+	CLIVersion string        `json:"cliVersion"`
+	Release    releaseInfo   `json:"release"`
+	Namespaces []string      `json:"namespaces"`
+	Pods       []string      `json:"pods,omitempty"`
+	Since      string        `json:"since"`
+	MaxSize    int64         `json:"maxSize"`
+	Files      []fileInfo    `json:"files"`
+	Errors     []bundleError `json:"errors,omitempty"`
+}
+
+// releaseInfo is the Helm release the bundle was collected for.
+type releaseInfo struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+}
+
+// fileInfo describes a file that was collected. Skipped files are listed
+// without content because the bundle was already full.
+type fileInfo struct {
+	Path      string `json:"path"`
+	Size      int    `json:"size"`
+	Truncated bool   `json:"truncated,omitempty"`
+	Skipped   bool   `json:"skipped,omitempty"`
+}
+
+// bundleError is an error that prevented part of the bundle from being
+// collected.
+type bundleError struct {
+	Collector string `json:"collector"`
+	Error     string `json:"error"`
+}
+
+func newBundle(maxSize int64, m manifest) *bundle {
+	m.MaxSize = maxSize
+	return &bundle{
+		maxSize:  maxSize,
+		files:    make(map[string][]byte),
+		manifest: m,
+	}
+}
+
+// add redacts the data and adds it to the bundle at the given path.
+func (b *bundle) add(name string, data []byte) {
+	data = Redact(data)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	info := fileInfo{Path: name, Size: len(data)}
+	remaining := b.maxSize - b.size
+	switch {
+	case remaining <= 0:
+		info.Skipped = true
+		data = nil
+	case int64(len(data)) > remaining:
+		info.Truncated = true
+		data = data[:remaining]
+	}
+
+	b.size += int64(len(data))
+	b.files[name] = data
+	b.manifest.Files = append(b.manifest.Files, info)
+}
+
+// addJSON adds the value to the bundle as indented JSON.
+func (b *bundle) addJSON(name string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshalling %s: %w", name, err)
+	}
+	b.add(name, data)
+	return nil
+}
+
+// addYAML adds the value to the bundle as YAML.
+func (b *bundle) addYAML(name string, v interface{}) error {
+	data, err := yaml.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("error marshalling %s: %w", name, err)
+	}
+	b.add(name, data)
+	return nil
+}
+
+// addError records that the collector failed.
+func (b *bundle) addError(collector string, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.manifest.Errors = append(b.manifest.Errors, bundleError{Collector: collector, Error: err.Error()})
+}
+
+// full returns true if no more data can be added to the bundle.
+func (b *bundle) full() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.size >= b.maxSize
+}
+
+// write writes the bundle as a gzipped tarball with all files in the given
+// directory. The manifest is written last and doesn't count towards the
+// maximum size.
+func (b *bundle) write(w io.Writer, dir string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	sort.Slice(b.manifest.Files, func(i, j int) bool {
+		return b.manifest.Files[i].Path < b.manifest.Files[j].Path
+	})
+	sort.Slice(b.manifest.Errors, func(i, j int) bool {
+		return b.manifest.Errors[i].Collector < b.manifest.Errors[j].Collector
+	})
+	manifest, err := json.MarshalIndent(b.manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshalling manifest: %w", err)
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	writeFile := func(name string, data []byte) error {
+		hdr := &tar.Header{
+			Name:    path.Join(dir, name),
+			Mode:    0600,
+			Size:    int64(len(data)),
+			ModTime: b.manifest.CreatedAt,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		_, err := tw.Write(data)
+		return err
+	}
+
+	for _, f := range b.manifest.Files {
+		if f.Skipped {
+			continue
+		}
+		if err := writeFile(f.Path, b.files[f.Path]); err != nil {
+			return fmt.Errorf("error writing %s to bundle: %w", f.Path, err)
+		}
+	}
+	if err := writeFile(manifestFileName, manifest); err != nil {
+		return fmt.Errorf("error writing manifest to bundle: %w", err)
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
@@ -0,0 +1,84 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package debug
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBundle_MaxSize(t *testing.T) {
+	b := newBundle(10, manifest{})
+	b.add("a.txt", []byte("123456"))
+	require.False(t, b.full())
+	b.add("b.txt", []byte("123456"))
+	require.True(t, b.full())
+	b.add("c.txt", []byte("123456"))
+
+	require.Equal(t, []fileInfo{
+		{Path: "a.txt", Size: 6},
+		{Path: "b.txt", Size: 6, Truncated: true},
+		{Path: "c.txt", Size: 6, Skipped: true},
+	}, b.manifest.Files)
+	require.Equal(t, "1234", string(b.files["b.txt"]))
+}
+
+func TestBundle_Write(t *testing.T) {
+	createdAt := time.Date(2023, 4, 1, 12, 0, 0, 0, time.UTC)
+	b := newBundle(1024, manifest{
+		CreatedAt: createdAt,
+		Release:   releaseInfo{Name: "consul", Namespace: "consul"},
+	})
+	b.add("logs/consul/consul-server-0/consul.log", []byte("-token=abc123"))
+	require.NoError(t, b.addJSON("consul/leader.json", "10.0.0.1:8300"))
+	b.addError("envoy", errors.New("connection refused"))
+
+	var buf bytes.Buffer
+	require.NoError(t, b.write(&buf, "consul-k8s-debug"))
+
+	files := readArchive(t, &buf)
+	require.Equal(t, map[string]string{
+		"consul-k8s-debug/consul/leader.json":                     `"10.0.0.1:8300"`,
+		"consul-k8s-debug/logs/consul/consul-server-0/consul.log": "-token=<redacted>",
+		"consul-k8s-debug/manifest.json":                          files["consul-k8s-debug/manifest.json"],
+	}, files)
+
+	var m manifest
+	require.NoError(t, json.Unmarshal([]byte(files["consul-k8s-debug/manifest.json"]), &m))
+	require.Equal(t, createdAt, m.CreatedAt)
+	require.Equal(t, int64(1024), m.MaxSize)
+	require.Equal(t, []fileInfo{
+		{Path: "consul/leader.json", Size: 15},
+		{Path: "logs/consul/consul-server-0/consul.log", Size: 17},
+	}, m.Files)
+	require.Equal(t, []bundleError{{Collector: "envoy", Error: "connection refused"}}, m.Errors)
+}
+
+// readArchive returns the contents of the files in a gzipped tarball.
+func readArchive(t *testing.T, r io.Reader) map[string]string {
+	gz, err := gzip.NewReader(r)
+	require.NoError(t, err)
+	tr := tar.NewReader(gz)
+
+	files := make(map[string]string)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		data, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		files[hdr.Name] = string(data)
+	}
+	return files
+}
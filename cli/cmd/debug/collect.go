@@ -0,0 +1,439 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package debug
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"helm.sh/helm/v3/pkg/action"
+	helmCLI "helm.sh/helm/v3/pkg/cli"
+	v1 "k8s.io/api/core/v1"
+	apiextv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/hashicorp/consul-k8s/cli/common"
+	"github.com/hashicorp/consul-k8s/cli/common/terminal"
+	"github.com/hashicorp/consul-k8s/cli/helm"
+)
+
+const (
+	// defaultAdminPort is the port where the Envoy admin API is exposed.
+	defaultAdminPort = 19000
+
+	// maxConcurrentProxies is how many proxies are dumped at the same time.
+	maxConcurrentProxies = 8
+)
+
+// proxySelectors select the Pods that run Envoy proxies: Pods with injected
+// sidecars and gateways.
+var proxySelectors = []string{
+	"consul.hashicorp.com/connect-inject-status=injected",
+	"component in (ingress-gateway, mesh-gateway, terminating-gateway), chart=consul-helm",
+	"api-gateway.consul.hashicorp.com/managed=true",
+}
+
+// consulEndpoints are the Consul HTTP API endpoints that are collected, keyed
+// by the name of the file they are written to.
+var consulEndpoints = map[string]string{
+	"members.json":            "/v1/agent/members",
+	"leader.json":             "/v1/status/leader",
+	"raft-configuration.json": "/v1/operator/raft/configuration",
+	"catalog-nodes.json":      "/v1/catalog/nodes",
+	"catalog-services.json":   "/v1/catalog/services",
+	"peerings.json":           "/v1/peerings",
+}
+
+// collectOptions are what the collectors collect data for.
+type collectOptions struct {
+	settings         *helmCLI.EnvSettings
+	releaseName      string
+	releaseNamespace string
+	namespaces       []string
+	pods             []podRef
+}
+
+// collect runs each collector in turn. A collector that fails is recorded in
+// the manifest and doesn't prevent the others from running.
+func (c *Command) collect(ctx context.Context, b *bundle, opts collectOptions) {
+	collectors := []struct {
+		name string
+		fn   func(context.Context, *bundle, collectOptions) error
+	}{
+		{"helm", c.collectHelm},
+		{"kubernetes", c.collectKubernetes},
+		{"logs", c.collectLogs},
+		{"custom resources", c.collectCustomResources},
+		{"envoy", c.collectEnvoy},
+		{"consul", c.collectConsul},
+	}
+	for _, collector := range collectors {
+		c.UI.Output("Collecting %s", collector.name, terminal.WithInfoStyle())
+		if err := collector.fn(ctx, b, opts); err != nil {
+			b.addError(collector.name, err)
+		}
+	}
+}
+
+// collectHelm collects the status and the values of the Helm release.
+func (c *Command) collectHelm(_ context.Context, b *bundle, opts collectOptions) error {
+	debugLog := func(format string, v ...interface{}) {
+		c.Log.Debug(fmt.Sprintf(format, v...))
+	}
+	statusConfig, err := helm.InitActionConfig(new(action.Configuration), opts.releaseNamespace, opts.settings, debugLog)
+	if err != nil {
+		return err
+	}
+	rel, err := c.helmActionsRunner.GetStatus(action.NewStatus(statusConfig), opts.releaseName)
+	if err != nil {
+		return fmt.Errorf("couldn't get the status of the release: %w", err)
+	}
+
+	status := map[string]interface{}{
+		"name":      rel.Name,
+		"namespace": rel.Namespace,
+		"revision":  rel.Version,
+	}
+	if rel.Info != nil {
+		status["status"] = rel.Info.Status.String()
+		status["description"] = rel.Info.Description
+		status["lastDeployed"] = rel.Info.LastDeployed.Time
+	}
+	if rel.Chart != nil && rel.Chart.Metadata != nil {
+		status["chartVersion"] = rel.Chart.Metadata.Version
+		status["appVersion"] = rel.Chart.Metadata.AppVersion
+	}
+	if err := b.addYAML("helm/release.yaml", status); err != nil {
+		return err
+	}
+	return b.addYAML("helm/values.yaml", rel.Config)
+}
+
+// collectKubernetes collects the Pods and recent events of each namespace.
+func (c *Command) collectKubernetes(ctx context.Context, b *bundle, opts collectOptions) error {
+	since := c.now().Add(-c.flagSince)
+	for _, ns := range opts.namespaces {
+		pods, err := c.kubernetes.CoreV1().Pods(ns).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			b.addError("kubernetes "+ns, fmt.Errorf("error listing Pods: %w", err))
+		} else {
+			for i := range pods.Items {
+				pods.Items[i].ManagedFields = nil
+			}
+			if err := b.addYAML(path.Join("kubernetes", ns, "pods.yaml"), pods.Items); err != nil {
+				return err
+			}
+		}
+
+		events, err := c.kubernetes.CoreV1().Events(ns).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			b.addError("kubernetes "+ns, fmt.Errorf("error listing events: %w", err))
+			continue
+		}
+		recent := []v1.Event{}
+		for _, event := range events.Items {
+			if eventTime(event).Before(since) {
+				continue
+			}
+			event.ManagedFields = nil
+			recent = append(recent, event)
+		}
+		sort.SliceStable(recent, func(i, j int) bool {
+			return eventTime(recent[i]).Before(eventTime(recent[j]))
+		})
+		if err := b.addYAML(path.Join("kubernetes", ns, "events.yaml"), recent); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// eventTime returns the time the event last occurred.
+func eventTime(event v1.Event) time.Time {
+	switch {
+	case !event.LastTimestamp.IsZero():
+		return event.LastTimestamp.Time
+	case !event.EventTime.IsZero():
+		return event.EventTime.Time
+	default:
+		return event.CreationTimestamp.Time
+	}
+}
+
+// collectLogs collects the logs of every container of the Consul control
+// plane Pods and of the Pods passed with -pod.
+func (c *Command) collectLogs(ctx context.Context, b *bundle, opts collectOptions) error {
+	controlPlane, err := c.kubernetes.CoreV1().Pods(opts.releaseNamespace).List(ctx, metav1.ListOptions{
+		LabelSelector: "release=" + opts.releaseName,
+	})
+	if err != nil {
+		return fmt.Errorf("error listing control plane Pods: %w", err)
+	}
+	pods := controlPlane.Items
+	for _, ref := range opts.pods {
+		pod, err := c.kubernetes.CoreV1().Pods(ref.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+		if err != nil {
+			b.addError("logs "+ref.String(), err)
+			continue
+		}
+		pods = append(pods, *pod)
+	}
+
+	sinceSeconds := int64(c.flagSince.Seconds())
+	collected := make(map[string]bool)
+	for _, pod := range pods {
+		key := pod.Namespace + "/" + pod.Name
+		if collected[key] {
+			continue
+		}
+		collected[key] = true
+
+		for _, container := range append(pod.Spec.InitContainers, pod.Spec.Containers...) {
+			if b.full() {
+				return nil
+			}
+			logs, err := c.kubernetes.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, &v1.PodLogOptions{
+				Container:    container.Name,
+				SinceSeconds: &sinceSeconds,
+				LimitBytes:   &b.maxSize,
+			}).DoRaw(ctx)
+			if err != nil {
+				b.addError(fmt.Sprintf("logs %s/%s", key, container.Name), err)
+				continue
+			}
+			b.add(path.Join("logs", pod.Namespace, pod.Name, container.Name+".log"), logs)
+		}
+	}
+	return nil
+}
+
+// collectCustomResources collects the Consul custom resources in each
+// namespace, including their sync status.
+func (c *Command) collectCustomResources(ctx context.Context, b *bundle, opts collectOptions) error {
+	crds, err := c.apiext.ApiextensionsV1().CustomResourceDefinitions().List(ctx, metav1.ListOptions{
+		LabelSelector: "app=consul",
+	})
+	if err != nil {
+		return fmt.Errorf("error listing custom resource definitions: %w", err)
+	}
+
+	for _, crd := range crds.Items {
+		gvr := schema.GroupVersionResource{
+			Group:    crd.Spec.Group,
+			Version:  storageVersion(crd),
+			Resource: crd.Spec.Names.Plural,
+		}
+		namespaces := opts.namespaces
+		if crd.Spec.Scope == apiextv1.ClusterScoped {
+			namespaces = []string{""}
+		}
+
+		var resources []unstructured.Unstructured
+		for _, ns := range namespaces {
+			list, err := c.dynamic.Resource(gvr).Namespace(ns).List(ctx, metav1.ListOptions{})
+			if err != nil {
+				b.addError("custom resources "+crd.Spec.Names.Plural, err)
+				continue
+			}
+			for _, item := range list.Items {
+				item.SetManagedFields(nil)
+				resources = append(resources, item)
+			}
+		}
+		if len(resources) == 0 {
+			continue
+		}
+		objects := make([]map[string]interface{}, 0, len(resources))
+		for _, r := range resources {
+			objects = append(objects, r.Object)
+		}
+		if err := b.addYAML(path.Join("custom-resources", crd.Spec.Names.Plural+".yaml"), objects); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// storageVersion returns the version custom resources are stored as.
+func storageVersion(crd apiextv1.CustomResourceDefinition) string {
+	for _, version := range crd.Spec.Versions {
+		if version.Storage {
+			return version.Name
+		}
+	}
+	return crd.Spec.Versions[0].Name
+}
+
+// proxy is an Envoy proxy to dump. Pods with multiple services run a proxy per
+// service, each with its own admin port.
+type proxy struct {
+	pod       v1.Pod
+	name      string
+	adminPort int
+}
+
+// collectEnvoy dumps the configuration and stats of the Envoy proxies in the
+// Pods passed with -pod, or of every proxy in the namespaces. Proxies are
+// dumped concurrently.
+func (c *Command) collectEnvoy(ctx context.Context, b *bundle, opts collectOptions) error {
+	proxies, err := c.fetchProxies(ctx, b, opts)
+	if err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, maxConcurrentProxies)
+	for _, p := range proxies {
+		wg.Add(1)
+		go func(p proxy) {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				b.addError(fmt.Sprintf("envoy %s/%s/%s", p.pod.Namespace, p.pod.Name, p.name), ctx.Err())
+				return
+			}
+			c.dumpProxy(ctx, b, p)
+		}(p)
+	}
+	wg.Wait()
+	return nil
+}
+
+// fetchProxies returns the proxies to dump.
+func (c *Command) fetchProxies(ctx context.Context, b *bundle, opts collectOptions) ([]proxy, error) {
+	var pods []v1.Pod
+	if len(opts.pods) > 0 {
+		for _, ref := range opts.pods {
+			pod, err := c.kubernetes.CoreV1().Pods(ref.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+			if err != nil {
+				b.addError("envoy "+ref.String(), err)
+				continue
+			}
+			if runsProxy(*pod) {
+				pods = append(pods, *pod)
+			}
+		}
+	} else {
+		for _, ns := range opts.namespaces {
+			for _, selector := range proxySelectors {
+				list, err := c.kubernetes.CoreV1().Pods(ns).List(ctx, metav1.ListOptions{LabelSelector: selector})
+				if err != nil {
+					return nil, fmt.Errorf("error listing proxies: %w", err)
+				}
+				pods = append(pods, list.Items...)
+			}
+		}
+	}
+
+	var proxies []proxy
+	for _, pod := range pods {
+		connectService := pod.Annotations["consul.hashicorp.com/connect-service"]
+		if !strings.Contains(connectService, ",") {
+			proxies = append(proxies, proxy{pod: pod, name: pod.Name, adminPort: defaultAdminPort})
+			continue
+		}
+		for index, service := range strings.Split(connectService, ",") {
+			proxies = append(proxies, proxy{pod: pod, name: service, adminPort: defaultAdminPort + index})
+		}
+	}
+	return proxies, nil
+}
+
+// runsProxy returns true if the Pod runs an Envoy proxy.
+func runsProxy(pod v1.Pod) bool {
+	for _, s := range proxySelectors {
+		selector, err := labels.Parse(s)
+		if err == nil && selector.Matches(labels.Set(pod.Labels)) {
+			return true
+		}
+	}
+	return false
+}
+
+// dumpProxy adds the config dump and stats of the proxy to the bundle.
+func (c *Command) dumpProxy(ctx context.Context, b *bundle, p proxy) {
+	name := fmt.Sprintf("envoy %s/%s/%s", p.pod.Namespace, p.pod.Name, p.name)
+	dir := path.Join("envoy", p.pod.Namespace, p.pod.Name, p.name)
+
+	config, err := c.fetchConfig(ctx, c.portForward(p.pod, p.adminPort))
+	if err != nil {
+		b.addError(name, fmt.Errorf("error fetching config dump: %w", err))
+	} else {
+		b.add(path.Join(dir, "config_dump.json"), config.JSON())
+	}
+
+	stats, err := c.fetchStats(ctx, c.portForward(p.pod, p.adminPort))
+	if err != nil {
+		b.addError(name, fmt.Errorf("error fetching stats: %w", err))
+	} else if err := b.addJSON(path.Join(dir, "stats.json"), stats.Values); err != nil {
+		b.addError(name, err)
+	}
+}
+
+func (c *Command) portForward(pod v1.Pod, port int) *common.PortForward {
+	return &common.PortForward{
+		Namespace:  pod.Namespace,
+		PodName:    pod.Name,
+		RemotePort: port,
+		KubeClient: c.kubernetes,
+		RestConfig: c.restConfig,
+	}
+}
+
+// collectConsul collects the members, raft state, catalog and peerings from a
+// Consul server through a port forward.
+func (c *Command) collectConsul(ctx context.Context, b *bundle, opts collectOptions) error {
+	server, err := common.FindConsulServer(ctx, c.kubernetes, opts.releaseNamespace, opts.releaseName)
+	if err != nil {
+		return err
+	}
+	conn, err := common.NewConsulConnection(ctx, c.kubernetes, *server)
+	if err != nil {
+		return err
+	}
+	state, err := c.fetchConsulState(ctx, c.portForward(*server, conn.Port), conn)
+	for file, body := range state {
+		b.add(path.Join("consul", file), body)
+	}
+	return err
+}
+
+// fetchConsulState opens a port forward to a Consul server and fetches each of
+// the Consul endpoints. It returns the responses of the endpoints that could
+// be fetched along with the errors of those that couldn't.
+func fetchConsulState(ctx context.Context, portForward common.PortForwarder, conn common.ConsulConnection) (map[string][]byte, error) {
+	endpoint, err := portForward.Open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer portForward.Close()
+
+	client, err := conn.HTTPClient()
+	if err != nil {
+		return nil, err
+	}
+
+	state := make(map[string][]byte)
+	var errs []error
+	for file, apiPath := range consulEndpoints {
+		body, err := conn.Get(ctx, client, endpoint, apiPath)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", apiPath, err))
+			continue
+		}
+		state[file] = body
+	}
+	return state, errors.Join(errs...)
+}
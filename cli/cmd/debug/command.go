@@ -0,0 +1,403 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package debug
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/posener/complete"
+	helmCLI "helm.sh/helm/v3/pkg/cli"
+	apiext "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/api/validation"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/utils/strings/slices"
+
+	"github.com/hashicorp/consul-k8s/cli/common"
+	"github.com/hashicorp/consul-k8s/cli/common/envoy"
+	"github.com/hashicorp/consul-k8s/cli/common/flag"
+	"github.com/hashicorp/consul-k8s/cli/common/terminal"
+	"github.com/hashicorp/consul-k8s/cli/helm"
+	"github.com/hashicorp/consul-k8s/cli/version"
+)
+
+const (
+	flagNameArchive     = "archive"
+	flagNamePod         = "pod"
+	flagNameNamespace   = "namespace"
+	flagNameDuration    = "duration"
+	flagNameSince       = "since"
+	flagNameMaxSize     = "max-size"
+	flagNameKubeConfig  = "kubeconfig"
+	flagNameKubeContext = "context"
+
+	defaultDuration = 2 * time.Minute
+	defaultSince    = time.Hour
+	defaultMaxSize  = "100Mi"
+
+	// timestampFormat is used in the name of the bundle.
+	timestampFormat = "20060102T150405Z"
+)
+
+// Command is the command struct for the debug command.
+type Command struct {
+	*common.BaseCommand
+
+	helmActionsRunner helm.HelmActionsRunner
+
+	kubernetes kubernetes.Interface
+	apiext     apiext.Interface
+	dynamic    dynamic.Interface
+	restConfig *rest.Config
+
+	set *flag.Sets
+
+	flagArchive    string
+	flagPods       []string
+	flagNamespaces []string
+	flagDuration   time.Duration
+	flagSince      time.Duration
+	flagMaxSize    string
+
+	flagKubeConfig  string
+	flagKubeContext string
+
+	fetchConfig      func(context.Context, common.PortForwarder) (*envoy.EnvoyConfig, error)
+	fetchStats       func(context.Context, common.PortForwarder) (*envoy.Stats, error)
+	fetchConsulState func(context.Context, common.PortForwarder, common.ConsulConnection) (map[string][]byte, error)
+
+	// now returns the current time. It is set in tests.
+	now func() time.Time
+
+	once sync.Once
+	help string
+}
+
+func (c *Command) init() {
+	if c.fetchConfig == nil {
+		c.fetchConfig = envoy.FetchConfig
+	}
+	if c.fetchStats == nil {
+		c.fetchStats = envoy.FetchStats
+	}
+	if c.fetchConsulState == nil {
+		c.fetchConsulState = fetchConsulState
+	}
+	if c.now == nil {
+		c.now = time.Now
+	}
+
+	c.set = flag.NewSets()
+	f := c.set.NewSet("Command Options")
+	f.StringVar(&flag.StringVar{
+		Name:    flagNameArchive,
+		Target:  &c.flagArchive,
+		Usage:   "Path of the bundle to write. Defaults to consul-k8s-debug-<timestamp>.tar.gz in the current directory.",
+		Aliases: []string{"a"},
+	})
+	f.StringSliceVar(&flag.StringSliceVar{
+		Name:    flagNamePod,
+		Target:  &c.flagPods,
+		Usage:   "Pod to collect logs and Envoy configuration from, as [<namespace>/]<name>. May be specified multiple times. Defaults to the Pods with injected proxies in the collected namespaces.",
+		Aliases: []string{"p"},
+	})
+	f.StringSliceVar(&flag.StringSliceVar{
+		Name:    flagNameNamespace,
+		Target:  &c.flagNamespaces,
+		Usage:   "Namespace to collect events, Pods, custom resources and proxies from. May be specified multiple times. Defaults to the namespace of the Consul installation and of the Pods passed with -pod.",
+		Aliases: []string{"n"},
+	})
+	f.DurationVar(&flag.DurationVar{
+		Name:    flagNameDuration,
+		Target:  &c.flagDuration,
+		Default: defaultDuration,
+		Usage:   "Maximum time to spend collecting the bundle. Anything not collected by then is listed as an error in the manifest.",
+		Aliases: []string{"d"},
+	})
+	f.DurationVar(&flag.DurationVar{
+		Name:    flagNameSince,
+		Target:  &c.flagSince,
+		Default: defaultSince,
+		Usage:   "Only collect logs and events newer than this duration.",
+	})
+	f.StringVar(&flag.StringVar{
+		Name:    flagNameMaxSize,
+		Target:  &c.flagMaxSize,
+		Default: defaultMaxSize,
+		Usage:   "Maximum uncompressed size of the bundle, e.g. 50Mi or 1Gi. Files that don't fit are truncated or skipped.",
+	})
+
+	f = c.set.NewSet("Global Options")
+	f.StringVar(&flag.StringVar{
+		Name:    flagNameKubeConfig,
+		Aliases: []string{"c"},
+		Target:  &c.flagKubeConfig,
+		Usage:   "Set the path to kubeconfig file.",
+	})
+	f.StringVar(&flag.StringVar{
+		Name:   flagNameKubeContext,
+		Target: &c.flagKubeContext,
+		Usage:  "Set the Kubernetes context to use.",
+	})
+
+	c.help = c.set.Help()
+}
+
+// Run collects the debug bundle.
+func (c *Command) Run(args []string) int {
+	c.once.Do(c.init)
+	if c.helmActionsRunner == nil {
+		c.helmActionsRunner = &helm.ActionRunner{}
+	}
+
+	c.Log.ResetNamed("debug")
+	defer common.CloseWithError(c.BaseCommand)
+
+	if err := c.set.Parse(args); err != nil {
+		c.UI.Output(err.Error(), terminal.WithErrorStyle())
+		c.UI.Output("\n" + c.Help())
+		return 1
+	}
+
+	maxSize, err := c.validateFlags()
+	if err != nil {
+		c.UI.Output(err.Error(), terminal.WithErrorStyle())
+		c.UI.Output("\n" + c.Help())
+		return 1
+	}
+
+	settings := helmCLI.New()
+	if c.flagKubeConfig != "" {
+		settings.KubeConfig = c.flagKubeConfig
+	}
+	if c.flagKubeContext != "" {
+		settings.KubeContext = c.flagKubeContext
+	}
+	if err := c.initKubernetes(settings); err != nil {
+		c.UI.Output(err.Error(), terminal.WithErrorStyle())
+		return 1
+	}
+
+	uiLogger := func(s string, args ...interface{}) {
+		c.UI.Output(fmt.Sprintf(s, args...), terminal.WithLibraryStyle())
+	}
+	_, releaseName, releaseNamespace, err := c.helmActionsRunner.CheckForInstallations(&helm.CheckForInstallationsOptions{
+		Settings:    settings,
+		ReleaseName: common.DefaultReleaseName,
+		DebugLog:    uiLogger,
+	})
+	if err != nil {
+		c.UI.Output(err.Error(), terminal.WithErrorStyle())
+		return 1
+	}
+
+	pods, err := parsePods(c.flagPods, settings.Namespace())
+	if err != nil {
+		c.UI.Output(err.Error(), terminal.WithErrorStyle())
+		return 1
+	}
+	namespaces := c.flagNamespaces
+	if len(namespaces) == 0 {
+		namespaces = defaultNamespaces(releaseNamespace, pods)
+	}
+
+	now := c.now().UTC()
+	name := "consul-k8s-debug-" + now.Format(timestampFormat)
+	archive := c.flagArchive
+	if archive == "" {
+		archive = name + ".tar.gz"
+	}
+
+	b := newBundle(maxSize, manifest{
+		CreatedAt:  now,
+		CLIVersion: version.GetHumanVersion(),
+		Release:    releaseInfo{Name: releaseName, Namespace: releaseNamespace},
+		Namespaces: namespaces,
+		Pods:       podNames(pods),
+		Since:      c.flagSince.String(),
+	})
+
+	c.UI.Output("Collecting debug bundle for release %q in namespace %q", releaseName, releaseNamespace, terminal.WithHeaderStyle())
+	ctx, cancel := context.WithTimeout(c.Ctx, c.flagDuration)
+	defer cancel()
+	c.collect(ctx, b, collectOptions{
+		settings:         settings,
+		releaseName:      releaseName,
+		releaseNamespace: releaseNamespace,
+		namespaces:       namespaces,
+		pods:             pods,
+	})
+
+	if err := writeArchive(archive, b, name); err != nil {
+		c.UI.Output(err.Error(), terminal.WithErrorStyle())
+		return 1
+	}
+
+	if len(b.manifest.Errors) > 0 {
+		c.UI.Output("Some data could not be collected, see the errors in %s:", manifestFileName, terminal.WithWarningStyle())
+		for _, e := range b.manifest.Errors {
+			c.UI.Output("%s: %s", e.Collector, e.Error, terminal.WithWarningStyle())
+		}
+	}
+	if b.full() {
+		c.UI.Output("The bundle reached its maximum size of %s, some files were truncated or skipped.", c.flagMaxSize, terminal.WithWarningStyle())
+	}
+	c.UI.Output("Saved debug bundle to %s", archive, terminal.WithSuccessStyle())
+	return 0
+}
+
+// Help returns a description of the command and how it is used.
+func (c *Command) Help() string {
+	c.once.Do(c.init)
+	return fmt.Sprintf("%s\n\nUsage: consul-k8s debug [flags]\n\n%s", c.Synopsis(), c.help)
+}
+
+// Synopsis returns a one-line command summary.
+func (c *Command) Synopsis() string {
+	return "Collect a bundle of debugging information about a Consul installation on Kubernetes."
+}
+
+// AutocompleteFlags returns a mapping of supported flags and autocomplete
+// options for this command. The map key for the Flags map should be the
+// complete flag such as "-foo" or "--foo".
+func (c *Command) AutocompleteFlags() complete.Flags {
+	return complete.Flags{
+		fmt.Sprintf("-%s", flagNameArchive):     complete.PredictFiles("*.tar.gz"),
+		fmt.Sprintf("-%s", flagNamePod):         complete.PredictNothing,
+		fmt.Sprintf("-%s", flagNameNamespace):   complete.PredictNothing,
+		fmt.Sprintf("-%s", flagNameDuration):    complete.PredictNothing,
+		fmt.Sprintf("-%s", flagNameSince):       complete.PredictNothing,
+		fmt.Sprintf("-%s", flagNameMaxSize):     complete.PredictNothing,
+		fmt.Sprintf("-%s", flagNameKubeConfig):  complete.PredictFiles("*"),
+		fmt.Sprintf("-%s", flagNameKubeContext): complete.PredictNothing,
+	}
+}
+
+// AutocompleteArgs returns the argument predictor for this command.
+// Since argument completion is not supported, this will return
+// complete.PredictNothing.
+func (c *Command) AutocompleteArgs() complete.Predictor {
+	return complete.PredictNothing
+}
+
+// validateFlags checks the flags and returns the maximum size of the bundle in
+// bytes.
+func (c *Command) validateFlags() (int64, error) {
+	if len(c.set.Args()) > 0 {
+		return 0, errors.New("should have no non-flag arguments")
+	}
+	for _, ns := range c.flagNamespaces {
+		if errs := validation.ValidateNamespaceName(ns, false); len(errs) > 0 {
+			return 0, fmt.Errorf("invalid namespace name passed for -namespace/-n: %v", strings.Join(errs, "; "))
+		}
+	}
+	if c.flagDuration <= 0 {
+		return 0, errors.New("-duration must be greater than 0")
+	}
+	if c.flagSince <= 0 {
+		return 0, errors.New("-since must be greater than 0")
+	}
+	maxSize, err := resource.ParseQuantity(c.flagMaxSize)
+	if err != nil || maxSize.Value() <= 0 {
+		return 0, fmt.Errorf("-max-size must be a positive size such as 100Mi, got %q", c.flagMaxSize)
+	}
+	return maxSize.Value(), nil
+}
+
+func (c *Command) initKubernetes(settings *helmCLI.EnvSettings) (err error) {
+	if c.restConfig == nil {
+		if c.restConfig, err = settings.RESTClientGetter().ToRESTConfig(); err != nil {
+			return fmt.Errorf("error creating Kubernetes REST config %v", err)
+		}
+	}
+	if c.kubernetes == nil {
+		if c.kubernetes, err = kubernetes.NewForConfig(c.restConfig); err != nil {
+			return fmt.Errorf("error creating Kubernetes client %v", err)
+		}
+	}
+	if c.apiext == nil {
+		if c.apiext, err = apiext.NewForConfig(c.restConfig); err != nil {
+			return fmt.Errorf("error creating Kubernetes client %v", err)
+		}
+	}
+	if c.dynamic == nil {
+		if c.dynamic, err = dynamic.NewForConfig(c.restConfig); err != nil {
+			return fmt.Errorf("error creating Kubernetes client %v", err)
+		}
+	}
+	return nil
+}
+
+// podRef is a Pod passed with the -pod flag.
+type podRef struct {
+	Namespace string
+	Name      string
+}
+
+func (p podRef) String() string {
+	return p.Namespace + "/" + p.Name
+}
+
+// parsePods parses the values of the -pod flag. Pods without a namespace are
+// in the default namespace of the kubeconfig context.
+func parsePods(values []string, defaultNamespace string) ([]podRef, error) {
+	var pods []podRef
+	for _, v := range values {
+		if v == "" {
+			continue
+		}
+		ref := podRef{Namespace: defaultNamespace, Name: v}
+		if ns, name, found := strings.Cut(v, "/"); found {
+			ref = podRef{Namespace: ns, Name: name}
+		}
+		if ref.Namespace == "" || ref.Name == "" || strings.Contains(ref.Name, "/") {
+			return nil, fmt.Errorf("invalid Pod passed for -pod/-p: %q must be [<namespace>/]<name>", v)
+		}
+		pods = append(pods, ref)
+	}
+	return pods, nil
+}
+
+func podNames(pods []podRef) []string {
+	var names []string
+	for _, p := range pods {
+		names = append(names, p.String())
+	}
+	return names
+}
+
+// defaultNamespaces returns the namespace of the installation and of the Pods.
+func defaultNamespaces(releaseNamespace string, pods []podRef) []string {
+	namespaces := []string{releaseNamespace}
+	for _, p := range pods {
+		if !slices.Contains(namespaces, p.Namespace) {
+			namespaces = append(namespaces, p.Namespace)
+		}
+	}
+	return namespaces
+}
+
+// writeArchive writes the bundle to the archive file.
+func writeArchive(archive string, b *bundle, dir string) error {
+	f, err := os.OpenFile(archive, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("error creating debug bundle: %w", err)
+	}
+	if err := b.write(f, dir); err != nil {
+		f.Close()
+		return fmt.Errorf("error writing debug bundle: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("error writing debug bundle: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,393 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package debug
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/posener/complete"
+	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/release"
+	v1 "k8s.io/api/core/v1"
+	apiextv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apiextFake "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/fake"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicFake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+
+	"github.com/hashicorp/consul-k8s/cli/common"
+	"github.com/hashicorp/consul-k8s/cli/common/envoy"
+	cmnFlag "github.com/hashicorp/consul-k8s/cli/common/flag"
+	"github.com/hashicorp/consul-k8s/cli/common/terminal"
+	"github.com/hashicorp/consul-k8s/cli/helm"
+)
+
+var serviceDefaultsGVR = schema.GroupVersionResource{
+	Group:    "consul.hashicorp.com",
+	Version:  "v1alpha1",
+	Resource: "servicedefaults",
+}
+
+func TestFlagParsing(t *testing.T) {
+	cases := map[string]struct {
+		args []string
+		out  int
+	}{
+		"No args": {
+			args: []string{},
+			out:  0,
+		},
+		"Pods and namespaces": {
+			args: []string{"-pod", "default/web", "-p", "api", "-namespace", "default,consul"},
+			out:  0,
+		},
+		"Non-flag argument": {
+			args: []string{"web"},
+			out:  1,
+		},
+		"Nonexistent flag passed, -foo bar": {
+			args: []string{"-foo", "bar"},
+			out:  1,
+		},
+		"Invalid argument passed, -namespace YOLO": {
+			args: []string{"-namespace", "YOLO"},
+			out:  1,
+		},
+		"Invalid pod passed, -pod default/": {
+			args: []string{"-pod", "default/"},
+			out:  1,
+		},
+		"Invalid duration passed, -duration 0s": {
+			args: []string{"-duration", "0s"},
+			out:  1,
+		},
+		"Invalid since passed, -since -1h": {
+			args: []string{"-since", "-1h"},
+			out:  1,
+		},
+		"Invalid max size passed, -max-size lots": {
+			args: []string{"-max-size", "lots"},
+			out:  1,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			c := setupCommand(new(bytes.Buffer))
+			c.kubernetes = fake.NewSimpleClientset()
+			c.apiext, c.dynamic = fakeCustomResources(t)
+			args := append([]string{"-archive", filepath.Join(t.TempDir(), "bundle.tar.gz")}, tc.args...)
+			require.Equal(t, tc.out, c.Run(args))
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	buf := new(bytes.Buffer)
+	c := setupCommand(buf)
+	c.kubernetes = fake.NewSimpleClientset(
+		serverPod(),
+		injectedPod("web", "default", "web"),
+		injectedPod("multiport", "default", "web,admin"),
+		&v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "default"}},
+		&v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "consul-bootstrap-acl-token", Namespace: "consul"},
+			Data:       map[string][]byte{"token": []byte("bootstrap-token")},
+		},
+		&v1.Event{
+			ObjectMeta:    metav1.ObjectMeta{Name: "recent", Namespace: "consul"},
+			LastTimestamp: metav1.NewTime(c.now().Add(-time.Minute)),
+			Message:       "Started container consul",
+		},
+		&v1.Event{
+			ObjectMeta:    metav1.ObjectMeta{Name: "old", Namespace: "consul"},
+			LastTimestamp: metav1.NewTime(c.now().Add(-2 * time.Hour)),
+			Message:       "Pulled image",
+		},
+	)
+	c.apiext, c.dynamic = fakeCustomResources(t)
+
+	envoyFake := &fakeEnvoy{}
+	c.fetchConfig = envoyFake.fetchConfig
+	c.fetchStats = envoyFake.fetchStats
+	var gotConn common.ConsulConnection
+	c.fetchConsulState = func(_ context.Context, pf common.PortForwarder, conn common.ConsulConnection) (map[string][]byte, error) {
+		gotConn = conn
+		require.Equal(t, 8500, pf.(*common.PortForward).RemotePort)
+		return map[string][]byte{"leader.json": []byte(`"10.0.0.1:8300"`)}, errors.New("/v1/peerings: connection refused")
+	}
+
+	archive := filepath.Join(t.TempDir(), "bundle.tar.gz")
+	require.Equal(t, 0, c.Run([]string{"-archive", archive, "-namespace", "consul,default"}), buf.String())
+	require.Contains(t, buf.String(), "Saved debug bundle to "+archive)
+	require.Contains(t, buf.String(), "/v1/peerings: connection refused")
+
+	f, err := os.Open(archive)
+	require.NoError(t, err)
+	defer f.Close()
+	files := readArchive(t, f)
+
+	dir := "consul-k8s-debug-20230401T120000Z/"
+	for _, name := range []string{
+		"helm/release.yaml",
+		"helm/values.yaml",
+		"kubernetes/consul/pods.yaml",
+		"kubernetes/consul/events.yaml",
+		"kubernetes/default/pods.yaml",
+		"logs/consul/consul-server-0/consul.log",
+		"custom-resources/servicedefaults.yaml",
+		"envoy/default/web/web/config_dump.json",
+		"envoy/default/web/web/stats.json",
+		"envoy/default/multiport/web/config_dump.json",
+		"envoy/default/multiport/admin/config_dump.json",
+		"consul/leader.json",
+		manifestFileName,
+	} {
+		require.Contains(t, files, dir+name)
+	}
+	require.NotContains(t, files, dir+"envoy/default/other/other/config_dump.json")
+
+	require.Contains(t, files[dir+"helm/values.yaml"], "gossipKey: <redacted>")
+	require.Contains(t, files[dir+"kubernetes/consul/events.yaml"], "Started container consul")
+	require.NotContains(t, files[dir+"kubernetes/consul/events.yaml"], "Pulled image")
+	require.Contains(t, files[dir+"custom-resources/servicedefaults.yaml"], "name: web")
+
+	require.ElementsMatch(t, []int{19000, 19000, 19000, 19000, 19001, 19001}, envoyFake.ports)
+	require.Equal(t, common.ConsulConnection{Port: 8500, Scheme: "http", Token: "bootstrap-token"}, gotConn)
+
+	var m manifest
+	require.NoError(t, json.Unmarshal([]byte(files[dir+manifestFileName]), &m))
+	require.Equal(t, releaseInfo{Name: "consul", Namespace: "consul"}, m.Release)
+	require.Equal(t, []string{"consul", "default"}, m.Namespaces)
+	require.Equal(t, []bundleError{{Collector: "consul", Error: "/v1/peerings: connection refused"}}, m.Errors)
+}
+
+func TestRun_Pods(t *testing.T) {
+	buf := new(bytes.Buffer)
+	c := setupCommand(buf)
+	c.kubernetes = fake.NewSimpleClientset(
+		serverPod(),
+		injectedPod("web", "default", "web"),
+		injectedPod("api", "default", "api"),
+	)
+	c.apiext, c.dynamic = fakeCustomResources(t)
+	envoyFake := &fakeEnvoy{}
+	c.fetchConfig = envoyFake.fetchConfig
+	c.fetchStats = envoyFake.fetchStats
+	c.fetchConsulState = func(context.Context, common.PortForwarder, common.ConsulConnection) (map[string][]byte, error) {
+		return nil, nil
+	}
+
+	archive := filepath.Join(t.TempDir(), "bundle.tar.gz")
+	require.Equal(t, 0, c.Run([]string{"-archive", archive, "-pod", "default/web", "-pod", "default/missing"}), buf.String())
+
+	f, err := os.Open(archive)
+	require.NoError(t, err)
+	defer f.Close()
+	files := readArchive(t, f)
+
+	dir := "consul-k8s-debug-20230401T120000Z/"
+	require.Contains(t, files, dir+"logs/default/web/envoy-sidecar.log")
+	require.Contains(t, files, dir+"envoy/default/web/web/config_dump.json")
+	require.NotContains(t, files, dir+"logs/default/api/envoy-sidecar.log")
+	require.NotContains(t, files, dir+"envoy/default/api/api/config_dump.json")
+	require.Contains(t, buf.String(), `pods "missing" not found`)
+}
+
+func TestRun_ArchiveExists(t *testing.T) {
+	buf := new(bytes.Buffer)
+	c := setupCommand(buf)
+	c.kubernetes = fake.NewSimpleClientset()
+	c.apiext, c.dynamic = fakeCustomResources(t)
+
+	archive := filepath.Join(t.TempDir(), "bundle.tar.gz")
+	require.NoError(t, os.WriteFile(archive, []byte("existing"), 0600))
+	require.Equal(t, 1, c.Run([]string{"-archive", archive}))
+	require.Contains(t, buf.String(), "file exists")
+}
+
+func TestTaskCreateCommand_AutocompleteFlags(t *testing.T) {
+	t.Parallel()
+	buf := new(bytes.Buffer)
+	cmd := setupCommand(buf)
+
+	predictor := cmd.AutocompleteFlags()
+
+	// Test that we get the expected number of predictions
+	args := complete.Args{Last: "-"}
+	res := predictor.Predict(args)
+
+	// Grab the list of flags from the Flag object
+	flags := make([]string, 0)
+	cmd.set.VisitSets(func(name string, set *cmnFlag.Set) {
+		set.VisitAll(func(flag *flag.Flag) {
+			flags = append(flags, fmt.Sprintf("-%s", flag.Name))
+		})
+	})
+
+	// Verify that there is a prediction for each flag associated with the command
+	require.Equal(t, len(flags), len(res))
+	require.ElementsMatch(t, flags, res, "flags and predictions didn't match, make sure to add "+
+		"new flags to the command AutoCompleteFlags function")
+}
+
+func TestTaskCreateCommand_AutocompleteArgs(t *testing.T) {
+	buf := new(bytes.Buffer)
+	cmd := setupCommand(buf)
+	c := cmd.AutocompleteArgs()
+	require.Equal(t, complete.PredictNothing, c)
+}
+
+// fakeEnvoy records the admin ports that configs and stats are fetched from.
+type fakeEnvoy struct {
+	mu    sync.Mutex
+	ports []int
+}
+
+func (f *fakeEnvoy) record(pf common.PortForwarder) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.ports = append(f.ports, pf.(*common.PortForward).RemotePort)
+}
+
+func (f *fakeEnvoy) fetchConfig(_ context.Context, pf common.PortForwarder) (*envoy.EnvoyConfig, error) {
+	f.record(pf)
+	return &envoy.EnvoyConfig{RawCfg: []byte(`{"configs": []}`)}, nil
+}
+
+func (f *fakeEnvoy) fetchStats(_ context.Context, pf common.PortForwarder) (*envoy.Stats, error) {
+	f.record(pf)
+	return &envoy.Stats{Values: map[string]uint64{"server.live": 1}}, nil
+}
+
+func serverPod() *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "consul-server-0",
+			Namespace: "consul",
+			Labels: map[string]string{
+				"app":       "consul",
+				"component": "server",
+				"release":   "consul",
+			},
+			OwnerReferences: []metav1.OwnerReference{{Kind: "StatefulSet", Name: "consul-server"}},
+		},
+		Spec: v1.PodSpec{
+			Containers: []v1.Container{{
+				Name:  "consul",
+				Ports: []v1.ContainerPort{{Name: "http", ContainerPort: 8500}},
+			}},
+		},
+		Status: v1.PodStatus{Phase: v1.PodRunning},
+	}
+}
+
+func injectedPod(name, namespace, services string) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   namespace,
+			Labels:      map[string]string{"consul.hashicorp.com/connect-inject-status": "injected"},
+			Annotations: map[string]string{"consul.hashicorp.com/connect-service": services},
+		},
+		Spec: v1.PodSpec{
+			Containers: []v1.Container{{Name: "app"}, {Name: "envoy-sidecar"}},
+		},
+	}
+}
+
+func fakeCustomResources(t *testing.T) (*apiextFake.Clientset, *dynamicFake.FakeDynamicClient) {
+	crd := &apiextv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "servicedefaults.consul.hashicorp.com",
+			Labels: map[string]string{"app": "consul"},
+		},
+		Spec: apiextv1.CustomResourceDefinitionSpec{
+			Group: serviceDefaultsGVR.Group,
+			Names: apiextv1.CustomResourceDefinitionNames{
+				Plural: serviceDefaultsGVR.Resource,
+				Kind:   "ServiceDefaults",
+			},
+			Scope:    apiextv1.NamespaceScoped,
+			Versions: []apiextv1.CustomResourceDefinitionVersion{{Name: serviceDefaultsGVR.Version, Storage: true}},
+		},
+	}
+	serviceDefaults := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "consul.hashicorp.com/v1alpha1",
+		"kind":       "ServiceDefaults",
+		"metadata": map[string]interface{}{
+			"name":      "web",
+			"namespace": "default",
+		},
+		"spec": map[string]interface{}{"protocol": "http"},
+	}}
+	dynamicClient := dynamicFake.NewSimpleDynamicClientWithCustomListKinds(
+		runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{serviceDefaultsGVR: "ServiceDefaultsList"},
+	)
+	// The resource is created through the client because the fake can't guess
+	// the plural of ServiceDefaults from its kind.
+	_, err := dynamicClient.Resource(serviceDefaultsGVR).Namespace("default").Create(context.Background(), serviceDefaults, metav1.CreateOptions{})
+	require.NoError(t, err)
+	return apiextFake.NewSimpleClientset(crd), dynamicClient
+}
+
+func setupCommand(buf io.Writer) *Command {
+	// Log at a test level to standard out.
+	log := hclog.New(&hclog.LoggerOptions{
+		Name:   "test",
+		Level:  hclog.Debug,
+		Output: os.Stdout,
+	})
+
+	// Setup and initialize the command struct
+	command := &Command{
+		BaseCommand: &common.BaseCommand{
+			Ctx: context.Background(),
+			Log: log,
+			UI:  terminal.NewUI(context.Background(), buf),
+		},
+		helmActionsRunner: &helm.MockActionRunner{
+			CheckForInstallationsFunc: func(options *helm.CheckForInstallationsOptions) (bool, string, string, error) {
+				return true, "consul", "consul", nil
+			},
+			GetStatusFunc: func(status *action.Status, name string) (*release.Release, error) {
+				return &release.Release{
+					Name:      "consul",
+					Namespace: "consul",
+					Info:      &release.Info{Status: release.StatusDeployed},
+					Config: map[string]interface{}{
+						"global": map[string]interface{}{
+							"gossipEncryption": map[string]interface{}{"gossipKey": "aGVsbG8="},
+						},
+					},
+				}, nil
+			},
+		},
+		restConfig: &rest.Config{},
+		now: func() time.Time {
+			return time.Date(2023, 4, 1, 12, 0, 0, 0, time.UTC)
+		},
+	}
+	command.init()
+
+	return command
+}
@@ -0,0 +1,108 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package debug
+
+import (
+	"regexp"
+)
+
+// redacted replaces the values of secrets and tokens in the bundle.
+const redacted = "<redacted>"
+
+var (
+	// sensitiveKey matches the names of fields whose values are secrets.
+	sensitiveKey = regexp.MustCompile(`(?i)(token|secret|password|passwd|private_?key|credentials|encrypt|gossip_?key)`)
+	// referenceKey matches the names of fields that look sensitive but refer
+	// to a secret rather than hold one, e.g. secretName or tokenFile.
+	referenceKey = regexp.MustCompile(`(?i)(name|names|key|file|path|dir|ttl|type|mount|enabled|method|backend|role|policy|selector|ref|expiry|expiration|duration|interval|period)$`)
+	// keyValueKey matches the names of fields that hold a key even though
+	// they end in "key", e.g. privateKey or gossipKey.
+	keyValueKey = regexp.MustCompile(`(?i)(private_?key|gossip_?key)$`)
+
+	jsonField = regexp.MustCompile(`"([A-Za-z0-9_.\-]+)"(\s*:\s*)"((?:[^"\\]|\\.)*)"`)
+	yamlField = regexp.MustCompile(`(?m)^(\s*(?:-\s+)?)([A-Za-z0-9_.\-]+)(:[ \t]+)([^\s|>#].*)$`)
+	// The name/value fields of environment variables, in either order. The
+	// value is redacted if the name is sensitive, e.g. CONSUL_HTTP_TOKEN.
+	jsonEnvVar         = regexp.MustCompile(`("name"\s*:\s*"([A-Za-z0-9_.\-]+)"\s*,\s*"value"\s*:\s*)"((?:[^"\\]|\\.)*)"`)
+	jsonEnvVarReversed = regexp.MustCompile(`("value"\s*:\s*)"((?:[^"\\]|\\.)*)"(\s*,\s*"name"\s*:\s*"([A-Za-z0-9_.\-]+)")`)
+	yamlEnvVar         = regexp.MustCompile(`(?m)(^[ \t]*(?:-[ \t]+)?name:[ \t]+["']?([A-Za-z0-9_.\-]+)["']?[ \t]*\n[ \t]+value:[ \t]+)([^\s|>#].*)$`)
+	yamlEnvVarReversed = regexp.MustCompile(`(?m)(^[ \t]*(?:-[ \t]+)?value:[ \t]+)([^\s|>#].*)(\n[ \t]+name:[ \t]+["']?([A-Za-z0-9_.\-]+)["']?[ \t]*)$`)
+
+	cliFlag = regexp.MustCompile(`(?i)(-{1,2}[a-z0-9\-]*(?:token|password|secret)[a-z0-9\-]*[= ])([^\s\\]+)`)
+	header  = regexp.MustCompile(`(?i)((?:x-consul-token|authorization)["']?\s*[:=]\s*["']?)(?:bearer\s+)?[^\s"',]+`)
+	pemKey  = regexp.MustCompile(`(?s)-----BEGIN ([A-Z ]*)PRIVATE KEY-----.*?-----END ([A-Z ]*)PRIVATE KEY-----`)
+)
+
+// isSensitive returns true if the field with the given name holds a secret.
+func isSensitive(key string) bool {
+	if !sensitiveKey.MatchString(key) {
+		return false
+	}
+	if keyValueKey.MatchString(key) {
+		return true
+	}
+	return !referenceKey.MatchString(key)
+}
+
+// isEmptyValue returns true if the JSON or YAML value doesn't hold a secret.
+func isEmptyValue(value string) bool {
+	return value == "" || value == "null" || value == `""` || value == "''"
+}
+
+// redactEnvVars redacts the values of environment variables with sensitive
+// names. The name and the value are captured by the nameGroup and valueGroup
+// of re, and every other group is kept.
+func redactEnvVars(b []byte, re *regexp.Regexp, nameGroup, valueGroup int, quoted bool) []byte {
+	return re.ReplaceAllFunc(b, func(match []byte) []byte {
+		groups := re.FindSubmatch(match)
+		if !isSensitive(string(groups[nameGroup])) || isEmptyValue(string(groups[valueGroup])) {
+			return match
+		}
+		var out []byte
+		for i := 1; i < len(groups); i++ {
+			switch {
+			case i == valueGroup && quoted:
+				out = append(out, `"`+redacted+`"`...)
+			case i == valueGroup:
+				out = append(out, redacted...)
+			case i == nameGroup:
+				// The name is part of the group around it.
+			default:
+				out = append(out, groups[i]...)
+			}
+		}
+		return out
+	})
+}
+
+// Redact replaces secrets and tokens in the content of a file with a
+// placeholder. It recognizes JSON and YAML fields with sensitive names,
+// environment variables with sensitive names, flags and headers that pass
+// tokens and PEM-encoded private keys, so it can be applied to logs as well as
+// to structured data.
+func Redact(b []byte) []byte {
+	b = pemKey.ReplaceAll(b, []byte("-----BEGIN ${1}PRIVATE KEY-----"+redacted+"-----END ${2}PRIVATE KEY-----"))
+	b = redactEnvVars(b, jsonEnvVar, 2, 3, true)
+	b = redactEnvVars(b, jsonEnvVarReversed, 4, 2, true)
+	b = redactEnvVars(b, yamlEnvVar, 2, 3, false)
+	b = redactEnvVars(b, yamlEnvVarReversed, 4, 2, false)
+	b = jsonField.ReplaceAllFunc(b, func(match []byte) []byte {
+		groups := jsonField.FindSubmatch(match)
+		if !isSensitive(string(groups[1])) || len(groups[3]) == 0 {
+			return match
+		}
+		return []byte(`"` + string(groups[1]) + `"` + string(groups[2]) + `"` + redacted + `"`)
+	})
+	b = yamlField.ReplaceAllFunc(b, func(match []byte) []byte {
+		groups := yamlField.FindSubmatch(match)
+		value := string(groups[4])
+		if !isSensitive(string(groups[2])) || value == "null" || value == `""` || value == "''" || value == "true" || value == "false" {
+			return match
+		}
+		return []byte(string(groups[1]) + string(groups[2]) + string(groups[3]) + redacted)
+	})
+	b = cliFlag.ReplaceAll(b, []byte("${1}"+redacted))
+	b = header.ReplaceAll(b, []byte("${1}"+redacted))
+	return b
+}
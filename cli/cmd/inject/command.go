@@ -0,0 +1,44 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package inject
+
+import (
+	"github.com/hashicorp/consul-k8s/cli/common"
+)
+
+// subcommand is the consul-k8s-control-plane subcommand that injects the
+// manifests.
+var subcommand = []string{"inject"}
+
+// InjectCommand renders the connect injector's changes to Kubernetes
+// manifests by running the consul-k8s-control-plane binary, which has the
+// connect injector's mutation.
+type InjectCommand struct {
+	*common.BaseCommand
+}
+
+// Run injects the manifests. The flags are passed to consul-k8s-control-plane
+// and its exit code is returned.
+func (c *InjectCommand) Run(args []string) int {
+	c.Log.ResetNamed("inject")
+	defer common.CloseWithError(c.BaseCommand)
+
+	return common.RunControlPlane(c.Ctx, c.UI, subcommand, args)
+}
+
+// Help returns the help of the consul-k8s-control-plane command.
+func (c *InjectCommand) Help() string {
+	return common.ControlPlaneHelp(subcommand, "consul-k8s inject", help)
+}
+
+// Synopsis returns a one-line command summary.
+func (c *InjectCommand) Synopsis() string {
+	return "Render the connect injector's changes to Kubernetes manifests."
+}
+
+const help = `Usage: consul-k8s inject -f <manifests> [options]
+
+  Injects the Consul dataplane sidecar and connect-init container into the
+  pod templates of the Kubernetes manifests the same way the connect injector
+  webhook does, without a Kubernetes cluster or Consul servers.`
@@ -23,6 +23,7 @@ import (
 const (
 	flagNameNamespace     = "namespace"
 	flagNameAllNamespaces = "all-namespaces"
+	flagNameOutput        = "output"
 	flagNameKubeConfig    = "kubeconfig"
 	flagNameKubeContext   = "context"
 )
@@ -37,6 +38,7 @@ type ListCommand struct {
 
 	flagNamespace     string
 	flagAllNamespaces bool
+	flagOutput        string
 
 	flagKubeConfig  string
 	flagKubeContext string
@@ -45,6 +47,13 @@ type ListCommand struct {
 	help string
 }
 
+// proxy is a pod running a proxy, as output by the command.
+type proxy struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+}
+
 // init sets up flags and help text for the command.
 func (c *ListCommand) init() {
 	c.set = flag.NewSets()
@@ -63,6 +72,13 @@ func (c *ListCommand) init() {
 		Usage:   "List pods in all namespaces.",
 		Aliases: []string{"A"},
 	})
+	f.StringVar(&flag.StringVar{
+		Name:    flagNameOutput,
+		Target:  &c.flagOutput,
+		Default: terminal.FormatTable,
+		Usage:   terminal.OutputUsage("the proxies"),
+		Aliases: []string{"o"},
+	})
 
 	f = c.set.NewSet("Global Options")
 	f.StringVar(&flag.StringVar{
@@ -113,7 +129,10 @@ func (c *ListCommand) Run(args []string) int {
 		return 1
 	}
 
-	c.output(pods)
+	if err := c.output(pods); err != nil {
+		c.UI.Output(err.Error(), terminal.WithErrorStyle())
+		return 1
+	}
 	return 0
 }
 
@@ -135,6 +154,7 @@ func (c *ListCommand) AutocompleteFlags() complete.Flags {
 	return complete.Flags{
 		fmt.Sprintf("-%s", flagNameNamespace):     complete.PredictNothing,
 		fmt.Sprintf("-%s", flagNameAllNamespaces): complete.PredictNothing,
+		fmt.Sprintf("-%s", flagNameOutput):        complete.PredictSet(terminal.Formats...),
 		fmt.Sprintf("-%s", flagNameKubeConfig):    complete.PredictFiles("*"),
 		fmt.Sprintf("-%s", flagNameKubeContext):   complete.PredictNothing,
 	}
@@ -155,6 +175,9 @@ func (c *ListCommand) validateFlags() error {
 	if errs := validation.ValidateNamespaceName(c.flagNamespace, false); c.flagNamespace != "" && len(errs) > 0 {
 		return fmt.Errorf("invalid namespace name passed for -namespace/-n: %v", strings.Join(errs, "; "))
 	}
+	if err := terminal.ValidateFormat(c.flagOutput); err != nil {
+		return err
+	}
 
 	return nil
 }
@@ -228,30 +251,9 @@ func (c *ListCommand) fetchPods() ([]v1.Pod, error) {
 	return pods, nil
 }
 
-// output prints a table of pods to the terminal.
-func (c *ListCommand) output(pods []v1.Pod) {
-	if len(pods) == 0 {
-		if c.flagAllNamespaces {
-			c.UI.Output("No proxies found across all namespaces.")
-		} else {
-			c.UI.Output("No proxies found in %s namespace.", c.namespace())
-		}
-		return
-	}
-
-	if c.flagAllNamespaces {
-		c.UI.Output("Namespace: all namespaces\n")
-	} else {
-		c.UI.Output("Namespace: %s\n", c.namespace())
-	}
-
-	var tbl *terminal.Table
-	if c.flagAllNamespaces {
-		tbl = terminal.NewTable("Namespace", "Name", "Type")
-	} else {
-		tbl = terminal.NewTable("Name", "Type")
-	}
-
+// proxies returns the proxies run by pods.
+func proxies(pods []v1.Pod) []proxy {
+	proxies := make([]proxy, 0, len(pods))
 	for _, pod := range pods {
 		var proxyType string
 
@@ -275,10 +277,46 @@ func (c *ListCommand) output(pods []v1.Pod) {
 			proxyType = "Sidecar"
 		}
 
+		proxies = append(proxies, proxy{Namespace: pod.Namespace, Name: pod.Name, Type: proxyType})
+	}
+	return proxies
+}
+
+// output prints the proxies run by pods in the output format.
+func (c *ListCommand) output(pods []v1.Pod) error {
+	result := proxies(pods)
+	return terminal.Render(c.UI, c.flagOutput, result, func() { c.outputTable(result) })
+}
+
+// outputTable prints a table of proxies to the terminal.
+func (c *ListCommand) outputTable(proxies []proxy) {
+	if len(proxies) == 0 {
+		if c.flagAllNamespaces {
+			c.UI.Output("No proxies found across all namespaces.")
+		} else {
+			c.UI.Output("No proxies found in %s namespace.", c.namespace())
+		}
+		return
+	}
+
+	if c.flagAllNamespaces {
+		c.UI.Output("Namespace: all namespaces\n")
+	} else {
+		c.UI.Output("Namespace: %s\n", c.namespace())
+	}
+
+	var tbl *terminal.Table
+	if c.flagAllNamespaces {
+		tbl = terminal.NewTable("Namespace", "Name", "Type")
+	} else {
+		tbl = terminal.NewTable("Name", "Type")
+	}
+
+	for _, p := range proxies {
 		if c.flagAllNamespaces {
-			tbl.AddRow([]string{pod.Namespace, pod.Name, proxyType}, []string{})
+			tbl.AddRow([]string{p.Namespace, p.Name, p.Type}, []string{})
 		} else {
-			tbl.AddRow([]string{pod.Name, proxyType}, []string{})
+			tbl.AddRow([]string{p.Name, p.Type}, []string{})
 		}
 	}
 
@@ -6,6 +6,7 @@ package list
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
@@ -41,6 +42,10 @@ func TestFlagParsing(t *testing.T) {
 			args: []string{"-namespace", "YOLO"},
 			out:  1,
 		},
+		"Invalid output format, -output xml": {
+			args: []string{"-output", "xml"},
+			out:  1,
+		},
 	}
 
 	for name, tc := range cases {
@@ -319,6 +324,51 @@ func TestListCommandOutput(t *testing.T) {
 	}
 }
 
+func TestListCommandOutputJSON(t *testing.T) {
+	pods := []v1.Pod{
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "mesh-gateway",
+				Namespace: "consul",
+				Labels: map[string]string{
+					"component": "mesh-gateway",
+					"chart":     "consul-helm",
+				},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "pod1",
+				Namespace: "default",
+				Labels: map[string]string{
+					"consul.hashicorp.com/connect-inject-status": "injected",
+				},
+			},
+		},
+	}
+
+	buf := new(bytes.Buffer)
+	c := setupCommand(buf)
+	c.kubernetes = fake.NewSimpleClientset(&v1.PodList{Items: pods})
+
+	out := c.Run([]string{"-A", "-o", "json"})
+	require.Equal(t, 0, out)
+
+	var actual []proxy
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &actual))
+	require.Equal(t, []proxy{
+		{Namespace: "consul", Name: "mesh-gateway", Type: "Mesh Gateway"},
+		{Namespace: "default", Name: "pod1", Type: "Sidecar"},
+	}, actual)
+
+	// No proxies is an empty list rather than a message.
+	buf.Reset()
+	c = setupCommand(buf)
+	c.kubernetes = fake.NewSimpleClientset()
+	require.Equal(t, 0, c.Run([]string{"-o", "json"}))
+	require.Equal(t, "[]\n", buf.String())
+}
+
 func TestNoPodsFound(t *testing.T) {
 	cases := map[string]struct {
 		args     []string
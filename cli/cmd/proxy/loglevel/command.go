@@ -28,6 +28,7 @@ const (
 	flagNameNamespace   = "namespace"
 	flagNameUpdateLevel = "update-level"
 	flagNameReset       = "reset"
+	flagNameOutput      = "output"
 	flagNameKubeConfig  = "kubeconfig"
 	flagNameKubeContext = "context"
 )
@@ -57,6 +58,7 @@ type LogLevelCommand struct {
 	namespace   string
 	level       string
 	reset       bool
+	output      string
 	kubeConfig  string
 	kubeContext string
 
@@ -91,6 +93,14 @@ func (l *LogLevelCommand) init() {
 		Aliases: []string{"r"},
 	})
 
+	f.StringVar(&flag.StringVar{
+		Name:    flagNameOutput,
+		Target:  &l.output,
+		Default: terminal.FormatTable,
+		Usage:   terminal.OutputUsage("the log levels of each proxy"),
+		Aliases: []string{"o"},
+	})
+
 	f = l.set.NewSet("Global Options")
 	f.StringVar(&flag.StringVar{
 		Name:    flagNameKubeConfig,
@@ -180,6 +190,9 @@ func (l *LogLevelCommand) validateFlags() error {
 	if l.level != "" && l.reset {
 		return fmt.Errorf("cannot set log level to %q and reset to 'info' at the same time", l.level)
 	}
+	if err := terminal.ValidateFormat(l.output); err != nil {
+		return err
+	}
 	if l.namespace == "" {
 		return nil
 	}
@@ -270,8 +283,7 @@ func (l *LogLevelCommand) fetchOrSetLogLevels(adminPorts map[string]int) error {
 		loggers[name] = logLevels
 	}
 
-	l.outputLevels(loggers)
-	return nil
+	return terminal.Render(l.UI, l.output, loggers, func() { l.outputLevels(loggers) })
 }
 
 func parseParams(params string) (*envoy.LoggerParams, error) {
@@ -330,6 +342,7 @@ func (l *LogLevelCommand) Synopsis() string {
 func (l *LogLevelCommand) AutocompleteFlags() complete.Flags {
 	return complete.Flags{
 		fmt.Sprintf("-%s", flagNameNamespace):   complete.PredictNothing,
+		fmt.Sprintf("-%s", flagNameOutput):      complete.PredictSet(terminal.Formats...),
 		fmt.Sprintf("-%s", flagNameKubeConfig):  complete.PredictFiles("*"),
 		fmt.Sprintf("-%s", flagNameKubeContext): complete.PredictNothing,
 	}
@@ -6,6 +6,7 @@ package loglevel
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
@@ -45,6 +46,10 @@ func TestFlagParsingFails(t *testing.T) {
 			args: []string{"podName", "-namespace", "YOLO"},
 			out:  1,
 		},
+		"Invalid output format, -output xml": {
+			args: []string{"podName", "-output", "xml"},
+			out:  1,
+		},
 	}
 	podName := "now-this-is-pod-racing"
 	fakePod := v1.Pod{
@@ -207,6 +212,31 @@ func TestOutputForSettingLogLevels(t *testing.T) {
 	}
 }
 
+func TestOutputJSON(t *testing.T) {
+	t.Parallel()
+	podName := "now-this-is-pod-racing"
+	fakePod := v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      podName,
+			Namespace: "default",
+		},
+	}
+
+	buf := bytes.NewBuffer([]byte{})
+	c := setupCommand(buf)
+	c.envoyLoggingCaller = func(context.Context, common.PortForwarder, *envoy.LoggerParams) (map[string]string, error) {
+		return testLogConfig, nil
+	}
+	c.kubernetes = fake.NewSimpleClientset(&v1.PodList{Items: []v1.Pod{fakePod}})
+
+	out := c.Run([]string{podName, "-output", "json"})
+	require.Equal(t, 0, out)
+
+	var actual map[string]LoggerConfig
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &actual))
+	require.Equal(t, map[string]LoggerConfig{podName: testLogConfig}, actual)
+}
+
 func TestHelp(t *testing.T) {
 	t.Parallel()
 	buf := bytes.NewBuffer([]byte{})
@@ -16,7 +16,6 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
-	"k8s.io/utils/strings/slices"
 
 	"github.com/hashicorp/consul-k8s/cli/common"
 	"github.com/hashicorp/consul-k8s/cli/common/envoy"
@@ -28,9 +27,8 @@ import (
 const defaultAdminPort int = 19000
 
 const (
-	Table = "table"
-	JSON  = "json"
-	Raw   = "raw"
+	// Raw outputs the Envoy config dump as it was fetched.
+	Raw = "raw"
 
 	flagNameNamespace   = "namespace"
 	flagNameOutput      = "output"
@@ -96,8 +94,8 @@ func (c *ReadCommand) init() {
 	f.StringVar(&flag.StringVar{
 		Name:    flagNameOutput,
 		Target:  &c.flagOutput,
-		Usage:   "Output the Envoy configuration as 'table', 'json', or 'raw'.",
-		Default: Table,
+		Usage:   terminal.OutputUsage("the Envoy configuration", Raw) + " 'raw' outputs the unfiltered config dump.",
+		Default: terminal.FormatTable,
 		Aliases: []string{"o"},
 	})
 
@@ -218,7 +216,7 @@ func (c *ReadCommand) Synopsis() string {
 func (c *ReadCommand) AutocompleteFlags() complete.Flags {
 	return complete.Flags{
 		fmt.Sprintf("-%s", flagNameNamespace):   complete.PredictNothing,
-		fmt.Sprintf("-%s", flagNameOutput):      complete.PredictNothing,
+		fmt.Sprintf("-%s", flagNameOutput):      complete.PredictSet(append(terminal.Formats, Raw)...),
 		fmt.Sprintf("-%s", flagNameClusters):    complete.PredictNothing,
 		fmt.Sprintf("-%s", flagNameListeners):   complete.PredictNothing,
 		fmt.Sprintf("-%s", flagNameRoutes):      complete.PredictNothing,
@@ -266,8 +264,8 @@ func (c *ReadCommand) validateFlags() error {
 	if errs := validation.ValidateNamespaceName(c.flagNamespace, false); c.flagNamespace != "" && len(errs) > 0 {
 		return fmt.Errorf("invalid namespace name passed for -namespace/-n: %v", strings.Join(errs, "; "))
 	}
-	if outputs := []string{Table, JSON, Raw}; !slices.Contains(outputs, c.flagOutput) {
-		return fmt.Errorf("-output must be one of %s.", strings.Join(outputs, ", "))
+	if err := terminal.ValidateFormat(c.flagOutput, Raw); err != nil {
+		return err
 	}
 	return nil
 }
@@ -349,16 +347,11 @@ func (c *ReadCommand) fetchConfigs(adminPorts map[string]int) (map[string]*envoy
 }
 
 func (c *ReadCommand) outputConfigs(configs map[string]*envoy.EnvoyConfig) error {
-	switch c.flagOutput {
-	case Table:
-		return c.outputTables(configs)
-	case JSON:
-		return c.outputJSON(configs)
-	case Raw:
+	if c.flagOutput == Raw {
 		return c.outputRaw(configs)
 	}
 
-	return nil
+	return terminal.Render(c.UI, c.flagOutput, c.filterConfigs(configs), func() { c.outputTables(configs) })
 }
 
 // shouldPrintTable takes the flag passed in for that table. If the flag is true,
@@ -401,7 +394,7 @@ func (c *ReadCommand) filterWarnings() []string {
 	return warnings
 }
 
-func (c *ReadCommand) outputTables(configs map[string]*envoy.EnvoyConfig) error {
+func (c *ReadCommand) outputTables(configs map[string]*envoy.EnvoyConfig) {
 	if c.flagFQDN != "" || c.flagAddress != "" || c.flagPort != -1 {
 		c.UI.Output("Filters applied", terminal.WithHeaderStyle())
 
@@ -432,11 +425,11 @@ func (c *ReadCommand) outputTables(configs map[string]*envoy.EnvoyConfig) error
 		c.outputSecretsTable(config.Secrets)
 		c.UI.Output("\n")
 	}
-
-	return nil
 }
 
-func (c *ReadCommand) outputJSON(configs map[string]*envoy.EnvoyConfig) error {
+// filterConfigs returns the filtered tables of the configs, keyed by the
+// name of their proxy.
+func (c *ReadCommand) filterConfigs(configs map[string]*envoy.EnvoyConfig) map[string]interface{} {
 	cfgs := make(map[string]interface{})
 	for name, config := range configs {
 		cfg := make(map[string]interface{})
@@ -459,17 +452,7 @@ func (c *ReadCommand) outputJSON(configs map[string]*envoy.EnvoyConfig) error {
 		cfgs[name] = cfg
 	}
 
-	escaped, err := json.MarshalIndent(cfgs, "", "\t")
-	if err != nil {
-		return err
-	}
-
-	// Unescape `>` the cheap way.
-	out := strings.ReplaceAll(string(escaped), "\\u003e", ">")
-
-	c.UI.Output(out)
-
-	return nil
+	return cfgs
 }
 
 func (c *ReadCommand) outputRaw(configs map[string]*envoy.EnvoyConfig) error {
@@ -6,6 +6,7 @@ package read
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
@@ -18,6 +19,7 @@ import (
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes/fake"
+	"sigs.k8s.io/yaml"
 
 	"github.com/hashicorp/consul-k8s/cli/common"
 	"github.com/hashicorp/consul-k8s/cli/common/envoy"
@@ -159,6 +161,43 @@ func TestReadCommandOutput(t *testing.T) {
 	}
 }
 
+func TestReadCommandStructuredOutput(t *testing.T) {
+	podName := "fakePod"
+	fakePod := v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      podName,
+			Namespace: "default",
+		},
+	}
+
+	run := func(args ...string) string {
+		buf := new(bytes.Buffer)
+		c := setupCommand(buf)
+		c.kubernetes = fake.NewSimpleClientset(&v1.PodList{Items: []v1.Pod{fakePod}})
+		c.fetchConfig = func(context.Context, common.PortForwarder) (*envoy.EnvoyConfig, error) {
+			return testEnvoyConfig, nil
+		}
+		require.Equal(t, 0, c.Run(append([]string{podName}, args...)), buf.String())
+		return buf.String()
+	}
+
+	// JSON only has the tables that aren't filtered out.
+	var actual map[string]map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal([]byte(run("-output", "json", "-clusters", "-routes")), &actual))
+	require.Len(t, actual, 1)
+	require.Contains(t, actual[podName], "clusters")
+	require.Contains(t, actual[podName], "routes")
+	require.Len(t, actual[podName], 2)
+
+	// YAML has the same fields as JSON.
+	var fromYAML map[string]map[string][]envoy.Cluster
+	require.NoError(t, yaml.Unmarshal([]byte(run("-output", "yaml", "-clusters")), &fromYAML))
+	require.Equal(t, testEnvoyConfig.Clusters, fromYAML[podName]["clusters"])
+
+	template := `template={{range $name, $config := .}}{{$name}}: {{len $config.clusters}} clusters{{end}}`
+	require.Equal(t, fmt.Sprintf("%s: %d clusters\n", podName, len(testEnvoyConfig.Clusters)), run("-output", template))
+}
+
 // TestFilterWarnings ensures that a warning is printed if the user applies a
 // field filter (e.g. -fqdn default) and a table filter (e.g. -secrets) where
 // the former does not affect the output of the latter.
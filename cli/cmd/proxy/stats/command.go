@@ -0,0 +1,468 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package stats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/posener/complete"
+	helmCLI "helm.sh/helm/v3/pkg/cli"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/validation"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"github.com/hashicorp/consul-k8s/cli/common"
+	"github.com/hashicorp/consul-k8s/cli/common/envoy"
+	"github.com/hashicorp/consul-k8s/cli/common/flag"
+	"github.com/hashicorp/consul-k8s/cli/common/terminal"
+)
+
+// defaultAdminPort is the port where the Envoy admin API is exposed.
+const defaultAdminPort int = 19000
+
+// defaultSelector selects the Pods with injected sidecar proxies when neither a
+// Pod name nor a selector is passed.
+const defaultSelector = "consul.hashicorp.com/connect-inject-status=injected"
+
+const (
+	// Prometheus outputs the unsampled stats in the Prometheus text format.
+	Prometheus = "prometheus"
+
+	flagNameNamespace     = "namespace"
+	flagNameAllNamespaces = "all-namespaces"
+	flagNameSelector      = "selector"
+	flagNameOutput        = "output"
+	flagNameInterval      = "interval"
+	flagNameCluster       = "cluster"
+	flagNameListener      = "listener"
+	flagNameKubeConfig    = "kubeconfig"
+	flagNameKubeContext   = "context"
+)
+
+// StatsCommand is the command struct for the proxy stats command.
+type StatsCommand struct {
+	*common.BaseCommand
+
+	kubernetes kubernetes.Interface
+
+	set *flag.Sets
+
+	// Command Flags
+	flagPodName       string
+	flagNamespace     string
+	flagAllNamespaces bool
+	flagSelector      string
+	flagOutput        string
+	flagInterval      time.Duration
+
+	// Output Filtering Opts
+	flagCluster  string
+	flagListener string
+
+	// Global Flags
+	flagKubeConfig  string
+	flagKubeContext string
+
+	fetchStats           func(context.Context, common.PortForwarder) (*envoy.Stats, error)
+	fetchPrometheusStats func(context.Context, common.PortForwarder, string) (string, error)
+
+	restConfig *rest.Config
+
+	once sync.Once
+	help string
+}
+
+// target is an Envoy proxy to fetch stats from. Pods with multiple services
+// run a proxy per service, each with its own admin port.
+type target struct {
+	Namespace string `json:"namespace"`
+	Pod       string `json:"pod"`
+	Proxy     string `json:"proxy"`
+	adminPort int
+}
+
+// targetStats is the output for a single target.
+type targetStats struct {
+	target
+	Interval string `json:"interval"`
+	Stats    []Row  `json:"stats"`
+}
+
+func (c *StatsCommand) init() {
+	if c.fetchStats == nil {
+		c.fetchStats = envoy.FetchStats
+	}
+	if c.fetchPrometheusStats == nil {
+		c.fetchPrometheusStats = envoy.FetchPrometheusStats
+	}
+
+	c.set = flag.NewSets()
+	f := c.set.NewSet("Command Options")
+	f.StringVar(&flag.StringVar{
+		Name:    flagNameNamespace,
+		Target:  &c.flagNamespace,
+		Usage:   "The namespace where the target Pods can be found.",
+		Aliases: []string{"n"},
+	})
+	f.BoolVar(&flag.BoolVar{
+		Name:    flagNameAllNamespaces,
+		Target:  &c.flagAllNamespaces,
+		Default: false,
+		Usage:   "Fetch stats from Pods in all namespaces. Cannot be used with a Pod name.",
+		Aliases: []string{"A"},
+	})
+	f.StringVar(&flag.StringVar{
+		Name:    flagNameSelector,
+		Target:  &c.flagSelector,
+		Usage:   fmt.Sprintf("Label selector for the Pods to fetch stats from when no Pod name is given. Defaults to %q.", defaultSelector),
+		Aliases: []string{"l"},
+	})
+	f.StringVar(&flag.StringVar{
+		Name:    flagNameOutput,
+		Target:  &c.flagOutput,
+		Usage:   terminal.OutputUsage("the stats", Prometheus) + " Prometheus output is the unsampled Envoy stats in the Prometheus text format.",
+		Default: terminal.FormatTable,
+		Aliases: []string{"o"},
+	})
+	f.DurationVar(&flag.DurationVar{
+		Name:    flagNameInterval,
+		Target:  &c.flagInterval,
+		Default: 5 * time.Second,
+		Usage:   "How long to sample the stats for when computing rates and counts.",
+		Aliases: []string{"i"},
+	})
+
+	f = c.set.NewSet("Output Filtering Options")
+	f.StringVar(&flag.StringVar{
+		Name:   flagNameCluster,
+		Target: &c.flagCluster,
+		Usage:  "Filter output to upstream clusters with names which contain the given value. May be combined with -listener.",
+	})
+	f.StringVar(&flag.StringVar{
+		Name:   flagNameListener,
+		Target: &c.flagListener,
+		Usage:  "Filter output to listeners with names which contain the given value. May be combined with -cluster.",
+	})
+
+	f = c.set.NewSet("Global Options")
+	f.StringVar(&flag.StringVar{
+		Name:    flagNameKubeConfig,
+		Aliases: []string{"c"},
+		Target:  &c.flagKubeConfig,
+		Usage:   "Set the path to kubeconfig file.",
+	})
+	f.StringVar(&flag.StringVar{
+		Name:   flagNameKubeContext,
+		Target: &c.flagKubeContext,
+		Usage:  "Set the Kubernetes context to use.",
+	})
+
+	c.help = c.set.Help()
+}
+
+// Run executes the stats command.
+func (c *StatsCommand) Run(args []string) int {
+	c.once.Do(c.init)
+	c.Log.ResetNamed("stats")
+	defer common.CloseWithError(c.BaseCommand)
+
+	if err := c.parseFlags(args); err != nil {
+		c.UI.Output(err.Error(), terminal.WithErrorStyle())
+		c.UI.Output("\n" + c.Help())
+		return 1
+	}
+
+	if err := c.validateFlags(); err != nil {
+		c.UI.Output(err.Error(), terminal.WithErrorStyle())
+		c.UI.Output("\n" + c.Help())
+		return 1
+	}
+
+	if err := c.initKubernetes(); err != nil {
+		c.UI.Output(err.Error(), terminal.WithErrorStyle())
+		return 1
+	}
+
+	targets, err := c.fetchTargets()
+	if err != nil {
+		c.UI.Output(err.Error(), terminal.WithErrorStyle())
+		return 1
+	}
+	if len(targets) == 0 && !terminal.Structured(c.flagOutput) {
+		c.UI.Output("No proxies found matching the selector.")
+		return 0
+	}
+
+	if c.flagOutput == Prometheus {
+		err = c.outputPrometheus(targets)
+	} else {
+		var results []targetStats
+		if results, err = c.sampleStats(targets); err == nil {
+			err = c.outputStats(results)
+		}
+	}
+	if err != nil {
+		c.UI.Output(err.Error(), terminal.WithErrorStyle())
+		return 1
+	}
+
+	return 0
+}
+
+// Help returns a description of the command and how it is used.
+func (c *StatsCommand) Help() string {
+	c.once.Do(c.init)
+	return fmt.Sprintf("%s\n\nUsage: consul-k8s proxy stats [<pod-name>] [flags]\n\n%s", c.Synopsis(), c.help)
+}
+
+// Synopsis returns a one-line command summary.
+func (c *StatsCommand) Synopsis() string {
+	return "Inspect the traffic statistics of Envoy proxies."
+}
+
+// AutocompleteFlags returns a mapping of supported flags and autocomplete
+// options for this command. The map key for the Flags map should be the
+// complete flag such as "-foo" or "--foo".
+func (c *StatsCommand) AutocompleteFlags() complete.Flags {
+	return complete.Flags{
+		fmt.Sprintf("-%s", flagNameNamespace):     complete.PredictNothing,
+		fmt.Sprintf("-%s", flagNameAllNamespaces): complete.PredictNothing,
+		fmt.Sprintf("-%s", flagNameSelector):      complete.PredictNothing,
+		fmt.Sprintf("-%s", flagNameOutput):        complete.PredictSet(append(terminal.Formats, Prometheus)...),
+		fmt.Sprintf("-%s", flagNameInterval):      complete.PredictNothing,
+		fmt.Sprintf("-%s", flagNameCluster):       complete.PredictNothing,
+		fmt.Sprintf("-%s", flagNameListener):      complete.PredictNothing,
+		fmt.Sprintf("-%s", flagNameKubeConfig):    complete.PredictFiles("*"),
+		fmt.Sprintf("-%s", flagNameKubeContext):   complete.PredictNothing,
+	}
+}
+
+// AutocompleteArgs returns the argument predictor for this command.
+// Since argument completion is not supported, this will return
+// complete.PredictNothing.
+func (c *StatsCommand) AutocompleteArgs() complete.Predictor {
+	return complete.PredictNothing
+}
+
+func (c *StatsCommand) parseFlags(args []string) error {
+	// Separate positional arguments from keyed arguments.
+	positional := []string{}
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-") {
+			break
+		}
+		positional = append(positional, arg)
+	}
+	keyed := args[len(positional):]
+
+	if len(positional) > 1 {
+		return errors.New("At most one positional argument may be passed: <pod-name>")
+	}
+	if len(positional) == 1 {
+		c.flagPodName = positional[0]
+	}
+
+	return c.set.Parse(keyed)
+}
+
+func (c *StatsCommand) validateFlags() error {
+	if errs := validation.ValidateNamespaceName(c.flagNamespace, false); c.flagNamespace != "" && len(errs) > 0 {
+		return fmt.Errorf("invalid namespace name passed for -namespace/-n: %v", strings.Join(errs, "; "))
+	}
+	if c.flagPodName != "" && (c.flagAllNamespaces || c.flagSelector != "") {
+		return errors.New("-all-namespaces and -selector cannot be used with a Pod name")
+	}
+	if err := terminal.ValidateFormat(c.flagOutput, Prometheus); err != nil {
+		return err
+	}
+	if c.flagInterval <= 0 {
+		return errors.New("-interval must be greater than 0")
+	}
+	return nil
+}
+
+func (c *StatsCommand) initKubernetes() (err error) {
+	settings := helmCLI.New()
+
+	if c.flagKubeConfig != "" {
+		settings.KubeConfig = c.flagKubeConfig
+	}
+
+	if c.flagKubeContext != "" {
+		settings.KubeContext = c.flagKubeContext
+	}
+
+	if c.restConfig == nil {
+		if c.restConfig, err = settings.RESTClientGetter().ToRESTConfig(); err != nil {
+			return fmt.Errorf("error creating Kubernetes REST config %v", err)
+		}
+	}
+
+	if c.kubernetes == nil {
+		if c.kubernetes, err = kubernetes.NewForConfig(c.restConfig); err != nil {
+			return fmt.Errorf("error creating Kubernetes client %v", err)
+		}
+	}
+
+	if c.flagNamespace == "" {
+		c.flagNamespace = settings.Namespace()
+	}
+
+	return nil
+}
+
+// fetchTargets returns the proxies in the Pod passed as an argument, or in the
+// Pods matching the selector.
+func (c *StatsCommand) fetchTargets() ([]target, error) {
+	if c.flagPodName != "" {
+		pod, err := c.kubernetes.CoreV1().Pods(c.flagNamespace).Get(c.Ctx, c.flagPodName, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return podTargets(*pod), nil
+	}
+
+	namespace := c.flagNamespace
+	if c.flagAllNamespaces {
+		namespace = "" // An empty namespace means all namespaces.
+	}
+	selector := c.flagSelector
+	if selector == "" {
+		selector = defaultSelector
+	}
+	pods, err := c.kubernetes.CoreV1().Pods(namespace).List(c.Ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, err
+	}
+
+	var targets []target
+	for _, pod := range pods.Items {
+		targets = append(targets, podTargets(pod)...)
+	}
+	return targets, nil
+}
+
+// podTargets returns a target for each proxy in the Pod.
+func podTargets(pod v1.Pod) []target {
+	connectService, isMultiport := pod.Annotations["consul.hashicorp.com/connect-service"]
+	if !isMultiport || !strings.Contains(connectService, ",") {
+		return []target{{Namespace: pod.Namespace, Pod: pod.Name, Proxy: pod.Name, adminPort: defaultAdminPort}}
+	}
+
+	var targets []target
+	for index, service := range strings.Split(connectService, ",") {
+		targets = append(targets, target{Namespace: pod.Namespace, Pod: pod.Name, Proxy: service, adminPort: defaultAdminPort + index})
+	}
+	return targets
+}
+
+func (c *StatsCommand) portForward(t target) *common.PortForward {
+	return &common.PortForward{
+		Namespace:  t.Namespace,
+		PodName:    t.Pod,
+		RemotePort: t.adminPort,
+		KubeClient: c.kubernetes,
+		RestConfig: c.restConfig,
+	}
+}
+
+// sampleStats takes a snapshot of the stats of every target, waits for the
+// interval and takes another. The rows are computed over the actual time
+// between the snapshots of each target because port forwarding to many Pods
+// takes a while.
+func (c *StatsCommand) sampleStats(targets []target) ([]targetStats, error) {
+	if len(targets) == 0 {
+		return []targetStats{}, nil
+	}
+
+	first := make([]*envoy.Stats, len(targets))
+	for i, t := range targets {
+		stats, err := c.fetchStats(c.Ctx, c.portForward(t))
+		if err != nil {
+			return nil, fmt.Errorf("error fetching stats for %s/%s: %w", t.Namespace, t.Proxy, err)
+		}
+		first[i] = stats
+	}
+
+	select {
+	case <-time.After(c.flagInterval):
+	case <-c.Ctx.Done():
+		return nil, c.Ctx.Err()
+	}
+
+	filter := Filter{Cluster: c.flagCluster, Listener: c.flagListener}
+	results := make([]targetStats, len(targets))
+	for i, t := range targets {
+		second, err := c.fetchStats(c.Ctx, c.portForward(t))
+		if err != nil {
+			return nil, fmt.Errorf("error fetching stats for %s/%s: %w", t.Namespace, t.Proxy, err)
+		}
+		results[i] = targetStats{
+			target:   t,
+			Interval: interval(first[i], second).String(),
+			Stats:    Compute(first[i], second, filter),
+		}
+	}
+	return results, nil
+}
+
+func (c *StatsCommand) outputStats(results []targetStats) error {
+	return terminal.Render(c.UI, c.flagOutput, results, func() {
+		for _, result := range results {
+			c.UI.Output(fmt.Sprintf("Envoy stats for %s in namespace %s over %s:", result.Proxy, result.Namespace, result.Interval))
+			c.UI.Output(fmt.Sprintf("Stats (%d)", len(result.Stats)), terminal.WithHeaderStyle())
+			c.UI.Table(formatRows(result.Stats))
+			c.UI.Output("")
+		}
+	})
+}
+
+func (c *StatsCommand) outputPrometheus(targets []target) error {
+	filter := PrometheusFilter(Filter{Cluster: c.flagCluster, Listener: c.flagListener})
+	for _, t := range targets {
+		stats, err := c.fetchPrometheusStats(c.Ctx, c.portForward(t), filter)
+		if err != nil {
+			return fmt.Errorf("error fetching stats for %s/%s: %w", t.Namespace, t.Proxy, err)
+		}
+		// Comments keep the output valid in the Prometheus text format when
+		// there are multiple targets.
+		if len(targets) > 1 {
+			c.UI.Output(fmt.Sprintf("# Envoy stats for %s in namespace %s", t.Proxy, t.Namespace))
+		}
+		c.UI.Output(strings.TrimRight(stats, "\n"))
+	}
+	return nil
+}
+
+func formatRows(rows []Row) *terminal.Table {
+	table := terminal.NewTable("Type", "Name", "RQ/s", "5xx/s", "CX/s", "Active CX", "Retries", "CB Overflows")
+	for _, row := range rows {
+		var errorColor, overflowColor string
+		if row.Errors5xxPerSecond > 0 {
+			errorColor = terminal.Red
+		}
+		if row.CircuitBreakerOverflows > 0 {
+			overflowColor = terminal.Yellow
+		}
+
+		table.AddRow([]string{
+			row.Type,
+			row.Name,
+			fmt.Sprintf("%.2f", row.RequestsPerSecond),
+			fmt.Sprintf("%.2f", row.Errors5xxPerSecond),
+			fmt.Sprintf("%.2f", row.ConnectionsPerSecond),
+			fmt.Sprintf("%d", row.ActiveConnections),
+			fmt.Sprintf("%d", row.Retries),
+			fmt.Sprintf("%d", row.CircuitBreakerOverflows),
+		}, []string{"", "", "", errorColor, "", "", "", overflowColor})
+	}
+	return table
+}
@@ -0,0 +1,342 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package stats
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/posener/complete"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/hashicorp/consul-k8s/cli/common"
+	"github.com/hashicorp/consul-k8s/cli/common/envoy"
+	cmnFlag "github.com/hashicorp/consul-k8s/cli/common/flag"
+	"github.com/hashicorp/consul-k8s/cli/common/terminal"
+)
+
+func TestFlagParsing(t *testing.T) {
+	cases := map[string]struct {
+		args []string
+		out  int
+	}{
+		"No args": {
+			args: []string{"-interval", "1ms"},
+			out:  0,
+		},
+		"Pod name": {
+			args: []string{"fakePod", "-interval", "1ms"},
+			out:  0,
+		},
+		"Multiple pod names": {
+			args: []string{"fakePod", "fakePod2"},
+			out:  1,
+		},
+		"Pod name with all namespaces": {
+			args: []string{"fakePod", "-A"},
+			out:  1,
+		},
+		"Pod name with selector": {
+			args: []string{"fakePod", "-l", "app=backend"},
+			out:  1,
+		},
+		"Nonexistent flag passed, -foo bar": {
+			args: []string{"fakePod", "-foo", "bar"},
+			out:  1,
+		},
+		"Invalid argument passed, -namespace YOLO": {
+			args: []string{"fakePod", "-namespace", "YOLO"},
+			out:  1,
+		},
+		"Invalid output passed, -output xml": {
+			args: []string{"fakePod", "-output", "xml"},
+			out:  1,
+		},
+		"Invalid interval passed, -interval 0s": {
+			args: []string{"fakePod", "-interval", "0s"},
+			out:  1,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			c := setupCommand(new(bytes.Buffer))
+			c.kubernetes = fake.NewSimpleClientset(testPod("fakePod", "default", nil))
+			c.fetchStats = newFakeStats().fetch
+
+			out := c.Run(tc.args)
+			require.Equal(t, tc.out, out)
+		})
+	}
+}
+
+func TestStatsCommandOutput(t *testing.T) {
+	pods := []v1.Pod{
+		*testPod("backend", "default", map[string]string{"app": "backend"}),
+		*testPod("frontend", "web", map[string]string{"app": "frontend"}),
+		*testPod("not-injected", "default", nil),
+	}
+	pods[2].Labels = map[string]string{}
+
+	cases := map[string]struct {
+		args     []string
+		expected []string
+		excluded []string
+	}{
+		"Single pod": {
+			args: []string{"backend"},
+			expected: []string{
+				"Envoy stats for backend in namespace default over",
+				"Type.*Name.*RQ/s.*5xx/s.*CX/s.*Active CX.*Retries.*CB Overflows",
+				"cluster.*backend\\.default\\.dc1.*\\d+\\.\\d\\d.*",
+				"http.*public_listener",
+			},
+			excluded: []string{"frontend in namespace web"},
+		},
+		"All namespaces": {
+			args: []string{"-A"},
+			expected: []string{
+				"Envoy stats for backend in namespace default over",
+				"Envoy stats for frontend in namespace web over",
+			},
+			excluded: []string{"not-injected"},
+		},
+		"Selector": {
+			args: []string{"-A", "-l", "app=frontend"},
+			expected: []string{
+				"Envoy stats for frontend in namespace web over",
+			},
+			excluded: []string{"backend in namespace default"},
+		},
+		"Cluster filter": {
+			args: []string{"backend", "-cluster", "backend"},
+			expected: []string{
+				"Stats \\(1\\)",
+				"cluster.*backend\\.default\\.dc1",
+			},
+			excluded: []string{"public_listener"},
+		},
+		"Listener filter": {
+			args: []string{"backend", "-listener", "public"},
+			expected: []string{
+				"Stats \\(1\\)",
+				"http.*public_listener",
+			},
+			excluded: []string{"dc1"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			buf := new(bytes.Buffer)
+			c := setupCommand(buf)
+			c.kubernetes = fake.NewSimpleClientset(&v1.PodList{Items: pods})
+			c.fetchStats = newFakeStats().fetch
+
+			out := c.Run(append(tc.args, "-interval", "1ms"))
+			require.Equal(t, 0, out)
+
+			actual := buf.String()
+			for _, expression := range tc.expected {
+				require.Regexp(t, expression, actual)
+			}
+			for _, expression := range tc.excluded {
+				require.NotRegexp(t, expression, actual)
+			}
+		})
+	}
+}
+
+func TestStatsCommandOutput_JSON(t *testing.T) {
+	buf := new(bytes.Buffer)
+	c := setupCommand(buf)
+	c.kubernetes = fake.NewSimpleClientset(testPod("backend", "default", nil))
+	c.fetchStats = newFakeStats().fetch
+
+	out := c.Run([]string{"backend", "-o", "json", "-interval", "1ms", "-cluster", "backend"})
+	require.Equal(t, 0, out)
+
+	var actual []map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &actual))
+	require.Len(t, actual, 1)
+	require.Equal(t, "default", actual[0]["namespace"])
+	require.Equal(t, "backend", actual[0]["pod"])
+	require.Equal(t, "backend", actual[0]["proxy"])
+
+	rows := actual[0]["stats"].([]interface{})
+	require.Len(t, rows, 1)
+	row := rows[0].(map[string]interface{})
+	require.Equal(t, TypeCluster, row["type"])
+	require.Equal(t, backendCluster, row["name"])
+	require.Equal(t, float64(2), row["activeConnections"])
+	require.Equal(t, float64(3), row["retries"])
+	require.Equal(t, float64(4), row["circuitBreakerOverflows"])
+	require.Greater(t, row["requestsPerSecond"], float64(0))
+}
+
+func TestStatsCommandOutput_NoProxies(t *testing.T) {
+	cases := map[string]struct {
+		output   string
+		expected string
+	}{
+		"table": {
+			output:   "table",
+			expected: "No proxies found matching the selector.\n",
+		},
+		"json": {
+			output:   "json",
+			expected: "[]\n",
+		},
+		"yaml": {
+			output:   "yaml",
+			expected: "[]\n",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			buf := new(bytes.Buffer)
+			c := setupCommand(buf)
+			c.kubernetes = fake.NewSimpleClientset()
+
+			out := c.Run([]string{"-o", tc.output})
+			require.Equal(t, 0, out)
+			require.Equal(t, tc.expected, buf.String())
+		})
+	}
+}
+
+func TestStatsCommandOutput_Prometheus(t *testing.T) {
+	pod := testPod("backend", "default", nil)
+	pod.Annotations = map[string]string{"consul.hashicorp.com/connect-service": "backend,backend-admin"}
+
+	buf := new(bytes.Buffer)
+	c := setupCommand(buf)
+	c.kubernetes = fake.NewSimpleClientset(pod)
+	var filters []string
+	c.fetchPrometheusStats = func(_ context.Context, pf common.PortForwarder, filter string) (string, error) {
+		filters = append(filters, filter)
+		return fmt.Sprintf("envoy_cluster_upstream_rq_total{envoy_cluster_name=\"backend\"} %d\n", pf.(*common.PortForward).RemotePort), nil
+	}
+
+	out := c.Run([]string{"backend", "-o", "prometheus", "-cluster", "backend"})
+	require.Equal(t, 0, out)
+
+	actual := buf.String()
+	require.Contains(t, actual, "# Envoy stats for backend in namespace default\nenvoy_cluster_upstream_rq_total{envoy_cluster_name=\"backend\"} 19000")
+	require.Contains(t, actual, "# Envoy stats for backend-admin in namespace default\nenvoy_cluster_upstream_rq_total{envoy_cluster_name=\"backend\"} 19001")
+	require.Equal(t, []string{`^cluster\..*backend`, `^cluster\..*backend`}, filters)
+}
+
+func TestTaskCreateCommand_AutocompleteFlags(t *testing.T) {
+	t.Parallel()
+	buf := new(bytes.Buffer)
+	cmd := setupCommand(buf)
+
+	predictor := cmd.AutocompleteFlags()
+
+	// Test that we get the expected number of predictions
+	args := complete.Args{Last: "-"}
+	res := predictor.Predict(args)
+
+	// Grab the list of flags from the Flag object
+	flags := make([]string, 0)
+	cmd.set.VisitSets(func(name string, set *cmnFlag.Set) {
+		set.VisitAll(func(flag *flag.Flag) {
+			flags = append(flags, fmt.Sprintf("-%s", flag.Name))
+		})
+	})
+
+	// Verify that there is a prediction for each flag associated with the command
+	assert.Equal(t, len(flags), len(res))
+	assert.ElementsMatch(t, flags, res, "flags and predictions didn't match, make sure to add "+
+		"new flags to the command AutoCompleteFlags function")
+}
+
+func TestTaskCreateCommand_AutocompleteArgs(t *testing.T) {
+	buf := new(bytes.Buffer)
+	cmd := setupCommand(buf)
+	c := cmd.AutocompleteArgs()
+	assert.Equal(t, complete.PredictNothing, c)
+}
+
+// fakeStats returns snapshots whose counters increase on every fetch.
+type fakeStats struct {
+	mu      sync.Mutex
+	fetches map[int]int
+	start   time.Time
+}
+
+func newFakeStats() *fakeStats {
+	return &fakeStats{fetches: make(map[int]int), start: time.Now()}
+}
+
+func (f *fakeStats) fetch(_ context.Context, pf common.PortForwarder) (*envoy.Stats, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	port := pf.(*common.PortForward).RemotePort
+	n := uint64(f.fetches[port])
+	f.fetches[port]++
+
+	return &envoy.Stats{
+		Time: f.start.Add(time.Duration(n) * time.Second),
+		Values: map[string]uint64{
+			"cluster." + backendCluster + ".upstream_rq_total":    100 + 10*n,
+			"cluster." + backendCluster + ".upstream_cx_active":   2,
+			"cluster." + backendCluster + ".upstream_rq_retry":    3 * n,
+			"cluster." + backendCluster + ".upstream_cx_overflow": 4 * n,
+			"http.public_listener.downstream_rq_total":            50 + 5*n,
+			"http.admin.downstream_rq_total":                      n,
+		},
+	}, nil
+}
+
+func testPod(name, namespace string, labels map[string]string) *v1.Pod {
+	podLabels := map[string]string{"consul.hashicorp.com/connect-inject-status": "injected"}
+	for k, v := range labels {
+		podLabels[k] = v
+	}
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    podLabels,
+		},
+	}
+}
+
+func setupCommand(buf io.Writer) *StatsCommand {
+	// Log at a test level to standard out.
+	log := hclog.New(&hclog.LoggerOptions{
+		Name:   "test",
+		Level:  hclog.Debug,
+		Output: os.Stdout,
+	})
+
+	// Setup and initialize the command struct
+	command := &StatsCommand{
+		BaseCommand: &common.BaseCommand{
+			Ctx: context.Background(),
+			Log: log,
+			UI:  terminal.NewUI(context.Background(), buf),
+		},
+	}
+	command.init()
+
+	return command
+}
@@ -0,0 +1,233 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package stats
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/consul-k8s/cli/common/envoy"
+)
+
+const (
+	// TypeCluster is the type of rows computed from upstream cluster stats.
+	TypeCluster = "cluster"
+	// TypeListener is the type of rows computed from listener stats.
+	TypeListener = "listener"
+	// TypeHTTP is the type of rows computed from the stats of the HTTP
+	// connection managers in listener filter chains.
+	TypeHTTP = "http"
+)
+
+// adminStatName is the name Envoy uses in the stats of its own admin listener.
+// It's excluded because the requests made by this command are counted there.
+const adminStatName = "admin"
+
+// Row is the activity of an upstream cluster or listener over the sampling
+// interval.
+type Row struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+
+	RequestsPerSecond       float64 `json:"requestsPerSecond"`
+	Errors5xxPerSecond      float64 `json:"5xxPerSecond"`
+	ConnectionsPerSecond    float64 `json:"connectionsPerSecond"`
+	ActiveConnections       uint64  `json:"activeConnections"`
+	Retries                 uint64  `json:"retries"`
+	CircuitBreakerOverflows uint64  `json:"circuitBreakerOverflows"`
+}
+
+// statKind describes how a stat contributes to a Row.
+type statKind int
+
+const (
+	requests statKind = iota
+	errors5xx
+	connections
+	activeConnections
+	retries
+	circuitBreakerOverflows
+)
+
+// statSuffixes are the stats that are read for each type, keyed by the suffix
+// after the cluster or listener name. Names can contain dots so they are found
+// by trimming the type prefix and one of these suffixes.
+var statSuffixes = map[string]map[string]statKind{
+	TypeCluster: {
+		"upstream_rq_total":            requests,
+		"upstream_rq_5xx":              errors5xx,
+		"upstream_cx_total":            connections,
+		"upstream_cx_active":           activeConnections,
+		"upstream_rq_retry":            retries,
+		"upstream_cx_overflow":         circuitBreakerOverflows,
+		"upstream_rq_pending_overflow": circuitBreakerOverflows,
+		"upstream_rq_retry_overflow":   circuitBreakerOverflows,
+	},
+	TypeListener: {
+		"downstream_cx_total":  connections,
+		"downstream_cx_active": activeConnections,
+	},
+	TypeHTTP: {
+		"downstream_rq_total":  requests,
+		"downstream_rq_5xx":    errors5xx,
+		"downstream_cx_total":  connections,
+		"downstream_cx_active": activeConnections,
+	},
+}
+
+// originInfixes are the infixes of the cluster stats that Envoy also emits
+// split by where the request originated, such as
+// cluster.<name>.external.upstream_rq_5xx. The requests they count are also
+// counted by the stats without the infix.
+var originInfixes = []string{"external", "internal"}
+
+// stat is a stat that rows are computed from.
+type stat struct {
+	rowType string
+	rowName string
+	kind    statKind
+	// byOrigin is true if the stat is one of the stats split by request
+	// origin.
+	byOrigin bool
+}
+
+// Filter selects the rows to compute. A row is included if its name contains
+// the filter value for its type. If only one of the values is set, rows of the
+// other types are excluded.
+type Filter struct {
+	Cluster  string
+	Listener string
+}
+
+func (f Filter) includes(rowType, name string) bool {
+	if f.Cluster == "" && f.Listener == "" {
+		return true
+	}
+	if rowType == TypeCluster {
+		return f.Cluster != "" && strings.Contains(name, f.Cluster)
+	}
+	return f.Listener != "" && strings.Contains(name, f.Listener)
+}
+
+// Compute returns the rows for the activity between the two snapshots, sorted
+// by type and name. Rates are per second over the time between the snapshots,
+// retries and circuit breaker overflows are counted over that time and active
+// connections are the value in the second snapshot.
+func Compute(first, second *envoy.Stats, filter Filter) []Row {
+	seconds := second.Time.Sub(first.Time).Seconds()
+	rows := make(map[string]*Row)
+
+	for name, value := range second.Values {
+		st, ok := parseStatName(name)
+		// The stats split by request origin are skipped so that requests
+		// aren't counted twice.
+		if !ok || st.byOrigin || st.rowName == adminStatName || !filter.includes(st.rowType, st.rowName) {
+			continue
+		}
+
+		key := st.rowType + "/" + st.rowName
+		row, exists := rows[key]
+		if !exists {
+			row = &Row{Type: st.rowType, Name: st.rowName}
+			rows[key] = row
+		}
+
+		if st.kind == activeConnections {
+			row.ActiveConnections += value
+			continue
+		}
+		delta := counterDelta(first.Values[name], value)
+		switch st.kind {
+		case requests:
+			row.RequestsPerSecond += rate(delta, seconds)
+		case errors5xx:
+			row.Errors5xxPerSecond += rate(delta, seconds)
+		case connections:
+			row.ConnectionsPerSecond += rate(delta, seconds)
+		case retries:
+			row.Retries += delta
+		case circuitBreakerOverflows:
+			row.CircuitBreakerOverflows += delta
+		}
+	}
+
+	result := make([]Row, 0, len(rows))
+	for _, row := range rows {
+		result = append(result, *row)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Type != result[j].Type {
+			return result[i].Type < result[j].Type
+		}
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// PrometheusFilter returns the regular expression passed to the Envoy
+// Prometheus stats endpoint to select the same stats as the filter.
+func PrometheusFilter(filter Filter) string {
+	var exprs []string
+	if filter.Cluster != "" {
+		exprs = append(exprs, `^cluster\..*`+regexp.QuoteMeta(filter.Cluster))
+	}
+	if filter.Listener != "" {
+		exprs = append(exprs, `^(listener|http)\..*`+regexp.QuoteMeta(filter.Listener))
+	}
+	return strings.Join(exprs, "|")
+}
+
+// parseStatName returns the stat if it's one that rows are computed from. The
+// origin infix of cluster stats is stripped from the row name.
+func parseStatName(name string) (stat, bool) {
+	prefix, rest, found := strings.Cut(name, ".")
+	if !found {
+		return stat{}, false
+	}
+	suffixes, ok := statSuffixes[prefix]
+	if !ok {
+		return stat{}, false
+	}
+	for suffix, kind := range suffixes {
+		rowName := strings.TrimSuffix(rest, "."+suffix)
+		if rowName == rest || rowName == "" {
+			continue
+		}
+		st := stat{rowType: prefix, rowName: rowName, kind: kind}
+		if prefix == TypeCluster {
+			for _, infix := range originInfixes {
+				if trimmed := strings.TrimSuffix(rowName, "."+infix); trimmed != rowName && trimmed != "" {
+					st.rowName = trimmed
+					st.byOrigin = true
+					break
+				}
+			}
+		}
+		return st, true
+	}
+	return stat{}, false
+}
+
+// counterDelta returns how much the counter increased. Counters are reset when
+// Envoy restarts, in which case the whole second value is the increase.
+func counterDelta(first, second uint64) uint64 {
+	if second < first {
+		return second
+	}
+	return second - first
+}
+
+func rate(delta uint64, seconds float64) float64 {
+	if seconds <= 0 {
+		return 0
+	}
+	return float64(delta) / seconds
+}
+
+// interval rounds the time between the snapshots for display.
+func interval(first, second *envoy.Stats) time.Duration {
+	return second.Time.Sub(first.Time).Round(100 * time.Millisecond)
+}
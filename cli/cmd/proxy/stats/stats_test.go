@@ -0,0 +1,167 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package stats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/hashicorp/consul-k8s/cli/common/envoy"
+)
+
+const backendCluster = "backend.default.dc1.internal.bc3815c2-1a0f-f3ff-a2e9-20d791f08d00.consul"
+
+func TestCompute(t *testing.T) {
+	start := time.Now()
+	first := &envoy.Stats{
+		Time: start,
+		Values: map[string]uint64{
+			"cluster." + backendCluster + ".upstream_rq_total":            100,
+			"cluster." + backendCluster + ".upstream_rq_5xx":              10,
+			"cluster." + backendCluster + ".upstream_cx_total":            5,
+			"cluster." + backendCluster + ".upstream_cx_active":           3,
+			"cluster." + backendCluster + ".upstream_rq_retry":            2,
+			"cluster." + backendCluster + ".upstream_rq_retry_overflow":   1,
+			"cluster." + backendCluster + ".upstream_rq_pending_overflow": 0,
+			"cluster." + backendCluster + ".external.upstream_rq_5xx":     10,
+			"cluster." + backendCluster + ".internal.upstream_rq_total":   100,
+			"cluster.local_app.upstream_rq_total":                         500,
+			"listener.10.0.0.5_20000.downstream_cx_total":                 40,
+			"listener.10.0.0.5_20000.downstream_cx_active":                4,
+			"listener.admin.downstream_cx_total":                          9,
+			"http.public_listener.downstream_rq_total":                    300,
+			"http.public_listener.downstream_rq_5xx":                      0,
+			"http.admin.downstream_rq_total":                              9,
+			"server.live":                                                 1,
+		},
+	}
+	second := &envoy.Stats{
+		Time: start.Add(2 * time.Second),
+		Values: map[string]uint64{
+			"cluster." + backendCluster + ".upstream_rq_total":            120,
+			"cluster." + backendCluster + ".upstream_rq_5xx":              14,
+			"cluster." + backendCluster + ".upstream_cx_total":            7,
+			"cluster." + backendCluster + ".upstream_cx_active":           2,
+			"cluster." + backendCluster + ".upstream_rq_retry":            5,
+			"cluster." + backendCluster + ".upstream_rq_retry_overflow":   2,
+			"cluster." + backendCluster + ".upstream_rq_pending_overflow": 3,
+			// The stats split by request origin don't add to the totals.
+			"cluster." + backendCluster + ".external.upstream_rq_5xx":   14,
+			"cluster." + backendCluster + ".internal.upstream_rq_total": 120,
+			// Envoy restarted and the counter was reset.
+			"cluster.local_app.upstream_rq_total":          10,
+			"listener.10.0.0.5_20000.downstream_cx_total":  44,
+			"listener.10.0.0.5_20000.downstream_cx_active": 6,
+			"listener.admin.downstream_cx_total":           11,
+			"http.public_listener.downstream_rq_total":     340,
+			"http.public_listener.downstream_rq_5xx":       2,
+			"http.admin.downstream_rq_total":               11,
+			"server.live":                                  1,
+		},
+	}
+
+	backend := Row{
+		Type:                    TypeCluster,
+		Name:                    backendCluster,
+		RequestsPerSecond:       10,
+		Errors5xxPerSecond:      2,
+		ConnectionsPerSecond:    1,
+		ActiveConnections:       2,
+		Retries:                 3,
+		CircuitBreakerOverflows: 4,
+	}
+	localApp := Row{Type: TypeCluster, Name: "local_app", RequestsPerSecond: 5}
+	publicListener := Row{Type: TypeHTTP, Name: "public_listener", RequestsPerSecond: 20, Errors5xxPerSecond: 1}
+	listener := Row{Type: TypeListener, Name: "10.0.0.5_20000", ConnectionsPerSecond: 2, ActiveConnections: 6}
+
+	cases := map[string]struct {
+		filter   Filter
+		expected []Row
+	}{
+		"no filter": {
+			expected: []Row{backend, localApp, publicListener, listener},
+		},
+		"cluster filter": {
+			filter:   Filter{Cluster: "backend"},
+			expected: []Row{backend},
+		},
+		"listener filter": {
+			filter:   Filter{Listener: "public"},
+			expected: []Row{publicListener},
+		},
+		"cluster and listener filters": {
+			filter:   Filter{Cluster: "local_app", Listener: "20000"},
+			expected: []Row{localApp, listener},
+		},
+		"no matches": {
+			filter:   Filter{Cluster: "frontend"},
+			expected: []Row{},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, tc.expected, Compute(first, second, tc.filter))
+		})
+	}
+}
+
+func TestParseStatName(t *testing.T) {
+	cases := map[string]struct {
+		name     string
+		expected stat
+		ok       bool
+	}{
+		"cluster stat": {
+			name:     "cluster." + backendCluster + ".upstream_rq_total",
+			expected: stat{rowType: TypeCluster, rowName: backendCluster, kind: requests},
+			ok:       true,
+		},
+		"cluster stat with external infix": {
+			name:     "cluster." + backendCluster + ".external.upstream_rq_5xx",
+			expected: stat{rowType: TypeCluster, rowName: backendCluster, kind: errors5xx, byOrigin: true},
+			ok:       true,
+		},
+		"cluster stat with internal infix": {
+			name:     "cluster.local_app.internal.upstream_rq_total",
+			expected: stat{rowType: TypeCluster, rowName: "local_app", kind: requests, byOrigin: true},
+			ok:       true,
+		},
+		"listener stat": {
+			name:     "listener.10.0.0.5_20000.downstream_cx_active",
+			expected: stat{rowType: TypeListener, rowName: "10.0.0.5_20000", kind: activeConnections},
+			ok:       true,
+		},
+		"http stat with a name ending in an infix": {
+			name:     "http.internal.downstream_rq_total",
+			expected: stat{rowType: TypeHTTP, rowName: "internal", kind: requests},
+			ok:       true,
+		},
+		"unknown suffix": {
+			name: "cluster." + backendCluster + ".upstream_rq_time",
+		},
+		"unknown prefix": {
+			name: "server.live",
+		},
+		"no row name": {
+			name: "cluster.upstream_rq_total",
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			actual, ok := parseStatName(tc.name)
+			require.Equal(t, tc.ok, ok)
+			require.Equal(t, tc.expected, actual)
+		})
+	}
+}
+
+func TestPrometheusFilter(t *testing.T) {
+	require.Equal(t, "", PrometheusFilter(Filter{}))
+	require.Equal(t, `^cluster\..*backend\.default`, PrometheusFilter(Filter{Cluster: "backend.default"}))
+	require.Equal(t, `^cluster\..*backend|^(listener|http)\..*public_listener`,
+		PrometheusFilter(Filter{Cluster: "backend", Listener: "public_listener"}))
+}
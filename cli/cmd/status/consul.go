@@ -0,0 +1,101 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package status
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/hashicorp/consul-k8s/cli/common"
+)
+
+// consulStatus is the state of the Consul servers.
+type consulStatus struct {
+	Leader   string
+	Raft     raftConfiguration
+	Peerings []peering
+}
+
+// raftConfiguration is the response of /v1/operator/raft/configuration.
+type raftConfiguration struct {
+	Servers []raftServer
+}
+
+type raftServer struct {
+	ID      string
+	Node    string
+	Address string
+	Leader  bool
+	Voter   bool
+}
+
+// peering is an entry in the response of /v1/peerings.
+type peering struct {
+	Name  string
+	State string
+}
+
+// leader returns the server that is the raft leader.
+func (s *consulStatus) leader() *raftServer {
+	if s.Leader == "" {
+		return nil
+	}
+	for i, server := range s.Raft.Servers {
+		if server.Leader {
+			return &s.Raft.Servers[i]
+		}
+	}
+	return nil
+}
+
+// voters returns the number of voting servers.
+func (s *consulStatus) voters() int {
+	var voters int
+	for _, server := range s.Raft.Servers {
+		if server.Voter {
+			voters++
+		}
+	}
+	return voters
+}
+
+// fetchConsulStatus opens a port forward to a Consul server and fetches the
+// raft leader and configuration, and the peerings if peering is enabled.
+func fetchConsulStatus(ctx context.Context, portForward common.PortForwarder, conn common.ConsulConnection, peering bool) (*consulStatus, error) {
+	endpoint, err := portForward.Open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer portForward.Close()
+
+	client, err := conn.HTTPClient()
+	if err != nil {
+		return nil, err
+	}
+	get := func(path string, v interface{}) error {
+		body, err := conn.Get(ctx, client, endpoint, path)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if err := json.Unmarshal(body, v); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		return nil
+	}
+
+	var status consulStatus
+	if err := get("/v1/status/leader", &status.Leader); err != nil {
+		return nil, err
+	}
+	if err := get("/v1/operator/raft/configuration", &status.Raft); err != nil {
+		return nil, err
+	}
+	if peering {
+		if err := get("/v1/peerings", &status.Peerings); err != nil {
+			return nil, err
+		}
+	}
+	return &status, nil
+}
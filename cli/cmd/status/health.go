@@ -0,0 +1,491 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package status
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	apiextv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/hashicorp/consul-k8s/cli/common"
+)
+
+// Health is the health of a component of the installation.
+type Health string
+
+const (
+	Healthy  Health = "healthy"
+	Degraded Health = "degraded"
+)
+
+// componentHealth is the health of one component of the installation.
+type componentHealth struct {
+	Component string `json:"component"`
+	Health    Health `json:"health"`
+	Message   string `json:"message"`
+}
+
+func healthy(component, format string, args ...interface{}) componentHealth {
+	return componentHealth{Component: component, Health: Healthy, Message: fmt.Sprintf(format, args...)}
+}
+
+func degraded(component, format string, args ...interface{}) componentHealth {
+	return componentHealth{Component: component, Health: Degraded, Message: fmt.Sprintf(format, args...)}
+}
+
+// target is the installation whose health is checked.
+type target struct {
+	releaseName string
+	namespace   string
+	// peering is true if cluster peering is enabled in the Helm values.
+	peering bool
+}
+
+// healthCheck checks the health of a set of components. Components that are
+// not part of the installation are not reported.
+type healthCheck struct {
+	component string
+	check     func(context.Context, target) ([]componentHealth, error)
+}
+
+// checkHealth runs each health check. A check that fails is reported as a
+// degraded component.
+func (c *Command) checkHealth(ctx context.Context, t target) []componentHealth {
+	checks := []healthCheck{
+		{"Consul servers", c.checkServers},
+		{"Deployments", c.checkDeployments},
+		{"API gateways", c.checkAPIGateways},
+		{"Webhooks", c.checkWebhooks},
+		{"CNI", c.checkCNI},
+		{"Custom resources", c.checkCustomResources},
+		{"Consul", c.checkConsul},
+	}
+
+	var components []componentHealth
+	for _, hc := range checks {
+		results, err := hc.check(ctx, t)
+		if err != nil {
+			results = append(results, degraded(hc.component, "error checking health: %v", err))
+		}
+		components = append(components, results...)
+	}
+	return components
+}
+
+func (c *Command) checkServers(_ context.Context, t target) ([]componentHealth, error) {
+	return c.checkConsulServers(t.namespace)
+}
+
+// checkConsulServers reports the health of Consul servers if they are
+// expected to be found in the Kubernetes cluster. It does not check for
+// server status if they are not running within the Kubernetes cluster.
+func (c *Command) checkConsulServers(namespace string) ([]componentHealth, error) {
+	servers, err := c.kubernetes.AppsV1().StatefulSets(namespace).List(c.Ctx, metav1.ListOptions{LabelSelector: "app=consul,chart=consul-helm,component=server"})
+	if err != nil {
+		return nil, err
+	}
+	if len(servers.Items) == 0 {
+		return nil, nil
+	}
+
+	desiredServers, readyServers := int(*servers.Items[0].Spec.Replicas), int(servers.Items[0].Status.ReadyReplicas)
+	if readyServers < desiredServers {
+		return []componentHealth{degraded("Consul servers", "%d/%d servers ready", readyServers, desiredServers)}, nil
+	}
+	return []componentHealth{healthy("Consul servers", "%d/%d servers ready", readyServers, desiredServers)}, nil
+}
+
+// checkDeployments reports the health of the control plane Deployments and
+// of the gateways deployed by the Helm chart.
+func (c *Command) checkDeployments(ctx context.Context, t target) ([]componentHealth, error) {
+	deployments, err := c.kubernetes.AppsV1().Deployments(t.namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: "app=consul,release=" + t.releaseName +
+			",component in (connect-injector, sync-catalog, webhook-cert-manager, api-gateway-controller, mesh-gateway, ingress-gateway, terminating-gateway)",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var components []componentHealth
+	for _, deployment := range deployments.Items {
+		components = append(components, deploymentHealth(deployment.Name, deployment))
+	}
+	return components, nil
+}
+
+// checkAPIGateways reports the health of the gateways deployed by the API
+// gateway controller in any namespace.
+func (c *Command) checkAPIGateways(ctx context.Context, _ target) ([]componentHealth, error) {
+	deployments, err := c.kubernetes.AppsV1().Deployments("").List(ctx, metav1.ListOptions{
+		LabelSelector: "api-gateway.consul.hashicorp.com/managed=true",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var components []componentHealth
+	for _, deployment := range deployments.Items {
+		components = append(components, deploymentHealth(fmt.Sprintf("API gateway %s/%s", deployment.Namespace, deployment.Name), deployment))
+	}
+	return components, nil
+}
+
+func deploymentHealth(component string, deployment appsv1.Deployment) componentHealth {
+	desired := int32(1)
+	if deployment.Spec.Replicas != nil {
+		desired = *deployment.Spec.Replicas
+	}
+	ready := deployment.Status.ReadyReplicas
+	if ready < desired {
+		return degraded(component, "%d/%d replicas ready", ready, desired)
+	}
+	return healthy(component, "%d/%d replicas ready", ready, desired)
+}
+
+// checkWebhooks reports the expiry of the connect injector's webhook
+// certificate and whether the caBundle of each of its webhooks is valid and
+// trusts that certificate.
+func (c *Command) checkWebhooks(ctx context.Context, t target) ([]componentHealth, error) {
+	configs, err := c.kubernetes.AdmissionregistrationV1().MutatingWebhookConfigurations().List(ctx, metav1.ListOptions{
+		LabelSelector: "app=consul,component=connect-injector,release=" + t.releaseName,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	now := c.now()
+	var components []componentHealth
+	for _, config := range configs.Items {
+		// The certificate is only found in this secret when it is managed by
+		// the webhook cert manager, rather than e.g. by Vault.
+		var servingCert *x509.Certificate
+		secretName := strings.TrimSuffix(config.Name, "-connect-injector") + "-connect-inject-webhook-cert"
+		secret, err := c.kubernetes.CoreV1().Secrets(t.namespace).Get(ctx, secretName, metav1.GetOptions{})
+		switch {
+		case k8serrors.IsNotFound(err):
+		case err != nil:
+			return components, err
+		default:
+			component := "Webhook certificate " + secretName
+			certs, err := parseCertificates(secret.Data[v1.TLSCertKey])
+			if err != nil {
+				components = append(components, degraded(component, "%v", err))
+				break
+			}
+			servingCert = certs[0]
+			if err := checkValidity(servingCert, now); err != nil {
+				components = append(components, degraded(component, "%v", err))
+				break
+			}
+			components = append(components, healthy(component, "expires %s (in %s)",
+				servingCert.NotAfter.UTC().Format(time.RFC3339), servingCert.NotAfter.Sub(now).Round(time.Minute)))
+		}
+
+		component := "Webhook configuration " + config.Name
+		var problems []string
+		for _, webhook := range config.Webhooks {
+			if err := checkCABundle(webhook.ClientConfig.CABundle, servingCert, now); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %v", webhook.Name, err))
+			}
+		}
+		if len(problems) > 0 {
+			components = append(components, degraded(component, "invalid caBundle for %d/%d webhooks: %s",
+				len(problems), len(config.Webhooks), strings.Join(problems, "; ")))
+			continue
+		}
+		components = append(components, healthy(component, "caBundle valid for %d webhooks", len(config.Webhooks)))
+	}
+	return components, nil
+}
+
+// checkCABundle returns an error if the caBundle doesn't hold valid CA
+// certificates, or doesn't trust the serving certificate if it is known.
+func checkCABundle(caBundle []byte, servingCert *x509.Certificate, now time.Time) error {
+	if len(caBundle) == 0 {
+		return errors.New("caBundle is empty")
+	}
+	certs, err := parseCertificates(caBundle)
+	if err != nil {
+		return err
+	}
+	roots := x509.NewCertPool()
+	for _, cert := range certs {
+		if err := checkValidity(cert, now); err != nil {
+			return fmt.Errorf("CA certificate %q %w", cert.Subject.CommonName, err)
+		}
+		roots.AddCert(cert)
+	}
+	// An expired webhook certificate is reported on its own.
+	if servingCert == nil || checkValidity(servingCert, now) != nil {
+		return nil
+	}
+	_, err = servingCert.Verify(x509.VerifyOptions{Roots: roots, CurrentTime: now})
+	var unknownAuthority x509.UnknownAuthorityError
+	switch {
+	case errors.As(err, &unknownAuthority):
+		return errors.New("caBundle doesn't trust the webhook certificate")
+	case err != nil:
+		return fmt.Errorf("error verifying the webhook certificate: %w", err)
+	}
+	return nil
+}
+
+// parseCertificates parses the PEM-encoded certificates.
+func parseCertificates(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid certificate: %w", err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("no PEM-encoded certificates found")
+	}
+	return certs, nil
+}
+
+// checkValidity returns an error if the certificate is expired or not yet
+// valid.
+func checkValidity(cert *x509.Certificate, now time.Time) error {
+	if now.After(cert.NotAfter) {
+		return fmt.Errorf("expired at %s", cert.NotAfter.UTC().Format(time.RFC3339))
+	}
+	if now.Before(cert.NotBefore) {
+		return fmt.Errorf("not valid until %s", cert.NotBefore.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// checkCNI reports the nodes that the CNI DaemonSet should run on but where
+// its Pod isn't ready.
+func (c *Command) checkCNI(ctx context.Context, t target) ([]componentHealth, error) {
+	daemonSets, err := c.kubernetes.AppsV1().DaemonSets(t.namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: "app=consul,component=cni,release=" + t.releaseName,
+	})
+	if err != nil || len(daemonSets.Items) == 0 {
+		return nil, err
+	}
+
+	nodes, err := c.kubernetes.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	var components []componentHealth
+	for _, ds := range daemonSets.Items {
+		selector, err := metav1.LabelSelectorAsSelector(ds.Spec.Selector)
+		if err != nil {
+			return components, err
+		}
+		pods, err := c.kubernetes.CoreV1().Pods(ds.Namespace).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+		if err != nil {
+			return components, err
+		}
+		ready := make(map[string]bool)
+		for _, pod := range pods.Items {
+			if podReady(pod) {
+				ready[pod.Spec.NodeName] = true
+			}
+		}
+
+		var eligible int
+		var missing []string
+		for _, node := range nodes.Items {
+			if !runsOnNode(ds.Spec.Template.Spec, node) {
+				continue
+			}
+			eligible++
+			if !ready[node.Name] {
+				missing = append(missing, node.Name)
+			}
+		}
+		component := "CNI " + ds.Name
+		if len(missing) > 0 {
+			sort.Strings(missing)
+			components = append(components, degraded(component, "ready on %d/%d nodes, not ready on %s",
+				eligible-len(missing), eligible, strings.Join(missing, ", ")))
+			continue
+		}
+		components = append(components, healthy(component, "ready on %d/%d nodes", eligible, eligible))
+	}
+	return components, nil
+}
+
+// runsOnNode returns true if a DaemonSet Pod with the spec should run on the
+// node, i.e. the node matches its node selector and it tolerates the taints of
+// the node. Taints added by Kubernetes for node conditions are tolerated by
+// DaemonSet Pods automatically.
+func runsOnNode(spec v1.PodSpec, node v1.Node) bool {
+	for key, value := range spec.NodeSelector {
+		if node.Labels[key] != value {
+			return false
+		}
+	}
+	for i := range node.Spec.Taints {
+		taint := &node.Spec.Taints[i]
+		if taint.Effect == v1.TaintEffectPreferNoSchedule || strings.HasPrefix(taint.Key, "node.kubernetes.io/") {
+			continue
+		}
+		tolerated := false
+		for _, toleration := range spec.Tolerations {
+			if toleration.ToleratesTaint(taint) {
+				tolerated = true
+				break
+			}
+		}
+		if !tolerated {
+			return false
+		}
+	}
+	return true
+}
+
+func podReady(pod v1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == v1.PodReady {
+			return condition.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// checkCustomResources reports the number of Consul custom resources whose
+// Synced condition isn't True.
+func (c *Command) checkCustomResources(ctx context.Context, _ target) ([]componentHealth, error) {
+	crds, err := c.apiext.ApiextensionsV1().CustomResourceDefinitions().List(ctx, metav1.ListOptions{
+		LabelSelector: "app=consul",
+	})
+	if err != nil || len(crds.Items) == 0 {
+		return nil, err
+	}
+
+	var total, unsynced int
+	var kinds []string
+	for _, crd := range crds.Items {
+		gvr := schema.GroupVersionResource{
+			Group:    crd.Spec.Group,
+			Version:  storageVersion(crd),
+			Resource: crd.Spec.Names.Plural,
+		}
+		list, err := c.dynamic.Resource(gvr).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("error listing %s: %w", crd.Spec.Names.Plural, err)
+		}
+
+		var count int
+		for _, item := range list.Items {
+			if !synced(item) {
+				count++
+			}
+		}
+		total += len(list.Items)
+		unsynced += count
+		if count > 0 {
+			kinds = append(kinds, fmt.Sprintf("%s (%d)", crd.Spec.Names.Plural, count))
+		}
+	}
+
+	if unsynced > 0 {
+		sort.Strings(kinds)
+		return []componentHealth{degraded("Custom resources", "%d/%d resources not synced: %s", unsynced, total, strings.Join(kinds, ", "))}, nil
+	}
+	return []componentHealth{healthy("Custom resources", "%d/%d resources synced", total, total)}, nil
+}
+
+// storageVersion returns the version custom resources are stored as.
+func storageVersion(crd apiextv1.CustomResourceDefinition) string {
+	for _, version := range crd.Spec.Versions {
+		if version.Storage {
+			return version.Name
+		}
+	}
+	return crd.Spec.Versions[0].Name
+}
+
+// synced returns true if the custom resource has the condition Synced=True.
+func synced(resource unstructured.Unstructured) bool {
+	conditions, _, _ := unstructured.NestedSlice(resource.Object, "status", "conditions")
+	for _, c := range conditions {
+		condition, ok := c.(map[string]interface{})
+		if ok && condition["type"] == "Synced" {
+			return condition["status"] == string(metav1.ConditionTrue)
+		}
+	}
+	return false
+}
+
+// checkConsul reports the raft leader and the state of each peering through a
+// port forward to a Consul server. It is skipped if the servers don't run in
+// the Kubernetes cluster.
+func (c *Command) checkConsul(ctx context.Context, t target) ([]componentHealth, error) {
+	servers, err := c.kubernetes.AppsV1().StatefulSets(t.namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: "app=consul,component=server,release=" + t.releaseName,
+	})
+	if err != nil || len(servers.Items) == 0 {
+		return nil, err
+	}
+
+	server, err := common.FindConsulServer(ctx, c.kubernetes, t.namespace, t.releaseName)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := common.NewConsulConnection(ctx, c.kubernetes, *server)
+	if err != nil {
+		return nil, err
+	}
+	pf := &common.PortForward{
+		Namespace:  server.Namespace,
+		PodName:    server.Name,
+		RemotePort: conn.Port,
+		KubeClient: c.kubernetes,
+		RestConfig: c.restConfig,
+	}
+	status, err := c.fetchConsulStatus(ctx, pf, conn, t.peering)
+	if err != nil {
+		return nil, err
+	}
+
+	var components []componentHealth
+	leader := status.leader()
+	voters := status.voters()
+	if leader == nil {
+		components = append(components, degraded("Consul leader", "no raft leader, %d voters", voters))
+	} else {
+		components = append(components, healthy("Consul leader", "%s (%s), %d voters", leader.Node, leader.Address, voters))
+	}
+
+	for _, peering := range status.Peerings {
+		component := "Peering " + peering.Name
+		switch peering.State {
+		case "FAILING", "TERMINATED", "UNDEFINED", "":
+			components = append(components, degraded(component, "state is %s", peering.State))
+		default:
+			components = append(components, healthy(component, "state is %s", peering.State))
+		}
+	}
+	return components, nil
+}
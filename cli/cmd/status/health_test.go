@@ -0,0 +1,429 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package status
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	helmRelease "helm.sh/helm/v3/pkg/release"
+	admissionv1 "k8s.io/api/admissionregistration/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	apiextv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apiextFake "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/fake"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicFake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/utils/pointer"
+
+	"github.com/hashicorp/consul-k8s/cli/common"
+	"github.com/hashicorp/consul-k8s/cli/helm"
+)
+
+var testTarget = target{releaseName: "consul", namespace: "consul"}
+
+func TestCheckDeployments(t *testing.T) {
+	c := getInitializedCommand(t, nil)
+	c.kubernetes = fake.NewSimpleClientset(
+		deployment("consul-connect-injector", "connect-injector", 2, 2),
+		deployment("consul-sync-catalog", "sync-catalog", 1, 0),
+		deployment("consul-mesh-gateway", "mesh-gateway", 2, 1),
+		deployment("consul-other", "other", 1, 0),
+	)
+
+	components, err := c.checkDeployments(context.Background(), testTarget)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []componentHealth{
+		healthy("consul-connect-injector", "2/2 replicas ready"),
+		degraded("consul-sync-catalog", "0/1 replicas ready"),
+		degraded("consul-mesh-gateway", "1/2 replicas ready"),
+	}, components)
+}
+
+func TestCheckWebhooks(t *testing.T) {
+	ca, caKey := generateCert(t, nil, nil, testNow.Add(-time.Hour), testNow.Add(24*time.Hour))
+	otherCA, _ := generateCert(t, nil, nil, testNow.Add(-time.Hour), testNow.Add(24*time.Hour))
+	expiredCA, _ := generateCert(t, nil, nil, testNow.Add(-2*time.Hour), testNow.Add(-time.Hour))
+	cert, _ := generateCert(t, ca, caKey, testNow.Add(-time.Hour), testNow.Add(12*time.Hour))
+	expiredCert, _ := generateCert(t, ca, caKey, testNow.Add(-2*time.Hour), testNow.Add(-time.Hour))
+
+	cases := map[string]struct {
+		cert     []byte
+		caBundle []byte
+		expected []componentHealth
+	}{
+		"valid": {
+			cert:     cert,
+			caBundle: ca,
+			expected: []componentHealth{
+				healthy("Webhook certificate consul-connect-inject-webhook-cert", "expires 2023-04-02T00:00:00Z (in 12h0m0s)"),
+				healthy("Webhook configuration consul-connect-injector", "caBundle valid for 1 webhooks"),
+			},
+		},
+		"certificate managed outside of the cluster": {
+			caBundle: ca,
+			expected: []componentHealth{
+				healthy("Webhook configuration consul-connect-injector", "caBundle valid for 1 webhooks"),
+			},
+		},
+		"expired certificate": {
+			cert:     expiredCert,
+			caBundle: ca,
+			expected: []componentHealth{
+				degraded("Webhook certificate consul-connect-inject-webhook-cert", "expired at 2023-04-01T11:00:00Z"),
+				healthy("Webhook configuration consul-connect-injector", "caBundle valid for 1 webhooks"),
+			},
+		},
+		"empty caBundle": {
+			cert: cert,
+			expected: []componentHealth{
+				healthy("Webhook certificate consul-connect-inject-webhook-cert", "expires 2023-04-02T00:00:00Z (in 12h0m0s)"),
+				degraded("Webhook configuration consul-connect-injector", "invalid caBundle for 1/1 webhooks: mutate-pods: caBundle is empty"),
+			},
+		},
+		"expired caBundle": {
+			caBundle: expiredCA,
+			expected: []componentHealth{
+				degraded("Webhook configuration consul-connect-injector", `invalid caBundle for 1/1 webhooks: mutate-pods: CA certificate "test" expired at 2023-04-01T11:00:00Z`),
+			},
+		},
+		"caBundle of another CA": {
+			cert:     cert,
+			caBundle: otherCA,
+			expected: []componentHealth{
+				healthy("Webhook certificate consul-connect-inject-webhook-cert", "expires 2023-04-02T00:00:00Z (in 12h0m0s)"),
+				degraded("Webhook configuration consul-connect-injector", "invalid caBundle for 1/1 webhooks: mutate-pods: caBundle doesn't trust the webhook certificate"),
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			c := getInitializedCommand(t, nil)
+			c.kubernetes = fake.NewSimpleClientset(&admissionv1.MutatingWebhookConfiguration{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:   "consul-connect-injector",
+					Labels: map[string]string{"app": "consul", "component": "connect-injector", "release": "consul"},
+				},
+				Webhooks: []admissionv1.MutatingWebhook{{
+					Name:         "mutate-pods",
+					ClientConfig: admissionv1.WebhookClientConfig{CABundle: tc.caBundle},
+				}},
+			})
+			if tc.cert != nil {
+				_, err := c.kubernetes.CoreV1().Secrets("consul").Create(context.Background(), &v1.Secret{
+					ObjectMeta: metav1.ObjectMeta{Name: "consul-connect-inject-webhook-cert", Namespace: "consul"},
+					Data:       map[string][]byte{v1.TLSCertKey: tc.cert},
+				}, metav1.CreateOptions{})
+				require.NoError(t, err)
+			}
+
+			components, err := c.checkWebhooks(context.Background(), testTarget)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, components)
+		})
+	}
+}
+
+func TestCheckCNI(t *testing.T) {
+	c := getInitializedCommand(t, nil)
+	c.kubernetes = fake.NewSimpleClientset(
+		&appsv1.DaemonSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "consul-cni",
+				Namespace: "consul",
+				Labels:    map[string]string{"app": "consul", "component": "cni", "release": "consul"},
+			},
+			Spec: appsv1.DaemonSetSpec{
+				Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"component": "cni"}},
+				Template: v1.PodTemplateSpec{
+					Spec: v1.PodSpec{
+						NodeSelector: map[string]string{"kubernetes.io/os": "linux"},
+						Tolerations:  []v1.Toleration{{Key: "dedicated", Operator: v1.TolerationOpExists}},
+					},
+				},
+			},
+		},
+		node("node-1", "linux"),
+		node("node-2", "linux", v1.Taint{Key: "dedicated", Value: "mesh", Effect: v1.TaintEffectNoSchedule}),
+		node("node-3", "linux", v1.Taint{Key: "node.kubernetes.io/not-ready", Effect: v1.TaintEffectNoExecute}),
+		node("node-4", "linux", v1.Taint{Key: "gpu", Effect: v1.TaintEffectNoSchedule}),
+		node("node-5", "windows"),
+		cniPod("consul-cni-1", "node-1", true),
+		cniPod("consul-cni-2", "node-2", false),
+	)
+
+	components, err := c.checkCNI(context.Background(), testTarget)
+	require.NoError(t, err)
+	require.Equal(t, []componentHealth{
+		degraded("CNI consul-cni", "ready on 1/3 nodes, not ready on node-2, node-3"),
+	}, components)
+}
+
+func TestCheckCustomResources(t *testing.T) {
+	gvr := schema.GroupVersionResource{Group: "consul.hashicorp.com", Version: "v1alpha1", Resource: "servicedefaults"}
+	c := getInitializedCommand(t, nil)
+	c.apiext = apiextFake.NewSimpleClientset(&apiextv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "servicedefaults.consul.hashicorp.com",
+			Labels: map[string]string{"app": "consul"},
+		},
+		Spec: apiextv1.CustomResourceDefinitionSpec{
+			Group:    gvr.Group,
+			Names:    apiextv1.CustomResourceDefinitionNames{Plural: gvr.Resource, Kind: "ServiceDefaults"},
+			Scope:    apiextv1.NamespaceScoped,
+			Versions: []apiextv1.CustomResourceDefinitionVersion{{Name: gvr.Version, Storage: true}},
+		},
+	})
+	dynamicClient := dynamicFake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{gvr: "ServiceDefaultsList"})
+	for name, status := range map[string]string{"web": "True", "api": "False", "db": ""} {
+		resource := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "consul.hashicorp.com/v1alpha1",
+			"kind":       "ServiceDefaults",
+			"metadata":   map[string]interface{}{"name": name, "namespace": "default"},
+		}}
+		if status != "" {
+			resource.Object["status"] = map[string]interface{}{
+				"conditions": []interface{}{map[string]interface{}{"type": "Synced", "status": status}},
+			}
+		}
+		_, err := dynamicClient.Resource(gvr).Namespace("default").Create(context.Background(), resource, metav1.CreateOptions{})
+		require.NoError(t, err)
+	}
+	c.dynamic = dynamicClient
+
+	components, err := c.checkCustomResources(context.Background(), testTarget)
+	require.NoError(t, err)
+	require.Equal(t, []componentHealth{
+		degraded("Custom resources", "2/3 resources not synced: servicedefaults (2)"),
+	}, components)
+}
+
+func TestCheckConsul(t *testing.T) {
+	cases := map[string]struct {
+		status   *consulStatus
+		err      error
+		peering  bool
+		expected []componentHealth
+	}{
+		"leader elected": {
+			status: &consulStatus{
+				Leader: "10.0.0.1:8300",
+				Raft: raftConfiguration{Servers: []raftServer{
+					{Node: "consul-server-0", Address: "10.0.0.1:8300", Leader: true, Voter: true},
+					{Node: "consul-server-1", Address: "10.0.0.2:8300", Voter: true},
+					{Node: "consul-server-2", Address: "10.0.0.3:8300", Voter: true},
+				}},
+			},
+			expected: []componentHealth{
+				healthy("Consul leader", "consul-server-0 (10.0.0.1:8300), 3 voters"),
+			},
+		},
+		"no leader": {
+			status: &consulStatus{
+				Raft: raftConfiguration{Servers: []raftServer{
+					{Node: "consul-server-0", Address: "10.0.0.1:8300", Voter: true},
+				}},
+			},
+			expected: []componentHealth{
+				degraded("Consul leader", "no raft leader, 1 voters"),
+			},
+		},
+		"peerings": {
+			peering: true,
+			status: &consulStatus{
+				Leader: "10.0.0.1:8300",
+				Raft: raftConfiguration{Servers: []raftServer{
+					{Node: "consul-server-0", Address: "10.0.0.1:8300", Leader: true, Voter: true},
+				}},
+				Peerings: []peering{{Name: "dc2", State: "ACTIVE"}, {Name: "dc3", State: "FAILING"}},
+			},
+			expected: []componentHealth{
+				healthy("Consul leader", "consul-server-0 (10.0.0.1:8300), 1 voters"),
+				healthy("Peering dc2", "state is ACTIVE"),
+				degraded("Peering dc3", "state is FAILING"),
+			},
+		},
+		"port forward error": {
+			err: errors.New("connection refused"),
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			c := getInitializedCommand(t, nil)
+			c.kubernetes = fake.NewSimpleClientset(serverPod())
+			require.NoError(t, createServers("consul-server", "consul", 1, 1, c.kubernetes))
+			c.fetchConsulStatus = func(_ context.Context, pf common.PortForwarder, conn common.ConsulConnection, peering bool) (*consulStatus, error) {
+				require.Equal(t, "consul-server-0", pf.(*common.PortForward).PodName)
+				require.Equal(t, common.ConsulConnection{Port: 8500, Scheme: "http"}, conn)
+				require.Equal(t, tc.peering, peering)
+				return tc.status, tc.err
+			}
+
+			components, err := c.checkConsul(context.Background(), target{releaseName: "consul", namespace: "consul", peering: tc.peering})
+			if tc.err != nil {
+				require.Equal(t, tc.err, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, components)
+		})
+	}
+}
+
+func TestCheckConsul_ExternalServers(t *testing.T) {
+	c := getInitializedCommand(t, nil)
+	c.kubernetes = fake.NewSimpleClientset()
+	c.fetchConsulStatus = func(context.Context, common.PortForwarder, common.ConsulConnection, bool) (*consulStatus, error) {
+		require.Fail(t, "servers outside of the cluster should not be checked")
+		return nil, nil
+	}
+
+	components, err := c.checkConsul(context.Background(), testTarget)
+	require.NoError(t, err)
+	require.Empty(t, components)
+}
+
+func TestStatus_JSON(t *testing.T) {
+	buf := new(bytes.Buffer)
+	c := getInitializedCommand(t, buf)
+	c.kubernetes = fake.NewSimpleClientset(
+		deployment("consul-connect-injector", "connect-injector", 1, 0),
+	)
+	c.helmActionsRunner = &helm.MockActionRunner{
+		CheckForInstallationsFunc: func(options *helm.CheckForInstallationsOptions) (bool, string, string, error) {
+			return true, "consul", "consul", nil
+		},
+		GetStatusFunc: func(status *action.Status, name string) (*helmRelease.Release, error) {
+			return &helmRelease.Release{
+				Name: "consul", Namespace: "consul", Version: 2,
+				Info:   &helmRelease.Info{Status: helmRelease.StatusDeployed},
+				Chart:  &chart.Chart{Metadata: &chart.Metadata{Version: "1.2.0", AppVersion: "1.16.0"}},
+				Config: map[string]interface{}{"global": map[string]interface{}{"name": "consul"}},
+			}, nil
+		},
+	}
+
+	require.Equal(t, 1, c.Run([]string{"-o", "json"}))
+
+	var r report
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &r), buf.String())
+	require.False(t, r.Healthy)
+	require.Equal(t, "consul", r.Release.Name)
+	require.Equal(t, "deployed", r.Release.Status)
+	require.Equal(t, "1.2.0", r.Release.ChartVersion)
+	require.Equal(t, 2, r.Release.Revision)
+	require.Equal(t, []componentHealth{
+		healthy("Helm release", "release is deployed"),
+		degraded("consul-connect-injector", "0/1 replicas ready"),
+	}, r.Components)
+}
+
+func TestStatus_InvalidOutput(t *testing.T) {
+	buf := new(bytes.Buffer)
+	c := getInitializedCommand(t, buf)
+	require.Equal(t, 1, c.Run([]string{"-output", "xml"}))
+	require.Contains(t, buf.String(), "-output must be one of table, json, yaml, or template=<template>")
+}
+
+func TestReleaseHealth(t *testing.T) {
+	require.Equal(t, Healthy, releaseHealth(&releaseStatus{Status: "deployed"}).Health)
+	require.Equal(t, Degraded, releaseHealth(&releaseStatus{Status: "failed"}).Health)
+	require.Equal(t, Degraded, releaseHealth(&releaseStatus{Status: "pending-upgrade"}).Health)
+}
+
+func deployment(name, component string, replicas, ready int32) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "consul",
+			Labels:    map[string]string{"app": "consul", "component": component, "release": "consul"},
+		},
+		Spec:   appsv1.DeploymentSpec{Replicas: pointer.Int32(replicas)},
+		Status: appsv1.DeploymentStatus{ReadyReplicas: ready},
+	}
+}
+
+func node(name, os string, taints ...v1.Taint) *v1.Node {
+	return &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{"kubernetes.io/os": os}},
+		Spec:       v1.NodeSpec{Taints: taints},
+	}
+}
+
+func cniPod(name, nodeName string, ready bool) *v1.Pod {
+	status := v1.ConditionFalse
+	if ready {
+		status = v1.ConditionTrue
+	}
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "consul", Labels: map[string]string{"component": "cni"}},
+		Spec:       v1.PodSpec{NodeName: nodeName},
+		Status:     v1.PodStatus{Conditions: []v1.PodCondition{{Type: v1.PodReady, Status: status}}},
+	}
+}
+
+func serverPod() *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "consul-server-0",
+			Namespace:       "consul",
+			Labels:          map[string]string{"app": "consul", "component": "server", "release": "consul"},
+			OwnerReferences: []metav1.OwnerReference{{Kind: "StatefulSet", Name: "consul-server"}},
+		},
+		Spec: v1.PodSpec{
+			Containers: []v1.Container{{Name: "consul", Ports: []v1.ContainerPort{{Name: "http", ContainerPort: 8500}}}},
+		},
+		Status: v1.PodStatus{Phase: v1.PodRunning},
+	}
+}
+
+// generateCert returns a PEM-encoded certificate signed by the parent, or a
+// self-signed CA certificate if there is no parent.
+func generateCert(t *testing.T, parentPEM []byte, parentKey *ecdsa.PrivateKey, notBefore, notAfter time.Time) ([]byte, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	parent, signer := template, key
+	if parentPEM != nil {
+		certs, err := parseCertificates(parentPEM)
+		require.NoError(t, err)
+		parent, signer = certs[0], parentKey
+	} else {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, signer)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), key
+}
@@ -4,14 +4,18 @@
 package status
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"strconv"
 	"sync"
+	"time"
 
 	"github.com/posener/complete"
 	"helm.sh/helm/v3/pkg/release"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apiext "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
 
 	"github.com/hashicorp/consul-k8s/cli/common"
 	"github.com/hashicorp/consul-k8s/cli/common/flag"
@@ -24,6 +28,7 @@ import (
 )
 
 const (
+	flagNameOutput      = "output"
 	flagNameKubeConfig  = "kubeconfig"
 	flagNameKubeContext = "context"
 )
@@ -34,20 +39,73 @@ type Command struct {
 	helmActionsRunner helm.HelmActionsRunner
 
 	kubernetes kubernetes.Interface
+	apiext     apiext.Interface
+	dynamic    dynamic.Interface
+	restConfig *rest.Config
 
 	set *flag.Sets
 
+	flagOutput string
+
 	flagKubeConfig  string
 	flagKubeContext string
 
+	fetchConsulStatus func(context.Context, common.PortForwarder, common.ConsulConnection, bool) (*consulStatus, error)
+
+	// now returns the current time. It is set in tests.
+	now func() time.Time
+
 	once sync.Once
 	help string
 }
 
+// report is the status of the installation in structured output.
+type report struct {
+	Release    releaseStatus     `json:"release"`
+	Healthy    bool              `json:"healthy"`
+	Components []componentHealth `json:"components"`
+}
+
+// releaseStatus is the status of the Helm release.
+type releaseStatus struct {
+	Name         string                 `json:"name"`
+	Namespace    string                 `json:"namespace"`
+	Status       string                 `json:"status"`
+	ChartVersion string                 `json:"chartVersion"`
+	AppVersion   string                 `json:"appVersion"`
+	Revision     int                    `json:"revision"`
+	LastUpdated  time.Time              `json:"lastUpdated"`
+	Config       map[string]interface{} `json:"config"`
+	Hooks        []hookStatus           `json:"hooks,omitempty"`
+}
+
+// hookStatus is the status of a pre-install or pre-upgrade Helm hook.
+type hookStatus struct {
+	Name  string `json:"name"`
+	Kind  string `json:"kind"`
+	Phase string `json:"phase"`
+}
+
 func (c *Command) init() {
+	if c.fetchConsulStatus == nil {
+		c.fetchConsulStatus = fetchConsulStatus
+	}
+	if c.now == nil {
+		c.now = time.Now
+	}
+
 	c.set = flag.NewSets()
 
-	f := c.set.NewSet("Global Options")
+	f := c.set.NewSet("Command Options")
+	f.StringVar(&flag.StringVar{
+		Name:    flagNameOutput,
+		Target:  &c.flagOutput,
+		Default: terminal.FormatTable,
+		Usage:   terminal.OutputUsage("the status"),
+		Aliases: []string{"o"},
+	})
+
+	f = c.set.NewSet("Global Options")
 	f.StringVar(&flag.StringVar{
 		Name:    "kubeconfig",
 		Aliases: []string{"c"},
@@ -65,7 +123,8 @@ func (c *Command) init() {
 	c.help = c.set.Help()
 }
 
-// Run checks the status of a Consul installation on Kubernetes.
+// Run checks the status of a Consul installation on Kubernetes. It returns 1 if
+// any component of the installation is degraded.
 func (c *Command) Run(args []string) int {
 	c.once.Do(c.init)
 	if c.helmActionsRunner == nil {
@@ -95,17 +154,23 @@ func (c *Command) Run(args []string) int {
 	}
 
 	if err := c.setupKubeClient(settings); err != nil {
-		c.UI.Output(err.Error(), terminal.WithErrorStyle())
+		terminal.OutputError(c.UI, c.flagOutput, err.Error())
 		return 1
 	}
 
-	// Setup logger to stream Helm library logs.
+	// Setup logger to stream Helm library logs. Structured output is kept parseable
+	// by sending them to the debug log instead.
 	var uiLogger = func(s string, args ...interface{}) {
 		logMsg := fmt.Sprintf(s, args...)
 		c.UI.Output(logMsg, terminal.WithLibraryStyle())
 	}
-
-	c.UI.Output("Consul Status Summary", terminal.WithHeaderStyle())
+	if terminal.Structured(c.flagOutput) {
+		uiLogger = func(s string, args ...interface{}) {
+			c.Log.Debug(fmt.Sprintf(s, args...))
+		}
+	} else {
+		c.UI.Output("Consul Status Summary", terminal.WithHeaderStyle())
+	}
 
 	_, releaseName, namespace, err := c.helmActionsRunner.CheckForInstallations(&helm.CheckForInstallationsOptions{
 		Settings:    settings,
@@ -113,20 +178,39 @@ func (c *Command) Run(args []string) int {
 		DebugLog:    uiLogger,
 	})
 	if err != nil {
-		c.UI.Output(err.Error(), terminal.WithErrorStyle())
+		terminal.OutputError(c.UI, c.flagOutput, err.Error())
 		return 1
 	}
 
-	if err := c.checkHelmInstallation(settings, uiLogger, releaseName, namespace); err != nil {
-		c.UI.Output(err.Error(), terminal.WithErrorStyle())
+	rel, err := c.checkHelmInstallation(settings, uiLogger, releaseName, namespace)
+	if err != nil {
+		terminal.OutputError(c.UI, c.flagOutput, err.Error())
 		return 1
 	}
+	if !terminal.Structured(c.flagOutput) {
+		c.outputRelease(rel)
+	}
 
-	if err := c.checkConsulServers(namespace); err != nil {
-		c.UI.Output("Unable to check Kubernetes cluster for Consul servers: %v", err)
-		return 1
+	components := []componentHealth{releaseHealth(rel)}
+	components = append(components, c.checkHealth(c.Ctx, target{
+		releaseName: releaseName,
+		namespace:   namespace,
+		peering:     peeringEnabled(rel.Config),
+	})...)
+	r := report{Release: *rel, Healthy: true, Components: components}
+	for _, component := range components {
+		if component.Health != Healthy {
+			r.Healthy = false
+		}
 	}
 
+	if err := c.outputReport(r); err != nil {
+		terminal.OutputError(c.UI, c.flagOutput, err.Error())
+		return 1
+	}
+	if !r.Healthy {
+		return 1
+	}
 	return 0
 }
 
@@ -135,7 +219,7 @@ func (c *Command) validateFlags() error {
 	if len(c.set.Args()) > 0 {
 		return errors.New("should have no non-flag arguments")
 	}
-	return nil
+	return terminal.ValidateFormat(c.flagOutput)
 }
 
 // AutocompleteFlags returns a mapping of supported flags and autocomplete
@@ -143,6 +227,7 @@ func (c *Command) validateFlags() error {
 // complete flag such as "-foo" or "--foo".
 func (c *Command) AutocompleteFlags() complete.Flags {
 	return complete.Flags{
+		fmt.Sprintf("-%s", flagNameOutput):      complete.PredictSet(terminal.Formats...),
 		fmt.Sprintf("-%s", flagNameKubeConfig):  complete.PredictFiles("*"),
 		fmt.Sprintf("-%s", flagNameKubeContext): complete.PredictNothing,
 	}
@@ -155,54 +240,114 @@ func (c *Command) AutocompleteArgs() complete.Predictor {
 	return complete.PredictNothing
 }
 
-// checkHelmInstallation uses the helm Go SDK to depict the status of a named release. This function then prints
-// the version of the release, it's status (unknown, deployed, uninstalled, ...), and the overwritten values.
-func (c *Command) checkHelmInstallation(settings *helmCLI.EnvSettings, uiLogger action.DebugLog, releaseName, namespace string) error {
+// checkHelmInstallation uses the helm Go SDK to depict the status of a named release: its version, status
+// (unknown, deployed, uninstalled, ...), the overwritten values and the status of its hooks.
+func (c *Command) checkHelmInstallation(settings *helmCLI.EnvSettings, uiLogger action.DebugLog, releaseName, namespace string) (*releaseStatus, error) {
 	// Need a specific action config to call helm status, where namespace comes from the previous call to list.
 	statusConfig := new(action.Configuration)
 	statusConfig, err := helm.InitActionConfig(statusConfig, namespace, settings, uiLogger)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	statuser := action.NewStatus(statusConfig)
 	rel, err := c.helmActionsRunner.GetStatus(statuser, releaseName)
 	if err != nil {
-		return fmt.Errorf("couldn't check for installations: %s", err)
+		return nil, fmt.Errorf("couldn't check for installations: %s", err)
+	}
+
+	status := &releaseStatus{
+		Name:         releaseName,
+		Namespace:    namespace,
+		Status:       string(rel.Info.Status),
+		ChartVersion: rel.Chart.Metadata.Version,
+		AppVersion:   rel.Chart.Metadata.AppVersion,
+		Revision:     rel.Version,
+		LastUpdated:  rel.Info.LastDeployed.Time,
+		Config:       rel.Config,
+	}
+	for _, hook := range rel.Hooks {
+		// Remember that we only report the status of pre-install or pre-upgrade hooks.
+		if validEvent(hook.Events) {
+			status.Hooks = append(status.Hooks, hookStatus{Name: hook.Name, Kind: hook.Kind, Phase: hook.LastRun.Phase.String()})
+		}
 	}
+	return status, nil
+}
 
-	timezone, _ := rel.Info.LastDeployed.Zone()
+// outputRelease prints the version of the release, its status and the overwritten values.
+func (c *Command) outputRelease(rel *releaseStatus) {
+	timezone, _ := rel.LastUpdated.Zone()
 
 	tbl := terminal.NewTable("Name", "Namespace", "Status", "Chart Version", "AppVersion", "Revision", "Last Updated")
-	tbl.AddRow([]string{releaseName, namespace, string(rel.Info.Status), rel.Chart.Metadata.Version,
-		rel.Chart.Metadata.AppVersion, strconv.Itoa(rel.Version),
-		rel.Info.LastDeployed.Format("2006/01/02 15:04:05") + " " + timezone}, []string{})
+	tbl.AddRow([]string{rel.Name, rel.Namespace, rel.Status, rel.ChartVersion,
+		rel.AppVersion, strconv.Itoa(rel.Revision),
+		rel.LastUpdated.Format("2006/01/02 15:04:05") + " " + timezone}, []string{})
 	c.UI.Table(tbl)
 
 	valuesYaml, err := yaml.Marshal(rel.Config)
 	c.UI.Output("Config:", terminal.WithHeaderStyle())
 	if err != nil {
 		c.UI.Output("%+v", err, terminal.WithInfoStyle())
-	} else if len(rel.Config) == 0 {
-		c.UI.Output(string(valuesYaml), terminal.WithInfoStyle())
 	} else {
 		c.UI.Output(string(valuesYaml), terminal.WithInfoStyle())
 	}
 
-	// Check the status of the hooks.
-	if len(rel.Hooks) > 1 {
+	// Output the status of the hooks.
+	if len(rel.Hooks) > 0 {
 		c.UI.Output("Status Of Helm Hooks:", terminal.WithHeaderStyle())
 
 		for _, hook := range rel.Hooks {
-			// Remember that we only report the status of pre-install or pre-upgrade hooks.
-			if validEvent(hook.Events) {
-				c.UI.Output("%s %s: %s", hook.Name, hook.Kind, hook.LastRun.Phase.String())
-			}
+			c.UI.Output("%s %s: %s", hook.Name, hook.Kind, hook.Phase)
 		}
 		fmt.Println("")
 	}
+}
 
-	return nil
+// outputReport prints the health of each component, or the whole report in
+// a structured format.
+func (c *Command) outputReport(r report) error {
+	return terminal.Render(c.UI, c.flagOutput, r, func() { c.outputComponents(r) })
+}
+
+// outputComponents prints a table of the health of each component.
+func (c *Command) outputComponents(r report) {
+	c.UI.Output("Component Health:", terminal.WithHeaderStyle())
+	tbl := terminal.NewTable("Component", "Health", "Message")
+	var unhealthy int
+	for _, component := range r.Components {
+		color := terminal.Green
+		if component.Health != Healthy {
+			color = terminal.Red
+			unhealthy++
+		}
+		tbl.AddRow([]string{component.Component, string(component.Health), component.Message}, []string{"", color})
+	}
+	c.UI.Table(tbl)
+
+	if unhealthy > 0 {
+		c.UI.Output("%d/%d components are degraded", unhealthy, len(r.Components), terminal.WithErrorStyle())
+	} else {
+		c.UI.Output("All components are healthy", terminal.WithSuccessStyle())
+	}
+}
+
+// releaseHealth reports the Helm release as degraded if its last operation
+// failed or is still pending.
+func releaseHealth(rel *releaseStatus) componentHealth {
+	status := release.Status(rel.Status)
+	if status == release.StatusFailed || status.IsPending() {
+		return degraded("Helm release", "release is %s", status)
+	}
+	return healthy("Helm release", "release is %s", status)
+}
+
+// peeringEnabled returns true if cluster peering is enabled in the Helm values.
+func peeringEnabled(values map[string]interface{}) bool {
+	global, _ := values["global"].(map[string]interface{})
+	peering, _ := global["peering"].(map[string]interface{})
+	enabled, _ := peering["enabled"].(bool)
+	return enabled
 }
 
 // validEvent is a helper function that checks if the given hook's events are pre-install or pre-upgrade.
@@ -217,39 +362,35 @@ func validEvent(events []release.HookEvent) bool {
 	return false
 }
 
-// checkConsulServers prints the status of Consul servers if they
-// are expected to be found in the Kubernetes cluster. It does not check for
-// server status if they are not running within the Kubernetes cluster.
-func (c *Command) checkConsulServers(namespace string) error {
-	servers, err := c.kubernetes.AppsV1().StatefulSets(namespace).List(c.Ctx, metav1.ListOptions{LabelSelector: "app=consul,chart=consul-helm,component=server"})
-	if err != nil {
-		return err
-	}
-	if len(servers.Items) != 0 {
-		desiredServers, readyServers := int(*servers.Items[0].Spec.Replicas), int(servers.Items[0].Status.ReadyReplicas)
-		if readyServers < desiredServers {
-			c.UI.Output("Consul servers healthy %d/%d", readyServers, desiredServers, terminal.WithErrorStyle())
-		} else {
-			c.UI.Output("Consul servers healthy %d/%d", readyServers, desiredServers)
-		}
-	}
-
-	return nil
-}
-
 // setupKubeClient to use for non Helm SDK calls to the Kubernetes API The Helm SDK will use
 // settings.RESTClientGetter for its calls as well, so this will use a consistent method to
 // target the right cluster for both Helm SDK and non Helm SDK calls.
-func (c *Command) setupKubeClient(settings *helmCLI.EnvSettings) error {
+func (c *Command) setupKubeClient(settings *helmCLI.EnvSettings) (err error) {
+	if c.restConfig == nil {
+		c.restConfig, err = settings.RESTClientGetter().ToRESTConfig()
+		if err != nil {
+			terminal.OutputError(c.UI, c.flagOutput, "Error retrieving Kubernetes authentication: %v", err)
+			return err
+		}
+	}
 	if c.kubernetes == nil {
-		restConfig, err := settings.RESTClientGetter().ToRESTConfig()
+		c.kubernetes, err = kubernetes.NewForConfig(c.restConfig)
+		if err != nil {
+			terminal.OutputError(c.UI, c.flagOutput, "Error initializing Kubernetes client: %v", err)
+			return err
+		}
+	}
+	if c.apiext == nil {
+		c.apiext, err = apiext.NewForConfig(c.restConfig)
 		if err != nil {
-			c.UI.Output("Error retrieving Kubernetes authentication: %v", err, terminal.WithErrorStyle())
+			terminal.OutputError(c.UI, c.flagOutput, "Error initializing Kubernetes client: %v", err)
 			return err
 		}
-		c.kubernetes, err = kubernetes.NewForConfig(restConfig)
+	}
+	if c.dynamic == nil {
+		c.dynamic, err = dynamic.NewForConfig(c.restConfig)
 		if err != nil {
-			c.UI.Output("Error initializing Kubernetes client: %v", err, terminal.WithErrorStyle())
+			terminal.OutputError(c.UI, c.flagOutput, "Error initializing Kubernetes client: %v", err)
 			return err
 		}
 	}
@@ -265,5 +406,5 @@ func (c *Command) Help() string {
 
 // Synopsis returns a one-line command summary.
 func (c *Command) Synopsis() string {
-	return "Check the status of a Consul installation on Kubernetes."
+	return "Check the status and health of a Consul installation on Kubernetes."
 }
@@ -12,6 +12,7 @@ import (
 	"io"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/hashicorp/consul-k8s/cli/common"
 	cmnFlag "github.com/hashicorp/consul-k8s/cli/common/flag"
@@ -26,11 +27,17 @@ import (
 	helmRelease "helm.sh/helm/v3/pkg/release"
 	helmTime "helm.sh/helm/v3/pkg/time"
 	appsv1 "k8s.io/api/apps/v1"
+	apiextFake "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/fake"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicFake "k8s.io/client-go/dynamic/fake"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
 )
 
+var testNow = time.Date(2023, 4, 1, 12, 0, 0, 0, time.UTC)
+
 func TestCheckConsulServers(t *testing.T) {
 	namespace := "default"
 	cases := map[string]struct {
@@ -53,14 +60,16 @@ func TestCheckConsulServers(t *testing.T) {
 			require.NoError(t, err)
 
 			// Verify that the correct server statuses are seen.
-			err = c.checkConsulServers(namespace)
+			components, err := c.checkConsulServers(namespace)
 			require.NoError(t, err)
 
-			actual := buf.String()
-			if tc.desired != 0 {
-				require.Contains(t, actual, fmt.Sprintf("Consul servers healthy %d/%d", tc.healthy, tc.desired))
+			require.Len(t, components, 1)
+			require.Equal(t, fmt.Sprintf("%d/%d servers ready", tc.healthy, tc.desired), components[0].Message)
+			if tc.healthy < tc.desired {
+				require.Equal(t, Degraded, components[0].Health)
+			} else {
+				require.Equal(t, Healthy, components[0].Health)
 			}
-			buf.Reset()
 		})
 	}
 }
@@ -81,7 +90,9 @@ func TestStatus(t *testing.T) {
 			input: []string{},
 			messages: []string{
 				fmt.Sprintf("\n==> Consul Status Summary\nName\tNamespace\tStatus\tChart Version\tAppVersion\tRevision\tLast Updated            \n    \t         \tREADY \t1.0.0        \t          \t0       \t%s\t\n", notImeStr),
-				"\n==> Config:\n    {}\n    \nConsul servers healthy 3/3\n",
+				"\n==> Config:\n    {}\n    \n\n==> Component Health:\n",
+				"Consul servers\t\x1b[32mhealthy\x1b[0m\t3/3 servers ready\t\n",
+				"All components are healthy\n",
 			},
 			preProcessingFunc: func(k8s kubernetes.Interface) error {
 				return createServers("consul-server-test1", "consul", 3, 3, k8s)
@@ -107,7 +118,8 @@ func TestStatus(t *testing.T) {
 			messages: []string{
 				fmt.Sprintf("\n==> Consul Status Summary\nName\tNamespace\tStatus\tChart Version\tAppVersion\tRevision\tLast Updated            \n    \t         \tREADY \t1.0.0        \t          \t0       \t%s\t\n", notImeStr),
 				"\n==> Config:\n    {}\n    \n",
-				"\n==> Status Of Helm Hooks:\npre-install-hook pre-install: Succeeded\npre-upgrade-hook pre-upgrade: Succeeded\nConsul servers healthy 3/3\n",
+				"\n==> Status Of Helm Hooks:\npre-install-hook pre-install: Succeeded\npre-upgrade-hook pre-upgrade: Succeeded\n\n==> Component Health:\n",
+				"Consul servers\t\x1b[32mhealthy\x1b[0m\t3/3 servers ready\t\n",
 			},
 			preProcessingFunc: func(k8s kubernetes.Interface) error {
 				return createServers("consul-server-test1", "consul", 3, 3, k8s)
@@ -210,6 +222,31 @@ func TestStatus(t *testing.T) {
 	}
 }
 
+func TestStatus_StructuredOutputError(t *testing.T) {
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	stderr := os.Stderr
+	os.Stderr = w
+	t.Cleanup(func() { os.Stderr = stderr })
+
+	buf := new(bytes.Buffer)
+	c := getInitializedCommand(t, buf)
+	c.kubernetes = fake.NewSimpleClientset()
+	c.helmActionsRunner = &helm.MockActionRunner{
+		CheckForInstallationsFunc: func(options *helm.CheckForInstallationsOptions) (bool, string, string, error) {
+			return false, "", "", errors.New("kaboom!")
+		},
+	}
+	returnCode := c.Run([]string{"-output", "json"})
+	require.Equal(t, 1, returnCode)
+
+	require.NoError(t, w.Close())
+	errOutput, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Empty(t, buf.String())
+	require.Contains(t, string(errOutput), "kaboom!")
+}
+
 func TestTaskCreateCommand_AutocompleteFlags(t *testing.T) {
 	t.Parallel()
 	cmd := getInitializedCommand(t, nil)
@@ -255,12 +292,17 @@ func getInitializedCommand(t *testing.T, buf io.Writer) *Command {
 		ui = terminal.NewBasicUI(context.Background())
 	}
 	baseCommand := &common.BaseCommand{
+		Ctx: context.Background(),
 		Log: log,
 		UI:  ui,
 	}
 
 	c := &Command{
 		BaseCommand: baseCommand,
+		apiext:      apiextFake.NewSimpleClientset(),
+		dynamic:     dynamicFake.NewSimpleDynamicClient(runtime.NewScheme()),
+		restConfig:  &rest.Config{},
+		now:         func() time.Time { return testNow },
 	}
 	c.init()
 	return c
@@ -271,7 +313,7 @@ func createServers(name, namespace string, replicas, readyReplicas int32, k8s ku
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      name,
 			Namespace: namespace,
-			Labels:    map[string]string{"app": "consul", "chart": "consul-helm", "component": "server"},
+			Labels:    map[string]string{"app": "consul", "chart": "consul-helm", "component": "server", "release": "consul"},
 		},
 		Spec: appsv1.StatefulSetSpec{
 			Replicas: &replicas,
@@ -0,0 +1,322 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package intentions
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	actionAllow = "allow"
+	actionDeny  = "deny"
+
+	wildcard         = "*"
+	defaultNamespace = "default"
+	defaultPartition = "default"
+)
+
+// identity is the Consul identity of a service.
+type identity struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	Partition string `json:"partition"`
+}
+
+func (i identity) String() string {
+	return fmt.Sprintf("%s (namespace: %s, partition: %s)", i.Name, i.Namespace, i.Partition)
+}
+
+// serviceIntentions is the part of a ServiceIntentions resource that is needed
+// to evaluate it.
+type serviceIntentions struct {
+	Metadata struct {
+		Name      string
+		Namespace string
+	}
+	Spec struct {
+		Destination struct {
+			Name      string
+			Namespace string
+		}
+		Sources []source
+	}
+	Status struct {
+		Conditions []condition
+	}
+}
+
+type condition struct {
+	Type    string
+	Status  string
+	Reason  string
+	Message string
+}
+
+// synced returns whether the resource has been written to Consul.
+func (s serviceIntentions) synced() bool {
+	for _, condition := range s.Status.Conditions {
+		if condition.Type == "Synced" {
+			return condition.Status == "True"
+		}
+	}
+	return false
+}
+
+type source struct {
+	Name          string
+	Namespace     string
+	Peer          string
+	Partition     string
+	SamenessGroup string
+	Action        string
+	Permissions   []permission
+	Description   string
+}
+
+type permission struct {
+	Action string
+	HTTP   *httpMatch
+}
+
+type httpMatch struct {
+	PathExact  string
+	PathPrefix string
+	PathRegex  string
+	Methods    []string
+	Header     []headerMatch
+}
+
+type headerMatch struct {
+	Name    string
+	Present bool
+	Exact   string
+	Prefix  string
+	Suffix  string
+	Regex   string
+	Invert  bool
+}
+
+// request is the HTTP request that L7 permissions are evaluated against.
+type request struct {
+	Method  string      `json:"method"`
+	Path    string      `json:"path"`
+	Headers http.Header `json:"headers,omitempty"`
+}
+
+// decision is the outcome of evaluating the intentions for a source and
+// destination.
+type decision struct {
+	Allowed bool
+	// Intention and Source are the resource and source that matched. They are
+	// nil if no intention matched and the default policy applies.
+	Intention *serviceIntentions
+	Source    *source
+	// Destination is the destination of the matched intention with its
+	// namespace defaulted.
+	Destination identity
+	// Precedence of the matched intention, from 1 to 9.
+	Precedence int
+	// Permission is the index of the matched L7 permission, or -1 if the
+	// intention has no L7 permissions or none matched.
+	Permission int
+	// Skipped are the resources that matched but haven't been synced to Consul.
+	Skipped []*serviceIntentions
+}
+
+// evaluate finds the intention with the highest precedence that matches the
+// source and destination, and decides whether the request is allowed the same
+// way Consul does: sources with an action decide by that action, sources with
+// L7 permissions decide by the first matching permission, and if no intention
+// or permission matches the default policy applies.
+func evaluate(resources []serviceIntentions, src, dst identity, req request, settings meshSettings) decision {
+	d := decision{Allowed: settings.defaultAllow, Permission: -1}
+	for i := range resources {
+		resource := &resources[i]
+		dstID := identity{
+			Name:      resource.Spec.Destination.Name,
+			Namespace: resource.Spec.Destination.Namespace,
+			Partition: settings.partition,
+		}
+		if dstID.Namespace == "" {
+			dstID.Namespace = settings.consulNamespace(resource.Metadata.Namespace)
+		}
+		if !matches(dstID.Name, dst.Name) || !matches(dstID.Namespace, dst.Namespace) {
+			continue
+		}
+		for j := range resource.Spec.Sources {
+			s := &resource.Spec.Sources[j]
+			// Sources in other clusters can never match a local workload.
+			if s.Peer != "" || s.SamenessGroup != "" {
+				continue
+			}
+			if s.Partition != "" && s.Partition != src.Partition {
+				continue
+			}
+			namespace := s.Namespace
+			if namespace == "" {
+				namespace = dstID.Namespace
+			}
+			if !matches(s.Name, src.Name) || !matches(namespace, src.Namespace) {
+				continue
+			}
+			if !resource.synced() {
+				d.Skipped = append(d.Skipped, resource)
+				continue
+			}
+			p := precedence(namespace, s.Name, dstID.Namespace, dstID.Name)
+			if p > d.Precedence {
+				d.Intention, d.Source, d.Destination, d.Precedence = resource, s, dstID, p
+			}
+		}
+	}
+	if d.Source == nil {
+		return d
+	}
+
+	if len(d.Source.Permissions) == 0 {
+		d.Allowed = d.Source.Action == actionAllow
+		return d
+	}
+	for i, perm := range d.Source.Permissions {
+		if perm.HTTP == nil || perm.HTTP.matches(req) {
+			d.Permission = i
+			d.Allowed = perm.Action == actionAllow
+			break
+		}
+	}
+	return d
+}
+
+// matches returns whether name matches pattern, which is either an exact
+// name or the wildcard.
+func matches(pattern, name string) bool {
+	return pattern == wildcard || pattern == name
+}
+
+// precedence returns the precedence Consul gives to an intention, from 9 for an
+// exact source and destination to 1 for wildcard namespaces and names.
+func precedence(srcNamespace, srcName, dstNamespace, dstName string) int {
+	rank := func(namespace, name string) int {
+		switch {
+		case namespace == wildcard:
+			return 1
+		case name == wildcard:
+			return 2
+		default:
+			return 3
+		}
+	}
+	return (rank(dstNamespace, dstName)-1)*3 + rank(srcNamespace, srcName)
+}
+
+// matches returns whether the request matches all the conditions of the HTTP
+// permission.
+func (m *httpMatch) matches(req request) bool {
+	switch {
+	case m.PathExact != "" && req.Path != m.PathExact:
+		return false
+	case m.PathPrefix != "" && !strings.HasPrefix(req.Path, m.PathPrefix):
+		return false
+	case m.PathRegex != "" && !fullMatch(m.PathRegex, req.Path):
+		return false
+	}
+	if len(m.Methods) > 0 {
+		var found bool
+		for _, method := range m.Methods {
+			if strings.EqualFold(method, req.Method) {
+				found = true
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	for _, h := range m.Header {
+		if !h.matches(req.Headers) {
+			return false
+		}
+	}
+	return true
+}
+
+func (h headerMatch) matches(headers http.Header) bool {
+	values, present := headers[http.CanonicalHeaderKey(h.Name)]
+	value := strings.Join(values, ",")
+
+	var matched bool
+	switch {
+	case h.Exact != "":
+		matched = present && value == h.Exact
+	case h.Prefix != "":
+		matched = present && strings.HasPrefix(value, h.Prefix)
+	case h.Suffix != "":
+		matched = present && strings.HasSuffix(value, h.Suffix)
+	case h.Regex != "":
+		matched = present && fullMatch(h.Regex, value)
+	default:
+		matched = present
+	}
+	return matched != h.Invert
+}
+
+// fullMatch returns whether the regular expression matches all of s, as Envoy
+// does. Both Envoy and Go use RE2 syntax.
+func fullMatch(expr, s string) bool {
+	re, err := regexp.Compile("^(?:" + expr + ")$")
+	if err != nil {
+		return false
+	}
+	return re.MatchString(s)
+}
+
+// describe explains an HTTP permission, e.g. "GET,POST /api/*".
+func (m *httpMatch) describe() string {
+	var parts []string
+	if len(m.Methods) > 0 {
+		parts = append(parts, strings.Join(m.Methods, ","))
+	}
+	switch {
+	case m.PathExact != "":
+		parts = append(parts, m.PathExact)
+	case m.PathPrefix != "":
+		parts = append(parts, m.PathPrefix+"*")
+	case m.PathRegex != "":
+		parts = append(parts, fmt.Sprintf("~%s", m.PathRegex))
+	}
+	headers := make([]string, 0, len(m.Header))
+	for _, h := range m.Header {
+		headers = append(headers, h.describe())
+	}
+	sort.Strings(headers)
+	parts = append(parts, headers...)
+	if len(parts) == 0 {
+		return "any request"
+	}
+	return strings.Join(parts, " ")
+}
+
+func (h headerMatch) describe() string {
+	var op, value string
+	switch {
+	case h.Exact != "":
+		op, value = "=", h.Exact
+	case h.Prefix != "":
+		op, value = "^=", h.Prefix
+	case h.Suffix != "":
+		op, value = "$=", h.Suffix
+	case h.Regex != "":
+		op, value = "~", h.Regex
+	default:
+		op = " present"
+	}
+	not := ""
+	if h.Invert {
+		not = "!"
+	}
+	return fmt.Sprintf("%s[%s%s%s]", not, h.Name, op, value)
+}
@@ -0,0 +1,237 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package intentions
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvaluate(t *testing.T) {
+	frontend := identity{Name: "frontend", Namespace: "web", Partition: "default"}
+	backend := identity{Name: "backend", Namespace: "api", Partition: "default"}
+	mirroring := meshSettings{namespacesEnabled: true, mirroring: true, partition: "default"}
+	get := request{Method: "GET", Path: "/", Headers: http.Header{}}
+
+	cases := map[string]struct {
+		resources  []serviceIntentions
+		settings   meshSettings
+		req        request
+		allowed    bool
+		matched    string
+		precedence int
+		permission int
+		skipped    int
+	}{
+		"No intentions, default allow": {
+			settings: meshSettings{defaultAllow: true},
+			req:      get,
+			allowed:  true,
+		},
+		"No intentions, default deny": {
+			settings: mirroring,
+			req:      get,
+			allowed:  false,
+		},
+		"Exact intention allows": {
+			resources: []serviceIntentions{
+				intention("backend", "api", "backend", "", source{Name: "frontend", Namespace: "web", Action: actionAllow}),
+			},
+			settings:   mirroring,
+			req:        get,
+			allowed:    true,
+			matched:    "backend",
+			precedence: 9,
+		},
+		"Destination namespace defaults from the resource namespace": {
+			resources: []serviceIntentions{
+				intention("backend-web", "web", "backend", "", source{Name: "frontend", Namespace: "web", Action: actionDeny}),
+				intention("backend", "api", "backend", "", source{Name: "frontend", Namespace: "web", Action: actionAllow}),
+			},
+			settings:   mirroring,
+			req:        get,
+			allowed:    true,
+			matched:    "backend",
+			precedence: 9,
+		},
+		"Source namespace defaults to the destination namespace": {
+			resources: []serviceIntentions{
+				intention("backend", "api", "backend", "", source{Name: "frontend", Action: actionAllow}),
+			},
+			settings: mirroring,
+			req:      get,
+			allowed:  false,
+		},
+		"Exact deny beats wildcard allow": {
+			resources: []serviceIntentions{
+				intention("all", "api", "*", "*", source{Name: "*", Namespace: "*", Action: actionAllow}),
+				intention("backend", "api", "backend", "", source{Name: "frontend", Namespace: "web", Action: actionDeny}),
+			},
+			settings:   meshSettings{namespacesEnabled: true, mirroring: true, partition: "default", defaultAllow: true},
+			req:        get,
+			allowed:    false,
+			matched:    "backend",
+			precedence: 9,
+		},
+		"Wildcard source namespace": {
+			resources: []serviceIntentions{
+				intention("backend", "api", "backend", "", source{Name: "*", Namespace: "*", Action: actionAllow}),
+				intention("any", "api", "*", "", source{Name: "frontend", Namespace: "web", Action: actionDeny}),
+			},
+			settings:   mirroring,
+			req:        get,
+			allowed:    true,
+			matched:    "backend",
+			precedence: 7,
+		},
+		"Peered and sameness group sources don't match": {
+			resources: []serviceIntentions{
+				intention("backend", "api", "backend", "",
+					source{Name: "frontend", Namespace: "web", Peer: "dc2", Action: actionAllow},
+					source{Name: "frontend", Namespace: "web", SamenessGroup: "group", Action: actionAllow}),
+			},
+			settings: mirroring,
+			req:      get,
+			allowed:  false,
+		},
+		"Unsynced intention is skipped": {
+			resources: []serviceIntentions{
+				unsynced(intention("backend", "api", "backend", "", source{Name: "frontend", Namespace: "web", Action: actionAllow})),
+			},
+			settings: mirroring,
+			req:      get,
+			allowed:  false,
+			skipped:  1,
+		},
+		"First matching L7 permission decides": {
+			resources: []serviceIntentions{
+				intention("backend", "api", "backend", "", source{Name: "frontend", Namespace: "web", Permissions: []permission{
+					{Action: actionDeny, HTTP: &httpMatch{PathPrefix: "/admin"}},
+					{Action: actionAllow, HTTP: &httpMatch{PathPrefix: "/", Methods: []string{"GET"}}},
+				}}),
+			},
+			settings:   mirroring,
+			req:        request{Method: "GET", Path: "/admin/users", Headers: http.Header{}},
+			allowed:    false,
+			matched:    "backend",
+			precedence: 9,
+			permission: 0,
+		},
+		"L7 permission with headers": {
+			resources: []serviceIntentions{
+				intention("backend", "api", "backend", "", source{Name: "frontend", Namespace: "web", Permissions: []permission{
+					{Action: actionAllow, HTTP: &httpMatch{PathExact: "/", Header: []headerMatch{{Name: "x-user", Exact: "admin"}}}},
+				}}),
+			},
+			settings:   mirroring,
+			req:        request{Method: "GET", Path: "/", Headers: http.Header{"X-User": {"admin"}}},
+			allowed:    true,
+			matched:    "backend",
+			precedence: 9,
+			permission: 0,
+		},
+		"No L7 permission matches, default applies": {
+			resources: []serviceIntentions{
+				intention("backend", "api", "backend", "", source{Name: "frontend", Namespace: "web", Permissions: []permission{
+					{Action: actionAllow, HTTP: &httpMatch{Methods: []string{"POST"}}},
+				}}),
+			},
+			settings:   mirroring,
+			req:        get,
+			allowed:    false,
+			matched:    "backend",
+			precedence: 9,
+			permission: -1,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			d := evaluate(tc.resources, frontend, backend, tc.req, tc.settings)
+			require.Equal(t, tc.allowed, d.Allowed)
+			require.Len(t, d.Skipped, tc.skipped)
+			if tc.matched == "" {
+				require.Nil(t, d.Intention)
+				return
+			}
+			require.Equal(t, tc.matched, d.Intention.Metadata.Name)
+			require.Equal(t, tc.precedence, d.Precedence)
+			if len(d.Source.Permissions) > 0 {
+				require.Equal(t, tc.permission, d.Permission)
+			}
+		})
+	}
+}
+
+func TestPrecedence(t *testing.T) {
+	cases := []struct {
+		srcNamespace, srcName, dstNamespace, dstName string
+		expected                                     int
+	}{
+		{"web", "frontend", "api", "backend", 9},
+		{"web", "*", "api", "backend", 8},
+		{"*", "*", "api", "backend", 7},
+		{"web", "frontend", "api", "*", 6},
+		{"web", "*", "api", "*", 5},
+		{"*", "*", "api", "*", 4},
+		{"web", "frontend", "*", "*", 3},
+		{"web", "*", "*", "*", 2},
+		{"*", "*", "*", "*", 1},
+	}
+	for _, tc := range cases {
+		require.Equal(t, tc.expected, precedence(tc.srcNamespace, tc.srcName, tc.dstNamespace, tc.dstName))
+	}
+}
+
+func TestHeaderMatch(t *testing.T) {
+	headers := http.Header{"X-User": {"admin"}, "X-Version": {"v2.1"}}
+	cases := map[string]struct {
+		match    headerMatch
+		expected bool
+	}{
+		"Present":           {headerMatch{Name: "x-user", Present: true}, true},
+		"Not present":       {headerMatch{Name: "x-other", Present: true}, false},
+		"Exact":             {headerMatch{Name: "x-user", Exact: "admin"}, true},
+		"Exact mismatch":    {headerMatch{Name: "x-user", Exact: "guest"}, false},
+		"Prefix":            {headerMatch{Name: "x-version", Prefix: "v2"}, true},
+		"Suffix":            {headerMatch{Name: "x-version", Suffix: ".1"}, true},
+		"Regex":             {headerMatch{Name: "x-version", Regex: `v2\.\d+`}, true},
+		"Regex partial":     {headerMatch{Name: "x-version", Regex: `v2`}, false},
+		"Inverted":          {headerMatch{Name: "x-user", Exact: "admin", Invert: true}, false},
+		"Inverted mismatch": {headerMatch{Name: "x-user", Exact: "guest", Invert: true}, true},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, tc.expected, tc.match.matches(headers))
+		})
+	}
+}
+
+func TestHTTPMatchDescribe(t *testing.T) {
+	m := &httpMatch{
+		PathPrefix: "/api",
+		Methods:    []string{"GET", "POST"},
+		Header:     []headerMatch{{Name: "x-user", Exact: "admin"}, {Name: "x-debug", Present: true, Invert: true}},
+	}
+	require.Equal(t, "GET,POST /api* ![x-debug present] [x-user=admin]", m.describe())
+	require.Equal(t, "any request", (&httpMatch{}).describe())
+}
+
+func intention(name, namespace, dstName, dstNamespace string, sources ...source) serviceIntentions {
+	var s serviceIntentions
+	s.Metadata.Name = name
+	s.Metadata.Namespace = namespace
+	s.Spec.Destination.Name = dstName
+	s.Spec.Destination.Namespace = dstNamespace
+	s.Spec.Sources = sources
+	s.Status.Conditions = []condition{{Type: "Synced", Status: "True"}}
+	return s
+}
+
+func unsynced(s serviceIntentions) serviceIntentions {
+	s.Status.Conditions[0].Status = "False"
+	return s
+}
@@ -0,0 +1,207 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package intentions
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	annotationService         = "consul.hashicorp.com/connect-service"
+	annotationConsulNamespace = "consul.hashicorp.com/consul-namespace"
+	injectedSelector          = "consul.hashicorp.com/connect-inject-status=injected"
+)
+
+// meshSettings are the Helm values that determine the Consul identities of
+// workloads and the default intention policy.
+type meshSettings struct {
+	namespacesEnabled    bool
+	destinationNamespace string
+	mirroring            bool
+	mirroringPrefix      string
+	partition            string
+	datacenter           string
+	// defaultAllow is Consul's default intention policy. It follows the ACL
+	// default policy, which is deny when the chart manages ACLs.
+	defaultAllow bool
+}
+
+// newMeshSettings reads the mesh settings from the values of a release,
+// falling back to the chart defaults for values that weren't set.
+func newMeshSettings(values map[string]interface{}) meshSettings {
+	s := meshSettings{
+		namespacesEnabled:    lookup(values, false, "global", "enableConsulNamespaces"),
+		destinationNamespace: lookup(values, defaultNamespace, "connectInject", "consulNamespaces", "consulDestinationNamespace"),
+		mirroring:            lookup(values, true, "connectInject", "consulNamespaces", "mirroringK8S"),
+		mirroringPrefix:      lookup(values, "", "connectInject", "consulNamespaces", "mirroringK8SPrefix"),
+		partition:            defaultPartition,
+		datacenter:           lookup(values, "dc1", "global", "datacenter"),
+		defaultAllow:         !lookup(values, false, "global", "acls", "manageSystemACLs"),
+	}
+	if lookup(values, false, "global", "adminPartitions", "enabled") {
+		s.partition = lookup(values, defaultPartition, "global", "adminPartitions", "name")
+	}
+	return s
+}
+
+// lookup returns the value at path in values, or def if it isn't set.
+func lookup[T any](values map[string]interface{}, def T, path ...string) T {
+	for i, key := range path {
+		v, ok := values[key]
+		if !ok {
+			return def
+		}
+		if i == len(path)-1 {
+			if t, ok := v.(T); ok {
+				return t
+			}
+			return def
+		}
+		if values, ok = v.(map[string]interface{}); !ok {
+			return def
+		}
+	}
+	return def
+}
+
+// consulNamespace returns the Consul namespace that services in a Kubernetes
+// namespace are registered in.
+func (s meshSettings) consulNamespace(kubeNamespace string) string {
+	switch {
+	case !s.namespacesEnabled:
+		return defaultNamespace
+	case s.mirroring:
+		return s.mirroringPrefix + kubeNamespace
+	default:
+		return s.destinationNamespace
+	}
+}
+
+// workload is a source or destination from the command line resolved to its
+// Consul identity.
+type workload struct {
+	identity
+	kubeNamespace string
+	// pod is set if the workload was given as a pod.
+	pod *v1.Pod
+}
+
+// resolve resolves a [namespace/]name reference to a pod or service. Pods are
+// resolved to the Consul service they are registered as, anything else is
+// taken to be the name of a Consul service.
+func resolve(ctx context.Context, client kubernetes.Interface, ref, namespace string, settings meshSettings) (workload, error) {
+	if ns, name, found := strings.Cut(ref, "/"); found {
+		namespace, ref = ns, name
+	}
+	w := workload{
+		identity: identity{
+			Name:      ref,
+			Namespace: settings.consulNamespace(namespace),
+			Partition: settings.partition,
+		},
+		kubeNamespace: namespace,
+	}
+
+	pod, err := client.CoreV1().Pods(namespace).Get(ctx, ref, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return w, nil
+	}
+	if err != nil {
+		return w, fmt.Errorf("error getting pod %s/%s: %w", namespace, ref, err)
+	}
+
+	services, err := serviceNames(ctx, client, pod)
+	if err != nil {
+		return w, err
+	}
+	if len(services) == 0 {
+		return w, fmt.Errorf("pod %s/%s is not part of a service: it has no %s annotation and no Kubernetes Service selects it",
+			namespace, ref, annotationService)
+	}
+	w.Name = services[0]
+	if ns := pod.Annotations[annotationConsulNamespace]; ns != "" && settings.namespacesEnabled {
+		w.Namespace = ns
+	}
+	w.pod = pod
+	return w, nil
+}
+
+// serviceNames returns the names of the services a pod is registered as. These
+// come from the connect-service annotation, or from the Kubernetes Services
+// selecting the pod.
+func serviceNames(ctx context.Context, client kubernetes.Interface, pod *v1.Pod) ([]string, error) {
+	if annotation := pod.Annotations[annotationService]; annotation != "" {
+		var names []string
+		for _, name := range strings.Split(annotation, ",") {
+			names = append(names, strings.TrimSpace(name))
+		}
+		return names, nil
+	}
+
+	services, err := client.CoreV1().Services(pod.Namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("error listing services in %s: %w", pod.Namespace, err)
+	}
+	var names []string
+	for _, service := range services.Items {
+		if len(service.Spec.Selector) == 0 {
+			continue
+		}
+		if labels.SelectorFromSet(service.Spec.Selector).Matches(labels.Set(pod.Labels)) {
+			names = append(names, service.Name)
+		}
+	}
+	return names, nil
+}
+
+// destinationPod returns a running, injected pod of the destination service.
+func destinationPod(ctx context.Context, client kubernetes.Interface, dst workload) (*v1.Pod, error) {
+	if dst.pod != nil {
+		return dst.pod, nil
+	}
+	pods, err := client.CoreV1().Pods(dst.kubeNamespace).List(ctx, metav1.ListOptions{LabelSelector: injectedSelector})
+	if err != nil {
+		return nil, fmt.Errorf("error listing pods in %s: %w", dst.kubeNamespace, err)
+	}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.Status.Phase != v1.PodRunning {
+			continue
+		}
+		names, err := serviceNames(ctx, client, pod)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			if name == dst.Name {
+				return pod, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// adminPort returns the port of the Envoy admin API of the service's proxy.
+// Pods with multiple services run a proxy per service, whose admin ports start
+// at 19000 in the order of the connect-service annotation.
+func adminPort(pod *v1.Pod, service string) int {
+	names := strings.Split(pod.Annotations[annotationService], ",")
+	if len(names) < 2 {
+		return defaultAdminPort
+	}
+	for i, name := range names {
+		if strings.TrimSpace(name) == service {
+			return defaultAdminPort + i
+		}
+	}
+	return defaultAdminPort
+}
@@ -0,0 +1,554 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package intentions
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/consul-k8s/cli/common"
+	"github.com/hashicorp/consul-k8s/cli/common/envoy"
+	"github.com/hashicorp/consul-k8s/cli/common/flag"
+	"github.com/hashicorp/consul-k8s/cli/common/terminal"
+	"github.com/hashicorp/consul-k8s/cli/helm"
+	"github.com/posener/complete"
+	"helm.sh/helm/v3/pkg/action"
+	helmCLI "helm.sh/helm/v3/pkg/cli"
+	"k8s.io/apimachinery/pkg/api/validation"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	defaultAdminPort    int = 19000
+	flagNameKubeConfig      = "kubeconfig"
+	flagNameKubeContext     = "context"
+	flagNameNamespace       = "namespace"
+	flagNameSource          = "source"
+	flagNameDestination     = "destination"
+	flagNameMethod          = "method"
+	flagNamePath            = "path"
+	flagNameHeader          = "header"
+	flagNameOutput          = "output"
+)
+
+var serviceIntentionsGVR = schema.GroupVersionResource{
+	Group:    "consul.hashicorp.com",
+	Version:  "v1alpha1",
+	Resource: "serviceintentions",
+}
+
+type IntentionsCommand struct {
+	*common.BaseCommand
+
+	kubernetes        kubernetes.Interface
+	dynamic           dynamic.Interface
+	helmActionsRunner helm.HelmActionsRunner
+	fetchConfig       func(context.Context, common.PortForwarder) (*envoy.EnvoyConfig, error)
+
+	set *flag.Sets
+
+	flagKubeConfig  string
+	flagKubeContext string
+	flagNamespace   string
+
+	flagSource      string
+	flagDestination string
+	flagMethod      string
+	flagPath        string
+	flagHeaders     map[string]string
+	flagOutput      string
+
+	restConfig *rest.Config
+	settings   *helmCLI.EnvSettings
+
+	once sync.Once
+	help string
+}
+
+// init sets up flags and help text for the command.
+func (c *IntentionsCommand) init() {
+	c.set = flag.NewSets()
+	f := c.set.NewSet("Command Options")
+
+	f.StringVar(&flag.StringVar{
+		Name:    flagNameSource,
+		Target:  &c.flagSource,
+		Usage:   "The source pod or service, as [namespace/]name.",
+		Aliases: []string{"s"},
+	})
+
+	f.StringVar(&flag.StringVar{
+		Name:    flagNameDestination,
+		Target:  &c.flagDestination,
+		Usage:   "The destination service, as [namespace/]name.",
+		Aliases: []string{"d"},
+	})
+
+	f.StringVar(&flag.StringVar{
+		Name:    flagNameMethod,
+		Target:  &c.flagMethod,
+		Default: http.MethodGet,
+		Usage:   "The HTTP method of the request, used to evaluate L7 permissions.",
+	})
+
+	f.StringVar(&flag.StringVar{
+		Name:    flagNamePath,
+		Target:  &c.flagPath,
+		Default: "/",
+		Usage:   "The HTTP path of the request, used to evaluate L7 permissions.",
+	})
+
+	f.StringMapVar(&flag.StringMapVar{
+		Name:   flagNameHeader,
+		Target: &c.flagHeaders,
+		Usage:  "An HTTP header of the request in the form name=value, used to evaluate L7 permissions. Can be specified multiple times.",
+	})
+
+	f.StringVar(&flag.StringVar{
+		Name:    flagNameOutput,
+		Target:  &c.flagOutput,
+		Default: terminal.FormatTable,
+		Usage:   terminal.OutputUsage("the result"),
+		Aliases: []string{"o"},
+	})
+
+	f = c.set.NewSet("Global Options")
+	f.StringVar(&flag.StringVar{
+		Name:    flagNameKubeConfig,
+		Aliases: []string{"c"},
+		Target:  &c.flagKubeConfig,
+		Default: "",
+		Usage:   "Set the path to kubeconfig file.",
+	})
+	f.StringVar(&flag.StringVar{
+		Name:    flagNameKubeContext,
+		Target:  &c.flagKubeContext,
+		Default: "",
+		Usage:   "Set the Kubernetes context to use.",
+	})
+
+	f.StringVar(&flag.StringVar{
+		Name:    flagNameNamespace,
+		Target:  &c.flagNamespace,
+		Usage:   "The namespace of the source and destination when they aren't given as namespace/name.",
+		Aliases: []string{"n"},
+	})
+
+	c.help = c.set.Help()
+}
+
+// Run executes the intentions command.
+func (c *IntentionsCommand) Run(args []string) int {
+	c.once.Do(c.init)
+	c.Log.ResetNamed("intentions")
+	defer common.CloseWithError(c.BaseCommand)
+
+	// Parse the command line flags.
+	if err := c.set.Parse(args); err != nil {
+		c.UI.Output("Error parsing arguments: %v", err.Error(), terminal.WithErrorStyle())
+		return 1
+	}
+
+	// Validate the command line flags.
+	if err := c.validateFlags(); err != nil {
+		c.UI.Output("Invalid argument: %v", err.Error(), terminal.WithErrorStyle())
+		return 1
+	}
+
+	if err := c.initKubernetes(); err != nil {
+		c.UI.Output("Error initializing Kubernetes client: %v", err.Error(), terminal.WithErrorStyle())
+		return 1
+	}
+	if c.helmActionsRunner == nil {
+		c.helmActionsRunner = &helm.ActionRunner{}
+	}
+	if c.fetchConfig == nil {
+		c.fetchConfig = envoy.FetchConfig
+	}
+
+	if err := c.Troubleshoot(); err != nil {
+		c.UI.Output("Error running troubleshoot: %v", err.Error(), terminal.WithErrorStyle())
+		return 1
+	}
+
+	return 0
+}
+
+// validateFlags ensures that the flags passed in by the can be used.
+func (c *IntentionsCommand) validateFlags() error {
+	if len(c.set.Args()) > 0 {
+		return fmt.Errorf("should have no non-flag arguments")
+	}
+
+	if c.flagSource == "" {
+		return fmt.Errorf("-source flag is required")
+	}
+
+	if c.flagDestination == "" {
+		return fmt.Errorf("-destination flag is required")
+	}
+
+	if errs := validation.ValidateNamespaceName(c.flagNamespace, false); c.flagNamespace != "" && len(errs) > 0 {
+		return fmt.Errorf("invalid namespace name passed for -namespace/-n: %v", strings.Join(errs, "; "))
+	}
+
+	if !strings.HasPrefix(c.flagPath, "/") {
+		return fmt.Errorf("-path must start with /")
+	}
+
+	return terminal.ValidateFormat(c.flagOutput)
+}
+
+// initKubernetes initializes the Kubernetes clients.
+func (c *IntentionsCommand) initKubernetes() (err error) {
+	c.settings = helmCLI.New()
+
+	if c.flagKubeConfig != "" {
+		c.settings.KubeConfig = c.flagKubeConfig
+	}
+
+	if c.flagKubeContext != "" {
+		c.settings.KubeContext = c.flagKubeContext
+	}
+
+	if c.restConfig == nil {
+		if c.restConfig, err = c.settings.RESTClientGetter().ToRESTConfig(); err != nil {
+			return fmt.Errorf("error creating Kubernetes REST config %v", err)
+		}
+	}
+
+	if c.kubernetes == nil {
+		if c.kubernetes, err = kubernetes.NewForConfig(c.restConfig); err != nil {
+			return fmt.Errorf("error creating Kubernetes client %v", err)
+		}
+	}
+
+	if c.dynamic == nil {
+		if c.dynamic, err = dynamic.NewForConfig(c.restConfig); err != nil {
+			return fmt.Errorf("error creating Kubernetes dynamic client %v", err)
+		}
+	}
+
+	if c.flagNamespace == "" {
+		c.flagNamespace = c.settings.Namespace()
+	}
+
+	return nil
+}
+
+// Troubleshoot evaluates the intentions between the source and destination
+// and cross-checks the result against the destination's Envoy RBAC filters.
+func (c *IntentionsCommand) Troubleshoot() error {
+	settings, err := c.meshSettings()
+	if err != nil {
+		return err
+	}
+
+	src, err := resolve(c.Ctx, c.kubernetes, c.flagSource, c.flagNamespace, settings)
+	if err != nil {
+		return err
+	}
+	dst, err := resolve(c.Ctx, c.kubernetes, c.flagDestination, c.flagNamespace, settings)
+	if err != nil {
+		return err
+	}
+
+	// The table output is printed as soon as each part is known, so that it
+	// isn't lost if the Envoy check fails.
+	table := !terminal.Structured(c.flagOutput)
+	if table {
+		c.UI.Output("Identities", terminal.WithHeaderStyle())
+		c.UI.Output("Source:      %s%s", src.identity, describePod(src), terminal.WithInfoStyle())
+		c.UI.Output("Destination: %s%s", dst.identity, describePod(dst), terminal.WithInfoStyle())
+	}
+
+	resources, err := c.listServiceIntentions()
+	if err != nil {
+		return err
+	}
+	req := request{Method: c.flagMethod, Path: c.flagPath, Headers: http.Header{}}
+	for name, value := range c.flagHeaders {
+		req.Headers.Add(name, value)
+	}
+	d := evaluate(resources, src.identity, dst.identity, req, settings)
+	if table {
+		c.outputDecision(d, src.identity, dst.identity, req, settings)
+	}
+
+	r := newResult(src, dst, req, d, settings)
+	if r.Envoy, err = c.checkEnvoy(dst, src.identity, req, d, settings); err != nil {
+		return err
+	}
+	return terminal.Render(c.UI, c.flagOutput, r, func() { c.outputEnvoy(r.Envoy, dst, req) })
+}
+
+// meshSettings reads the mesh settings from the values of the Consul release.
+func (c *IntentionsCommand) meshSettings() (meshSettings, error) {
+	_, releaseName, namespace, err := c.helmActionsRunner.CheckForInstallations(&helm.CheckForInstallationsOptions{
+		Settings:    c.settings,
+		ReleaseName: common.DefaultReleaseName,
+		DebugLog:    func(s string, args ...interface{}) { c.Log.Debug(fmt.Sprintf(s, args...)) },
+	})
+	if err != nil {
+		return meshSettings{}, err
+	}
+
+	statusConfig := new(action.Configuration)
+	statusConfig, err = helm.InitActionConfig(statusConfig, namespace, c.settings, func(s string, args ...interface{}) {
+		c.Log.Debug(fmt.Sprintf(s, args...))
+	})
+	if err != nil {
+		return meshSettings{}, err
+	}
+	rel, err := c.helmActionsRunner.GetStatus(action.NewStatus(statusConfig), releaseName)
+	if err != nil {
+		return meshSettings{}, fmt.Errorf("couldn't get the status of release %s: %w", releaseName, err)
+	}
+	return newMeshSettings(rel.Config), nil
+}
+
+// listServiceIntentions lists the ServiceIntentions resources in all
+// namespaces.
+func (c *IntentionsCommand) listServiceIntentions() ([]serviceIntentions, error) {
+	list, err := c.dynamic.Resource(serviceIntentionsGVR).List(c.Ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("error listing ServiceIntentions: %w", err)
+	}
+	resources := make([]serviceIntentions, 0, len(list.Items))
+	for _, item := range list.Items {
+		raw, err := json.Marshal(item.Object)
+		if err != nil {
+			return nil, err
+		}
+		var resource serviceIntentions
+		if err := json.Unmarshal(raw, &resource); err != nil {
+			return nil, fmt.Errorf("error parsing ServiceIntentions %s/%s: %w", item.GetNamespace(), item.GetName(), err)
+		}
+		resources = append(resources, resource)
+	}
+	return resources, nil
+}
+
+// outputDecision explains which intention matched and why.
+func (c *IntentionsCommand) outputDecision(d decision, src, dst identity, req request, settings meshSettings) {
+	c.UI.Output("Intentions", terminal.WithHeaderStyle())
+	for _, resource := range d.Skipped {
+		c.UI.Output("ServiceIntentions %s/%s matches but is not synced to Consul, so it was ignored",
+			resource.Metadata.Namespace, resource.Metadata.Name, terminal.WithWarningStyle())
+	}
+
+	if d.Source == nil {
+		c.UI.Output("No intention matches %s -> %s; the default policy applies: %s",
+			src.Name, dst.Name, describeDefault(settings), terminal.WithInfoStyle())
+	} else {
+		c.UI.Output("Matched ServiceIntentions %s/%s, source %s/%s -> destination %s/%s (precedence %d)",
+			d.Intention.Metadata.Namespace, d.Intention.Metadata.Name,
+			orDefault(d.Source.Namespace, d.Destination.Namespace), d.Source.Name,
+			d.Destination.Namespace, d.Destination.Name, d.Precedence, terminal.WithInfoStyle())
+		if d.Source.Description != "" {
+			c.UI.Output("Description: %s", d.Source.Description, terminal.WithInfoStyle())
+		}
+		if len(d.Source.Permissions) > 0 {
+			c.UI.Output("Evaluated L7 permissions for %s", describeRequest(req), terminal.WithInfoStyle())
+			for i, perm := range d.Source.Permissions {
+				match := describePermission(perm)
+				marker := " "
+				if i == d.Permission {
+					marker = "*"
+				}
+				c.UI.Output("%s %d. %s %s", marker, i+1, perm.Action, match, terminal.WithInfoStyle())
+			}
+			if d.Permission < 0 {
+				c.UI.Output("No permission matches the request; the default policy applies: %s",
+					describeDefault(settings), terminal.WithInfoStyle())
+			}
+		}
+	}
+
+	if d.Allowed {
+		c.UI.Output("%s is allowed to connect to %s", src.Name, dst.Name, terminal.WithSuccessStyle())
+	} else {
+		c.UI.Output("%s is denied from connecting to %s", src.Name, dst.Name, terminal.WithErrorStyle())
+	}
+}
+
+// checkEnvoy cross-checks the decision against the RBAC filters on the public
+// listener of a destination pod's proxy, evaluating L7 permissions for the
+// request.
+func (c *IntentionsCommand) checkEnvoy(dst workload, src identity, req request, d decision, settings meshSettings) (envoyCheck, error) {
+	check := envoyCheck{Verdicts: []envoyVerdict{}}
+
+	pod, err := destinationPod(c.Ctx, c.kubernetes, dst)
+	if err != nil {
+		return check, err
+	}
+	if pod == nil {
+		return check, nil
+	}
+
+	pf := common.PortForward{
+		Namespace:  pod.Namespace,
+		PodName:    pod.Name,
+		RemotePort: adminPort(pod, dst.Name),
+		KubeClient: c.kubernetes,
+		RestConfig: c.restConfig,
+	}
+	config, err := c.fetchConfig(c.Ctx, &pf)
+	if err != nil {
+		return check, fmt.Errorf("error fetching the Envoy config of pod %s/%s: %w", pod.Namespace, pod.Name, err)
+	}
+	filters, err := parseRBACFilters(config.RawCfg)
+	if err != nil {
+		return check, err
+	}
+
+	check.Pod = fmt.Sprintf("%s/%s", pod.Namespace, pod.Name)
+	check.Principal = spiffeID(src, settings.datacenter)
+	check.RBACFilters = len(filters) > 0
+	if !check.RBACFilters {
+		filters = []rbacFilter{{Name: "none"}}
+	}
+	for _, filter := range filters {
+		v := filter.evaluate(check.Principal, req)
+		check.Verdicts = append(check.Verdicts, envoyVerdict{rbacVerdict: v, Agrees: v.Allowed == d.Allowed})
+	}
+	return check, nil
+}
+
+// outputEnvoy prints the verdicts of the RBAC filters of the destination.
+func (c *IntentionsCommand) outputEnvoy(check envoyCheck, dst workload, req request) {
+	c.UI.Output("Envoy RBAC", terminal.WithHeaderStyle())
+	if check.Pod == "" {
+		c.UI.Output("No running pods with a proxy found for %s in %s; skipping the Envoy check",
+			dst.Name, dst.kubeNamespace, terminal.WithWarningStyle())
+		return
+	}
+
+	c.UI.Output("Evaluated %s on pod %s", check.Principal, check.Pod, terminal.WithInfoStyle())
+	if !check.RBACFilters {
+		c.UI.Output("The public listener has no RBAC filters, so all connections are allowed", terminal.WithInfoStyle())
+	}
+
+	for _, v := range check.Verdicts {
+		outcome := "denies"
+		if v.Allowed {
+			outcome = "allows"
+		}
+		policies := "no policy matched"
+		if len(v.Policies) > 0 {
+			policies = "matched policies " + strings.Join(v.Policies, ", ")
+		}
+		subject := "the connection"
+		if v.L7 {
+			subject = describeRequest(req)
+		}
+		if v.Agrees {
+			c.UI.Output("%s %s %s (%s), which agrees with the intentions",
+				v.Filter, outcome, subject, policies, terminal.WithSuccessStyle())
+		} else {
+			c.UI.Output("%s %s %s (%s), which disagrees with the intentions",
+				v.Filter, outcome, subject, policies, terminal.WithErrorStyle())
+			c.UI.Output("-> The intentions in Consul may have been changed outside of Kubernetes, or the proxy hasn't received the latest configuration",
+				terminal.WithInfoStyle())
+		}
+	}
+}
+
+func describePod(w workload) string {
+	if w.pod == nil {
+		return ""
+	}
+	return fmt.Sprintf(" from pod %s/%s", w.pod.Namespace, w.pod.Name)
+}
+
+func describeDefault(settings meshSettings) string {
+	if settings.defaultAllow {
+		return "allow (ACLs are not managed by the chart)"
+	}
+	return "deny (ACLs are enabled with a default deny policy)"
+}
+
+func describePermission(perm permission) string {
+	if perm.HTTP == nil {
+		return "any request"
+	}
+	return perm.HTTP.describe()
+}
+
+func describeRequest(req request) string {
+	s := fmt.Sprintf("%s %s", req.Method, req.Path)
+	for name, values := range req.Headers {
+		s += fmt.Sprintf(" [%s=%s]", name, strings.Join(values, ","))
+	}
+	return s
+}
+
+func orDefault(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
+
+// AutocompleteFlags returns a mapping of supported flags and autocomplete
+// options for this command. The map key for the Flags map should be the
+// complete flag such as "-foo" or "--foo".
+func (c *IntentionsCommand) AutocompleteFlags() complete.Flags {
+	return complete.Flags{
+		fmt.Sprintf("-%s", flagNameSource):      complete.PredictNothing,
+		fmt.Sprintf("-%s", flagNameDestination): complete.PredictNothing,
+		fmt.Sprintf("-%s", flagNameMethod): complete.PredictSet(http.MethodGet, http.MethodHead, http.MethodPost,
+			http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace),
+		fmt.Sprintf("-%s", flagNamePath):        complete.PredictNothing,
+		fmt.Sprintf("-%s", flagNameHeader):      complete.PredictNothing,
+		fmt.Sprintf("-%s", flagNameOutput):      complete.PredictSet(terminal.Formats...),
+		fmt.Sprintf("-%s", flagNameNamespace):   complete.PredictNothing,
+		fmt.Sprintf("-%s", flagNameKubeConfig):  complete.PredictFiles("*"),
+		fmt.Sprintf("-%s", flagNameKubeContext): complete.PredictNothing,
+	}
+}
+
+// AutocompleteArgs returns the argument predictor for this command.
+// Since argument completion is not supported, this will return
+// complete.PredictNothing.
+func (c *IntentionsCommand) AutocompleteArgs() complete.Predictor {
+	return complete.PredictNothing
+}
+
+func (c *IntentionsCommand) Synopsis() string {
+	return synopsis
+}
+
+func (c *IntentionsCommand) Help() string {
+	c.once.Do(c.init)
+	return fmt.Sprintf("%s\n\n%s", help, c.help)
+}
+
+const (
+	synopsis = "Explains whether intentions allow a source to connect to a destination."
+	help     = `
+Usage: consul-k8s troubleshoot intentions [options]
+
+  Resolves the Consul identities of a source and destination, evaluates the
+  ServiceIntentions resources and Consul's default policy, and explains which
+  intention decides whether the source may connect. L7 permissions are
+  evaluated for the request given by -method, -path and -header.
+
+  The result is cross-checked against the RBAC filters of the destination's
+  Envoy proxy.
+
+  Examples:
+    $ consul-k8s troubleshoot intentions -source frontend-5f8c7d-x2x9z -destination backend
+
+    $ consul-k8s troubleshoot intentions -source web/frontend -destination api/backend \
+        -method POST -path /admin -header x-user=admin`
+)
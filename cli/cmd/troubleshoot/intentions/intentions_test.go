@@ -0,0 +1,428 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package intentions
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/hashicorp/consul-k8s/cli/common"
+	"github.com/hashicorp/consul-k8s/cli/common/envoy"
+	cmnFlag "github.com/hashicorp/consul-k8s/cli/common/flag"
+	"github.com/hashicorp/consul-k8s/cli/common/terminal"
+	"github.com/hashicorp/consul-k8s/cli/helm"
+	"github.com/hashicorp/go-hclog"
+	"github.com/posener/complete"
+	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v3/pkg/action"
+	helmRelease "helm.sh/helm/v3/pkg/release"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicFake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+)
+
+func TestFlagParsing(t *testing.T) {
+	cases := map[string]struct {
+		args []string
+		out  int
+	}{
+		"No args, should fail": {
+			args: []string{},
+			out:  1,
+		},
+		"Nonexistent flag passed, -foo bar, should fail": {
+			args: []string{"-foo", "bar"},
+			out:  1,
+		},
+		"Missing -destination, should fail": {
+			args: []string{"-source", "frontend"},
+			out:  1,
+		},
+		"Missing -source, should fail": {
+			args: []string{"-destination", "backend"},
+			out:  1,
+		},
+		"Invalid namespace, should fail": {
+			args: []string{"-source", "frontend", "-destination", "backend", "-namespace", "not_a_namespace"},
+			out:  1,
+		},
+		"Relative path, should fail": {
+			args: []string{"-source", "frontend", "-destination", "backend", "-path", "admin"},
+			out:  1,
+		},
+		"Malformed header, should fail": {
+			args: []string{"-source", "frontend", "-destination", "backend", "-header", "x-user"},
+			out:  1,
+		},
+		"Invalid output, should fail": {
+			args: []string{"-source", "frontend", "-destination", "backend", "-output", "xml"},
+			out:  1,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			c := setupCommand(new(bytes.Buffer))
+			out := c.Run(tc.args)
+			require.Equal(t, tc.out, out)
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	allowFrontend := []map[string]interface{}{
+		{"name": "frontend", "action": "allow"},
+	}
+	cases := map[string]struct {
+		args     []string
+		values   map[string]interface{}
+		sources  []map[string]interface{}
+		synced   string
+		messages []string
+	}{
+		"Allowed by intention, agrees with Envoy": {
+			args:    []string{"-source", "frontend-abc", "-destination", "backend"},
+			values:  map[string]interface{}{"global": map[string]interface{}{"acls": map[string]interface{}{"manageSystemACLs": true}}},
+			sources: allowFrontend,
+			synced:  "True",
+			messages: []string{
+				"Source:      frontend (namespace: default, partition: default) from pod default/frontend-abc",
+				"Destination: backend (namespace: default, partition: default)",
+				"Matched ServiceIntentions default/backend, source default/frontend -> destination default/backend (precedence 9)",
+				"frontend is allowed to connect to backend",
+				"Evaluated spiffe://11111111-2222-3333-4444-555555555555.consul/ns/default/dc/dc1/svc/frontend on pod default/backend-xyz",
+				"envoy.filters.http.rbac allows the connection (no policy matched), which agrees with the intentions",
+			},
+		},
+		"Denied by default, disagrees with Envoy": {
+			args:    []string{"-source", "frontend", "-destination", "default/backend"},
+			values:  map[string]interface{}{"global": map[string]interface{}{"acls": map[string]interface{}{"manageSystemACLs": true}}},
+			sources: allowFrontend,
+			synced:  "False",
+			messages: []string{
+				"ServiceIntentions default/backend matches but is not synced to Consul, so it was ignored",
+				"No intention matches frontend -> backend; the default policy applies: deny (ACLs are enabled with a default deny policy)",
+				"frontend is denied from connecting to backend",
+				"envoy.filters.http.rbac allows the connection (no policy matched), which disagrees with the intentions",
+			},
+		},
+		"L7 permissions": {
+			args:   []string{"-source", "frontend", "-destination", "backend", "-method", "POST", "-path", "/admin"},
+			values: map[string]interface{}{},
+			sources: []map[string]interface{}{
+				{
+					"name":        "frontend",
+					"description": "Only reads",
+					"permissions": []interface{}{
+						map[string]interface{}{"action": "allow", "http": map[string]interface{}{"pathPrefix": "/", "methods": []interface{}{"GET"}}},
+						map[string]interface{}{"action": "deny", "http": map[string]interface{}{"pathPrefix": "/admin"}},
+					},
+				},
+			},
+			synced: "True",
+			messages: []string{
+				"Description: Only reads",
+				"Evaluated L7 permissions for POST /admin",
+				"  1. allow GET /*",
+				"* 2. deny /admin*",
+				"frontend is denied from connecting to backend",
+			},
+		},
+		"L7 permissions agree with Envoy": {
+			args:   []string{"-source", "web", "-destination", "backend", "-method", "POST", "-path", "/admin/users"},
+			values: map[string]interface{}{},
+			sources: []map[string]interface{}{
+				{
+					"name": "web",
+					"permissions": []interface{}{
+						map[string]interface{}{"action": "deny", "http": map[string]interface{}{"pathPrefix": "/admin", "methods": []interface{}{"POST", "DELETE"}}},
+					},
+				},
+			},
+			synced: "True",
+			messages: []string{
+				"web is denied from connecting to backend",
+				"envoy.filters.http.rbac denies POST /admin/users (matched policies consul-intentions-layer7-0), which agrees with the intentions",
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			buf := new(bytes.Buffer)
+			c := setupRunCommand(t, buf, tc.values, tc.sources, tc.synced)
+
+			out := c.Run(append(tc.args, "-namespace", "default"))
+			require.Equal(t, 0, out, buf.String())
+			for _, msg := range tc.messages {
+				require.Contains(t, buf.String(), msg)
+			}
+		})
+	}
+}
+
+func TestRunJSON(t *testing.T) {
+	buf := new(bytes.Buffer)
+	values := map[string]interface{}{"global": map[string]interface{}{"acls": map[string]interface{}{"manageSystemACLs": true}}}
+	c := setupRunCommand(t, buf, values, []map[string]interface{}{{"name": "frontend", "action": "allow"}}, "True")
+
+	out := c.Run([]string{"-source", "frontend-abc", "-destination", "backend", "-namespace", "default", "-output", "json"})
+	require.Equal(t, 0, out, buf.String())
+
+	var r result
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &r), buf.String())
+	defaultIdentity := func(name string) identity {
+		return identity{Name: name, Namespace: "default", Partition: "default"}
+	}
+	require.Equal(t, workloadResult{identity: defaultIdentity("frontend"), Pod: "default/frontend-abc"}, r.Source)
+	require.Equal(t, workloadResult{identity: defaultIdentity("backend")}, r.Destination)
+	require.True(t, r.Allowed)
+	require.Equal(t, "deny", r.DefaultPolicy)
+	require.Empty(t, r.Skipped)
+	require.Equal(t, &intentionResult{
+		Resource:    "default/backend",
+		Source:      defaultIdentity("frontend"),
+		Destination: defaultIdentity("backend"),
+		Precedence:  9,
+	}, r.Intention)
+	require.Equal(t, "default/backend-xyz", r.Envoy.Pod)
+	require.True(t, r.Envoy.RBACFilters)
+	require.Equal(t, []envoyVerdict{
+		{rbacVerdict: rbacVerdict{Filter: "envoy.filters.http.rbac", Allowed: true}, Agrees: true},
+		{rbacVerdict: rbacVerdict{Filter: "envoy.filters.network.rbac", Allowed: false}, Agrees: false},
+	}, r.Envoy.Verdicts)
+}
+
+func TestRunHelmError(t *testing.T) {
+	buf := new(bytes.Buffer)
+	c := setupCommand(buf)
+	c.helmActionsRunner = &helm.MockActionRunner{
+		CheckForInstallationsFunc: func(*helm.CheckForInstallationsOptions) (bool, string, string, error) {
+			return false, "", "", errors.New("couldn't find installation named 'consul'")
+		},
+	}
+	out := c.Run([]string{"-source", "frontend", "-destination", "backend"})
+	require.Equal(t, 1, out)
+	require.Contains(t, buf.String(), "Error running troubleshoot: couldn't find installation named 'consul'")
+}
+
+func TestNewMeshSettings(t *testing.T) {
+	cases := map[string]struct {
+		values   map[string]interface{}
+		expected meshSettings
+	}{
+		"Defaults": {
+			values: map[string]interface{}{},
+			expected: meshSettings{
+				destinationNamespace: "default",
+				mirroring:            true,
+				partition:            "default",
+				datacenter:           "dc1",
+				defaultAllow:         true,
+			},
+		},
+		"Namespaces, partitions and ACLs": {
+			values: map[string]interface{}{
+				"global": map[string]interface{}{
+					"datacenter":             "dc2",
+					"enableConsulNamespaces": true,
+					"adminPartitions":        map[string]interface{}{"enabled": true, "name": "ap1"},
+					"acls":                   map[string]interface{}{"manageSystemACLs": true},
+				},
+				"connectInject": map[string]interface{}{
+					"consulNamespaces": map[string]interface{}{
+						"consulDestinationNamespace": "mesh",
+						"mirroringK8S":               false,
+						"mirroringK8SPrefix":         "k8s-",
+					},
+				},
+			},
+			expected: meshSettings{
+				namespacesEnabled:    true,
+				destinationNamespace: "mesh",
+				mirroringPrefix:      "k8s-",
+				partition:            "ap1",
+				datacenter:           "dc2",
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, tc.expected, newMeshSettings(tc.values))
+		})
+	}
+}
+
+func TestConsulNamespace(t *testing.T) {
+	require.Equal(t, "default", meshSettings{}.consulNamespace("web"))
+	require.Equal(t, "k8s-web", meshSettings{namespacesEnabled: true, mirroring: true, mirroringPrefix: "k8s-"}.consulNamespace("web"))
+	require.Equal(t, "mesh", meshSettings{namespacesEnabled: true, destinationNamespace: "mesh"}.consulNamespace("web"))
+}
+
+func TestResolve(t *testing.T) {
+	settings := meshSettings{namespacesEnabled: true, mirroring: true, partition: "default"}
+	client := fake.NewSimpleClientset(
+		&v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "multiport-abc",
+				Namespace: "web",
+				Annotations: map[string]string{
+					annotationService:         "web, web-admin",
+					annotationConsulNamespace: "shared",
+				},
+			},
+		},
+		&v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "orphan", Namespace: "web"},
+		},
+	)
+
+	w, err := resolve(context.Background(), client, "multiport-abc", "web", settings)
+	require.NoError(t, err)
+	require.Equal(t, identity{Name: "web", Namespace: "shared", Partition: "default"}, w.identity)
+	require.NotNil(t, w.pod)
+
+	w, err = resolve(context.Background(), client, "api/backend", "web", settings)
+	require.NoError(t, err)
+	require.Equal(t, identity{Name: "backend", Namespace: "api", Partition: "default"}, w.identity)
+	require.Equal(t, "api", w.kubeNamespace)
+	require.Nil(t, w.pod)
+
+	_, err = resolve(context.Background(), client, "orphan", "web", settings)
+	require.EqualError(t, err, "pod web/orphan is not part of a service: it has no consul.hashicorp.com/connect-service annotation and no Kubernetes Service selects it")
+}
+
+func TestAdminPort(t *testing.T) {
+	pod := func(services string) *v1.Pod {
+		return &v1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{annotationService: services}}}
+	}
+	require.Equal(t, 19000, adminPort(pod("backend"), "backend"))
+	require.Equal(t, 19000, adminPort(pod(""), "backend"))
+	require.Equal(t, 19000, adminPort(pod("web, web-admin"), "web"))
+	require.Equal(t, 19001, adminPort(pod("web, web-admin"), "web-admin"))
+}
+
+func TestTaskCreateCommand_AutocompleteFlags(t *testing.T) {
+	t.Parallel()
+	cmd := setupCommand(new(bytes.Buffer))
+
+	predictor := cmd.AutocompleteFlags()
+
+	// Test that we get the expected number of predictions
+	args := complete.Args{Last: "-"}
+	res := predictor.Predict(args)
+
+	// Grab the list of flags from the Flag object
+	flags := make([]string, 0)
+	cmd.set.VisitSets(func(name string, set *cmnFlag.Set) {
+		set.VisitAll(func(flag *flag.Flag) {
+			flags = append(flags, fmt.Sprintf("-%s", flag.Name))
+		})
+	})
+
+	// Verify that there is a prediction for each flag associated with the command
+	require.Equal(t, len(flags), len(res))
+	require.ElementsMatch(t, flags, res, "flags and predictions didn't match, make sure to add "+
+		"new flags to the command AutoCompleteFlags function")
+}
+
+func setupCommand(buf io.Writer) *IntentionsCommand {
+	// Log at a test level to standard out.
+	log := hclog.New(&hclog.LoggerOptions{
+		Name:   "test",
+		Level:  hclog.Debug,
+		Output: os.Stdout,
+	})
+
+	// Setup and initialize the command struct
+	command := &IntentionsCommand{
+		BaseCommand: &common.BaseCommand{
+			Ctx: context.Background(),
+			Log: log,
+			UI:  terminal.NewUI(context.Background(), buf),
+		},
+		kubernetes:        fake.NewSimpleClientset(),
+		dynamic:           dynamicFake.NewSimpleDynamicClient(runtime.NewScheme()),
+		helmActionsRunner: &helm.MockActionRunner{},
+		restConfig:        &rest.Config{},
+	}
+	command.init()
+
+	return command
+}
+
+// setupRunCommand sets up a command with a frontend and backend pod, and a
+// ServiceIntentions resource for backend.
+func setupRunCommand(t *testing.T, buf io.Writer, values map[string]interface{}, sources []map[string]interface{}, synced string) *IntentionsCommand {
+	t.Helper()
+	c := setupCommand(buf)
+	c.kubernetes = fake.NewSimpleClientset(
+		&v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "frontend-abc", Namespace: "default", Labels: map[string]string{"app": "frontend"}},
+		},
+		&v1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "frontend", Namespace: "default"},
+			Spec:       v1.ServiceSpec{Selector: map[string]string{"app": "frontend"}},
+		},
+		&v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "backend-xyz",
+				Namespace:   "default",
+				Labels:      map[string]string{"consul.hashicorp.com/connect-inject-status": "injected"},
+				Annotations: map[string]string{annotationService: "backend"},
+			},
+			Status: v1.PodStatus{Phase: v1.PodRunning},
+		},
+	)
+	c.dynamic = fakeServiceIntentions(t, sources, synced)
+	c.helmActionsRunner = &helm.MockActionRunner{
+		GetStatusFunc: func(*action.Status, string) (*helmRelease.Release, error) {
+			return &helmRelease.Release{Config: values}, nil
+		},
+	}
+	c.fetchConfig = func(context.Context, common.PortForwarder) (*envoy.EnvoyConfig, error) {
+		return &envoy.EnvoyConfig{RawCfg: []byte(testConfigDump)}, nil
+	}
+	return c
+}
+
+// fakeServiceIntentions returns a dynamic client with a ServiceIntentions
+// resource for backend in the default namespace.
+func fakeServiceIntentions(t *testing.T, sources []map[string]interface{}, synced string) *dynamicFake.FakeDynamicClient {
+	t.Helper()
+	client := dynamicFake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{serviceIntentionsGVR: "ServiceIntentionsList"})
+
+	var sourceList []interface{}
+	for _, s := range sources {
+		sourceList = append(sourceList, s)
+	}
+	resource := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "consul.hashicorp.com/v1alpha1",
+		"kind":       "ServiceIntentions",
+		"metadata":   map[string]interface{}{"name": "backend", "namespace": "default"},
+		"spec": map[string]interface{}{
+			"destination": map[string]interface{}{"name": "backend"},
+			"sources":     sourceList,
+		},
+		"status": map[string]interface{}{
+			"conditions": []interface{}{map[string]interface{}{"type": "Synced", "status": synced}},
+		},
+	}}
+	_, err := client.Resource(serviceIntentionsGVR).Namespace("default").Create(context.Background(), resource, metav1.CreateOptions{})
+	require.NoError(t, err)
+	return client
+}
@@ -0,0 +1,350 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package intentions
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+const (
+	listenersConfigDumpType = "type.googleapis.com/envoy.admin.v3.ListenersConfigDump"
+	publicListenerPrefix    = "public_listener:"
+
+	filterNameNetworkRBAC  = "envoy.filters.network.rbac"
+	filterNameHTTPRBAC     = "envoy.filters.http.rbac"
+	filterNameHTTPConnMgr  = "envoy.filters.network.http_connection_manager"
+	rbacActionDeny         = "DENY"
+	placeholderTrustDomain = "11111111-2222-3333-4444-555555555555.consul"
+)
+
+// rbacFilter is an RBAC filter on the public listener of a sidecar proxy.
+type rbacFilter struct {
+	Name  string
+	Rules *rbacRules
+}
+
+type rbacRules struct {
+	Action   string
+	Policies map[string]rbacPolicy
+}
+
+type rbacPolicy struct {
+	Permissions []rbacPermission
+	Principals  []principal
+}
+
+// rbacPermission is an Envoy RBAC permission. Only the matchers that Consul
+// uses for L7 intentions are supported; any other permission never matches.
+type rbacPermission struct {
+	Any      bool
+	AndRules *permissionSet  `json:"and_rules"`
+	OrRules  *permissionSet  `json:"or_rules"`
+	NotRule  *rbacPermission `json:"not_rule"`
+	URLPath  *struct {
+		Path stringMatcher
+	} `json:"url_path"`
+	Header *headerMatcher
+}
+
+type permissionSet struct {
+	Rules []rbacPermission
+}
+
+// headerMatcher is an Envoy header matcher, with either the string_match or
+// the deprecated per-type fields that older versions of Consul generate.
+type headerMatcher struct {
+	Name           string
+	StringMatch    *stringMatcher `json:"string_match"`
+	ExactMatch     string         `json:"exact_match"`
+	PrefixMatch    string         `json:"prefix_match"`
+	SuffixMatch    string         `json:"suffix_match"`
+	SafeRegexMatch *struct {
+		Regex string
+	} `json:"safe_regex_match"`
+	PresentMatch bool `json:"present_match"`
+	InvertMatch  bool `json:"invert_match"`
+}
+
+// principal is an Envoy RBAC principal. Only the matchers that Consul uses for
+// intentions are supported.
+type principal struct {
+	Any           bool
+	Authenticated *struct {
+		PrincipalName stringMatcher `json:"principal_name"`
+	}
+	AndIDs *principalSet `json:"and_ids"`
+	OrIDs  *principalSet `json:"or_ids"`
+	NotID  *principal    `json:"not_id"`
+}
+
+type principalSet struct {
+	IDs []principal
+}
+
+type stringMatcher struct {
+	Exact     string
+	Prefix    string
+	Suffix    string
+	SafeRegex *struct {
+		Regex string
+	} `json:"safe_regex"`
+}
+
+// rbacVerdict is the outcome of evaluating an RBAC filter for a principal.
+type rbacVerdict struct {
+	Filter  string `json:"filter"`
+	Allowed bool   `json:"allowed"`
+	// Policies are the names of the policies whose principals matched.
+	Policies []string `json:"policies,omitempty"`
+	// L7 is true if a policy whose principals matched has L7 permissions, in
+	// which case the outcome depends on the request that was evaluated.
+	L7 bool `json:"l7"`
+}
+
+// parseRBACFilters returns the RBAC filters of the public listener in an Envoy
+// config dump.
+func parseRBACFilters(configDump []byte) ([]rbacFilter, error) {
+	var dump struct {
+		Configs []json.RawMessage
+	}
+	if err := json.Unmarshal(configDump, &dump); err != nil {
+		return nil, fmt.Errorf("error parsing the Envoy config dump: %w", err)
+	}
+
+	type filter struct {
+		Name        string
+		TypedConfig json.RawMessage `json:"typed_config"`
+	}
+	var filters []rbacFilter
+	for _, raw := range dump.Configs {
+		var listeners struct {
+			Type             string `json:"@type"`
+			DynamicListeners []struct {
+				ActiveState struct {
+					Listener struct {
+						Name         string
+						FilterChains []struct {
+							Filters []filter
+						} `json:"filter_chains"`
+					}
+				} `json:"active_state"`
+			} `json:"dynamic_listeners"`
+		}
+		if err := json.Unmarshal(raw, &listeners); err != nil {
+			return nil, fmt.Errorf("error parsing the Envoy config dump: %w", err)
+		}
+		if listeners.Type != listenersConfigDumpType {
+			continue
+		}
+
+		for _, l := range listeners.DynamicListeners {
+			listener := l.ActiveState.Listener
+			if !strings.HasPrefix(listener.Name, publicListenerPrefix) {
+				continue
+			}
+			for _, chain := range listener.FilterChains {
+				for _, f := range chain.Filters {
+					switch f.Name {
+					case filterNameNetworkRBAC:
+						var rbac rbacFilter
+						if err := json.Unmarshal(f.TypedConfig, &rbac); err != nil {
+							return nil, fmt.Errorf("error parsing %s: %w", f.Name, err)
+						}
+						rbac.Name = f.Name
+						filters = append(filters, rbac)
+					case filterNameHTTPConnMgr:
+						var hcm struct {
+							HTTPFilters []filter `json:"http_filters"`
+						}
+						if err := json.Unmarshal(f.TypedConfig, &hcm); err != nil {
+							return nil, fmt.Errorf("error parsing %s: %w", f.Name, err)
+						}
+						for _, hf := range hcm.HTTPFilters {
+							if hf.Name != filterNameHTTPRBAC {
+								continue
+							}
+							var rbac rbacFilter
+							if err := json.Unmarshal(hf.TypedConfig, &rbac); err != nil {
+								return nil, fmt.Errorf("error parsing %s: %w", hf.Name, err)
+							}
+							rbac.Name = hf.Name
+							filters = append(filters, rbac)
+						}
+					}
+				}
+			}
+		}
+	}
+	return filters, nil
+}
+
+// evaluate returns whether the filter allows the request from the principal.
+// A policy matches if any of its principals and any of its permissions match.
+// Filters without rules allow everything.
+func (f rbacFilter) evaluate(principalName string, req request) rbacVerdict {
+	v := rbacVerdict{Filter: f.Name, Allowed: true}
+	if f.Rules == nil {
+		return v
+	}
+	for name, policy := range f.Rules.Policies {
+		var principalMatched bool
+		for _, p := range policy.Principals {
+			if p.matches(principalName) {
+				principalMatched = true
+				break
+			}
+		}
+		if !principalMatched {
+			continue
+		}
+		if !anyPermission(policy.Permissions) {
+			v.L7 = true
+		}
+		for _, perm := range policy.Permissions {
+			if perm.matches(req) {
+				v.Policies = append(v.Policies, name)
+				break
+			}
+		}
+	}
+	sort.Strings(v.Policies)
+
+	matched := len(v.Policies) > 0
+	if f.Rules.Action == rbacActionDeny {
+		v.Allowed = !matched
+	} else {
+		// ALLOW is the default action.
+		v.Allowed = matched
+	}
+	return v
+}
+
+// anyPermission returns whether the permissions match every request.
+func anyPermission(permissions []rbacPermission) bool {
+	for _, p := range permissions {
+		if p.Any {
+			return true
+		}
+	}
+	return false
+}
+
+func (p rbacPermission) matches(req request) bool {
+	switch {
+	case p.Any:
+		return true
+	case p.AndRules != nil:
+		for _, rule := range p.AndRules.Rules {
+			if !rule.matches(req) {
+				return false
+			}
+		}
+		return true
+	case p.OrRules != nil:
+		for _, rule := range p.OrRules.Rules {
+			if rule.matches(req) {
+				return true
+			}
+		}
+		return false
+	case p.NotRule != nil:
+		return !p.NotRule.matches(req)
+	case p.URLPath != nil:
+		// Envoy matches the path without the query string.
+		path, _, _ := strings.Cut(req.Path, "?")
+		return p.URLPath.Path.matches(path)
+	case p.Header != nil:
+		return p.Header.matches(req)
+	}
+	return false
+}
+
+// matches returns whether the request's header matches, the same way as
+// headerMatch does for intentions. The :method and :path pseudo-headers are
+// taken from the request.
+func (h headerMatcher) matches(req request) bool {
+	var value string
+	var present bool
+	switch strings.ToLower(h.Name) {
+	case ":method":
+		value, present = req.Method, true
+	case ":path":
+		value, present = req.Path, true
+	default:
+		var values []string
+		values, present = req.Headers[http.CanonicalHeaderKey(h.Name)]
+		value = strings.Join(values, ",")
+	}
+
+	var matched bool
+	switch {
+	case h.StringMatch != nil:
+		matched = present && h.StringMatch.matches(value)
+	case h.ExactMatch != "":
+		matched = present && value == h.ExactMatch
+	case h.PrefixMatch != "":
+		matched = present && strings.HasPrefix(value, h.PrefixMatch)
+	case h.SuffixMatch != "":
+		matched = present && strings.HasSuffix(value, h.SuffixMatch)
+	case h.SafeRegexMatch != nil:
+		matched = present && fullMatch(h.SafeRegexMatch.Regex, value)
+	default:
+		matched = present
+	}
+	return matched != h.InvertMatch
+}
+
+func (p principal) matches(name string) bool {
+	switch {
+	case p.Any:
+		return true
+	case p.Authenticated != nil:
+		return p.Authenticated.PrincipalName.matches(name)
+	case p.AndIDs != nil:
+		for _, id := range p.AndIDs.IDs {
+			if !id.matches(name) {
+				return false
+			}
+		}
+		return true
+	case p.OrIDs != nil:
+		for _, id := range p.OrIDs.IDs {
+			if id.matches(name) {
+				return true
+			}
+		}
+		return false
+	case p.NotID != nil:
+		return !p.NotID.matches(name)
+	}
+	return false
+}
+
+func (m stringMatcher) matches(s string) bool {
+	switch {
+	case m.Exact != "":
+		return s == m.Exact
+	case m.Prefix != "":
+		return strings.HasPrefix(s, m.Prefix)
+	case m.Suffix != "":
+		return strings.HasSuffix(s, m.Suffix)
+	case m.SafeRegex != nil:
+		return fullMatch(m.SafeRegex.Regex, s)
+	}
+	return false
+}
+
+// spiffeID returns the SPIFFE ID that a service presents in its certificate.
+// Consul's principals match any trust domain, so a placeholder is used.
+func spiffeID(id identity, datacenter string) string {
+	path := fmt.Sprintf("/ns/%s/dc/%s/svc/%s", id.Namespace, datacenter, id.Name)
+	if id.Partition != "" && id.Partition != defaultPartition {
+		path = fmt.Sprintf("/ap/%s%s", id.Partition, path)
+	}
+	return fmt.Sprintf("spiffe://%s%s", placeholderTrustDomain, path)
+}
@@ -0,0 +1,223 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package intentions
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testConfigDump has an HTTP RBAC filter denying client, and web from writing
+// to /admin unless it's the admin user, and a network RBAC filter allowing
+// every service in the web namespace except admin.
+const testConfigDump = `{
+  "configs": [
+    {"@type": "type.googleapis.com/envoy.admin.v3.BootstrapConfigDump"},
+    {
+      "@type": "type.googleapis.com/envoy.admin.v3.ListenersConfigDump",
+      "dynamic_listeners": [
+        {
+          "name": "public_listener:10.0.0.1:20000",
+          "active_state": {
+            "listener": {
+              "name": "public_listener:10.0.0.1:20000",
+              "filter_chains": [
+                {
+                  "filters": [
+                    {
+                      "name": "envoy.filters.network.http_connection_manager",
+                      "typed_config": {
+                        "http_filters": [
+                          {
+                            "name": "envoy.filters.http.rbac",
+                            "typed_config": {
+                              "rules": {
+                                "action": "DENY",
+                                "policies": {
+                                  "consul-intentions-layer4": {
+                                    "permissions": [{"any": true}],
+                                    "principals": [
+                                      {"authenticated": {"principal_name": {"safe_regex": {"google_re2": {}, "regex": "^spiffe://[^/]+/ns/default/dc/[^/]+/svc/client$"}}}}
+                                    ]
+                                  },
+                                  "consul-intentions-layer7-0": {
+                                    "permissions": [
+                                      {
+                                        "and_rules": {
+                                          "rules": [
+                                            {"url_path": {"path": {"prefix": "/admin"}}},
+                                            {"header": {"name": ":method", "safe_regex_match": {"regex": "POST|DELETE"}}},
+                                            {"not_rule": {"header": {"name": "x-user", "string_match": {"exact": "admin"}}}}
+                                          ]
+                                        }
+                                      }
+                                    ],
+                                    "principals": [
+                                      {"authenticated": {"principal_name": {"safe_regex": {"regex": "^spiffe://[^/]+/ns/default/dc/[^/]+/svc/web$"}}}}
+                                    ]
+                                  }
+                                }
+                              }
+                            }
+                          },
+                          {"name": "envoy.filters.http.router"}
+                        ]
+                      }
+                    }
+                  ]
+                }
+              ]
+            }
+          }
+        },
+        {
+          "name": "public_listener:10.0.0.1:21000",
+          "active_state": {
+            "listener": {
+              "name": "public_listener:10.0.0.1:21000",
+              "filter_chains": [
+                {
+                  "filters": [
+                    {
+                      "name": "envoy.filters.network.rbac",
+                      "typed_config": {
+                        "rules": {
+                          "policies": {
+                            "consul-intentions-layer4": {
+                              "permissions": [{"any": true}],
+                              "principals": [
+                                {
+                                  "and_ids": {
+                                    "ids": [
+                                      {"authenticated": {"principal_name": {"safe_regex": {"regex": "^spiffe://[^/]+/ns/web/dc/[^/]+/svc/[^/]+$"}}}},
+                                      {"not_id": {"authenticated": {"principal_name": {"safe_regex": {"regex": "^spiffe://[^/]+/ns/web/dc/[^/]+/svc/admin$"}}}}}
+                                    ]
+                                  }
+                                }
+                              ]
+                            }
+                          }
+                        }
+                      }
+                    },
+                    {"name": "envoy.filters.network.tcp_proxy"}
+                  ]
+                }
+              ]
+            }
+          }
+        },
+        {
+          "name": "outbound_listener:127.0.0.1:15001",
+          "active_state": {
+            "listener": {
+              "name": "outbound_listener:127.0.0.1:15001",
+              "filter_chains": [{"filters": [{"name": "envoy.filters.network.rbac", "typed_config": {}}]}]
+            }
+          }
+        }
+      ]
+    }
+  ]
+}`
+
+func TestParseRBACFilters(t *testing.T) {
+	filters, err := parseRBACFilters([]byte(testConfigDump))
+	require.NoError(t, err)
+	require.Len(t, filters, 2)
+	require.Equal(t, filterNameHTTPRBAC, filters[0].Name)
+	require.Equal(t, "DENY", filters[0].Rules.Action)
+	require.Len(t, filters[0].Rules.Policies, 2)
+	require.Equal(t, filterNameNetworkRBAC, filters[1].Name)
+
+	_, err = parseRBACFilters([]byte("not json"))
+	require.Error(t, err)
+}
+
+func TestRBACFilterEvaluate(t *testing.T) {
+	filters, err := parseRBACFilters([]byte(testConfigDump))
+	require.NoError(t, err)
+	httpRBAC, networkRBAC := filters[0], filters[1]
+
+	cases := map[string]struct {
+		filter   rbacFilter
+		id       identity
+		req      request
+		expected rbacVerdict
+	}{
+		"HTTP deny policy matches": {
+			filter:   httpRBAC,
+			id:       identity{Name: "client", Namespace: "default"},
+			expected: rbacVerdict{Filter: filterNameHTTPRBAC, Policies: []string{"consul-intentions-layer4"}},
+		},
+		"HTTP deny policy doesn't match": {
+			filter:   httpRBAC,
+			id:       identity{Name: "other", Namespace: "default"},
+			expected: rbacVerdict{Filter: filterNameHTTPRBAC, Allowed: true},
+		},
+		"HTTP L7 policy matches the request": {
+			filter:   httpRBAC,
+			id:       identity{Name: "web", Namespace: "default"},
+			req:      request{Method: "POST", Path: "/admin/users?id=1"},
+			expected: rbacVerdict{Filter: filterNameHTTPRBAC, Policies: []string{"consul-intentions-layer7-0"}, L7: true},
+		},
+		"HTTP L7 policy doesn't match the method": {
+			filter:   httpRBAC,
+			id:       identity{Name: "web", Namespace: "default"},
+			req:      request{Method: "GET", Path: "/admin/users"},
+			expected: rbacVerdict{Filter: filterNameHTTPRBAC, Allowed: true, L7: true},
+		},
+		"HTTP L7 policy doesn't match the path": {
+			filter:   httpRBAC,
+			id:       identity{Name: "web", Namespace: "default"},
+			req:      request{Method: "POST", Path: "/api"},
+			expected: rbacVerdict{Filter: filterNameHTTPRBAC, Allowed: true, L7: true},
+		},
+		"HTTP L7 policy excludes the header": {
+			filter:   httpRBAC,
+			id:       identity{Name: "web", Namespace: "default"},
+			req:      request{Method: "DELETE", Path: "/admin", Headers: http.Header{"X-User": []string{"admin"}}},
+			expected: rbacVerdict{Filter: filterNameHTTPRBAC, Allowed: true, L7: true},
+		},
+		"Network allow policy with exclusion matches": {
+			filter:   networkRBAC,
+			id:       identity{Name: "frontend", Namespace: "web"},
+			expected: rbacVerdict{Filter: filterNameNetworkRBAC, Allowed: true, Policies: []string{"consul-intentions-layer4"}},
+		},
+		"Network allow policy excludes service": {
+			filter:   networkRBAC,
+			id:       identity{Name: "admin", Namespace: "web"},
+			expected: rbacVerdict{Filter: filterNameNetworkRBAC},
+		},
+		"Network allow policy in another partition": {
+			filter:   networkRBAC,
+			id:       identity{Name: "frontend", Namespace: "web", Partition: "ap1"},
+			expected: rbacVerdict{Filter: filterNameNetworkRBAC},
+		},
+		"No rules": {
+			filter:   rbacFilter{Name: "none"},
+			id:       identity{Name: "frontend", Namespace: "web"},
+			expected: rbacVerdict{Filter: "none", Allowed: true},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			req := tc.req
+			if req.Method == "" {
+				req = request{Method: "GET", Path: "/"}
+			}
+			require.Equal(t, tc.expected, tc.filter.evaluate(spiffeID(tc.id, "dc1"), req))
+		})
+	}
+}
+
+func TestSpiffeID(t *testing.T) {
+	require.Equal(t, "spiffe://11111111-2222-3333-4444-555555555555.consul/ns/web/dc/dc1/svc/frontend",
+		spiffeID(identity{Name: "frontend", Namespace: "web", Partition: "default"}, "dc1"))
+	require.Equal(t, "spiffe://11111111-2222-3333-4444-555555555555.consul/ap/ap1/ns/web/dc/dc2/svc/frontend",
+		spiffeID(identity{Name: "frontend", Namespace: "web", Partition: "ap1"}, "dc2"))
+}
@@ -0,0 +1,119 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package intentions
+
+import "fmt"
+
+// result is the outcome of troubleshooting the intentions between a source and
+// destination, for structured output.
+type result struct {
+	Source      workloadResult `json:"source"`
+	Destination workloadResult `json:"destination"`
+	Request     request        `json:"request"`
+	Allowed     bool           `json:"allowed"`
+	// Intention is nil if no intention matched and the default policy applies.
+	Intention *intentionResult `json:"intention"`
+	// DefaultPolicy is "allow" or "deny".
+	DefaultPolicy string `json:"defaultPolicy"`
+	// Skipped are the ServiceIntentions, as namespace/name, that matched but
+	// haven't been synced to Consul.
+	Skipped []string   `json:"skipped"`
+	Envoy   envoyCheck `json:"envoy"`
+}
+
+// workloadResult is the Consul identity of a source or destination.
+type workloadResult struct {
+	identity
+	// Pod is set, as namespace/name, if the workload was given as a pod.
+	Pod string `json:"pod,omitempty"`
+}
+
+// intentionResult is the intention that decided the connection.
+type intentionResult struct {
+	// Resource is the ServiceIntentions resource as namespace/name.
+	Resource    string             `json:"resource"`
+	Source      identity           `json:"source"`
+	Destination identity           `json:"destination"`
+	Precedence  int                `json:"precedence"`
+	Description string             `json:"description,omitempty"`
+	Permissions []permissionResult `json:"permissions,omitempty"`
+}
+
+// permissionResult is an L7 permission of the matched intention.
+type permissionResult struct {
+	Action string `json:"action"`
+	Match  string `json:"match"`
+	// Matched is true for the permission that decided the request.
+	Matched bool `json:"matched"`
+}
+
+// envoyCheck is the result of cross-checking the decision against the RBAC
+// filters of a destination pod's proxy.
+type envoyCheck struct {
+	// Pod is the destination pod that was checked, as namespace/name. It is
+	// empty if no running pod with a proxy was found.
+	Pod       string `json:"pod,omitempty"`
+	Principal string `json:"principal,omitempty"`
+	// RBACFilters is false if the public listener has no RBAC filters, in
+	// which case all connections are allowed.
+	RBACFilters bool           `json:"rbacFilters"`
+	Verdicts    []envoyVerdict `json:"verdicts"`
+}
+
+// envoyVerdict is the verdict of an RBAC filter.
+type envoyVerdict struct {
+	rbacVerdict
+	// Agrees is true if the filter decides the request the same way as the
+	// intentions. L7 permissions are evaluated for the same request.
+	Agrees bool `json:"agrees"`
+}
+
+// newResult collects the decision for the source and destination.
+func newResult(src, dst workload, req request, d decision, settings meshSettings) result {
+	r := result{
+		Source:        newWorkloadResult(src),
+		Destination:   newWorkloadResult(dst),
+		Request:       req,
+		Allowed:       d.Allowed,
+		DefaultPolicy: "deny",
+		Skipped:       []string{},
+		Envoy:         envoyCheck{Verdicts: []envoyVerdict{}},
+	}
+	if settings.defaultAllow {
+		r.DefaultPolicy = "allow"
+	}
+	for _, resource := range d.Skipped {
+		r.Skipped = append(r.Skipped, fmt.Sprintf("%s/%s", resource.Metadata.Namespace, resource.Metadata.Name))
+	}
+
+	if d.Source != nil {
+		r.Intention = &intentionResult{
+			Resource: fmt.Sprintf("%s/%s", d.Intention.Metadata.Namespace, d.Intention.Metadata.Name),
+			Source: identity{
+				Name:      d.Source.Name,
+				Namespace: orDefault(d.Source.Namespace, d.Destination.Namespace),
+				Partition: orDefault(d.Source.Partition, d.Destination.Partition),
+			},
+			Destination: d.Destination,
+			Precedence:  d.Precedence,
+			Description: d.Source.Description,
+		}
+		for i, perm := range d.Source.Permissions {
+			r.Intention.Permissions = append(r.Intention.Permissions, permissionResult{
+				Action:  perm.Action,
+				Match:   describePermission(perm),
+				Matched: i == d.Permission,
+			})
+		}
+	}
+	return r
+}
+
+func newWorkloadResult(w workload) workloadResult {
+	r := workloadResult{identity: w.identity}
+	if w.pod != nil {
+		r.Pod = fmt.Sprintf("%s/%s", w.pod.Namespace, w.pod.Name)
+	}
+	return r
+}
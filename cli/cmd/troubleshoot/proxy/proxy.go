@@ -13,6 +13,7 @@ import (
 	"github.com/hashicorp/consul-k8s/cli/common/flag"
 	"github.com/hashicorp/consul-k8s/cli/common/terminal"
 	troubleshoot "github.com/hashicorp/consul/troubleshoot/proxy"
+	"github.com/hashicorp/consul/troubleshoot/validate"
 	"github.com/posener/complete"
 	helmCLI "helm.sh/helm/v3/pkg/cli"
 	"k8s.io/apimachinery/pkg/api/validation"
@@ -28,6 +29,7 @@ const (
 	flagNamePod                 = "pod"
 	flagNameUpstreamEnvoyID     = "upstream-envoy-id"
 	flagNameUpstreamIP          = "upstream-ip"
+	flagNameOutput              = "output"
 	DebugColor                  = "\033[0;36m%s\033[0m"
 )
 
@@ -45,6 +47,7 @@ type ProxyCommand struct {
 	flagPod             string
 	flagUpstreamEnvoyID string
 	flagUpstreamIP      string
+	flagOutput          string
 
 	restConfig *rest.Config
 
@@ -78,6 +81,14 @@ func (c *ProxyCommand) init() {
 		Aliases: []string{"ip"},
 	})
 
+	f.StringVar(&flag.StringVar{
+		Name:    flagNameOutput,
+		Target:  &c.flagOutput,
+		Default: terminal.FormatTable,
+		Usage:   terminal.OutputUsage("the validation results"),
+		Aliases: []string{"o"},
+	})
+
 	f = c.set.NewSet("Global Options")
 	f.StringVar(&flag.StringVar{
 		Name:    flagNameKubeConfig,
@@ -151,7 +162,7 @@ func (c *ProxyCommand) validateFlags() error {
 		return fmt.Errorf("invalid namespace name passed for -namespace/-n: %v", strings.Join(errs, "; "))
 	}
 
-	return nil
+	return terminal.ValidateFormat(c.flagOutput)
 }
 
 // initKubernetes initializes the Kubernetes client.
@@ -225,19 +236,36 @@ func (c *ProxyCommand) Troubleshoot() error {
 		return err
 	}
 
-	c.UI.Output("Validation", terminal.WithHeaderStyle())
-	for _, o := range messages {
-		if o.Success {
-			c.UI.Output(o.Message, terminal.WithSuccessStyle())
-		} else {
-			c.UI.Output(o.Message, terminal.WithErrorStyle())
-			for _, action := range o.PossibleActions {
-				c.UI.Output(fmt.Sprintf("-> %s", action), terminal.WithInfoStyle())
-			}
-		}
+	return c.output(messages)
+}
+
+// message is the result of a validation of the proxy.
+type message struct {
+	Success         bool     `json:"success"`
+	Message         string   `json:"message"`
+	PossibleActions []string `json:"possibleActions,omitempty"`
+}
+
+// output prints the validation messages in the format set by -output.
+func (c *ProxyCommand) output(messages validate.Messages) error {
+	result := make([]message, 0, len(messages))
+	for _, m := range messages {
+		result = append(result, message{Success: m.Success, Message: m.Message, PossibleActions: m.PossibleActions})
 	}
 
-	return nil
+	return terminal.Render(c.UI, c.flagOutput, result, func() {
+		c.UI.Output("Validation", terminal.WithHeaderStyle())
+		for _, o := range result {
+			if o.Success {
+				c.UI.Output(o.Message, terminal.WithSuccessStyle())
+			} else {
+				c.UI.Output(o.Message, terminal.WithErrorStyle())
+				for _, action := range o.PossibleActions {
+					c.UI.Output(fmt.Sprintf("-> %s", action), terminal.WithInfoStyle())
+				}
+			}
+		}
+	})
 }
 
 // AutocompleteFlags returns a mapping of supported flags and autocomplete
@@ -246,6 +274,7 @@ func (c *ProxyCommand) Troubleshoot() error {
 func (c *ProxyCommand) AutocompleteFlags() complete.Flags {
 	return complete.Flags{
 		fmt.Sprintf("-%s", flagNameNamespace):   complete.PredictNothing,
+		fmt.Sprintf("-%s", flagNameOutput):      complete.PredictSet(terminal.Formats...),
 		fmt.Sprintf("-%s", flagNameKubeConfig):  complete.PredictFiles("*"),
 		fmt.Sprintf("-%s", flagNameKubeContext): complete.PredictNothing,
 	}
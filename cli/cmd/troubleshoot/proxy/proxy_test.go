@@ -6,12 +6,14 @@ package proxy
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"io"
 	"os"
 	"testing"
 
 	"github.com/hashicorp/consul-k8s/cli/common"
 	"github.com/hashicorp/consul-k8s/cli/common/terminal"
+	"github.com/hashicorp/consul/troubleshoot/validate"
 	"github.com/hashicorp/go-hclog"
 	"github.com/stretchr/testify/require"
 	"k8s.io/client-go/kubernetes/fake"
@@ -42,6 +44,10 @@ func TestFlagParsing(t *testing.T) {
 			args: []string{"-upstream-envoy-id", "-upstream-ip"},
 			out:  1,
 		},
+		"Invalid output passed, -output xml, should fail": {
+			args: []string{"-pod", "pod1", "-upstream-envoy-id", "1234", "-output", "xml"},
+			out:  1,
+		},
 	}
 
 	for name, tc := range cases {
@@ -54,6 +60,43 @@ func TestFlagParsing(t *testing.T) {
 	}
 }
 
+func TestOutput(t *testing.T) {
+	messages := validate.Messages{
+		{Success: true, Message: "listener for upstream \"backend\" found"},
+		{Message: "no healthy endpoints for cluster \"backend\"", PossibleActions: []string{"check that your upstream service is healthy and running"}},
+	}
+
+	t.Run("table", func(t *testing.T) {
+		buf := new(bytes.Buffer)
+		c := setupCommand(buf)
+		require.NoError(t, c.output(messages))
+		require.Contains(t, buf.String(), "Validation")
+		require.Contains(t, buf.String(), "-> check that your upstream service is healthy and running")
+	})
+
+	t.Run("json", func(t *testing.T) {
+		buf := new(bytes.Buffer)
+		c := setupCommand(buf)
+		c.flagOutput = terminal.FormatJSON
+		require.NoError(t, c.output(messages))
+
+		var actual []message
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &actual))
+		require.Equal(t, []message{
+			{Success: true, Message: "listener for upstream \"backend\" found"},
+			{Message: "no healthy endpoints for cluster \"backend\"", PossibleActions: []string{"check that your upstream service is healthy and running"}},
+		}, actual)
+	})
+
+	t.Run("template", func(t *testing.T) {
+		buf := new(bytes.Buffer)
+		c := setupCommand(buf)
+		c.flagOutput = "template={{range .}}{{.success}}\n{{end}}"
+		require.NoError(t, c.output(messages))
+		require.Equal(t, "true\nfalse\n", buf.String())
+	})
+}
+
 func setupCommand(buf io.Writer) *ProxyCommand {
 	// Log at a test level to standard out.
 	log := hclog.New(&hclog.LoggerOptions{
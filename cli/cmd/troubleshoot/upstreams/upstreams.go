@@ -28,6 +28,7 @@ const (
 	flagNameKubeContext     = "context"
 	flagNameNamespace       = "namespace"
 	flagNamePod             = "pod"
+	flagNameOutput          = "output"
 )
 
 type UpstreamsCommand struct {
@@ -41,7 +42,8 @@ type UpstreamsCommand struct {
 	flagKubeContext string
 	flagNamespace   string
 
-	flagPod string
+	flagPod    string
+	flagOutput string
 
 	restConfig *rest.Config
 
@@ -61,6 +63,14 @@ func (c *UpstreamsCommand) init() {
 		Aliases: []string{"p"},
 	})
 
+	f.StringVar(&flag.StringVar{
+		Name:    flagNameOutput,
+		Target:  &c.flagOutput,
+		Default: terminal.FormatTable,
+		Usage:   terminal.OutputUsage("the upstreams"),
+		Aliases: []string{"o"},
+	})
+
 	f = c.set.NewSet("Global Options")
 	f.StringVar(&flag.StringVar{
 		Name:    flagNameKubeConfig,
@@ -130,7 +140,7 @@ func (c *UpstreamsCommand) validateFlags() error {
 		return fmt.Errorf("invalid namespace name passed for -namespace/-n: %v", strings.Join(errs, "; "))
 	}
 
-	return nil
+	return terminal.ValidateFormat(c.flagOutput)
 }
 
 // initKubernetes initializes the Kubernetes client.
@@ -199,6 +209,41 @@ func (c *UpstreamsCommand) Troubleshoot() error {
 		return fmt.Errorf("error getting upstreams: %v", err)
 	}
 
+	return c.output(envoyIDs, upstreamIPs)
+}
+
+// upstreams are the upstreams of a proxy.
+type upstreams struct {
+	EnvoyIDs    []string     `json:"envoyIDs"`
+	UpstreamIPs []upstreamIP `json:"upstreamIPs"`
+}
+
+// upstreamIP is an upstream of a transparent proxy.
+type upstreamIP struct {
+	IPs          []string `json:"ips"`
+	Virtual      bool     `json:"virtual"`
+	ClusterNames []string `json:"clusterNames"`
+}
+
+// output prints the upstreams in the format set by -output.
+func (c *UpstreamsCommand) output(envoyIDs []string, upstreamIPs []troubleshoot.UpstreamIP) error {
+	result := upstreams{EnvoyIDs: envoyIDs, UpstreamIPs: make([]upstreamIP, 0, len(upstreamIPs))}
+	if result.EnvoyIDs == nil {
+		result.EnvoyIDs = []string{}
+	}
+	for _, u := range upstreamIPs {
+		result.UpstreamIPs = append(result.UpstreamIPs, upstreamIP{
+			IPs:          u.IPs,
+			Virtual:      u.IsVirtual,
+			ClusterNames: clusterNames(u.ClusterNames),
+		})
+	}
+
+	return terminal.Render(c.UI, c.flagOutput, result, func() { c.outputTable(envoyIDs, upstreamIPs) })
+}
+
+// outputTable prints the upstreams and hints for finding a missing upstream.
+func (c *UpstreamsCommand) outputTable(envoyIDs []string, upstreamIPs []troubleshoot.UpstreamIP) {
 	c.UI.Output(fmt.Sprintf("Upstreams (explicit upstreams only) (%v)", len(envoyIDs)), terminal.WithHeaderStyle())
 	for _, e := range envoyIDs {
 		c.UI.Output(e)
@@ -217,8 +262,6 @@ func (c *UpstreamsCommand) Troubleshoot() error {
 	c.UI.Output("-> To check that the right cluster is being dialed, run a DNS lookup "+
 		"for the upstream you are dialing. For example, run `dig backend.svc.consul` to return the IP address for the `backend` service. If the address you get from that is missing "+
 		"from the upstream IPs, it means that your proxy may be misconfigured.", terminal.WithInfoStyle())
-
-	return nil
 }
 
 // AutocompleteFlags returns a mapping of supported flags and autocomplete
@@ -227,6 +270,7 @@ func (c *UpstreamsCommand) Troubleshoot() error {
 func (c *UpstreamsCommand) AutocompleteFlags() complete.Flags {
 	return complete.Flags{
 		fmt.Sprintf("-%s", flagNameNamespace):   complete.PredictNothing,
+		fmt.Sprintf("-%s", flagNameOutput):      complete.PredictSet(terminal.Formats...),
 		fmt.Sprintf("-%s", flagNameKubeConfig):  complete.PredictFiles("*"),
 		fmt.Sprintf("-%s", flagNameKubeContext): complete.PredictNothing,
 	}
@@ -252,12 +296,17 @@ func formatIPs(ips []string) string {
 }
 
 func formatClusterNames(names map[string]struct{}) string {
-	var out []string
+	return strings.Join(clusterNames(names), ", ")
+}
+
+// clusterNames returns the names of the clusters in sorted order.
+func clusterNames(names map[string]struct{}) []string {
+	out := make([]string, 0, len(names))
 	for k := range names {
 		out = append(out, k)
 	}
 	sort.Strings(out)
-	return strings.Join(out, ", ")
+	return out
 }
 
 const (
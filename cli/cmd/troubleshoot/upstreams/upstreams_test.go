@@ -6,12 +6,14 @@ package upstreams
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"io"
 	"os"
 	"testing"
 
 	"github.com/hashicorp/consul-k8s/cli/common"
 	"github.com/hashicorp/consul-k8s/cli/common/terminal"
+	troubleshoot "github.com/hashicorp/consul/troubleshoot/proxy"
 	"github.com/hashicorp/go-hclog"
 	"github.com/stretchr/testify/require"
 	"k8s.io/client-go/kubernetes/fake"
@@ -34,6 +36,10 @@ func TestFlagParsing(t *testing.T) {
 			args: []string{"-namespace", "notaname"},
 			out:  1,
 		},
+		"Invalid output passed, -output xml, should fail": {
+			args: []string{"-pod", "pod1", "-output", "xml"},
+			out:  1,
+		},
 	}
 
 	for name, tc := range cases {
@@ -46,6 +52,30 @@ func TestFlagParsing(t *testing.T) {
 	}
 }
 
+func TestOutputJSON(t *testing.T) {
+	buf := new(bytes.Buffer)
+	c := setupCommand(buf)
+	c.flagOutput = terminal.FormatJSON
+
+	err := c.output(nil, []troubleshoot.UpstreamIP{
+		{
+			IPs:          []string{"10.0.0.1"},
+			IsVirtual:    true,
+			ClusterNames: map[string]struct{}{"backend2": {}, "backend1": {}},
+		},
+	})
+	require.NoError(t, err)
+
+	var actual upstreams
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &actual))
+	require.Equal(t, upstreams{
+		EnvoyIDs: []string{},
+		UpstreamIPs: []upstreamIP{
+			{IPs: []string{"10.0.0.1"}, Virtual: true, ClusterNames: []string{"backend1", "backend2"}},
+		},
+	}, actual)
+}
+
 func TestFormatIPs(t *testing.T) {
 	t.Parallel()
 
@@ -4,29 +4,96 @@
 package version
 
 import (
+	"fmt"
+	"sync"
+
 	"github.com/hashicorp/consul-k8s/cli/common"
+	"github.com/hashicorp/consul-k8s/cli/common/flag"
 	"github.com/hashicorp/consul-k8s/cli/common/terminal"
+	"github.com/posener/complete"
 )
 
+const flagNameOutput = "output"
+
 type Command struct {
 	*common.BaseCommand
 
 	// Version is the Consul on Kubernetes CLI version.
 	Version string
+
+	set *flag.Sets
+
+	flagOutput string
+
+	once sync.Once
+	help string
+}
+
+// versionInfo is the output of the command.
+type versionInfo struct {
+	Version string `json:"version"`
+}
+
+func (c *Command) init() {
+	c.set = flag.NewSets()
+	f := c.set.NewSet("Command Options")
+	f.StringVar(&flag.StringVar{
+		Name:    flagNameOutput,
+		Target:  &c.flagOutput,
+		Default: terminal.FormatTable,
+		Usage:   terminal.OutputUsage("the version"),
+		Aliases: []string{"o"},
+	})
+
+	c.help = c.set.Help()
 }
 
 // Run prints the version of the Consul on Kubernetes CLI.
-func (c *Command) Run(_ []string) int {
-	c.UI.Output("consul-k8s %s", c.Version, terminal.WithInfoStyle())
+func (c *Command) Run(args []string) int {
+	c.once.Do(c.init)
+
+	if err := c.set.Parse(args); err != nil {
+		c.UI.Output(err.Error(), terminal.WithErrorStyle())
+		return 1
+	}
+	if err := terminal.ValidateFormat(c.flagOutput); err != nil {
+		c.UI.Output(err.Error(), terminal.WithErrorStyle())
+		return 1
+	}
+
+	err := terminal.Render(c.UI, c.flagOutput, versionInfo{Version: c.Version}, func() {
+		c.UI.Output("consul-k8s %s", c.Version, terminal.WithInfoStyle())
+	})
+	if err != nil {
+		terminal.OutputError(c.UI, c.flagOutput, err.Error())
+		return 1
+	}
 	return 0
 }
 
 // Help returns a description of the command and how it is used.
 func (c *Command) Help() string {
-	return "Usage: consul-k8s version\n\n" + c.Synopsis()
+	c.once.Do(c.init)
+	return c.Synopsis() + "\n\nUsage: consul-k8s version [flags]\n\n" + c.help
 }
 
 // Synopsis returns a one-line command summary.
 func (c *Command) Synopsis() string {
 	return "Print the version of the Consul on Kubernetes CLI."
 }
+
+// AutocompleteFlags returns a mapping of supported flags and autocomplete
+// options for this command. The map key for the Flags map should be the
+// complete flag such as "-foo" or "--foo".
+func (c *Command) AutocompleteFlags() complete.Flags {
+	return complete.Flags{
+		fmt.Sprintf("-%s", flagNameOutput): complete.PredictSet(terminal.Formats...),
+	}
+}
+
+// AutocompleteArgs returns the argument predictor for this command.
+// Since argument completion is not supported, this will return
+// complete.PredictNothing.
+func (c *Command) AutocompleteArgs() complete.Predictor {
+	return complete.PredictNothing
+}
@@ -0,0 +1,75 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package version
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/hashicorp/consul-k8s/cli/common"
+	"github.com/hashicorp/consul-k8s/cli/common/terminal"
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun(t *testing.T) {
+	cases := map[string]struct {
+		args     []string
+		expected string
+	}{
+		"table": {
+			args:     []string{},
+			expected: "    consul-k8s v1.2.0\n",
+		},
+		"json": {
+			args:     []string{"-output", "json"},
+			expected: "{\n\t\"version\": \"v1.2.0\"\n}\n",
+		},
+		"template": {
+			args:     []string{"-o", "template={{.version}}"},
+			expected: "v1.2.0\n",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			buf := new(bytes.Buffer)
+			c := getInitializedCommand(t, buf)
+
+			require.Equal(t, 0, c.Run(tc.args))
+			require.Equal(t, tc.expected, buf.String())
+		})
+	}
+}
+
+func TestRun_InvalidFormat(t *testing.T) {
+	buf := new(bytes.Buffer)
+	c := getInitializedCommand(t, buf)
+
+	require.Equal(t, 1, c.Run([]string{"-output", "xml"}))
+	require.Contains(t, buf.String(), "-output must be one of table, json, yaml, or template=<template>")
+}
+
+func getInitializedCommand(t *testing.T, buf io.Writer) *Command {
+	t.Helper()
+	log := hclog.New(&hclog.LoggerOptions{
+		Name:   "cli",
+		Level:  hclog.Info,
+		Output: os.Stdout,
+	})
+
+	c := &Command{
+		BaseCommand: &common.BaseCommand{
+			Ctx: context.Background(),
+			Log: log,
+			UI:  terminal.NewUI(context.Background(), buf),
+		},
+		Version: "v1.2.0",
+	}
+	c.init()
+	return c
+}
@@ -8,13 +8,18 @@ import (
 
 	"github.com/hashicorp/consul-k8s/cli/cmd/config"
 	config_read "github.com/hashicorp/consul-k8s/cli/cmd/config/read"
+	config_validate "github.com/hashicorp/consul-k8s/cli/cmd/config/validate"
+	"github.com/hashicorp/consul-k8s/cli/cmd/debug"
+	"github.com/hashicorp/consul-k8s/cli/cmd/inject"
 	"github.com/hashicorp/consul-k8s/cli/cmd/install"
 	"github.com/hashicorp/consul-k8s/cli/cmd/proxy"
 	"github.com/hashicorp/consul-k8s/cli/cmd/proxy/list"
 	"github.com/hashicorp/consul-k8s/cli/cmd/proxy/loglevel"
 	"github.com/hashicorp/consul-k8s/cli/cmd/proxy/read"
+	"github.com/hashicorp/consul-k8s/cli/cmd/proxy/stats"
 	"github.com/hashicorp/consul-k8s/cli/cmd/status"
 	"github.com/hashicorp/consul-k8s/cli/cmd/troubleshoot"
+	"github.com/hashicorp/consul-k8s/cli/cmd/troubleshoot/intentions"
 	troubleshoot_proxy "github.com/hashicorp/consul-k8s/cli/cmd/troubleshoot/proxy"
 	"github.com/hashicorp/consul-k8s/cli/cmd/troubleshoot/upstreams"
 	"github.com/hashicorp/consul-k8s/cli/cmd/uninstall"
@@ -81,6 +86,11 @@ func initializeCommands(ctx context.Context, log hclog.Logger) (*common.BaseComm
 				BaseCommand: baseCommand,
 			}, nil
 		},
+		"proxy stats": func() (cli.Command, error) {
+			return &stats.StatsCommand{
+				BaseCommand: baseCommand,
+			}, nil
+		},
 		"config": func() (cli.Command, error) {
 			return &config.ConfigCommand{
 				BaseCommand: baseCommand,
@@ -91,11 +101,31 @@ func initializeCommands(ctx context.Context, log hclog.Logger) (*common.BaseComm
 				BaseCommand: baseCommand,
 			}, nil
 		},
+		"config validate": func() (cli.Command, error) {
+			return &config_validate.ValidateCommand{
+				BaseCommand: baseCommand,
+			}, nil
+		},
+		"inject": func() (cli.Command, error) {
+			return &inject.InjectCommand{
+				BaseCommand: baseCommand,
+			}, nil
+		},
+		"debug": func() (cli.Command, error) {
+			return &debug.Command{
+				BaseCommand: baseCommand,
+			}, nil
+		},
 		"troubleshoot": func() (cli.Command, error) {
 			return &troubleshoot.TroubleshootCommand{
 				BaseCommand: baseCommand,
 			}, nil
 		},
+		"troubleshoot intentions": func() (cli.Command, error) {
+			return &intentions.IntentionsCommand{
+				BaseCommand: baseCommand,
+			}, nil
+		},
 		"troubleshoot proxy": func() (cli.Command, error) {
 			return &troubleshoot_proxy.ProxyCommand{
 				BaseCommand: baseCommand,
@@ -0,0 +1,142 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package common
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ConsulConnection is how to connect to the HTTP API of a Consul server Pod
+// through a port forward.
+type ConsulConnection struct {
+	// Port is the port of the HTTP API on the Pod.
+	Port int
+	// Scheme is either http or https.
+	Scheme string
+	// Token is the ACL token to make requests with. It is empty when ACLs are
+	// not managed by the Helm chart.
+	Token string
+	// CACert is the PEM-encoded CA certificate of the servers when TLS is
+	// enabled.
+	CACert []byte
+}
+
+// FindConsulServer returns a running Consul server Pod of the Helm release.
+func FindConsulServer(ctx context.Context, client kubernetes.Interface, namespace, releaseName string) (*v1.Pod, error) {
+	servers, err := client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: "app=consul,component=server,release=" + releaseName,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing Consul servers: %w", err)
+	}
+	for i := range servers.Items {
+		if servers.Items[i].Status.Phase == v1.PodRunning {
+			return &servers.Items[i], nil
+		}
+	}
+	return nil, errors.New("no running Consul server Pods found")
+}
+
+// NewConsulConnection returns how to connect to the Consul server Pod. The CA
+// certificate and ACL bootstrap token are read from the secrets created by the
+// Helm chart if they exist.
+func NewConsulConnection(ctx context.Context, client kubernetes.Interface, server v1.Pod) (ConsulConnection, error) {
+	ports := make(map[string]int)
+	for _, container := range server.Spec.Containers {
+		for _, port := range container.Ports {
+			ports[port.Name] = int(port.ContainerPort)
+		}
+	}
+
+	// The Pods are owned by the StatefulSet named <fullname>-server.
+	var prefix string
+	for _, owner := range server.OwnerReferences {
+		if owner.Kind == "StatefulSet" {
+			prefix = strings.TrimSuffix(owner.Name, "-server")
+		}
+	}
+
+	conn := ConsulConnection{Scheme: "http"}
+	port, ok := ports["http"]
+	if httpsPort, tlsEnabled := ports["https"]; tlsEnabled {
+		conn.Scheme = "https"
+		port, ok = httpsPort, true
+		caCert, err := readSecret(ctx, client, server.Namespace, prefix+"-ca-cert", v1.TLSCertKey)
+		if err != nil {
+			return conn, fmt.Errorf("error reading the Consul CA certificate: %w", err)
+		}
+		conn.CACert = caCert
+	}
+	if !ok {
+		return conn, fmt.Errorf("Consul server Pod %s has no HTTP port", server.Name)
+	}
+	conn.Port = port
+
+	token, err := readSecret(ctx, client, server.Namespace, prefix+"-bootstrap-acl-token", "token")
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return conn, fmt.Errorf("error reading the Consul ACL bootstrap token: %w", err)
+	}
+	conn.Token = string(token)
+	return conn, nil
+}
+
+func readSecret(ctx context.Context, client kubernetes.Interface, namespace, name, key string) ([]byte, error) {
+	secret, err := client.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return secret.Data[key], nil
+}
+
+// HTTPClient returns an HTTP client for the connection that trusts the CA
+// certificate of the servers.
+func (c ConsulConnection) HTTPClient() (*http.Client, error) {
+	client := &http.Client{}
+	if c.Scheme == "https" {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(c.CACert) {
+			return nil, errors.New("failed to parse the Consul CA certificate")
+		}
+		client.Transport = &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}
+	}
+	return client, nil
+}
+
+// Get makes a request to the Consul HTTP API at the endpoint of an open port
+// forward and returns the body of the response.
+func (c ConsulConnection) Get(ctx context.Context, client *http.Client, endpoint, path string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s://%s%s", c.Scheme, endpoint, path), nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.Token != "" {
+		req.Header.Set("X-Consul-Token", c.Token)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return body, nil
+}
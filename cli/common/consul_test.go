@@ -0,0 +1,135 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package common
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestFindConsulServer(t *testing.T) {
+	pending := consulServerPod("consul-server-0", nil)
+	pending.Status.Phase = v1.PodPending
+	running := consulServerPod("consul-server-1", nil)
+	other := consulServerPod("other-server-0", nil)
+	other.Labels["release"] = "other"
+
+	client := fake.NewSimpleClientset(pending, running, other)
+	server, err := FindConsulServer(context.Background(), client, "consul", "consul")
+	require.NoError(t, err)
+	require.Equal(t, "consul-server-1", server.Name)
+
+	_, err = FindConsulServer(context.Background(), fake.NewSimpleClientset(pending), "consul", "consul")
+	require.EqualError(t, err, "no running Consul server Pods found")
+}
+
+func TestNewConsulConnection(t *testing.T) {
+	cases := map[string]struct {
+		ports    []v1.ContainerPort
+		secrets  []*v1.Secret
+		expected ConsulConnection
+		err      string
+	}{
+		"HTTP without ACLs": {
+			ports:    []v1.ContainerPort{{Name: "http", ContainerPort: 8500}},
+			expected: ConsulConnection{Port: 8500, Scheme: "http"},
+		},
+		"HTTPS with ACLs": {
+			ports: []v1.ContainerPort{{Name: "http", ContainerPort: 8500}, {Name: "https", ContainerPort: 8501}},
+			secrets: []*v1.Secret{
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "consul-ca-cert", Namespace: "consul"},
+					Data:       map[string][]byte{"tls.crt": []byte("ca")},
+				},
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "consul-bootstrap-acl-token", Namespace: "consul"},
+					Data:       map[string][]byte{"token": []byte("bootstrap-token")},
+				},
+			},
+			expected: ConsulConnection{Port: 8501, Scheme: "https", Token: "bootstrap-token", CACert: []byte("ca")},
+		},
+		"HTTPS without CA secret": {
+			ports: []v1.ContainerPort{{Name: "https", ContainerPort: 8501}},
+			err:   `error reading the Consul CA certificate: secrets "consul-ca-cert" not found`,
+		},
+		"No HTTP port": {
+			ports: []v1.ContainerPort{{Name: "serflan", ContainerPort: 8301}},
+			err:   "Consul server Pod consul-server-0 has no HTTP port",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			client := fake.NewSimpleClientset()
+			for _, secret := range tc.secrets {
+				_, err := client.CoreV1().Secrets(secret.Namespace).Create(context.Background(), secret, metav1.CreateOptions{})
+				require.NoError(t, err)
+			}
+
+			conn, err := NewConsulConnection(context.Background(), client, *consulServerPod("consul-server-0", tc.ports))
+			if tc.err != "" {
+				require.EqualError(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, conn)
+		})
+	}
+}
+
+func TestConsulConnection_Get(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Consul-Token") != "token" {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte("ACL not found\n"))
+			return
+		}
+		_, _ = w.Write([]byte(`"10.0.0.1:8300"`))
+	}))
+	defer server.Close()
+	endpoint := strings.TrimPrefix(server.URL, "http://")
+
+	conn := ConsulConnection{Scheme: "http", Token: "token"}
+	client, err := conn.HTTPClient()
+	require.NoError(t, err)
+	body, err := conn.Get(context.Background(), client, endpoint, "/v1/status/leader")
+	require.NoError(t, err)
+	require.Equal(t, `"10.0.0.1:8300"`, string(body))
+
+	conn.Token = ""
+	_, err = conn.Get(context.Background(), client, endpoint, "/v1/status/leader")
+	require.EqualError(t, err, "unexpected status code 403: ACL not found")
+}
+
+func TestConsulConnection_HTTPClientInvalidCA(t *testing.T) {
+	_, err := ConsulConnection{Scheme: "https", CACert: []byte("not a certificate")}.HTTPClient()
+	require.EqualError(t, err, "failed to parse the Consul CA certificate")
+}
+
+func consulServerPod(name string, ports []v1.ContainerPort) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "consul",
+			Labels: map[string]string{
+				"app":       "consul",
+				"component": "server",
+				"release":   "consul",
+			},
+			OwnerReferences: []metav1.OwnerReference{{Kind: "StatefulSet", Name: "consul-server"}},
+		},
+		Spec: v1.PodSpec{
+			Containers: []v1.Container{{Name: "consul", Ports: ports}},
+		},
+		Status: v1.PodStatus{Phase: v1.PodRunning},
+	}
+}
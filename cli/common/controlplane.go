@@ -0,0 +1,120 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package common
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/hashicorp/consul-k8s/cli/common/terminal"
+	"github.com/hashicorp/consul-k8s/cli/version"
+)
+
+const (
+	// ControlPlaneBinary is the name of the consul-k8s-control-plane binary.
+	// Commands that need the control plane's webhook and custom resource code
+	// run it rather than importing that code, because the two modules depend
+	// on incompatible Kubernetes library versions.
+	ControlPlaneBinary = "consul-k8s-control-plane"
+
+	// EnvControlPlanePath is the environment variable that sets the path to
+	// the consul-k8s-control-plane binary. If it's not set, the binary is
+	// looked up on the PATH.
+	EnvControlPlanePath = "CONSUL_K8S_CONTROL_PLANE_PATH"
+
+	// controlPlaneReleases is where the consul-k8s-control-plane binary is
+	// released.
+	controlPlaneReleases = "https://releases.hashicorp.com/consul-k8s-control-plane/"
+)
+
+// ControlPlanePath returns the path to the consul-k8s-control-plane binary.
+// The error says how to install the binary if it can't be found.
+func ControlPlanePath() (string, error) {
+	if path, ok := os.LookupEnv(EnvControlPlanePath); ok && path != "" {
+		if _, err := exec.LookPath(path); err != nil {
+			return "", fmt.Errorf("%s is set to %q, which is not an executable %s binary: %w",
+				EnvControlPlanePath, path, ControlPlaneBinary, err)
+		}
+		return path, nil
+	}
+	path, err := exec.LookPath(ControlPlaneBinary)
+	if err != nil {
+		return "", fmt.Errorf("%s was not found on the PATH. Install %s %s from %s, "+
+			"or set %s to the path of the binary",
+			ControlPlaneBinary, ControlPlaneBinary, version.GetHumanVersion(), controlPlaneReleases, EnvControlPlanePath)
+	}
+	return path, nil
+}
+
+// ControlPlaneRequirement returns the help text paragraph that says that the
+// CLI command needs the consul-k8s-control-plane binary.
+func ControlPlaneRequirement(cliCommand string) string {
+	return fmt.Sprintf(`  %s requires the %s binary, which is not included
+  with this CLI. Install the same version as this CLI (%s) from
+  %s on the PATH, or set
+  %s to the path of the binary.`,
+		cliCommand, ControlPlaneBinary, version.GetHumanVersion(), controlPlaneReleases, EnvControlPlanePath)
+}
+
+// RunControlPlane runs the consul-k8s-control-plane subcommand with the args,
+// connected to the standard input and the UI's output, and returns its exit
+// code.
+func RunControlPlane(ctx context.Context, ui terminal.UI, subcommand []string, args []string) int {
+	path, err := ControlPlanePath()
+	if err != nil {
+		ui.Output(fmt.Sprintf("consul-k8s %s requires %s: %s", strings.Join(subcommand, " "), ControlPlaneBinary, err),
+			terminal.WithErrorStyle())
+		return 1
+	}
+	stdout, stderr, err := ui.OutputWriters()
+	if err != nil {
+		ui.Output(err.Error(), terminal.WithErrorStyle())
+		return 1
+	}
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	cmd := exec.CommandContext(ctx, path, append(append([]string{}, subcommand...), args...)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return exitErr.ExitCode()
+		}
+		ui.Output(fmt.Sprintf("Error running %s: %s", ControlPlaneBinary, err), terminal.WithErrorStyle())
+		return 1
+	}
+	return 0
+}
+
+// ControlPlaneHelp returns the help of the consul-k8s-control-plane subcommand
+// with its usage line rewritten for the CLI command, or fallback if the binary
+// can't be run. Either is followed by the ControlPlaneRequirement paragraph.
+func ControlPlaneHelp(subcommand []string, cliCommand, fallback string) string {
+	requirement := ControlPlaneRequirement(cliCommand)
+	path, err := ControlPlanePath()
+	if err != nil {
+		return fallback + "\n\n" + requirement
+	}
+	var out bytes.Buffer
+	cmd := exec.Command(path, append(append([]string{}, subcommand...), "-help")...)
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	// The help flag makes the command exit non-zero so only the output is
+	// checked.
+	_ = cmd.Run()
+	help := strings.TrimSpace(out.String())
+	if help == "" {
+		return fallback + "\n\n" + requirement
+	}
+	return strings.ReplaceAll(help, ControlPlaneBinary+" "+strings.Join(subcommand, " "), cliCommand) + "\n\n" + requirement
+}
@@ -0,0 +1,98 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package common
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/hashicorp/consul-k8s/cli/common/terminal"
+)
+
+// fakeControlPlane writes a script that records its arguments to a file,
+// prints a usage line for -help and exits with the given code, and points
+// EnvControlPlanePath at it. It returns the path of the arguments file.
+func fakeControlPlane(t *testing.T, exitCode string) string {
+	t.Helper()
+	dir := t.TempDir()
+	argsFile := filepath.Join(dir, "args")
+	script := filepath.Join(dir, ControlPlaneBinary)
+	err := os.WriteFile(script, []byte(`#!/bin/sh
+echo "$@" > `+argsFile+`
+for arg in "$@"; do
+  if [ "$arg" = "-help" ]; then
+    echo "Usage: consul-k8s-control-plane config validate -f <path> [options]" >&2
+    exit 1
+  fi
+done
+exit `+exitCode+`
+`), 0700)
+	require.NoError(t, err)
+	t.Setenv(EnvControlPlanePath, script)
+	return argsFile
+}
+
+func TestRunControlPlane(t *testing.T) {
+	cases := map[string]struct {
+		exitCode string
+		expected int
+	}{
+		"success": {exitCode: "0", expected: 0},
+		"failure": {exitCode: "3", expected: 3},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			argsFile := fakeControlPlane(t, c.exitCode)
+			ui := terminal.NewUI(context.Background(), &bytes.Buffer{})
+
+			code := RunControlPlane(context.Background(), ui, []string{"config", "validate"}, []string{"-f", "manifests", "-output", "json"})
+			require.Equal(t, c.expected, code)
+
+			args, err := os.ReadFile(argsFile)
+			require.NoError(t, err)
+			require.Equal(t, "config validate -f manifests -output json\n", string(args))
+		})
+	}
+}
+
+func TestRunControlPlane_NotFound(t *testing.T) {
+	t.Setenv(EnvControlPlanePath, "")
+	t.Setenv("PATH", t.TempDir())
+	buf := &bytes.Buffer{}
+	ui := terminal.NewUI(context.Background(), buf)
+
+	code := RunControlPlane(context.Background(), ui, []string{"inject"}, nil)
+	require.Equal(t, 1, code)
+	require.Contains(t, buf.String(), "consul-k8s inject requires consul-k8s-control-plane: consul-k8s-control-plane was not found on the PATH")
+	require.Contains(t, buf.String(), "https://releases.hashicorp.com/consul-k8s-control-plane/")
+	require.Contains(t, buf.String(), EnvControlPlanePath)
+}
+
+func TestRunControlPlane_PathNotExecutable(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), ControlPlaneBinary)
+	t.Setenv(EnvControlPlanePath, missing)
+	buf := &bytes.Buffer{}
+	ui := terminal.NewUI(context.Background(), buf)
+
+	code := RunControlPlane(context.Background(), ui, []string{"inject"}, nil)
+	require.Equal(t, 1, code)
+	require.Contains(t, buf.String(), EnvControlPlanePath+` is set to "`+missing+`", which is not an executable consul-k8s-control-plane binary`)
+}
+
+func TestControlPlaneHelp(t *testing.T) {
+	fakeControlPlane(t, "0")
+	help := ControlPlaneHelp([]string{"config", "validate"}, "consul-k8s config validate", "fallback")
+	require.Equal(t, "Usage: consul-k8s config validate -f <path> [options]\n\n"+ControlPlaneRequirement("consul-k8s config validate"), help)
+
+	t.Setenv(EnvControlPlanePath, "")
+	t.Setenv("PATH", t.TempDir())
+	help = ControlPlaneHelp([]string{"config", "validate"}, "consul-k8s config validate", "fallback")
+	require.Equal(t, "fallback\n\n"+ControlPlaneRequirement("consul-k8s config validate"), help)
+	require.Contains(t, help, "consul-k8s config validate requires the consul-k8s-control-plane binary")
+}
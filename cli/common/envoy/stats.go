@@ -0,0 +1,103 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package envoy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/hashicorp/consul-k8s/cli/common"
+)
+
+// Stats is a snapshot of the counters and gauges exposed by the Envoy admin
+// stats endpoint, keyed by stat name.
+type Stats struct {
+	// Values are the values of the counters and gauges. Histograms are not
+	// included.
+	Values map[string]uint64
+	// Time is when the snapshot was taken.
+	Time time.Time
+}
+
+// statsResponse is the body returned by /stats?format=json. Histograms are
+// returned as an entry without a name and are skipped.
+type statsResponse struct {
+	Stats []struct {
+		Name  string  `json:"name"`
+		Value *uint64 `json:"value"`
+	} `json:"stats"`
+}
+
+// FetchStats opens a port forward to the Envoy admin API and fetches a snapshot
+// of the counters and gauges from the stats endpoint.
+func FetchStats(ctx context.Context, portForward common.PortForwarder) (*Stats, error) {
+	endpoint, err := portForward.Open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer portForward.Close()
+
+	body, err := getAdminEndpoint(fmt.Sprintf("http://%s/stats?format=json", endpoint))
+	if err != nil {
+		return nil, err
+	}
+
+	var response statsResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("failed to parse Envoy stats: %w", err)
+	}
+
+	stats := &Stats{Values: make(map[string]uint64), Time: time.Now()}
+	for _, stat := range response.Stats {
+		if stat.Name == "" || stat.Value == nil {
+			continue
+		}
+		stats.Values[stat.Name] = *stat.Value
+	}
+	return stats, nil
+}
+
+// FetchPrometheusStats opens a port forward to the Envoy admin API and fetches
+// the stats in the Prometheus text exposition format. If filter is not empty,
+// only stats whose Envoy names match the regular expression are returned.
+func FetchPrometheusStats(ctx context.Context, portForward common.PortForwarder, filter string) (string, error) {
+	endpoint, err := portForward.Open(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer portForward.Close()
+
+	statsURL := fmt.Sprintf("http://%s/stats/prometheus", endpoint)
+	if filter != "" {
+		statsURL += "?filter=" + url.QueryEscape(filter)
+	}
+	body, err := getAdminEndpoint(statsURL)
+	if err != nil {
+		return "", err
+	}
+	return string(body), nil
+}
+
+// getAdminEndpoint returns the body of a GET request to the Envoy admin API.
+func getAdminEndpoint(endpoint string) ([]byte, error) {
+	response, err := http.Get(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach envoy: %v", err)
+	}
+	if response.StatusCode >= 400 {
+		return nil, fmt.Errorf("call to envoy failed with status code: %d, and message: %s", response.StatusCode, body)
+	}
+	return body, nil
+}
@@ -0,0 +1,81 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package envoy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFetchStats(t *testing.T) {
+	rawStats, err := os.ReadFile("testdata/test_stats.json")
+	require.NoError(t, err)
+
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/stats", r.URL.Path)
+		require.Equal(t, "json", r.URL.Query().Get("format"))
+		w.Write(rawStats)
+	}))
+	defer mockServer.Close()
+
+	mpf := &mockPortForwarder{
+		openBehavior: func(ctx context.Context) (string, error) {
+			return strings.Replace(mockServer.URL, "http://", "", 1), nil
+		},
+	}
+
+	stats, err := FetchStats(context.Background(), mpf)
+	require.NoError(t, err)
+	require.Equal(t, map[string]uint64{
+		"cluster.backend.default.dc1.internal.bc3815c2-1a0f-f3ff-a2e9-20d791f08d00.consul.upstream_rq_total":  1200,
+		"cluster.backend.default.dc1.internal.bc3815c2-1a0f-f3ff-a2e9-20d791f08d00.consul.upstream_rq_5xx":    12,
+		"cluster.backend.default.dc1.internal.bc3815c2-1a0f-f3ff-a2e9-20d791f08d00.consul.upstream_cx_active": 4,
+		"cluster.local_app.upstream_rq_total":                600,
+		"listener.192.168.69.179_20000.downstream_cx_active": 2,
+		"server.live": 1,
+	}, stats.Values)
+	require.False(t, stats.Time.IsZero())
+}
+
+func TestFetchPrometheusStats(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/stats/prometheus", r.URL.Path)
+		require.Equal(t, `^cluster\.backend`, r.URL.Query().Get("filter"))
+		w.Write([]byte("# TYPE envoy_cluster_upstream_rq_total counter\nenvoy_cluster_upstream_rq_total{envoy_cluster_name=\"backend\"} 1200\n"))
+	}))
+	defer mockServer.Close()
+
+	mpf := &mockPortForwarder{
+		openBehavior: func(ctx context.Context) (string, error) {
+			return strings.Replace(mockServer.URL, "http://", "", 1), nil
+		},
+	}
+
+	stats, err := FetchPrometheusStats(context.Background(), mpf, `^cluster\.backend`)
+	require.NoError(t, err)
+	require.Contains(t, stats, `envoy_cluster_upstream_rq_total{envoy_cluster_name="backend"} 1200`)
+}
+
+func TestFetchStats_ErrorStatus(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("unavailable"))
+	}))
+	defer mockServer.Close()
+
+	mpf := &mockPortForwarder{
+		openBehavior: func(ctx context.Context) (string, error) {
+			return strings.Replace(mockServer.URL, "http://", "", 1), nil
+		},
+	}
+
+	_, err := FetchStats(context.Background(), mpf)
+	require.EqualError(t, err, "call to envoy failed with status code: 503, and message: unavailable")
+}
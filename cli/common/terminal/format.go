@@ -0,0 +1,150 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package terminal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// FormatTable is the human-readable output of a command.
+	FormatTable = "table"
+	// FormatJSON outputs the result of a command as JSON.
+	FormatJSON = "json"
+	// FormatYAML outputs the result of a command as YAML.
+	FormatYAML = "yaml"
+	// FormatTemplatePrefix prefixes a Go template that is executed with the
+	// result of a command, e.g. template={{.name}}. The template sees the
+	// result with the same field names as the JSON output.
+	FormatTemplatePrefix = "template="
+)
+
+// Formats are the output formats supported by every command that has an
+// -output flag, for use in autocompletion.
+var Formats = []string{FormatTable, FormatJSON, FormatYAML, FormatTemplatePrefix}
+
+// OutputUsage returns the usage of the -output flag of a command. what is
+// what the command outputs, e.g. "the status", and extra are the formats
+// specific to the command.
+func OutputUsage(what string, extra ...string) string {
+	formats := append([]string{FormatTable, FormatJSON, FormatYAML}, extra...)
+	for i, format := range formats {
+		formats[i] = fmt.Sprintf("'%s'", format)
+	}
+	return fmt.Sprintf("Output %s as %s, or with a Go template as 'template=<template>'. The template is executed "+
+		"with the fields of the JSON output.", what, strings.Join(formats, ", "))
+}
+
+// ValidateFormat returns an error if format isn't one of the supported
+// formats, one of the extra formats of the command, or a valid template.
+func ValidateFormat(format string, extra ...string) error {
+	formats := append([]string{FormatTable, FormatJSON, FormatYAML}, extra...)
+	for _, f := range formats {
+		if format == f {
+			return nil
+		}
+	}
+	if strings.HasPrefix(format, FormatTemplatePrefix) {
+		if _, err := parseTemplate(format); err != nil {
+			return fmt.Errorf("-output has an invalid template: %w", err)
+		}
+		return nil
+	}
+	return fmt.Errorf("-output must be one of %s, or %s<template>", strings.Join(formats, ", "), FormatTemplatePrefix)
+}
+
+// Structured returns true if format is a machine-readable format. Commands
+// keep progress messages out of their output when it is structured so that
+// it can be parsed.
+func Structured(format string) bool {
+	return format != FormatTable
+}
+
+// OutputError prints an error of a command with the given output format. In
+// structured formats the error is written to the error writer of the UI, so
+// that it doesn't mix with the output that is parsed.
+func OutputError(ui UI, format, msg string, args ...interface{}) {
+	args = append(args, WithErrorStyle())
+	if Structured(format) {
+		if _, stderr, err := ui.OutputWriters(); err == nil {
+			args = append(args, WithWriter(stderr))
+		}
+	}
+	ui.Output(msg, args...)
+}
+
+// Render outputs the result of a command in format. The table format is
+// written by table, which prints the human-readable output of the command;
+// the other formats are rendered from result, which should be a struct with
+// json tags.
+func Render(ui UI, format string, result interface{}, table func()) error {
+	var out []byte
+	var err error
+	switch {
+	case format == FormatTable:
+		table()
+		return nil
+	case format == FormatJSON:
+		out, err = marshalJSON(result)
+	case format == FormatYAML:
+		out, err = yaml.Marshal(result)
+	case strings.HasPrefix(format, FormatTemplatePrefix):
+		out, err = executeTemplate(format, result)
+	default:
+		return fmt.Errorf("unsupported output format %q", format)
+	}
+	if err != nil {
+		return err
+	}
+
+	ui.Output("%s", strings.TrimRight(string(out), "\n"))
+	return nil
+}
+
+// marshalJSON marshals v as indented JSON without escaping HTML characters
+// such as '>', which are common in Envoy configuration.
+func marshalJSON(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "\t")
+	if err := encoder.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func parseTemplate(format string) (*template.Template, error) {
+	return template.New("output").Option("missingkey=error").Parse(strings.TrimPrefix(format, FormatTemplatePrefix))
+}
+
+// executeTemplate executes the template of format with result converted to
+// its JSON representation, so templates use the same field names as the JSON
+// output.
+func executeTemplate(format string, result interface{}) ([]byte, error) {
+	tmpl, err := parseTemplate(format)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := json.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+	var data interface{}
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("error executing output template: %w", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,116 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package terminal
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testResult struct {
+	Name       string   `json:"name"`
+	Healthy    bool     `json:"healthy"`
+	Components []string `json:"components,omitempty"`
+	Filter     string   `json:"filter"`
+}
+
+func TestRender(t *testing.T) {
+	result := testResult{Name: "consul", Healthy: true, Components: []string{"server", "client"}, Filter: "port > 80"}
+
+	cases := map[string]struct {
+		format   string
+		expected string
+	}{
+		"table": {
+			format:   FormatTable,
+			expected: "human-readable\n",
+		},
+		"json": {
+			format: FormatJSON,
+			expected: `{
+	"name": "consul",
+	"healthy": true,
+	"components": [
+		"server",
+		"client"
+	],
+	"filter": "port > 80"
+}
+`,
+		},
+		"yaml": {
+			format: FormatYAML,
+			expected: `components:
+- server
+- client
+filter: port > 80
+healthy: true
+name: consul
+`,
+		},
+		"template": {
+			format:   `template={{.name}} {{range .components}}{{.}},{{end}} healthy={{.healthy}}`,
+			expected: "consul server,client, healthy=true\n",
+		},
+		"template with percent signs": {
+			format:   `template=100% {{.name}}`,
+			expected: "100% consul\n",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			buf := new(bytes.Buffer)
+			ui := NewUI(context.Background(), buf)
+			err := Render(ui, tc.format, result, func() {
+				ui.Output("human-readable")
+			})
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, buf.String())
+		})
+	}
+}
+
+func TestRender_Errors(t *testing.T) {
+	ui := NewUI(context.Background(), new(bytes.Buffer))
+	table := func() { t.Fatal("table should not be rendered") }
+
+	err := Render(ui, "xml", testResult{}, table)
+	require.EqualError(t, err, `unsupported output format "xml"`)
+
+	err = Render(ui, "template={{.missing}}", testResult{}, table)
+	require.ErrorContains(t, err, `map has no entry for key "missing"`)
+}
+
+func TestOutputError(t *testing.T) {
+	buf := new(bytes.Buffer)
+	ui := NewUI(context.Background(), buf)
+	OutputError(ui, FormatTable, "error: %s", "kaboom")
+	require.Equal(t, " ! error: kaboom\n", buf.String())
+
+	// Structured formats write the error to the error writer of the UI.
+	buf.Reset()
+	OutputError(ui, FormatJSON, "error: %s", "kaboom")
+	require.Empty(t, buf.String())
+}
+
+func TestValidateFormat(t *testing.T) {
+	for _, format := range []string{FormatTable, FormatJSON, FormatYAML, "template={{.name}}"} {
+		require.NoError(t, ValidateFormat(format), format)
+	}
+	require.NoError(t, ValidateFormat("raw", "raw"))
+
+	require.EqualError(t, ValidateFormat("raw"), "-output must be one of table, json, yaml, or template=<template>")
+	require.EqualError(t, ValidateFormat("xml", "raw"), "-output must be one of table, json, yaml, raw, or template=<template>")
+	require.ErrorContains(t, ValidateFormat("template={{.name"), "-output has an invalid template")
+}
+
+func TestStructured(t *testing.T) {
+	require.False(t, Structured(FormatTable))
+	require.True(t, Structured(FormatJSON))
+	require.True(t, Structured("template={{.name}}"))
+}
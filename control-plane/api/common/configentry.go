@@ -49,6 +49,10 @@ type ConfigEntryResource interface {
 	SyncedCondition() (status corev1.ConditionStatus, reason, message string)
 	// SyncedConditionStatus returns the status of the synced condition.
 	SyncedConditionStatus() corev1.ConditionStatus
+	// SetConsulStatus records where the config entry was last written in Consul.
+	SetConsulStatus(status ConsulStatus)
+	// ConsulStatus returns where the config entry was last written in Consul.
+	ConsulStatus() ConsulStatus
 	// ToConsul converts the resource to the corresponding Consul API definition.
 	// Its return type is the generic ConfigEntry but a specific config entry
 	// type should be constructed e.g. ServiceConfigEntry.
@@ -100,3 +104,19 @@ type ConsulMeta struct {
 	// `k8s-staging` Consul namespace.
 	Prefix string
 }
+
+// ConsulStatus describes the config entry in Consul that a custom resource was
+// last synced to.
+type ConsulStatus struct {
+	// Namespace is the Consul namespace the config entry was written to after
+	// applying namespace mirroring and prefixes.
+	Namespace string
+	// Partition is the Consul admin partition the config entry was written to.
+	Partition string
+	// Datacenter is the Consul datacenter that manages the config entry.
+	Datacenter string
+	// ModifyIndex is the Raft index at which the config entry was last modified.
+	ModifyIndex uint64
+	// SpecHash is a hash of the config entry that was last written to Consul.
+	SpecHash string
+}
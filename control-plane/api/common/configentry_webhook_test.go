@@ -321,6 +321,12 @@ func (in *mockConfigEntry) SyncedConditionStatus() corev1.ConditionStatus {
 	return corev1.ConditionTrue
 }
 
+func (in *mockConfigEntry) SetConsulStatus(_ ConsulStatus) {}
+
+func (in *mockConfigEntry) ConsulStatus() ConsulStatus {
+	return ConsulStatus{}
+}
+
 func (in *mockConfigEntry) ToConsul(string) capi.ConfigEntry {
 	return &capi.ServiceConfigEntry{}
 }
@@ -0,0 +1,351 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package v1alpha1
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/hashicorp/consul-k8s/control-plane/api/common"
+	capi "github.com/hashicorp/consul/api"
+	"github.com/mitchellh/mapstructure"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+const ConfigEntryKubeKind string = "configentry"
+
+// dedicatedConfigEntryKinds are the config entry kinds that have their own
+// custom resource. They can't be managed through a ConfigEntry resource.
+var dedicatedConfigEntryKinds = map[string]string{
+	capi.ServiceDefaults:    "ServiceDefaults",
+	capi.ProxyDefaults:      "ProxyDefaults",
+	capi.ServiceResolver:    "ServiceResolver",
+	capi.ServiceRouter:      "ServiceRouter",
+	capi.ServiceSplitter:    "ServiceSplitter",
+	capi.ServiceIntentions:  "ServiceIntentions",
+	capi.IngressGateway:     "IngressGateway",
+	capi.TerminatingGateway: "TerminatingGateway",
+	capi.MeshConfig:         "Mesh",
+	capi.ExportedServices:   "ExportedServices",
+	capi.SamenessGroup:      "SamenessGroup",
+}
+
+// PassthroughConfigEntryKinds are the config entry kinds that can be managed
+// with a ConfigEntry resource.
+var PassthroughConfigEntryKinds = []string{
+	capi.APIGateway,
+	capi.HTTPRoute,
+	capi.InlineCertificate,
+	capi.JWTProvider,
+	capi.RateLimitIPConfig,
+	capi.TCPRoute,
+}
+
+// globalConfigEntryKinds are the config entry kinds without a dedicated custom
+// resource that only exist in the default Consul namespace.
+var globalConfigEntryKinds = map[string]bool{
+	capi.RateLimitIPConfig: true,
+	capi.JWTProvider:       true,
+}
+
+// configEntryIgnoredFields are the fields that are set by Consul or by the
+// controller and so are ignored when comparing a ConfigEntry resource with
+// the entry in Consul.
+var configEntryIgnoredFields = []string{"Partition", "Namespace", "Meta", "Status", "CreateIndex", "ModifyIndex"}
+
+func init() {
+	SchemeBuilder.Register(&ConfigEntry{}, &ConfigEntryList{})
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+
+// ConfigEntry is the Schema for config entry kinds that don't have a dedicated
+// custom resource. The config entry is passed through to Consul as is.
+// +kubebuilder:printcolumn:name="Kind",type="string",JSONPath=".spec.kind",description="The Consul config entry kind"
+// +kubebuilder:printcolumn:name="Synced",type="string",JSONPath=".status.conditions[?(@.type==\"Synced\")].status",description="The sync status of the resource with Consul"
+// +kubebuilder:printcolumn:name="Last Synced",type="date",JSONPath=".status.lastSyncedTime",description="The last successful synced time of the resource with Consul"
+// +kubebuilder:printcolumn:name="Consul Namespace",type="string",JSONPath=".status.consulNamespace",description="The Consul namespace the resource was written to",priority=1
+// +kubebuilder:printcolumn:name="Consul Partition",type="string",JSONPath=".status.consulPartition",description="The Consul admin partition the resource was written to",priority=1
+// +kubebuilder:printcolumn:name="Datacenter",type="string",JSONPath=".status.datacenter",description="The Consul datacenter that manages the resource",priority=1
+// +kubebuilder:printcolumn:name="Modify Index",type="integer",JSONPath=".status.modifyIndex",description="The Consul index at which the resource was last modified",priority=1
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp",description="The age of the resource"
+// +kubebuilder:resource:shortName="config-entry"
+type ConfigEntry struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ConfigEntrySpec `json:"spec,omitempty"`
+	Status `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// ConfigEntryList contains a list of ConfigEntry.
+type ConfigEntryList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ConfigEntry `json:"items"`
+}
+
+// ConfigEntrySpec defines the desired state of ConfigEntry.
+type ConfigEntrySpec struct {
+	// Kind is the Consul config entry kind, e.g. jwt-provider.
+	// Kinds that have a dedicated custom resource are not supported.
+	Kind string `json:"kind"`
+	// Name is the name of the config entry in Consul. It defaults to the name
+	// of the resource.
+	Name string `json:"name,omitempty"`
+	// Spec is the body of the config entry. Fields use the same names as
+	// the Consul config entry in JSON, e.g. Issuer for a jwt-provider. The kind,
+	// name, namespace, partition and meta fields are set by the controller.
+	// +kubebuilder:validation:Type=object
+	// +kubebuilder:validation:Schemaless
+	// +kubebuilder:pruning:PreserveUnknownFields
+	Spec json.RawMessage `json:"spec,omitempty"`
+}
+
+func (in *ConfigEntry) GetObjectMeta() metav1.ObjectMeta {
+	return in.ObjectMeta
+}
+
+func (in *ConfigEntry) AddFinalizer(name string) {
+	in.ObjectMeta.Finalizers = append(in.Finalizers(), name)
+}
+
+func (in *ConfigEntry) RemoveFinalizer(name string) {
+	var newFinalizers []string
+	for _, oldF := range in.Finalizers() {
+		if oldF != name {
+			newFinalizers = append(newFinalizers, oldF)
+		}
+	}
+	in.ObjectMeta.Finalizers = newFinalizers
+}
+
+func (in *ConfigEntry) Finalizers() []string {
+	return in.ObjectMeta.Finalizers
+}
+
+func (in *ConfigEntry) ConsulKind() string {
+	return in.Spec.Kind
+}
+
+func (in *ConfigEntry) ConsulGlobalResource() bool {
+	return globalConfigEntryKinds[in.Spec.Kind]
+}
+
+func (in *ConfigEntry) ConsulMirroringNS() string {
+	if in.ConsulGlobalResource() {
+		return common.DefaultConsulNamespace
+	}
+	return in.Namespace
+}
+
+func (in *ConfigEntry) KubeKind() string {
+	return ConfigEntryKubeKind
+}
+
+func (in *ConfigEntry) ConsulName() string {
+	if in.Spec.Name != "" {
+		return in.Spec.Name
+	}
+	return in.ObjectMeta.Name
+}
+
+func (in *ConfigEntry) KubernetesName() string {
+	return in.ObjectMeta.Name
+}
+
+func (in *ConfigEntry) SetSyncedCondition(status corev1.ConditionStatus, reason, message string) {
+	in.Status.Conditions = Conditions{
+		{
+			Type:               ConditionSynced,
+			Status:             status,
+			LastTransitionTime: metav1.Now(),
+			Reason:             reason,
+			Message:            message,
+		},
+	}
+}
+
+func (in *ConfigEntry) SetLastSyncedTime(time *metav1.Time) {
+	in.Status.LastSyncedTime = time
+}
+
+func (in *ConfigEntry) SyncedCondition() (status corev1.ConditionStatus, reason, message string) {
+	cond := in.Status.GetCondition(ConditionSynced)
+	if cond == nil {
+		return corev1.ConditionUnknown, "", ""
+	}
+	return cond.Status, cond.Reason, cond.Message
+}
+
+func (in *ConfigEntry) SyncedConditionStatus() corev1.ConditionStatus {
+	cond := in.Status.GetCondition(ConditionSynced)
+	if cond == nil {
+		return corev1.ConditionUnknown
+	}
+	return cond.Status
+}
+
+// ToConsul decodes the spec into the Consul config entry for the kind. It
+// returns nil if the spec can't be decoded, which Validate prevents.
+func (in *ConfigEntry) ToConsul(datacenter string) capi.ConfigEntry {
+	entry, err := in.decode(datacenter)
+	if err != nil {
+		return nil
+	}
+	return entry
+}
+
+func (in *ConfigEntry) MatchesConsul(candidate capi.ConfigEntry) bool {
+	if candidate == nil || candidate.GetKind() != in.ConsulKind() {
+		return false
+	}
+	// No datacenter is passed to ToConsul as we ignore the Meta field when checking for equality.
+	entry := in.ToConsul("")
+	if entry == nil {
+		return false
+	}
+	desired, err := configEntryFields(entry)
+	if err != nil {
+		return false
+	}
+	actual, err := configEntryFields(candidate)
+	if err != nil {
+		return false
+	}
+	return cmp.Equal(desired, actual, cmpopts.EquateEmpty())
+}
+
+func (in *ConfigEntry) Validate(_ common.ConsulMeta) error {
+	var errs field.ErrorList
+	path := field.NewPath("spec")
+
+	if in.Spec.Kind == "" {
+		errs = append(errs, field.Required(path.Child("kind"), "kind must be set"))
+	} else if crd, ok := dedicatedConfigEntryKinds[in.Spec.Kind]; ok {
+		errs = append(errs, field.Invalid(path.Child("kind"), in.Spec.Kind,
+			fmt.Sprintf("%s config entries must be managed with the %s resource; the kinds supported by %s resources are %s",
+				in.Spec.Kind, crd, ConfigEntryKubeKind, strings.Join(PassthroughConfigEntryKinds, ", "))))
+	} else if !isPassthroughConfigEntryKind(in.Spec.Kind) {
+		errs = append(errs, field.NotSupported(path.Child("kind"), in.Spec.Kind, PassthroughConfigEntryKinds))
+	} else if err := in.validateSpec(); err != nil {
+		errs = append(errs, field.Invalid(path.Child("spec"), string(in.Spec.Spec), err.Error()))
+	}
+
+	if len(errs) > 0 {
+		return apierrors.NewInvalid(
+			schema.GroupKind{Group: ConsulHashicorpGroup, Kind: ConfigEntryKubeKind},
+			in.KubernetesName(), errs)
+	}
+	return nil
+}
+
+// DefaultNamespaceFields has no behaviour here as the spec is passed through as is.
+func (in *ConfigEntry) DefaultNamespaceFields(_ common.ConsulMeta) {
+}
+
+// decode converts the spec into the Consul config entry for the kind.
+func (in *ConfigEntry) decode(datacenter string) (capi.ConfigEntry, error) {
+	raw, err := in.rawSpec()
+	if err != nil {
+		return nil, err
+	}
+	raw["Kind"] = in.ConsulKind()
+	raw["Name"] = in.ConsulName()
+	raw["Meta"] = meta(datacenter)
+	return capi.DecodeConfigEntry(raw)
+}
+
+// rawSpec unmarshals the spec into a map with the fields managed by the
+// controller removed.
+func (in *ConfigEntry) rawSpec() (map[string]interface{}, error) {
+	raw := make(map[string]interface{})
+	if len(in.Spec.Spec) > 0 {
+		if err := json.Unmarshal(in.Spec.Spec, &raw); err != nil {
+			return nil, fmt.Errorf("must be valid map value: %s", err)
+		}
+	}
+	for key := range raw {
+		switch strings.ToLower(key) {
+		case "kind", "name", "namespace", "partition", "meta":
+			delete(raw, key)
+		}
+	}
+	return raw, nil
+}
+
+// validateSpec returns an error if the spec can't be decoded into the
+// Consul config entry for the kind or if it contains unknown fields.
+func (in *ConfigEntry) validateSpec() error {
+	raw, err := in.rawSpec()
+	if err != nil {
+		return err
+	}
+	if _, err := in.decode(""); err != nil {
+		return err
+	}
+
+	// DecodeConfigEntry ignores fields it doesn't know about so we decode
+	// again to find them. Otherwise typos would be silently dropped.
+	entry, _ := capi.MakeConfigEntry(in.ConsulKind(), "")
+	var md mapstructure.Metadata
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook: mapstructure.ComposeDecodeHookFunc(
+			mapstructure.StringToTimeDurationHookFunc(),
+			mapstructure.StringToTimeHookFunc(time.RFC3339),
+		),
+		Metadata:         &md,
+		Result:           &entry,
+		WeaklyTypedInput: true,
+	})
+	if err != nil {
+		return err
+	}
+	if err := decoder.Decode(raw); err != nil {
+		return err
+	}
+	if len(md.Unused) > 0 {
+		sort.Strings(md.Unused)
+		return fmt.Errorf("unknown fields: %s", strings.Join(md.Unused, ", "))
+	}
+	return nil
+}
+
+// configEntryFields returns the fields of entry that are compared by
+// MatchesConsul.
+func configEntryFields(entry capi.ConfigEntry) (map[string]interface{}, error) {
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return nil, err
+	}
+	fields := make(map[string]interface{})
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil, err
+	}
+	for _, f := range configEntryIgnoredFields {
+		delete(fields, f)
+	}
+	return fields, nil
+}
+
+func isPassthroughConfigEntryKind(kind string) bool {
+	for _, k := range PassthroughConfigEntryKinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,370 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package v1alpha1
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul-k8s/control-plane/api/common"
+	capi "github.com/hashicorp/consul/api"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestConfigEntry_MatchesConsul(t *testing.T) {
+	cases := map[string]struct {
+		Ours    ConfigEntry
+		Theirs  capi.ConfigEntry
+		Matches bool
+	}{
+		"empty fields matches": {
+			Ours: ConfigEntry{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "okta",
+				},
+				Spec: ConfigEntrySpec{
+					Kind: capi.JWTProvider,
+				},
+			},
+			Theirs: &capi.JWTProviderConfigEntry{
+				Kind:        capi.JWTProvider,
+				Name:        "okta",
+				Namespace:   "default",
+				CreateIndex: 1,
+				ModifyIndex: 2,
+				Meta: map[string]string{
+					common.SourceKey:     common.SourceValue,
+					common.DatacenterKey: "datacenter",
+				},
+			},
+			Matches: true,
+		},
+		"all fields set matches": {
+			Ours: ConfigEntry{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "okta",
+				},
+				Spec: ConfigEntrySpec{
+					Kind: capi.JWTProvider,
+					Spec: json.RawMessage(`{"Issuer": "okta", "Audiences": ["a", "b"], "JSONWebKeySet": {"Remote": {"URI": "https://example.com/keys", "RequestTimeoutMs": 500}}}`),
+				},
+			},
+			Theirs: &capi.JWTProviderConfigEntry{
+				Kind:      capi.JWTProvider,
+				Name:      "okta",
+				Issuer:    "okta",
+				Audiences: []string{"a", "b"},
+				JSONWebKeySet: &capi.JSONWebKeySet{
+					Remote: &capi.RemoteJWKS{
+						URI:              "https://example.com/keys",
+						RequestTimeoutMs: 500,
+					},
+				},
+			},
+			Matches: true,
+		},
+		"spec name is used": {
+			Ours: ConfigEntry{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "okta-provider",
+				},
+				Spec: ConfigEntrySpec{
+					Kind: capi.JWTProvider,
+					Name: "okta",
+				},
+			},
+			Theirs: &capi.JWTProviderConfigEntry{
+				Kind: capi.JWTProvider,
+				Name: "okta",
+			},
+			Matches: true,
+		},
+		"different field does not match": {
+			Ours: ConfigEntry{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "okta",
+				},
+				Spec: ConfigEntrySpec{
+					Kind: capi.JWTProvider,
+					Spec: json.RawMessage(`{"Issuer": "okta"}`),
+				},
+			},
+			Theirs: &capi.JWTProviderConfigEntry{
+				Kind:   capi.JWTProvider,
+				Name:   "okta",
+				Issuer: "auth0",
+			},
+			Matches: false,
+		},
+		"different kind does not match": {
+			Ours: ConfigEntry{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "okta",
+				},
+				Spec: ConfigEntrySpec{
+					Kind: capi.JWTProvider,
+				},
+			},
+			Theirs: &capi.ServiceConfigEntry{
+				Kind: capi.ServiceDefaults,
+				Name: "okta",
+			},
+			Matches: false,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, c.Matches, c.Ours.MatchesConsul(c.Theirs))
+		})
+	}
+}
+
+func TestConfigEntry_ToConsul(t *testing.T) {
+	cases := map[string]struct {
+		Ours ConfigEntry
+		Exp  capi.ConfigEntry
+	}{
+		"empty fields": {
+			Ours: ConfigEntry{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "global",
+				},
+				Spec: ConfigEntrySpec{
+					Kind: capi.RateLimitIPConfig,
+				},
+			},
+			Exp: &capi.RateLimitIPConfigEntry{
+				Kind: capi.RateLimitIPConfig,
+				Name: "global",
+				Meta: map[string]string{
+					common.SourceKey:     common.SourceValue,
+					common.DatacenterKey: "datacenter",
+				},
+			},
+		},
+		"every field set": {
+			Ours: ConfigEntry{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "global",
+				},
+				Spec: ConfigEntrySpec{
+					Kind: capi.RateLimitIPConfig,
+					Spec: json.RawMessage(`{"Mode": "permissive", "ReadRate": 100, "WriteRate": "50"}`),
+				},
+			},
+			Exp: &capi.RateLimitIPConfigEntry{
+				Kind:      capi.RateLimitIPConfig,
+				Name:      "global",
+				Mode:      "permissive",
+				ReadRate:  100,
+				WriteRate: 50,
+				Meta: map[string]string{
+					common.SourceKey:     common.SourceValue,
+					common.DatacenterKey: "datacenter",
+				},
+			},
+		},
+		"managed fields in config are ignored": {
+			Ours: ConfigEntry{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "global",
+				},
+				Spec: ConfigEntrySpec{
+					Kind: capi.RateLimitIPConfig,
+					Spec: json.RawMessage(`{"Kind": "jwt-provider", "Name": "other", "Namespace": "ns", "Meta": {"foo": "bar"}}`),
+				},
+			},
+			Exp: &capi.RateLimitIPConfigEntry{
+				Kind: capi.RateLimitIPConfig,
+				Name: "global",
+				Meta: map[string]string{
+					common.SourceKey:     common.SourceValue,
+					common.DatacenterKey: "datacenter",
+				},
+			},
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, c.Exp, c.Ours.ToConsul("datacenter"))
+		})
+	}
+}
+
+func TestConfigEntry_ToConsulInvalidConfig(t *testing.T) {
+	configEntry := &ConfigEntry{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo"},
+		Spec: ConfigEntrySpec{
+			Kind: "invalid",
+			Spec: json.RawMessage(`{}`),
+		},
+	}
+	require.Nil(t, configEntry.ToConsul("datacenter"))
+}
+
+func TestConfigEntry_Validate(t *testing.T) {
+	cases := map[string]struct {
+		input          *ConfigEntry
+		expectedErrMsg string
+	}{
+		"valid": {
+			input: &ConfigEntry{
+				ObjectMeta: metav1.ObjectMeta{Name: "okta"},
+				Spec: ConfigEntrySpec{
+					Kind: capi.JWTProvider,
+					Spec: json.RawMessage(`{"Issuer": "okta", "JSONWebKeySet": {"Remote": {"URI": "https://example.com/keys"}}}`),
+				},
+			},
+		},
+		"kind not set": {
+			input: &ConfigEntry{
+				ObjectMeta: metav1.ObjectMeta{Name: "okta"},
+			},
+			expectedErrMsg: `configentry.consul.hashicorp.com "okta" is invalid: spec.kind: Required value: kind must be set`,
+		},
+		"kind with dedicated resource": {
+			input: &ConfigEntry{
+				ObjectMeta: metav1.ObjectMeta{Name: "web"},
+				Spec: ConfigEntrySpec{
+					Kind: capi.ServiceDefaults,
+				},
+			},
+			expectedErrMsg: `configentry.consul.hashicorp.com "web" is invalid: spec.kind: Invalid value: "service-defaults": service-defaults config entries must be managed with the ServiceDefaults resource; the kinds supported by configentry resources are api-gateway, http-route, inline-certificate, jwt-provider, control-plane-request-limit, tcp-route`,
+		},
+		"unknown kind": {
+			input: &ConfigEntry{
+				ObjectMeta: metav1.ObjectMeta{Name: "web"},
+				Spec: ConfigEntrySpec{
+					Kind: "foo",
+				},
+			},
+			expectedErrMsg: `configentry.consul.hashicorp.com "web" is invalid: spec.kind: Unsupported value: "foo": supported values: "api-gateway", "http-route", "inline-certificate", "jwt-provider", "control-plane-request-limit", "tcp-route"`,
+		},
+		"config not a map": {
+			input: &ConfigEntry{
+				ObjectMeta: metav1.ObjectMeta{Name: "okta"},
+				Spec: ConfigEntrySpec{
+					Kind: capi.JWTProvider,
+					Spec: json.RawMessage(`[1, 2]`),
+				},
+			},
+			expectedErrMsg: `configentry.consul.hashicorp.com "okta" is invalid: spec.spec: Invalid value: "[1, 2]": must be valid map value: json: cannot unmarshal array into Go value of type map[string]interface {}`,
+		},
+		"unknown fields": {
+			input: &ConfigEntry{
+				ObjectMeta: metav1.ObjectMeta{Name: "okta"},
+				Spec: ConfigEntrySpec{
+					Kind: capi.JWTProvider,
+					Spec: json.RawMessage(`{"Issuer": "okta", "Isuer": "okta", "JSONWebKeySet": {"Remote": {"URL": "https://example.com/keys"}}}`),
+				},
+			},
+			expectedErrMsg: `configentry.consul.hashicorp.com "okta" is invalid: spec.spec: Invalid value: "{\"Issuer\": \"okta\", \"Isuer\": \"okta\", \"JSONWebKeySet\": {\"Remote\": {\"URL\": \"https://example.com/keys\"}}}": unknown fields: Isuer, JSONWebKeySet.Remote.URL`,
+		},
+		"field of wrong type": {
+			input: &ConfigEntry{
+				ObjectMeta: metav1.ObjectMeta{Name: "okta"},
+				Spec: ConfigEntrySpec{
+					Kind: capi.JWTProvider,
+					Spec: json.RawMessage(`{"Audiences": {"foo": "bar"}}`),
+				},
+			},
+			expectedErrMsg: `configentry.consul.hashicorp.com "okta" is invalid: spec.spec: Invalid value: "{\"Audiences\": {\"foo\": \"bar\"}}": 1 error(s) decoding:
+
+* 'Audiences[0]' expected type 'string', got unconvertible type 'map[string]interface {}', value: 'map[foo:bar]'`,
+		},
+	}
+	for name, testCase := range cases {
+		t.Run(name, func(t *testing.T) {
+			err := testCase.input.Validate(common.ConsulMeta{})
+			if testCase.expectedErrMsg != "" {
+				require.EqualError(t, err, testCase.expectedErrMsg)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestConfigEntry_AddFinalizer(t *testing.T) {
+	configEntry := &ConfigEntry{}
+	configEntry.AddFinalizer("finalizer")
+	require.Equal(t, []string{"finalizer"}, configEntry.ObjectMeta.Finalizers)
+}
+
+func TestConfigEntry_RemoveFinalizer(t *testing.T) {
+	configEntry := &ConfigEntry{
+		ObjectMeta: metav1.ObjectMeta{
+			Finalizers: []string{"f1", "f2"},
+		},
+	}
+	configEntry.RemoveFinalizer("f1")
+	require.Equal(t, []string{"f2"}, configEntry.ObjectMeta.Finalizers)
+}
+
+func TestConfigEntry_SetSyncedCondition(t *testing.T) {
+	configEntry := &ConfigEntry{}
+	configEntry.SetSyncedCondition(corev1.ConditionTrue, "reason", "message")
+
+	require.Equal(t, corev1.ConditionTrue, configEntry.Status.Conditions[0].Status)
+	require.Equal(t, "reason", configEntry.Status.Conditions[0].Reason)
+	require.Equal(t, "message", configEntry.Status.Conditions[0].Message)
+	now := metav1.Now()
+	require.True(t, configEntry.Status.Conditions[0].LastTransitionTime.Before(&now))
+}
+
+func TestConfigEntry_SetLastSyncedTime(t *testing.T) {
+	configEntry := &ConfigEntry{}
+	syncedTime := metav1.NewTime(time.Now())
+	configEntry.SetLastSyncedTime(&syncedTime)
+
+	require.Equal(t, &syncedTime, configEntry.Status.LastSyncedTime)
+}
+
+func TestConfigEntry_SyncedConditionWhenStatusNil(t *testing.T) {
+	status, reason, message := (&ConfigEntry{}).SyncedCondition()
+	require.Equal(t, corev1.ConditionUnknown, status)
+	require.Equal(t, "", reason)
+	require.Equal(t, "", message)
+}
+
+func TestConfigEntry_ConsulKind(t *testing.T) {
+	require.Equal(t, capi.JWTProvider, (&ConfigEntry{Spec: ConfigEntrySpec{Kind: capi.JWTProvider}}).ConsulKind())
+}
+
+func TestConfigEntry_KubeKind(t *testing.T) {
+	require.Equal(t, "configentry", (&ConfigEntry{}).KubeKind())
+}
+
+func TestConfigEntry_ConsulName(t *testing.T) {
+	require.Equal(t, "foo", (&ConfigEntry{ObjectMeta: metav1.ObjectMeta{Name: "foo"}}).ConsulName())
+	require.Equal(t, "bar", (&ConfigEntry{ObjectMeta: metav1.ObjectMeta{Name: "foo"}, Spec: ConfigEntrySpec{Name: "bar"}}).ConsulName())
+}
+
+func TestConfigEntry_KubernetesName(t *testing.T) {
+	require.Equal(t, "foo", (&ConfigEntry{ObjectMeta: metav1.ObjectMeta{Name: "foo"}, Spec: ConfigEntrySpec{Name: "bar"}}).KubernetesName())
+}
+
+func TestConfigEntry_ConsulNamespace(t *testing.T) {
+	require.Equal(t, "bar", (&ConfigEntry{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "bar"}, Spec: ConfigEntrySpec{Kind: capi.HTTPRoute}}).ConsulMirroringNS())
+	require.Equal(t, common.DefaultConsulNamespace, (&ConfigEntry{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "bar"}, Spec: ConfigEntrySpec{Kind: capi.JWTProvider}}).ConsulMirroringNS())
+}
+
+func TestConfigEntry_ConsulGlobalResource(t *testing.T) {
+	require.False(t, (&ConfigEntry{Spec: ConfigEntrySpec{Kind: capi.HTTPRoute}}).ConsulGlobalResource())
+	require.True(t, (&ConfigEntry{Spec: ConfigEntrySpec{Kind: capi.JWTProvider}}).ConsulGlobalResource())
+}
+
+func TestConfigEntry_ObjectMeta(t *testing.T) {
+	meta := metav1.ObjectMeta{
+		Name:      "name",
+		Namespace: "namespace",
+	}
+	configEntry := &ConfigEntry{
+		ObjectMeta: meta,
+	}
+	require.Equal(t, meta, configEntry.GetObjectMeta())
+}
@@ -0,0 +1,82 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package v1alpha1
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-logr/logr"
+	"github.com/hashicorp/consul-k8s/control-plane/api/common"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// +kubebuilder:object:generate=false
+
+type ConfigEntryWebhook struct {
+	Logger logr.Logger
+
+	// ConsulMeta contains metadata specific to the Consul installation.
+	ConsulMeta common.ConsulMeta
+
+	decoder *admission.Decoder
+	client.Client
+}
+
+// NOTE: The path value in the below line is the path to the webhook.
+// If it is updated, run code-gen, update subcommand/controller/command.go
+// and the consul-helm value for the path to the webhook.
+//
+// NOTE: The below line cannot be combined with any other comment. If it is it will break the code generation.
+//
+// +kubebuilder:webhook:verbs=create;update,path=/mutate-v1alpha1-configentry,mutating=true,failurePolicy=fail,groups=consul.hashicorp.com,resources=configentries,versions=v1alpha1,name=mutate-configentry.consul.hashicorp.com,sideEffects=None,admissionReviewVersions=v1beta1;v1
+
+func (v *ConfigEntryWebhook) Handle(ctx context.Context, req admission.Request) admission.Response {
+	var configEntry ConfigEntry
+	err := v.decoder.Decode(req, &configEntry)
+	if err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	return common.ValidateConfigEntry(ctx, req, v.Logger, &configEntryKindLister{webhook: v, kind: configEntry.Spec.Kind}, &configEntry, v.ConsulMeta)
+}
+
+func (v *ConfigEntryWebhook) List(ctx context.Context) ([]common.ConfigEntryResource, error) {
+	var configEntryList ConfigEntryList
+	if err := v.Client.List(ctx, &configEntryList); err != nil {
+		return nil, err
+	}
+	var entries []common.ConfigEntryResource
+	for i := range configEntryList.Items {
+		entries = append(entries, &configEntryList.Items[i])
+	}
+	return entries, nil
+}
+
+func (v *ConfigEntryWebhook) InjectDecoder(d *admission.Decoder) error {
+	v.decoder = d
+	return nil
+}
+
+// configEntryKindLister lists the ConfigEntry resources of a single kind so
+// that names only need to be unique per config entry kind.
+type configEntryKindLister struct {
+	webhook *ConfigEntryWebhook
+	kind    string
+}
+
+func (l *configEntryKindLister) List(ctx context.Context) ([]common.ConfigEntryResource, error) {
+	all, err := l.webhook.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var entries []common.ConfigEntryResource
+	for _, item := range all {
+		if item.ConsulKind() == l.kind {
+			entries = append(entries, item)
+		}
+	}
+	return entries, nil
+}
@@ -0,0 +1,135 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package v1alpha1
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	logrtest "github.com/go-logr/logr/testing"
+	"github.com/hashicorp/consul-k8s/control-plane/api/common"
+	capi "github.com/hashicorp/consul/api"
+	"github.com/stretchr/testify/require"
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+func TestValidateConfigEntry(t *testing.T) {
+	otherNS := "other"
+	existing := func(name, kind string) *ConfigEntry {
+		return &ConfigEntry{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Spec:       ConfigEntrySpec{Kind: kind},
+		}
+	}
+
+	cases := map[string]struct {
+		existingResources []runtime.Object
+		newResource       *ConfigEntry
+		expAllow          bool
+		expErrMessage     string
+	}{
+		"no duplicates, valid": {
+			existingResources: nil,
+			newResource: &ConfigEntry{
+				ObjectMeta: metav1.ObjectMeta{Name: "okta"},
+				Spec:       ConfigEntrySpec{Kind: capi.JWTProvider},
+			},
+			expAllow: true,
+		},
+		"duplicate of an entry of the same kind": {
+			existingResources: []runtime.Object{
+				existing("auth0", capi.JWTProvider),
+				existing("okta", capi.JWTProvider),
+				existing("web", capi.TCPRoute),
+			},
+			newResource: &ConfigEntry{
+				ObjectMeta: metav1.ObjectMeta{Name: "okta"},
+				Spec:       ConfigEntrySpec{Kind: capi.JWTProvider},
+			},
+			expAllow:      false,
+			expErrMessage: "configentry resource with name \"okta\" is already defined – all configentry resources must have unique names across namespaces",
+		},
+		"same name as an entry of a different kind": {
+			existingResources: []runtime.Object{
+				existing("auth0", capi.JWTProvider),
+				existing("okta", capi.TCPRoute),
+				existing("web", capi.TCPRoute),
+			},
+			newResource: &ConfigEntry{
+				ObjectMeta: metav1.ObjectMeta{Name: "okta"},
+				Spec:       ConfigEntrySpec{Kind: capi.JWTProvider},
+			},
+			expAllow: true,
+		},
+		"different name from the entries of the same kind": {
+			existingResources: []runtime.Object{
+				existing("auth0", capi.JWTProvider),
+				existing("okta", capi.JWTProvider),
+			},
+			newResource: &ConfigEntry{
+				ObjectMeta: metav1.ObjectMeta{Name: "keycloak"},
+				Spec:       ConfigEntrySpec{Kind: capi.JWTProvider},
+			},
+			expAllow: true,
+		},
+		"kind with a dedicated resource": {
+			newResource: &ConfigEntry{
+				ObjectMeta: metav1.ObjectMeta{Name: "web"},
+				Spec:       ConfigEntrySpec{Kind: capi.ServiceDefaults},
+			},
+			expAllow: false,
+			expErrMessage: `configentry.consul.hashicorp.com "web" is invalid: spec.kind: Invalid value: "service-defaults": ` +
+				`service-defaults config entries must be managed with the ServiceDefaults resource; the kinds supported by ` +
+				`configentry resources are api-gateway, http-route, inline-certificate, jwt-provider, control-plane-request-limit, tcp-route`,
+		},
+		"unsupported kind": {
+			newResource: &ConfigEntry{
+				ObjectMeta: metav1.ObjectMeta{Name: "web"},
+				Spec:       ConfigEntrySpec{Kind: "foo"},
+			},
+			expAllow: false,
+			expErrMessage: `configentry.consul.hashicorp.com "web" is invalid: spec.kind: Unsupported value: "foo": supported values: ` +
+				`"api-gateway", "http-route", "inline-certificate", "jwt-provider", "control-plane-request-limit", "tcp-route"`,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			marshalledRequestObject, err := json.Marshal(c.newResource)
+			require.NoError(t, err)
+			s := runtime.NewScheme()
+			s.AddKnownTypes(GroupVersion, &ConfigEntry{}, &ConfigEntryList{})
+			client := fake.NewClientBuilder().WithScheme(s).WithRuntimeObjects(c.existingResources...).Build()
+			decoder, err := admission.NewDecoder(s)
+			require.NoError(t, err)
+
+			validator := &ConfigEntryWebhook{
+				Client:     client,
+				Logger:     logrtest.TestLogger{T: t},
+				decoder:    decoder,
+				ConsulMeta: common.ConsulMeta{},
+			}
+			response := validator.Handle(ctx, admission.Request{
+				AdmissionRequest: admissionv1.AdmissionRequest{
+					Name:      c.newResource.KubernetesName(),
+					Namespace: otherNS,
+					Operation: admissionv1.Create,
+					Object: runtime.RawExtension{
+						Raw: marshalledRequestObject,
+					},
+				},
+			})
+
+			require.Equal(t, c.expAllow, response.Allowed, response.AdmissionResponse.Result)
+			if c.expErrMessage != "" {
+				require.Equal(t, c.expErrMessage, response.AdmissionResponse.Result.Message)
+			}
+		})
+	}
+}
@@ -4,6 +4,8 @@
 package v1alpha1
 
 import (
+	"fmt"
+
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -15,6 +17,7 @@ import (
 
 const PeeringAcceptorKubeKind = "peeringacceptors"
 const SecretBackendTypeKubernetes = "kubernetes"
+const SecretBackendTypeVault = "vault"
 
 func init() {
 	SchemeBuilder.Register(&PeeringAcceptor{}, &PeeringAcceptorList{})
@@ -26,6 +29,7 @@ func init() {
 // PeeringAcceptor is the Schema for the peeringacceptors API.
 // +kubebuilder:printcolumn:name="Synced",type="string",JSONPath=".status.conditions[?(@.type==\"Synced\")].status",description="The sync status of the resource with Consul"
 // +kubebuilder:printcolumn:name="Last Synced",type="date",JSONPath=".status.lastSyncedTime",description="The last successful synced time of the resource with Consul"
+// +kubebuilder:printcolumn:name="Peering State",type="string",JSONPath=".status.peering.state",description="The state of the peering in Consul"
 // +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp",description="The age of the resource"
 // +kubebuilder:resource:shortName="peering-acceptor"
 type PeeringAcceptor struct {
@@ -57,11 +61,14 @@ type Peer struct {
 }
 
 type Secret struct {
-	// Name is the name of the secret generated.
+	// Name is the name of the secret generated. For the "vault" backend the
+	// secret is stored at <namespace>/<name> within the KV v2 secrets engine,
+	// prefixed with the admin partition if partitions are enabled.
 	Name string `json:"name,omitempty"`
 	// Key is the key of the secret generated.
 	Key string `json:"key,omitempty"`
-	// Backend is where the generated secret is stored. Currently supports the value: "kubernetes".
+	// Backend is where the generated secret is stored. Supports the values:
+	// "kubernetes" and "vault".
 	Backend string `json:"backend,omitempty"`
 }
 
@@ -80,11 +87,34 @@ type PeeringAcceptorStatus struct {
 	// LastSyncedTime is the last time the resource successfully synced with Consul.
 	// +optional
 	LastSyncedTime *metav1.Time `json:"lastSyncedTime,omitempty" description:"last time the condition transitioned from one status to another"`
+	// Peering is the state of the peering in Consul as of the last reconcile.
+	// +optional
+	Peering *PeeringStatus `json:"peering,omitempty"`
+}
+
+// PeeringStatus is the state of a peering in Consul.
+type PeeringStatus struct {
+	// State is the state of the peering, e.g. "ACTIVE", "FAILING" or "TERMINATED".
+	State string `json:"state,omitempty"`
+	// ImportedServices is the number of services imported from the peer.
+	ImportedServices int `json:"importedServices"`
+	// ExportedServices is the number of services exported to the peer.
+	ExportedServices int `json:"exportedServices"`
+	// LastHeartbeat is when the last heartbeat was received from the peer.
+	// +optional
+	LastHeartbeat *metav1.Time `json:"lastHeartbeat,omitempty"`
+	// LastReceive is when the last message was received from the peer.
+	// +optional
+	LastReceive *metav1.Time `json:"lastReceive,omitempty"`
+	// LastSend is when the last message was sent to the peer.
+	// +optional
+	LastSend *metav1.Time `json:"lastSend,omitempty"`
 }
 
 type SecretRefStatus struct {
 	Secret `json:",inline"`
-	// ResourceVersion is the resource version for the secret.
+	// ResourceVersion is the resource version for the secret. For the "vault"
+	// backend this is the version of the KV v2 secret.
 	ResourceVersion string `json:"resourceVersion,omitempty"`
 }
 
@@ -116,9 +146,8 @@ func (pa *PeeringAcceptor) Validate() error {
 			schema.GroupKind{Group: ConsulHashicorpGroup, Kind: PeeringAcceptorKubeKind},
 			pa.KubernetesName(), errs)
 	}
-	// Currently, the only supported backend is "kubernetes".
-	if pa.Spec.Peer.Secret.Backend != SecretBackendTypeKubernetes {
-		errs = append(errs, field.Invalid(field.NewPath("spec").Child("peer").Child("secret").Child("backend"), pa.Spec.Peer.Secret.Backend, `backend must be "kubernetes"`))
+	if err := pa.Spec.Peer.Secret.validateBackend(field.NewPath("spec").Child("peer").Child("secret").Child("backend")); err != nil {
+		errs = append(errs, err)
 	}
 	if len(errs) > 0 {
 		return apierrors.NewInvalid(
@@ -128,6 +157,14 @@ func (pa *PeeringAcceptor) Validate() error {
 	return nil
 }
 
+func (s *Secret) validateBackend(path *field.Path) *field.Error {
+	switch s.Backend {
+	case SecretBackendTypeKubernetes, SecretBackendTypeVault:
+		return nil
+	}
+	return field.Invalid(path, s.Backend, fmt.Sprintf("backend must be one of %q, %q", SecretBackendTypeKubernetes, SecretBackendTypeVault))
+}
+
 func (pa *PeeringAcceptor) SetSyncedCondition(status corev1.ConditionStatus, reason string, message string) {
 	pa.Status.Conditions = Conditions{
 		{
@@ -69,7 +69,7 @@ func TestPeeringAcceptor_Validate(t *testing.T) {
 				},
 			},
 			expectedErrMsgs: []string{
-				`spec.peer.secret.backend: Invalid value: "invalid": backend must be "kubernetes"`,
+				`spec.peer.secret.backend: Invalid value: "invalid": backend must be one of "kubernetes", "vault"`,
 			},
 		},
 	}
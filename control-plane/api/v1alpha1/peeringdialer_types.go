@@ -25,6 +25,7 @@ func init() {
 // PeeringDialer is the Schema for the peeringdialers API.
 // +kubebuilder:printcolumn:name="Synced",type="string",JSONPath=".status.conditions[?(@.type==\"Synced\")].status",description="The sync status of the resource with Consul"
 // +kubebuilder:printcolumn:name="Last Synced",type="date",JSONPath=".status.lastSyncedTime",description="The last successful synced time of the resource with Consul"
+// +kubebuilder:printcolumn:name="Peering State",type="string",JSONPath=".status.peering.state",description="The state of the peering in Consul"
 // +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp",description="The age of the resource"
 // +kubebuilder:resource:shortName="peering-dialer"
 type PeeringDialer struct {
@@ -65,6 +66,16 @@ type PeeringDialerStatus struct {
 	// LastSyncedTime is the last time the resource successfully synced with Consul.
 	// +optional
 	LastSyncedTime *metav1.Time `json:"lastSyncedTime,omitempty" description:"last time the condition transitioned from one status to another"`
+	// Peering is the state of the peering in Consul as of the last reconcile.
+	// +optional
+	Peering *PeeringStatus `json:"peering,omitempty"`
+	// RedialAttempts is the number of times the peering has been automatically
+	// re-established since it was last active.
+	// +optional
+	RedialAttempts int `json:"redialAttempts,omitempty"`
+	// LastRedialTime is the last time the peering was automatically re-established.
+	// +optional
+	LastRedialTime *metav1.Time `json:"lastRedialTime,omitempty"`
 }
 
 func (pd *PeeringDialer) Secret() *Secret {
@@ -98,9 +109,8 @@ func (pd *PeeringDialer) Validate() error {
 			schema.GroupKind{Group: ConsulHashicorpGroup, Kind: PeeringDialerKubeKind},
 			pd.KubernetesName(), errs)
 	}
-	// Currently, the only supported backend is "kubernetes".
-	if pd.Spec.Peer.Secret.Backend != "kubernetes" {
-		errs = append(errs, field.Invalid(field.NewPath("spec").Child("peer").Child("secret").Child("backend"), pd.Spec.Peer.Secret.Backend, `backend must be "kubernetes"`))
+	if err := pd.Spec.Peer.Secret.validateBackend(field.NewPath("spec").Child("peer").Child("secret").Child("backend")); err != nil {
+		errs = append(errs, err)
 	}
 	if len(errs) > 0 {
 		return apierrors.NewInvalid(
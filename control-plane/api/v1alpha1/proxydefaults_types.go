@@ -33,6 +33,10 @@ func init() {
 // ProxyDefaults is the Schema for the proxydefaults API
 // +kubebuilder:printcolumn:name="Synced",type="string",JSONPath=".status.conditions[?(@.type==\"Synced\")].status",description="The sync status of the resource with Consul"
 // +kubebuilder:printcolumn:name="Last Synced",type="date",JSONPath=".status.lastSyncedTime",description="The last successful synced time of the resource with Consul"
+// +kubebuilder:printcolumn:name="Consul Namespace",type="string",JSONPath=".status.consulNamespace",description="The Consul namespace the resource was written to",priority=1
+// +kubebuilder:printcolumn:name="Consul Partition",type="string",JSONPath=".status.consulPartition",description="The Consul admin partition the resource was written to",priority=1
+// +kubebuilder:printcolumn:name="Datacenter",type="string",JSONPath=".status.datacenter",description="The Consul datacenter that manages the resource",priority=1
+// +kubebuilder:printcolumn:name="Modify Index",type="integer",JSONPath=".status.modifyIndex",description="The Consul index at which the resource was last modified",priority=1
 // +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp",description="The age of the resource"
 // +kubebuilder:resource:shortName="proxy-defaults"
 type ProxyDefaults struct {
@@ -4,6 +4,7 @@
 package v1alpha1
 
 import (
+	"github.com/hashicorp/consul-k8s/control-plane/api/common"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
@@ -81,6 +82,26 @@ type Status struct {
 	// LastSyncedTime is the last time the resource successfully synced with Consul.
 	// +optional
 	LastSyncedTime *metav1.Time `json:"lastSyncedTime,omitempty" description:"last time the condition transitioned from one status to another"`
+
+	// ConsulNamespace is the Consul namespace the resource was written to.
+	// +optional
+	ConsulNamespace string `json:"consulNamespace,omitempty"`
+
+	// ConsulPartition is the Consul admin partition the resource was written to.
+	// +optional
+	ConsulPartition string `json:"consulPartition,omitempty"`
+
+	// Datacenter is the Consul datacenter that manages the resource.
+	// +optional
+	Datacenter string `json:"datacenter,omitempty"`
+
+	// ModifyIndex is the Consul index at which the config entry was last modified.
+	// +optional
+	ModifyIndex uint64 `json:"modifyIndex,omitempty"`
+
+	// LastAppliedSpecHash is a hash of the config entry last written to Consul.
+	// +optional
+	LastAppliedSpecHash string `json:"lastAppliedSpecHash,omitempty"`
 }
 
 func (s *Status) GetCondition(t ConditionType) *Condition {
@@ -91,3 +112,23 @@ func (s *Status) GetCondition(t ConditionType) *Condition {
 	}
 	return nil
 }
+
+// SetConsulStatus records where the resource was last written in Consul.
+func (s *Status) SetConsulStatus(status common.ConsulStatus) {
+	s.ConsulNamespace = status.Namespace
+	s.ConsulPartition = status.Partition
+	s.Datacenter = status.Datacenter
+	s.ModifyIndex = status.ModifyIndex
+	s.LastAppliedSpecHash = status.SpecHash
+}
+
+// ConsulStatus returns where the resource was last written in Consul.
+func (s *Status) ConsulStatus() common.ConsulStatus {
+	return common.ConsulStatus{
+		Namespace:   s.ConsulNamespace,
+		Partition:   s.ConsulPartition,
+		Datacenter:  s.Datacenter,
+		ModifyIndex: s.ModifyIndex,
+		SpecHash:    s.LastAppliedSpecHash,
+	}
+}
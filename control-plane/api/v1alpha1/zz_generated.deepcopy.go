@@ -63,6 +63,85 @@ func (in Conditions) DeepCopy() Conditions {
 	return *out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ConfigEntry) DeepCopyInto(out *ConfigEntry) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ConfigEntry.
+func (in *ConfigEntry) DeepCopy() *ConfigEntry {
+	if in == nil {
+		return nil
+	}
+	out := new(ConfigEntry)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ConfigEntry) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ConfigEntryList) DeepCopyInto(out *ConfigEntryList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ConfigEntry, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ConfigEntryList.
+func (in *ConfigEntryList) DeepCopy() *ConfigEntryList {
+	if in == nil {
+		return nil
+	}
+	out := new(ConfigEntryList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ConfigEntryList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ConfigEntrySpec) DeepCopyInto(out *ConfigEntrySpec) {
+	*out = *in
+	if in.Spec != nil {
+		in, out := &in.Spec, &out.Spec
+		*out = make(json.RawMessage, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ConfigEntrySpec.
+func (in *ConfigEntrySpec) DeepCopy() *ConfigEntrySpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ConfigEntrySpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *CookieConfig) DeepCopyInto(out *CookieConfig) {
 	*out = *in
@@ -1070,6 +1149,11 @@ func (in *PeeringAcceptorStatus) DeepCopyInto(out *PeeringAcceptorStatus) {
 		in, out := &in.LastSyncedTime, &out.LastSyncedTime
 		*out = (*in).DeepCopy()
 	}
+	if in.Peering != nil {
+		in, out := &in.Peering, &out.Peering
+		*out = new(PeeringStatus)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PeeringAcceptorStatus.
@@ -1185,6 +1269,15 @@ func (in *PeeringDialerStatus) DeepCopyInto(out *PeeringDialerStatus) {
 		in, out := &in.LastSyncedTime, &out.LastSyncedTime
 		*out = (*in).DeepCopy()
 	}
+	if in.Peering != nil {
+		in, out := &in.Peering, &out.Peering
+		*out = new(PeeringStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.LastRedialTime != nil {
+		in, out := &in.LastRedialTime, &out.LastRedialTime
+		*out = (*in).DeepCopy()
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PeeringDialerStatus.
@@ -1212,6 +1305,33 @@ func (in *PeeringMeshConfig) DeepCopy() *PeeringMeshConfig {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PeeringStatus) DeepCopyInto(out *PeeringStatus) {
+	*out = *in
+	if in.LastHeartbeat != nil {
+		in, out := &in.LastHeartbeat, &out.LastHeartbeat
+		*out = (*in).DeepCopy()
+	}
+	if in.LastReceive != nil {
+		in, out := &in.LastReceive, &out.LastReceive
+		*out = (*in).DeepCopy()
+	}
+	if in.LastSend != nil {
+		in, out := &in.LastSend, &out.LastSend
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PeeringStatus.
+func (in *PeeringStatus) DeepCopy() *PeeringStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(PeeringStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ProxyDefaults) DeepCopyInto(out *ProxyDefaults) {
 	*out = *in
@@ -0,0 +1,318 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+// Package validate validates Consul custom resource manifests without a
+// Kubernetes cluster, the same way the admission webhooks validate them, and
+// checks the references between the resources of a set.
+package validate
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/consul-k8s/control-plane/api/v1alpha1"
+	"gopkg.in/yaml.v3"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	sigsyaml "sigs.k8s.io/yaml"
+)
+
+// scheme has the custom resource types that can be validated.
+var scheme = runtime.NewScheme()
+
+func init() {
+	if err := v1alpha1.AddToScheme(scheme); err != nil {
+		panic(err)
+	}
+}
+
+// manifestExtensions are the extensions of the files read from directories.
+var manifestExtensions = map[string]bool{".yaml": true, ".yml": true, ".json": true}
+
+var (
+	documentSeparator = regexp.MustCompile(`^---(\s.*)?$`)
+	unknownField      = regexp.MustCompile(`unknown field "([^"]+)"`)
+)
+
+// Resource is a Consul custom resource decoded from a manifest.
+type Resource struct {
+	// File and Line locate the start of the resource's document.
+	File string
+	Line int
+	// Object is the decoded resource, e.g. *v1alpha1.ServiceRouter.
+	Object runtime.Object
+
+	// node is the parsed YAML of the document, used to find the lines of fields.
+	node *yaml.Node
+}
+
+// Kind returns the Kubernetes kind of the resource, e.g. ServiceRouter.
+func (r Resource) Kind() string {
+	return r.Object.GetObjectKind().GroupVersionKind().Kind
+}
+
+// Load decodes the Consul custom resources in files and directories.
+// Directories are walked recursively for .yaml, .yml and .json files.
+// Documents that aren't Consul resources are skipped. Resources without a
+// namespace are put in namespace. Problems decoding documents are returned
+// alongside the resources that were decoded; the error is only set if a file
+// couldn't be read.
+func Load(paths []string, namespace string) ([]Resource, []Problem, error) {
+	var resources []Resource
+	var problems []Problem
+	for _, path := range paths {
+		err := filepath.WalkDir(path, func(file string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			// Files given explicitly are read whatever their extension.
+			if d.IsDir() || (file != path && !manifestExtensions[filepath.Ext(file)]) {
+				return nil
+			}
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return err
+			}
+			r, p := Decode(file, data, namespace)
+			resources = append(resources, r...)
+			problems = append(problems, p...)
+			return nil
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return resources, problems, nil
+}
+
+// Decode decodes the Consul custom resources in the YAML or JSON documents of
+// a file. Fields that aren't part of a resource's schema are problems, since
+// the API server would silently drop them.
+func Decode(file string, data []byte, namespace string) ([]Resource, []Problem) {
+	var resources []Resource
+	var problems []Problem
+	for _, doc := range splitDocuments(data) {
+		var obj unstructured.Unstructured
+		if err := sigsyaml.Unmarshal(doc.data, &obj.Object); err != nil {
+			problems = append(problems, Problem{File: file, Line: doc.line, Severity: SeverityError,
+				Message: fmt.Sprintf("invalid YAML: %s", err)})
+			continue
+		}
+		if len(obj.Object) == 0 {
+			continue
+		}
+		gvk := obj.GroupVersionKind()
+		if gvk.Group != v1alpha1.GroupVersion.Group {
+			continue
+		}
+
+		var node yaml.Node
+		if err := yaml.Unmarshal(doc.data, &node); err != nil {
+			problems = append(problems, Problem{File: file, Line: doc.line, Severity: SeverityError,
+				Message: fmt.Sprintf("invalid YAML: %s", err)})
+			continue
+		}
+		r := Resource{File: file, Line: doc.line, node: &node}
+		if len(node.Content) > 0 {
+			r.Line = doc.line + node.Content[0].Line - 1
+		}
+		problem := Problem{File: file, Line: r.Line, Kind: gvk.Kind, Name: obj.GetName(), Severity: SeverityError}
+
+		if gvk.Version != v1alpha1.GroupVersion.Version {
+			problem.Message = fmt.Sprintf("unsupported version %q, only %s is supported", gvk.Version, v1alpha1.GroupVersion)
+			problems = append(problems, problem)
+			continue
+		}
+		typed, err := scheme.New(gvk)
+		if err != nil || !validatable(typed) {
+			problem.Message = fmt.Sprintf("unsupported kind %q", gvk.Kind)
+			problems = append(problems, problem)
+			continue
+		}
+
+		jsonData, err := sigsyaml.YAMLToJSON(doc.data)
+		if err != nil {
+			problem.Message = err.Error()
+			problems = append(problems, problem)
+			continue
+		}
+		decoder := json.NewDecoder(bytes.NewReader(jsonData))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(typed); err != nil {
+			problem.Line = r.decodeErrorLine(err)
+			problem.Message = err.Error()
+			problems = append(problems, problem)
+			continue
+		}
+		if obj.GetNamespace() == "" {
+			if o, ok := typed.(interface{ SetNamespace(string) }); ok {
+				o.SetNamespace(namespace)
+			}
+		}
+		r.Object = typed
+		resources = append(resources, r)
+	}
+	return resources, problems
+}
+
+// validatable returns whether obj can be validated, i.e. it's a config entry
+// or a peering resource.
+func validatable(obj runtime.Object) bool {
+	switch obj.(type) {
+	case configEntry, peering:
+		return true
+	}
+	return false
+}
+
+// decodeErrorLine returns the line of the field that couldn't be decoded, or
+// the start of the resource if it can't be located.
+func (r Resource) decodeErrorLine(err error) int {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return r.line(typeErr.Field)
+	}
+	if m := unknownField.FindStringSubmatch(err.Error()); m != nil {
+		// The error doesn't have the path of the unknown field, so the first
+		// key with its name is used.
+		if n := findKey(r.node, m[1]); n != nil {
+			return r.Line + n.Line - r.node.Content[0].Line
+		}
+	}
+	return r.Line
+}
+
+// line returns the line of the field at path, e.g. spec.routes[0].match, or of
+// its closest ancestor that's in the document.
+func (r Resource) line(path string) int {
+	if r.node == nil || len(r.node.Content) == 0 {
+		return r.Line
+	}
+	root := r.node.Content[0]
+	n, at := root, root
+	for _, segment := range splitPath(path) {
+		value, key := child(n, segment)
+		if value == nil {
+			break
+		}
+		n, at = value, key
+	}
+	return r.Line + at.Line - root.Line
+}
+
+// splitPath splits a field path such as spec.routes[0].match or
+// spec.subsets[v1] into its names, indexes and keys.
+func splitPath(path string) []string {
+	var segments []string
+	for _, part := range strings.Split(path, ".") {
+		for part != "" {
+			open := strings.Index(part, "[")
+			if open == -1 {
+				segments = append(segments, part)
+				break
+			}
+			if open > 0 {
+				segments = append(segments, part[:open])
+			}
+			end := strings.Index(part, "]")
+			if end < open {
+				segments = append(segments, part[open:])
+				break
+			}
+			segments = append(segments, part[open+1:end])
+			part = part[end+1:]
+		}
+	}
+	return segments
+}
+
+// child returns the value of key in a mapping node or the element at index key
+// of a sequence node, along with the node that starts it: the key of mapping
+// values, or the element itself. If n is a sequence and key isn't an index,
+// key is looked up in the first element that has it.
+func child(n *yaml.Node, key string) (*yaml.Node, *yaml.Node) {
+	switch n.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if n.Content[i].Value == key {
+				return n.Content[i+1], n.Content[i]
+			}
+		}
+	case yaml.SequenceNode:
+		if index, err := strconv.Atoi(key); err == nil {
+			if index >= 0 && index < len(n.Content) {
+				return n.Content[index], n.Content[index]
+			}
+			return nil, nil
+		}
+		for _, element := range n.Content {
+			if value, start := child(element, key); value != nil {
+				return value, start
+			}
+		}
+	}
+	return nil, nil
+}
+
+// findKey returns the first key node named key in a depth-first walk of n.
+func findKey(n *yaml.Node, key string) *yaml.Node {
+	if n == nil {
+		return nil
+	}
+	if n.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if n.Content[i].Value == key {
+				return n.Content[i]
+			}
+		}
+	}
+	for _, c := range n.Content {
+		if found := findKey(c, key); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// document is a YAML document of a file and the line it starts at.
+type document struct {
+	data []byte
+	line int
+}
+
+// splitDocuments splits YAML data into its documents.
+func splitDocuments(data []byte) []document {
+	var docs []document
+	current := document{line: 1}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(data)+1)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if documentSeparator.Match(scanner.Bytes()) {
+			docs = append(docs, current)
+			current = document{line: line + 1}
+			continue
+		}
+		current.data = append(current.data, scanner.Bytes()...)
+		current.data = append(current.data, '\n')
+	}
+	docs = append(docs, current)
+
+	nonEmpty := docs[:0]
+	for _, doc := range docs {
+		if len(bytes.TrimSpace(doc.data)) > 0 {
+			nonEmpty = append(nonEmpty, doc)
+		}
+	}
+	return nonEmpty
+}
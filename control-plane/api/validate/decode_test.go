@@ -0,0 +1,185 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package validate
+
+import (
+	"testing"
+
+	"github.com/hashicorp/consul-k8s/control-plane/api/v1alpha1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad(t *testing.T) {
+	resources, problems, err := Load([]string{"testdata/manifests"}, "default")
+	require.NoError(t, err)
+	require.Empty(t, problems)
+
+	var found []string
+	for _, r := range resources {
+		found = append(found, r.location()+" "+r.Kind())
+	}
+	require.Equal(t, []string{
+		"testdata/manifests/nested/intentions.yml:1 ServiceIntentions",
+		"testdata/manifests/routing.yaml:1 ServiceDefaults",
+		"testdata/manifests/routing.yaml:8 ServiceResolver",
+		"testdata/manifests/routing.yaml:20 ServiceRouter",
+		"testdata/manifests/routing.yaml:32 ServiceSplitter",
+	}, found)
+
+	_, _, err = Load([]string{"testdata/missing"}, "default")
+	require.Error(t, err)
+}
+
+func TestDecode(t *testing.T) {
+	cases := map[string]struct {
+		manifest  string
+		resources int
+		problems  []string
+	}{
+		"Non-Consul resources are skipped": {
+			manifest: `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+---
+# comment only
+`,
+		},
+		"Unknown field": {
+			manifest: `---
+apiVersion: consul.hashicorp.com/v1alpha1
+kind: ServiceRouter
+metadata:
+  name: web
+spec:
+  routes:
+    - match:
+        http:
+          pathPrefx: /v2
+`,
+			problems: []string{`file.yaml:10: error: ServiceRouter/web: json: unknown field "pathPrefx"`},
+		},
+		"Wrong type": {
+			manifest: `apiVersion: consul.hashicorp.com/v1alpha1
+kind: ServiceSplitter
+metadata:
+  name: web
+spec:
+  splits:
+    - weight: "90"
+`,
+			problems: []string{"file.yaml:7: error: ServiceSplitter/web: json: cannot unmarshal string into Go struct field ServiceSplitter.spec.splits.0.weight of type float32"},
+		},
+		"Unsupported version and kind": {
+			manifest: `apiVersion: consul.hashicorp.com/v1beta1
+kind: ServiceRouter
+metadata:
+  name: web
+---
+apiVersion: consul.hashicorp.com/v1alpha1
+kind: ServiceRouterList
+metadata:
+  name: web
+`,
+			problems: []string{
+				`file.yaml:1: error: ServiceRouter/web: unsupported version "v1beta1", only consul.hashicorp.com/v1alpha1 is supported`,
+				`file.yaml:6: error: ServiceRouterList/web: unsupported kind "ServiceRouterList"`,
+			},
+		},
+		"Invalid YAML": {
+			manifest: `apiVersion: consul.hashicorp.com/v1alpha1
+kind: [
+`,
+			problems: []string{"file.yaml:1: error: invalid YAML: error converting YAML to JSON: yaml: line 2: did not find expected node content"},
+		},
+		"Multiple documents": {
+			manifest: `apiVersion: consul.hashicorp.com/v1alpha1
+kind: ServiceDefaults
+metadata:
+  name: web
+---
+apiVersion: consul.hashicorp.com/v1alpha1
+kind: PeeringDialer
+metadata:
+  name: dc2
+`,
+			resources: 2,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			resources, problems := Decode("file.yaml", []byte(tc.manifest), "default")
+			require.Len(t, resources, tc.resources)
+			var got []string
+			for _, p := range problems {
+				got = append(got, p.String())
+			}
+			require.Equal(t, tc.problems, got)
+		})
+	}
+}
+
+func TestDecode_DefaultsNamespace(t *testing.T) {
+	resources, problems := Decode("file.yaml", []byte(`apiVersion: consul.hashicorp.com/v1alpha1
+kind: ServiceDefaults
+metadata:
+  name: web
+---
+apiVersion: consul.hashicorp.com/v1alpha1
+kind: ServiceDefaults
+metadata:
+  name: api
+  namespace: backend
+`), "frontend")
+	require.Empty(t, problems)
+	require.Len(t, resources, 2)
+	require.Equal(t, "frontend", resources[0].Object.(*v1alpha1.ServiceDefaults).Namespace)
+	require.Equal(t, "backend", resources[1].Object.(*v1alpha1.ServiceDefaults).Namespace)
+}
+
+func TestResourceLine(t *testing.T) {
+	resources, problems := Decode("file.yaml", []byte(`# leading comment
+---
+apiVersion: consul.hashicorp.com/v1alpha1
+kind: ServiceResolver
+metadata:
+  name: web
+spec:
+  subsets:
+    v1:
+      filter: v1
+  failover:
+    v1:
+      targets:
+        - service: api
+        - service: db
+          serviceSubset: v2
+`), "default")
+	require.Empty(t, problems)
+	require.Len(t, resources, 1)
+	r := resources[0]
+
+	cases := map[string]int{
+		"":                             3,
+		"spec":                         7,
+		"spec.subsets[v1].filter":      10,
+		"spec.failover[v1].targets[1]": 15,
+		"spec.failover[v1].targets[1].serviceSubset": 16,
+		"spec.failover[v1].targets[5]":               13,
+		"spec.failover.v1.targets.serviceSubset":     16,
+		"spec.loadBalancer.policy":                   7,
+	}
+	for path, line := range cases {
+		require.Equal(t, line, r.line(path), path)
+	}
+}
+
+func TestSplitPath(t *testing.T) {
+	require.Equal(t, []string{"spec", "routes", "0", "match"}, splitPath("spec.routes[0].match"))
+	require.Equal(t, []string{"spec", "failover", "v1", "targets", "2"}, splitPath("spec.failover[v1].targets[2]"))
+	require.Equal(t, []string{"metadata", "name"}, splitPath("metadata.name"))
+	require.Empty(t, splitPath(""))
+}
@@ -0,0 +1,302 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package validate
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hashicorp/consul-k8s/control-plane/api/common"
+	"github.com/hashicorp/consul-k8s/control-plane/api/v1alpha1"
+	"github.com/hashicorp/consul-k8s/control-plane/namespaces"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// httpProtocols are the protocols that support routers, splitters and L7
+// intentions.
+var httpProtocols = map[string]bool{"http": true, "http2": true, "grpc": true}
+
+// singletonNames are the names that singleton config entries must have.
+var singletonNames = map[string]string{
+	v1alpha1.ProxyDefaultsKubeKind: common.Global,
+	v1alpha1.MeshKubeKind:          common.Mesh,
+}
+
+// service identifies a service in Consul.
+type service struct {
+	namespace string
+	name      string
+}
+
+func (s service) String() string {
+	if s.namespace == "" {
+		return s.name
+	}
+	return s.namespace + "/" + s.name
+}
+
+// checker checks the resources of a set against each other.
+type checker struct {
+	consulMeta common.ConsulMeta
+	problems   []Problem
+
+	serviceDefaults map[service]Resource
+	resolvers       map[service]Resource
+	proxyDefaults   *Resource
+}
+
+// checkSet checks the resources of a set against each other.
+func checkSet(resources []Resource, consulMeta common.ConsulMeta) []Problem {
+	c := &checker{
+		consulMeta:      consulMeta,
+		serviceDefaults: make(map[service]Resource),
+		resolvers:       make(map[service]Resource),
+	}
+	c.checkDuplicates(resources)
+
+	// Duplicates are reported above, so the first definition is used.
+	for _, r := range resources {
+		switch obj := r.Object.(type) {
+		case *v1alpha1.ServiceDefaults:
+			if svc := c.service(obj, "", obj.Name); !has(c.serviceDefaults, svc) {
+				c.serviceDefaults[svc] = r
+			}
+		case *v1alpha1.ServiceResolver:
+			if svc := c.service(obj, "", obj.Name); !has(c.resolvers, svc) {
+				c.resolvers[svc] = r
+			}
+		case *v1alpha1.ProxyDefaults:
+			if c.proxyDefaults == nil {
+				r := r
+				c.proxyDefaults = &r
+			}
+		}
+	}
+
+	for _, r := range resources {
+		switch obj := r.Object.(type) {
+		case *v1alpha1.ServiceRouter:
+			c.checkRouter(r, obj)
+		case *v1alpha1.ServiceSplitter:
+			c.checkSplitter(r, obj)
+		case *v1alpha1.ServiceResolver:
+			c.checkResolver(r, obj)
+		case *v1alpha1.ServiceIntentions:
+			c.checkIntentions(r, obj)
+		}
+	}
+	return c.problems
+}
+
+// checkDuplicates checks that no two resources configure the same Consul
+// config entry and that there's at most one of each singleton resource.
+func (c *checker) checkDuplicates(resources []Resource) {
+	type key struct {
+		kind      string
+		namespace string
+		name      string
+	}
+	kube := make(map[key]Resource)
+	consul := make(map[key]Resource)
+	singletons := make(map[string]Resource)
+
+	for _, r := range resources {
+		kubeKey := key{kind: r.Kind(), namespace: r.namespace(), name: r.name()}
+		if first, ok := kube[kubeKey]; ok {
+			c.add(r, SeverityError, "", fmt.Sprintf("duplicate resource, already defined at %s", first.location()))
+			continue
+		}
+		kube[kubeKey] = r
+
+		entry, ok := r.Object.(configEntry)
+		if !ok {
+			continue
+		}
+		if name, ok := singletonNames[entry.KubeKind()]; ok && entry.KubernetesName() != name {
+			c.add(r, SeverityError, "metadata.name", fmt.Sprintf("%s resource name must be %q", r.Kind(), name))
+		}
+		if _, ok := singletonNames[entry.KubeKind()]; ok || entry.KubeKind() == v1alpha1.ExportedServicesKubeKind {
+			if first, ok := singletons[r.Kind()]; ok {
+				c.add(r, SeverityError, "", fmt.Sprintf("%s resource already defined at %s, only one is supported", r.Kind(), first.location()))
+				continue
+			}
+			singletons[r.Kind()] = r
+		}
+
+		consulKey := key{kind: entry.ConsulKind(), namespace: c.consulNamespace(entry), name: entry.ConsulName()}
+		if first, ok := consul[consulKey]; ok {
+			c.add(r, SeverityError, "", fmt.Sprintf("configures the same Consul config entry as %s/%s at %s",
+				first.Kind(), first.name(), first.location()))
+			continue
+		}
+		consul[consulKey] = r
+	}
+}
+
+func (c *checker) checkRouter(r Resource, router *v1alpha1.ServiceRouter) {
+	self := c.service(router, "", router.Name)
+	c.requireHTTP(r, "", self, "ServiceRouter")
+
+	path := field.NewPath("spec").Child("routes")
+	for i, route := range router.Spec.Routes {
+		if route.Destination == nil {
+			continue
+		}
+		dest := self
+		if route.Destination.Service != "" || route.Destination.Namespace != "" {
+			dest = c.service(router, route.Destination.Namespace, orDefault(route.Destination.Service, router.Name))
+		}
+		c.checkSubset(r, path.Index(i).Child("destination", "serviceSubset"), dest, route.Destination.ServiceSubset)
+	}
+}
+
+func (c *checker) checkSplitter(r Resource, splitter *v1alpha1.ServiceSplitter) {
+	self := c.service(splitter, "", splitter.Name)
+	c.requireHTTP(r, "", self, "ServiceSplitter")
+
+	path := field.NewPath("spec").Child("splits")
+	for i, split := range splitter.Spec.Splits {
+		dest := c.service(splitter, split.Namespace, orDefault(split.Service, splitter.Name))
+		c.checkSubset(r, path.Index(i).Child("serviceSubset"), dest, split.ServiceSubset)
+	}
+}
+
+func (c *checker) checkResolver(r Resource, resolver *v1alpha1.ServiceResolver) {
+	self := c.service(resolver, "", resolver.Name)
+	path := field.NewPath("spec")
+
+	if subset := resolver.Spec.DefaultSubset; subset != "" {
+		if _, ok := resolver.Spec.Subsets[subset]; !ok {
+			c.add(r, SeverityError, path.Child("defaultSubset").String(),
+				fmt.Sprintf("service subset %q is not defined in spec.subsets", subset))
+		}
+	}
+	if redirect := resolver.Spec.Redirect; redirect != nil && redirect.Peer == "" && redirect.Datacenter == "" && redirect.SamenessGroup == "" {
+		dest := c.service(resolver, redirect.Namespace, orDefault(redirect.Service, resolver.Name))
+		c.checkSubset(r, path.Child("redirect", "serviceSubset"), dest, redirect.ServiceSubset)
+	}
+	for subset, failover := range resolver.Spec.Failover {
+		if len(failover.Datacenters) == 0 && failover.SamenessGroup == "" {
+			dest := c.service(resolver, failover.Namespace, orDefault(failover.Service, resolver.Name))
+			c.checkSubset(r, path.Child("failover").Key(subset).Child("serviceSubset"), dest, failover.ServiceSubset)
+		}
+		for i, target := range failover.Targets {
+			if target.Peer != "" || target.Datacenter != "" {
+				continue
+			}
+			dest := c.service(resolver, target.Namespace, orDefault(target.Service, self.name))
+			c.checkSubset(r, path.Child("failover").Key(subset).Child("targets").Index(i).Child("serviceSubset"), dest, target.ServiceSubset)
+		}
+	}
+}
+
+func (c *checker) checkIntentions(r Resource, intentions *v1alpha1.ServiceIntentions) {
+	if intentions.Spec.Destination.Name == common.WildcardNamespace {
+		return
+	}
+	for _, source := range intentions.Spec.Sources {
+		if len(source.Permissions) > 0 {
+			dest := c.service(intentions, intentions.Spec.Destination.Namespace, intentions.Spec.Destination.Name)
+			c.requireHTTP(r, "spec.destination", dest, "ServiceIntentions with L7 permissions")
+			return
+		}
+	}
+}
+
+// requireHTTP checks that the protocol of svc, set by its ServiceDefaults or
+// the ProxyDefaults, supports L7 features.
+func (c *checker) requireHTTP(r Resource, fieldPath string, svc service, what string) {
+	protocol, source := c.protocol(svc)
+	switch {
+	case source == nil:
+		c.add(r, SeverityWarning, fieldPath, fmt.Sprintf(
+			"%s requires service %q to have protocol http, http2 or grpc, but no ServiceDefaults or ProxyDefaults in the set sets its protocol",
+			what, svc))
+	case !httpProtocols[protocol]:
+		c.add(r, SeverityError, fieldPath, fmt.Sprintf(
+			"%s requires service %q to have protocol http, http2 or grpc, but %s/%s at %s sets it to %q",
+			what, svc, source.Kind(), source.name(), source.location(), protocol))
+	}
+}
+
+// protocol returns the protocol of svc and the resource that sets it, or nil
+// if no resource in the set does.
+func (c *checker) protocol(svc service) (string, *Resource) {
+	if r, ok := c.serviceDefaults[svc]; ok {
+		if protocol := r.Object.(*v1alpha1.ServiceDefaults).Spec.Protocol; protocol != "" {
+			return protocol, &r
+		}
+	}
+	if c.proxyDefaults != nil {
+		var config struct {
+			Protocol string `json:"protocol"`
+		}
+		raw := c.proxyDefaults.Object.(*v1alpha1.ProxyDefaults).Spec.Config
+		if raw != nil && json.Unmarshal(raw, &config) == nil && config.Protocol != "" {
+			return config.Protocol, c.proxyDefaults
+		}
+	}
+	return "", nil
+}
+
+// checkSubset checks that subset is defined by the ServiceResolver of svc.
+func (c *checker) checkSubset(r Resource, path *field.Path, svc service, subset string) {
+	if subset == "" {
+		return
+	}
+	resolver, ok := c.resolvers[svc]
+	if !ok {
+		c.add(r, SeverityWarning, path.String(), fmt.Sprintf(
+			"service subset %q of service %q can't be checked, there is no ServiceResolver for the service in the set", subset, svc))
+		return
+	}
+	if _, ok := resolver.Object.(*v1alpha1.ServiceResolver).Spec.Subsets[subset]; !ok {
+		c.add(r, SeverityError, path.String(), fmt.Sprintf(
+			"service subset %q is not defined by ServiceResolver/%s at %s", subset, resolver.name(), resolver.location()))
+	}
+}
+
+// service returns the service named name referenced from entry. An empty
+// namespace refers to the namespace of entry.
+func (c *checker) service(entry configEntry, namespace, name string) service {
+	if !c.consulMeta.NamespacesEnabled {
+		return service{name: name}
+	}
+	if namespace == "" {
+		namespace = c.consulNamespace(entry)
+	}
+	return service{namespace: namespace, name: name}
+}
+
+// consulNamespace returns the Consul namespace that the config entry is
+// written to, the same way the config entry controller determines it.
+func (c *checker) consulNamespace(entry configEntry) string {
+	if !c.consulMeta.NamespacesEnabled {
+		return ""
+	}
+	namespace := entry.ConsulMirroringNS()
+	if _, ok := entry.(*v1alpha1.ServiceIntentions); ok && namespace != "" {
+		return namespace
+	}
+	if entry.ConsulGlobalResource() || namespace == common.WildcardNamespace {
+		return namespace
+	}
+	return namespaces.ConsulNamespace(namespace, true, c.consulMeta.DestinationNamespace, c.consulMeta.Mirroring, c.consulMeta.Prefix)
+}
+
+func (c *checker) add(r Resource, severity Severity, fieldPath, message string) {
+	c.problems = append(c.problems, r.problem(severity, fieldPath, message))
+}
+
+func has(m map[service]Resource, svc service) bool {
+	_, ok := m[svc]
+	return ok
+}
+
+func orDefault(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
@@ -0,0 +1,155 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package validate
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/hashicorp/consul-k8s/control-plane/api/common"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// Severity is how serious a problem is.
+type Severity string
+
+const (
+	// SeverityError is a problem that would make the API server or Consul
+	// reject the resource.
+	SeverityError Severity = "error"
+	// SeverityWarning is a problem that depends on resources outside of the
+	// set, e.g. a reference to a ServiceResolver that isn't in the set.
+	SeverityWarning Severity = "warning"
+)
+
+// Problem is an issue with a resource, anchored to the line of the manifest
+// where it is.
+type Problem struct {
+	File     string   `json:"file"`
+	Line     int      `json:"line"`
+	Kind     string   `json:"kind,omitempty"`
+	Name     string   `json:"name,omitempty"`
+	Field    string   `json:"field,omitempty"`
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+}
+
+// String formats the problem as file:line: severity: Kind/name: field: message.
+func (p Problem) String() string {
+	s := fmt.Sprintf("%s:%d: %s: ", p.File, p.Line, p.Severity)
+	if p.Kind != "" {
+		s += fmt.Sprintf("%s/%s: ", p.Kind, p.Name)
+	}
+	if p.Field != "" {
+		s += p.Field + ": "
+	}
+	return s + p.Message
+}
+
+// configEntry is implemented by the config entry custom resources.
+type configEntry = common.ConfigEntryResource
+
+// peering is implemented by the peering custom resources, which are validated
+// without the Consul installation's settings.
+type peering interface {
+	runtime.Object
+	Validate() error
+}
+
+// Validate validates the resources the way their admission webhooks do, after
+// defaulting their namespace fields, and checks the resources of the set
+// against each other: duplicates, singletons, protocols required by L7
+// resources and service subset references.
+//
+// Resources are defaulted in place.
+func Validate(resources []Resource, consulMeta common.ConsulMeta) []Problem {
+	var problems []Problem
+	for _, r := range resources {
+		var err error
+		switch obj := r.Object.(type) {
+		case configEntry:
+			obj.DefaultNamespaceFields(consulMeta)
+			err = obj.Validate(consulMeta)
+		case peering:
+			err = obj.Validate()
+		}
+		problems = append(problems, r.problems(err)...)
+	}
+	problems = append(problems, checkSet(resources, consulMeta)...)
+
+	SortProblems(problems)
+	return problems
+}
+
+// SortProblems sorts problems by file and line.
+func SortProblems(problems []Problem) {
+	sort.SliceStable(problems, func(i, j int) bool {
+		if problems[i].File != problems[j].File {
+			return problems[i].File < problems[j].File
+		}
+		return problems[i].Line < problems[j].Line
+	})
+}
+
+// HasErrors returns whether any of the problems is an error.
+func HasErrors(problems []Problem) bool {
+	for _, p := range problems {
+		if p.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// problems converts a validation error into problems. Errors that list the
+// invalid fields get a problem for each field, at the field's line.
+func (r Resource) problems(err error) []Problem {
+	if err == nil {
+		return nil
+	}
+	var statusErr *apierrors.StatusError
+	if errors.As(err, &statusErr) && statusErr.ErrStatus.Details != nil && len(statusErr.ErrStatus.Details.Causes) > 0 {
+		var problems []Problem
+		for _, cause := range statusErr.ErrStatus.Details.Causes {
+			problems = append(problems, r.problem(SeverityError, cause.Field, cause.Message))
+		}
+		return problems
+	}
+	return []Problem{r.problem(SeverityError, "", err.Error())}
+}
+
+// problem returns a problem with the resource at the line of field.
+func (r Resource) problem(severity Severity, field, message string) Problem {
+	return Problem{
+		File:     r.File,
+		Line:     r.line(field),
+		Kind:     r.Kind(),
+		Name:     r.name(),
+		Field:    field,
+		Severity: severity,
+		Message:  message,
+	}
+}
+
+func (r Resource) name() string {
+	if obj, ok := r.Object.(metav1.Object); ok {
+		return obj.GetName()
+	}
+	return ""
+}
+
+func (r Resource) namespace() string {
+	if obj, ok := r.Object.(metav1.Object); ok {
+		return obj.GetNamespace()
+	}
+	return ""
+}
+
+// location returns the file and line of the resource.
+func (r Resource) location() string {
+	return fmt.Sprintf("%s:%d", r.File, r.Line)
+}
@@ -0,0 +1,335 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package validate
+
+import (
+	"testing"
+
+	"github.com/hashicorp/consul-k8s/control-plane/api/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	cases := map[string]struct {
+		manifest   string
+		consulMeta common.ConsulMeta
+		problems   []string
+	}{
+		"Valid set": {
+			manifest: `apiVersion: consul.hashicorp.com/v1alpha1
+kind: ServiceDefaults
+metadata:
+  name: web
+spec:
+  protocol: http
+---
+apiVersion: consul.hashicorp.com/v1alpha1
+kind: ServiceResolver
+metadata:
+  name: web
+spec:
+  subsets:
+    v1:
+      filter: 'Service.Meta.version == v1'
+---
+apiVersion: consul.hashicorp.com/v1alpha1
+kind: ServiceRouter
+metadata:
+  name: web
+spec:
+  routes:
+    - destination:
+        serviceSubset: v1
+`,
+		},
+		"Webhook validation errors are at the field's line": {
+			manifest: `apiVersion: consul.hashicorp.com/v1alpha1
+kind: ServiceRouter
+metadata:
+  name: web
+spec:
+  routes:
+    - match:
+        http:
+          pathExact: /exact
+          pathPrefix: /prefix
+`,
+			problems: []string{
+				"file.yaml:1: warning: ServiceRouter/web: ServiceRouter requires service \"web\" to have protocol http, http2 or grpc, but no ServiceDefaults or ProxyDefaults in the set sets its protocol",
+				"file.yaml:8: error: ServiceRouter/web: spec.routes[0].match.http: Invalid value: \"{\\\"pathExact\\\":\\\"/exact\\\",\\\"pathPrefix\\\":\\\"/prefix\\\"}\": at most only one of pathExact, pathPrefix, or pathRegex may be configured",
+			},
+		},
+		"Peering resources are validated": {
+			manifest: `apiVersion: consul.hashicorp.com/v1alpha1
+kind: PeeringAcceptor
+metadata:
+  name: dc2
+spec:
+  peer:
+    secret:
+      name: dc2-token
+      key: data
+      backend: aws
+`,
+			problems: []string{
+				`file.yaml:10: error: PeeringAcceptor/dc2: spec.peer.secret.backend: Invalid value: "aws": backend must be one of "kubernetes", "vault"`,
+			},
+		},
+		"Duplicate resources": {
+			manifest: `apiVersion: consul.hashicorp.com/v1alpha1
+kind: ServiceDefaults
+metadata:
+  name: web
+---
+apiVersion: consul.hashicorp.com/v1alpha1
+kind: ServiceDefaults
+metadata:
+  name: web
+`,
+			problems: []string{
+				"file.yaml:6: error: ServiceDefaults/web: duplicate resource, already defined at file.yaml:1",
+			},
+		},
+		"Duplicate intentions destinations": {
+			manifest: `apiVersion: consul.hashicorp.com/v1alpha1
+kind: ServiceIntentions
+metadata:
+  name: web
+spec:
+  destination:
+    name: web
+  sources:
+    - name: frontend
+      action: allow
+---
+apiVersion: consul.hashicorp.com/v1alpha1
+kind: ServiceIntentions
+metadata:
+  name: web-2
+spec:
+  destination:
+    name: web
+  sources:
+    - name: api
+      action: deny
+`,
+			problems: []string{
+				"file.yaml:12: error: ServiceIntentions/web-2: configures the same Consul config entry as ServiceIntentions/web at file.yaml:1",
+			},
+		},
+		"Intentions destinations in different namespaces with mirroring": {
+			manifest: `apiVersion: consul.hashicorp.com/v1alpha1
+kind: ServiceIntentions
+metadata:
+  name: web
+  namespace: frontend
+spec:
+  destination:
+    name: web
+  sources:
+    - name: api
+      action: allow
+---
+apiVersion: consul.hashicorp.com/v1alpha1
+kind: ServiceIntentions
+metadata:
+  name: web
+  namespace: backend
+spec:
+  destination:
+    name: web
+  sources:
+    - name: api
+      action: allow
+`,
+			consulMeta: common.ConsulMeta{NamespacesEnabled: true, DestinationNamespace: "default", Mirroring: true},
+		},
+		"Singletons": {
+			manifest: `apiVersion: consul.hashicorp.com/v1alpha1
+kind: ProxyDefaults
+metadata:
+  name: global
+---
+apiVersion: consul.hashicorp.com/v1alpha1
+kind: ProxyDefaults
+metadata:
+  name: global
+  namespace: other
+---
+apiVersion: consul.hashicorp.com/v1alpha1
+kind: Mesh
+metadata:
+  name: cluster
+`,
+			problems: []string{
+				"file.yaml:6: error: ProxyDefaults/global: ProxyDefaults resource already defined at file.yaml:1, only one is supported",
+				"file.yaml:15: error: Mesh/cluster: metadata.name: Mesh resource name must be \"mesh\"",
+			},
+		},
+		"Router with TCP protocol": {
+			manifest: `apiVersion: consul.hashicorp.com/v1alpha1
+kind: ServiceDefaults
+metadata:
+  name: web
+spec:
+  protocol: tcp
+---
+apiVersion: consul.hashicorp.com/v1alpha1
+kind: ServiceRouter
+metadata:
+  name: web
+spec:
+  routes:
+    - destination:
+        service: api
+`,
+			problems: []string{
+				"file.yaml:8: error: ServiceRouter/web: ServiceRouter requires service \"web\" to have protocol http, http2 or grpc, but ServiceDefaults/web at file.yaml:1 sets it to \"tcp\"",
+			},
+		},
+		"Protocol from ProxyDefaults": {
+			manifest: `apiVersion: consul.hashicorp.com/v1alpha1
+kind: ProxyDefaults
+metadata:
+  name: global
+spec:
+  config:
+    protocol: http
+---
+apiVersion: consul.hashicorp.com/v1alpha1
+kind: ServiceSplitter
+metadata:
+  name: web
+spec:
+  splits:
+    - weight: 100
+      service: api
+`,
+		},
+		"Undefined subsets": {
+			manifest: `apiVersion: consul.hashicorp.com/v1alpha1
+kind: ServiceDefaults
+metadata:
+  name: web
+spec:
+  protocol: http
+---
+apiVersion: consul.hashicorp.com/v1alpha1
+kind: ServiceResolver
+metadata:
+  name: web
+spec:
+  defaultSubset: v3
+  subsets:
+    v1:
+      filter: 'Service.Meta.version == v1'
+  failover:
+    v1:
+      targets:
+        - serviceSubset: v2
+---
+apiVersion: consul.hashicorp.com/v1alpha1
+kind: ServiceSplitter
+metadata:
+  name: web
+spec:
+  splits:
+    - weight: 50
+      serviceSubset: v1
+    - weight: 50
+      serviceSubset: v2
+    - weight: 0
+      service: api
+      serviceSubset: v1
+`,
+			problems: []string{
+				`file.yaml:13: error: ServiceResolver/web: spec.defaultSubset: service subset "v3" is not defined in spec.subsets`,
+				`file.yaml:20: error: ServiceResolver/web: spec.failover[v1].targets[0].serviceSubset: service subset "v2" is not defined by ServiceResolver/web at file.yaml:8`,
+				`file.yaml:31: error: ServiceSplitter/web: spec.splits[1].serviceSubset: service subset "v2" is not defined by ServiceResolver/web at file.yaml:8`,
+				`file.yaml:34: warning: ServiceSplitter/web: spec.splits[2].serviceSubset: service subset "v1" of service "api" can't be checked, there is no ServiceResolver for the service in the set`,
+			},
+		},
+		"Subsets are looked up in the Consul namespace": {
+			manifest: `apiVersion: consul.hashicorp.com/v1alpha1
+kind: ServiceDefaults
+metadata:
+  name: web
+  namespace: frontend
+spec:
+  protocol: http
+---
+apiVersion: consul.hashicorp.com/v1alpha1
+kind: ServiceResolver
+metadata:
+  name: web
+  namespace: backend
+spec:
+  subsets:
+    v1:
+      filter: 'Service.Meta.version == v1'
+---
+apiVersion: consul.hashicorp.com/v1alpha1
+kind: ServiceRouter
+metadata:
+  name: web
+  namespace: frontend
+spec:
+  routes:
+    - destination:
+        serviceSubset: v1
+    - destination:
+        namespace: backend
+        serviceSubset: v1
+`,
+			consulMeta: common.ConsulMeta{NamespacesEnabled: true, DestinationNamespace: "default", Mirroring: true},
+			problems: []string{
+				`file.yaml:27: warning: ServiceRouter/web: spec.routes[0].destination.serviceSubset: service subset "v1" of service "frontend/web" can't be checked, there is no ServiceResolver for the service in the set`,
+			},
+		},
+		"L7 intentions require HTTP": {
+			manifest: `apiVersion: consul.hashicorp.com/v1alpha1
+kind: ServiceDefaults
+metadata:
+  name: web
+spec:
+  protocol: tcp
+---
+apiVersion: consul.hashicorp.com/v1alpha1
+kind: ServiceIntentions
+metadata:
+  name: web
+spec:
+  destination:
+    name: web
+  sources:
+    - name: frontend
+      permissions:
+        - action: allow
+          http:
+            pathPrefix: /
+`,
+			problems: []string{
+				`file.yaml:13: error: ServiceIntentions/web: spec.destination: ServiceIntentions with L7 permissions requires service "web" to have protocol http, http2 or grpc, but ServiceDefaults/web at file.yaml:1 sets it to "tcp"`,
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			resources, problems := Decode("file.yaml", []byte(tc.manifest), "default")
+			require.Empty(t, problems)
+			var got []string
+			for _, p := range Validate(resources, tc.consulMeta) {
+				got = append(got, p.String())
+			}
+			require.Equal(t, tc.problems, got)
+		})
+	}
+}
+
+func TestHasErrors(t *testing.T) {
+	require.False(t, HasErrors(nil))
+	require.False(t, HasErrors([]Problem{{Severity: SeverityWarning}}))
+	require.True(t, HasErrors([]Problem{{Severity: SeverityWarning}, {Severity: SeverityError}}))
+}
@@ -30,6 +30,9 @@ type CNIConfig struct {
 	LogLevel string `json:"log_level"   mapstructure:"log_level"`
 	// Multus is if the plugin is a multus plugin. Can be set as a cli flag.
 	Multus bool `json:"multus"      mapstructure:"multus"`
+	// RedirectBackend is the backend that applies the traffic redirection rules. Empty means the plugin probes the
+	// node for it. Can be set as a cli flag.
+	RedirectBackend string `json:"redirect_backend,omitempty" mapstructure:"redirect_backend,omitempty"`
 }
 
 func NewDefaultCNIConfig() *CNIConfig {
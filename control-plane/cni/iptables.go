@@ -0,0 +1,219 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/hashicorp/consul-k8s/control-plane/cni/nftables"
+	"github.com/hashicorp/consul/sdk/iptables"
+)
+
+// consulChains are the NAT chains created by iptables.Setup.
+var consulChains = []string{
+	iptables.ProxyInboundChain,
+	iptables.ProxyInboundRedirectChain,
+	iptables.ProxyOutputChain,
+	iptables.ProxyOutputRedirectChain,
+	iptables.DNSChain,
+}
+
+// iptablesExecutor runs iptables commands in a network namespace. Used for testing.
+type iptablesExecutor interface {
+	// Run runs iptables with args in the network namespace and returns its output.
+	Run(netns string, args ...string) (string, error)
+}
+
+// nsenterExecutor implements iptablesExecutor by running iptables with nsenter.
+type nsenterExecutor struct{}
+
+func (nsenterExecutor) Run(netns string, args ...string) (string, error) {
+	nsenterArgs := append([]string{fmt.Sprintf("--net=%s", netns), "--", "iptables"}, args...)
+	output, err := exec.Command("nsenter", nsenterArgs...).CombinedOutput()
+	if err != nil {
+		return string(output), fmt.Errorf("failed to run iptables %s: %v, output: %s", strings.Join(args, " "), err, output)
+	}
+	return string(output), nil
+}
+
+// iptablesRule is a rule appended or inserted into a chain.
+type iptablesRule struct {
+	table string
+	chain string
+	spec  []string
+}
+
+func (r iptablesRule) String() string {
+	return strings.Join(r.spec, " ")
+}
+
+// ruleRecorder implements iptables.Provider by recording the rules instead of
+// applying them.
+type ruleRecorder struct {
+	rules [][]string
+}
+
+func (r *ruleRecorder) AddRule(_ string, args ...string) {
+	r.rules = append(r.rules, args)
+}
+
+func (r *ruleRecorder) ApplyRules() error {
+	return nil
+}
+
+func (r *ruleRecorder) Rules() []string {
+	var rules []string
+	for _, rule := range r.rules {
+		rules = append(rules, strings.Join(rule, " "))
+	}
+	return rules
+}
+
+// expectedRules returns the chains and rules that iptables.Setup creates for
+// the config.
+func expectedRules(cfg iptables.Config) ([]string, []iptablesRule, error) {
+	recorder := &ruleRecorder{}
+	cfg.IptablesProvider = recorder
+	if err := iptables.Setup(cfg); err != nil {
+		return nil, nil, err
+	}
+
+	var chains []string
+	var rules []iptablesRule
+	for _, args := range recorder.rules {
+		// Every rule is of the form -t <table> <operation> <chain> [spec...].
+		if len(args) < 4 || args[0] != "-t" {
+			return nil, nil, fmt.Errorf("unexpected iptables rule: %s", strings.Join(args, " "))
+		}
+		switch args[2] {
+		case "-N":
+			chains = append(chains, args[3])
+		case "-A", "-I":
+			rules = append(rules, iptablesRule{table: args[1], chain: args[3], spec: args[4:]})
+		}
+	}
+	return chains, rules, nil
+}
+
+// verifyRules reads back the NAT chains in the network namespace and returns
+// an error if any of the chains or rules for the config are missing, or if the
+// Consul chains have rules that aren't in the config.
+func verifyRules(executor iptablesExecutor, netns string, cfg iptables.Config) error {
+	chains, rules, err := expectedRules(cfg)
+	if err != nil {
+		return err
+	}
+
+	expectedCounts := make(map[string]int)
+	for _, rule := range rules {
+		expectedCounts[rule.chain]++
+	}
+	for _, chain := range chains {
+		output, err := executor.Run(netns, "-t", "nat", "-S", chain)
+		if err != nil {
+			return fmt.Errorf("iptables chain %s is missing: %w", chain, err)
+		}
+		if count := countRules(output, chain); count != expectedCounts[chain] {
+			return fmt.Errorf("iptables chain %s has %d rules, expected %d", chain, count, expectedCounts[chain])
+		}
+	}
+
+	for _, rule := range rules {
+		args := append([]string{"-t", rule.table, "-C", rule.chain}, rule.spec...)
+		if _, err := executor.Run(netns, args...); err != nil {
+			return fmt.Errorf("iptables rule %q is missing from chain %s", rule, rule.chain)
+		}
+	}
+	return nil
+}
+
+// nftablesVerifier is an nftables.Provider that only records the rules so that they can be verified
+// instead of applied.
+type nftablesVerifier struct {
+	*nftables.Provider
+}
+
+func (nftablesVerifier) ApplyRules() error {
+	return nil
+}
+
+// verifyNftables reads back the Consul nftables table in the network namespace and returns an error if any of the
+// chains for the config are missing or have a different number of rules.
+func verifyNftables(executor nftables.Executor, netns string, cfg iptables.Config) error {
+	verifier := nftablesVerifier{nftables.NewProvider(netns, executor)}
+	cfg.IptablesProvider = verifier
+	if err := iptables.Setup(cfg); err != nil {
+		return err
+	}
+	return verifier.Verify()
+}
+
+// cleanupRules removes the jumps to the Consul chains from the built-in NAT
+// chains and then deletes the Consul chains in the network namespace. Chains
+// that don't exist are skipped so that it's safe to run more than once.
+func cleanupRules(executor iptablesExecutor, netns string) error {
+	for _, chain := range []string{"OUTPUT", "PREROUTING"} {
+		output, err := executor.Run(netns, "-t", "nat", "-S", chain)
+		if err != nil {
+			return err
+		}
+		for _, line := range strings.Split(output, "\n") {
+			fields := strings.Fields(line)
+			if len(fields) < 2 || fields[0] != "-A" || !jumpsToConsulChain(fields) {
+				continue
+			}
+			args := append([]string{"-t", "nat", "-D"}, fields[1:]...)
+			if _, err := executor.Run(netns, args...); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Flush every chain before deleting any because the Consul chains jump to
+	// each other and a chain can't be deleted while it's referenced.
+	var existing []string
+	for _, chain := range consulChains {
+		if _, err := executor.Run(netns, "-t", "nat", "-S", chain); err != nil {
+			continue
+		}
+		existing = append(existing, chain)
+		if _, err := executor.Run(netns, "-t", "nat", "-F", chain); err != nil {
+			return err
+		}
+	}
+	for _, chain := range existing {
+		if _, err := executor.Run(netns, "-t", "nat", "-X", chain); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// countRules returns the number of rules in the output of iptables -S for the
+// chain.
+func countRules(output, chain string) int {
+	count := 0
+	for _, line := range strings.Split(output, "\n") {
+		if strings.HasPrefix(line, "-A "+chain+" ") {
+			count++
+		}
+	}
+	return count
+}
+
+func jumpsToConsulChain(fields []string) bool {
+	for i := 0; i < len(fields)-1; i++ {
+		if fields[i] != "-j" {
+			continue
+		}
+		for _, chain := range consulChains {
+			if fields[i+1] == chain {
+				return true
+			}
+		}
+	}
+	return false
+}
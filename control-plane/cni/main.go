@@ -14,12 +14,14 @@ import (
 	"github.com/containernetworking/cni/pkg/types"
 	current "github.com/containernetworking/cni/pkg/types/100"
 	"github.com/containernetworking/cni/pkg/version"
+	"github.com/hashicorp/consul-k8s/control-plane/cni/nftables"
 	"github.com/hashicorp/consul/sdk/iptables"
 	"github.com/hashicorp/go-hclog"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/clientcmd"
 
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	bv "github.com/containernetworking/plugins/pkg/utils/buildversion"
@@ -45,9 +47,17 @@ const (
 	// indicate the status of the CNI plugin.
 	complete = "complete"
 
+	// failed is used in conjunction with keyTransparentProxyStatus to indicate that a CHECK
+	// found that the traffic redirection rules are no longer in place.
+	failed = "failed"
+
 	// annotationRedirectTraffic stores iptables.Config information so that the CNI plugin can use it to apply
 	// iptables rules.
 	annotationRedirectTraffic = "consul.hashicorp.com/redirect-traffic-config"
+
+	// annotationRedirectBackend records the backend that ADD applied the traffic redirection rules with so that
+	// CHECK and DEL use the same backend, even if detecting the backend would give a different answer by then.
+	annotationRedirectBackend = "consul.hashicorp.com/redirect-traffic-backend"
 )
 
 type Command struct {
@@ -55,6 +65,11 @@ type Command struct {
 	client kubernetes.Interface
 	// iptablesProvider is the Provider that will apply iptables rules. Used for testing.
 	iptablesProvider iptables.Provider
+	// iptablesExecutor runs the iptables commands that read back and clean up rules. Used for testing.
+	iptablesExecutor iptablesExecutor
+	// nftablesExecutor runs the commands that probe the node for the backend and apply, read back and clean up
+	// nftables rules. Used for testing.
+	nftablesExecutor nftables.Executor
 }
 
 type CNIArgs struct {
@@ -93,7 +108,9 @@ type PluginConf struct {
 	Kubeconfig string `json:"kubeconfig"`
 	// LogLevl is the logging level. Can be set as a cli flag.
 	LogLevel string `json:"log_level"`
-	//
+	// RedirectBackend is the backend that applies the traffic redirection rules: iptables, nftables or auto,
+	// which probes the node. Empty is the same as auto. Can be set as a cli flag.
+	RedirectBackend string `json:"redirect_backend"`
 }
 
 // parseConfig parses the supplied CNI configuration (and prevResult) from stdin.
@@ -164,18 +181,8 @@ func (c *Command) cmdAdd(args *skel.CmdArgs) error {
 	}
 
 	ctx := context.Background()
-	if c.client == nil {
-
-		// Connect to kubernetes.
-		restConfig, err := clientcmd.BuildConfigFromFlags("", filepath.Join(cfg.CNINetDir, cfg.Kubeconfig))
-		if err != nil {
-			return fmt.Errorf("could not get rest config from kubernetes api: %s", err)
-		}
-
-		c.client, err = kubernetes.NewForConfig(restConfig)
-		if err != nil {
-			return fmt.Errorf("error initializing Kubernetes client: %s", err)
-		}
+	if err := c.initClient(cfg); err != nil {
+		return err
 	}
 
 	pod, err := c.client.CoreV1().Pods(podNamespace).Get(ctx, podName, metav1.GetOptions{})
@@ -205,9 +212,18 @@ func (c *Command) cmdAdd(args *skel.CmdArgs) error {
 	// Set NetNS passed through the CNI.
 	iptablesCfg.NetNS = args.Netns
 
-	// Set the provider to a fake provider in testing, otherwise use the default iptables.Provider
+	backend, err := nftables.Resolve(cfg.RedirectBackend, c.nftExecutor())
+	if err != nil {
+		return err
+	}
+	logger.Debug("using traffic redirection backend", "backend", backend)
+
+	// Set the provider to a fake provider in testing, otherwise use the nftables.Provider for the nftables backend
+	// or the default iptables.Provider.
 	if c.iptablesProvider != nil {
 		iptablesCfg.IptablesProvider = c.iptablesProvider
+	} else if backend == nftables.BackendNftables {
+		iptablesCfg.IptablesProvider = nftables.NewProvider(args.Netns, c.nftExecutor())
 	}
 
 	// Apply the iptables rules.
@@ -218,7 +234,10 @@ func (c *Command) cmdAdd(args *skel.CmdArgs) error {
 
 	// We do not throw an error here because kubernetes will often throw a benign error where the pod has been
 	// updated in between the get and update of the annotation. Eventually kubernetes will update the annotation
-	ok = c.updateTransparentProxyStatusAnnotation(podName, podNamespace, complete)
+	ok = c.updatePodAnnotations(podName, podNamespace, map[string]string{
+		keyTransparentProxyStatus: complete,
+		annotationRedirectBackend: backend,
+	})
 	if !ok {
 		logger.Info("unable to update %s pod annotation to complete", keyTransparentProxyStatus)
 	}
@@ -228,21 +247,189 @@ func (c *Command) cmdAdd(args *skel.CmdArgs) error {
 	return types.PrintResult(result, cfg.CNIVersion)
 }
 
-// cmdDel is called for DELETE requests.
-func cmdDel(_ *skel.CmdArgs) error {
-	// Nothing to do but this function will still be called as part of the CNI specification.
+// cmdDel is called for DELETE requests. It removes the traffic redirection rules from the pod's network
+// namespace, if it still exists, and sets the transparent-proxy-status annotation back to waiting. Failures are
+// logged rather than returned because the runtime retries DEL until it succeeds, which would block the pod from
+// being torn down.
+func (c *Command) cmdDel(args *skel.CmdArgs) error {
+	cfg, err := parseConfig(args.StdinData)
+	if err != nil {
+		return err
+	}
+
+	cniArgs := CNIArgs{}
+	if err := types.LoadArgs(args.Args, &cniArgs); err != nil {
+		return err
+	}
+	podNamespace := string(cniArgs.K8S_POD_NAMESPACE)
+	podName := string(cniArgs.K8S_POD_NAME)
+	if podNamespace == "" || podName == "" {
+		// Nothing was done for this container in ADD so there is nothing to clean up.
+		return nil
+	}
+
+	logger := hclog.New(&hclog.LoggerOptions{
+		Name:  fmt.Sprintf("%s/%s", podNamespace, podName),
+		Level: hclog.LevelFromString(cfg.LogLevel),
+	})
+
+	if err := c.initClient(cfg); err != nil {
+		logger.Warn("skipping cleanup", "error", err)
+		return nil
+	}
+
+	// The pod may already have been deleted, in which case we still clean up the rules but have no annotation
+	// to update.
+	pod, podErr := c.client.CoreV1().Pods(podNamespace).Get(context.Background(), podName, metav1.GetOptions{})
+	if podErr != nil && !k8serrors.IsNotFound(podErr) {
+		logger.Warn("unable to retrieve pod", "error", podErr)
+	}
+	if podErr != nil {
+		pod = nil
+	} else if skipTrafficRedirection(*pod) {
+		return nil
+	}
+
+	// The network namespace is optional for DEL and is empty once the runtime has torn it down, in which case the
+	// rules went with it.
+	if args.Netns != "" {
+		if err := c.cleanup(cfg, pod, args.Netns); err != nil {
+			logger.Warn("unable to clean up traffic redirect rules", "error", err)
+		} else {
+			logger.Debug("traffic redirect rules removed from pod", "netns", args.Netns)
+		}
+	}
+
+	if podErr == nil {
+		if ok := c.updateTransparentProxyStatusAnnotation(podName, podNamespace, waiting); !ok {
+			logger.Info("unable to update pod annotation to waiting", "annotation", keyTransparentProxyStatus)
+		}
+	}
 	return nil
 }
 
-// cmdCheck is called for CHECK requests.
-func cmdCheck(_ *skel.CmdArgs) error {
-	// Nothing to do but this function will still be called as part of the CNI specification.
+// cmdCheck is called for CHECK requests. It reads back the NAT chains in the pod's network namespace and returns
+// an error if the rules created from the redirect-traffic-config annotation are missing or differ.
+func (c *Command) cmdCheck(args *skel.CmdArgs) error {
+	cfg, err := parseConfig(args.StdinData)
+	if err != nil {
+		return err
+	}
+
+	cniArgs := CNIArgs{}
+	if err := types.LoadArgs(args.Args, &cniArgs); err != nil {
+		return err
+	}
+	podNamespace := string(cniArgs.K8S_POD_NAMESPACE)
+	podName := string(cniArgs.K8S_POD_NAME)
+	if podNamespace == "" || podName == "" {
+		return fmt.Errorf("not running in a pod, namespace and pod should have values")
+	}
+
+	logger := hclog.New(&hclog.LoggerOptions{
+		Name:  fmt.Sprintf("%s/%s", podNamespace, podName),
+		Level: hclog.LevelFromString(cfg.LogLevel),
+	})
+
+	if err := c.initClient(cfg); err != nil {
+		return err
+	}
+	pod, err := c.client.CoreV1().Pods(podNamespace).Get(context.Background(), podName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("error retrieving pod: %s", err)
+	}
+	if skipTrafficRedirection(*pod) {
+		return nil
+	}
+
+	iptablesCfg, err := parseAnnotation(*pod, annotationRedirectTraffic)
+	if err != nil {
+		return err
+	}
+	if err := c.verify(cfg, pod, args.Netns, iptablesCfg); err != nil {
+		if ok := c.updateTransparentProxyStatusAnnotation(podName, podNamespace, failed); !ok {
+			logger.Info("unable to update pod annotation to failed", "annotation", keyTransparentProxyStatus)
+		}
+		return fmt.Errorf("traffic redirect rules are not in place: %v", err)
+	}
 	return nil
 }
 
 func main() {
 	c := &Command{}
-	skel.PluginMain(c.cmdAdd, cmdCheck, cmdDel, version.All, bv.BuildString("consul-cni"))
+	skel.PluginMain(c.cmdAdd, c.cmdCheck, c.cmdDel, version.All, bv.BuildString("consul-cni"))
+}
+
+// initClient creates the Kubernetes client from the kubeconfig in the CNI net dir if it isn't already set.
+func (c *Command) initClient(cfg *PluginConf) error {
+	if c.client != nil {
+		return nil
+	}
+
+	// Connect to kubernetes.
+	restConfig, err := clientcmd.BuildConfigFromFlags("", filepath.Join(cfg.CNINetDir, cfg.Kubeconfig))
+	if err != nil {
+		return fmt.Errorf("could not get rest config from kubernetes api: %s", err)
+	}
+
+	c.client, err = kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return fmt.Errorf("error initializing Kubernetes client: %s", err)
+	}
+	return nil
+}
+
+// executor returns the iptablesExecutor, which is a fake in testing, otherwise one that runs iptables with nsenter.
+func (c *Command) executor() iptablesExecutor {
+	if c.iptablesExecutor != nil {
+		return c.iptablesExecutor
+	}
+	return nsenterExecutor{}
+}
+
+// nftExecutor returns the nftables.Executor, which is a fake in testing, otherwise one that runs the commands.
+func (c *Command) nftExecutor() nftables.Executor {
+	if c.nftablesExecutor != nil {
+		return c.nftablesExecutor
+	}
+	return nftables.CommandExecutor{}
+}
+
+// redirectBackend returns the backend that ADD applied the traffic redirection rules to the pod with. Pods that
+// were set up before the backend was recorded, or that are already gone when pod is nil, fall back to the backend
+// from the plugin config.
+func (c *Command) redirectBackend(cfg *PluginConf, pod *corev1.Pod) (string, error) {
+	backend := cfg.RedirectBackend
+	if pod != nil && pod.Annotations[annotationRedirectBackend] != "" {
+		backend = pod.Annotations[annotationRedirectBackend]
+	}
+	return nftables.Resolve(backend, c.nftExecutor())
+}
+
+// verify reads back the traffic redirection rules for the config from the network namespace with the backend
+// that ADD applied them with.
+func (c *Command) verify(cfg *PluginConf, pod *corev1.Pod, netns string, iptablesCfg iptables.Config) error {
+	backend, err := c.redirectBackend(cfg, pod)
+	if err != nil {
+		return err
+	}
+	if backend == nftables.BackendNftables {
+		return verifyNftables(c.nftExecutor(), netns, iptablesCfg)
+	}
+	return verifyRules(c.executor(), netns, iptablesCfg)
+}
+
+// cleanup removes the traffic redirection rules from the network namespace with the backend that ADD applied them
+// with. pod is nil if it's already gone.
+func (c *Command) cleanup(cfg *PluginConf, pod *corev1.Pod, netns string) error {
+	backend, err := c.redirectBackend(cfg, pod)
+	if err != nil {
+		return err
+	}
+	if backend == nftables.BackendNftables {
+		return nftables.DeleteTable(c.nftExecutor(), netns)
+	}
+	return cleanupRules(c.executor(), netns)
 }
 
 // skipTrafficRedirection looks for annotations on the pod and determines if it should skip traffic redirection.
@@ -276,12 +463,19 @@ func parseAnnotation(pod corev1.Pod, annotation string) (iptables.Config, error)
 // updateTransparentProxyStatusAnnotation updates the transparent-proxy-status annotation. We use it as a simple inicator of
 // CNI status on the pod.  Failing is not fatal.
 func (c *Command) updateTransparentProxyStatusAnnotation(podName, namespace, status string) bool {
+	return c.updatePodAnnotations(podName, namespace, map[string]string{keyTransparentProxyStatus: status})
+}
+
+// updatePodAnnotations sets the annotations on the pod. Failing is not fatal.
+func (c *Command) updatePodAnnotations(podName, namespace string, annotations map[string]string) bool {
 	// Refresh the pod so that we can update it without problems
 	pod, err := c.client.CoreV1().Pods(namespace).Get(context.Background(), podName, metav1.GetOptions{})
 	if err != nil {
 		return false
 	}
-	pod.Annotations[keyTransparentProxyStatus] = status
+	for key, value := range annotations {
+		pod.Annotations[key] = value
+	}
 	_, err = c.client.CoreV1().Pods(namespace).Update(context.Background(), pod, metav1.UpdateOptions{})
 	return err == nil
 }
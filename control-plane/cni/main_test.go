@@ -11,6 +11,7 @@ import (
 	"testing"
 
 	"github.com/containernetworking/cni/pkg/skel"
+	"github.com/hashicorp/consul-k8s/control-plane/cni/nftables"
 	"github.com/hashicorp/consul/sdk/iptables"
 	"github.com/stretchr/testify/require"
 	corev1 "k8s.io/api/core/v1"
@@ -387,3 +388,322 @@ const missingIPsStdinData = `{
     "name": "consul-cni",
     "type": "consul-cni"
 }`
+
+func Test_cmdCheck(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name        string
+		modifyRules func(netns *fakeNetns)
+		expectedErr string
+	}{
+		{
+			name: "Rules in place, should succeed",
+		},
+		{
+			name: "Chain missing, should throw error",
+			modifyRules: func(netns *fakeNetns) {
+				delete(netns.chains, iptables.ProxyOutputRedirectChain)
+			},
+			expectedErr: "iptables chain CONSUL_PROXY_REDIRECT is missing: iptables: No chain/target/match by that name",
+		},
+		{
+			name: "Rule missing from a built-in chain, should throw error",
+			modifyRules: func(netns *fakeNetns) {
+				netns.chains["PREROUTING"] = nil
+			},
+			expectedErr: `iptables rule "-p tcp -j CONSUL_PROXY_INBOUND" is missing from chain PREROUTING`,
+		},
+		{
+			name: "Rule differs, should throw error",
+			modifyRules: func(netns *fakeNetns) {
+				netns.chains[iptables.ProxyInboundRedirectChain] = []string{"-p tcp -j REDIRECT --to-port 20001"}
+			},
+			expectedErr: `iptables rule "-p tcp -j REDIRECT --to-port 20000" is missing from chain CONSUL_PROXY_IN_REDIRECT`,
+		},
+		{
+			name: "Extra rule in a Consul chain, should throw error",
+			modifyRules: func(netns *fakeNetns) {
+				chain := iptables.ProxyOutputChain
+				netns.chains[chain] = append(netns.chains[chain], "-d 10.0.0.0/8 -j RETURN")
+			},
+			expectedErr: "iptables chain CONSUL_PROXY_OUTPUT has 5 rules, expected 4",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			netns := newFakeNetns()
+			cmd := &Command{
+				client:           fake.NewSimpleClientset(),
+				iptablesProvider: netns,
+				iptablesExecutor: netns,
+				nftablesExecutor: &fakeNft{},
+			}
+			podName := "pod-with-rules"
+			_, err := cmd.client.CoreV1().Pods(defaultNamespace).Create(context.Background(), redirectedPod(t, podName), metav1.CreateOptions{})
+			require.NoError(t, err)
+			args := minimalSkelArgs(podName, defaultNamespace, goodStdinData)
+			require.NoError(t, cmd.cmdAdd(args))
+
+			if c.modifyRules != nil {
+				c.modifyRules(netns)
+			}
+			err = cmd.cmdCheck(args)
+			pod, getErr := cmd.client.CoreV1().Pods(defaultNamespace).Get(context.Background(), podName, metav1.GetOptions{})
+			require.NoError(t, getErr)
+			if c.expectedErr == "" {
+				require.NoError(t, err)
+				require.Equal(t, complete, pod.Annotations[keyTransparentProxyStatus])
+			} else {
+				require.EqualError(t, err, "traffic redirect rules are not in place: "+c.expectedErr)
+				require.Equal(t, failed, pod.Annotations[keyTransparentProxyStatus])
+			}
+		})
+	}
+}
+
+func Test_cmdCheck_SkipsPodWithoutRedirection(t *testing.T) {
+	t.Parallel()
+
+	netns := newFakeNetns()
+	cmd := &Command{
+		client:           fake.NewSimpleClientset(minimalPod(defaultPodName)),
+		iptablesExecutor: netns,
+		nftablesExecutor: &fakeNft{},
+	}
+	require.NoError(t, cmd.cmdCheck(minimalSkelArgs(defaultPodName, defaultNamespace, goodStdinData)))
+	require.Empty(t, netns.commands)
+}
+
+func Test_cmdDel(t *testing.T) {
+	t.Parallel()
+
+	netns := newFakeNetns()
+	// A rule that isn't Consul's should be left alone.
+	netns.chains["OUTPUT"] = []string{"-p tcp -j OTHER_CHAIN"}
+	cmd := &Command{
+		client:           fake.NewSimpleClientset(),
+		iptablesProvider: netns,
+		iptablesExecutor: netns,
+		nftablesExecutor: &fakeNft{},
+	}
+	podName := "pod-with-rules"
+	_, err := cmd.client.CoreV1().Pods(defaultNamespace).Create(context.Background(), redirectedPod(t, podName), metav1.CreateOptions{})
+	require.NoError(t, err)
+	args := minimalSkelArgs(podName, defaultNamespace, goodStdinData)
+	require.NoError(t, cmd.cmdAdd(args))
+
+	require.NoError(t, cmd.cmdDel(args))
+	require.Equal(t, map[string][]string{
+		"OUTPUT":     {"-p tcp -j OTHER_CHAIN"},
+		"PREROUTING": {},
+	}, netns.chains)
+	pod, err := cmd.client.CoreV1().Pods(defaultNamespace).Get(context.Background(), podName, metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Equal(t, waiting, pod.Annotations[keyTransparentProxyStatus])
+
+	// DEL can be called more than once and after the pod is gone.
+	require.NoError(t, cmd.client.CoreV1().Pods(defaultNamespace).Delete(context.Background(), podName, metav1.DeleteOptions{}))
+	require.NoError(t, cmd.cmdDel(args))
+
+	// The rules can be added again after they've been cleaned up.
+	_, err = cmd.client.CoreV1().Pods(defaultNamespace).Create(context.Background(), redirectedPod(t, podName), metav1.CreateOptions{})
+	require.NoError(t, err)
+	require.NoError(t, cmd.cmdAdd(args))
+	require.NoError(t, cmd.cmdCheck(args))
+}
+
+func Test_Nftables(t *testing.T) {
+	t.Parallel()
+
+	nft := &fakeNft{installed: true}
+	cmd := &Command{
+		client:           fake.NewSimpleClientset(),
+		iptablesExecutor: newFakeNetns(),
+		nftablesExecutor: nft,
+	}
+	podName := "pod-with-rules"
+	_, err := cmd.client.CoreV1().Pods(defaultNamespace).Create(context.Background(), redirectedPod(t, podName), metav1.CreateOptions{})
+	require.NoError(t, err)
+	stdinData := strings.Replace(goodStdinData, `"log_level": "info",`, `"log_level": "info", "redirect_backend": "nftables",`, 1)
+	args := minimalSkelArgs(podName, defaultNamespace, stdinData)
+
+	require.NoError(t, cmd.cmdAdd(args))
+	require.Equal(t, []string{"nsenter --net=/some/netns/path -- nft -f -"}, nft.commands)
+	require.Contains(t, nft.stdin[0], "add rule ip consul CONSUL_PROXY_INBOUND tcp dport 9090 return\n")
+	require.Contains(t, nft.stdin[0], "add rule ip consul CONSUL_DNS_REDIRECT udp dport 53 dnat to 10.0.0.10\n")
+	pod, err := cmd.client.CoreV1().Pods(defaultNamespace).Get(context.Background(), podName, metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Equal(t, complete, pod.Annotations[keyTransparentProxyStatus])
+
+	// CHECK reads back the table, which the fake doesn't have.
+	err = cmd.cmdCheck(args)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "nftables table consul is missing")
+
+	require.NoError(t, cmd.cmdDel(args))
+	require.Equal(t, "nsenter --net=/some/netns/path -- nft -f -", nft.commands[len(nft.commands)-1])
+	require.Equal(t, "table ip consul\ndelete table ip consul\n", nft.stdin[len(nft.stdin)-1])
+}
+
+func Test_RecordedBackend(t *testing.T) {
+	t.Parallel()
+
+	nft := &fakeNft{installed: true, noIptables: true}
+	netns := newFakeNetns()
+	cmd := &Command{
+		client:           fake.NewSimpleClientset(),
+		iptablesExecutor: netns,
+		nftablesExecutor: nft,
+	}
+	podName := "pod-with-rules"
+	_, err := cmd.client.CoreV1().Pods(defaultNamespace).Create(context.Background(), redirectedPod(t, podName), metav1.CreateOptions{})
+	require.NoError(t, err)
+	args := minimalSkelArgs(podName, defaultNamespace, goodStdinData)
+
+	// Detection picks nftables when ADD runs and the backend is recorded on the pod.
+	require.NoError(t, cmd.cmdAdd(args))
+	pod, err := cmd.client.CoreV1().Pods(defaultNamespace).Get(context.Background(), podName, metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Equal(t, nftables.BackendNftables, pod.Annotations[annotationRedirectBackend])
+
+	// Detection would now pick iptables but CHECK and DEL keep using nftables.
+	nft.noIptables = false
+	require.Equal(t, nftables.BackendIptables, nftables.Detect(nft))
+
+	err = cmd.cmdCheck(args)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "nftables table consul is missing")
+
+	require.NoError(t, cmd.cmdDel(args))
+	require.Equal(t, "nsenter --net=/some/netns/path -- nft -f -", nft.commands[len(nft.commands)-1])
+	require.Equal(t, "table ip consul\ndelete table ip consul\n", nft.stdin[len(nft.stdin)-1])
+	require.Empty(t, netns.commands)
+}
+
+// redirectedPod returns a pod with the annotations for traffic redirection.
+func redirectedPod(t *testing.T, podName string) *corev1.Pod {
+	pod := minimalPod(podName)
+	pod.Annotations[keyInjectStatus] = "true"
+	pod.Annotations[keyTransparentProxyStatus] = "enabled"
+	cfg := iptables.Config{
+		ProxyUserID:          "5995",
+		ProxyInboundPort:     20000,
+		ConsulDNSIP:          "10.0.0.10",
+		ExcludeInboundPorts:  []string{"9090"},
+		ExcludeOutboundCIDRs: []string{"1.1.1.1/32"},
+	}
+	iptablesConfigJson, err := json.Marshal(&cfg)
+	require.NoError(t, err)
+	pod.Annotations[annotationRedirectTraffic] = string(iptablesConfigJson)
+	return pod
+}
+
+// fakeNetns is a fake of the NAT table of a network namespace. It implements iptables.Provider to apply rules
+// and iptablesExecutor to read them back and remove them. Rules are stored as the spec after the chain name.
+type fakeNetns struct {
+	chains   map[string][]string
+	pending  [][]string
+	commands []string
+}
+
+func newFakeNetns() *fakeNetns {
+	return &fakeNetns{
+		chains: map[string][]string{
+			"OUTPUT":     nil,
+			"PREROUTING": nil,
+		},
+	}
+}
+
+func (f *fakeNetns) AddRule(_ string, args ...string) {
+	f.pending = append(f.pending, args)
+}
+
+func (f *fakeNetns) ApplyRules() error {
+	for _, args := range f.pending {
+		if _, err := f.Run("", args...); err != nil {
+			return err
+		}
+	}
+	f.pending = nil
+	return nil
+}
+
+func (f *fakeNetns) Rules() []string {
+	var rules []string
+	for _, args := range f.pending {
+		rules = append(rules, strings.Join(args, " "))
+	}
+	return rules
+}
+
+func (f *fakeNetns) Run(_ string, args ...string) (string, error) {
+	f.commands = append(f.commands, strings.Join(args, " "))
+	if len(args) < 4 || args[0] != "-t" || args[1] != "nat" {
+		return "", fmt.Errorf("unsupported command: %v", args)
+	}
+	op, chain, spec := args[2], args[3], strings.Join(args[4:], " ")
+	rules, exists := f.chains[chain]
+	if !exists && op != "-N" {
+		return "", fmt.Errorf("iptables: No chain/target/match by that name")
+	}
+
+	switch op {
+	case "-N":
+		if exists {
+			return "", fmt.Errorf("iptables: Chain already exists")
+		}
+		f.chains[chain] = nil
+	case "-A":
+		f.chains[chain] = append(rules, spec)
+	case "-I":
+		f.chains[chain] = append([]string{spec}, rules...)
+	case "-C", "-D":
+		for i, rule := range rules {
+			if rule == spec {
+				if op == "-D" {
+					f.chains[chain] = append(rules[:i:i], rules[i+1:]...)
+				}
+				return "", nil
+			}
+		}
+		return "", fmt.Errorf("iptables: Bad rule (does a matching rule exist in that chain?)")
+	case "-S":
+		output := fmt.Sprintf("-N %s\n", chain)
+		for _, rule := range rules {
+			output += fmt.Sprintf("-A %s %s\n", chain, rule)
+		}
+		return output, nil
+	case "-F":
+		f.chains[chain] = nil
+	case "-X":
+		delete(f.chains, chain)
+	default:
+		return "", fmt.Errorf("unsupported command: %v", args)
+	}
+	return "", nil
+}
+
+// fakeNft is a fake of the nft binary. If it isn't installed, every command fails. Listing the Consul table fails
+// and other commands are recorded and succeed.
+type fakeNft struct {
+	installed bool
+	// noIptables makes the iptables binary look missing, which makes detection pick nftables.
+	noIptables bool
+	commands   []string
+	stdin      []string
+}
+
+func (f *fakeNft) Run(stdin, name string, args ...string) (string, error) {
+	if !f.installed || (f.noIptables && name == "iptables") {
+		return "", fmt.Errorf("exec: %q: executable file not found in $PATH", name)
+	}
+	command := strings.Join(append([]string{name}, args...), " ")
+	if strings.HasSuffix(command, "nft list table ip consul") {
+		return "", fmt.Errorf("Error: No such file or directory")
+	}
+	f.commands = append(f.commands, command)
+	f.stdin = append(f.stdin, stdin)
+	return "", nil
+}
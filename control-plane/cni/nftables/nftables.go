@@ -0,0 +1,106 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+// Package nftables applies the transparent proxy traffic redirection rules with
+// nft instead of the iptables binary. Provider implements iptables.Provider so
+// that the rules are still created by iptables.Setup and the two backends have
+// the same semantics.
+package nftables
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+const (
+	// BackendAuto detects the backend by probing the node.
+	BackendAuto = "auto"
+	// BackendIptables applies the rules with the iptables binary.
+	BackendIptables = "iptables"
+	// BackendNftables applies the rules with the nft binary.
+	BackendNftables = "nftables"
+
+	// TableName is the name of the nftables table that holds the Consul chains.
+	TableName = "consul"
+	// tableFamily is the address family of the table. Like the iptables
+	// backend, only IPv4 traffic is redirected.
+	tableFamily = "ip"
+)
+
+// Executor runs commands. Used for testing.
+type Executor interface {
+	// Run runs the command with stdin and returns its combined output.
+	Run(stdin, name string, args ...string) (string, error)
+}
+
+// CommandExecutor implements Executor with exec.Cmd.
+type CommandExecutor struct{}
+
+func (CommandExecutor) Run(stdin, name string, args ...string) (string, error) {
+	cmd := exec.Command(name, args...)
+	cmd.Stdin = strings.NewReader(stdin)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return string(output), fmt.Errorf("failed to run command: %s, err: %v, output: %s", cmd.String(), err, output)
+	}
+	return string(output), nil
+}
+
+// Resolve returns the backend to use, which is either BackendIptables or
+// BackendNftables. If backend is empty or BackendAuto, the node is probed
+// with Detect.
+func Resolve(backend string, executor Executor) (string, error) {
+	switch backend {
+	case "", BackendAuto:
+		return Detect(executor), nil
+	case BackendIptables, BackendNftables:
+		return backend, nil
+	default:
+		return "", fmt.Errorf("unknown traffic redirection backend %q, must be one of %s, %s or %s",
+			backend, BackendAuto, BackendIptables, BackendNftables)
+	}
+}
+
+// Detect probes the current network namespace for the backend to use.
+// nftables is used when nft is installed and either there is no iptables
+// binary, or it's the legacy variant while the node's rules are already in
+// nftables. Rules added with legacy iptables on such a node are evaluated
+// separately from the nftables rules, which silently breaks redirection.
+// iptables-nft writes nftables rules itself so it's safe to keep using.
+func Detect(executor Executor) string {
+	if _, err := executor.Run("", "nft", "--version"); err != nil {
+		return BackendIptables
+	}
+	version, err := executor.Run("", "iptables", "--version")
+	if err != nil {
+		return BackendNftables
+	}
+	if strings.Contains(version, "nf_tables") {
+		return BackendIptables
+	}
+	tables, err := executor.Run("", "nft", "list", "tables")
+	if err == nil && strings.TrimSpace(tables) != "" {
+		return BackendNftables
+	}
+	return BackendIptables
+}
+
+// DeleteTable deletes the Consul table from the network namespace, or the
+// current one if netns is empty. It's not an error if the table doesn't exist.
+func DeleteTable(executor Executor, netns string) error {
+	// Declaring the table first makes the delete a no-op if it doesn't exist.
+	ruleset := fmt.Sprintf("table %[1]s %[2]s\ndelete table %[1]s %[2]s\n", tableFamily, TableName)
+	_, err := runNft(executor, netns, ruleset, "-f", "-")
+	return err
+}
+
+// runNft runs nft with args in the network namespace, or the current one if
+// netns is empty.
+func runNft(executor Executor, netns, stdin string, args ...string) (string, error) {
+	if netns == "" {
+		return executor.Run(stdin, "nft", args...)
+	}
+	nsenterArgs := append([]string{fmt.Sprintf("--net=%s", netns), "--", "nft"}, args...)
+	return executor.Run(stdin, "nsenter", nsenterArgs...)
+}
@@ -0,0 +1,119 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package nftables
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolve(t *testing.T) {
+	cases := map[string]struct {
+		backend  string
+		binaries map[string]string
+		tables   string
+		expected string
+		expErr   string
+	}{
+		"explicit iptables": {
+			backend:  BackendIptables,
+			binaries: map[string]string{"nft": "nftables v1.0.2"},
+			expected: BackendIptables,
+		},
+		"explicit nftables": {
+			backend:  BackendNftables,
+			expected: BackendNftables,
+		},
+		"unknown backend": {
+			backend: "ipfw",
+			expErr:  `unknown traffic redirection backend "ipfw"`,
+		},
+		"no nft": {
+			binaries: map[string]string{"iptables": "iptables v1.8.4 (legacy)"},
+			expected: BackendIptables,
+		},
+		"no iptables": {
+			backend:  BackendAuto,
+			binaries: map[string]string{"nft": "nftables v1.0.2"},
+			expected: BackendNftables,
+		},
+		"iptables-nft": {
+			binaries: map[string]string{"nft": "nftables v1.0.2", "iptables": "iptables v1.8.7 (nf_tables)"},
+			tables:   "table inet filter",
+			expected: BackendIptables,
+		},
+		"legacy iptables without nftables rules": {
+			binaries: map[string]string{"nft": "nftables v1.0.2", "iptables": "iptables v1.8.4 (legacy)"},
+			expected: BackendIptables,
+		},
+		"legacy iptables with nftables rules": {
+			binaries: map[string]string{"nft": "nftables v1.0.2", "iptables": "iptables v1.8.4 (legacy)"},
+			tables:   "table inet filter\ntable ip nat",
+			expected: BackendNftables,
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			executor := &fakeExecutor{binaries: c.binaries, tables: c.tables}
+			backend, err := Resolve(c.backend, executor)
+			if c.expErr != "" {
+				require.EqualError(t, err, c.expErr+", must be one of auto, iptables or nftables")
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, c.expected, backend)
+		})
+	}
+}
+
+func TestDeleteTable(t *testing.T) {
+	executor := &fakeExecutor{}
+	require.NoError(t, DeleteTable(executor, ""))
+	require.Equal(t, []string{"nft -f -"}, executor.calls)
+	require.Equal(t, "table ip consul\ndelete table ip consul\n", executor.stdin[0])
+}
+
+// fakeExecutor records the commands it runs. The --version of binaries and
+// nft list tables return their configured output. Commands in outputs return
+// their output, other commands fail if outputs is set and succeed otherwise.
+type fakeExecutor struct {
+	// binaries maps the installed binaries to their version. nil means all
+	// binaries are installed.
+	binaries map[string]string
+	tables   string
+	outputs  map[string]string
+
+	calls []string
+	stdin []string
+}
+
+func (f *fakeExecutor) Run(stdin, name string, args ...string) (string, error) {
+	if f.binaries != nil {
+		version, ok := f.binaries[name]
+		if !ok {
+			return "", errors.New("executable file not found in $PATH")
+		}
+		if len(args) == 1 && args[0] == "--version" {
+			return version, nil
+		}
+	}
+	if name == "nft" && strings.Join(args, " ") == "list tables" {
+		return f.tables, nil
+	}
+	call := strings.Join(append([]string{name}, args...), " ")
+	if f.outputs != nil {
+		output, ok := f.outputs[call]
+		if !ok {
+			return "", errors.New("exit status 1")
+		}
+		return output, nil
+	}
+	f.calls = append(f.calls, call)
+	f.stdin = append(f.stdin, stdin)
+	return "", nil
+}
@@ -0,0 +1,268 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package nftables
+
+import (
+	"fmt"
+	"strings"
+)
+
+// baseChains are the nftables base chains that replace the built-in iptables
+// NAT chains, keyed by the iptables chain name. The priority is the one of the
+// iptables NAT chains so that the rules run at the same point.
+var baseChains = map[string]string{
+	"OUTPUT":     "type nat hook output priority -100; policy accept;",
+	"PREROUTING": "type nat hook prerouting priority -100; policy accept;",
+}
+
+// Provider implements iptables.Provider by translating the iptables NAT rules
+// created by iptables.Setup into an nftables ruleset. ApplyRules replaces the
+// Consul table in a single transaction, so applying the same rules again is a
+// no-op rather than adding duplicates like the iptables backend does.
+type Provider struct {
+	netns    string
+	executor Executor
+
+	// chains are the chains in the order they were created.
+	chains []*chain
+	// err is the first error translating a rule. It's returned by ApplyRules
+	// because AddRule can't return an error.
+	err error
+}
+
+type chain struct {
+	name  string
+	rules []string
+}
+
+// NewProvider returns a Provider that applies the rules in the network
+// namespace, or the current one if netns is empty.
+func NewProvider(netns string, executor Executor) *Provider {
+	return &Provider{netns: netns, executor: executor}
+}
+
+// AddRule translates the iptables rule. name is the binary the rule would have
+// been run with and is ignored.
+func (p *Provider) AddRule(_ string, args ...string) {
+	if p.err != nil {
+		return
+	}
+	if err := p.addRule(args); err != nil {
+		p.err = fmt.Errorf("unsupported iptables rule %q: %w", strings.Join(args, " "), err)
+	}
+}
+
+// ApplyRules replaces the Consul table with the ruleset.
+func (p *Provider) ApplyRules() error {
+	ruleset, err := p.Ruleset()
+	if err != nil {
+		return err
+	}
+	if _, err := runNft(p.executor, p.netns, ruleset, "-f", "-"); err != nil {
+		return fmt.Errorf("failed to apply nftables ruleset: %w", err)
+	}
+	return nil
+}
+
+// Rules returns the nft commands that add the rules.
+func (p *Provider) Rules() []string {
+	var rules []string
+	for _, c := range p.chains {
+		for _, rule := range c.rules {
+			rules = append(rules, fmt.Sprintf("add rule %s %s %s %s", tableFamily, TableName, c.name, rule))
+		}
+	}
+	return rules
+}
+
+// Ruleset returns the nft script that replaces the Consul table. Every chain
+// is declared before any rule is added so that rules can jump to chains that
+// are created later.
+func (p *Provider) Ruleset() (string, error) {
+	if p.err != nil {
+		return "", p.err
+	}
+
+	var b strings.Builder
+	// Declaring the table before deleting it makes the delete succeed the
+	// first time the rules are applied.
+	fmt.Fprintf(&b, "table %s %s\n", tableFamily, TableName)
+	fmt.Fprintf(&b, "delete table %s %s\n", tableFamily, TableName)
+	fmt.Fprintf(&b, "table %s %s {\n", tableFamily, TableName)
+	for _, c := range p.chains {
+		fmt.Fprintf(&b, "\tchain %s {\n", c.name)
+		if hook, ok := baseChains[c.name]; ok {
+			fmt.Fprintf(&b, "\t\t%s\n", hook)
+		}
+		b.WriteString("\t}\n")
+	}
+	b.WriteString("}\n")
+	for _, rule := range p.Rules() {
+		b.WriteString(rule + "\n")
+	}
+	return b.String(), nil
+}
+
+// Verify reads back the Consul table from the network namespace and returns an
+// error if any of the chains are missing or have a different number of rules
+// than the ruleset. The rules themselves aren't compared because nft lists
+// them in its own normalized form.
+func (p *Provider) Verify() error {
+	if p.err != nil {
+		return p.err
+	}
+	output, err := runNft(p.executor, p.netns, "", "list", "table", tableFamily, TableName)
+	if err != nil {
+		return fmt.Errorf("nftables table %s is missing: %w", TableName, err)
+	}
+	counts := countRules(output)
+	for _, c := range p.chains {
+		count, ok := counts[c.name]
+		if !ok {
+			return fmt.Errorf("nftables chain %s is missing", c.name)
+		}
+		if count != len(c.rules) {
+			return fmt.Errorf("nftables chain %s has %d rules, expected %d", c.name, count, len(c.rules))
+		}
+	}
+	return nil
+}
+
+func (p *Provider) addRule(args []string) error {
+	// Every rule is of the form -t nat <operation> <chain> [spec...].
+	if len(args) < 4 || args[0] != "-t" {
+		return fmt.Errorf("expected -t <table> <operation> <chain>")
+	}
+	if args[1] != "nat" {
+		return fmt.Errorf("table %s is not supported", args[1])
+	}
+
+	op, name, spec := args[2], args[3], args[4:]
+	if op == "-N" {
+		p.chain(name)
+		return nil
+	}
+
+	rule, err := translate(spec)
+	if err != nil {
+		return err
+	}
+	c := p.chain(name)
+	switch op {
+	case "-A":
+		c.rules = append(c.rules, rule)
+	case "-I":
+		c.rules = append([]string{rule}, c.rules...)
+	default:
+		return fmt.Errorf("operation %s is not supported", op)
+	}
+	return nil
+}
+
+// chain returns the chain with the name, creating it if it doesn't exist.
+func (p *Provider) chain(name string) *chain {
+	for _, c := range p.chains {
+		if c.name == name {
+			return c
+		}
+	}
+	c := &chain{name: name}
+	p.chains = append(p.chains, c)
+	return c
+}
+
+// translate returns the nftables rule for the iptables rule spec.
+func translate(spec []string) (string, error) {
+	var protocol, dport, daddr, uid, target, toPort, toDestination string
+	for i := 0; i < len(spec); i++ {
+		flag := spec[i]
+		if flag == "-m" {
+			// Matches are translated from their options so the module names
+			// are skipped.
+			i++
+			continue
+		}
+		if i+1 >= len(spec) {
+			return "", fmt.Errorf("%s has no value", flag)
+		}
+		value := spec[i+1]
+		i++
+		switch flag {
+		case "-p":
+			protocol = value
+		case "--dport":
+			// iptables port ranges are first:last while nftables uses first-last.
+			dport = strings.Replace(value, ":", "-", 1)
+		case "-d":
+			daddr = value
+		case "--uid-owner":
+			uid = value
+		case "-j":
+			target = value
+		case "--to-port":
+			toPort = value
+		case "--to-destination":
+			toDestination = value
+		default:
+			return "", fmt.Errorf("option %s is not supported", flag)
+		}
+	}
+
+	var exprs []string
+	if daddr != "" {
+		exprs = append(exprs, "ip daddr "+daddr)
+	}
+	if uid != "" {
+		exprs = append(exprs, "meta skuid "+uid)
+	}
+	switch {
+	case dport != "" && protocol == "":
+		return "", fmt.Errorf("--dport requires -p")
+	case dport != "":
+		exprs = append(exprs, fmt.Sprintf("%s dport %s", protocol, dport))
+	case protocol != "":
+		exprs = append(exprs, "meta l4proto "+protocol)
+	}
+
+	switch target {
+	case "":
+		return "", fmt.Errorf("-j must be set")
+	case "RETURN":
+		exprs = append(exprs, "return")
+	case "REDIRECT":
+		if toPort == "" {
+			return "", fmt.Errorf("REDIRECT requires --to-port")
+		}
+		exprs = append(exprs, "redirect to :"+toPort)
+	case "DNAT":
+		if toDestination == "" {
+			return "", fmt.Errorf("DNAT requires --to-destination")
+		}
+		exprs = append(exprs, "dnat to "+toDestination)
+	default:
+		exprs = append(exprs, "jump "+target)
+	}
+	return strings.Join(exprs, " "), nil
+}
+
+// countRules returns the number of rules in each chain in the output of nft
+// list table.
+func countRules(output string) map[string]int {
+	counts := make(map[string]int)
+	current := ""
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 0:
+		case fields[0] == "chain" && len(fields) > 1:
+			current = fields[1]
+			counts[current] = 0
+		case fields[0] == "}":
+			current = ""
+		case current != "" && fields[0] != "type":
+			counts[current]++
+		}
+	}
+	return counts
+}
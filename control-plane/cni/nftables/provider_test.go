@@ -0,0 +1,183 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package nftables
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/consul/sdk/iptables"
+	"github.com/stretchr/testify/require"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+func TestProvider_Ruleset(t *testing.T) {
+	cases := map[string]iptables.Config{
+		"minimal": {
+			ProxyUserID:      "5995",
+			ProxyInboundPort: 20000,
+		},
+		"outbound-port": {
+			ProxyUserID:       "5995",
+			ProxyInboundPort:  20000,
+			ProxyOutboundPort: 15002,
+		},
+		"exclusions": {
+			ProxyUserID:          "5995",
+			ProxyInboundPort:     20000,
+			ExcludeInboundPorts:  []string{"22", "8000:8080"},
+			ExcludeOutboundPorts: []string{"9090"},
+			ExcludeOutboundCIDRs: []string{"10.0.0.0/8", "192.168.1.1"},
+			ExcludeUIDs:          []string{"1000", "1001"},
+		},
+		"dns": {
+			ProxyUserID:      "5995",
+			ProxyInboundPort: 20000,
+			ConsulDNSIP:      "10.0.34.16",
+		},
+		"dns-port": {
+			ProxyUserID:      "5995",
+			ProxyInboundPort: 20000,
+			ConsulDNSPort:    8600,
+		},
+	}
+
+	for name, cfg := range cases {
+		t.Run(name, func(t *testing.T) {
+			executor := &fakeExecutor{}
+			provider := NewProvider("/var/run/netns/pod", executor)
+			cfg.IptablesProvider = provider
+			require.NoError(t, iptables.Setup(cfg))
+
+			ruleset, err := provider.Ruleset()
+			require.NoError(t, err)
+
+			goldenFile := filepath.Join("testdata", name+".golden")
+			if *update {
+				require.NoError(t, os.WriteFile(goldenFile, []byte(ruleset), 0644))
+			}
+			expected, err := os.ReadFile(goldenFile)
+			require.NoError(t, err)
+			require.Equal(t, string(expected), ruleset)
+
+			// The ruleset is applied with a single nft run in the network namespace.
+			require.Len(t, executor.calls, 1)
+			require.Equal(t, "nsenter --net=/var/run/netns/pod -- nft -f -", executor.calls[0])
+			require.Equal(t, ruleset, executor.stdin[0])
+		})
+	}
+}
+
+func TestProvider_UnsupportedRule(t *testing.T) {
+	cases := map[string][]string{
+		"filter table":      {"-t", "filter", "-A", "INPUT", "-j", "ACCEPT"},
+		"unknown option":    {"-t", "nat", "-A", "OUTPUT", "-s", "10.0.0.1", "-j", "RETURN"},
+		"dport without -p":  {"-t", "nat", "-A", "OUTPUT", "--dport", "53", "-j", "RETURN"},
+		"missing target":    {"-t", "nat", "-A", "OUTPUT", "-p", "tcp"},
+		"missing to-port":   {"-t", "nat", "-A", "OUTPUT", "-p", "tcp", "-j", "REDIRECT"},
+		"missing operation": {"-t", "nat"},
+	}
+
+	for name, args := range cases {
+		t.Run(name, func(t *testing.T) {
+			executor := &fakeExecutor{}
+			provider := NewProvider("", executor)
+			provider.AddRule("iptables", args...)
+			err := provider.ApplyRules()
+			require.Error(t, err)
+			require.Contains(t, err.Error(), "unsupported iptables rule")
+			require.Empty(t, executor.calls)
+		})
+	}
+}
+
+func TestProvider_Verify(t *testing.T) {
+	listing := `table ip consul {
+	chain CONSUL_PROXY_INBOUND {
+		meta l4proto tcp jump CONSUL_PROXY_IN_REDIRECT
+	}
+	chain CONSUL_PROXY_IN_REDIRECT {
+		meta l4proto tcp redirect to :20000
+	}
+	chain CONSUL_PROXY_OUTPUT {
+		meta skuid 5995 return
+		ip daddr 127.0.0.1 return
+		jump CONSUL_PROXY_REDIRECT
+	}
+	chain CONSUL_PROXY_REDIRECT {
+		meta l4proto tcp redirect to :15001
+	}
+	chain CONSUL_DNS_REDIRECT {
+	}
+	chain OUTPUT {
+		type nat hook output priority dstnat; policy accept;
+		meta l4proto tcp jump CONSUL_PROXY_OUTPUT
+	}
+	chain PREROUTING {
+		type nat hook prerouting priority dstnat; policy accept;
+		meta l4proto tcp jump CONSUL_PROXY_INBOUND
+	}
+}
+`
+	cases := map[string]struct {
+		listing string
+		expErr  string
+	}{
+		"rules in place": {
+			listing: listing,
+		},
+		"missing table": {
+			expErr: "nftables table consul is missing",
+		},
+		"missing chain": {
+			listing: strings.Replace(listing, "chain CONSUL_DNS_REDIRECT {\n\t}\n", "", 1),
+			expErr:  "nftables chain CONSUL_DNS_REDIRECT is missing",
+		},
+		"missing rule": {
+			listing: strings.Replace(listing, "\t\tjump CONSUL_PROXY_REDIRECT\n", "", 1),
+			expErr:  "nftables chain CONSUL_PROXY_OUTPUT has 2 rules, expected 3",
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			executor := &fakeExecutor{outputs: map[string]string{}}
+			if c.listing != "" {
+				executor.outputs["nsenter --net=/var/run/netns/pod -- nft list table ip consul"] = c.listing
+			}
+			provider := NewProvider("/var/run/netns/pod", executor)
+			addRules(t, provider, iptables.Config{ProxyUserID: "5995", ProxyInboundPort: 20000})
+
+			err := provider.Verify()
+			if c.expErr == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			require.Contains(t, err.Error(), c.expErr)
+		})
+	}
+}
+
+// addRules adds the rules for the config to the provider without applying them.
+func addRules(t *testing.T, provider *Provider, cfg iptables.Config) {
+	recorder := &recorder{}
+	cfg.IptablesProvider = recorder
+	require.NoError(t, iptables.Setup(cfg))
+	for _, args := range recorder.rules {
+		provider.AddRule("iptables", args...)
+	}
+}
+
+type recorder struct {
+	rules [][]string
+}
+
+func (r *recorder) AddRule(_ string, args ...string) { r.rules = append(r.rules, args) }
+func (r *recorder) ApplyRules() error                { return nil }
+func (r *recorder) Rules() []string                  { return nil }
@@ -7,6 +7,7 @@ import (
 	"os"
 
 	cmdACLInit "github.com/hashicorp/consul-k8s/control-plane/subcommand/acl-init"
+	cmdConfigValidate "github.com/hashicorp/consul-k8s/control-plane/subcommand/config-validate"
 	cmdConnectInit "github.com/hashicorp/consul-k8s/control-plane/subcommand/connect-init"
 	cmdConsulLogout "github.com/hashicorp/consul-k8s/control-plane/subcommand/consul-logout"
 	cmdCreateFederationSecret "github.com/hashicorp/consul-k8s/control-plane/subcommand/create-federation-secret"
@@ -14,12 +15,16 @@ import (
 	cmdFetchServerRegion "github.com/hashicorp/consul-k8s/control-plane/subcommand/fetch-server-region"
 	cmdGetConsulClientCA "github.com/hashicorp/consul-k8s/control-plane/subcommand/get-consul-client-ca"
 	cmdGossipEncryptionAutogenerate "github.com/hashicorp/consul-k8s/control-plane/subcommand/gossip-encryption-autogenerate"
+	cmdGossipKeyRotate "github.com/hashicorp/consul-k8s/control-plane/subcommand/gossip-key-rotate"
+	cmdInject "github.com/hashicorp/consul-k8s/control-plane/subcommand/inject"
 	cmdInjectConnect "github.com/hashicorp/consul-k8s/control-plane/subcommand/inject-connect"
 	cmdInstallCNI "github.com/hashicorp/consul-k8s/control-plane/subcommand/install-cni"
 	cmdPartitionInit "github.com/hashicorp/consul-k8s/control-plane/subcommand/partition-init"
+	cmdRotateACLTokens "github.com/hashicorp/consul-k8s/control-plane/subcommand/rotate-acl-tokens"
 	cmdServerACLInit "github.com/hashicorp/consul-k8s/control-plane/subcommand/server-acl-init"
 	cmdSyncCatalog "github.com/hashicorp/consul-k8s/control-plane/subcommand/sync-catalog"
 	cmdTLSInit "github.com/hashicorp/consul-k8s/control-plane/subcommand/tls-init"
+	cmdTLSRotator "github.com/hashicorp/consul-k8s/control-plane/subcommand/tls-rotator"
 	cmdVersion "github.com/hashicorp/consul-k8s/control-plane/subcommand/version"
 	webhookCertManager "github.com/hashicorp/consul-k8s/control-plane/subcommand/webhook-cert-manager"
 	"github.com/hashicorp/consul-k8s/control-plane/version"
@@ -45,6 +50,14 @@ func init() {
 			return &cmdInjectConnect.Command{UI: ui}, nil
 		},
 
+		"inject": func() (cli.Command, error) {
+			return &cmdInject.Command{UI: ui}, nil
+		},
+
+		"config validate": func() (cli.Command, error) {
+			return &cmdConfigValidate.Command{UI: ui}, nil
+		},
+
 		"consul-logout": func() (cli.Command, error) {
 			return &cmdConsulLogout.Command{UI: ui}, nil
 		},
@@ -57,6 +70,10 @@ func init() {
 			return &cmdPartitionInit.Command{UI: ui}, nil
 		},
 
+		"rotate-acl-tokens": func() (cli.Command, error) {
+			return &cmdRotateACLTokens.Command{UI: ui}, nil
+		},
+
 		"sync-catalog": func() (cli.Command, error) {
 			return &cmdSyncCatalog.Command{UI: ui}, nil
 		},
@@ -85,9 +102,16 @@ func init() {
 			return &cmdTLSInit.Command{UI: ui}, nil
 		},
 
+		"tls-rotator": func() (cli.Command, error) {
+			return &cmdTLSRotator.Command{UI: ui}, nil
+		},
+
 		"gossip-encryption-autogenerate": func() (cli.Command, error) {
 			return &cmdGossipEncryptionAutogenerate.Command{UI: ui}, nil
 		},
+		"gossip-key-rotate": func() (cli.Command, error) {
+			return &cmdGossipKeyRotate.Command{UI: ui}, nil
+		},
 		"install-cni": func() (cli.Command, error) {
 			return &cmdInstallCNI.Command{UI: ui}, nil
 		},
@@ -166,6 +166,11 @@ const (
 	// iptables rules.
 	AnnotationRedirectTraffic = "consul.hashicorp.com/redirect-traffic-config"
 
+	// AnnotationCNIStatus is the key of the annotation that the CNI installer adds to
+	// nodes to report whether the consul-cni plugin is installed in the active CNI
+	// config file. Its value is CNIStatusInstalled or CNIStatusNotInstalled.
+	AnnotationCNIStatus = "consul.hashicorp.com/cni-status"
+
 	// AnnotationOriginalPod is the value of the pod before being overwritten by the consul
 	// webhook/meshWebhook.
 	AnnotationOriginalPod = "consul.hashicorp.com/original-pod"
@@ -185,12 +190,21 @@ const (
 	// by the peering controllers.
 	LabelPeeringToken = "consul.hashicorp.com/peering-token"
 
+	// LabelCNIStatus is the label that the CNI installer adds to nodes alongside
+	// AnnotationCNIStatus so that pods that rely on the consul-cni plugin can be
+	// required to be scheduled on nodes where it's installed.
+	LabelCNIStatus = "consul.hashicorp.com/cni-status"
+
 	// Injected is used as the annotation value for keyInjectStatus and annotationInjected.
 	Injected = "injected"
 
 	// Enabled is used as the annotation value for keyTransparentProxyStatus.
 	Enabled = "enabled"
 
+	// CNIStatusInstalled and CNIStatusNotInstalled are the values for AnnotationCNIStatus and LabelCNIStatus.
+	CNIStatusInstalled    = "installed"
+	CNIStatusNotInstalled = "not-installed"
+
 	// ManagedByValue is the value for keyManagedBy.
 	ManagedByValue = "consul-k8s-endpoints-controller"
 )
@@ -20,6 +20,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/utils/pointer"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
@@ -46,14 +47,28 @@ type AcceptorController struct {
 	Log logr.Logger
 	// Scheme is the API scheme that this controller should have.
 	Scheme *runtime.Scheme
+	// VaultSecretBackend stores peering tokens for resources that use the
+	// "vault" secret backend. It is nil if the Vault backend is not configured.
+	VaultSecretBackend SecretBackend
+	// SecretPollInterval is how often resources whose peering token is stored
+	// outside of Kubernetes are reconciled to detect changes to the token.
+	SecretPollInterval time.Duration
+	// HealthCheckInterval is how often the state of the peering in Consul is
+	// read and mirrored into the status. If 0, it is only read when the
+	// resource is reconciled for another reason.
+	HealthCheckInterval time.Duration
+	// EventRecorder is used to emit Kubernetes events when the state of the
+	// peering changes. If nil, no events are emitted.
+	EventRecorder record.EventRecorder
 	context.Context
 }
 
 const (
-	finalizerName    = "finalizers.consul.hashicorp.com"
-	consulAgentError = "consulAgentError"
-	internalError    = "internalError"
-	kubernetesError  = "kubernetesError"
+	finalizerName      = "finalizers.consul.hashicorp.com"
+	consulAgentError   = "consulAgentError"
+	internalError      = "internalError"
+	kubernetesError    = "kubernetesError"
+	secretBackendError = "secretBackendError"
 )
 
 //+kubebuilder:rbac:groups=consul.hashicorp.com,resources=peeringacceptors,verbs=get;list;watch;create;update;patch;delete
@@ -117,11 +132,10 @@ func (r *AcceptorController) Reconcile(ctx context.Context, req ctrl.Request) (c
 	} else {
 		if containsString(acceptor.Finalizers, finalizerName) {
 			r.Log.Info("PeeringAcceptor was deleted, deleting from Consul", "name", req.Name, "ns", req.Namespace)
-			err := r.deletePeering(ctx, apiClient, req.Name)
-			if acceptor.Secret().Backend == "kubernetes" {
-				err = r.deleteK8sSecret(ctx, acceptor.Secret().Name, acceptor.Namespace)
+			if err := r.deletePeering(ctx, apiClient, req.Name); err != nil {
+				return ctrl.Result{}, err
 			}
-			if err != nil {
+			if err := r.deleteSecret(ctx, acceptor.Namespace, *acceptor.Secret()); err != nil {
 				return ctrl.Result{}, err
 			}
 			controllerutil.RemoveFinalizer(acceptor, finalizerName)
@@ -130,11 +144,11 @@ func (r *AcceptorController) Reconcile(ctx context.Context, req ctrl.Request) (c
 		}
 	}
 
-	// existingSecret will be nil if it doesn't exist, and have the contents of the secret if it does exist.
-	existingSecret, err := r.getExistingSecret(ctx, acceptor.Secret().Name, acceptor.Namespace)
+	// existingToken will be nil if the secret doesn't exist.
+	existingToken, err := r.readSecret(ctx, acceptor.Namespace, *acceptor.Secret())
 	if err != nil {
 		r.Log.Error(err, "error retrieving existing secret", "name", acceptor.Secret().Name)
-		r.updateStatusError(ctx, acceptor, kubernetesError, err)
+		r.updateStatusError(ctx, acceptor, secretErrorReason(acceptor.Secret().Backend), err)
 		return ctrl.Result{}, err
 	}
 
@@ -152,8 +166,8 @@ func (r *AcceptorController) Reconcile(ctx context.Context, req ctrl.Request) (c
 
 		if acceptor.SecretRef() != nil {
 			r.Log.Info("stale secret in status; deleting stale secret", "name", acceptor.Name, "secret-name", acceptor.SecretRef().Name)
-			if err := r.deleteK8sSecret(ctx, acceptor.SecretRef().Name, acceptor.Namespace); err != nil {
-				r.updateStatusError(ctx, acceptor, kubernetesError, err)
+			if err := r.deleteSecret(ctx, acceptor.Namespace, acceptor.SecretRef().Secret); err != nil {
+				r.updateStatusError(ctx, acceptor, secretErrorReason(acceptor.SecretRef().Backend), err)
 				return ctrl.Result{}, err
 			}
 		}
@@ -163,15 +177,13 @@ func (r *AcceptorController) Reconcile(ctx context.Context, req ctrl.Request) (c
 			r.updateStatusError(ctx, acceptor, consulAgentError, err)
 			return ctrl.Result{}, err
 		}
-		if acceptor.Secret().Backend == "kubernetes" {
-			if err := r.createOrUpdateK8sSecret(ctx, acceptor, resp); err != nil {
-				r.updateStatusError(ctx, acceptor, kubernetesError, err)
-				return ctrl.Result{}, err
-			}
+		if err := r.writeSecret(ctx, acceptor.Namespace, *acceptor.Secret(), resp.PeeringToken); err != nil {
+			r.updateStatusError(ctx, acceptor, secretErrorReason(acceptor.Secret().Backend), err)
+			return ctrl.Result{}, err
 		}
 		// Store the state in the status.
 		err := r.updateStatus(ctx, req.NamespacedName)
-		return ctrl.Result{}, err
+		return r.successResult(acceptor), err
 	}
 
 	// TODO(peering): Verify that the existing peering in Consul is an acceptor peer. If it is a dialing peer, an error should be thrown.
@@ -179,7 +191,7 @@ func (r *AcceptorController) Reconcile(ctx context.Context, req ctrl.Request) (c
 	r.Log.Info("peering exists in Consul")
 
 	// If the peering does exist in Consul, figure out whether to generate and store a new token.
-	shouldGenerate, nameChanged, err := shouldGenerateToken(acceptor, existingSecret)
+	shouldGenerate, nameChanged, err := shouldGenerateToken(acceptor, existingToken != nil)
 	if err != nil {
 		r.updateStatusError(ctx, acceptor, internalError, err)
 		return ctrl.Result{}, err
@@ -192,31 +204,32 @@ func (r *AcceptorController) Reconcile(ctx context.Context, req ctrl.Request) (c
 		if resp, err = r.generateToken(ctx, apiClient, acceptor.Name); err != nil {
 			return ctrl.Result{}, err
 		}
-		if acceptor.Secret().Backend == "kubernetes" {
-			if err = r.createOrUpdateK8sSecret(ctx, acceptor, resp); err != nil {
-				return ctrl.Result{}, err
-			}
+		if err = r.writeSecret(ctx, acceptor.Namespace, *acceptor.Secret(), resp.PeeringToken); err != nil {
+			return ctrl.Result{}, err
 		}
 		// Delete the existing secret if the name changed. This needs to come before updating the status if we do generate a new token.
 		if nameChanged && acceptor.SecretRef() != nil {
 			r.Log.Info("stale secret in status; deleting stale secret", "name", acceptor.Name, "secret-name", acceptor.SecretRef().Name)
-			if err = r.deleteK8sSecret(ctx, acceptor.SecretRef().Name, acceptor.Namespace); err != nil {
-				r.updateStatusError(ctx, acceptor, kubernetesError, err)
+			if err = r.deleteSecret(ctx, acceptor.Namespace, acceptor.SecretRef().Secret); err != nil {
+				r.updateStatusError(ctx, acceptor, secretErrorReason(acceptor.SecretRef().Backend), err)
 				return ctrl.Result{}, err
 			}
 		}
 
 		// Store the state in the status.
 		err := r.updateStatus(ctx, req.NamespacedName)
-		return ctrl.Result{}, err
+		return r.successResult(acceptor), err
 	}
 
-	return ctrl.Result{}, nil
+	if err := r.updatePeeringStatus(ctx, acceptor, peering); err != nil {
+		return ctrl.Result{}, err
+	}
+	return r.successResult(acceptor), nil
 }
 
 // shouldGenerateToken returns whether a token should be generated, and whether the name of the secret has changed. It
 // compares the spec secret's name/key/backend and resource version with the name/key/backend and resource version of the status secret's.
-func shouldGenerateToken(acceptor *consulv1alpha1.PeeringAcceptor, existingSecret *corev1.Secret) (shouldGenerate bool, nameChanged bool, err error) {
+func shouldGenerateToken(acceptor *consulv1alpha1.PeeringAcceptor, secretExists bool) (shouldGenerate bool, nameChanged bool, err error) {
 	if acceptor.SecretRef() != nil {
 		// Compare the existing name, key, and backend.
 		if acceptor.SecretRef().Name != acceptor.Secret().Name {
@@ -240,7 +253,7 @@ func shouldGenerateToken(acceptor *consulv1alpha1.PeeringAcceptor, existingSecre
 		}
 	}
 
-	if existingSecret == nil {
+	if !secretExists {
 		return true, false, nil
 	}
 
@@ -285,55 +298,58 @@ func (r *AcceptorController) updateStatusError(ctx context.Context, acceptor *co
 	}
 }
 
-// getExistingSecret gets the K8s secret specified, and either returns the existing secret or nil if it doesn't exist.
-func (r *AcceptorController) getExistingSecret(ctx context.Context, name string, namespace string) (*corev1.Secret, error) {
-	existingSecret := &corev1.Secret{}
-	namespacedName := types.NamespacedName{Name: name, Namespace: namespace}
-	err := r.Client.Get(ctx, namespacedName, existingSecret)
-	if k8serrors.IsNotFound(err) {
-		// The secret was deleted.
-		return nil, nil
-	} else if err != nil {
-		r.Log.Error(err, "couldn't get secret", "name", name, "namespace", namespace)
-		return nil, err
+// updatePeeringStatus mirrors the state of the peering in Consul into the peeringAcceptor's status. The Synced
+// condition is False while the peering is failing or terminated.
+func (r *AcceptorController) updatePeeringStatus(ctx context.Context, acceptor *consulv1alpha1.PeeringAcceptor, peering *api.Peering) error {
+	status := peeringStatus(peering)
+	synced, reason, message, syncedChanged := peeringSyncedCondition(acceptor.Status.Conditions, peering.State)
+	if !peeringStatusChanged(acceptor.Status.Peering, status) && !syncedChanged {
+		return nil
+	}
+	recordPeeringStateChange(r.EventRecorder, acceptor, acceptor.Status.Peering, status.State)
+	acceptor.Status.Peering = status
+	if syncedChanged {
+		acceptor.SetSyncedCondition(synced, reason, message)
+	}
+	err := r.Status().Update(ctx, acceptor)
+	if err != nil {
+		r.Log.Error(err, "failed to update PeeringAcceptor status", "name", acceptor.Name, "namespace", acceptor.Namespace)
 	}
-	return existingSecret, nil
+	return err
 }
 
-// createOrUpdateK8sSecret creates a secret and uses the controller's K8s client to apply the secret. It checks if
-// there's an existing secret with the same name and makes sure to update the existing secret if so.
-func (r *AcceptorController) createOrUpdateK8sSecret(ctx context.Context, acceptor *consulv1alpha1.PeeringAcceptor, resp *api.PeeringGenerateTokenResponse) error {
-	secretName := acceptor.Secret().Name
-	secretNamespace := acceptor.Namespace
-	secret := createSecret(secretName, secretNamespace, acceptor.Secret().Key, resp.PeeringToken)
-	existingSecret, err := r.getExistingSecret(ctx, secretName, secretNamespace)
+// readSecret reads the peering token from the secret's backend. It returns nil if the secret doesn't exist.
+func (r *AcceptorController) readSecret(ctx context.Context, namespace string, secret consulv1alpha1.Secret) (*PeeringToken, error) {
+	backend, err := secretBackendFor(secret.Backend, r.Client, r.VaultSecretBackend)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if existingSecret != nil {
-		if err := r.Client.Update(ctx, secret); err != nil {
-			return err
-		}
+	return backend.Read(ctx, namespace, secret)
+}
 
-	} else {
-		if err := r.Client.Create(ctx, secret); err != nil {
-			return err
-		}
+// writeSecret stores the peering token in the secret's backend, creating or updating the secret.
+func (r *AcceptorController) writeSecret(ctx context.Context, namespace string, secret consulv1alpha1.Secret, token string) error {
+	backend, err := secretBackendFor(secret.Backend, r.Client, r.VaultSecretBackend)
+	if err != nil {
+		return err
 	}
-	return nil
+	return backend.Write(ctx, namespace, secret, token)
 }
 
-func (r *AcceptorController) deleteK8sSecret(ctx context.Context, name, namespace string) error {
-	existingSecret, err := r.getExistingSecret(ctx, name, namespace)
+// deleteSecret deletes the secret from its backend if it exists.
+func (r *AcceptorController) deleteSecret(ctx context.Context, namespace string, secret consulv1alpha1.Secret) error {
+	backend, err := secretBackendFor(secret.Backend, r.Client, r.VaultSecretBackend)
 	if err != nil {
 		return err
 	}
-	if existingSecret != nil {
-		if err := r.Client.Delete(ctx, existingSecret); err != nil {
-			return err
-		}
-	}
-	return nil
+	return backend.Delete(ctx, namespace, secret)
+}
+
+// successResult returns the result of a successful reconcile. Secrets stored outside of Kubernetes can't be
+// watched so the acceptor is requeued to regenerate the token if the secret is deleted. The acceptor is also
+// requeued to keep the peering state in its status up to date.
+func (r *AcceptorController) successResult(acceptor *consulv1alpha1.PeeringAcceptor) ctrl.Result {
+	return requeueAfter(pollResult(acceptor.Secret().Backend, r.SecretPollInterval), r.HealthCheckInterval)
 }
 
 // SetupWithManager sets up the controller with the Manager.
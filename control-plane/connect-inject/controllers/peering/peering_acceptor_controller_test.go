@@ -973,7 +973,7 @@ func TestShouldGenerateToken(t *testing.T) {
 
 	for _, tt := range cases {
 		t.Run(tt.name, func(t *testing.T) {
-			shouldGenerate, nameChanged, err := shouldGenerateToken(tt.peeringAcceptor, tt.existingSecret())
+			shouldGenerate, nameChanged, err := shouldGenerateToken(tt.peeringAcceptor, tt.existingSecret() != nil)
 			if tt.expErr == nil {
 				require.NoError(t, err)
 				require.Equal(t, shouldGenerate, tt.expShouldGenerate)
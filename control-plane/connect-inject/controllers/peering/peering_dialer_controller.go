@@ -20,6 +20,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/utils/pointer"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
@@ -42,6 +43,29 @@ type PeeringDialerController struct {
 	Log logr.Logger
 	// Scheme is the API scheme that this controller should have.
 	Scheme *runtime.Scheme
+	// VaultSecretBackend reads peering tokens for resources that use the
+	// "vault" secret backend. It is nil if the Vault backend is not configured.
+	VaultSecretBackend SecretBackend
+	// SecretPollInterval is how often resources whose peering token is stored
+	// outside of Kubernetes are reconciled to detect a rotated token.
+	SecretPollInterval time.Duration
+	// HealthCheckInterval is how often the state of the peering in Consul is
+	// read and mirrored into the status. If 0, it is only read when the
+	// resource is reconciled for another reason.
+	HealthCheckInterval time.Duration
+	// AutoRedial re-establishes peerings that Consul reports as terminated
+	// using the token in spec.peer.secret.
+	AutoRedial bool
+	// RedialBackoff is how long to wait after the first attempt to
+	// re-establish a terminated peering before trying again. The wait doubles
+	// after each attempt until the peering is active again.
+	RedialBackoff time.Duration
+	// MaxRedialBackoff is the longest wait between attempts to re-establish a
+	// terminated peering.
+	MaxRedialBackoff time.Duration
+	// EventRecorder is used to emit Kubernetes events when the state of the
+	// peering changes or it is re-established. If nil, no events are emitted.
+	EventRecorder record.EventRecorder
 	context.Context
 }
 
@@ -102,10 +126,10 @@ func (r *PeeringDialerController) Reconcile(ctx context.Context, req ctrl.Reques
 	}
 
 	// specSecret will be nil if the secret specified by the spec doesn't exist.
-	var specSecret *corev1.Secret
-	specSecret, err = r.getSecret(ctx, dialer.Secret().Name, dialer.Namespace)
+	var specSecret *PeeringToken
+	specSecret, err = r.readSecret(ctx, dialer.Namespace, *dialer.Secret())
 	if err != nil {
-		r.updateStatusError(ctx, dialer, kubernetesError, err)
+		r.updateStatusError(ctx, dialer, secretErrorReason(dialer.Secret().Backend), err)
 		return ctrl.Result{}, err
 	}
 
@@ -123,11 +147,11 @@ func (r *PeeringDialerController) Reconcile(ctx context.Context, req ctrl.Reques
 	}
 
 	// statusSecret will be nil if the secret specified by the status doesn't exist.
-	var statusSecret *corev1.Secret
+	var statusSecret *PeeringToken
 	if secretRefSet {
-		statusSecret, err = r.getSecret(ctx, dialer.SecretRef().Name, dialer.Namespace)
+		statusSecret, err = r.readSecret(ctx, dialer.Namespace, dialer.SecretRef().Secret)
 		if err != nil {
-			r.updateStatusError(ctx, dialer, kubernetesError, err)
+			r.updateStatusError(ctx, dialer, secretErrorReason(dialer.SecretRef().Backend), err)
 			return ctrl.Result{}, err
 		}
 	}
@@ -138,13 +162,12 @@ func (r *PeeringDialerController) Reconcile(ctx context.Context, req ctrl.Reques
 		// Whether the peering exists in Consul or not we want to initiate the peering so the status can reflect the
 		// correct secret specified in the spec.
 		r.Log.Info("the secret in status.secretRef doesn't exist or wasn't set, establishing peering with the existing spec.peer.secret", "secret-name", dialer.Secret().Name, "secret-namespace", dialer.Namespace)
-		peeringToken := specSecret.Data[dialer.Secret().Key]
-		if err := r.establishPeering(ctx, apiClient, dialer.Name, string(peeringToken)); err != nil {
+		if err := r.establishPeering(ctx, apiClient, dialer.Name, specSecret.Token); err != nil {
 			r.updateStatusError(ctx, dialer, consulAgentError, err)
 			return ctrl.Result{}, err
 		} else {
-			err := r.updateStatus(ctx, req.NamespacedName, specSecret.ResourceVersion)
-			return ctrl.Result{}, err
+			err := r.updateStatus(ctx, req.NamespacedName, specSecret.Version)
+			return r.successResult(dialer), err
 		}
 	} else {
 		// At this point, the status secret does exist.
@@ -161,13 +184,12 @@ func (r *PeeringDialerController) Reconcile(ctx context.Context, req ctrl.Reques
 
 		if peering == nil {
 			r.Log.Info("status.secret exists, but the peering doesn't exist in Consul; establishing peering with the existing spec.peer.secret", "secret-name", dialer.Secret().Name, "secret-namespace", dialer.Namespace)
-			peeringToken := specSecret.Data[dialer.Secret().Key]
-			if err := r.establishPeering(ctx, apiClient, dialer.Name, string(peeringToken)); err != nil {
+			if err := r.establishPeering(ctx, apiClient, dialer.Name, specSecret.Token); err != nil {
 				r.updateStatusError(ctx, dialer, consulAgentError, err)
 				return ctrl.Result{}, err
 			} else {
-				err := r.updateStatus(ctx, req.NamespacedName, specSecret.ResourceVersion)
-				return ctrl.Result{}, err
+				err := r.updateStatus(ctx, req.NamespacedName, specSecret.Version)
+				return r.successResult(dialer), err
 			}
 		}
 
@@ -175,36 +197,79 @@ func (r *PeeringDialerController) Reconcile(ctx context.Context, req ctrl.Reques
 		// differences, initiate peering.
 		if r.specStatusSecretsDifferent(dialer, specSecret) {
 			r.Log.Info("the spec.peer.secret is different from the status secret, re-establishing peering", "secret-name", dialer.Secret().Name, "secret-namespace", dialer.Namespace)
-			peeringToken := specSecret.Data[dialer.Secret().Key]
-			if err := r.establishPeering(ctx, apiClient, dialer.Name, string(peeringToken)); err != nil {
+			if err := r.establishPeering(ctx, apiClient, dialer.Name, specSecret.Token); err != nil {
 				r.updateStatusError(ctx, dialer, consulAgentError, err)
 				return ctrl.Result{}, err
 			} else {
-				err := r.updateStatus(ctx, req.NamespacedName, specSecret.ResourceVersion)
-				return ctrl.Result{}, err
+				err := r.updateStatus(ctx, req.NamespacedName, specSecret.Version)
+				return r.successResult(dialer), err
 			}
 		}
 
 		if updated, err := r.versionAnnotationUpdated(dialer); err == nil && updated {
 			r.Log.Info("the version annotation was incremented; re-establishing peering with spec.peer.secret", "secret-name", dialer.Secret().Name, "secret-namespace", dialer.Namespace)
-			peeringToken := specSecret.Data[dialer.Secret().Key]
-			if err := r.establishPeering(ctx, apiClient, dialer.Name, string(peeringToken)); err != nil {
+			if err := r.establishPeering(ctx, apiClient, dialer.Name, specSecret.Token); err != nil {
 				r.updateStatusError(ctx, dialer, consulAgentError, err)
 				return ctrl.Result{}, err
 			} else {
-				err := r.updateStatus(ctx, req.NamespacedName, specSecret.ResourceVersion)
-				return ctrl.Result{}, err
+				err := r.updateStatus(ctx, req.NamespacedName, specSecret.Version)
+				return r.successResult(dialer), err
 			}
 		} else if err != nil {
 			r.updateStatusError(ctx, dialer, internalError, err)
 			return ctrl.Result{}, err
 		}
+
+		// Finally, mirror the health of the peering into the status and re-establish it if it was terminated.
+		if r.AutoRedial && peering.State == api.PeeringStateTerminated {
+			return r.redial(ctx, apiClient, dialer, peering, specSecret)
+		}
+		if err := r.updatePeeringStatus(ctx, dialer, peering); err != nil {
+			return ctrl.Result{}, err
+		}
 	}
 
-	return ctrl.Result{}, nil
+	return r.successResult(dialer), nil
+}
+
+// redial re-establishes a terminated peering with the token in spec.peer.secret. Attempts are spaced out with an
+// exponential backoff that is reset once the peering is active again.
+func (r *PeeringDialerController) redial(ctx context.Context, apiClient *api.Client, dialer *consulv1alpha1.PeeringDialer, peering *api.Peering, token *PeeringToken) (ctrl.Result, error) {
+	if dialer.Status.LastRedialTime != nil {
+		backoff := redialBackoff(dialer.Status.RedialAttempts, r.RedialBackoff, r.MaxRedialBackoff)
+		if wait := time.Until(dialer.Status.LastRedialTime.Add(backoff)); wait > 0 {
+			r.Log.Info("peering was terminated; waiting before re-establishing peering", "name", dialer.Name, "wait", wait)
+			return ctrl.Result{RequeueAfter: wait}, r.updatePeeringStatus(ctx, dialer, peering)
+		}
+	}
+
+	attempt := dialer.Status.RedialAttempts + 1
+	r.Log.Info("peering was terminated; re-establishing peering with spec.peer.secret", "name", dialer.Name, "attempt", attempt)
+	status := peeringStatus(peering)
+	recordPeeringStateChange(r.EventRecorder, dialer, dialer.Status.Peering, status.State)
+	dialer.Status.Peering = status
+	dialer.Status.RedialAttempts = attempt
+	dialer.Status.LastRedialTime = &metav1.Time{Time: time.Now()}
+	result := requeueAfter(ctrl.Result{RequeueAfter: redialBackoff(attempt, r.RedialBackoff, r.MaxRedialBackoff)}, r.HealthCheckInterval)
+
+	if err := r.establishPeering(ctx, apiClient, dialer.Name, token.Token); err != nil {
+		r.recordEvent(dialer, corev1.EventTypeWarning, RedialFailedReason, redialMessage(attempt, err))
+		// The error is surfaced in the status rather than returned so that the next attempt is made after the
+		// backoff rather than the controller's rate limit.
+		r.updateStatusError(ctx, dialer, consulAgentError, err)
+		return result, nil
+	}
+	r.recordEvent(dialer, corev1.EventTypeNormal, RedialReason, redialMessage(attempt, nil))
+	dialer.Status.LastSyncedTime = &metav1.Time{Time: time.Now()}
+	dialer.SetSyncedCondition(corev1.ConditionTrue, "", "")
+	if err := r.Status().Update(ctx, dialer); err != nil {
+		r.Log.Error(err, "failed to update PeeringDialer status", "name", dialer.Name, "namespace", dialer.Namespace)
+		return ctrl.Result{}, err
+	}
+	return result, nil
 }
 
-func (r *PeeringDialerController) specStatusSecretsDifferent(dialer *consulv1alpha1.PeeringDialer, existingSpecSecret *corev1.Secret) bool {
+func (r *PeeringDialerController) specStatusSecretsDifferent(dialer *consulv1alpha1.PeeringDialer, existingSpecSecret *PeeringToken) bool {
 	if dialer.SecretRef().Name != dialer.Secret().Name {
 		return true
 	}
@@ -214,7 +279,7 @@ func (r *PeeringDialerController) specStatusSecretsDifferent(dialer *consulv1alp
 	if dialer.SecretRef().Backend != dialer.Secret().Backend {
 		return true
 	}
-	return dialer.SecretRef().ResourceVersion != existingSpecSecret.ResourceVersion
+	return dialer.SecretRef().ResourceVersion != existingSpecSecret.Version
 }
 
 func (r *PeeringDialerController) updateStatus(ctx context.Context, dialerObjKey types.NamespacedName, resourceVersion string) error {
@@ -253,18 +318,52 @@ func (r *PeeringDialerController) updateStatusError(ctx context.Context, dialer
 	}
 }
 
-func (r *PeeringDialerController) getSecret(ctx context.Context, name string, namespace string) (*corev1.Secret, error) {
-	secret := &corev1.Secret{}
-	namespacedName := types.NamespacedName{Name: name, Namespace: namespace}
-	err := r.Client.Get(ctx, namespacedName, secret)
-	if k8serrors.IsNotFound(err) {
-		// The secret was deleted.
-		return nil, nil
-	} else if err != nil {
-		r.Log.Error(err, "couldn't get secret", "name", name, "namespace", namespace)
+// updatePeeringStatus mirrors the state of the peering in Consul into the peeringDialer's status. The Synced
+// condition is False while the peering is failing or terminated. Once the peering is active, the count of attempts
+// to re-establish it is reset.
+func (r *PeeringDialerController) updatePeeringStatus(ctx context.Context, dialer *consulv1alpha1.PeeringDialer, peering *api.Peering) error {
+	status := peeringStatus(peering)
+	resetRedial := peering.State == api.PeeringStateActive && dialer.Status.RedialAttempts > 0
+	synced, reason, message, syncedChanged := peeringSyncedCondition(dialer.Status.Conditions, peering.State)
+	if !peeringStatusChanged(dialer.Status.Peering, status) && !resetRedial && !syncedChanged {
+		return nil
+	}
+	recordPeeringStateChange(r.EventRecorder, dialer, dialer.Status.Peering, status.State)
+	dialer.Status.Peering = status
+	if syncedChanged {
+		dialer.SetSyncedCondition(synced, reason, message)
+	}
+	if resetRedial {
+		dialer.Status.RedialAttempts = 0
+	}
+	err := r.Status().Update(ctx, dialer)
+	if err != nil {
+		r.Log.Error(err, "failed to update PeeringDialer status", "name", dialer.Name, "namespace", dialer.Namespace)
+	}
+	return err
+}
+
+func (r *PeeringDialerController) recordEvent(dialer *consulv1alpha1.PeeringDialer, eventType, reason, message string) {
+	if r.EventRecorder == nil {
+		return
+	}
+	r.EventRecorder.Event(dialer, eventType, reason, message)
+}
+
+// readSecret reads the peering token from the secret's backend. It returns nil if the secret doesn't exist.
+func (r *PeeringDialerController) readSecret(ctx context.Context, namespace string, secret consulv1alpha1.Secret) (*PeeringToken, error) {
+	backend, err := secretBackendFor(secret.Backend, r.Client, r.VaultSecretBackend)
+	if err != nil {
 		return nil, err
 	}
-	return secret, nil
+	return backend.Read(ctx, namespace, secret)
+}
+
+// successResult returns the result of a successful reconcile. Secrets stored outside of Kubernetes can't be
+// watched so the dialer is requeued to re-establish the peering if the token is rotated. The dialer is also
+// requeued to keep the peering state in its status up to date and to notice terminated peerings.
+func (r *PeeringDialerController) successResult(dialer *consulv1alpha1.PeeringDialer) ctrl.Result {
+	return requeueAfter(pollResult(dialer.Secret().Backend, r.SecretPollInterval), r.HealthCheckInterval)
 }
 
 // SetupWithManager sets up the controller with the Manager.
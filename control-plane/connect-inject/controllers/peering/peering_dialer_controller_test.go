@@ -572,7 +572,7 @@ func TestSpecStatusSecretsDifferent(t *testing.T) {
 	t.Parallel()
 	cases := map[string]struct {
 		dialer      *v1alpha1.PeeringDialer
-		secret      *corev1.Secret
+		secret      *PeeringToken
 		isDifferent bool
 	}{
 		"different secret name in spec and status": {
@@ -669,10 +669,8 @@ func TestSpecStatusSecretsDifferent(t *testing.T) {
 					},
 				},
 			},
-			secret: &corev1.Secret{
-				ObjectMeta: metav1.ObjectMeta{
-					ResourceVersion: "version2",
-				},
+			secret: &PeeringToken{
+				Version: "version2",
 			},
 			isDifferent: true,
 		},
@@ -698,10 +696,8 @@ func TestSpecStatusSecretsDifferent(t *testing.T) {
 					},
 				},
 			},
-			secret: &corev1.Secret{
-				ObjectMeta: metav1.ObjectMeta{
-					ResourceVersion: "version1",
-				},
+			secret: &PeeringToken{
+				Version: "version1",
 			},
 			isDifferent: false,
 		},
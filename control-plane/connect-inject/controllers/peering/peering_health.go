@@ -0,0 +1,156 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package peering
+
+import (
+	"fmt"
+	"time"
+
+	consulv1alpha1 "github.com/hashicorp/consul-k8s/control-plane/api/v1alpha1"
+	"github.com/hashicorp/consul/api"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// PeeringStateChangedReason is the reason of the event emitted when the
+	// state of a peering in Consul changes.
+	PeeringStateChangedReason = "PeeringStateChanged"
+	// RedialReason is the reason of the event emitted when a terminated
+	// peering is re-established.
+	RedialReason = "Redial"
+	// RedialFailedReason is the reason of the event emitted when re-establishing
+	// a terminated peering fails.
+	RedialFailedReason = "RedialFailed"
+	// PeeringUnhealthyReason is the reason of the Synced condition while the
+	// peering is failing or terminated in Consul.
+	PeeringUnhealthyReason = "PeeringUnhealthy"
+)
+
+// peeringStatus returns the status of the peering as reported by Consul.
+func peeringStatus(peering *api.Peering) *consulv1alpha1.PeeringStatus {
+	return &consulv1alpha1.PeeringStatus{
+		State:            string(peering.State),
+		ImportedServices: len(peering.StreamStatus.ImportedServices),
+		ExportedServices: len(peering.StreamStatus.ExportedServices),
+		LastHeartbeat:    metaTime(peering.StreamStatus.LastHeartbeat),
+		LastReceive:      metaTime(peering.StreamStatus.LastReceive),
+		LastSend:         metaTime(peering.StreamStatus.LastSend),
+	}
+}
+
+// peeringStatusChanged returns whether the peering status differs from the
+// existing one. Times are compared at the precision they're stored at.
+func peeringStatusChanged(existing, updated *consulv1alpha1.PeeringStatus) bool {
+	if existing == nil || updated == nil {
+		return existing != updated
+	}
+	return existing.State != updated.State ||
+		existing.ImportedServices != updated.ImportedServices ||
+		existing.ExportedServices != updated.ExportedServices ||
+		!metaTimeEqual(existing.LastHeartbeat, updated.LastHeartbeat) ||
+		!metaTimeEqual(existing.LastReceive, updated.LastReceive) ||
+		!metaTimeEqual(existing.LastSend, updated.LastSend)
+}
+
+// peeringSyncedCondition returns the Synced condition for the state of the
+// peering and whether it differs from the existing one. The condition is False
+// while the peering is failing or terminated and True again once it recovers.
+// Conditions set for other reasons, such as reconcile errors, are kept.
+func peeringSyncedCondition(conditions consulv1alpha1.Conditions, state api.PeeringState) (corev1.ConditionStatus, string, string, bool) {
+	var existing *consulv1alpha1.Condition
+	for i := range conditions {
+		if conditions[i].Type == consulv1alpha1.ConditionSynced {
+			existing = &conditions[i]
+		}
+	}
+	switch state {
+	case api.PeeringStateFailing, api.PeeringStateTerminated:
+		message := fmt.Sprintf("Peering state is %s", state)
+		changed := !existing.IsFalse() || existing.Reason != PeeringUnhealthyReason || existing.Message != message
+		return corev1.ConditionFalse, PeeringUnhealthyReason, message, changed
+	}
+	if existing != nil && existing.Reason == PeeringUnhealthyReason {
+		return corev1.ConditionTrue, "", "", true
+	}
+	return "", "", "", false
+}
+
+// recordPeeringStateChange emits an event if the state of the peering changed.
+// Events for peerings that stopped being healthy are warnings.
+func recordPeeringStateChange(recorder record.EventRecorder, obj client.Object, existing *consulv1alpha1.PeeringStatus, state string) {
+	if recorder == nil {
+		return
+	}
+	previous := ""
+	if existing != nil {
+		previous = existing.State
+	}
+	if previous == state {
+		return
+	}
+	eventType := corev1.EventTypeNormal
+	switch api.PeeringState(state) {
+	case api.PeeringStateFailing, api.PeeringStateTerminated:
+		eventType = corev1.EventTypeWarning
+	}
+	if previous == "" {
+		recorder.Eventf(obj, eventType, PeeringStateChangedReason, "Peering state is %s", state)
+		return
+	}
+	recorder.Eventf(obj, eventType, PeeringStateChangedReason, "Peering state changed from %s to %s", previous, state)
+}
+
+// redialBackoff returns how long to wait after the given number of attempts
+// to re-establish a peering before trying again. The wait doubles with each
+// attempt up to max.
+func redialBackoff(attempts int, base, max time.Duration) time.Duration {
+	if attempts <= 0 || base <= 0 {
+		return 0
+	}
+	backoff := base
+	for i := 1; i < attempts && (max <= 0 || backoff < max); i++ {
+		backoff *= 2
+	}
+	if max > 0 && backoff > max {
+		backoff = max
+	}
+	return backoff
+}
+
+// requeueAfter returns result requeued after interval, unless result is
+// already requeued sooner. An interval of 0 leaves result unchanged.
+func requeueAfter(result ctrl.Result, interval time.Duration) ctrl.Result {
+	if interval <= 0 {
+		return result
+	}
+	if result.RequeueAfter == 0 || interval < result.RequeueAfter {
+		result.RequeueAfter = interval
+	}
+	return result
+}
+
+func metaTime(t *time.Time) *metav1.Time {
+	if t == nil || t.IsZero() {
+		return nil
+	}
+	return &metav1.Time{Time: t.Truncate(time.Second)}
+}
+
+func metaTimeEqual(a, b *metav1.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(b)
+}
+
+func redialMessage(attempt int, err error) string {
+	if err != nil {
+		return fmt.Sprintf("Failed to re-establish terminated peering (attempt %d): %s", attempt, err)
+	}
+	return fmt.Sprintf("Re-established terminated peering (attempt %d)", attempt)
+}
@@ -0,0 +1,429 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package peering
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	logrtest "github.com/go-logr/logr/testing"
+	"github.com/hashicorp/consul-k8s/control-plane/api/v1alpha1"
+	"github.com/hashicorp/consul-k8s/control-plane/consul"
+	"github.com/hashicorp/consul-k8s/control-plane/helper/test"
+	"github.com/hashicorp/consul/api"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestRedialBackoff(t *testing.T) {
+	cases := map[string]struct {
+		attempts int
+		base     time.Duration
+		max      time.Duration
+		exp      time.Duration
+	}{
+		"no attempts":      {attempts: 0, base: time.Second, max: time.Minute, exp: 0},
+		"first attempt":    {attempts: 1, base: time.Second, max: time.Minute, exp: time.Second},
+		"third attempt":    {attempts: 3, base: time.Second, max: time.Minute, exp: 4 * time.Second},
+		"capped":           {attempts: 10, base: time.Second, max: time.Minute, exp: time.Minute},
+		"many attempts":    {attempts: 1000, base: time.Second, max: time.Minute, exp: time.Minute},
+		"no max":           {attempts: 4, base: time.Second, exp: 8 * time.Second},
+		"base exceeds max": {attempts: 1, base: time.Hour, max: time.Minute, exp: time.Minute},
+		"no base":          {attempts: 3, max: time.Minute, exp: 0},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, c.exp, redialBackoff(c.attempts, c.base, c.max))
+		})
+	}
+}
+
+func TestRequeueAfter(t *testing.T) {
+	require.Equal(t, ctrl.Result{}, requeueAfter(ctrl.Result{}, 0))
+	require.Equal(t, ctrl.Result{RequeueAfter: time.Minute}, requeueAfter(ctrl.Result{}, time.Minute))
+	require.Equal(t, ctrl.Result{RequeueAfter: time.Second}, requeueAfter(ctrl.Result{RequeueAfter: time.Minute}, time.Second))
+	require.Equal(t, ctrl.Result{RequeueAfter: time.Second}, requeueAfter(ctrl.Result{RequeueAfter: time.Second}, time.Minute))
+}
+
+func TestPeeringSyncedCondition(t *testing.T) {
+	synced := v1alpha1.Conditions{{Type: v1alpha1.ConditionSynced, Status: corev1.ConditionTrue}}
+	failing := v1alpha1.Conditions{{Type: v1alpha1.ConditionSynced, Status: corev1.ConditionFalse, Reason: PeeringUnhealthyReason, Message: "Peering state is FAILING"}}
+	reconcileErr := v1alpha1.Conditions{{Type: v1alpha1.ConditionSynced, Status: corev1.ConditionFalse, Reason: "ConsulAgentError", Message: "error"}}
+	cases := map[string]struct {
+		conditions v1alpha1.Conditions
+		state      api.PeeringState
+		expStatus  corev1.ConditionStatus
+		expReason  string
+		expMessage string
+		expChanged bool
+	}{
+		"active and synced":         {conditions: synced, state: api.PeeringStateActive},
+		"active without conditions": {state: api.PeeringStateActive},
+		"starts failing": {
+			conditions: synced,
+			state:      api.PeeringStateFailing,
+			expStatus:  corev1.ConditionFalse,
+			expReason:  PeeringUnhealthyReason,
+			expMessage: "Peering state is FAILING",
+			expChanged: true,
+		},
+		"still failing": {
+			conditions: failing,
+			state:      api.PeeringStateFailing,
+			expStatus:  corev1.ConditionFalse,
+			expReason:  PeeringUnhealthyReason,
+			expMessage: "Peering state is FAILING",
+		},
+		"terminated after failing": {
+			conditions: failing,
+			state:      api.PeeringStateTerminated,
+			expStatus:  corev1.ConditionFalse,
+			expReason:  PeeringUnhealthyReason,
+			expMessage: "Peering state is TERMINATED",
+			expChanged: true,
+		},
+		"recovered": {
+			conditions: failing,
+			state:      api.PeeringStateActive,
+			expStatus:  corev1.ConditionTrue,
+			expChanged: true,
+		},
+		"reconcile error is kept": {conditions: reconcileErr, state: api.PeeringStateActive},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			status, reason, message, changed := peeringSyncedCondition(c.conditions, c.state)
+			require.Equal(t, c.expChanged, changed)
+			if c.expChanged || c.expStatus != "" {
+				require.Equal(t, c.expStatus, status)
+				require.Equal(t, c.expReason, reason)
+				require.Equal(t, c.expMessage, message)
+			}
+		})
+	}
+}
+
+func TestReconcile_PeeringAcceptorPeeringStatus(t *testing.T) {
+	heartbeat := time.Now().Add(-10 * time.Second).UTC()
+	consulServer := newFakeConsulPeering(t, &api.Peering{
+		Name:  "acceptor",
+		State: api.PeeringStateActive,
+		StreamStatus: api.PeeringStreamStatus{
+			ImportedServices: []string{"backend", "db"},
+			ExportedServices: []string{"frontend"},
+			LastHeartbeat:    &heartbeat,
+		},
+	})
+
+	secret := createSecret("acceptor-token", "default", "data", "token")
+	acceptor := &v1alpha1.PeeringAcceptor{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "acceptor",
+			Namespace:  "default",
+			Finalizers: []string{finalizerName},
+		},
+		Spec: v1alpha1.PeeringAcceptorSpec{
+			Peer: &v1alpha1.Peer{
+				Secret: &v1alpha1.Secret{Name: "acceptor-token", Key: "data", Backend: "kubernetes"},
+			},
+		},
+		Status: v1alpha1.PeeringAcceptorStatus{
+			SecretRef: &v1alpha1.SecretRefStatus{
+				Secret: v1alpha1.Secret{Name: "acceptor-token", Key: "data", Backend: "kubernetes"},
+			},
+		},
+	}
+	s := scheme.Scheme
+	s.AddKnownTypes(v1alpha1.GroupVersion, &v1alpha1.PeeringAcceptor{}, &v1alpha1.PeeringAcceptorList{})
+	fakeClient := fake.NewClientBuilder().WithScheme(s).WithRuntimeObjects(secret, acceptor).Build()
+	recorder := record.NewFakeRecorder(10)
+
+	controller := &AcceptorController{
+		Client:              fakeClient,
+		ConsulClientConfig:  consulServer.cfg,
+		ConsulServerConnMgr: consulServer.watcher,
+		Log:                 logrtest.TestLogger{T: t},
+		Scheme:              s,
+		HealthCheckInterval: 30 * time.Second,
+		EventRecorder:       recorder,
+	}
+	namespacedName := types.NamespacedName{Name: "acceptor", Namespace: "default"}
+
+	resp, err := controller.Reconcile(context.Background(), ctrl.Request{NamespacedName: namespacedName})
+	require.NoError(t, err)
+	require.Equal(t, ctrl.Result{RequeueAfter: 30 * time.Second}, resp)
+
+	var updated v1alpha1.PeeringAcceptor
+	require.NoError(t, fakeClient.Get(context.Background(), namespacedName, &updated))
+	require.NotNil(t, updated.Status.Peering)
+	require.Equal(t, "ACTIVE", updated.Status.Peering.State)
+	require.Equal(t, 2, updated.Status.Peering.ImportedServices)
+	require.Equal(t, 1, updated.Status.Peering.ExportedServices)
+	require.True(t, updated.Status.Peering.LastHeartbeat.Equal(&metav1.Time{Time: heartbeat.Truncate(time.Second)}))
+	require.Equal(t, "Normal PeeringStateChanged Peering state is ACTIVE", <-recorder.Events)
+
+	// The peering starts failing.
+	consulServer.setState(api.PeeringStateFailing)
+	_, err = controller.Reconcile(context.Background(), ctrl.Request{NamespacedName: namespacedName})
+	require.NoError(t, err)
+	require.NoError(t, fakeClient.Get(context.Background(), namespacedName, &updated))
+	require.Equal(t, "FAILING", updated.Status.Peering.State)
+	require.Equal(t, "Warning PeeringStateChanged Peering state changed from ACTIVE to FAILING", <-recorder.Events)
+	require.Len(t, updated.Status.Conditions, 1)
+	require.Equal(t, corev1.ConditionFalse, updated.Status.Conditions[0].Status)
+	require.Equal(t, PeeringUnhealthyReason, updated.Status.Conditions[0].Reason)
+	require.Equal(t, "Peering state is FAILING", updated.Status.Conditions[0].Message)
+
+	// The peering recovers.
+	consulServer.setState(api.PeeringStateActive)
+	_, err = controller.Reconcile(context.Background(), ctrl.Request{NamespacedName: namespacedName})
+	require.NoError(t, err)
+	require.NoError(t, fakeClient.Get(context.Background(), namespacedName, &updated))
+	require.Equal(t, "ACTIVE", updated.Status.Peering.State)
+	require.Equal(t, "Normal PeeringStateChanged Peering state changed from FAILING to ACTIVE", <-recorder.Events)
+	require.Len(t, updated.Status.Conditions, 1)
+	require.Equal(t, corev1.ConditionTrue, updated.Status.Conditions[0].Status)
+	require.Empty(t, updated.Status.Conditions[0].Reason)
+
+	// The acceptor never re-establishes peerings.
+	require.Equal(t, 0, consulServer.establishCalls())
+}
+
+func TestReconcile_PeeringDialerRedial(t *testing.T) {
+	cases := map[string]struct {
+		state         api.PeeringState
+		status        v1alpha1.PeeringDialerStatus
+		establishErr  bool
+		autoRedial    bool
+		expEstablish  int
+		expAttempts   int
+		expSynced     corev1.ConditionStatus
+		expEvents     []string
+		expRequeue    time.Duration
+		expMaxRequeue time.Duration
+	}{
+		"terminated peering is re-established": {
+			state:        api.PeeringStateTerminated,
+			autoRedial:   true,
+			expEstablish: 1,
+			expAttempts:  1,
+			expSynced:    corev1.ConditionTrue,
+			expEvents: []string{
+				"Warning PeeringStateChanged Peering state is TERMINATED",
+				"Normal Redial Re-established terminated peering (attempt 1)",
+			},
+			expRequeue: 10 * time.Second,
+		},
+		"terminated peering is not re-established when auto redial is disabled": {
+			state:        api.PeeringStateTerminated,
+			autoRedial:   false,
+			expEstablish: 0,
+			expEvents: []string{
+				"Warning PeeringStateChanged Peering state is TERMINATED",
+			},
+			expRequeue: 30 * time.Second,
+		},
+		"terminated peering waits for the backoff": {
+			state: api.PeeringStateTerminated,
+			status: v1alpha1.PeeringDialerStatus{
+				Peering:        &v1alpha1.PeeringStatus{State: "TERMINATED"},
+				RedialAttempts: 2,
+				LastRedialTime: &metav1.Time{Time: time.Now()},
+			},
+			autoRedial:    true,
+			expEstablish:  0,
+			expAttempts:   2,
+			expMaxRequeue: 20 * time.Second,
+		},
+		"terminated peering is re-established once the backoff has passed": {
+			state: api.PeeringStateTerminated,
+			status: v1alpha1.PeeringDialerStatus{
+				Peering:        &v1alpha1.PeeringStatus{State: "TERMINATED"},
+				RedialAttempts: 2,
+				LastRedialTime: &metav1.Time{Time: time.Now().Add(-time.Minute)},
+			},
+			autoRedial:   true,
+			expEstablish: 1,
+			expAttempts:  3,
+			expSynced:    corev1.ConditionTrue,
+			expEvents: []string{
+				"Normal Redial Re-established terminated peering (attempt 3)",
+			},
+			expRequeue: 30 * time.Second,
+		},
+		"failure to re-establish is recorded": {
+			state:        api.PeeringStateTerminated,
+			autoRedial:   true,
+			establishErr: true,
+			expEstablish: 1,
+			expAttempts:  1,
+			expSynced:    corev1.ConditionFalse,
+			expEvents: []string{
+				"Warning PeeringStateChanged Peering state is TERMINATED",
+				"Warning RedialFailed Failed to re-establish terminated peering (attempt 1): Unexpected response code: 500 (establish failed)",
+			},
+			expRequeue: 10 * time.Second,
+		},
+		"active peering resets redial attempts": {
+			state: api.PeeringStateActive,
+			status: v1alpha1.PeeringDialerStatus{
+				Peering:        &v1alpha1.PeeringStatus{State: "TERMINATED"},
+				RedialAttempts: 2,
+				LastRedialTime: &metav1.Time{Time: time.Now().Add(-time.Minute)},
+			},
+			autoRedial:   true,
+			expEstablish: 0,
+			expAttempts:  0,
+			expEvents: []string{
+				"Normal PeeringStateChanged Peering state changed from TERMINATED to ACTIVE",
+			},
+			expRequeue: 30 * time.Second,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			consulServer := newFakeConsulPeering(t, &api.Peering{Name: "dialer", State: c.state})
+			consulServer.establishErr = c.establishErr
+
+			s := scheme.Scheme
+			s.AddKnownTypes(v1alpha1.GroupVersion, &v1alpha1.PeeringDialer{}, &v1alpha1.PeeringDialerList{})
+			fakeClient := fake.NewClientBuilder().WithScheme(s).
+				WithRuntimeObjects(createSecret("dialer-token", "default", "data", "token")).Build()
+
+			// The status secret must match the spec secret, including its resource version, so that the peering
+			// isn't re-established because the token changed.
+			var secret corev1.Secret
+			require.NoError(t, fakeClient.Get(context.Background(), types.NamespacedName{Name: "dialer-token", Namespace: "default"}, &secret))
+			dialer := &v1alpha1.PeeringDialer{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:       "dialer",
+					Namespace:  "default",
+					Finalizers: []string{finalizerName},
+				},
+				Spec: v1alpha1.PeeringDialerSpec{
+					Peer: &v1alpha1.Peer{
+						Secret: &v1alpha1.Secret{Name: "dialer-token", Key: "data", Backend: "kubernetes"},
+					},
+				},
+				Status: c.status,
+			}
+			dialer.Status.SecretRef = &v1alpha1.SecretRefStatus{
+				Secret:          v1alpha1.Secret{Name: "dialer-token", Key: "data", Backend: "kubernetes"},
+				ResourceVersion: secret.ResourceVersion,
+			}
+			require.NoError(t, fakeClient.Create(context.Background(), dialer))
+			recorder := record.NewFakeRecorder(10)
+
+			controller := &PeeringDialerController{
+				Client:              fakeClient,
+				ConsulClientConfig:  consulServer.cfg,
+				ConsulServerConnMgr: consulServer.watcher,
+				Log:                 logrtest.TestLogger{T: t},
+				Scheme:              s,
+				HealthCheckInterval: 30 * time.Second,
+				AutoRedial:          c.autoRedial,
+				RedialBackoff:       10 * time.Second,
+				MaxRedialBackoff:    time.Minute,
+				EventRecorder:       recorder,
+			}
+			namespacedName := types.NamespacedName{Name: "dialer", Namespace: "default"}
+
+			resp, err := controller.Reconcile(context.Background(), ctrl.Request{NamespacedName: namespacedName})
+			require.NoError(t, err)
+			if c.expMaxRequeue != 0 {
+				require.Greater(t, resp.RequeueAfter, time.Duration(0))
+				require.LessOrEqual(t, resp.RequeueAfter, c.expMaxRequeue)
+			} else {
+				require.Equal(t, c.expRequeue, resp.RequeueAfter)
+			}
+			require.Equal(t, c.expEstablish, consulServer.establishCalls())
+
+			var updated v1alpha1.PeeringDialer
+			require.NoError(t, fakeClient.Get(context.Background(), namespacedName, &updated))
+			require.Equal(t, string(c.state), updated.Status.Peering.State)
+			require.Equal(t, c.expAttempts, updated.Status.RedialAttempts)
+			if c.expSynced != "" {
+				require.Len(t, updated.Status.Conditions, 1)
+				require.Equal(t, c.expSynced, updated.Status.Conditions[0].Status)
+			}
+
+			close(recorder.Events)
+			var events []string
+			for event := range recorder.Events {
+				events = append(events, event)
+			}
+			require.Equal(t, c.expEvents, events)
+		})
+	}
+}
+
+// fakeConsulPeering is a fake Consul HTTP API that serves a single peering.
+type fakeConsulPeering struct {
+	cfg     *consul.Config
+	watcher consul.ServerConnectionManager
+
+	mu           sync.Mutex
+	peering      *api.Peering
+	establishErr bool
+	establishes  int
+}
+
+func newFakeConsulPeering(t *testing.T, peering *api.Peering) *fakeConsulPeering {
+	f := &fakeConsulPeering{peering: peering}
+	server := httptest.NewServer(http.HandlerFunc(f.handle))
+	t.Cleanup(server.Close)
+
+	host, portStr, err := net.SplitHostPort(server.Listener.Addr().String())
+	require.NoError(t, err)
+	port, err := strconv.Atoi(portStr)
+	require.NoError(t, err)
+	f.cfg = &consul.Config{APIClientConfig: &api.Config{}, HTTPPort: port}
+	f.watcher = test.MockConnMgrForIPAndPort(host, port)
+	return f
+}
+
+func (f *fakeConsulPeering) setState(state api.PeeringState) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.peering.State = state
+}
+
+func (f *fakeConsulPeering) establishCalls() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.establishes
+}
+
+func (f *fakeConsulPeering) handle(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/v1/peering/"+f.peering.Name:
+		_ = json.NewEncoder(w).Encode(f.peering)
+	case r.Method == http.MethodPost && r.URL.Path == "/v1/peering/establish":
+		f.establishes++
+		if f.establishErr {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte("establish failed"))
+			return
+		}
+		_, _ = w.Write([]byte("{}"))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
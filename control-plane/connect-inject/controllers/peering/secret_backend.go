@@ -0,0 +1,126 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package peering
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	consulv1alpha1 "github.com/hashicorp/consul-k8s/control-plane/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// SecretBackend stores peering tokens. The backend used by a PeeringAcceptor
+// or PeeringDialer is selected by spec.peer.secret.backend.
+type SecretBackend interface {
+	// Read returns the peering token stored in secret. It returns nil if the
+	// secret doesn't exist.
+	Read(ctx context.Context, namespace string, secret consulv1alpha1.Secret) (*PeeringToken, error)
+	// Write stores token in secret, creating the secret if it doesn't exist.
+	Write(ctx context.Context, namespace string, secret consulv1alpha1.Secret, token string) error
+	// Delete deletes secret. It does not return an error if the secret
+	// doesn't exist.
+	Delete(ctx context.Context, namespace string, secret consulv1alpha1.Secret) error
+}
+
+// PeeringToken is a peering token read from a SecretBackend.
+type PeeringToken struct {
+	// Token is the peering token. It is empty if the secret exists but
+	// doesn't contain the key.
+	Token string
+	// Version identifies the revision of the secret holding the token so that
+	// changes to it can be detected.
+	Version string
+}
+
+// KubernetesSecretBackend stores peering tokens in Kubernetes secrets in the
+// namespace of the PeeringAcceptor or PeeringDialer.
+type KubernetesSecretBackend struct {
+	client.Client
+}
+
+var _ SecretBackend = (*KubernetesSecretBackend)(nil)
+
+func (b *KubernetesSecretBackend) Read(ctx context.Context, namespace string, secret consulv1alpha1.Secret) (*PeeringToken, error) {
+	existing, err := b.get(ctx, secret.Name, namespace)
+	if err != nil || existing == nil {
+		return nil, err
+	}
+	return &PeeringToken{
+		Token:   string(existing.Data[secret.Key]),
+		Version: existing.ResourceVersion,
+	}, nil
+}
+
+func (b *KubernetesSecretBackend) Write(ctx context.Context, namespace string, secret consulv1alpha1.Secret, token string) error {
+	k8sSecret := createSecret(secret.Name, namespace, secret.Key, token)
+	existing, err := b.get(ctx, secret.Name, namespace)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return b.Client.Update(ctx, k8sSecret)
+	}
+	return b.Client.Create(ctx, k8sSecret)
+}
+
+func (b *KubernetesSecretBackend) Delete(ctx context.Context, namespace string, secret consulv1alpha1.Secret) error {
+	existing, err := b.get(ctx, secret.Name, namespace)
+	if err != nil || existing == nil {
+		return err
+	}
+	return b.Client.Delete(ctx, existing)
+}
+
+// get returns the Kubernetes secret or nil if it doesn't exist.
+func (b *KubernetesSecretBackend) get(ctx context.Context, name, namespace string) (*corev1.Secret, error) {
+	existing := &corev1.Secret{}
+	err := b.Client.Get(ctx, types.NamespacedName{Name: name, Namespace: namespace}, existing)
+	if k8serrors.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("couldn't get secret %s/%s: %w", namespace, name, err)
+	}
+	return existing, nil
+}
+
+// secretBackendFor returns the backend for the given backend type. vault may
+// be nil if the Vault backend isn't configured.
+func secretBackendFor(backendType string, k8sClient client.Client, vault SecretBackend) (SecretBackend, error) {
+	switch backendType {
+	case consulv1alpha1.SecretBackendTypeKubernetes:
+		return &KubernetesSecretBackend{Client: k8sClient}, nil
+	case consulv1alpha1.SecretBackendTypeVault:
+		if vault == nil {
+			return nil, fmt.Errorf("the %q secret backend is not configured", backendType)
+		}
+		return vault, nil
+	default:
+		return nil, fmt.Errorf("unsupported secret backend %q", backendType)
+	}
+}
+
+// secretErrorReason returns the status condition reason for an error from the
+// given secret backend.
+func secretErrorReason(backendType string) string {
+	if backendType == consulv1alpha1.SecretBackendTypeKubernetes {
+		return kubernetesError
+	}
+	return secretBackendError
+}
+
+// pollResult returns the result of a successful reconcile for a resource that
+// uses the given secret backend. Kubernetes secrets are watched, but changes
+// to secrets in other backends can only be detected by polling.
+func pollResult(backendType string, interval time.Duration) ctrl.Result {
+	if backendType == consulv1alpha1.SecretBackendTypeKubernetes || interval <= 0 {
+		return ctrl.Result{}
+	}
+	return ctrl.Result{RequeueAfter: interval}
+}
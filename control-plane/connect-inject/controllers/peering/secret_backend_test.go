@@ -0,0 +1,291 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package peering
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	consulv1alpha1 "github.com/hashicorp/consul-k8s/control-plane/api/v1alpha1"
+	"github.com/hashicorp/consul-k8s/control-plane/connect-inject/constants"
+	vaultapi "github.com/hashicorp/vault/api"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestKubernetesSecretBackend(t *testing.T) {
+	ctx := context.Background()
+	k8sClient := fake.NewClientBuilder().Build()
+	backend := &KubernetesSecretBackend{Client: k8sClient}
+	secret := consulv1alpha1.Secret{
+		Name:    "peering-token",
+		Key:     "data",
+		Backend: consulv1alpha1.SecretBackendTypeKubernetes,
+	}
+
+	// Reading a secret that doesn't exist returns nil.
+	token, err := backend.Read(ctx, "default", secret)
+	require.NoError(t, err)
+	require.Nil(t, token)
+
+	// Writing creates the secret with the peering token label.
+	require.NoError(t, backend.Write(ctx, "default", secret, "token1"))
+	var created corev1.Secret
+	require.NoError(t, k8sClient.Get(ctx, types.NamespacedName{Name: "peering-token", Namespace: "default"}, &created))
+	require.Equal(t, "token1", string(created.Data["data"]))
+	require.Equal(t, "true", created.Labels[constants.LabelPeeringToken])
+
+	token, err = backend.Read(ctx, "default", secret)
+	require.NoError(t, err)
+	require.Equal(t, "token1", token.Token)
+	require.Equal(t, created.ResourceVersion, token.Version)
+
+	// Writing again updates the secret.
+	require.NoError(t, backend.Write(ctx, "default", secret, "token2"))
+	updated, err := backend.Read(ctx, "default", secret)
+	require.NoError(t, err)
+	require.Equal(t, "token2", updated.Token)
+	require.NotEqual(t, token.Version, updated.Version)
+
+	// Deleting twice is not an error.
+	require.NoError(t, backend.Delete(ctx, "default", secret))
+	require.NoError(t, backend.Delete(ctx, "default", secret))
+	token, err = backend.Read(ctx, "default", secret)
+	require.NoError(t, err)
+	require.Nil(t, token)
+}
+
+func TestVaultSecretBackend(t *testing.T) {
+	ctx := context.Background()
+	vault := newFakeVaultKV(t)
+	backend := &VaultSecretBackend{
+		Client:         vault.client,
+		Mount:          "secret",
+		AuthMethodPath: "kubernetes",
+		Role:           "connect-inject",
+		TokenFile:      vault.tokenFile,
+	}
+	secret := consulv1alpha1.Secret{
+		Name:    "consul/peering-token",
+		Key:     "data",
+		Backend: consulv1alpha1.SecretBackendTypeVault,
+	}
+
+	// Reading a secret that doesn't exist returns nil.
+	token, err := backend.Read(ctx, "default", secret)
+	require.NoError(t, err)
+	require.Nil(t, token)
+	require.Equal(t, 1, vault.logins)
+
+	// Writing creates the secret.
+	require.NoError(t, backend.Write(ctx, "default", secret, "token1"))
+	token, err = backend.Read(ctx, "default", secret)
+	require.NoError(t, err)
+	require.Equal(t, &PeeringToken{Token: "token1", Version: "1"}, token)
+
+	// Writing again keeps other keys in the secret and bumps the version.
+	vault.put("default/consul/peering-token", map[string]interface{}{"data": "token1", "other": "value"})
+	require.NoError(t, backend.Write(ctx, "default", secret, "token2"))
+	token, err = backend.Read(ctx, "default", secret)
+	require.NoError(t, err)
+	require.Equal(t, &PeeringToken{Token: "token2", Version: "3"}, token)
+	require.Equal(t, "value", vault.data["default/consul/peering-token"]["other"])
+
+	// Secrets with the same name in other namespaces are separate.
+	token, err = backend.Read(ctx, "other", secret)
+	require.NoError(t, err)
+	require.Nil(t, token)
+	require.NoError(t, backend.Write(ctx, "other", secret, "other-token"))
+	token, err = backend.Read(ctx, "default", secret)
+	require.NoError(t, err)
+	require.Equal(t, "token2", token.Token)
+
+	// The token is reused until it expires.
+	require.Equal(t, 1, vault.logins)
+
+	// Deleting only removes the token if there are other keys.
+	require.NoError(t, backend.Delete(ctx, "default", secret))
+	token, err = backend.Read(ctx, "default", secret)
+	require.NoError(t, err)
+	require.Equal(t, &PeeringToken{Token: "", Version: "4"}, token)
+	require.Equal(t, map[string]interface{}{"other": "value"}, vault.data["default/consul/peering-token"])
+
+	// Deleting the last key removes every version of the secret.
+	require.NoError(t, backend.Delete(ctx, "other", secret))
+	_, ok := vault.data["other/consul/peering-token"]
+	require.False(t, ok)
+
+	// Deleting a secret that doesn't exist is not an error.
+	require.NoError(t, backend.Delete(ctx, "other", secret))
+}
+
+func TestVaultSecretBackend_Partition(t *testing.T) {
+	ctx := context.Background()
+	vault := newFakeVaultKV(t)
+	backend := &VaultSecretBackend{
+		Client:         vault.client,
+		Mount:          "secret",
+		Partition:      "ap1",
+		AuthMethodPath: "kubernetes",
+		Role:           "connect-inject",
+		TokenFile:      vault.tokenFile,
+	}
+	secret := consulv1alpha1.Secret{Name: "peering-token", Key: "data", Backend: consulv1alpha1.SecretBackendTypeVault}
+
+	require.NoError(t, backend.Write(ctx, "default", secret, "token1"))
+	require.Equal(t, map[string]interface{}{"data": "token1"}, vault.data["ap1/default/peering-token"])
+}
+
+func TestVaultSecretBackend_LoginError(t *testing.T) {
+	vault := newFakeVaultKV(t)
+	backend := &VaultSecretBackend{
+		Client:         vault.client,
+		Mount:          "secret",
+		AuthMethodPath: "kubernetes",
+		Role:           "unknown",
+		TokenFile:      vault.tokenFile,
+	}
+	_, err := backend.Read(context.Background(), "default", consulv1alpha1.Secret{Name: "foo", Key: "data"})
+	require.ErrorContains(t, err, `logging in to Vault with role "unknown"`)
+}
+
+func TestSecretBackendFor(t *testing.T) {
+	vault := &VaultSecretBackend{}
+
+	backend, err := secretBackendFor(consulv1alpha1.SecretBackendTypeKubernetes, fake.NewClientBuilder().Build(), nil)
+	require.NoError(t, err)
+	require.IsType(t, &KubernetesSecretBackend{}, backend)
+
+	backend, err = secretBackendFor(consulv1alpha1.SecretBackendTypeVault, nil, vault)
+	require.NoError(t, err)
+	require.Equal(t, vault, backend)
+
+	_, err = secretBackendFor(consulv1alpha1.SecretBackendTypeVault, nil, nil)
+	require.EqualError(t, err, `the "vault" secret backend is not configured`)
+
+	_, err = secretBackendFor("foo", nil, vault)
+	require.EqualError(t, err, `unsupported secret backend "foo"`)
+}
+
+func TestPollResult(t *testing.T) {
+	require.Equal(t, ctrl.Result{}, pollResult(consulv1alpha1.SecretBackendTypeKubernetes, time.Minute))
+	require.Equal(t, ctrl.Result{}, pollResult(consulv1alpha1.SecretBackendTypeVault, 0))
+	require.Equal(t, ctrl.Result{RequeueAfter: time.Minute}, pollResult(consulv1alpha1.SecretBackendTypeVault, time.Minute))
+}
+
+// fakeVaultKV is a fake Vault server with a KV v2 secrets engine mounted at
+// secret/ and a Kubernetes auth method mounted at auth/kubernetes/ that
+// accepts the role "connect-inject".
+type fakeVaultKV struct {
+	client    *vaultapi.Client
+	tokenFile string
+
+	mu       sync.Mutex
+	data     map[string]map[string]interface{}
+	versions map[string]int
+	logins   int
+}
+
+func newFakeVaultKV(t *testing.T) *fakeVaultKV {
+	f := &fakeVaultKV{
+		data:     make(map[string]map[string]interface{}),
+		versions: make(map[string]int),
+	}
+	f.tokenFile = filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(f.tokenFile, []byte("service-account-jwt\n"), 0600))
+
+	server := httptest.NewServer(http.HandlerFunc(f.handle))
+	t.Cleanup(server.Close)
+
+	cfg := vaultapi.DefaultConfig()
+	cfg.Address = server.URL
+	client, err := vaultapi.NewClient(cfg)
+	require.NoError(t, err)
+	client.ClearToken()
+	f.client = client
+	return f
+}
+
+func (f *fakeVaultKV) put(name string, data map[string]interface{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.data[name] = data
+	f.versions[name]++
+}
+
+func (f *fakeVaultKV) handle(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var body map[string]interface{}
+	if r.Body != nil {
+		_ = json.NewDecoder(r.Body).Decode(&body)
+	}
+
+	if r.URL.Path == "/v1/auth/kubernetes/login" {
+		if body["role"] != "connect-inject" || body["jwt"] != "service-account-jwt" {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+		f.logins++
+		_, _ = w.Write([]byte(`{"auth":{"client_token":"vault-token","lease_duration":3600}}`))
+		return
+	}
+	if r.Header.Get("X-Vault-Token") != "vault-token" {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`{"errors":["permission denied"]}`))
+		return
+	}
+
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/v1/secret/data/"):
+		name := strings.TrimPrefix(r.URL.Path, "/v1/secret/data/")
+		switch r.Method {
+		case http.MethodGet:
+			data, ok := f.data[name]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				_, _ = w.Write([]byte(`{"errors":[]}`))
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"data": map[string]interface{}{
+					"data":     data,
+					"metadata": map[string]interface{}{"version": f.versions[name]},
+				},
+			})
+		case http.MethodPut, http.MethodPost:
+			options, _ := body["options"].(map[string]interface{})
+			if cas, ok := options["cas"]; ok && fmt.Sprint(cas) != fmt.Sprint(f.versions[name]) {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`{"errors":["check-and-set parameter did not match the current version"]}`))
+				return
+			}
+			data, _ := body["data"].(map[string]interface{})
+			f.data[name] = data
+			f.versions[name]++
+			_, _ = w.Write([]byte(`{}`))
+		}
+	case strings.HasPrefix(r.URL.Path, "/v1/secret/metadata/") && r.Method == http.MethodDelete:
+		name := strings.TrimPrefix(r.URL.Path, "/v1/secret/metadata/")
+		delete(f.data, name)
+		delete(f.versions, name)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
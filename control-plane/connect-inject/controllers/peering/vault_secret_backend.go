@@ -0,0 +1,202 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package peering
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	consulv1alpha1 "github.com/hashicorp/consul-k8s/control-plane/api/v1alpha1"
+	vaultapi "github.com/hashicorp/vault/api"
+)
+
+// defaultServiceAccountTokenFile is where Kubernetes mounts the service
+// account token that is used to log in with the Vault Kubernetes auth method.
+const defaultServiceAccountTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+// VaultSecretBackend stores peering tokens in a Vault KV version 2 secrets
+// engine. Secrets are stored at <namespace>/<name> within the secrets engine,
+// or <partition>/<namespace>/<name> if Partition is set, where namespace is
+// the Kubernetes namespace of the peering resource and name is the name of the
+// peering secret. The key is the key within the secret's data.
+type VaultSecretBackend struct {
+	// Client is the Vault API client.
+	Client *vaultapi.Client
+	// Mount is the path the KV v2 secrets engine is mounted at, e.g. "secret".
+	Mount string
+	// Partition is the Consul admin partition of the cluster. It is empty if
+	// admin partitions are disabled.
+	Partition string
+	// AuthMethodPath is the path the Kubernetes auth method is mounted at,
+	// e.g. "kubernetes".
+	AuthMethodPath string
+	// Role is the Vault role to log in with. If empty, the token already set
+	// on Client is used instead of logging in.
+	Role string
+	// TokenFile is the service account token file used to log in. Defaults to
+	// the token mounted into the pod.
+	TokenFile string
+
+	// mu guards tokenExpiry.
+	mu sync.Mutex
+	// tokenExpiry is when the Vault token from the last login expires.
+	tokenExpiry time.Time
+}
+
+var _ SecretBackend = (*VaultSecretBackend)(nil)
+
+func (b *VaultSecretBackend) Read(ctx context.Context, namespace string, secret consulv1alpha1.Secret) (*PeeringToken, error) {
+	data, version, err := b.read(ctx, b.secretPath(namespace, secret.Name))
+	if err != nil || data == nil {
+		return nil, err
+	}
+	token, _ := data[secret.Key].(string)
+	return &PeeringToken{
+		Token:   token,
+		Version: version,
+	}, nil
+}
+
+func (b *VaultSecretBackend) Write(ctx context.Context, namespace string, secret consulv1alpha1.Secret, token string) error {
+	// Keep any other keys stored alongside the token and use check-and-set so
+	// that we don't overwrite concurrent changes to them.
+	name := b.secretPath(namespace, secret.Name)
+	data, version, err := b.read(ctx, name)
+	if err != nil {
+		return err
+	}
+	if data == nil {
+		data = make(map[string]interface{})
+	}
+	data[secret.Key] = token
+	return b.write(ctx, name, data, version)
+}
+
+func (b *VaultSecretBackend) Delete(ctx context.Context, namespace string, secret consulv1alpha1.Secret) error {
+	name := b.secretPath(namespace, secret.Name)
+	data, version, err := b.read(ctx, name)
+	if err != nil {
+		return err
+	}
+	if _, ok := data[secret.Key]; !ok {
+		return nil
+	}
+
+	// Only remove the token so that other keys stored alongside it are kept.
+	delete(data, secret.Key)
+	if len(data) > 0 {
+		return b.write(ctx, name, data, version)
+	}
+
+	// Deleting the metadata deletes every version of the secret, which is
+	// only done once it has no keys left. Vault doesn't return an error if
+	// the secret doesn't exist.
+	if _, err := b.Client.Logical().DeleteWithContext(ctx, b.path("metadata", name)); err != nil {
+		return fmt.Errorf("deleting secret %q from Vault: %w", name, err)
+	}
+	return nil
+}
+
+// read returns the data and version of the latest version of the secret at
+// name. It returns nil data if the secret doesn't exist or its latest version
+// has been deleted, in which case the version is still returned if known.
+func (b *VaultSecretBackend) read(ctx context.Context, name string) (map[string]interface{}, string, error) {
+	if err := b.login(ctx); err != nil {
+		return nil, "", err
+	}
+	secret, err := b.Client.Logical().ReadWithContext(ctx, b.path("data", name))
+	if err != nil {
+		return nil, "", fmt.Errorf("reading secret %q from Vault: %w", name, err)
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, "", nil
+	}
+	var version string
+	if metadata, ok := secret.Data["metadata"].(map[string]interface{}); ok && metadata["version"] != nil {
+		version = fmt.Sprint(metadata["version"])
+	}
+	data, _ := secret.Data["data"].(map[string]interface{})
+	return data, version, nil
+}
+
+// write writes a new version of the secret at name with check-and-set, so it
+// fails if the secret has changed since version was read.
+func (b *VaultSecretBackend) write(ctx context.Context, name string, data map[string]interface{}, version string) error {
+	if version == "" {
+		version = "0"
+	}
+	_, err := b.Client.Logical().WriteWithContext(ctx, b.path("data", name), map[string]interface{}{
+		"data": data,
+		"options": map[string]interface{}{
+			"cas": version,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("writing secret %q to Vault: %w", name, err)
+	}
+	return nil
+}
+
+// login logs in to Vault with the Kubernetes auth method if there is no token
+// or the token is about to expire.
+func (b *VaultSecretBackend) login(ctx context.Context) error {
+	if b.Role == "" {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if time.Now().Before(b.tokenExpiry) {
+		return nil
+	}
+
+	tokenFile := b.TokenFile
+	if tokenFile == "" {
+		tokenFile = defaultServiceAccountTokenFile
+	}
+	jwt, err := os.ReadFile(tokenFile)
+	if err != nil {
+		return fmt.Errorf("reading service account token: %w", err)
+	}
+	authPath := strings.Trim(b.AuthMethodPath, "/")
+	resp, err := b.Client.Logical().WriteWithContext(ctx, fmt.Sprintf("auth/%s/login", authPath), map[string]interface{}{
+		"role": b.Role,
+		"jwt":  strings.TrimSpace(string(jwt)),
+	})
+	if err != nil {
+		return fmt.Errorf("logging in to Vault with role %q: %w", b.Role, err)
+	}
+	if resp == nil || resp.Auth == nil || resp.Auth.ClientToken == "" {
+		return fmt.Errorf("logging in to Vault with role %q: no token returned", b.Role)
+	}
+	b.Client.SetToken(resp.Auth.ClientToken)
+
+	// Log in again once most of the token's TTL has passed rather than
+	// renewing it, since the token may have a max TTL.
+	ttl := time.Duration(resp.Auth.LeaseDuration) * time.Second
+	b.tokenExpiry = time.Now().Add(ttl * 4 / 5)
+	return nil
+}
+
+// secretPath returns the path within the KV v2 secrets engine of the peering
+// secret with the given name in a Kubernetes namespace. The namespace, and the
+// partition if set, are part of the path so that peering resources with the
+// same secret name in different namespaces or clusters don't share a secret.
+func (b *VaultSecretBackend) secretPath(namespace, name string) string {
+	name = fmt.Sprintf("%s/%s", namespace, strings.TrimPrefix(name, "/"))
+	if b.Partition != "" {
+		name = fmt.Sprintf("%s/%s", b.Partition, name)
+	}
+	return name
+}
+
+// path returns the API path of the secret at name in the KV v2 secrets
+// engine, e.g. secret/data/<name>.
+func (b *VaultSecretBackend) path(kind, name string) string {
+	return fmt.Sprintf("%s/%s/%s", strings.Trim(b.Mount, "/"), kind, name)
+}
@@ -26,8 +26,8 @@ const (
 func (w *MeshWebhook) configureDNS(pod *corev1.Pod, k8sNS string) error {
 	// First, we need to determine the nameservers configured in this cluster from /etc/resolv.conf.
 	etcResolvConf := defaultEtcResolvConfFile
-	if w.etcResolvFile != "" {
-		etcResolvConf = w.etcResolvFile
+	if w.EtcResolvFile != "" {
+		etcResolvConf = w.EtcResolvFile
 	}
 	cfg, err := dns.ClientConfigFromFile(etcResolvConf)
 	if err != nil {
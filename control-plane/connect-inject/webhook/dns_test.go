@@ -82,7 +82,7 @@ options ndots:5`,
 			_, err = etcResolvFile.WriteString(c.etcResolv)
 			require.NoError(t, err)
 			w := MeshWebhook{
-				etcResolvFile:    etcResolvFile.Name(),
+				EtcResolvFile:    etcResolvFile.Name(),
 				ReleaseNamespace: "consul",
 			}
 
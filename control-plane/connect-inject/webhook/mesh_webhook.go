@@ -177,6 +177,10 @@ type MeshWebhook struct {
 	// redirection
 	EnableCNI bool
 
+	// EnableCNINodeAffinity requires pods with transparent proxy enabled to be scheduled on nodes that the CNI
+	// installer has labeled as having the consul-cni plugin installed. It only applies if EnableCNI is set.
+	EnableCNINodeAffinity bool
+
 	// TProxyOverwriteProbes controls whether the webhook should mutate pod's HTTP probes
 	// to point them to the Envoy proxy.
 	TProxyOverwriteProbes bool
@@ -203,9 +207,11 @@ type MeshWebhook struct {
 	LogLevel string
 	LogJSON  bool
 
+	// EtcResolvFile is the path of the resolv.conf file that the nameservers of the cluster are read from when
+	// configuring Consul DNS. It defaults to /etc/resolv.conf, which is the webhook container's own file.
+	EtcResolvFile string
+
 	decoder *admission.Decoder
-	// etcResolvFile is only used in tests to stub out /etc/resolv.conf file.
-	etcResolvFile string
 }
 type multiPortInfo struct {
 	serviceIndex int
@@ -231,45 +237,132 @@ func (w *MeshWebhook) Handle(ctx context.Context, req admission.Request) admissi
 		return admission.Errored(http.StatusBadRequest, err)
 	}
 
+	if shouldInject, err := w.ShouldInject(&pod, req.Namespace); err != nil {
+		w.Log.Error(err, "error checking if should inject", "request name", req.Name)
+		return admission.Errored(http.StatusInternalServerError, err)
+	} else if !shouldInject {
+		return admission.Allowed(fmt.Sprintf("%s %s does not require injection", pod.Kind, pod.Name))
+	}
+
+	w.Log.Info("received pod", "name", req.Name, "ns", req.Namespace)
+
+	// A user can enable/disable tproxy for an entire namespace via a label.
+	ns, err := w.Clientset.CoreV1().Namespaces().Get(ctx, req.Namespace, metav1.GetOptions{})
+	if err != nil {
+		w.Log.Error(err, "error fetching namespace metadata for container", "request name", req.Name)
+		return admission.Errored(http.StatusInternalServerError, fmt.Errorf("error getting namespace metadata for container: %s", err))
+	}
+
+	if err := w.Mutate(ctx, &pod, *ns); err != nil {
+		w.Log.Error(err, "error injecting pod", "request name", req.Name)
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+
+	// When CNI and tproxy are enabled, the CNI plugin applies the redirect traffic rules so it must be installed
+	// on the pod's node.
+	if w.EnableCNI && pod.Annotations[constants.KeyTransparentProxyStatus] == constants.Enabled {
+		if w.EnableCNINodeAffinity {
+			addCNINodeAffinity(&pod)
+		}
+		if err = w.checkCNIInstalled(ctx, pod); err != nil {
+			w.Log.Error(err, "error checking CNI plugin on node", "request name", req.Name)
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+	}
+
+	// Marshall the pod into JSON after it has the desired envs, annotations, labels,
+	// sidecars and initContainers appended to it.
+	updatedPodJson, err := json.Marshal(pod)
+	if err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	// Create a patches based on the Pod that was received by the meshWebhook
+	// and the desired Pod spec.
+	patches, err := jsonpatch.CreatePatch(origPodJson, updatedPodJson)
+	if err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	// Check and potentially create Consul resources. This is done after
+	// all patches are created to guarantee no errors were encountered in
+	// that process before modifying the Consul cluster.
+	if w.EnableNamespaces {
+		serverState, err := w.ConsulServerConnMgr.State()
+		if err != nil {
+			w.Log.Error(err, "error checking or creating namespace",
+				"ns", w.consulNamespace(req.Namespace), "request name", req.Name)
+			return admission.Errored(http.StatusInternalServerError, fmt.Errorf("error checking or creating namespace: %s", err))
+		}
+		apiClient, err := consul.NewClientFromConnMgrState(w.ConsulConfig, serverState)
+		if err != nil {
+			w.Log.Error(err, "error checking or creating namespace",
+				"ns", w.consulNamespace(req.Namespace), "request name", req.Name)
+			return admission.Errored(http.StatusInternalServerError, fmt.Errorf("error checking or creating namespace: %s", err))
+		}
+		if _, err := namespaces.EnsureExists(apiClient, w.consulNamespace(req.Namespace), w.CrossNamespaceACLPolicy); err != nil {
+			w.Log.Error(err, "error checking or creating namespace",
+				"ns", w.consulNamespace(req.Namespace), "request name", req.Name)
+			return admission.Errored(http.StatusInternalServerError, fmt.Errorf("error checking or creating namespace: %s", err))
+		}
+	}
+
+	// Return a Patched response along with the patches we intend on applying to the
+	// Pod received by the meshWebhook.
+	return admission.Patched(fmt.Sprintf("valid %s request", pod.Kind), patches...)
+}
+
+// ShouldInject sets the default annotations on the pod and returns whether it should be injected. namespace is the
+// Kubernetes namespace of the pod.
+func (w *MeshWebhook) ShouldInject(pod *corev1.Pod, namespace string) (bool, error) {
+	podJson, err := json.Marshal(pod)
+	if err != nil {
+		return false, err
+	}
+
 	// Setup the default annotation values that are used for the container.
 	// This MUST be done before shouldInject is called since that function
 	// uses these annotations.
-	if err := w.defaultAnnotations(&pod, string(origPodJson)); err != nil {
-		w.Log.Error(err, "error creating default annotations", "request name", req.Name)
-		return admission.Errored(http.StatusInternalServerError, fmt.Errorf("error creating default annotations: %s", err))
+	if err := w.defaultAnnotations(pod, string(podJson)); err != nil {
+		return false, fmt.Errorf("error creating default annotations: %s", err)
 	}
 
 	// Check if we should inject, for example we don't inject in the
 	// system namespaces.
-	if shouldInject, err := w.shouldInject(pod, req.Namespace); err != nil {
-		w.Log.Error(err, "error checking if should inject", "request name", req.Name)
-		return admission.Errored(http.StatusInternalServerError, fmt.Errorf("error checking if should inject: %s", err))
-	} else if !shouldInject {
-		return admission.Allowed(fmt.Sprintf("%s %s does not require injection", pod.Kind, pod.Name))
+	shouldInject, err := w.shouldInject(*pod, namespace)
+	if err != nil {
+		return false, fmt.Errorf("error checking if should inject: %s", err)
 	}
+	return shouldInject, nil
+}
 
-	w.Log.Info("received pod", "name", req.Name, "ns", req.Namespace)
-
+// Mutate injects the init containers and sidecars into the pod in place. ns is the namespace of the pod. It must only
+// be called once ShouldInject has returned true for the pod.
+//
+// Mutate doesn't call the Consul API. The Kubernetes API is only called to find the service account secrets of multi
+// port pods when ACLs are enabled. If Clientset is nil, the secret with the same name as the service account is
+// mounted instead, which allows injection to be rendered offline.
+func (w *MeshWebhook) Mutate(ctx context.Context, pod *corev1.Pod, ns corev1.Namespace) error {
 	// Add our volume that will be shared by the init container and
 	// the sidecar for passing data in the pod.
 	pod.Spec.Volumes = append(pod.Spec.Volumes, w.containerVolume())
 
 	// Optionally mount data volume to other containers
-	w.injectVolumeMount(pod)
+	w.injectVolumeMount(*pod)
 
 	// Optionally add any volumes that are to be used by the envoy sidecar.
 	if _, ok := pod.Annotations[constants.AnnotationConsulSidecarUserVolume]; ok {
 		var userVolumes []corev1.Volume
 		err := json.Unmarshal([]byte(pod.Annotations[constants.AnnotationConsulSidecarUserVolume]), &userVolumes)
 		if err != nil {
-			return admission.Errored(http.StatusInternalServerError, fmt.Errorf("error unmarshalling sidecar user volumes: %s", err))
+			return fmt.Errorf("error unmarshalling sidecar user volumes: %s", err)
 		}
 		pod.Spec.Volumes = append(pod.Spec.Volumes, userVolumes...)
 	}
 
 	// Add the upstream services as environment variables for easy
 	// service discovery.
-	containerEnvVars := w.containerEnvVars(pod)
+	containerEnvVars := w.containerEnvVars(*pod)
 	for i := range pod.Spec.InitContainers {
 		pod.Spec.InitContainers[i].Env = append(pod.Spec.InitContainers[i].Env, containerEnvVars...)
 	}
@@ -278,33 +371,24 @@ func (w *MeshWebhook) Handle(ctx context.Context, req admission.Request) admissi
 		pod.Spec.Containers[i].Env = append(pod.Spec.Containers[i].Env, containerEnvVars...)
 	}
 
-	// A user can enable/disable tproxy for an entire namespace via a label.
-	ns, err := w.Clientset.CoreV1().Namespaces().Get(ctx, req.Namespace, metav1.GetOptions{})
-	if err != nil {
-		w.Log.Error(err, "error fetching namespace metadata for container", "request name", req.Name)
-		return admission.Errored(http.StatusInternalServerError, fmt.Errorf("error getting namespace metadata for container: %s", err))
-	}
-
 	// Get service names from the annotation. If theres 0-1 service names, it's a single port pod, otherwise it's multi
 	// port.
-	annotatedSvcNames := w.annotatedServiceNames(pod)
+	annotatedSvcNames := w.annotatedServiceNames(*pod)
 	multiPort := len(annotatedSvcNames) > 1
 
 	// For single port pods, add the single init container and envoy sidecar.
 	if !multiPort {
 		// Add the init container that registers the service and sets up the Envoy configuration.
-		initContainer, err := w.containerInit(*ns, pod, multiPortInfo{})
+		initContainer, err := w.containerInit(ns, *pod, multiPortInfo{})
 		if err != nil {
-			w.Log.Error(err, "error configuring injection init container", "request name", req.Name)
-			return admission.Errored(http.StatusInternalServerError, fmt.Errorf("error configuring injection init container: %s", err))
+			return fmt.Errorf("error configuring injection init container: %s", err)
 		}
 		pod.Spec.InitContainers = append(pod.Spec.InitContainers, initContainer)
 
 		// Add the Envoy sidecar.
-		envoySidecar, err := w.consulDataplaneSidecar(*ns, pod, multiPortInfo{})
+		envoySidecar, err := w.consulDataplaneSidecar(ns, *pod, multiPortInfo{})
 		if err != nil {
-			w.Log.Error(err, "error configuring injection sidecar container", "request name", req.Name)
-			return admission.Errored(http.StatusInternalServerError, fmt.Errorf("error configuring injection sidecar container: %s", err))
+			return fmt.Errorf("error configuring injection sidecar container: %s", err)
 		}
 		pod.Spec.Containers = append(pod.Spec.Containers, envoySidecar)
 	} else {
@@ -316,33 +400,17 @@ func (w *MeshWebhook) Handle(ctx context.Context, req admission.Request) admissi
 		// those tokens if not already specified via the pod's serviceAccountName.
 
 		w.Log.Info("processing multiport pod")
-		err := w.checkUnsupportedMultiPortCases(*ns, pod)
+		err := w.checkUnsupportedMultiPortCases(ns, *pod)
 		if err != nil {
-			w.Log.Error(err, "checking unsupported cases for multi port pods")
-			return admission.Errored(http.StatusInternalServerError, err)
+			return err
 		}
 		for i, svc := range annotatedSvcNames {
 			w.Log.Info(fmt.Sprintf("service: %s", svc))
 			if w.AuthMethod != "" {
 				if svc != "" && pod.Spec.ServiceAccountName != svc {
-					secretName := ""
-					sa, err := w.Clientset.CoreV1().ServiceAccounts(req.Namespace).Get(ctx, svc, metav1.GetOptions{})
+					secretName, err := w.serviceAccountSecretName(ctx, ns.Name, svc)
 					if err != nil {
-						w.Log.Error(err, "couldn't get service accounts")
-						return admission.Errored(http.StatusInternalServerError, err)
-					}
-					if len(sa.Secrets) == 0 {
-						// Check to see if there is a secret with the same name as the ServiceAccount for Kube-1.24+.
-						w.Log.Info(fmt.Sprintf("service account %s has zero secrets exp at least 1", svc))
-						sec, err := w.Clientset.CoreV1().Secrets(req.Namespace).Get(ctx, svc, metav1.GetOptions{})
-						if err != nil {
-							w.Log.Error(err, "couldn't get Secret associated with Service Account")
-							return admission.Errored(http.StatusInternalServerError, err)
-						}
-						secretName = sec.Name
-						w.Log.Info(fmt.Sprintf("fetched secret: %s", secretName))
-					} else {
-						secretName = sa.Secrets[0].Name
+						return err
 					}
 					w.Log.Info("found service account, mounting service account secret to Pod", "serviceAccountName", secretName)
 					pod.Spec.Volumes = append(pod.Spec.Volumes, corev1.Volume{
@@ -363,18 +431,16 @@ func (w *MeshWebhook) Handle(ctx context.Context, req admission.Request) admissi
 			}
 
 			// Add the init container that registers the service and sets up the Envoy configuration.
-			initContainer, err := w.containerInit(*ns, pod, mpi)
+			initContainer, err := w.containerInit(ns, *pod, mpi)
 			if err != nil {
-				w.Log.Error(err, "error configuring injection init container", "request name", req.Name)
-				return admission.Errored(http.StatusInternalServerError, fmt.Errorf("error configuring injection init container: %s", err))
+				return fmt.Errorf("error configuring injection init container: %s", err)
 			}
 			pod.Spec.InitContainers = append(pod.Spec.InitContainers, initContainer)
 
 			// Add the Envoy sidecar.
-			envoySidecar, err := w.consulDataplaneSidecar(*ns, pod, mpi)
+			envoySidecar, err := w.consulDataplaneSidecar(ns, *pod, mpi)
 			if err != nil {
-				w.Log.Error(err, "error configuring injection sidecar container", "request name", req.Name)
-				return admission.Errored(http.StatusInternalServerError, fmt.Errorf("error configuring injection sidecar container: %s", err))
+				return fmt.Errorf("error configuring injection sidecar container: %s", err)
 			}
 			pod.Spec.Containers = append(pod.Spec.Containers, envoySidecar)
 		}
@@ -384,10 +450,9 @@ func (w *MeshWebhook) Handle(ctx context.Context, req admission.Request) admissi
 	// and does not need to be checked for being a nil value.
 	pod.Annotations[constants.KeyInjectStatus] = constants.Injected
 
-	tproxyEnabled, err := common.TransparentProxyEnabled(*ns, pod, w.EnableTransparentProxy)
+	tproxyEnabled, err := common.TransparentProxyEnabled(ns, *pod, w.EnableTransparentProxy)
 	if err != nil {
-		w.Log.Error(err, "error determining if transparent proxy is enabled", "request name", req.Name)
-		return admission.Errored(http.StatusInternalServerError, fmt.Errorf("error determining if transparent proxy is enabled: %s", err))
+		return fmt.Errorf("error determining if transparent proxy is enabled: %s", err)
 	}
 
 	// Add an annotation to the pod sets transparent-proxy-status to enabled or disabled. Used by the CNI plugin
@@ -398,17 +463,15 @@ func (w *MeshWebhook) Handle(ctx context.Context, req admission.Request) admissi
 
 	// If tproxy with DNS redirection is enabled, we want to configure dns on the pod.
 	if tproxyEnabled && w.EnableConsulDNS {
-		if err = w.configureDNS(&pod, req.Namespace); err != nil {
-			w.Log.Error(err, "error configuring DNS on the pod", "request name", req.Name)
-			return admission.Errored(http.StatusInternalServerError, fmt.Errorf("error configuring DNS on the pod: %s", err))
+		if err = w.configureDNS(pod, ns.Name); err != nil {
+			return fmt.Errorf("error configuring DNS on the pod: %s", err)
 		}
 
 	}
 
 	// Add annotations for metrics.
-	if err = w.prometheusAnnotations(&pod); err != nil {
-		w.Log.Error(err, "error configuring prometheus annotations", "request name", req.Name)
-		return admission.Errored(http.StatusInternalServerError, fmt.Errorf("error configuring prometheus annotations: %s", err))
+	if err = w.prometheusAnnotations(pod); err != nil {
+		return fmt.Errorf("error configuring prometheus annotations: %s", err)
 	}
 
 	if pod.Labels == nil {
@@ -422,65 +485,51 @@ func (w *MeshWebhook) Handle(ctx context.Context, req admission.Request) admissi
 
 	// Consul-ENT only: Add the Consul destination namespace as an annotation to the pod.
 	if w.EnableNamespaces {
-		pod.Annotations[constants.AnnotationConsulNamespace] = w.consulNamespace(req.Namespace)
+		pod.Annotations[constants.AnnotationConsulNamespace] = w.consulNamespace(ns.Name)
 	}
 
 	// Overwrite readiness/liveness probes if needed.
-	err = w.overwriteProbes(*ns, &pod)
+	err = w.overwriteProbes(ns, pod)
 	if err != nil {
-		w.Log.Error(err, "error overwriting readiness or liveness probes", "request name", req.Name)
-		return admission.Errored(http.StatusInternalServerError, fmt.Errorf("error overwriting readiness or liveness probes: %s", err))
+		return fmt.Errorf("error overwriting readiness or liveness probes: %s", err)
 	}
 
 	// When CNI and tproxy are enabled, we add an annotation to the pod that contains the iptables config so that the CNI
 	// plugin can apply redirect traffic rules on the pod.
 	if w.EnableCNI && tproxyEnabled {
-		if err = w.addRedirectTrafficConfigAnnotation(&pod, *ns); err != nil {
-			w.Log.Error(err, "error configuring annotation for CNI traffic redirection", "request name", req.Name)
-			return admission.Errored(http.StatusInternalServerError, fmt.Errorf("error configuring annotation for CNI traffic redirection: %s", err))
+		if err = w.addRedirectTrafficConfigAnnotation(pod, ns); err != nil {
+			return fmt.Errorf("error configuring annotation for CNI traffic redirection: %s", err)
 		}
 	}
 
-	// Marshall the pod into JSON after it has the desired envs, annotations, labels,
-	// sidecars and initContainers appended to it.
-	updatedPodJson, err := json.Marshal(pod)
-	if err != nil {
-		return admission.Errored(http.StatusBadRequest, err)
-	}
+	return nil
+}
 
-	// Create a patches based on the Pod that was received by the meshWebhook
-	// and the desired Pod spec.
-	patches, err := jsonpatch.CreatePatch(origPodJson, updatedPodJson)
+// serviceAccountSecretName returns the name of the secret holding the token of the service account. If Clientset is
+// nil, it returns the name of the service account because that's the name of the secret created for it on
+// Kubernetes 1.24+.
+func (w *MeshWebhook) serviceAccountSecretName(ctx context.Context, namespace, serviceAccount string) (string, error) {
+	if w.Clientset == nil {
+		return serviceAccount, nil
+	}
+	sa, err := w.Clientset.CoreV1().ServiceAccounts(namespace).Get(ctx, serviceAccount, metav1.GetOptions{})
 	if err != nil {
-		return admission.Errored(http.StatusBadRequest, err)
+		w.Log.Error(err, "couldn't get service accounts")
+		return "", err
 	}
-
-	// Check and potentially create Consul resources. This is done after
-	// all patches are created to guarantee no errors were encountered in
-	// that process before modifying the Consul cluster.
-	if w.EnableNamespaces {
-		serverState, err := w.ConsulServerConnMgr.State()
-		if err != nil {
-			w.Log.Error(err, "error checking or creating namespace",
-				"ns", w.consulNamespace(req.Namespace), "request name", req.Name)
-			return admission.Errored(http.StatusInternalServerError, fmt.Errorf("error checking or creating namespace: %s", err))
-		}
-		apiClient, err := consul.NewClientFromConnMgrState(w.ConsulConfig, serverState)
-		if err != nil {
-			w.Log.Error(err, "error checking or creating namespace",
-				"ns", w.consulNamespace(req.Namespace), "request name", req.Name)
-			return admission.Errored(http.StatusInternalServerError, fmt.Errorf("error checking or creating namespace: %s", err))
-		}
-		if _, err := namespaces.EnsureExists(apiClient, w.consulNamespace(req.Namespace), w.CrossNamespaceACLPolicy); err != nil {
-			w.Log.Error(err, "error checking or creating namespace",
-				"ns", w.consulNamespace(req.Namespace), "request name", req.Name)
-			return admission.Errored(http.StatusInternalServerError, fmt.Errorf("error checking or creating namespace: %s", err))
-		}
+	if len(sa.Secrets) > 0 {
+		return sa.Secrets[0].Name, nil
 	}
 
-	// Return a Patched response along with the patches we intend on applying to the
-	// Pod received by the meshWebhook.
-	return admission.Patched(fmt.Sprintf("valid %s request", pod.Kind), patches...)
+	// Check to see if there is a secret with the same name as the ServiceAccount for Kube-1.24+.
+	w.Log.Info(fmt.Sprintf("service account %s has zero secrets exp at least 1", serviceAccount))
+	sec, err := w.Clientset.CoreV1().Secrets(namespace).Get(ctx, serviceAccount, metav1.GetOptions{})
+	if err != nil {
+		w.Log.Error(err, "couldn't get Secret associated with Service Account")
+		return "", err
+	}
+	w.Log.Info(fmt.Sprintf("fetched secret: %s", sec.Name))
+	return sec.Name, nil
 }
 
 // overwriteProbes overwrites readiness/liveness probes of this pod when
@@ -1781,6 +1781,57 @@ func TestHandler_checkUnsupportedMultiPortCases(t *testing.T) {
 	}
 }
 
+// Test that multi port pods can be mutated without a Kubernetes client by mounting the secrets with the same name as
+// the service accounts.
+func TestMutate_MultiPortWithoutClientset(t *testing.T) {
+	w := MeshWebhook{
+		Log:                   logrtest.TestLogger{T: t},
+		AllowK8sNamespacesSet: mapset.NewSetWith("*"),
+		DenyK8sNamespacesSet:  mapset.NewSet(),
+		ConsulConfig:          &consul.Config{HTTPPort: 8500},
+		AuthMethod:            "k8s",
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{
+				constants.AnnotationService: "web,web-admin",
+			},
+		},
+		Spec: corev1.PodSpec{
+			ServiceAccountName: "web",
+			Containers: []corev1.Container{
+				{
+					Name: "web",
+					VolumeMounts: []corev1.VolumeMount{
+						{
+							Name:      "kube-api-access",
+							MountPath: "/var/run/secrets/kubernetes.io/serviceaccount",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	shouldInject, err := w.ShouldInject(pod, namespaces.DefaultNamespace)
+	require.NoError(t, err)
+	require.True(t, shouldInject)
+
+	ns := corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespaces.DefaultNamespace}}
+	require.NoError(t, w.Mutate(context.Background(), pod, ns))
+	require.Contains(t, pod.Spec.Volumes, corev1.Volume{
+		Name: "web-admin-service-account",
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName: "web-admin",
+			},
+		},
+	})
+	require.Len(t, pod.Spec.InitContainers, 2)
+	require.Len(t, pod.Spec.Containers, 3)
+	require.Equal(t, constants.Injected, pod.Annotations[constants.KeyInjectStatus])
+}
+
 // encodeRaw is a helper to encode some data into a RawExtension.
 func encodeRaw(t *testing.T, input interface{}) runtime.RawExtension {
 	data, err := json.Marshal(input)
@@ -4,14 +4,18 @@
 package webhook
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"reflect"
 	"strconv"
 
 	"github.com/hashicorp/consul-k8s/control-plane/connect-inject/common"
 	"github.com/hashicorp/consul-k8s/control-plane/connect-inject/constants"
 	"github.com/hashicorp/consul/sdk/iptables"
 	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 // addRedirectTrafficConfigAnnotation creates an iptables.Config in JSON format based on proxy configuration.
@@ -130,3 +134,64 @@ func (w *MeshWebhook) addRedirectTrafficConfigAnnotation(pod *corev1.Pod, ns cor
 
 	return nil
 }
+
+// addCNINodeAffinity requires the pod to be scheduled on a node where the CNI installer reports that the consul-cni
+// plugin is installed, since traffic redirection rules would never be applied to the pod on other nodes. The
+// requirement is added to every existing node selector term because the terms are ORed.
+func addCNINodeAffinity(pod *corev1.Pod) {
+	requirement := corev1.NodeSelectorRequirement{
+		Key:      constants.LabelCNIStatus,
+		Operator: corev1.NodeSelectorOpIn,
+		Values:   []string{constants.CNIStatusInstalled},
+	}
+	if pod.Spec.Affinity == nil {
+		pod.Spec.Affinity = &corev1.Affinity{}
+	}
+	if pod.Spec.Affinity.NodeAffinity == nil {
+		pod.Spec.Affinity.NodeAffinity = &corev1.NodeAffinity{}
+	}
+	nodeAffinity := pod.Spec.Affinity.NodeAffinity
+	if nodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		nodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution = &corev1.NodeSelector{}
+	}
+	selector := nodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution
+	if len(selector.NodeSelectorTerms) == 0 {
+		selector.NodeSelectorTerms = []corev1.NodeSelectorTerm{{}}
+	}
+	for i, term := range selector.NodeSelectorTerms {
+		if !hasNodeSelectorRequirement(term.MatchExpressions, requirement) {
+			selector.NodeSelectorTerms[i].MatchExpressions = append(term.MatchExpressions, requirement)
+		}
+	}
+}
+
+func hasNodeSelectorRequirement(requirements []corev1.NodeSelectorRequirement, requirement corev1.NodeSelectorRequirement) bool {
+	for _, r := range requirements {
+		if reflect.DeepEqual(r, requirement) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkCNIInstalled returns an error if the pod is already scheduled on a node whose CNI installer reports that the
+// consul-cni plugin isn't installed, in which case traffic redirection rules would never be applied to the pod.
+// Nodes without the label or annotation are allowed because they may run an installer that doesn't report its status,
+// and pods that aren't scheduled yet can't be checked.
+func (w *MeshWebhook) checkCNIInstalled(ctx context.Context, pod corev1.Pod) error {
+	if pod.Spec.NodeName == "" {
+		return nil
+	}
+	node, err := w.Clientset.CoreV1().Nodes().Get(ctx, pod.Spec.NodeName, metav1.GetOptions{})
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("error getting node %s: %w", pod.Spec.NodeName, err)
+	}
+	if node.Labels[constants.LabelCNIStatus] == constants.CNIStatusNotInstalled ||
+		node.Annotations[constants.AnnotationCNIStatus] == constants.CNIStatusNotInstalled {
+		return fmt.Errorf("consul-cni plugin is not installed on node %s so traffic redirection cannot be applied to the pod", pod.Spec.NodeName)
+	}
+	return nil
+}
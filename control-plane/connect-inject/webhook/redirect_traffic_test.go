@@ -4,6 +4,7 @@
 package webhook
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"strconv"
@@ -15,11 +16,14 @@ import (
 	"github.com/hashicorp/consul-k8s/control-plane/consul"
 	"github.com/hashicorp/consul/sdk/iptables"
 	"github.com/stretchr/testify/require"
+	"gomodules.xyz/jsonpatch/v2"
+	admissionv1 "k8s.io/api/admission/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes/fake"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 )
 
@@ -478,3 +482,253 @@ func TestRedirectTraffic_consulDNS(t *testing.T) {
 		})
 	}
 }
+
+func TestCheckCNIInstalled(t *testing.T) {
+	nodeWithStatus := func(name, status string) *corev1.Node {
+		node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}}
+		if status != "" {
+			node.Labels = map[string]string{constants.LabelCNIStatus: status}
+		}
+		return node
+	}
+	clientset := fake.NewSimpleClientset(
+		nodeWithStatus("installed", constants.CNIStatusInstalled),
+		nodeWithStatus("not-installed", constants.CNIStatusNotInstalled),
+		nodeWithStatus("no-label", ""),
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{
+			Name:        "annotation-only",
+			Annotations: map[string]string{constants.AnnotationCNIStatus: constants.CNIStatusNotInstalled},
+		}},
+	)
+	w := MeshWebhook{Clientset: clientset}
+
+	cases := map[string]struct {
+		nodeName string
+		expErr   string
+	}{
+		"pod not scheduled":    {nodeName: ""},
+		"plugin installed":     {nodeName: "installed"},
+		"node not found":       {nodeName: "missing"},
+		"node without label":   {nodeName: "no-label"},
+		"plugin not installed": {nodeName: "not-installed", expErr: "consul-cni plugin is not installed on node not-installed so traffic redirection cannot be applied to the pod"},
+		"annotation not installed": {
+			nodeName: "annotation-only",
+			expErr:   "consul-cni plugin is not installed on node annotation-only so traffic redirection cannot be applied to the pod",
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			pod := corev1.Pod{Spec: corev1.PodSpec{NodeName: c.nodeName}}
+			err := w.checkCNIInstalled(context.Background(), pod)
+			if c.expErr == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.EqualError(t, err, c.expErr)
+		})
+	}
+}
+
+func TestAddCNINodeAffinity(t *testing.T) {
+	cniRequirement := corev1.NodeSelectorRequirement{
+		Key:      constants.LabelCNIStatus,
+		Operator: corev1.NodeSelectorOpIn,
+		Values:   []string{constants.CNIStatusInstalled},
+	}
+	zoneRequirement := corev1.NodeSelectorRequirement{
+		Key:      "topology.kubernetes.io/zone",
+		Operator: corev1.NodeSelectorOpIn,
+		Values:   []string{"us-east-1a"},
+	}
+	preferred := []corev1.PreferredSchedulingTerm{{
+		Weight:     1,
+		Preference: corev1.NodeSelectorTerm{MatchExpressions: []corev1.NodeSelectorRequirement{zoneRequirement}},
+	}}
+
+	cases := map[string]struct {
+		affinity *corev1.Affinity
+		expected *corev1.Affinity
+	}{
+		"no affinity": {
+			affinity: nil,
+			expected: &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+					NodeSelectorTerms: []corev1.NodeSelectorTerm{
+						{MatchExpressions: []corev1.NodeSelectorRequirement{cniRequirement}},
+					},
+				},
+			}},
+		},
+		"only preferred node affinity": {
+			affinity: &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{
+				PreferredDuringSchedulingIgnoredDuringExecution: preferred,
+			}},
+			expected: &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+					NodeSelectorTerms: []corev1.NodeSelectorTerm{
+						{MatchExpressions: []corev1.NodeSelectorRequirement{cniRequirement}},
+					},
+				},
+				PreferredDuringSchedulingIgnoredDuringExecution: preferred,
+			}},
+		},
+		"requirement added to every term": {
+			affinity: &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+					NodeSelectorTerms: []corev1.NodeSelectorTerm{
+						{MatchExpressions: []corev1.NodeSelectorRequirement{zoneRequirement}},
+						{MatchFields: []corev1.NodeSelectorRequirement{{Key: "metadata.name", Operator: corev1.NodeSelectorOpIn, Values: []string{"node-1"}}}},
+					},
+				},
+			}},
+			expected: &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+					NodeSelectorTerms: []corev1.NodeSelectorTerm{
+						{MatchExpressions: []corev1.NodeSelectorRequirement{zoneRequirement, cniRequirement}},
+						{
+							MatchExpressions: []corev1.NodeSelectorRequirement{cniRequirement},
+							MatchFields:      []corev1.NodeSelectorRequirement{{Key: "metadata.name", Operator: corev1.NodeSelectorOpIn, Values: []string{"node-1"}}},
+						},
+					},
+				},
+			}},
+		},
+		"requirement already set": {
+			affinity: &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+					NodeSelectorTerms: []corev1.NodeSelectorTerm{
+						{MatchExpressions: []corev1.NodeSelectorRequirement{cniRequirement}},
+					},
+				},
+			}},
+			expected: &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+					NodeSelectorTerms: []corev1.NodeSelectorTerm{
+						{MatchExpressions: []corev1.NodeSelectorRequirement{cniRequirement}},
+					},
+				},
+			}},
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			pod := corev1.Pod{Spec: corev1.PodSpec{Affinity: c.affinity}}
+			addCNINodeAffinity(&pod)
+			require.Equal(t, c.expected, pod.Spec.Affinity)
+		})
+	}
+}
+
+// Test that pods that aren't scheduled yet, which is always the case at
+// admission for pods created by controllers, are required to be scheduled on
+// nodes where consul-cni is installed only if the node affinity is enabled, and
+// that pods on nodes that report consul-cni isn't installed are refused.
+func TestHandle_CNINodeAffinity(t *testing.T) {
+	s := runtime.NewScheme()
+	s.AddKnownTypes(schema.GroupVersion{
+		Group:   "",
+		Version: "v1",
+	}, &corev1.Pod{})
+	decoder, err := admission.NewDecoder(s)
+	require.NoError(t, err)
+
+	clientset := fake.NewSimpleClientset(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: defaultNamespace}},
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "no-label"}},
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{
+			Name:   "not-installed",
+			Labels: map[string]string{constants.LabelCNIStatus: constants.CNIStatusNotInstalled},
+		}},
+	)
+
+	cases := map[string]struct {
+		cni          bool
+		nodeAffinity bool
+		nodeName     string
+		expErr       string
+		expected     *corev1.Affinity
+	}{
+		"CNI disabled": {
+			cni:          false,
+			nodeAffinity: true,
+		},
+		"node affinity disabled": {
+			cni: true,
+		},
+		"pod without node name": {
+			cni:          true,
+			nodeAffinity: true,
+			expected: &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+					NodeSelectorTerms: []corev1.NodeSelectorTerm{{
+						MatchExpressions: []corev1.NodeSelectorRequirement{{
+							Key:      constants.LabelCNIStatus,
+							Operator: corev1.NodeSelectorOpIn,
+							Values:   []string{constants.CNIStatusInstalled},
+						}},
+					}},
+				},
+			}},
+		},
+		"pod on node without label": {
+			cni:      true,
+			nodeName: "no-label",
+		},
+		"pod on node without consul-cni": {
+			cni:      true,
+			nodeName: "not-installed",
+			expErr:   "consul-cni plugin is not installed on node not-installed",
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			w := MeshWebhook{
+				Log:                    logrtest.TestLogger{T: t},
+				AllowK8sNamespacesSet:  mapset.NewSetWith("*"),
+				DenyK8sNamespacesSet:   mapset.NewSet(),
+				EnableTransparentProxy: true,
+				EnableCNI:              c.cni,
+				EnableCNINodeAffinity:  c.nodeAffinity,
+				ConsulConfig:           &consul.Config{HTTPPort: 8500},
+				decoder:                decoder,
+				Clientset:              clientset,
+			}
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: defaultPodName, Namespace: defaultNamespace},
+				Spec: corev1.PodSpec{
+					NodeName:   c.nodeName,
+					Containers: []corev1.Container{{Name: "web"}},
+				},
+			}
+			resp := w.Handle(context.Background(), admission.Request{
+				AdmissionRequest: admissionv1.AdmissionRequest{
+					Namespace: defaultNamespace,
+					Object:    encodeRaw(t, pod),
+				},
+			})
+			if c.expErr != "" {
+				require.False(t, resp.Allowed)
+				require.Contains(t, resp.Result.Message, c.expErr)
+				return
+			}
+			require.True(t, resp.Allowed, resp.Result)
+
+			var affinityPatch *jsonpatch.Operation
+			for i, patch := range resp.Patches {
+				if patch.Path == "/spec/affinity" {
+					affinityPatch = &resp.Patches[i]
+				}
+			}
+			if c.expected == nil {
+				require.Nil(t, affinityPatch)
+				return
+			}
+			require.NotNil(t, affinityPatch)
+			value, err := json.Marshal(affinityPatch.Value)
+			require.NoError(t, err)
+			var actual corev1.Affinity
+			require.NoError(t, json.Unmarshal(value, &actual))
+			require.Equal(t, c.expected, &actual)
+		})
+	}
+}
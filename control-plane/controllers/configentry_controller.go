@@ -5,6 +5,8 @@ package controllers
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"strings"
@@ -20,6 +22,7 @@ import (
 	k8serr "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/workqueue"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -32,6 +35,10 @@ const (
 	ConsulAgentError             = "ConsulAgentError"
 	ExternallyManagedConfigError = "ExternallyManagedConfigError"
 	MigrationFailedError         = "MigrationFailedError"
+	InvalidConfigEntryError      = "InvalidConfigEntryError"
+
+	// SyncedReason is the event reason used when a resource is synced to Consul.
+	SyncedReason = "Synced"
 )
 
 // Controller is implemented by CRD-specific controllers. It is used by
@@ -87,8 +94,14 @@ type ConfigEntryController struct {
 	// any created Consul namespaces to allow cross namespace service discovery.
 	// Only necessary if ACLs are enabled.
 	CrossNSACLPolicy string
+
+	// EventRecorder is used to emit Kubernetes events when a resource's sync
+	// status changes. If nil, no events are emitted.
+	EventRecorder record.EventRecorder
 }
 
+// +kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
+
 // ReconcileEntry reconciles an update to a resource. CRD-specific controller's
 // call this function because it handles reconciliation of config entries
 // generically.
@@ -169,6 +182,13 @@ func (r *ConfigEntryController) ReconcileEntry(ctx context.Context, crdCtrl Cont
 		return ctrl.Result{}, nil
 	}
 
+	// A resource can only fail to convert if it bypassed the webhook, e.g. a
+	// ConfigEntry with a config that can't be decoded.
+	if consulEntry == nil {
+		return r.syncFailed(ctx, logger, crdCtrl, configEntry, InvalidConfigEntryError,
+			fmt.Errorf("unable to convert %s to a %s config entry", configEntry.KubeKind(), configEntry.ConsulKind()))
+	}
+
 	// Check to see if consul has config entry with the same name
 	entry, _, err := consulClient.ConfigEntries().Get(configEntry.ConsulKind(), configEntry.ConsulName(), &capi.QueryOptions{
 		Namespace: r.consulNamespace(consulEntry, configEntry.ConsulMirroringNS(), configEntry.ConsulGlobalResource()),
@@ -200,7 +220,7 @@ func (r *ConfigEntryController) ReconcileEntry(ctx context.Context, crdCtrl Cont
 				fmt.Errorf("writing config entry to consul: %w", err))
 		}
 		logger.Info("config entry created", "request-time", writeMeta.RequestTime)
-		return r.syncSuccessful(ctx, crdCtrl, configEntry)
+		return r.syncSuccessful(ctx, crdCtrl, configEntry, r.writtenConsulStatus(logger, consulClient, configEntry, consulEntry))
 	}
 
 	// If there is an error when trying to get the config entry from the api server,
@@ -248,7 +268,7 @@ func (r *ConfigEntryController) ReconcileEntry(ctx context.Context, crdCtrl Cont
 				fmt.Errorf("updating config entry in consul: %w", err))
 		}
 		logger.Info("config entry updated", "request-time", writeMeta.RequestTime)
-		return r.syncSuccessful(ctx, crdCtrl, configEntry)
+		return r.syncSuccessful(ctx, crdCtrl, configEntry, r.writtenConsulStatus(logger, consulClient, configEntry, consulEntry))
 	} else if requiresMigration && entry.GetMeta()[common.DatacenterKey] != r.DatacenterName {
 		// If we get here then we're doing a migration and the entry in Consul
 		// matches the entry in Kubernetes. We just need to update the metadata
@@ -262,9 +282,11 @@ func (r *ConfigEntryController) ReconcileEntry(ctx context.Context, crdCtrl Cont
 				fmt.Errorf("updating config entry in consul: %w", err))
 		}
 		logger.Info("config entry migrated", "request-time", writeMeta.RequestTime)
-		return r.syncSuccessful(ctx, crdCtrl, configEntry)
-	} else if configEntry.SyncedConditionStatus() != corev1.ConditionTrue {
-		return r.syncSuccessful(ctx, crdCtrl, configEntry)
+		return r.syncSuccessful(ctx, crdCtrl, configEntry, r.writtenConsulStatus(logger, consulClient, configEntry, consulEntry))
+	} else if consulStatus := r.consulStatus(configEntry, consulEntry, entry); configEntry.SyncedConditionStatus() != corev1.ConditionTrue || configEntry.ConsulStatus() != consulStatus {
+		// Also update the status if it's out of date with Consul, e.g. because
+		// the entry was modified outside of Kubernetes.
+		return r.syncSuccessful(ctx, crdCtrl, configEntry, consulStatus)
 	}
 
 	return ctrl.Result{}, nil
@@ -309,7 +331,7 @@ func (r *ConfigEntryController) consulNamespace(configEntry capi.ConfigEntry, na
 	// is defaulted by the webhook. These are then set on the ServiceIntentions config entry
 	// but not on the others. In case the ConfigEntry has the Consul Namespace set, we just
 	// use the namespace assigned instead of attempting to determine it.
-	if configEntry.GetNamespace() != "" {
+	if configEntry != nil && configEntry.GetNamespace() != "" {
 		return configEntry.GetNamespace()
 	}
 
@@ -325,6 +347,9 @@ func (r *ConfigEntryController) consulNamespace(configEntry capi.ConfigEntry, na
 }
 
 func (r *ConfigEntryController) syncFailed(ctx context.Context, logger logr.Logger, updater Controller, configEntry common.ConfigEntryResource, errType string, err error) (ctrl.Result, error) {
+	if status, reason, _ := configEntry.SyncedCondition(); status != corev1.ConditionFalse || reason != errType {
+		r.recordEvent(configEntry, corev1.EventTypeWarning, errType, err.Error())
+	}
 	configEntry.SetSyncedCondition(corev1.ConditionFalse, errType, err.Error())
 	if updateErr := updater.UpdateStatus(ctx, configEntry); updateErr != nil {
 		// Log the original error here because we are returning the updateErr.
@@ -335,8 +360,14 @@ func (r *ConfigEntryController) syncFailed(ctx context.Context, logger logr.Logg
 	return ctrl.Result{}, err
 }
 
-func (r *ConfigEntryController) syncSuccessful(ctx context.Context, updater Controller, configEntry common.ConfigEntryResource) (ctrl.Result, error) {
+func (r *ConfigEntryController) syncSuccessful(ctx context.Context, updater Controller, configEntry common.ConfigEntryResource, consulStatus common.ConsulStatus) (ctrl.Result, error) {
+	if configEntry.SyncedConditionStatus() != corev1.ConditionTrue {
+		r.recordEvent(configEntry, corev1.EventTypeNormal, SyncedReason,
+			fmt.Sprintf("config entry synced to Consul (namespace: %q, partition: %q, modify-index: %d)",
+				consulStatus.Namespace, consulStatus.Partition, consulStatus.ModifyIndex))
+	}
 	configEntry.SetSyncedCondition(corev1.ConditionTrue, "", "")
+	configEntry.SetConsulStatus(consulStatus)
 	timeNow := metav1.NewTime(time.Now())
 	configEntry.SetLastSyncedTime(&timeNow)
 	return ctrl.Result{}, updater.UpdateStatus(ctx, configEntry)
@@ -354,6 +385,9 @@ func (r *ConfigEntryController) syncUnknownWithError(ctx context.Context,
 	errType string,
 	err error) (ctrl.Result, error) {
 
+	if status, reason, _ := configEntry.SyncedCondition(); status != corev1.ConditionUnknown || reason != errType {
+		r.recordEvent(configEntry, corev1.EventTypeWarning, errType, err.Error())
+	}
 	configEntry.SetSyncedCondition(corev1.ConditionUnknown, errType, err.Error())
 	if updateErr := updater.UpdateStatus(ctx, configEntry); updateErr != nil {
 		// Log the original error here because we are returning the updateErr.
@@ -364,6 +398,59 @@ func (r *ConfigEntryController) syncUnknownWithError(ctx context.Context,
 	return ctrl.Result{}, err
 }
 
+// writtenConsulStatus reads back a config entry that was just written to
+// Consul and returns its status. If the entry can't be read, the status is
+// returned without a modify index since the write itself succeeded.
+func (r *ConfigEntryController) writtenConsulStatus(logger logr.Logger, consulClient *capi.Client, configEntry common.ConfigEntryResource, consulEntry capi.ConfigEntry) common.ConsulStatus {
+	entry, _, err := consulClient.ConfigEntries().Get(configEntry.ConsulKind(), configEntry.ConsulName(), &capi.QueryOptions{
+		Namespace: r.consulNamespace(consulEntry, configEntry.ConsulMirroringNS(), configEntry.ConsulGlobalResource()),
+	})
+	if err != nil {
+		logger.Error(err, "reading config entry from consul after write")
+		entry = nil
+	}
+	return r.consulStatus(configEntry, consulEntry, entry)
+}
+
+// consulStatus returns the status of a config entry in Consul. consulEntry
+// is the config entry generated from the resource and entry is the config
+// entry as read from Consul, which may be nil.
+func (r *ConfigEntryController) consulStatus(configEntry common.ConfigEntryResource, consulEntry capi.ConfigEntry, entry capi.ConfigEntry) common.ConsulStatus {
+	status := common.ConsulStatus{
+		Namespace:  r.consulNamespace(consulEntry, configEntry.ConsulMirroringNS(), configEntry.ConsulGlobalResource()),
+		Datacenter: r.DatacenterName,
+		SpecHash:   configEntrySpecHash(consulEntry),
+	}
+	if r.ConsulClientConfig != nil && r.ConsulClientConfig.APIClientConfig != nil {
+		status.Partition = r.ConsulClientConfig.APIClientConfig.Partition
+	}
+	if entry != nil {
+		status.ModifyIndex = entry.GetModifyIndex()
+		if entry.GetPartition() != "" {
+			status.Partition = entry.GetPartition()
+		}
+	}
+	return status
+}
+
+func (r *ConfigEntryController) recordEvent(configEntry common.ConfigEntryResource, eventType, reason, message string) {
+	if r.EventRecorder == nil {
+		return
+	}
+	r.EventRecorder.Event(configEntry, eventType, reason, message)
+}
+
+// configEntrySpecHash returns a hash of the config entry that is written to
+// Consul so that changes to the applied spec can be detected.
+func configEntrySpecHash(consulEntry capi.ConfigEntry) string {
+	entryJSON, err := json.Marshal(consulEntry)
+	if err != nil {
+		return ""
+	}
+	hash := sha256.Sum256(entryJSON)
+	return hex.EncodeToString(hash[:])
+}
+
 // nonMatchingMigrationError returns an error that indicates the migration failed
 // because the config entries did not match.
 func (r *ConfigEntryController) nonMatchingMigrationError(kubeEntry common.ConfigEntryResource, consulEntry capi.ConfigEntry) error {
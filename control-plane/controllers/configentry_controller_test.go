@@ -5,6 +5,7 @@ package controllers
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"testing"
 	"time"
@@ -23,6 +24,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
@@ -431,6 +433,37 @@ func TestConfigEntryControllers_createsConfigEntry(t *testing.T) {
 				require.Equal(t, "sni", resource.Services[0].SNI)
 			},
 		},
+		{
+			kubeKind:   "ConfigEntry",
+			consulKind: capi.JWTProvider,
+			configEntryResource: &v1alpha1.ConfigEntry{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "foo",
+					Namespace: kubeNS,
+				},
+				Spec: v1alpha1.ConfigEntrySpec{
+					Kind: capi.JWTProvider,
+					Spec: json.RawMessage(`{"Issuer": "issuer", "JSONWebKeySet": {"Remote": {"URI": "https://example.com/keys"}}}`),
+				},
+			},
+			reconciler: func(client client.Client, cfg *consul.Config, watcher consul.ServerConnectionManager, logger logr.Logger) testReconciler {
+				return &ConfigEntryResourceController{
+					Client: client,
+					Log:    logger,
+					ConfigEntryController: &ConfigEntryController{
+						ConsulClientConfig:  cfg,
+						ConsulServerConnMgr: watcher,
+						DatacenterName:      datacenterName,
+					},
+				}
+			},
+			compare: func(t *testing.T, consulEntry capi.ConfigEntry) {
+				resource, ok := consulEntry.(*capi.JWTProviderConfigEntry)
+				require.True(t, ok, "cast error")
+				require.Equal(t, "issuer", resource.Issuer)
+				require.Equal(t, "https://example.com/keys", resource.JSONWebKeySet.Remote.URI)
+			},
+		},
 	}
 
 	for _, c := range cases {
@@ -473,6 +506,12 @@ func TestConfigEntryControllers_createsConfigEntry(t *testing.T) {
 			req.NoError(err)
 			req.Equal(corev1.ConditionTrue, c.configEntryResource.SyncedConditionStatus())
 
+			// Check that the status records where the entry was written.
+			consulStatus := c.configEntryResource.ConsulStatus()
+			req.Equal(datacenterName, consulStatus.Datacenter)
+			req.Equal(cfg.GetModifyIndex(), consulStatus.ModifyIndex)
+			req.NotEmpty(consulStatus.SpecHash)
+
 			// Check that the finalizer is added.
 			req.Contains(c.configEntryResource.Finalizers(), FinalizerName)
 		})
@@ -1389,6 +1428,7 @@ func TestConfigEntryControllers_errorUpdatesSyncStatus(t *testing.T) {
 	// Stop the server before calling reconcile imitating a server that's not running.
 	_ = testClient.TestServer.Stop()
 
+	recorder := record.NewFakeRecorder(10)
 	reconciler := &ServiceDefaultsController{
 		Client: fakeClient,
 		Log:    logrtest.TestLogger{T: t},
@@ -1396,6 +1436,7 @@ func TestConfigEntryControllers_errorUpdatesSyncStatus(t *testing.T) {
 			ConsulClientConfig:  testClient.Cfg,
 			ConsulServerConnMgr: testClient.Watcher,
 			DatacenterName:      datacenterName,
+			EventRecorder:       recorder,
 		},
 	}
 
@@ -1421,6 +1462,10 @@ func TestConfigEntryControllers_errorUpdatesSyncStatus(t *testing.T) {
 	req.Equal(corev1.ConditionFalse, status)
 	req.Equal("ConsulAgentError", reason)
 	req.Contains(errMsg, expErr)
+
+	// Check that a warning event was emitted for the failure.
+	req.Len(recorder.Events, 1)
+	req.Contains(<-recorder.Events, "Warning ConsulAgentError")
 }
 
 // Test that if the config entry hasn't changed in Consul but our resource
@@ -1456,6 +1501,7 @@ func TestConfigEntryControllers_setsSyncedToTrue(t *testing.T) {
 	testClient := test.TestServerWithMockConnMgrWatcher(t, nil)
 	testClient.TestServer.WaitForServiceIntentions(t)
 	consulClient := testClient.APIClient
+	recorder := record.NewFakeRecorder(10)
 	reconciler := &ServiceDefaultsController{
 		Client: fakeClient,
 		Log:    logrtest.TestLogger{T: t},
@@ -1463,6 +1509,7 @@ func TestConfigEntryControllers_setsSyncedToTrue(t *testing.T) {
 			ConsulClientConfig:  testClient.Cfg,
 			ConsulServerConnMgr: testClient.Watcher,
 			DatacenterName:      datacenterName,
+			EventRecorder:       recorder,
 		},
 	}
 
@@ -1485,6 +1532,18 @@ func TestConfigEntryControllers_setsSyncedToTrue(t *testing.T) {
 	err = fakeClient.Get(ctx, namespacedName, svcDefaults)
 	req.NoError(err)
 	req.Equal(corev1.ConditionTrue, svcDefaults.SyncedConditionStatus())
+
+	// Check that an event was emitted for the transition to synced.
+	req.Len(recorder.Events, 1)
+	req.Contains(<-recorder.Events, "Normal Synced")
+
+	// Reconciling again doesn't emit another event since the status hasn't
+	// changed.
+	_, err = reconciler.Reconcile(ctx, ctrl.Request{
+		NamespacedName: namespacedName,
+	})
+	req.NoError(err)
+	req.Len(recorder.Events, 0)
 }
 
 // Test that if the config entry exists in Consul but is not managed by the
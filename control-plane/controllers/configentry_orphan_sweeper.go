@@ -0,0 +1,333 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/hashicorp/consul-k8s/control-plane/api/common"
+	consulv1alpha1 "github.com/hashicorp/consul-k8s/control-plane/api/v1alpha1"
+	"github.com/hashicorp/consul-k8s/control-plane/consul"
+	capi "github.com/hashicorp/consul/api"
+	"github.com/hashicorp/go-multierror"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	orphanedConfigEntries = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "consul_config_entry_orphans",
+		Help: "Number of Consul config entries managed by this datacenter that have no backing custom resource.",
+	}, []string{"kind"})
+	orphanedConfigEntriesDeleted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "consul_config_entry_orphans_deleted_total",
+		Help: "Number of orphaned Consul config entries deleted by the sweeper.",
+	}, []string{"kind"})
+	orphanSweepErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "consul_config_entry_orphan_sweep_errors_total",
+		Help: "Number of orphaned config entry sweeps that failed.",
+	})
+)
+
+func init() {
+	metrics.Registry.MustRegister(orphanedConfigEntries, orphanedConfigEntriesDeleted, orphanSweepErrors)
+}
+
+// configEntryKinds maps each Consul config entry kind that is managed through a
+// custom resource to the list type of that custom resource.
+var configEntryKinds = map[string]func() client.ObjectList{
+	capi.ServiceDefaults:    func() client.ObjectList { return &consulv1alpha1.ServiceDefaultsList{} },
+	capi.ServiceResolver:    func() client.ObjectList { return &consulv1alpha1.ServiceResolverList{} },
+	capi.ProxyDefaults:      func() client.ObjectList { return &consulv1alpha1.ProxyDefaultsList{} },
+	capi.MeshConfig:         func() client.ObjectList { return &consulv1alpha1.MeshList{} },
+	capi.ExportedServices:   func() client.ObjectList { return &consulv1alpha1.ExportedServicesList{} },
+	capi.ServiceRouter:      func() client.ObjectList { return &consulv1alpha1.ServiceRouterList{} },
+	capi.ServiceSplitter:    func() client.ObjectList { return &consulv1alpha1.ServiceSplitterList{} },
+	capi.ServiceIntentions:  func() client.ObjectList { return &consulv1alpha1.ServiceIntentionsList{} },
+	capi.IngressGateway:     func() client.ObjectList { return &consulv1alpha1.IngressGatewayList{} },
+	capi.TerminatingGateway: func() client.ObjectList { return &consulv1alpha1.TerminatingGatewayList{} },
+	capi.SamenessGroup:      func() client.ObjectList { return &consulv1alpha1.SamenessGroupList{} },
+}
+
+// sortedConfigEntryKinds returns the kinds in configEntryKinds in a stable
+// order so that sweeps are logged consistently.
+func sortedConfigEntryKinds() []string {
+	kinds := make([]string, 0, len(configEntryKinds))
+	for kind := range configEntryKinds {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// OrphanedConfigEntrySweeper periodically deletes config entries from Consul
+// that were created by this datacenter's controllers but no longer have a
+// custom resource backing them. This can happen if a custom resource is
+// force-deleted or has its finalizer removed while the controller is down.
+//
+// It implements controller-runtime's manager.Runnable and
+// manager.LeaderElectionRunnable interfaces so that only the leader sweeps.
+type OrphanedConfigEntrySweeper struct {
+	client.Client
+	Log logr.Logger
+
+	// ConfigEntryController holds the Consul client configuration and the
+	// namespace settings used to map custom resources to config entries.
+	ConfigEntryController *ConfigEntryController
+
+	// Interval is how often to sweep for orphaned config entries.
+	Interval time.Duration
+
+	// GracePeriod is how long a config entry must be continuously orphaned
+	// before it is deleted. This guards against deleting entries for custom
+	// resources that were created after the resources were listed.
+	GracePeriod time.Duration
+
+	// DryRun causes orphans to be logged rather than deleted.
+	DryRun bool
+
+	// orphans records the time each orphaned config entry was first seen,
+	// keyed by orphanKey.
+	orphans map[string]time.Time
+
+	// now is used to get the current time. It is overridden in tests.
+	now func() time.Time
+}
+
+// Start runs the sweeper until ctx is cancelled.
+func (s *OrphanedConfigEntrySweeper) Start(ctx context.Context) error {
+	s.Log.Info("starting orphaned config entry sweeper", "interval", s.Interval, "grace-period", s.GracePeriod, "dry-run", s.DryRun)
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := s.Sweep(ctx); err != nil {
+				orphanSweepErrors.Inc()
+				s.Log.Error(err, "sweeping orphaned config entries")
+			}
+		}
+	}
+}
+
+// NeedLeaderElection ensures the sweeper only runs on the leader so that
+// replicas don't race each other to delete the same entries.
+func (s *OrphanedConfigEntrySweeper) NeedLeaderElection() bool {
+	return true
+}
+
+// Sweep performs a single pass over every managed config entry kind, including
+// the kinds managed through ConfigEntry resources. Entries that have been
+// orphaned for longer than the grace period are deleted. A failure to sweep
+// one kind is logged and doesn't stop the other kinds from being swept; the
+// failures are returned together once every kind was swept.
+func (s *OrphanedConfigEntrySweeper) Sweep(ctx context.Context) error {
+	if s.orphans == nil {
+		s.orphans = make(map[string]time.Time)
+	}
+	if s.now == nil {
+		s.now = time.Now
+	}
+
+	serverState, err := s.ConfigEntryController.ConsulServerConnMgr.State()
+	if err != nil {
+		return fmt.Errorf("failed to get Consul server state: %w", err)
+	}
+	consulClient, err := consul.NewClientFromConnMgrState(s.ConfigEntryController.ConsulClientConfig, serverState)
+	if err != nil {
+		return fmt.Errorf("failed to create Consul API client: %w", err)
+	}
+
+	var errs error
+	seen := make(map[string]struct{})
+	// failedKinds are the kinds that couldn't be listed. Their orphans are
+	// remembered so that their grace period isn't restarted.
+	failedKinds := make(map[string]bool)
+	for _, kind := range sortedConfigEntryKinds() {
+		backed, err := s.backedEntries(ctx, configEntryKinds[kind]())
+		if meta.IsNoMatchError(err) {
+			// The CRD for this kind isn't installed so there is nothing to
+			// compare against.
+			continue
+		} else if err != nil {
+			failedKinds[kind] = true
+			errs = multierror.Append(errs, s.sweepError(kind, fmt.Errorf("listing %s resources: %w", kind, err)))
+			continue
+		}
+		if err := s.sweepKind(consulClient, kind, backed, seen); err != nil {
+			failedKinds[kind] = true
+			errs = multierror.Append(errs, s.sweepError(kind, err))
+		}
+	}
+
+	// Entries of the kinds without a dedicated custom resource are backed by
+	// ConfigEntry resources, matched on their spec.kind and spec.name.
+	passthroughBacked, err := s.backedEntries(ctx, &consulv1alpha1.ConfigEntryList{})
+	switch {
+	case meta.IsNoMatchError(err):
+		// The ConfigEntry CRD isn't installed.
+	case err != nil:
+		for _, kind := range consulv1alpha1.PassthroughConfigEntryKinds {
+			failedKinds[kind] = true
+		}
+		errs = multierror.Append(errs, s.sweepError(common.ConfigEntry, fmt.Errorf("listing %s resources: %w", common.ConfigEntry, err)))
+	default:
+		for _, kind := range consulv1alpha1.PassthroughConfigEntryKinds {
+			if err := s.sweepKind(consulClient, kind, passthroughBacked, seen); err != nil {
+				// Older Consul servers don't support every kind so we
+				// don't fail the whole sweep.
+				failedKinds[kind] = true
+				s.Log.Info("unable to sweep config entries", "kind", kind, "err", err.Error())
+			}
+		}
+	}
+
+	// Forget about entries that are no longer orphaned, either because they
+	// were deleted or because a custom resource now backs them.
+	for key, kind := range s.orphanKinds() {
+		if _, ok := seen[key]; !ok && !failedKinds[kind] {
+			delete(s.orphans, key)
+		}
+	}
+	return errs
+}
+
+// sweepError logs err as the failure to sweep kind and returns it.
+func (s *OrphanedConfigEntrySweeper) sweepError(kind string, err error) error {
+	s.Log.Error(err, "sweeping orphaned config entries", "kind", kind)
+	return err
+}
+
+// sweepKind handles the entries of the given kind in Consul that aren't in
+// backed. The keys of orphaned entries are added to seen. Entries that fail to
+// be deleted don't stop the other entries from being handled.
+func (s *OrphanedConfigEntrySweeper) sweepKind(consulClient *capi.Client, kind string, backed, seen map[string]struct{}) error {
+	var opts capi.QueryOptions
+	if s.ConfigEntryController.EnableConsulNamespaces {
+		opts.Namespace = common.WildcardNamespace
+	}
+	entries, _, err := consulClient.ConfigEntries().List(kind, &opts)
+	if err != nil {
+		return fmt.Errorf("listing %s config entries from consul: %w", kind, err)
+	}
+
+	var errs error
+	orphanCount := 0
+	for _, entry := range entries {
+		if !s.ownedByDatacenter(entry) {
+			continue
+		}
+		key := s.orphanKey(kind, entry.GetNamespace(), entry.GetName())
+		if _, ok := backed[key]; ok {
+			continue
+		}
+		orphanCount++
+		seen[key] = struct{}{}
+		if err := s.handleOrphan(consulClient, key, entry); err != nil {
+			errs = multierror.Append(errs, err)
+		}
+	}
+	orphanedConfigEntries.WithLabelValues(kind).Set(float64(orphanCount))
+	return errs
+}
+
+// handleOrphan deletes entry from Consul if it has been orphaned for longer
+// than the grace period.
+func (s *OrphanedConfigEntrySweeper) handleOrphan(consulClient *capi.Client, key string, entry capi.ConfigEntry) error {
+	logger := s.Log.WithValues("kind", entry.GetKind(), "name", entry.GetName(), "ns", entry.GetNamespace())
+
+	firstSeen, ok := s.orphans[key]
+	if !ok {
+		logger.Info("found orphaned config entry", "grace-period", s.GracePeriod)
+		s.orphans[key] = s.now()
+		firstSeen = s.orphans[key]
+	}
+	if s.now().Sub(firstSeen) < s.GracePeriod {
+		return nil
+	}
+
+	if s.DryRun {
+		logger.Info("dry run: would delete orphaned config entry", "orphaned-since", firstSeen)
+		return nil
+	}
+
+	// Use a check-and-set delete so that we don't delete the entry if it was
+	// modified after we listed it.
+	deleted, _, err := consulClient.ConfigEntries().DeleteCAS(entry.GetKind(), entry.GetName(), entry.GetModifyIndex(), &capi.WriteOptions{
+		Namespace: entry.GetNamespace(),
+	})
+	if err != nil {
+		return fmt.Errorf("deleting orphaned config entry %s/%s from consul: %w", entry.GetKind(), entry.GetName(), err)
+	}
+	if !deleted {
+		logger.Info("orphaned config entry was modified since it was listed - skipping delete")
+		return nil
+	}
+	delete(s.orphans, key)
+	orphanedConfigEntriesDeleted.WithLabelValues(entry.GetKind()).Inc()
+	logger.Info("deleted orphaned config entry", "orphaned-since", firstSeen)
+	return nil
+}
+
+// backedEntries lists all custom resources of the given list type and returns
+// the set of orphan keys for the config entries they manage.
+func (s *OrphanedConfigEntrySweeper) backedEntries(ctx context.Context, list client.ObjectList) (map[string]struct{}, error) {
+	if err := s.List(ctx, list); err != nil {
+		return nil, err
+	}
+	items, err := meta.ExtractList(list)
+	if err != nil {
+		return nil, err
+	}
+
+	r := s.ConfigEntryController
+	backed := make(map[string]struct{}, len(items))
+	for _, item := range items {
+		configEntry, ok := item.(common.ConfigEntryResource)
+		if !ok {
+			return nil, fmt.Errorf("%T is not a config entry resource", item)
+		}
+		consulEntry := configEntry.ToConsul(r.DatacenterName)
+		consulNS := r.consulNamespace(consulEntry, configEntry.ConsulMirroringNS(), configEntry.ConsulGlobalResource())
+		backed[s.orphanKey(configEntry.ConsulKind(), consulNS, configEntry.ConsulName())] = struct{}{}
+	}
+	return backed, nil
+}
+
+// ownedByDatacenter returns true if the config entry was written by the
+// controllers in our datacenter.
+func (s *OrphanedConfigEntrySweeper) ownedByDatacenter(entry capi.ConfigEntry) bool {
+	entryMeta := entry.GetMeta()
+	return entryMeta[common.SourceKey] == common.SourceValue &&
+		entryMeta[common.DatacenterKey] == s.ConfigEntryController.DatacenterName
+}
+
+// orphanKinds returns the kind of each orphan, keyed by orphanKey.
+func (s *OrphanedConfigEntrySweeper) orphanKinds() map[string]string {
+	kinds := make(map[string]string, len(s.orphans))
+	for key := range s.orphans {
+		kinds[key] = strings.SplitN(key, "/", 2)[0]
+	}
+	return kinds
+}
+
+// orphanKey returns a key that uniquely identifies a config entry within the
+// partition the controllers are managing.
+func (s *OrphanedConfigEntrySweeper) orphanKey(kind, namespace, name string) string {
+	if !s.ConfigEntryController.EnableConsulNamespaces {
+		namespace = ""
+	} else if namespace == "" {
+		namespace = common.DefaultConsulNamespace
+	}
+	return fmt.Sprintf("%s/%s/%s", kind, namespace, name)
+}
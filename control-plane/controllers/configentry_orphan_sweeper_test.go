@@ -0,0 +1,301 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	logrtest "github.com/go-logr/logr/testing"
+	"github.com/hashicorp/consul-k8s/control-plane/api/common"
+	"github.com/hashicorp/consul-k8s/control-plane/api/v1alpha1"
+	"github.com/hashicorp/consul-k8s/control-plane/helper/test"
+	capi "github.com/hashicorp/consul/api"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestOrphanedConfigEntrySweeper_Sweep(t *testing.T) {
+	t.Parallel()
+
+	ownedMeta := map[string]string{
+		common.SourceKey:     common.SourceValue,
+		common.DatacenterKey: datacenterName,
+	}
+
+	cases := map[string]struct {
+		dryRun       bool
+		consulEntry  capi.ConfigEntry
+		kubeResource *v1alpha1.ServiceDefaults
+		expDeleted   bool
+	}{
+		"orphaned entry is deleted": {
+			consulEntry: &capi.ServiceConfigEntry{
+				Kind: capi.ServiceDefaults,
+				Name: "foo",
+				Meta: ownedMeta,
+			},
+			expDeleted: true,
+		},
+		"orphaned entry is not deleted in dry run": {
+			dryRun: true,
+			consulEntry: &capi.ServiceConfigEntry{
+				Kind: capi.ServiceDefaults,
+				Name: "foo",
+				Meta: ownedMeta,
+			},
+			expDeleted: false,
+		},
+		"entry with a custom resource is not deleted": {
+			consulEntry: &capi.ServiceConfigEntry{
+				Kind: capi.ServiceDefaults,
+				Name: "foo",
+				Meta: ownedMeta,
+			},
+			kubeResource: &v1alpha1.ServiceDefaults{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "foo",
+					Namespace: "default",
+				},
+			},
+			expDeleted: false,
+		},
+		"entry from another datacenter is not deleted": {
+			consulEntry: &capi.ServiceConfigEntry{
+				Kind: capi.ServiceDefaults,
+				Name: "foo",
+				Meta: map[string]string{
+					common.SourceKey:     common.SourceValue,
+					common.DatacenterKey: "other-datacenter",
+				},
+			},
+			expDeleted: false,
+		},
+		"entry not created by kubernetes is not deleted": {
+			consulEntry: &capi.ServiceConfigEntry{
+				Kind: capi.ServiceDefaults,
+				Name: "foo",
+			},
+			expDeleted: false,
+		},
+	}
+
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			s := runtime.NewScheme()
+			require.NoError(t, v1alpha1.AddToScheme(s))
+			clientBuilder := fake.NewClientBuilder().WithScheme(s)
+			if c.kubeResource != nil {
+				clientBuilder = clientBuilder.WithRuntimeObjects(c.kubeResource)
+			}
+
+			testClient := test.TestServerWithMockConnMgrWatcher(t, nil)
+			testClient.TestServer.WaitForServiceIntentions(t)
+			consulClient := testClient.APIClient
+			_, _, err := consulClient.ConfigEntries().Set(c.consulEntry, nil)
+			require.NoError(t, err)
+
+			sweeper := &OrphanedConfigEntrySweeper{
+				Client: clientBuilder.Build(),
+				Log:    logrtest.TestLogger{T: t},
+				ConfigEntryController: &ConfigEntryController{
+					ConsulClientConfig:  testClient.Cfg,
+					ConsulServerConnMgr: testClient.Watcher,
+					DatacenterName:      datacenterName,
+				},
+				DryRun: c.dryRun,
+			}
+			require.NoError(t, sweeper.Sweep(ctx))
+
+			_, _, err = consulClient.ConfigEntries().Get(c.consulEntry.GetKind(), c.consulEntry.GetName(), nil)
+			if c.expDeleted {
+				require.Error(t, err)
+				require.True(t, isNotFoundErr(err))
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestOrphanedConfigEntrySweeper_GracePeriod(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	s := runtime.NewScheme()
+	require.NoError(t, v1alpha1.AddToScheme(s))
+
+	testClient := test.TestServerWithMockConnMgrWatcher(t, nil)
+	testClient.TestServer.WaitForServiceIntentions(t)
+	consulClient := testClient.APIClient
+	_, _, err := consulClient.ConfigEntries().Set(&capi.ServiceConfigEntry{
+		Kind: capi.ServiceDefaults,
+		Name: "foo",
+		Meta: map[string]string{
+			common.SourceKey:     common.SourceValue,
+			common.DatacenterKey: datacenterName,
+		},
+	}, nil)
+	require.NoError(t, err)
+
+	now := time.Now()
+	sweeper := &OrphanedConfigEntrySweeper{
+		Client: fake.NewClientBuilder().WithScheme(s).Build(),
+		Log:    logrtest.TestLogger{T: t},
+		ConfigEntryController: &ConfigEntryController{
+			ConsulClientConfig:  testClient.Cfg,
+			ConsulServerConnMgr: testClient.Watcher,
+			DatacenterName:      datacenterName,
+		},
+		GracePeriod: time.Minute,
+		now:         func() time.Time { return now },
+	}
+
+	// The first sweep only records the orphan.
+	require.NoError(t, sweeper.Sweep(ctx))
+	_, _, err = consulClient.ConfigEntries().Get(capi.ServiceDefaults, "foo", nil)
+	require.NoError(t, err)
+
+	// Sweeping again before the grace period has passed is a no-op.
+	now = now.Add(30 * time.Second)
+	require.NoError(t, sweeper.Sweep(ctx))
+	_, _, err = consulClient.ConfigEntries().Get(capi.ServiceDefaults, "foo", nil)
+	require.NoError(t, err)
+
+	// Once the grace period has passed the entry is deleted.
+	now = now.Add(time.Minute)
+	require.NoError(t, sweeper.Sweep(ctx))
+	_, _, err = consulClient.ConfigEntries().Get(capi.ServiceDefaults, "foo", nil)
+	require.True(t, isNotFoundErr(err))
+}
+
+func TestOrphanedConfigEntrySweeper_ConfigEntryResources(t *testing.T) {
+	t.Parallel()
+
+	ownedMeta := map[string]string{
+		common.SourceKey:     common.SourceValue,
+		common.DatacenterKey: datacenterName,
+	}
+	jwksConfig := &capi.JSONWebKeySet{Remote: &capi.RemoteJWKS{URI: "https://example.com/keys"}}
+
+	cases := map[string]struct {
+		kubeResource *v1alpha1.ConfigEntry
+		expDeleted   bool
+	}{
+		"orphaned entry is deleted": {
+			expDeleted: true,
+		},
+		"entry with a ConfigEntry resource is not deleted": {
+			kubeResource: &v1alpha1.ConfigEntry{
+				ObjectMeta: metav1.ObjectMeta{Name: "okta", Namespace: "default"},
+				Spec:       v1alpha1.ConfigEntrySpec{Kind: capi.JWTProvider},
+			},
+			expDeleted: false,
+		},
+		"entry matched on spec.name is not deleted": {
+			kubeResource: &v1alpha1.ConfigEntry{
+				ObjectMeta: metav1.ObjectMeta{Name: "okta-provider", Namespace: "default"},
+				Spec:       v1alpha1.ConfigEntrySpec{Kind: capi.JWTProvider, Name: "okta"},
+			},
+			expDeleted: false,
+		},
+		"ConfigEntry resource of another kind does not back the entry": {
+			kubeResource: &v1alpha1.ConfigEntry{
+				ObjectMeta: metav1.ObjectMeta{Name: "okta", Namespace: "default"},
+				Spec:       v1alpha1.ConfigEntrySpec{Kind: capi.HTTPRoute},
+			},
+			expDeleted: true,
+		},
+	}
+
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			s := runtime.NewScheme()
+			require.NoError(t, v1alpha1.AddToScheme(s))
+			clientBuilder := fake.NewClientBuilder().WithScheme(s)
+			if c.kubeResource != nil {
+				clientBuilder = clientBuilder.WithRuntimeObjects(c.kubeResource)
+			}
+
+			testClient := test.TestServerWithMockConnMgrWatcher(t, nil)
+			testClient.TestServer.WaitForServiceIntentions(t)
+			consulClient := testClient.APIClient
+			_, _, err := consulClient.ConfigEntries().Set(&capi.JWTProviderConfigEntry{
+				Kind:          capi.JWTProvider,
+				Name:          "okta",
+				JSONWebKeySet: jwksConfig,
+				Meta:          ownedMeta,
+			}, nil)
+			require.NoError(t, err)
+
+			sweeper := &OrphanedConfigEntrySweeper{
+				Client: clientBuilder.Build(),
+				Log:    logrtest.TestLogger{T: t},
+				ConfigEntryController: &ConfigEntryController{
+					ConsulClientConfig:  testClient.Cfg,
+					ConsulServerConnMgr: testClient.Watcher,
+					DatacenterName:      datacenterName,
+				},
+			}
+			require.NoError(t, sweeper.Sweep(ctx))
+
+			_, _, err = consulClient.ConfigEntries().Get(capi.JWTProvider, "okta", nil)
+			if c.expDeleted {
+				require.True(t, isNotFoundErr(err))
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestOrphanedConfigEntrySweeper_ContinuesAfterKindFails(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	// Only the ServiceDefaults types are registered so listing every other
+	// kind fails.
+	s := runtime.NewScheme()
+	s.AddKnownTypes(v1alpha1.GroupVersion, &v1alpha1.ServiceDefaults{}, &v1alpha1.ServiceDefaultsList{})
+
+	testClient := test.TestServerWithMockConnMgrWatcher(t, nil)
+	testClient.TestServer.WaitForServiceIntentions(t)
+	consulClient := testClient.APIClient
+	_, _, err := consulClient.ConfigEntries().Set(&capi.ServiceConfigEntry{
+		Kind: capi.ServiceDefaults,
+		Name: "foo",
+		Meta: map[string]string{
+			common.SourceKey:     common.SourceValue,
+			common.DatacenterKey: datacenterName,
+		},
+	}, nil)
+	require.NoError(t, err)
+
+	sweeper := &OrphanedConfigEntrySweeper{
+		Client: fake.NewClientBuilder().WithScheme(s).Build(),
+		Log:    logrtest.TestLogger{T: t},
+		ConfigEntryController: &ConfigEntryController{
+			ConsulClientConfig:  testClient.Cfg,
+			ConsulServerConnMgr: testClient.Watcher,
+			DatacenterName:      datacenterName,
+		},
+	}
+	err = sweeper.Sweep(ctx)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "listing proxy-defaults resources")
+	require.Contains(t, err.Error(), "listing configentry resources")
+
+	// The kinds that could be listed were still swept.
+	_, _, err = consulClient.ConfigEntries().Get(capi.ServiceDefaults, "foo", nil)
+	require.True(t, isNotFoundErr(err))
+}
@@ -0,0 +1,158 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package cert
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// IsSelfSigned returns whether the certificate is a self-signed root.
+func IsSelfSigned(c *x509.Certificate) bool {
+	return bytes.Equal(c.RawSubject, c.RawIssuer) && c.CheckSignatureFrom(c) == nil
+}
+
+// BuildChain returns the certificates from candidates that issued ca, its
+// issuer and so on, in order from the issuer of ca to the root. Candidates
+// that aren't part of the chain are ignored.
+func BuildChain(ca *x509.Certificate, candidates []*x509.Certificate) []*x509.Certificate {
+	var chain []*x509.Certificate
+	current := ca
+	for !IsSelfSigned(current) && len(chain) < len(candidates) {
+		var issuer *x509.Certificate
+		for _, candidate := range candidates {
+			if bytes.Equal(current.RawIssuer, candidate.RawSubject) && current.CheckSignatureFrom(candidate) == nil {
+				issuer = candidate
+				break
+			}
+		}
+		if issuer == nil {
+			break
+		}
+		chain = append(chain, issuer)
+		current = issuer
+	}
+	return chain
+}
+
+// IntermediatesPEM returns the PEM encoded certificates that a server
+// presents after its leaf certificate issued by ca: ca and the rest of its
+// chain, except for self-signed roots which clients must already trust.
+func IntermediatesPEM(ca *x509.Certificate, chain []*x509.Certificate) string {
+	var buf bytes.Buffer
+	for _, c := range append([]*x509.Certificate{ca}, chain...) {
+		if IsSelfSigned(c) {
+			continue
+		}
+		_ = pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: c.Raw})
+	}
+	return buf.String()
+}
+
+// ValidateCA returns an error if caCert can't issue certificates with
+// signer at the given time. Certificates without basic constraints, such as
+// version 1 certificates, are accepted as CAs.
+func ValidateCA(caCert *x509.Certificate, signer crypto.Signer, now time.Time) error {
+	if caCert.BasicConstraintsValid && !caCert.IsCA {
+		return fmt.Errorf("certificate %q is not a CA", caCert.Subject.CommonName)
+	}
+	if caCert.KeyUsage != 0 && caCert.KeyUsage&x509.KeyUsageCertSign == 0 {
+		return fmt.Errorf("CA certificate %q can't sign certificates", caCert.Subject.CommonName)
+	}
+	if now.Before(caCert.NotBefore) || now.After(caCert.NotAfter) {
+		return fmt.Errorf("CA certificate %q is only valid from %s to %s",
+			caCert.Subject.CommonName, caCert.NotBefore.Format(time.RFC3339), caCert.NotAfter.Format(time.RFC3339))
+	}
+	pub, ok := signer.Public().(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !pub.Equal(caCert.PublicKey) {
+		return fmt.Errorf("CA private key does not match CA certificate %q", caCert.Subject.CommonName)
+	}
+	return nil
+}
+
+// NotAfter returns the earliest expiry of the certificates. A certificate
+// issued by the first certificate can't be valid for longer than this.
+func NotAfter(chain ...*x509.Certificate) time.Time {
+	var notAfter time.Time
+	for _, c := range chain {
+		if notAfter.IsZero() || c.NotAfter.Before(notAfter) {
+			notAfter = c.NotAfter
+		}
+	}
+	return notAfter
+}
+
+// CheckNameConstraints returns an error if the name constraints of any of
+// the CA certificates in chain don't permit host as a Subject Alternative
+// Name.
+func CheckNameConstraints(host string, chain ...*x509.Certificate) error {
+	ip := net.ParseIP(host)
+	for _, c := range chain {
+		var permitted bool
+		if ip != nil {
+			permitted = permittedIP(ip, c.PermittedIPRanges, c.ExcludedIPRanges)
+		} else {
+			permitted = permittedDomain(host, c.PermittedDNSDomains, c.ExcludedDNSDomains)
+		}
+		if !permitted {
+			return fmt.Errorf("%q is not permitted by the name constraints of CA certificate %q", host, c.Subject.CommonName)
+		}
+	}
+	return nil
+}
+
+func permittedIP(ip net.IP, permitted, excluded []*net.IPNet) bool {
+	for _, r := range excluded {
+		if r.Contains(ip) {
+			return false
+		}
+	}
+	if len(permitted) == 0 {
+		return true
+	}
+	for _, r := range permitted {
+		if r.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func permittedDomain(host string, permitted, excluded []string) bool {
+	for _, d := range excluded {
+		if matchDomainConstraint(host, d) {
+			return false
+		}
+	}
+	if len(permitted) == 0 {
+		return true
+	}
+	for _, d := range permitted {
+		if matchDomainConstraint(host, d) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchDomainConstraint returns whether host matches the DNS name
+// constraint. A constraint matches the domain and its subdomains, or only
+// its subdomains if it starts with a period.
+func matchDomainConstraint(host, constraint string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	constraint = strings.ToLower(constraint)
+	if constraint == "" {
+		return true
+	}
+	if strings.HasPrefix(constraint, ".") {
+		return strings.HasSuffix(host, constraint)
+	}
+	return host == constraint || strings.HasSuffix(host, "."+constraint)
+}
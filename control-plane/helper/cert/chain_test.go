@@ -0,0 +1,124 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package cert
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateCAWithKeyAlgorithm(t *testing.T) {
+	t.Parallel()
+
+	for _, alg := range KeyAlgorithms {
+		alg := alg
+		t.Run(string(alg), func(t *testing.T) {
+			t.Parallel()
+			signer, keyPEM, caPEM, _, err := GenerateCAWithKeyAlgorithm("Consul Agent CA", alg)
+			require.NoError(t, err)
+			parsedSigner, err := ParseSigner(keyPEM)
+			require.NoError(t, err)
+			require.Equal(t, signer.Public(), parsedSigner.Public())
+
+			caCert, err := ParseCert([]byte(caPEM))
+			require.NoError(t, err)
+			require.NoError(t, ValidateCA(caCert, signer, time.Now()))
+
+			certPEM, _, err := GenerateCertWithKeyAlgorithm("server.dc1.consul", time.Hour, caCert, signer, []string{"server.dc1.consul"}, alg)
+			require.NoError(t, err)
+			serverCert, err := ParseCert([]byte(certPEM))
+			require.NoError(t, err)
+			require.NoError(t, serverCert.CheckSignatureFrom(caCert))
+		})
+	}
+
+	_, _, _, _, err := GenerateCAWithKeyAlgorithm("Consul Agent CA", "dsa")
+	require.EqualError(t, err, "unsupported key algorithm \"dsa\"")
+}
+
+func TestBuildChain(t *testing.T) {
+	t.Parallel()
+
+	root, rootSigner := testCA(t, nil, nil, nil)
+	intermediate, intermediateSigner := testCA(t, root, rootSigner, nil)
+	issuing, _ := testCA(t, intermediate, intermediateSigner, nil)
+	unrelated, _ := testCA(t, nil, nil, nil)
+
+	require.Equal(t, []*x509.Certificate{intermediate, root}, BuildChain(issuing, []*x509.Certificate{unrelated, root, intermediate}))
+	require.Empty(t, BuildChain(root, []*x509.Certificate{intermediate}))
+	require.Equal(t, []*x509.Certificate{intermediate}, BuildChain(issuing, []*x509.Certificate{intermediate}))
+
+	intermediates, err := ParseCerts([]byte(IntermediatesPEM(issuing, []*x509.Certificate{intermediate, root})))
+	require.NoError(t, err)
+	require.Equal(t, []*x509.Certificate{issuing, intermediate}, intermediates)
+	require.Empty(t, IntermediatesPEM(root, nil))
+}
+
+func TestValidateCA(t *testing.T) {
+	t.Parallel()
+
+	ca, signer := testCA(t, nil, nil, nil)
+	_, otherSigner := testCA(t, nil, nil, nil)
+	require.NoError(t, ValidateCA(ca, signer, time.Now()))
+	require.EqualError(t, ValidateCA(ca, otherSigner, time.Now()), "CA private key does not match CA certificate \"Test CA\"")
+	require.ErrorContains(t, ValidateCA(ca, signer, time.Now().Add(-time.Hour)), "CA certificate \"Test CA\" is only valid from")
+}
+
+func TestCheckNameConstraints(t *testing.T) {
+	t.Parallel()
+
+	root, rootSigner := testCA(t, nil, nil, nil)
+	_, ipNet, err := net.ParseCIDR("10.0.0.0/8")
+	require.NoError(t, err)
+	constrained, _ := testCA(t, root, rootSigner, func(c *x509.Certificate) {
+		c.PermittedDNSDomains = []string{"consul", ".svc"}
+		c.ExcludedDNSDomains = []string{"bad.consul"}
+		c.PermittedIPRanges = []*net.IPNet{ipNet}
+	})
+
+	for _, host := range []string{"consul", "server.dc1.consul", "consul-server.default.svc", "10.0.0.1"} {
+		require.NoError(t, CheckNameConstraints(host, constrained, root), host)
+	}
+	for _, host := range []string{"localhost", "svc", "server.bad.consul", "127.0.0.1"} {
+		require.EqualError(t, CheckNameConstraints(host, constrained, root),
+			"\""+host+"\" is not permitted by the name constraints of CA certificate \"Test CA\"")
+	}
+}
+
+// testCA returns a CA certificate signed by parent, or self-signed if parent
+// is nil.
+func testCA(t *testing.T, parent *x509.Certificate, parentSigner crypto.Signer, modify func(*x509.Certificate)) (*x509.Certificate, crypto.Signer) {
+	signer, _, err := privateKey(DefaultKeyAlgorithm)
+	require.NoError(t, err)
+	sn, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          sn,
+		Subject:               pkix.Name{CommonName: "Test CA", SerialNumber: sn.String()},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+	}
+	if modify != nil {
+		modify(template)
+	}
+	if parent == nil {
+		parent, parentSigner = template, signer
+	}
+	bs, err := x509.CreateCertificate(rand.Reader, template, parent, signer.Public(), parentSigner)
+	require.NoError(t, err)
+	c, err := x509.ParseCertificate(bs)
+	require.NoError(t, err)
+	return c, signer
+}
@@ -26,9 +26,15 @@ type Notify struct {
 	ctxCancel context.CancelFunc
 	doneCh    <-chan struct{}
 
-	// WebhookConfigName is the name of the MutatingWebhookConfiguration
+	// WebhookConfigName is the name of the webhook configuration
 	// that will be updated with the CA bundle when a new CA is generated.
 	WebhookConfigName string
+	// WebhookConfigKind is the kind of the webhook configuration, either
+	// MutatingWebhookConfiguration or ValidatingWebhookConfiguration.
+	WebhookConfigKind string
+	// ConversionCRDNames are the names of the CustomResourceDefinitions whose
+	// conversion webhooks will be updated with the CA bundle.
+	ConversionCRDNames []string
 	// SecretName is the name of the Kubernetes TLS secret that will be
 	// be created/updated with the leaf certificate and it's private key when
 	// a new certificate key pair are generated.
@@ -82,10 +88,12 @@ func (n *Notify) Start(ctx context.Context) {
 		// Send the update, or quit if we were cancelled
 		select {
 		case n.Ch <- MetaBundle{
-			Bundle:            next,
-			WebhookConfigName: n.WebhookConfigName,
-			SecretName:        n.SecretName,
-			SecretNamespace:   n.SecretNamespace,
+			Bundle:             next,
+			WebhookConfigName:  n.WebhookConfigName,
+			WebhookConfigKind:  n.WebhookConfigKind,
+			ConversionCRDNames: n.ConversionCRDNames,
+			SecretName:         n.SecretName,
+			SecretNamespace:    n.SecretNamespace,
 		}:
 		case <-ctx.Done():
 			return
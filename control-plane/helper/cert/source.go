@@ -5,7 +5,9 @@ package cert
 
 import (
 	"context"
+	"crypto/x509"
 	"reflect"
+	"time"
 )
 
 // Source should be implemented by systems that support loading TLS
@@ -36,13 +38,19 @@ type Bundle struct {
 }
 
 // MetaBundle is a composition of a certificate bundle with fields indicating
-// the name of a MutatingWebhookConfiguration and a Secret that will be updated
+// the name of a webhook configuration and a Secret that will be updated
 // when a new Bundle is available.
 type MetaBundle struct {
 	Bundle
-	// WebhookConfigName is the name of the MutatingWebhookConfiguration
+	// WebhookConfigName is the name of the webhook configuration
 	// that will be updated with the CA bundle when a new CA is generated.
 	WebhookConfigName string
+	// WebhookConfigKind is the kind of the webhook configuration, either
+	// MutatingWebhookConfiguration or ValidatingWebhookConfiguration.
+	WebhookConfigKind string
+	// ConversionCRDNames are the names of the CustomResourceDefinitions whose
+	// conversion webhooks will be updated with the CA bundle.
+	ConversionCRDNames []string
 	// SecretName is the name of the Kubernetes TLS secret that will be
 	// be created/updated with the leaf certificate and it's private key when
 	// a new certificate key pair are generated.
@@ -56,3 +64,22 @@ type MetaBundle struct {
 func (b *Bundle) Equal(b2 *Bundle) bool {
 	return reflect.DeepEqual(b, b2)
 }
+
+// waitForRenewal blocks until cert expires within expiryWithin or the
+// context is done.
+func waitForRenewal(ctx context.Context, cert *x509.Certificate, expiryWithin time.Duration) error {
+	waitTime := time.Until(cert.NotAfter) - expiryWithin
+	if waitTime < 0 {
+		waitTime = 1 * time.Millisecond
+	}
+
+	timer := time.NewTimer(waitTime)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package cert
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// FileSource loads certificates from PEM encoded files on disk, such as a
+// mounted Kubernetes secret.
+//
+// If last is given, Certificate watches the directories of the files and
+// blocks until the certificates differ from last. The directories are watched
+// rather than the files because mounted secrets are updated by replacing a
+// symlink.
+type FileSource struct {
+	CertFile string // CertFile is the path to the certificate
+	KeyFile  string // KeyFile is the path to the certificate's private key
+	CAFile   string // CAFile is the path to the CA certificate bundle
+}
+
+// Certificate implements Source.
+func (s *FileSource) Certificate(ctx context.Context, last *Bundle) (Bundle, error) {
+	if last == nil {
+		return s.read()
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return Bundle{}, fmt.Errorf("could not create watcher: %w", err)
+	}
+	defer func() {
+		_ = watcher.Close()
+	}()
+	dirs := make(map[string]struct{})
+	for _, file := range []string{s.CertFile, s.KeyFile, s.CAFile} {
+		dirs[filepath.Dir(file)] = struct{}{}
+	}
+	for dir := range dirs {
+		if err := watcher.Add(dir); err != nil {
+			return Bundle{}, fmt.Errorf("could not watch %s directory: %w", dir, err)
+		}
+	}
+
+	// Read the files after starting the watch so that no changes are missed.
+	// Errors are ignored while waiting because the files may be read while
+	// they are only partially updated.
+	for {
+		result, err := s.read()
+		if err == nil && !last.Equal(&result) {
+			return result, nil
+		}
+
+		select {
+		case <-watcher.Events:
+		case err := <-watcher.Errors:
+			return Bundle{}, err
+		case <-ctx.Done():
+			return Bundle{}, ctx.Err()
+		}
+	}
+}
+
+func (s *FileSource) read() (Bundle, error) {
+	var result Bundle
+	for _, f := range []struct {
+		path string
+		data *[]byte
+	}{
+		{s.CertFile, &result.Cert},
+		{s.KeyFile, &result.Key},
+		{s.CAFile, &result.CACert},
+	} {
+		data, err := os.ReadFile(f.path)
+		if err != nil {
+			return Bundle{}, err
+		}
+		if len(data) == 0 {
+			return Bundle{}, fmt.Errorf("%s is empty", f.path)
+		}
+		*f.data = data
+	}
+	return result, nil
+}
@@ -0,0 +1,61 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package cert
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileSource(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	source := &FileSource{
+		CertFile: filepath.Join(dir, "leaf.pem"),
+		KeyFile:  filepath.Join(dir, "leaf.key.pem"),
+		CAFile:   filepath.Join(dir, "ca.pem"),
+	}
+	ctx := context.Background()
+
+	_, err := source.Certificate(ctx, nil)
+	require.Error(t, err)
+
+	first := Bundle{Cert: []byte("cert-1"), Key: []byte("key-1"), CACert: []byte("ca-1")}
+	testBundleDir(t, &first, dir)
+	bundle, err := source.Certificate(ctx, nil)
+	require.NoError(t, err)
+	require.Equal(t, first, bundle)
+
+	// Certificate blocks while the files are unchanged.
+	timeoutCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	_, err = source.Certificate(timeoutCtx, &bundle)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// Certificate returns when the files change.
+	type result struct {
+		bundle Bundle
+		err    error
+	}
+	resultCh := make(chan result, 1)
+	go func() {
+		next, err := source.Certificate(ctx, &bundle)
+		resultCh <- result{next, err}
+	}()
+	require.NoError(t, os.WriteFile(source.CertFile, []byte("cert-2"), 0644))
+
+	select {
+	case r := <-resultCh:
+		require.NoError(t, r.err)
+		require.Equal(t, Bundle{Cert: []byte("cert-2"), Key: []byte("key-1"), CACert: []byte("ca-1")}, r.bundle)
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "certificate was not returned after the files changed")
+	}
+}
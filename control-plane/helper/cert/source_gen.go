@@ -61,20 +61,8 @@ func (s *GenSource) Certificate(ctx context.Context, last *Bundle) (Bundle, erro
 			return result, err
 		}
 
-		waitTime := time.Until(cert.NotAfter) - s.expiryWithin()
-		if waitTime < 0 {
-			waitTime = 1 * time.Millisecond
-		}
-
-		timer := time.NewTimer(waitTime)
-		defer timer.Stop()
-
-		select {
-		case <-timer.C:
-			// Fall through, generate cert
-
-		case <-ctx.Done():
-			return result, ctx.Err()
+		if err := waitForRenewal(ctx, cert, s.expiryWithin()); err != nil {
+			return result, err
 		}
 	}
 
@@ -0,0 +1,88 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package cert
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/kubernetes"
+)
+
+// SecretCAKey is the key of the CA certificate in a TLS secret issued by
+// cert-manager.
+const SecretCAKey = "ca.crt"
+
+// SecretSource loads certificates from a Kubernetes TLS secret that is
+// issued and renewed by another system, such as cert-manager. The secret must
+// have the tls.crt, tls.key and ca.crt keys.
+//
+// If last is given, Certificate watches the secret and blocks until its
+// certificates differ from last.
+type SecretSource struct {
+	Clientset kubernetes.Interface
+	Name      string // Name of the secret
+	Namespace string // Namespace of the secret
+}
+
+// Certificate implements Source.
+func (s *SecretSource) Certificate(ctx context.Context, last *Bundle) (Bundle, error) {
+	secrets := s.Clientset.CoreV1().Secrets(s.Namespace)
+	selector := fields.OneTermEqualSelector("metadata.name", s.Name).String()
+	for {
+		list, err := secrets.List(ctx, metav1.ListOptions{FieldSelector: selector})
+		if err != nil {
+			return Bundle{}, err
+		}
+		for _, secret := range list.Items {
+			if secret.Name != s.Name {
+				continue
+			}
+			result, err := secretBundle(&secret)
+			if err != nil {
+				return result, err
+			}
+			if last == nil || !last.Equal(&result) {
+				return result, nil
+			}
+		}
+		if last == nil {
+			return Bundle{}, fmt.Errorf("secret %s/%s not found", s.Namespace, s.Name)
+		}
+
+		// Wait for the secret to change. Watching from the version of the
+		// list means changes made since the list aren't missed.
+		watcher, err := secrets.Watch(ctx, metav1.ListOptions{
+			FieldSelector:   selector,
+			ResourceVersion: list.ResourceVersion,
+		})
+		if err != nil {
+			return Bundle{}, err
+		}
+		select {
+		case <-watcher.ResultChan():
+			watcher.Stop()
+		case <-ctx.Done():
+			watcher.Stop()
+			return Bundle{}, ctx.Err()
+		}
+	}
+}
+
+func secretBundle(secret *corev1.Secret) (Bundle, error) {
+	result := Bundle{
+		Cert:   secret.Data[corev1.TLSCertKey],
+		Key:    secret.Data[corev1.TLSPrivateKeyKey],
+		CACert: secret.Data[SecretCAKey],
+	}
+	for _, key := range []string{corev1.TLSCertKey, corev1.TLSPrivateKeyKey, SecretCAKey} {
+		if len(secret.Data[key]) == 0 {
+			return Bundle{}, fmt.Errorf("secret %s/%s has no %s", secret.Namespace, secret.Name, key)
+		}
+	}
+	return result, nil
+}
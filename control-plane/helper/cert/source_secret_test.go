@@ -0,0 +1,86 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package cert
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestSecretSource(t *testing.T) {
+	t.Parallel()
+
+	k8s := fake.NewSimpleClientset()
+	source := &SecretSource{Clientset: k8s, Name: "webhook-cert", Namespace: "default"}
+	ctx := context.Background()
+
+	// The secret must exist for the initial certificate.
+	_, err := source.Certificate(ctx, nil)
+	require.EqualError(t, err, "secret default/webhook-cert not found")
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "webhook-cert", Namespace: "default"},
+		Data: map[string][]byte{
+			corev1.TLSCertKey:       []byte("cert-1"),
+			corev1.TLSPrivateKeyKey: []byte("key-1"),
+		},
+		Type: corev1.SecretTypeTLS,
+	}
+	_, err = k8s.CoreV1().Secrets("default").Create(ctx, secret, metav1.CreateOptions{})
+	require.NoError(t, err)
+	_, err = source.Certificate(ctx, nil)
+	require.EqualError(t, err, "secret default/webhook-cert has no ca.crt")
+
+	secret.Data[SecretCAKey] = []byte("ca-1")
+	_, err = k8s.CoreV1().Secrets("default").Update(ctx, secret, metav1.UpdateOptions{})
+	require.NoError(t, err)
+	bundle, err := source.Certificate(ctx, nil)
+	require.NoError(t, err)
+	require.Equal(t, Bundle{Cert: []byte("cert-1"), Key: []byte("key-1"), CACert: []byte("ca-1")}, bundle)
+
+	// Certificate blocks while the secret is unchanged.
+	timeoutCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	_, err = source.Certificate(timeoutCtx, &bundle)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// Certificate returns when the secret is renewed.
+	watching := make(chan struct{}, 1)
+	k8s.PrependWatchReactor("secrets", func(k8stesting.Action) (bool, watch.Interface, error) {
+		select {
+		case watching <- struct{}{}:
+		default:
+		}
+		return false, nil, nil
+	})
+	type result struct {
+		bundle Bundle
+		err    error
+	}
+	resultCh := make(chan result, 1)
+	go func() {
+		next, err := source.Certificate(ctx, &bundle)
+		resultCh <- result{next, err}
+	}()
+	<-watching
+	secret.Data[corev1.TLSCertKey] = []byte("cert-2")
+	_, err = k8s.CoreV1().Secrets("default").Update(ctx, secret, metav1.UpdateOptions{})
+	require.NoError(t, err)
+
+	select {
+	case r := <-resultCh:
+		require.NoError(t, r.err)
+		require.Equal(t, Bundle{Cert: []byte("cert-2"), Key: []byte("key-1"), CACert: []byte("ca-1")}, r.bundle)
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "certificate was not returned after the secret changed")
+	}
+}
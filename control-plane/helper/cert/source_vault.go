@@ -0,0 +1,170 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package cert
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	vaultapi "github.com/hashicorp/vault/api"
+)
+
+// defaultServiceAccountTokenFile is where Kubernetes mounts the service
+// account token that is used to log in with the Vault Kubernetes auth method.
+const defaultServiceAccountTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+// VaultSource issues certificates from a Vault PKI secrets engine, logging in
+// with the Vault Kubernetes auth method.
+//
+// If last is given, Certificate blocks until the certificate is near expiry
+// before issuing a new one.
+type VaultSource struct {
+	// Client is the Vault API client.
+	Client *vaultapi.Client
+	// AuthMethodPath is the path the Kubernetes auth method is mounted at,
+	// e.g. "kubernetes".
+	AuthMethodPath string
+	// Role is the Vault role to log in with. If empty, the token already set
+	// on Client is used instead of logging in.
+	Role string
+	// TokenFile is the service account token file used to log in. Defaults to
+	// the token mounted into the pod.
+	TokenFile string
+
+	// PKIPath is the path the PKI secrets engine is mounted at, e.g. "pki".
+	PKIPath string
+	// PKIRole is the PKI role to issue certificates with.
+	PKIRole string
+
+	// Hosts is the list of hosts to make the leaf valid for. The first host
+	// is used as the common name.
+	Hosts []string
+
+	// TTL is the requested duration that a certificate is valid for. If
+	// zero, the default TTL of the PKI role is used.
+	TTL time.Duration
+
+	// ExpiryWithin is the duration value used for determining whether to
+	// issue a new leaf certificate. If the old leaf certificate is expiring
+	// within this value, then a new leaf will be issued. Default is about
+	// 10% of the certificate's lifetime.
+	ExpiryWithin time.Duration
+}
+
+// Certificate implements Source.
+func (s *VaultSource) Certificate(ctx context.Context, last *Bundle) (Bundle, error) {
+	var result Bundle
+	if len(s.Hosts) == 0 {
+		return result, errors.New("at least one host is required to issue a certificate")
+	}
+
+	if last != nil {
+		cert, err := ParseCert(last.Cert)
+		if err != nil {
+			return result, err
+		}
+		if err := waitForRenewal(ctx, cert, s.expiryWithin(cert.NotAfter.Sub(cert.NotBefore))); err != nil {
+			return result, err
+		}
+	}
+
+	if err := s.login(ctx); err != nil {
+		return result, err
+	}
+
+	var dnsNames, ipAddresses []string
+	for _, host := range s.Hosts[1:] {
+		if net.ParseIP(host) != nil {
+			ipAddresses = append(ipAddresses, host)
+		} else {
+			dnsNames = append(dnsNames, host)
+		}
+	}
+	data := map[string]interface{}{
+		"common_name": s.Hosts[0],
+		"alt_names":   strings.Join(dnsNames, ","),
+		"ip_sans":     strings.Join(ipAddresses, ","),
+	}
+	if s.TTL > 0 {
+		data["ttl"] = s.TTL.String()
+	}
+	path := fmt.Sprintf("%s/issue/%s", strings.Trim(s.PKIPath, "/"), s.PKIRole)
+	resp, err := s.Client.Logical().WriteWithContext(ctx, path, data)
+	if err != nil {
+		return result, fmt.Errorf("issuing certificate from Vault: %w", err)
+	}
+	if resp == nil || resp.Data == nil {
+		return result, errors.New("issuing certificate from Vault: no certificate returned")
+	}
+
+	cert, _ := resp.Data["certificate"].(string)
+	key, _ := resp.Data["private_key"].(string)
+	if cert == "" || key == "" {
+		return result, errors.New("issuing certificate from Vault: no certificate returned")
+	}
+	// The CA chain includes the issuing CA and, if it's an intermediate,
+	// the CAs that issued it.
+	var caCerts []string
+	if chain, ok := resp.Data["ca_chain"].([]interface{}); ok {
+		for _, c := range chain {
+			if c, ok := c.(string); ok {
+				caCerts = append(caCerts, strings.TrimSpace(c))
+			}
+		}
+	}
+	if len(caCerts) == 0 {
+		issuingCA, _ := resp.Data["issuing_ca"].(string)
+		caCerts = append(caCerts, strings.TrimSpace(issuingCA))
+	}
+
+	result.Cert = []byte(strings.TrimSpace(cert) + "\n")
+	result.Key = []byte(strings.TrimSpace(key) + "\n")
+	result.CACert = []byte(strings.Join(caCerts, "\n") + "\n")
+	return result, nil
+}
+
+func (s *VaultSource) expiryWithin(lifetime time.Duration) time.Duration {
+	if s.ExpiryWithin > 0 {
+		return s.ExpiryWithin
+	}
+
+	// Roughly 10% accounting for float errors
+	return time.Duration(float64(lifetime) * 0.10)
+}
+
+// login logs in to Vault with the Kubernetes auth method. Certificates are
+// issued infrequently so this logs in every time rather than keeping the
+// token renewed.
+func (s *VaultSource) login(ctx context.Context) error {
+	if s.Role == "" {
+		return nil
+	}
+
+	tokenFile := s.TokenFile
+	if tokenFile == "" {
+		tokenFile = defaultServiceAccountTokenFile
+	}
+	jwt, err := os.ReadFile(tokenFile)
+	if err != nil {
+		return fmt.Errorf("reading service account token: %w", err)
+	}
+	authPath := strings.Trim(s.AuthMethodPath, "/")
+	resp, err := s.Client.Logical().WriteWithContext(ctx, fmt.Sprintf("auth/%s/login", authPath), map[string]interface{}{
+		"role": s.Role,
+		"jwt":  strings.TrimSpace(string(jwt)),
+	})
+	if err != nil {
+		return fmt.Errorf("logging in to Vault with role %q: %w", s.Role, err)
+	}
+	if resp == nil || resp.Auth == nil || resp.Auth.ClientToken == "" {
+		return fmt.Errorf("logging in to Vault with role %q: no token returned", s.Role)
+	}
+	s.Client.SetToken(resp.Auth.ClientToken)
+	return nil
+}
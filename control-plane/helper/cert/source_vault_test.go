@@ -0,0 +1,110 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package cert
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	vaultapi "github.com/hashicorp/vault/api"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVaultSource(t *testing.T) {
+	t.Parallel()
+
+	signer, _, caPEM, caTemplate, err := GenerateCA("Vault CA")
+	require.NoError(t, err)
+
+	var mu sync.Mutex
+	var issueRequests []map[string]interface{}
+	requests := func() []map[string]interface{} {
+		mu.Lock()
+		defer mu.Unlock()
+		return issueRequests
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/v1/auth/kubernetes/login":
+			if body["role"] != "webhook" || body["jwt"] != "service-account-token" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"auth": map[string]interface{}{"client_token": "vault-token"}})
+		case "/v1/pki_int/issue/webhook":
+			if r.Header.Get("X-Vault-Token") != "vault-token" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			mu.Lock()
+			issueRequests = append(issueRequests, body)
+			mu.Unlock()
+			ttl, err := time.ParseDuration(body["ttl"].(string))
+			require.NoError(t, err)
+			cert, key, err := GenerateCert(body["common_name"].(string), ttl, caTemplate, signer, []string{body["common_name"].(string)})
+			require.NoError(t, err)
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{
+				"certificate": cert,
+				"private_key": key,
+				"issuing_ca":  caPEM,
+				"ca_chain":    []string{caPEM},
+			}})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	client, err := vaultapi.NewClient(&vaultapi.Config{Address: server.URL})
+	require.NoError(t, err)
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("service-account-token\n"), 0600))
+
+	source := &VaultSource{
+		Client:         client,
+		AuthMethodPath: "kubernetes",
+		Role:           "webhook",
+		TokenFile:      tokenFile,
+		PKIPath:        "pki_int",
+		PKIRole:        "webhook",
+		Hosts:          []string{"webhook.consul.svc", "webhook", "127.0.0.1"},
+		TTL:            5 * time.Second,
+		ExpiryWithin:   2 * time.Second,
+	}
+
+	bundle, err := source.Certificate(context.Background(), nil)
+	require.NoError(t, err)
+	require.Equal(t, []map[string]interface{}{{
+		"common_name": "webhook.consul.svc",
+		"alt_names":   "webhook",
+		"ip_sans":     "127.0.0.1",
+		"ttl":         "5s",
+	}}, requests())
+	if hasOpenSSL {
+		testBundleVerify(t, &bundle)
+	}
+
+	// A new certificate is issued near expiry.
+	start := time.Now()
+	next, err := source.Certificate(context.Background(), &bundle)
+	require.NoError(t, err)
+	require.False(t, bundle.Equal(&next))
+	require.True(t, time.Since(start) > time.Second)
+	require.Len(t, requests(), 2)
+
+	// Login errors are returned.
+	source.Role = "other"
+	_, err = source.Certificate(context.Background(), nil)
+	require.ErrorContains(t, err, "logging in to Vault with role \"other\"")
+}
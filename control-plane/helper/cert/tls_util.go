@@ -9,6 +9,7 @@ import (
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
+	"crypto/rsa"
 	"crypto/sha256"
 	"crypto/x509"
 	"crypto/x509/pkix"
@@ -23,18 +24,44 @@ import (
 // NOTE: A lot of this code is taken from
 // https://github.com/hashicorp/consul/blob/44c023a3020fdd139c5be330f318a3c12339f08e/agent/connect/parsing.go.
 
+// KeyAlgorithm is the algorithm and size of generated private keys.
+type KeyAlgorithm string
+
+const (
+	KeyAlgorithmECDSAP256 KeyAlgorithm = "ecdsa-p256"
+	KeyAlgorithmECDSAP384 KeyAlgorithm = "ecdsa-p384"
+	KeyAlgorithmRSA2048   KeyAlgorithm = "rsa-2048"
+	KeyAlgorithmRSA4096   KeyAlgorithm = "rsa-4096"
+
+	DefaultKeyAlgorithm = KeyAlgorithmECDSAP256
+)
+
+// KeyAlgorithms are the supported key algorithms.
+var KeyAlgorithms = []KeyAlgorithm{KeyAlgorithmECDSAP256, KeyAlgorithmECDSAP384, KeyAlgorithmRSA2048, KeyAlgorithmRSA4096}
+
 // GenerateCA generates a CA with the provided
 // common name valid for 10 years. It returns the private key as
 // a crypto.Signer and a PEM string and certificate
 // as a *x509.Certificate and a PEM string or an error.
 func GenerateCA(commonName string) (
+	signer crypto.Signer,
+	keyPem string,
+	caCertPem string,
+	caCertTemplate *x509.Certificate,
+	err error) {
+	return GenerateCAWithKeyAlgorithm(commonName, DefaultKeyAlgorithm)
+}
+
+// GenerateCAWithKeyAlgorithm is like GenerateCA but generates the private
+// key of the CA with the given algorithm.
+func GenerateCAWithKeyAlgorithm(commonName string, alg KeyAlgorithm) (
 	signer crypto.Signer,
 	keyPem string,
 	caCertPem string,
 	caCertTemplate *x509.Certificate,
 	err error) {
 	// Create the private key we'll use for this CA cert.
-	signer, keyPem, err = privateKey()
+	signer, keyPem, err = privateKey(alg)
 	if err != nil {
 		return
 	}
@@ -98,8 +125,20 @@ func GenerateCert(
 	caCert *x509.Certificate,
 	caCertSigner crypto.Signer,
 	hosts []string) (string, string, error) {
+	return GenerateCertWithKeyAlgorithm(commonName, expiry, caCert, caCertSigner, hosts, DefaultKeyAlgorithm)
+}
+
+// GenerateCertWithKeyAlgorithm is like GenerateCert but generates the
+// private key of the certificate with the given algorithm.
+func GenerateCertWithKeyAlgorithm(
+	commonName string,
+	expiry time.Duration,
+	caCert *x509.Certificate,
+	caCertSigner crypto.Signer,
+	hosts []string,
+	alg KeyAlgorithm) (string, string, error) {
 	// Create the private key we'll use for this leaf cert.
-	signer, keyPEM, err := privateKey()
+	signer, keyPEM, err := privateKey(alg)
 	if err != nil {
 		return "", "", err
 	}
@@ -141,6 +180,73 @@ func GenerateCert(
 	return buf.String(), keyPEM, nil
 }
 
+// CrossSign issues a certificate for the CA caCert signed by the CA
+// signingCert. Certificates issued by caCert can then be verified by clients
+// that only trust signingCert. It returns the PEM encoded certificate or an
+// error.
+func CrossSign(
+	caCert *x509.Certificate,
+	signingCert *x509.Certificate,
+	signingCertSigner crypto.Signer) (string, error) {
+	sn, err := serialNumber()
+	if err != nil {
+		return "", err
+	}
+
+	// The cross-signed certificate can't outlive the signing CA.
+	notAfter := caCert.NotAfter
+	if signingCert.NotAfter.Before(notAfter) {
+		notAfter = signingCert.NotAfter
+	}
+	template := x509.Certificate{
+		SerialNumber:          sn,
+		Subject:               caCert.Subject,
+		BasicConstraintsValid: true,
+		KeyUsage:              caCert.KeyUsage,
+		ExtKeyUsage:           caCert.ExtKeyUsage,
+		IsCA:                  true,
+		NotAfter:              notAfter,
+		NotBefore:             time.Now().Add(-1 * time.Minute),
+		AuthorityKeyId:        signingCert.SubjectKeyId,
+		SubjectKeyId:          caCert.SubjectKeyId,
+	}
+	bs, err := x509.CreateCertificate(
+		rand.Reader, &template, signingCert, caCert.PublicKey, signingCertSigner)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	err = pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: bs})
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// ParseCerts parses all x509 certificates from a PEM-encoded bundle.
+func ParseCerts(pemValue []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, pemValue = pem.Decode(pemValue)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			return nil, fmt.Errorf("unexpected PEM block type %q in certificate bundle", block.Type)
+		}
+		c, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, c)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no PEM-encoded data found")
+	}
+	return certs, nil
+}
+
 // ParseCert parses the x509 certificate from a PEM-encoded value.
 func ParseCert(pemValue []byte) (*x509.Certificate, error) {
 	// The _ result below is not an error but the remaining PEM bytes.
@@ -189,26 +295,49 @@ func ParseSigner(pemValue string) (crypto.Signer, error) {
 	}
 }
 
-// privateKey returns a new ECDSA-based private key. Both a crypto.Signer
-// and the key in PEM format are returned.
-func privateKey() (crypto.Signer, string, error) {
-	pk, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
-	if err != nil {
-		return nil, "", err
-	}
-
-	bs, err := x509.MarshalECPrivateKey(pk)
-	if err != nil {
-		return nil, "", err
+// privateKey returns a new private key generated with the given algorithm.
+// Both a crypto.Signer and the key in PEM format are returned.
+func privateKey(alg KeyAlgorithm) (crypto.Signer, string, error) {
+	var (
+		signer crypto.Signer
+		block  *pem.Block
+	)
+	switch alg {
+	case KeyAlgorithmECDSAP256, KeyAlgorithmECDSAP384:
+		curve := elliptic.P256()
+		if alg == KeyAlgorithmECDSAP384 {
+			curve = elliptic.P384()
+		}
+		pk, err := ecdsa.GenerateKey(curve, rand.Reader)
+		if err != nil {
+			return nil, "", err
+		}
+		bs, err := x509.MarshalECPrivateKey(pk)
+		if err != nil {
+			return nil, "", err
+		}
+		signer, block = pk, &pem.Block{Type: "EC PRIVATE KEY", Bytes: bs}
+	case KeyAlgorithmRSA2048, KeyAlgorithmRSA4096:
+		bits := 2048
+		if alg == KeyAlgorithmRSA4096 {
+			bits = 4096
+		}
+		pk, err := rsa.GenerateKey(rand.Reader, bits)
+		if err != nil {
+			return nil, "", err
+		}
+		signer, block = pk, &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(pk)}
+	default:
+		return nil, "", fmt.Errorf("unsupported key algorithm %q", alg)
 	}
 
 	var buf bytes.Buffer
-	err = pem.Encode(&buf, &pem.Block{Type: "EC PRIVATE KEY", Bytes: bs})
+	err := pem.Encode(&buf, block)
 	if err != nil {
 		return nil, "", err
 	}
 
-	return pk, buf.String(), nil
+	return signer, buf.String(), nil
 }
 
 // serialNumber generates a new random serial number.
@@ -217,10 +346,10 @@ func serialNumber() (*big.Int, error) {
 }
 
 // keyId returns a x509 keyId from the given signing key. The key must be
-// an *ecdsa.PublicKey currently, but may support more types in the future.
+// an *ecdsa.PublicKey or *rsa.PublicKey.
 func keyId(raw interface{}) ([]byte, error) {
 	switch raw.(type) {
-	case *ecdsa.PublicKey:
+	case *ecdsa.PublicKey, *rsa.PublicKey:
 	default:
 		return nil, fmt.Errorf("invalid key type: %T", raw)
 	}
@@ -4,7 +4,15 @@
 package test
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
 	"fmt"
+	"math/big"
 	"net"
 	"net/http"
 	"net/http/httptest"
@@ -122,6 +130,30 @@ func GenerateServerCerts(t *testing.T) (string, string, string) {
 	return caFile.Name(), certFile.Name(), certKeyFile.Name()
 }
 
+// GenerateIntermediateCA generates an intermediate CA signed by the given
+// CA with the permitted DNS domain name constraints. It returns the PEM
+// encoded certificate and private key.
+func GenerateIntermediateCA(t *testing.T, caCert *x509.Certificate, caSigner crypto.Signer, permittedDNSDomains []string) (string, string) {
+	signer, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: "Consul Agent Intermediate CA - Test"},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		NotBefore:             time.Now().Add(-1 * time.Minute),
+		NotAfter:              time.Now().Add(365 * 24 * time.Hour),
+		PermittedDNSDomains:   permittedDNSDomains,
+	}
+	bs, err := x509.CreateCertificate(rand.Reader, template, caCert, signer.Public(), caSigner)
+	require.NoError(t, err)
+	key, err := x509.MarshalECPrivateKey(signer)
+	require.NoError(t, err)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: bs})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: key}))
+}
+
 // SetupK8sComponentAuthMethod creates a k8s auth method, sample "acl:write" ACL policy, Role and BindingRule
 // that allows a client using serviceAccount's JWT token to call "consul login".
 func SetupK8sComponentAuthMethod(t *testing.T, consulClient *api.Client, serviceAccountName, k8sComponentNS string) {
@@ -0,0 +1,172 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package configvalidate
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"sync"
+
+	"github.com/hashicorp/consul-k8s/control-plane/api/common"
+	"github.com/hashicorp/consul-k8s/control-plane/api/validate"
+	"github.com/hashicorp/consul-k8s/control-plane/subcommand/flags"
+	"github.com/mitchellh/cli"
+)
+
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+// Command validates Consul custom resource manifests without a Kubernetes cluster.
+type Command struct {
+	UI cli.Ui
+
+	flagSet *flag.FlagSet
+
+	flagFiles                      []string
+	flagNamespace                  string
+	flagEnablePartitions           bool
+	flagPartition                  string
+	flagEnableNamespaces           bool
+	flagConsulDestinationNamespace string
+	flagEnableK8SNSMirroring       bool
+	flagK8SNSMirroringPrefix       string
+	flagOutput                     string
+
+	once sync.Once
+	help string
+}
+
+// result is the JSON output of the command.
+type result struct {
+	Resources int                `json:"resources"`
+	Problems  []validate.Problem `json:"problems"`
+}
+
+func (c *Command) init() {
+	c.flagSet = flag.NewFlagSet("", flag.ContinueOnError)
+	c.flagSet.Var((*flags.AppendSliceValue)(&c.flagFiles), "f",
+		"Path to a file or directory with the manifests to validate. Directories are read recursively for "+
+			".yaml, .yml and .json files. May be specified multiple times; all the resources are validated as one set.")
+	c.flagSet.StringVar(&c.flagNamespace, "namespace", "default",
+		"Kubernetes namespace of the resources that don't set one.")
+	c.flagSet.BoolVar(&c.flagEnablePartitions, "enable-partitions", false,
+		"[Enterprise Only] Validate the resources for an installation with Admin Partitions enabled.")
+	c.flagSet.StringVar(&c.flagPartition, "partition", "",
+		"[Enterprise Only] Name of the Admin Partition the resources are written to.")
+	c.flagSet.BoolVar(&c.flagEnableNamespaces, "enable-namespaces", false,
+		"[Enterprise Only] Validate the resources for an installation with namespaces enabled.")
+	c.flagSet.StringVar(&c.flagConsulDestinationNamespace, "consul-destination-namespace", "default",
+		"[Enterprise Only] Consul namespace the resources are written to. If '-enable-k8s-namespace-mirroring' "+
+			"is true, this is not used.")
+	c.flagSet.BoolVar(&c.flagEnableK8SNSMirroring, "enable-k8s-namespace-mirroring", false,
+		"[Enterprise Only] Validate the resources for an installation with k8s namespace mirroring enabled.")
+	c.flagSet.StringVar(&c.flagK8SNSMirroringPrefix, "k8s-namespace-mirroring-prefix", "",
+		"[Enterprise Only] Prefix that is added to all k8s namespaces mirrored into Consul if mirroring is enabled.")
+	c.flagSet.StringVar(&c.flagOutput, "output", outputText,
+		fmt.Sprintf("Output format, one of %q or %q.", outputText, outputJSON))
+
+	c.help = flags.Usage(help, c.flagSet)
+}
+
+// Run validates the manifests. It returns 1 if any of them has errors;
+// warnings are printed but don't fail validation.
+func (c *Command) Run(args []string) int {
+	c.once.Do(c.init)
+
+	if err := c.flagSet.Parse(args); err != nil {
+		c.UI.Error(fmt.Sprintf("Error parsing flags: %s", err))
+		return 1
+	}
+	if len(c.flagFiles) == 0 {
+		c.UI.Error("-f must be set")
+		return 1
+	}
+	if c.flagOutput != outputText && c.flagOutput != outputJSON {
+		c.UI.Error(fmt.Sprintf("-output must be one of %q or %q", outputText, outputJSON))
+		return 1
+	}
+
+	resources, problems, err := validate.Load(c.flagFiles, c.flagNamespace)
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Error reading manifests: %s", err))
+		return 1
+	}
+	problems = append(problems, validate.Validate(resources, c.consulMeta())...)
+	validate.SortProblems(problems)
+
+	if c.flagOutput == outputJSON {
+		if problems == nil {
+			problems = []validate.Problem{}
+		}
+		out, err := json.MarshalIndent(result{Resources: len(resources), Problems: problems}, "", "  ")
+		if err != nil {
+			c.UI.Error(fmt.Sprintf("Error marshaling problems: %s", err))
+			return 1
+		}
+		c.UI.Output(string(out))
+	} else {
+		for _, p := range problems {
+			if p.Severity == validate.SeverityError {
+				c.UI.Error(p.String())
+			} else {
+				c.UI.Warn(p.String())
+			}
+		}
+		if !validate.HasErrors(problems) {
+			c.UI.Output(fmt.Sprintf("%d Consul resources are valid", len(resources)))
+		}
+	}
+
+	if validate.HasErrors(problems) {
+		return 1
+	}
+	return 0
+}
+
+// consulMeta returns the settings of the Consul installation the resources
+// are validated for.
+func (c *Command) consulMeta() common.ConsulMeta {
+	partition := c.flagPartition
+	if c.flagEnablePartitions && partition == "" {
+		partition = "default"
+	}
+	return common.ConsulMeta{
+		PartitionsEnabled:    c.flagEnablePartitions,
+		Partition:            partition,
+		NamespacesEnabled:    c.flagEnableNamespaces,
+		DestinationNamespace: c.flagConsulDestinationNamespace,
+		Mirroring:            c.flagEnableK8SNSMirroring,
+		Prefix:               c.flagK8SNSMirroringPrefix,
+	}
+}
+
+// Synopsis returns the summary of the config validate command.
+func (c *Command) Synopsis() string { return synopsis }
+
+// Help returns the help output of the command.
+func (c *Command) Help() string {
+	c.once.Do(c.init)
+	return c.help
+}
+
+const synopsis = "Validate Consul custom resource manifests."
+const help = `
+Usage: consul-k8s-control-plane config validate -f <path> [options]
+
+  Validates the Consul custom resources in Kubernetes manifests the same way
+  the admission webhooks do, without a Kubernetes cluster. Resources are
+  defaulted and validated for the Consul installation described by the
+  options, then checked against each other: duplicate resources and
+  intentions destinations, singleton resources, the protocol required by
+  routers, splitters and L7 intentions, and the service subsets they
+  reference.
+
+  Problems are printed with the file and line of the field they refer to.
+  References to resources that aren't in the manifests are warnings, since
+  they may already exist in the cluster. The command exits with 1 if there
+  are any errors.
+`
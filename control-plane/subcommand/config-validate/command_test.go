@@ -0,0 +1,107 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package configvalidate
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/consul-k8s/control-plane/api/validate"
+	"github.com/mitchellh/cli"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun_FlagValidation(t *testing.T) {
+	cases := []struct {
+		args   []string
+		expErr string
+	}{
+		{
+			args:   []string{},
+			expErr: "-f must be set",
+		},
+		{
+			args:   []string{"-f", "testdata/valid", "-output", "yaml"},
+			expErr: `-output must be one of "text" or "json"`,
+		},
+		{
+			args:   []string{"-f", "testdata/does-not-exist.yaml"},
+			expErr: "Error reading manifests",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.expErr, func(t *testing.T) {
+			ui := cli.NewMockUi()
+			cmd := Command{UI: ui}
+			code := cmd.Run(c.args)
+			require.Equal(t, 1, code)
+			require.Contains(t, ui.ErrorWriter.String(), c.expErr)
+		})
+	}
+}
+
+func TestRun_Valid(t *testing.T) {
+	ui := cli.NewMockUi()
+	cmd := Command{UI: ui}
+	code := cmd.Run([]string{"-f", "testdata/valid"})
+	require.Equal(t, 0, code, ui.ErrorWriter.String())
+	require.Equal(t, "4 Consul resources are valid\n", ui.OutputWriter.String())
+	require.Empty(t, ui.ErrorWriter.String())
+}
+
+func TestRun_Invalid(t *testing.T) {
+	ui := cli.NewMockUi()
+	cmd := Command{UI: ui}
+	code := cmd.Run([]string{"-f", "testdata/invalid.yaml"})
+	require.Equal(t, 1, code)
+	require.Empty(t, ui.OutputWriter.String())
+	require.Equal(t, `testdata/invalid.yaml:8: error: ServiceRouter/web: ServiceRouter requires service "web" to have protocol http, http2 or grpc, but ServiceDefaults/web at testdata/invalid.yaml:1 sets it to "tcp"
+testdata/invalid.yaml:16: warning: ServiceRouter/web: spec.routes[0].destination.serviceSubset: service subset "v2" of service "api" can't be checked, there is no ServiceResolver for the service in the set
+`, ui.ErrorWriter.String())
+}
+
+func TestRun_JSON(t *testing.T) {
+	ui := cli.NewMockUi()
+	cmd := Command{UI: ui}
+	code := cmd.Run([]string{"-f", "testdata/invalid.yaml", "-output", "json"})
+	require.Equal(t, 1, code)
+
+	var out result
+	require.NoError(t, json.Unmarshal(ui.OutputWriter.Bytes(), &out))
+	require.Equal(t, 2, out.Resources)
+	require.Len(t, out.Problems, 2)
+	require.Equal(t, validate.SeverityError, out.Problems[0].Severity)
+	require.Equal(t, validate.Problem{
+		File:     "testdata/invalid.yaml",
+		Line:     16,
+		Kind:     "ServiceRouter",
+		Name:     "web",
+		Field:    "spec.routes[0].destination.serviceSubset",
+		Severity: validate.SeverityWarning,
+		Message:  `service subset "v2" of service "api" can't be checked, there is no ServiceResolver for the service in the set`,
+	}, out.Problems[1])
+}
+
+func TestRun_MultipleFiles(t *testing.T) {
+	ui := cli.NewMockUi()
+	cmd := Command{UI: ui}
+	code := cmd.Run([]string{"-f", "testdata/invalid.yaml", "-f", "testdata/valid", "-output", "json"})
+	require.Equal(t, 1, code)
+
+	var out result
+	require.NoError(t, json.Unmarshal(ui.OutputWriter.Bytes(), &out))
+	require.Equal(t, 6, out.Resources)
+	// The files are validated as one set, so their resources are duplicates.
+	var duplicates []string
+	for _, p := range out.Problems {
+		if strings.HasPrefix(p.Message, "duplicate resource") {
+			duplicates = append(duplicates, p.Message)
+		}
+	}
+	require.Equal(t, []string{
+		"duplicate resource, already defined at testdata/invalid.yaml:1",
+		"duplicate resource, already defined at testdata/invalid.yaml:8",
+	}, duplicates)
+}
@@ -17,6 +17,7 @@ import (
 	"time"
 
 	"github.com/cenkalti/backoff"
+	"github.com/hashicorp/consul-k8s/control-plane/cni/nftables"
 	"github.com/hashicorp/consul-k8s/control-plane/connect-inject/constants"
 	"github.com/hashicorp/consul-k8s/control-plane/consul"
 	"github.com/hashicorp/consul-k8s/control-plane/namespaces"
@@ -47,6 +48,7 @@ type Command struct {
 	flagServiceName           string // Service name.
 	flagGatewayKind           string
 	flagRedirectTrafficConfig string
+	flagRedirectBackend       string
 	flagLogLevel              string
 	flagLogJSON               bool
 
@@ -82,6 +84,9 @@ func (c *Command) init() {
 	c.flagSet.BoolVar(&c.flagMultiPort, "multiport", false, "If the pod is a multi port pod.")
 	c.flagSet.StringVar(&c.flagGatewayKind, "gateway-kind", "", "Kind of gateway that is being registered: ingress-gateway, terminating-gateway, or mesh-gateway.")
 	c.flagSet.StringVar(&c.flagRedirectTrafficConfig, "redirect-traffic-config", os.Getenv("CONSUL_REDIRECT_TRAFFIC_CONFIG"), "Config (in JSON format) to configure iptables for this pod.")
+	c.flagSet.StringVar(&c.flagRedirectBackend, "redirect-backend", nftables.BackendAuto,
+		"Backend that applies the traffic redirection rules: \"iptables\", \"nftables\" or \"auto\", which "+
+			"uses nftables if the iptables binary is missing or is the legacy variant on a node whose rules are in nftables.")
 	c.flagSet.StringVar(&c.flagLogLevel, "log-level", "info",
 		"Log verbosity level. Supported values (in order of detail) are \"trace\", "+
 			"\"debug\", \"info\", \"warn\", and \"error\".")
@@ -352,6 +357,12 @@ func (c *Command) validateFlags() error {
 	if c.flagConsulNodeName == "" {
 		return errors.New("-consul-node-name must be set")
 	}
+	switch c.flagRedirectBackend {
+	case nftables.BackendAuto, nftables.BackendIptables, nftables.BackendNftables:
+	default:
+		return fmt.Errorf("-redirect-backend must be one of %q, %q or %q",
+			nftables.BackendAuto, nftables.BackendIptables, nftables.BackendNftables)
+	}
 
 	return nil
 }
@@ -380,6 +391,15 @@ func (c *Command) applyTrafficRedirectionRules(svc *api.AgentService) error {
 	}
 	if c.iptablesProvider != nil {
 		c.iptablesConfig.IptablesProvider = c.iptablesProvider
+	} else {
+		backend, err := nftables.Resolve(c.flagRedirectBackend, nftables.CommandExecutor{})
+		if err != nil {
+			return err
+		}
+		c.logger.Info("Using traffic redirection backend", "backend", backend)
+		if backend == nftables.BackendNftables {
+			c.iptablesConfig.IptablesProvider = nftables.NewProvider(c.iptablesConfig.NetNS, nftables.CommandExecutor{})
+		}
 	}
 
 	if svc.Proxy.TransparentProxy != nil && svc.Proxy.TransparentProxy.OutboundListenerPort != 0 {
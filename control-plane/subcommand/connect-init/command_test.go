@@ -63,6 +63,15 @@ func TestRun_FlagValidation(t *testing.T) {
 			},
 			expErr: "unknown log level: invalid",
 		},
+		{
+			flags: []string{
+				"-pod-name", testPodName,
+				"-pod-namespace", testPodNamespace,
+				"-consul-node-name", "bar",
+				"-redirect-backend", "ipfw",
+			},
+			expErr: `-redirect-backend must be one of "auto", "iptables" or "nftables"`,
+		},
 	}
 	for _, c := range cases {
 		t.Run(c.expErr, func(t *testing.T) {
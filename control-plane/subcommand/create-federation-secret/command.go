@@ -9,12 +9,19 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"sort"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/cenkalti/backoff"
+	"github.com/fsnotify/fsnotify"
 	"github.com/hashicorp/consul-k8s/control-plane/consul"
 	"github.com/hashicorp/consul-k8s/control-plane/subcommand"
 	"github.com/hashicorp/consul-k8s/control-plane/subcommand/common"
@@ -26,6 +33,7 @@ import (
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
 )
 
 const (
@@ -34,6 +42,14 @@ const (
 	fedSecretCAKeyKey            = "caKey"
 	fedSecretServerConfigKey     = "serverConfigJSON"
 	fedSecretReplicationTokenKey = "replicationToken"
+
+	// secondaryKubeconfigKey is the key in the secondary kubeconfig secrets
+	// that holds the kubeconfig.
+	secondaryKubeconfigKey = "kubeconfig"
+
+	// blockingQueryWaitTime is the maximum time a blocking query to Consul
+	// waits for a change in watch mode.
+	blockingQueryWaitTime = 1 * time.Minute
 )
 
 var retryInterval = 1 * time.Second
@@ -65,12 +81,28 @@ type Command struct {
 	flagLogJSON                bool
 	flagMeshGatewayServiceName string
 
+	// flagWatch keeps the command running after the secret is created and
+	// updates the secret whenever its data changes.
+	flagWatch          bool
+	flagResyncInterval time.Duration
+
+	// flagSecondaryKubeconfigSecrets are the names of secrets containing
+	// kubeconfigs for the Kubernetes clusters of secondary datacenters. The
+	// federation secret is also created in each of those clusters.
+	flagSecondaryKubeconfigSecrets []string
+	flagSecondaryK8sNamespace      string
+
 	k8sClient    kubernetes.Interface
 	consulClient *api.Client
 
-	once sync.Once
-	help string
-	ctx  context.Context
+	// secondaryClient creates a Kubernetes client for a secondary cluster
+	// from a kubeconfig. It's only set in tests.
+	secondaryClient func(kubeconfig []byte) (kubernetes.Interface, error)
+
+	once  sync.Once
+	help  string
+	ctx   context.Context
+	sigCh chan os.Signal
 }
 
 func (c *Command) init() {
@@ -96,6 +128,18 @@ func (c *Command) init() {
 			"\"debug\", \"info\", \"warn\", and \"error\".")
 	c.flags.BoolVar(&c.flagLogJSON, "log-json", false,
 		"Enable or disable JSON output format for logging.")
+	c.flags.BoolVar(&c.flagWatch, "watch", false,
+		"Keep running after the secret is created and update it whenever the mesh gateway addresses, "+
+			"the server CA, the gossip encryption key or the replication token change.")
+	c.flags.DurationVar(&c.flagResyncInterval, "resync-interval", 1*time.Minute,
+		"How often to re-read the secret data in watch mode in addition to watching Consul for changes.")
+	c.flags.Var((*flags.AppendSliceValue)(&c.flagSecondaryKubeconfigSecrets), "secondary-kubeconfig-secret",
+		"Name of a Kubernetes secret in -k8s-namespace with a kubeconfig for the Kubernetes cluster of a "+
+			fmt.Sprintf("secondary datacenter under the key %q. The federation secret is also created or ", secondaryKubeconfigKey)+
+			"updated in that cluster. May be specified multiple times.")
+	c.flags.StringVar(&c.flagSecondaryK8sNamespace, "secondary-k8s-namespace", "",
+		"Name of the Kubernetes namespace to create the federation secret in for secondary clusters. "+
+			"Defaults to -k8s-namespace.")
 
 	c.http = &flags.HTTPFlags{}
 	c.k8s = &flags.K8SFlags{}
@@ -125,53 +169,14 @@ func (c *Command) Run(args []string) int {
 		c.ctx = context.Background()
 	}
 
-	// The initial secret struct. We will be filling in its data map
-	// as we continue.
-	federationSecret := &corev1.Secret{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      fmt.Sprintf("%s-federation", c.flagResourcePrefix),
-			Namespace: c.flagK8sNamespace,
-			Labels:    map[string]string{common.CLILabelKey: common.CLILabelValue},
-		},
-		Type: "Opaque",
-		Data: make(map[string][]byte),
-	}
-
-	// Add gossip encryption key if it exists.
-	if c.flagGossipKeyFile != "" {
-		logger.Info("Retrieving gossip encryption key data")
-		gossipKey, err := os.ReadFile(c.flagGossipKeyFile)
-		if err != nil {
-			c.UI.Error(fmt.Sprintf("Error reading gossip encryption key file: %s", err))
-			return 1
-		}
-		if len(gossipKey) == 0 {
-			c.UI.Error(fmt.Sprintf("gossip key file %q was empty", c.flagGossipKeyFile))
-			return 1
-		}
-		federationSecret.Data[fedSecretGossipKey] = gossipKey
-		logger.Info("Gossip encryption key retrieved successfully")
-	}
-
-	// Add server CA cert.
-	logger.Info("Retrieving server CA cert data")
-	caCert, err := os.ReadFile(c.flagServerCACertFile)
-	if err != nil {
-		c.UI.Error(fmt.Sprintf("Error reading server CA cert file: %s", err))
-		return 1
-	}
-	federationSecret.Data[fedSecretCACertKey] = caCert
-	logger.Info("Server CA cert retrieved successfully")
-
-	// Add server CA key.
-	logger.Info("Retrieving server CA key data")
-	caKey, err := os.ReadFile(c.flagServerCAKeyFile)
+	// Read the data from files first so that we fail fast if they're missing.
+	logger.Info("Retrieving server CA and gossip encryption key data")
+	data, err := c.fileData()
 	if err != nil {
-		c.UI.Error(fmt.Sprintf("Error reading server CA key file: %s", err))
+		c.UI.Error(err.Error())
 		return 1
 	}
-	federationSecret.Data[fedSecretCAKeyKey] = caKey
-	logger.Info("Server CA key retrieved successfully")
+	logger.Info("Server CA and gossip encryption key retrieved successfully")
 
 	// Create the Kubernetes clientset.
 	if c.k8sClient == nil {
@@ -196,7 +201,7 @@ func (c *Command) Run(args []string) int {
 			logger.Error("error retrieving replication token", "err", err)
 			return 1
 		}
-		federationSecret.Data[fedSecretReplicationTokenKey] = replicationToken
+		data[fedSecretReplicationTokenKey] = replicationToken
 	}
 
 	// Set up Consul client because we need to make calls to Consul to retrieve
@@ -212,6 +217,11 @@ func (c *Command) Run(args []string) int {
 		// variable will be set to the IP of the Consul client pod on the same
 		// node.
 		c.http.MergeOntoConfig(cfg)
+		// Blocking queries in watch mode take up to blockingQueryWaitTime so
+		// the HTTP client can't time out before then.
+		if c.flagWatch {
+			cfg.HttpClient = &http.Client{Timeout: blockingQueryWaitTime + c.http.ConsulAPITimeout()}
+		}
 
 		var err error
 		c.consulClient, err = consul.NewClient(cfg, c.http.ConsulAPITimeout())
@@ -229,7 +239,7 @@ func (c *Command) Run(args []string) int {
 
 	// Get the mesh gateway addresses.
 	logger.Info("Retrieving mesh gateway addresses from Consul")
-	meshGWAddrs, err := c.meshGatewayAddrs(logger)
+	meshGWAddrs, err := c.waitForMeshGatewayAddrs(logger)
 	if err != nil {
 		logger.Error("Error looking up mesh gateways", "err", err)
 		return 1
@@ -243,22 +253,18 @@ func (c *Command) Run(args []string) int {
 		logger.Error("Unable to create server config json", "err", err)
 		return 1
 	}
-	federationSecret.Data[fedSecretServerConfigKey] = serverCfg
+	data[fedSecretServerConfigKey] = serverCfg
 
 	// Now create the Kubernetes secret.
-	logger.Info("Creating/updating Kubernetes secret", "name", federationSecret.ObjectMeta.Name, "ns", c.flagK8sNamespace)
-	_, err = c.k8sClient.CoreV1().Secrets(c.flagK8sNamespace).Create(c.ctx, federationSecret, metav1.CreateOptions{})
-	if k8serrors.IsAlreadyExists(err) {
-		logger.Info("Secret already exists, updating instead")
-		_, err = c.k8sClient.CoreV1().Secrets(c.flagK8sNamespace).Update(c.ctx, federationSecret, metav1.UpdateOptions{})
-	}
-
-	if err != nil {
+	if err := c.writeSecret(logger, data); err != nil {
 		logger.Error("Error creating/updating federation secret", "err", err)
 		return 1
 	}
-	logger.Info("Successfully created/updated federation secret", "name", federationSecret.ObjectMeta.Name, "ns", c.flagK8sNamespace)
-	return 0
+
+	if !c.flagWatch {
+		return 0
+	}
+	return c.watch(logger, datacenter, data)
 }
 
 func (c *Command) validateFlags(args []string) error {
@@ -289,13 +295,338 @@ func (c *Command) validateFlags(args []string) error {
 	if c.http.ConsulAPITimeout() <= 0 {
 		return errors.New("-consul-api-timeout must be set to a value greater than 0")
 	}
+	if c.flagWatch && c.flagResyncInterval <= 0 {
+		return errors.New("-resync-interval must be set to a value greater than 0")
+	}
 	return nil
 }
 
+// fileData returns the secret data that's read from files: the gossip
+// encryption key, if set, and the server CA cert and key.
+func (c *Command) fileData() (map[string][]byte, error) {
+	data := make(map[string][]byte)
+
+	// Add gossip encryption key if it exists.
+	if c.flagGossipKeyFile != "" {
+		gossipKey, err := os.ReadFile(c.flagGossipKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading gossip encryption key file: %s", err)
+		}
+		if len(gossipKey) == 0 {
+			return nil, fmt.Errorf("gossip key file %q was empty", c.flagGossipKeyFile)
+		}
+		data[fedSecretGossipKey] = gossipKey
+	}
+
+	caCert, err := os.ReadFile(c.flagServerCACertFile)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading server CA cert file: %s", err)
+	}
+	data[fedSecretCACertKey] = caCert
+
+	caKey, err := os.ReadFile(c.flagServerCAKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading server CA key file: %s", err)
+	}
+	data[fedSecretCAKeyKey] = caKey
+	return data, nil
+}
+
+// writeSecret creates or updates the federation secret with the data in this
+// cluster and in the clusters of the secondary datacenters.
+func (c *Command) writeSecret(logger hclog.Logger, data map[string][]byte) error {
+	name := fmt.Sprintf("%s-federation", c.flagResourcePrefix)
+	logger.Info("Creating/updating Kubernetes secret", "name", name, "ns", c.flagK8sNamespace)
+	if err := c.createOrUpdateSecret(c.k8sClient, c.flagK8sNamespace, data); err != nil {
+		return err
+	}
+	logger.Info("Successfully created/updated federation secret", "name", name, "ns", c.flagK8sNamespace)
+
+	namespace := c.flagSecondaryK8sNamespace
+	if namespace == "" {
+		namespace = c.flagK8sNamespace
+	}
+	for _, kubeconfigSecret := range c.flagSecondaryKubeconfigSecrets {
+		client, err := c.secondaryK8sClient(kubeconfigSecret)
+		if err != nil {
+			return err
+		}
+		if err := c.createOrUpdateSecret(client, namespace, data); err != nil {
+			return fmt.Errorf("creating/updating federation secret with kubeconfig from secret %q: %w", kubeconfigSecret, err)
+		}
+		logger.Info("Successfully created/updated federation secret in secondary cluster",
+			"name", name, "ns", namespace, "kubeconfig-secret", kubeconfigSecret)
+	}
+	return nil
+}
+
+// createOrUpdateSecret creates the federation secret with the data in the
+// namespace or updates it if it already exists.
+func (c *Command) createOrUpdateSecret(client kubernetes.Interface, namespace string, data map[string][]byte) error {
+	federationSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s-federation", c.flagResourcePrefix),
+			Namespace: namespace,
+			Labels:    map[string]string{common.CLILabelKey: common.CLILabelValue},
+		},
+		Type: "Opaque",
+		Data: data,
+	}
+	_, err := client.CoreV1().Secrets(namespace).Create(c.ctx, federationSecret, metav1.CreateOptions{})
+	if k8serrors.IsAlreadyExists(err) {
+		_, err = client.CoreV1().Secrets(namespace).Update(c.ctx, federationSecret, metav1.UpdateOptions{})
+	}
+	return err
+}
+
+// secondaryK8sClient returns a Kubernetes client for a secondary cluster
+// using the kubeconfig in the named secret.
+func (c *Command) secondaryK8sClient(kubeconfigSecret string) (kubernetes.Interface, error) {
+	secret, err := c.k8sClient.CoreV1().Secrets(c.flagK8sNamespace).Get(c.ctx, kubeconfigSecret, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("reading kubeconfig secret %q: %w", kubeconfigSecret, err)
+	}
+	kubeconfig, ok := secret.Data[secondaryKubeconfigKey]
+	if !ok {
+		return nil, fmt.Errorf("expected key '%s' in secret %s not set", secondaryKubeconfigKey, kubeconfigSecret)
+	}
+	if c.secondaryClient != nil {
+		return c.secondaryClient(kubeconfig)
+	}
+	cfg, err := clientcmd.RESTConfigFromKubeConfig(kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("parsing kubeconfig from secret %q: %w", kubeconfigSecret, err)
+	}
+	return kubernetes.NewForConfig(cfg)
+}
+
+// watch keeps the federation secret up to date until the command is
+// interrupted. It regenerates the secret data whenever the health of the mesh
+// gateways changes in Consul, whenever the server CA or gossip encryption key
+// files change, and every resync interval to pick up changes to the
+// replication token secret.
+func (c *Command) watch(logger hclog.Logger, datacenter string, current map[string][]byte) int {
+	ctx, cancel := context.WithCancel(c.ctx)
+	defer cancel()
+
+	// Wait on an interrupt or terminate to exit. This is only done in watch
+	// mode so that signals still stop the command while it's creating the
+	// secret.
+	if c.sigCh == nil {
+		c.sigCh = make(chan os.Signal, 1)
+		signal.Notify(c.sigCh, syscall.SIGINT, syscall.SIGTERM)
+		defer signal.Stop(c.sigCh)
+	}
+
+	changeCh := make(chan struct{}, 1)
+	notify := func() {
+		select {
+		case changeCh <- struct{}{}:
+		default:
+		}
+	}
+	go c.watchIndex(ctx, logger, "mesh gateway health", func(opts *api.QueryOptions) (uint64, error) {
+		_, meta, err := c.consulClient.Health().Service(c.flagMeshGatewayServiceName, "", false, opts)
+		if err != nil {
+			return 0, err
+		}
+		return meta.LastIndex, nil
+	}, notify)
+	go c.watchFiles(ctx, logger, notify)
+
+	ticker := time.NewTicker(c.flagResyncInterval)
+	defer ticker.Stop()
+
+	logger.Info("Watching for changes to the federation secret data")
+	for {
+		select {
+		case <-changeCh:
+		case <-ticker.C:
+		case sig := <-c.sigCh:
+			logger.Info(fmt.Sprintf("%s received, shutting down", sig))
+			return 0
+		case <-ctx.Done():
+			return 0
+		}
+
+		data, err := c.secretData(logger, datacenter, current)
+		if err != nil {
+			logger.Error("Error retrieving federation secret data, will retry", "err", err)
+			continue
+		}
+		if reflect.DeepEqual(data, current) {
+			continue
+		}
+		logger.Info("Federation secret data changed")
+		if err := c.writeSecret(logger, data); err != nil {
+			// Keep the old data so that the write is retried on the next
+			// change or resync.
+			logger.Error("Error creating/updating federation secret, will retry", "err", err)
+			continue
+		}
+		current = data
+	}
+}
+
+// watchIndex runs the blocking query until the context is cancelled and calls
+// notify whenever the index it returns changes.
+func (c *Command) watchIndex(ctx context.Context, logger hclog.Logger, name string, query func(*api.QueryOptions) (uint64, error), notify func()) {
+	var index uint64
+	for {
+		opts := &api.QueryOptions{WaitIndex: index, WaitTime: blockingQueryWaitTime}
+		newIndex, err := query(opts.WithContext(ctx))
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			logger.Error("Error watching Consul, retrying", "watch", name, "err", err)
+			select {
+			case <-time.After(retryInterval):
+			case <-ctx.Done():
+				return
+			}
+			continue
+		}
+		// The first query returns the current state which the secret was
+		// already created with.
+		if index != 0 && newIndex != index {
+			notify()
+		}
+		// Reset the index if it goes backwards so that the next query doesn't
+		// block on an index that will never be reached, and never block on
+		// index zero because that returns immediately.
+		if newIndex < index || newIndex == 0 {
+			newIndex = 1
+		}
+		index = newIndex
+	}
+}
+
+// watchFiles calls notify whenever the server CA or gossip encryption key
+// files change, until the context is cancelled. The directories are watched
+// rather than the files because mounted secrets are updated by replacing a
+// symlink. If the watch can't be set up, changes are still picked up on
+// resync.
+func (c *Command) watchFiles(ctx context.Context, logger hclog.Logger, notify func()) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		logger.Error("Error creating file watcher, changes to files will be picked up on resync", "err", err)
+		return
+	}
+	defer func() {
+		_ = watcher.Close()
+	}()
+
+	dirs := make(map[string]bool)
+	for _, file := range []string{c.flagServerCACertFile, c.flagServerCAKeyFile, c.flagGossipKeyFile} {
+		if file != "" {
+			dirs[filepath.Dir(file)] = true
+		}
+	}
+	for _, dir := range sortedKeys(dirs) {
+		if err := watcher.Add(dir); err != nil {
+			logger.Error("Error watching directory, changes to its files will be picked up on resync", "directory", dir, "err", err)
+		}
+	}
+
+	for {
+		select {
+		case _, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			notify()
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			logger.Error("Error watching files", "err", err)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// secretData regenerates the federation secret data. If no mesh gateway
+// instances are healthy, the server config from the current data is kept so
+// that secondaries don't lose all their primary gateways.
+func (c *Command) secretData(logger hclog.Logger, datacenter string, current map[string][]byte) (map[string][]byte, error) {
+	data, err := c.fileData()
+	if err != nil {
+		return nil, err
+	}
+
+	if c.flagExportReplicationToken {
+		token, err := c.readReplicationToken(c.replicationTokenSecretName())
+		if err != nil {
+			return nil, err
+		}
+		data[fedSecretReplicationTokenKey] = token
+	}
+
+	meshGWAddrs, err := c.meshGatewayAddrs()
+	if err != nil {
+		return nil, err
+	}
+	if len(meshGWAddrs) == 0 {
+		logger.Warn("No healthy instances of mesh gateway service found, keeping the current addresses",
+			"service-name", c.flagMeshGatewayServiceName)
+		data[fedSecretServerConfigKey] = current[fedSecretServerConfigKey]
+		return data, nil
+	}
+	serverCfg, err := c.serverCfg(datacenter, meshGWAddrs)
+	if err != nil {
+		return nil, err
+	}
+	data[fedSecretServerConfigKey] = serverCfg
+	return data, nil
+}
+
+// meshGatewayAddrs returns a sorted list of unique WAN addresses for the
+// passing instances of the mesh-gateway service.
+func (c *Command) meshGatewayAddrs() ([]string, error) {
+	entries, err := c.meshGatewayEntries()
+	if err != nil {
+		return nil, err
+	}
+	return wanAddrs(entries)
+}
+
+// meshGatewayEntries returns the passing instances of the mesh-gateway
+// service.
+func (c *Command) meshGatewayEntries() ([]*api.ServiceEntry, error) {
+	entries, _, err := c.consulClient.Health().Service(c.flagMeshGatewayServiceName, "", true, nil)
+	return entries, err
+}
+
+// wanAddrs returns a sorted list of the unique WAN addresses of the mesh
+// gateway instances.
+func wanAddrs(entries []*api.ServiceEntry) ([]string, error) {
+	// Use a map to collect the addresses to ensure uniqueness.
+	meshGatewayAddrs := make(map[string]bool)
+	for _, entry := range entries {
+		addr, ok := entry.Service.TaggedAddresses["wan"]
+		if !ok {
+			return nil, fmt.Errorf("no 'wan' key found in tagged addresses for service instance %q", entry.Service.ID)
+		}
+		meshGatewayAddrs[fmt.Sprintf("%s:%d", addr.Address, addr.Port)] = true
+	}
+	return sortedKeys(meshGatewayAddrs), nil
+}
+
+func sortedKeys(m map[string]bool) []string {
+	var keys []string
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 // replicationToken waits for the ACL replication token Kubernetes secret to
 // be created and then returns it.
 func (c *Command) replicationToken(logger hclog.Logger) ([]byte, error) {
-	secretName := fmt.Sprintf("%s-%s-acl-token", c.flagResourcePrefix, common.ACLReplicationTokenName)
+	secretName := c.replicationTokenSecretName()
 	logger.Info("Retrieving replication token from secret", "secret", secretName, "ns", c.flagK8sNamespace)
 
 	var unrecoverableErr error
@@ -305,9 +636,10 @@ func (c *Command) replicationToken(logger hclog.Logger) ([]byte, error) {
 	// ACL bootstrapping is complete. This can take some time because it
 	// requires all servers to be running and a leader elected.
 	// This will run forever but it's running as a Helm hook so Helm will timeout
-	// after a configurable time period.
+	// after a configurable time period, or as a Deployment in watch mode.
 	err := backoff.Retry(func() error {
-		secret, err := c.k8sClient.CoreV1().Secrets(c.flagK8sNamespace).Get(c.ctx, secretName, metav1.GetOptions{})
+		var err error
+		token, err = c.readReplicationToken(secretName)
 		if k8serrors.IsNotFound(err) {
 			logger.Warn("secret not yet created, retrying", "secret", secretName, "ns", c.flagK8sNamespace)
 			return errors.New("")
@@ -315,15 +647,6 @@ func (c *Command) replicationToken(logger hclog.Logger) ([]byte, error) {
 			unrecoverableErr = err
 			return nil
 		}
-		var ok bool
-		token, ok = secret.Data[common.ACLTokenSecretKey]
-		if !ok {
-			// If the secret exists but it doesn't have the expected key then
-			// something must have gone wrong generating the secret and we
-			// can't recover from that.
-			unrecoverableErr = fmt.Errorf("expected key '%s' in secret %s not set", common.ACLTokenSecretKey, secretName)
-			return nil
-		}
 		return nil
 	}, backoff.NewConstantBackOff(retryInterval))
 	// Unable to find the secret before timing out.
@@ -338,40 +661,47 @@ func (c *Command) replicationToken(logger hclog.Logger) ([]byte, error) {
 	return token, nil
 }
 
-// meshGatewayAddrs returns a list of unique WAN addresses for all service
-// instances of the mesh-gateway service.
-func (c *Command) meshGatewayAddrs(logger hclog.Logger) ([]string, error) {
-	var meshGWSvcs []*api.CatalogService
+func (c *Command) replicationTokenSecretName() string {
+	return fmt.Sprintf("%s-%s-acl-token", c.flagResourcePrefix, common.ACLReplicationTokenName)
+}
 
-	// Run in a retry in case the mesh gateways haven't yet been registered.
+// readReplicationToken returns the ACL replication token from its secret.
+func (c *Command) readReplicationToken(secretName string) ([]byte, error) {
+	secret, err := c.k8sClient.CoreV1().Secrets(c.flagK8sNamespace).Get(c.ctx, secretName, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	token, ok := secret.Data[common.ACLTokenSecretKey]
+	if !ok {
+		// If the secret exists but it doesn't have the expected key then
+		// something must have gone wrong generating the secret and we
+		// can't recover from that.
+		return nil, fmt.Errorf("expected key '%s' in secret %s not set", common.ACLTokenSecretKey, secretName)
+	}
+	return token, nil
+}
+
+// waitForMeshGatewayAddrs returns the addresses of the passing mesh gateway
+// instances, retrying until there is at least one.
+func (c *Command) waitForMeshGatewayAddrs(logger hclog.Logger) ([]string, error) {
+	var entries []*api.ServiceEntry
+
+	// Run in a retry in case the mesh gateways haven't yet been registered or
+	// aren't healthy yet.
 	_ = backoff.Retry(func() error {
 		var err error
-		meshGWSvcs, _, err = c.consulClient.Catalog().Service(c.flagMeshGatewayServiceName, "", nil)
+		entries, err = c.meshGatewayEntries()
 		if err != nil {
 			logger.Error("Error looking up mesh gateways, retrying", "err", err)
 			return errors.New("")
 		}
-		if len(meshGWSvcs) < 1 {
-			logger.Error("No instances of mesh gateway service found, retrying", "service-name", c.flagMeshGatewayServiceName)
+		if len(entries) < 1 {
+			logger.Error("No healthy instances of mesh gateway service found, retrying", "service-name", c.flagMeshGatewayServiceName)
 			return errors.New("")
 		}
 		return nil
 	}, backoff.NewConstantBackOff(retryInterval))
-
-	// Use a map to collect the addresses to ensure uniqueness.
-	meshGatewayAddrs := make(map[string]bool)
-	for _, svc := range meshGWSvcs {
-		addr, ok := svc.ServiceTaggedAddresses["wan"]
-		if !ok {
-			return nil, fmt.Errorf("no 'wan' key found in tagged addresses for service instance %q", svc.ServiceID)
-		}
-		meshGatewayAddrs[fmt.Sprintf("%s:%d", addr.Address, addr.Port)] = true
-	}
-	var uniqMeshGatewayAddrs []string
-	for addr := range meshGatewayAddrs {
-		uniqMeshGatewayAddrs = append(uniqMeshGatewayAddrs, addr)
-	}
-	return uniqMeshGatewayAddrs, nil
+	return wanAddrs(entries)
 }
 
 // serverCfg returns a JSON consul server config.
@@ -456,4 +786,9 @@ Usage: consul-k8s-control-plane create-federation-secret [options]
   datacenter to federate with the primary. This command should only be run in the
   primary datacenter.
 
+  With -watch, the command keeps running and updates the secret whenever the
+  mesh gateway addresses, the server CA, the gossip encryption key or the
+  replication token change. With -secondary-kubeconfig-secret, the secret is
+  also created or updated in the Kubernetes clusters of secondary datacenters.
+
 `
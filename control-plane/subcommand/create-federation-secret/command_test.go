@@ -7,6 +7,8 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"strconv"
 	"strings"
@@ -24,6 +26,7 @@ import (
 	"github.com/stretchr/testify/require"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/fake"
 )
 
@@ -85,6 +88,20 @@ func TestRun_FlagValidation(t *testing.T) {
 			},
 			expErr: "unknown log level: invalid",
 		},
+		{
+			flags: []string{
+				"-resource-prefix=prefix",
+				"-k8s-namespace=default",
+				"-server-ca-cert-file=file",
+				"-server-ca-key-file=file",
+				"-ca-file", f.Name(),
+				"-mesh-gateway-service-name=name",
+				"-consul-api-timeout=10s",
+				"-watch",
+				"-resync-interval=0s",
+			},
+			expErr: "-resync-interval must be set to a value greater than 0",
+		},
 	}
 
 	for _, c := range cases {
@@ -1126,6 +1143,232 @@ func TestRun_Autoencrypt(t *testing.T) {
 	require.Equal(t, string(keyFileBytes), string(secret.Data["caCert"]))
 }
 
+// Test that in watch mode the secret is updated in this cluster and in the
+// secondary cluster when the mesh gateway addresses or the server CA change.
+func TestRun_Watch(t *testing.T) {
+	t.Parallel()
+
+	k8sNS := "default"
+	resourcePrefix := "prefix"
+	kubeconfig := []byte("fake-kubeconfig")
+	k8s := fake.NewSimpleClientset(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "dc2-kubeconfig", Namespace: k8sNS},
+		Data:       map[string][]byte{"kubeconfig": kubeconfig},
+	})
+	secondaryK8s := fake.NewSimpleClientset()
+
+	consulServer := newFakeConsul()
+	consulServer.setGateway("mesh-gateway-1", "1.1.1.1", true)
+	// Gateways that aren't healthy are left out of the secret from the start.
+	consulServer.setGateway("mesh-gateway-3", "3.3.3.3", false)
+	server := httptest.NewServer(consulServer)
+	t.Cleanup(server.Close)
+
+	caFile, _, keyFile := test.GenerateServerCerts(t)
+	serverCACertFile := writeTempFile(t, "ca-cert-1")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ui := cli.NewMockUi()
+	cmd := Command{
+		UI:        ui,
+		k8sClient: k8s,
+		ctx:       ctx,
+		secondaryClient: func(config []byte) (kubernetes.Interface, error) {
+			require.Equal(t, kubeconfig, config)
+			return secondaryK8s, nil
+		},
+	}
+	exitCh := make(chan int, 1)
+	go func() {
+		exitCh <- cmd.Run([]string{
+			"-resource-prefix", resourcePrefix,
+			"-k8s-namespace", k8sNS,
+			"-mesh-gateway-service-name=mesh-gateway",
+			"-ca-file", caFile,
+			"-server-ca-cert-file", serverCACertFile,
+			"-server-ca-key-file", keyFile,
+			"-http-addr", server.URL,
+			"-consul-api-timeout", "10s",
+			"-watch",
+			"-resync-interval", "100ms",
+			"-secondary-kubeconfig-secret", "dc2-kubeconfig",
+		})
+	}()
+
+	requireSecret := func(caCert string, gateways ...string) {
+		gatewaysJSON, err := json.Marshal(gateways)
+		require.NoError(t, err)
+		expCfg := fmt.Sprintf(`{"primary_datacenter":"dc1","primary_gateways":%s}`, gatewaysJSON)
+		retry.Run(t, func(r *retry.R) {
+			for _, client := range []*fake.Clientset{k8s, secondaryK8s} {
+				secret, err := client.CoreV1().Secrets(k8sNS).Get(context.Background(), resourcePrefix+"-federation", metav1.GetOptions{})
+				require.NoError(r, err)
+				require.Equal(r, expCfg, string(secret.Data["serverConfigJSON"]))
+				require.Equal(r, caCert, string(secret.Data["caCert"]))
+			}
+		})
+	}
+	requireSecret("ca-cert-1", "1.1.1.1:443")
+
+	// Changes to the mesh gateways are picked up by the blocking query.
+	consulServer.setGateway("mesh-gateway-2", "2.2.2.2", true)
+	requireSecret("ca-cert-1", "1.1.1.1:443", "2.2.2.2:443")
+	consulServer.setGateway("mesh-gateway-1", "1.1.1.1", false)
+	requireSecret("ca-cert-1", "2.2.2.2:443")
+
+	// If no gateways are healthy the last addresses are kept.
+	consulServer.setGateway("mesh-gateway-2", "2.2.2.2", false)
+	err := os.WriteFile(serverCACertFile, []byte("ca-cert-2"), 0600)
+	require.NoError(t, err)
+	requireSecret("ca-cert-2", "2.2.2.2:443")
+
+	cancel()
+	select {
+	case exitCode := <-exitCh:
+		require.Equal(t, 0, exitCode, ui.ErrorWriter.String())
+	case <-time.After(5 * time.Second):
+		t.Fatal("command did not exit after the context was cancelled")
+	}
+}
+
+// Test that in watch mode changes to the server CA files are picked up
+// without waiting for a resync.
+func TestRun_WatchFiles(t *testing.T) {
+	t.Parallel()
+
+	k8sNS := "default"
+	resourcePrefix := "prefix"
+	k8s := fake.NewSimpleClientset()
+
+	consulServer := newFakeConsul()
+	consulServer.setGateway("mesh-gateway-1", "1.1.1.1", true)
+	server := httptest.NewServer(consulServer)
+	t.Cleanup(server.Close)
+
+	caFile, _, keyFile := test.GenerateServerCerts(t)
+	serverCACertFile := writeTempFile(t, "ca-cert-1")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	ui := cli.NewMockUi()
+	cmd := Command{
+		UI:        ui,
+		k8sClient: k8s,
+		ctx:       ctx,
+	}
+	go cmd.Run([]string{
+		"-resource-prefix", resourcePrefix,
+		"-k8s-namespace", k8sNS,
+		"-mesh-gateway-service-name=mesh-gateway",
+		"-ca-file", caFile,
+		"-server-ca-cert-file", serverCACertFile,
+		"-server-ca-key-file", keyFile,
+		"-http-addr", server.URL,
+		"-consul-api-timeout", "10s",
+		"-watch",
+		"-resync-interval", "1h",
+	})
+
+	requireCACert := func(caCert string) {
+		retry.Run(t, func(r *retry.R) {
+			secret, err := k8s.CoreV1().Secrets(k8sNS).Get(context.Background(), resourcePrefix+"-federation", metav1.GetOptions{})
+			require.NoError(r, err)
+			require.Equal(r, caCert, string(secret.Data["caCert"]))
+		})
+	}
+	requireCACert("ca-cert-1")
+
+	err := os.WriteFile(serverCACertFile, []byte("ca-cert-2"), 0600)
+	require.NoError(t, err)
+	requireCACert("ca-cert-2")
+}
+
+func writeTempFile(t *testing.T, contents string) string {
+	t.Helper()
+	f, err := os.CreateTemp(t.TempDir(), "")
+	require.NoError(t, err)
+	_, err = f.WriteString(contents)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	return f.Name()
+}
+
+// fakeConsul is a fake of the Consul HTTP API endpoints used in watch mode.
+// Blocking queries on the health endpoint return when a mesh gateway changes.
+type fakeConsul struct {
+	mu       sync.Mutex
+	index    uint64
+	changeCh chan struct{}
+	gateways map[string]fakeGateway
+}
+
+type fakeGateway struct {
+	address string
+	passing bool
+}
+
+func newFakeConsul() *fakeConsul {
+	return &fakeConsul{
+		index:    1,
+		changeCh: make(chan struct{}),
+		gateways: make(map[string]fakeGateway),
+	}
+}
+
+func (f *fakeConsul) setGateway(id, address string, passing bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.gateways[id] = fakeGateway{address: address, passing: passing}
+	f.index++
+	close(f.changeCh)
+	f.changeCh = make(chan struct{})
+}
+
+func (f *fakeConsul) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Block until the index changes if the query is waiting on the current
+	// index.
+	f.mu.Lock()
+	waitIndex, _ := strconv.ParseUint(r.URL.Query().Get("index"), 10, 64)
+	if waitIndex == f.index {
+		changeCh := f.changeCh
+		f.mu.Unlock()
+		select {
+		case <-changeCh:
+		case <-r.Context().Done():
+			return
+		case <-time.After(time.Second):
+		}
+		f.mu.Lock()
+	}
+	defer f.mu.Unlock()
+	w.Header().Set("X-Consul-Index", strconv.FormatUint(f.index, 10))
+
+	var resp interface{}
+	switch r.URL.Path {
+	case "/v1/agent/self":
+		resp = map[string]map[string]interface{}{"Config": {"Datacenter": "dc1"}}
+	case "/v1/health/service/mesh-gateway":
+		_, passingOnly := r.URL.Query()["passing"]
+		var entries []*api.ServiceEntry
+		for id, gw := range f.gateways {
+			if passingOnly && !gw.passing {
+				continue
+			}
+			entries = append(entries, &api.ServiceEntry{
+				Service: &api.AgentService{
+					ID:              id,
+					TaggedAddresses: map[string]api.ServiceAddress{"wan": {Address: gw.address, Port: 443}},
+				},
+			})
+		}
+		resp = entries
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
 var replicationPolicy = `acl = "write"
 operator = "write"
 agent_prefix "" {
@@ -0,0 +1,405 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gossipkeyrotate
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/consul-k8s/control-plane/consul"
+	"github.com/hashicorp/consul-k8s/control-plane/subcommand"
+	"github.com/hashicorp/consul-k8s/control-plane/subcommand/common"
+	"github.com/hashicorp/consul-k8s/control-plane/subcommand/flags"
+	"github.com/hashicorp/consul-server-connection-manager/discovery"
+	"github.com/hashicorp/consul/api"
+	"github.com/hashicorp/go-hclog"
+	"github.com/mitchellh/cli"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// stageAnnotation records how far the rotation of the key in the secret
+	// has progressed so that an interrupted rotation can be resumed.
+	stageAnnotation = "consul.hashicorp.com/gossip-key-rotation-stage"
+
+	// stageGenerated means the new key was generated and stored in the
+	// secret under the next key.
+	stageGenerated = "generated"
+	// stageInstalled means the new key was installed on every member.
+	stageInstalled = "installed"
+	// stageInUse means every member encrypts gossip with the new key.
+	stageInUse = "in-use"
+	// stageRemoved means the old key was removed from every member.
+	stageRemoved = "removed"
+)
+
+type Command struct {
+	UI cli.Ui
+
+	flags       *flag.FlagSet
+	k8s         *flags.K8SFlags
+	consulFlags *flags.ConsulFlags
+
+	// These flags determine where the Kubernetes secret is stored.
+	flagNamespace  string
+	flagSecretName string
+	flagSecretKey  string
+
+	flagTimeout  time.Duration
+	flagLogLevel string
+	flagLogJSON  bool
+
+	k8sClient kubernetes.Interface
+	watcher   consul.ServerConnectionManager
+
+	// ctx is cancelled when the command timeout is reached.
+	ctx           context.Context
+	retryDuration time.Duration
+
+	log  hclog.Logger
+	once sync.Once
+	help string
+}
+
+// init is run once to set up usage documentation for flags.
+func (c *Command) init() {
+	c.flags = flag.NewFlagSet("", flag.ContinueOnError)
+
+	c.flags.StringVar(&c.flagNamespace, "k8s-namespace", "", "Name of Kubernetes namespace where Consul and consul-k8s components are deployed.")
+	c.flags.StringVar(&c.flagSecretName, "secret-name", "", "Name of the secret containing the gossip encryption key.")
+	c.flags.StringVar(&c.flagSecretKey, "secret-key", "key", "Name of the secret key containing the gossip encryption key.")
+	c.flags.DurationVar(&c.flagTimeout, "timeout", 10*time.Minute,
+		"How long we'll try to rotate the key for before timing out, e.g. 1ms, 2s, 3m")
+	c.flags.StringVar(&c.flagLogLevel, "log-level", "info",
+		"Log verbosity level. Supported values (in order of detail) are \"trace\", "+
+			"\"debug\", \"info\", \"warn\", and \"error\".")
+	c.flags.BoolVar(&c.flagLogJSON, "log-json", false, "Enable or disable JSON output format for logging.")
+
+	c.k8s = &flags.K8SFlags{}
+	c.consulFlags = &flags.ConsulFlags{}
+	flags.Merge(c.flags, c.k8s.Flags())
+	flags.Merge(c.flags, c.consulFlags.Flags())
+	c.help = flags.Usage(help, c.flags)
+
+	// Default retry to 1s. This is exposed for setting in tests.
+	if c.retryDuration == 0 {
+		c.retryDuration = 1 * time.Second
+	}
+}
+
+// Run rotates the gossip encryption key stored in the secret. Each step is
+// idempotent and is recorded in an annotation on the secret, so an
+// interrupted rotation continues where it stopped when the command is run
+// again.
+func (c *Command) Run(args []string) int {
+	c.once.Do(c.init)
+
+	if err := c.flags.Parse(args); err != nil {
+		c.UI.Error(fmt.Sprintf("Failed to parse args: %v", err))
+		return 1
+	}
+
+	if err := c.validateFlags(); err != nil {
+		c.UI.Error(fmt.Sprintf("Failed to validate flags: %v", err))
+		return 1
+	}
+
+	var err error
+	c.log, err = common.Logger(c.flagLogLevel, c.flagLogJSON)
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	var cancel context.CancelFunc
+	c.ctx, cancel = context.WithTimeout(context.Background(), c.flagTimeout)
+	defer cancel()
+
+	if c.k8sClient == nil {
+		if err = c.createKubernetesClient(); err != nil {
+			c.UI.Error(fmt.Sprintf("Failed to create Kubernetes client: %v", err))
+			return 1
+		}
+	}
+
+	// Start Consul server Connection manager
+	watcher := c.watcher
+	if watcher == nil {
+		serverConnMgrCfg, err := c.consulFlags.ConsulServerConnMgrConfig()
+		if err != nil {
+			c.UI.Error(fmt.Sprintf("unable to create config for consul-server-connection-manager: %s", err))
+			return 1
+		}
+		watcher, err = discovery.NewWatcher(c.ctx, serverConnMgrCfg, c.log.Named("consul-server-connection-manager"))
+		if err != nil {
+			c.UI.Error(fmt.Sprintf("unable to create Consul server watcher: %s", err))
+			return 1
+		}
+	}
+	go watcher.Run()
+	defer watcher.Stop()
+
+	state, err := watcher.State()
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("unable to get Consul server addresses from watcher: %s", err))
+		return 1
+	}
+	consulClient, err := consul.NewClientFromConnMgrState(c.consulFlags.ConsulClientConfig(), state)
+	if err != nil {
+		c.log.Error(fmt.Sprintf("Error creating Consul client for addr %q: %s", state.Address, err))
+		return 1
+	}
+
+	if err := c.rotate(consulClient); err != nil {
+		c.log.Error("Failed to rotate gossip encryption key", "err", err)
+		return 1
+	}
+
+	c.UI.Info(fmt.Sprintf("Successfully rotated the gossip encryption key in Kubernetes secret `%s` in namespace `%s`.", c.flagSecretName, c.flagNamespace))
+	return 0
+}
+
+// rotate runs the remaining steps of the rotation based on the stage
+// recorded on the secret.
+func (c *Command) rotate(consulClient *api.Client) error {
+	secret, err := c.k8sClient.CoreV1().Secrets(c.flagNamespace).Get(c.ctx, c.flagSecretName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get Kubernetes secret: %w", err)
+	}
+	oldKey := string(secret.Data[c.flagSecretKey])
+	if oldKey == "" {
+		return fmt.Errorf("Kubernetes secret `%s` has no key `%s`", c.flagSecretName, c.flagSecretKey)
+	}
+	newKey := string(secret.Data[c.nextSecretKey()])
+	stage := secret.Annotations[stageAnnotation]
+	if stage != "" && newKey == "" {
+		return fmt.Errorf("rotation is at stage %q but Kubernetes secret `%s` has no key `%s`", stage, c.flagSecretName, c.nextSecretKey())
+	}
+
+	if stage == "" {
+		// Store the new key before installing it so that a resumed rotation
+		// uses the same key.
+		newKey, err = generateGossipSecret()
+		if err != nil {
+			return fmt.Errorf("failed to generate gossip secret: %w", err)
+		}
+		secret.Data[c.nextSecretKey()] = []byte(newKey)
+		if secret, err = c.updateStage(secret, stageGenerated); err != nil {
+			return err
+		}
+		stage = stageGenerated
+	}
+	operator := consulClient.Operator()
+
+	if stage == stageGenerated {
+		c.log.Info("Installing new gossip encryption key")
+		if err := c.untilSucceeds("installing new key", func() error {
+			return operator.KeyringInstall(newKey, nil)
+		}); err != nil {
+			return err
+		}
+		if err := c.waitForKeyring(operator, "waiting for every member to install the new key", func(r *api.KeyringResponse) bool {
+			return r.Keys[newKey] == r.NumNodes
+		}); err != nil {
+			return err
+		}
+		if secret, err = c.updateStage(secret, stageInstalled); err != nil {
+			return err
+		}
+		stage = stageInstalled
+	}
+
+	if stage == stageInstalled {
+		c.log.Info("Switching to new gossip encryption key")
+		if err := c.untilSucceeds("using new key", func() error {
+			return operator.KeyringUse(newKey, nil)
+		}); err != nil {
+			return err
+		}
+		if err := c.waitForKeyring(operator, "waiting for every member to use the new key", func(r *api.KeyringResponse) bool {
+			// Older servers don't report primary keys.
+			return r.PrimaryKeys == nil || r.PrimaryKeys[newKey] == r.NumNodes
+		}); err != nil {
+			return err
+		}
+		if secret, err = c.updateStage(secret, stageInUse); err != nil {
+			return err
+		}
+		stage = stageInUse
+	}
+
+	if stage == stageInUse {
+		c.log.Info("Removing old gossip encryption key")
+		if err := c.untilSucceeds("removing old key", func() error {
+			keyring, err := operator.KeyringList(nil)
+			if err != nil {
+				return err
+			}
+			for _, r := range keyring {
+				if r.Keys[oldKey] > 0 {
+					return operator.KeyringRemove(oldKey, nil)
+				}
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+		if secret, err = c.updateStage(secret, stageRemoved); err != nil {
+			return err
+		}
+		stage = stageRemoved
+	}
+
+	if stage != stageRemoved {
+		return fmt.Errorf("unknown rotation stage %q in annotation %s", stage, stageAnnotation)
+	}
+
+	// Replace the old key in the secret and clear the rotation state.
+	secret.Data[c.flagSecretKey] = []byte(newKey)
+	delete(secret.Data, c.nextSecretKey())
+	delete(secret.Annotations, stageAnnotation)
+	if _, err := c.k8sClient.CoreV1().Secrets(c.flagNamespace).Update(c.ctx, secret, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to update Kubernetes secret: %w", err)
+	}
+	return nil
+}
+
+// waitForKeyring waits until done returns true for the keyring of every
+// pool in every datacenter.
+func (c *Command) waitForKeyring(operator *api.Operator, opName string, done func(*api.KeyringResponse) bool) error {
+	return c.untilSucceeds(opName, func() error {
+		keyring, err := operator.KeyringList(nil)
+		if err != nil {
+			return err
+		}
+		for _, r := range keyring {
+			if !done(r) {
+				pool := "LAN"
+				if r.WAN {
+					pool = "WAN"
+				}
+				return fmt.Errorf("not all %d members of the %s pool in datacenter %q are done", r.NumNodes, pool, r.Datacenter)
+			}
+		}
+		return nil
+	})
+}
+
+// updateStage records the stage of the rotation on the secret. The update
+// fails if the secret was modified since it was read.
+func (c *Command) updateStage(secret *v1.Secret, stage string) (*v1.Secret, error) {
+	if secret.Annotations == nil {
+		secret.Annotations = make(map[string]string)
+	}
+	secret.Annotations[stageAnnotation] = stage
+	updated, err := c.k8sClient.CoreV1().Secrets(c.flagNamespace).Update(c.ctx, secret, metav1.UpdateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to record rotation stage %q on Kubernetes secret: %w", stage, err)
+	}
+	c.log.Info("Recorded rotation stage", "stage", stage)
+	return updated, nil
+}
+
+// nextSecretKey is the key in the secret that holds the new key during the
+// rotation.
+func (c *Command) nextSecretKey() string {
+	return c.flagSecretKey + "-next"
+}
+
+// untilSucceeds runs op until it returns a nil error.
+// If c.ctx is cancelled it will exit.
+func (c *Command) untilSucceeds(opName string, op func() error) error {
+	for {
+		err := op()
+		if err == nil {
+			c.log.Info(fmt.Sprintf("Success: %s", opName))
+			break
+		}
+		c.log.Info(fmt.Sprintf("Retrying: %s", opName), "err", err)
+		// Wait on either the retry duration (in which case we continue) or the
+		// overall command timeout.
+		select {
+		case <-time.After(c.retryDuration):
+			continue
+		case <-c.ctx.Done():
+			return fmt.Errorf("reached command timeout while %s: %w", opName, err)
+		}
+	}
+	return nil
+}
+
+// Help returns the command's help text.
+func (c *Command) Help() string {
+	c.once.Do(c.init)
+	return c.help
+}
+
+// Synopsis returns a one-line synopsis of the command.
+func (c *Command) Synopsis() string {
+	return synopsis
+}
+
+// validateFlags ensures that all required flags are set.
+func (c *Command) validateFlags() error {
+	if c.flagNamespace == "" {
+		return errors.New("-k8s-namespace must be set")
+	}
+
+	if c.flagSecretName == "" {
+		return errors.New("-secret-name must be set")
+	}
+
+	if c.flagSecretKey == "" {
+		return errors.New("-secret-key must be set")
+	}
+
+	return nil
+}
+
+// createKubernetesClient creates a Kubernetes client on the command object.
+func (c *Command) createKubernetesClient() error {
+	config, err := subcommand.K8SConfig(c.k8s.KubeConfig())
+	if err != nil {
+		return fmt.Errorf("failed to create Kubernetes config: %v", err)
+	}
+
+	c.k8sClient, err = kubernetes.NewForConfig(config)
+	if err != nil {
+		return fmt.Errorf("error initializing Kubernetes client: %s", err)
+	}
+
+	return nil
+}
+
+// generateGossipSecret generates a random 32 byte secret returned as a base64 encoded string.
+func generateGossipSecret() (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", fmt.Errorf("error reading random data: %s", err)
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+const synopsis = "Rotate the gossip encryption key."
+const help = `
+Usage: consul-k8s-control-plane gossip-key-rotate [options]
+
+  Rotates the gossip encryption key stored in a Kubernetes secret. A new key
+  is installed on every member of the cluster, then used to encrypt gossip,
+  and then the old key is removed and the secret is updated with the new key.
+
+  The progress of the rotation is recorded in the
+  consul.hashicorp.com/gossip-key-rotation-stage annotation on the secret and
+  the new key is stored under the "<secret-key>-next" key until the rotation
+  completes. If the rotation is interrupted, running the command again
+  resumes it.
+`
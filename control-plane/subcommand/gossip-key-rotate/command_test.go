@@ -0,0 +1,274 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gossipkeyrotate
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul-k8s/control-plane/helper/test"
+	"github.com/hashicorp/consul/api"
+	"github.com/mitchellh/cli"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const (
+	namespace  = "default"
+	secretName = "gossip-secret"
+	secretKey  = "key"
+	oldKey     = "b2xkLWtleS1vbGQta2V5LW9sZC1rZXktb2xkLWtleSE="
+)
+
+func TestRun_FlagValidation(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		flags  []string
+		expErr string
+	}{
+		{
+			flags:  []string{},
+			expErr: "-k8s-namespace must be set",
+		},
+		{
+			flags:  []string{"-k8s-namespace", "default"},
+			expErr: "-secret-name must be set",
+		},
+		{
+			flags:  []string{"-k8s-namespace", "default", "-secret-name", "my-secret", "-secret-key", ""},
+			expErr: "-secret-key must be set",
+		},
+		{
+			flags:  []string{"-k8s-namespace", "default", "-secret-name", "my-secret", "-log-level", "oak"},
+			expErr: "unknown log level",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.expErr, func(t *testing.T) {
+			ui := cli.NewMockUi()
+			cmd := Command{
+				UI: ui,
+			}
+			code := cmd.Run(c.flags)
+			require.Equal(t, 1, code)
+			require.Contains(t, ui.ErrorWriter.String(), c.expErr)
+		})
+	}
+}
+
+func TestRun_RotatesKey(t *testing.T) {
+	t.Parallel()
+
+	keyring := newFakeKeyring(3, oldKey)
+	// Members only report the new key after a few checks.
+	keyring.propagationDelay = 2
+	k8s := fake.NewSimpleClientset(gossipSecret(oldKey, "", ""))
+
+	code, ui := runCommand(t, keyring, k8s)
+	require.Equal(t, 0, code, ui.ErrorWriter.String())
+
+	secret := getSecret(t, k8s)
+	newKey := string(secret.Data[secretKey])
+	require.NotEqual(t, oldKey, newKey)
+	require.NotContains(t, secret.Data, secretKey+"-next")
+	require.NotContains(t, secret.Annotations, stageAnnotation)
+
+	require.Equal(t, map[string]int{newKey: 3}, keyring.keys)
+	require.Equal(t, newKey, keyring.primary)
+	require.Equal(t, []string{"install", "use", "remove"}, keyring.operations)
+}
+
+// Test that a rotation that was interrupted after the new key was installed
+// resumes with the same key and doesn't install it again.
+func TestRun_ResumesRotation(t *testing.T) {
+	t.Parallel()
+
+	newKey := "bmV3LWtleS1uZXcta2V5LW5ldy1rZXktbmV3LWtleSE="
+	keyring := newFakeKeyring(3, oldKey)
+	keyring.keys[newKey] = 3
+	k8s := fake.NewSimpleClientset(gossipSecret(oldKey, newKey, stageInstalled))
+
+	code, ui := runCommand(t, keyring, k8s)
+	require.Equal(t, 0, code, ui.ErrorWriter.String())
+
+	secret := getSecret(t, k8s)
+	require.Equal(t, newKey, string(secret.Data[secretKey]))
+	require.Equal(t, map[string]int{newKey: 3}, keyring.keys)
+	require.Equal(t, []string{"use", "remove"}, keyring.operations)
+}
+
+// Test that if members don't install the new key, the rotation stops before
+// using it and a later run continues with the same key.
+func TestRun_TimesOutWaitingForMembers(t *testing.T) {
+	t.Parallel()
+
+	keyring := newFakeKeyring(3, oldKey)
+	keyring.propagationDelay = 1000
+	k8s := fake.NewSimpleClientset(gossipSecret(oldKey, "", ""))
+
+	code, _ := runCommand(t, keyring, k8s, "-timeout=200ms")
+	require.Equal(t, 1, code)
+
+	secret := getSecret(t, k8s)
+	require.Equal(t, oldKey, string(secret.Data[secretKey]))
+	require.Equal(t, stageGenerated, secret.Annotations[stageAnnotation])
+	newKey := string(secret.Data[secretKey+"-next"])
+	require.NotEmpty(t, newKey)
+	require.Equal(t, oldKey, keyring.primary)
+
+	keyring.propagationDelay = 0
+	code, ui := runCommand(t, keyring, k8s)
+	require.Equal(t, 0, code, ui.ErrorWriter.String())
+	require.Equal(t, newKey, string(getSecret(t, k8s).Data[secretKey]))
+	require.Equal(t, newKey, keyring.primary)
+}
+
+func TestRun_SecretWithoutKey(t *testing.T) {
+	t.Parallel()
+
+	k8s := fake.NewSimpleClientset(gossipSecret("", "", ""))
+	code, _ := runCommand(t, newFakeKeyring(3, oldKey), k8s)
+	require.Equal(t, 1, code)
+}
+
+func runCommand(t *testing.T, keyring *fakeKeyring, k8s *fake.Clientset, args ...string) (int, *cli.MockUi) {
+	server := httptest.NewServer(keyring)
+	t.Cleanup(server.Close)
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	port, err := strconv.Atoi(serverURL.Port())
+	require.NoError(t, err)
+
+	ui := cli.NewMockUi()
+	cmd := Command{
+		UI:            ui,
+		k8sClient:     k8s,
+		watcher:       test.MockConnMgrForIPAndPort(serverURL.Hostname(), port),
+		retryDuration: 10 * time.Millisecond,
+	}
+	return cmd.Run(append([]string{
+		"-timeout=10s",
+		"-k8s-namespace=" + namespace,
+		"-secret-name=" + secretName,
+		"-addresses=" + serverURL.Hostname(),
+		"-http-port=" + serverURL.Port(),
+	}, args...)), ui
+}
+
+func gossipSecret(key, nextKey, stage string) *v1.Secret {
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      secretName,
+			Namespace: namespace,
+		},
+		Data: map[string][]byte{},
+	}
+	if key != "" {
+		secret.Data[secretKey] = []byte(key)
+	}
+	if nextKey != "" {
+		secret.Data[secretKey+"-next"] = []byte(nextKey)
+	}
+	if stage != "" {
+		secret.Annotations = map[string]string{stageAnnotation: stage}
+	}
+	return secret
+}
+
+func getSecret(t *testing.T, k8s *fake.Clientset) *v1.Secret {
+	secret, err := k8s.CoreV1().Secrets(namespace).Get(context.Background(), secretName, metav1.GetOptions{})
+	require.NoError(t, err)
+	return secret
+}
+
+// fakeKeyring is a fake of the Consul operator keyring API for a single
+// LAN pool.
+type fakeKeyring struct {
+	mu       sync.Mutex
+	numNodes int
+	keys     map[string]int
+	primary  string
+	// propagationDelay is the number of keyring lists after an install or
+	// use before every member reports the change.
+	propagationDelay int
+	pending          int
+	operations       []string
+}
+
+func newFakeKeyring(numNodes int, primary string) *fakeKeyring {
+	return &fakeKeyring{
+		numNodes: numNodes,
+		keys:     map[string]int{primary: numNodes},
+		primary:  primary,
+	}
+}
+
+func (f *fakeKeyring) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if r.URL.Path != "/v1/operator/keyring" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		resp := &api.KeyringResponse{
+			Datacenter:  "dc1",
+			Keys:        make(map[string]int),
+			PrimaryKeys: make(map[string]int),
+			NumNodes:    f.numNodes,
+		}
+		for key, count := range f.keys {
+			resp.Keys[key] = count
+		}
+		resp.PrimaryKeys[f.primary] = f.numNodes
+		if f.pending > 0 {
+			f.pending--
+			// Report that only one member has the latest change.
+			for key, count := range resp.Keys {
+				if count == f.numNodes && key != f.primary {
+					resp.Keys[key] = 1
+				}
+			}
+		}
+		_ = json.NewEncoder(w).Encode([]*api.KeyringResponse{resp})
+		return
+	}
+
+	var req struct{ Key string }
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	switch r.Method {
+	case http.MethodPost:
+		f.operations = append(f.operations, "install")
+		f.keys[req.Key] = f.numNodes
+		f.pending = f.propagationDelay
+	case http.MethodPut:
+		if f.keys[req.Key] == 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		f.operations = append(f.operations, "use")
+		f.primary = req.Key
+	case http.MethodDelete:
+		if req.Key == f.primary {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		f.operations = append(f.operations, "remove")
+		delete(f.keys, req.Key)
+	}
+}
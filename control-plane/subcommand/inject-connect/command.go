@@ -14,6 +14,7 @@ import (
 	"strings"
 	"sync"
 	"syscall"
+	"time"
 
 	apicommon "github.com/hashicorp/consul-k8s/control-plane/api/common"
 	"github.com/hashicorp/consul-k8s/control-plane/api/v1alpha1"
@@ -26,6 +27,7 @@ import (
 	"github.com/hashicorp/consul-k8s/control-plane/subcommand/common"
 	"github.com/hashicorp/consul-k8s/control-plane/subcommand/flags"
 	"github.com/hashicorp/consul-server-connection-manager/discovery"
+	vaultapi "github.com/hashicorp/vault/api"
 	"github.com/mitchellh/cli"
 	"go.uber.org/zap/zapcore"
 	corev1 "k8s.io/api/core/v1"
@@ -69,6 +71,11 @@ type Command struct {
 	flagK8SNSMirroringPrefix       string // Prefix added to Consul namespaces created when mirroring
 	flagCrossNamespaceACLPolicy    string // The name of the ACL policy to add to every created namespace if ACLs are enabled
 
+	// Flags for the orphaned config entry sweeper.
+	flagConfigEntryOrphanSweepInterval    time.Duration
+	flagConfigEntryOrphanSweepGracePeriod time.Duration
+	flagConfigEntryOrphanSweepDryRun      bool
+
 	// Flags for endpoints controller.
 	flagReleaseName      string
 	flagReleaseNamespace string
@@ -98,14 +105,25 @@ type Command struct {
 	flagDefaultEnableTransparentProxy          bool
 	flagTransparentProxyDefaultOverwriteProbes bool
 
-	// CNI flag.
-	flagEnableCNI bool
+	// CNI flags.
+	flagEnableCNI             bool
+	flagEnableCNINodeAffinity bool
 
 	// Additional metadata to get applied to nodes.
 	flagNodeMeta map[string]string
 
 	// Peering flags.
-	flagEnablePeering bool
+	flagEnablePeering              bool
+	flagPeeringVaultAddress        string
+	flagPeeringVaultCACertFile     string
+	flagPeeringVaultKVMount        string
+	flagPeeringVaultAuthMethodPath string
+	flagPeeringVaultRole           string
+	flagPeeringSecretPollInterval  time.Duration
+	flagPeeringHealthCheckInterval time.Duration
+	flagEnablePeeringAutoRedial    bool
+	flagPeeringRedialBackoff       time.Duration
+	flagPeeringMaxRedialBackoff    time.Duration
 
 	// WAN Federation flags.
 	flagEnableFederation bool
@@ -154,6 +172,30 @@ func (c *Command) init() {
 	c.flagSet.StringVar(&c.flagConsulK8sImage, "consul-k8s-image", "",
 		"Docker image for consul-k8s. Used for the connect sidecar.")
 	c.flagSet.BoolVar(&c.flagEnablePeering, "enable-peering", false, "Enable cluster peering controllers.")
+	c.flagSet.StringVar(&c.flagPeeringVaultAddress, "peering-vault-address", "",
+		"Address of the Vault server used to store peering tokens for peering resources with the \"vault\" secret backend. "+
+			"If not set, the \"vault\" secret backend is disabled.")
+	c.flagSet.StringVar(&c.flagPeeringVaultCACertFile, "peering-vault-ca-cert-file", "",
+		"Path to a PEM-encoded CA certificate used to verify the Vault server's TLS certificate when storing peering tokens in Vault.")
+	c.flagSet.StringVar(&c.flagPeeringVaultKVMount, "peering-vault-kv-mount", "secret",
+		"Path the Vault KV version 2 secrets engine that stores peering tokens is mounted at.")
+	c.flagSet.StringVar(&c.flagPeeringVaultAuthMethodPath, "peering-vault-auth-method-path", "kubernetes",
+		"Path the Vault Kubernetes auth method is mounted at.")
+	c.flagSet.StringVar(&c.flagPeeringVaultRole, "peering-vault-role", "",
+		"Vault role to log in with when storing peering tokens in Vault. If not set, the token from the VAULT_TOKEN "+
+			"environment variable is used.")
+	c.flagSet.DurationVar(&c.flagPeeringSecretPollInterval, "peering-secret-poll-interval", time.Minute,
+		"How often peering tokens stored outside of Kubernetes are checked for changes. Set to 0 to disable polling.")
+	c.flagSet.DurationVar(&c.flagPeeringHealthCheckInterval, "peering-health-check-interval", 30*time.Second,
+		"How often the state of each peering is read from Consul and recorded in the status of its PeeringAcceptor "+
+			"or PeeringDialer. Set to 0 to only read it when the resource changes.")
+	c.flagSet.BoolVar(&c.flagEnablePeeringAutoRedial, "enable-peering-auto-redial", true,
+		"Re-establish peerings that Consul reports as terminated using the token in the PeeringDialer's spec.peer.secret.")
+	c.flagSet.DurationVar(&c.flagPeeringRedialBackoff, "peering-redial-backoff", 10*time.Second,
+		"How long to wait after the first attempt to re-establish a terminated peering before trying again. "+
+			"The wait doubles after each attempt.")
+	c.flagSet.DurationVar(&c.flagPeeringMaxRedialBackoff, "peering-max-redial-backoff", 5*time.Minute,
+		"The longest wait between attempts to re-establish a terminated peering.")
 	c.flagSet.BoolVar(&c.flagEnableFederation, "enable-federation", false, "Enable Consul WAN Federation.")
 	c.flagSet.StringVar(&c.flagEnvoyExtraArgs, "envoy-extra-args", "",
 		"Extra envoy command line args to be set when starting envoy (e.g \"--log-level debug --disable-hot-restart\").")
@@ -179,10 +221,19 @@ func (c *Command) init() {
 	c.flagSet.StringVar(&c.flagCrossNamespaceACLPolicy, "consul-cross-namespace-acl-policy", "",
 		"[Enterprise Only] Name of the ACL policy to attach to all created Consul namespaces to allow service "+
 			"discovery across Consul namespaces. Only necessary if ACLs are enabled.")
+	c.flagSet.DurationVar(&c.flagConfigEntryOrphanSweepInterval, "config-entry-orphan-sweep-interval", 0,
+		"How often to check Consul for config entries created by this datacenter that no longer have a custom resource. "+
+			"Orphaned config entries are deleted. Set to 0 to disable.")
+	c.flagSet.DurationVar(&c.flagConfigEntryOrphanSweepGracePeriod, "config-entry-orphan-sweep-grace-period", 10*time.Minute,
+		"How long a config entry must be orphaned before it is deleted from Consul.")
+	c.flagSet.BoolVar(&c.flagConfigEntryOrphanSweepDryRun, "config-entry-orphan-sweep-dry-run", false,
+		"Log orphaned config entries instead of deleting them.")
 	c.flagSet.BoolVar(&c.flagDefaultEnableTransparentProxy, "default-enable-transparent-proxy", true,
 		"Enable transparent proxy mode for all Consul service mesh applications by default.")
 	c.flagSet.BoolVar(&c.flagEnableCNI, "enable-cni", false,
 		"Enable CNI traffic redirection for all Consul service mesh applications.")
+	c.flagSet.BoolVar(&c.flagEnableCNINodeAffinity, "enable-cni-node-affinity", false,
+		"Require transparent proxy pods to be scheduled on nodes labeled as having the consul-cni plugin installed.")
 	c.flagSet.BoolVar(&c.flagTransparentProxyDefaultOverwriteProbes, "transparent-proxy-default-overwrite-probes", true,
 		"Overwrite Kubernetes probes to point to Envoy by default when in Transparent Proxy mode.")
 	c.flagSet.BoolVar(&c.flagEnableConsulDNS, "enable-consul-dns", false,
@@ -465,6 +516,7 @@ func (c *Command) Run(args []string) int {
 		EnableNSMirroring:          c.flagEnableK8SNSMirroring,
 		NSMirroringPrefix:          c.flagK8SNSMirroringPrefix,
 		CrossNSACLPolicy:           c.flagCrossNamespaceACLPolicy,
+		EventRecorder:              mgr.GetEventRecorderFor("consul-config-entry-controller"),
 	}
 	if err = (&controllers.ServiceDefaultsController{
 		ConfigEntryController: configEntryReconciler,
@@ -565,6 +617,29 @@ func (c *Command) Run(args []string) int {
 		setupLog.Error(err, "unable to create controller", "controller", apicommon.SamenessGroup)
 		return 1
 	}
+	if err = (&controllers.ConfigEntryResourceController{
+		ConfigEntryController: configEntryReconciler,
+		Client:                mgr.GetClient(),
+		Log:                   ctrl.Log.WithName("controller").WithName(apicommon.ConfigEntry),
+		Scheme:                mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", apicommon.ConfigEntry)
+		return 1
+	}
+
+	if c.flagConfigEntryOrphanSweepInterval > 0 {
+		if err = mgr.Add(&controllers.OrphanedConfigEntrySweeper{
+			Client:                mgr.GetClient(),
+			Log:                   ctrl.Log.WithName("controller").WithName("config-entry-orphan-sweeper"),
+			ConfigEntryController: configEntryReconciler,
+			Interval:              c.flagConfigEntryOrphanSweepInterval,
+			GracePeriod:           c.flagConfigEntryOrphanSweepGracePeriod,
+			DryRun:                c.flagConfigEntryOrphanSweepDryRun,
+		}); err != nil {
+			setupLog.Error(err, "unable to create orphaned config entry sweeper")
+			return 1
+		}
+	}
 
 	if err = mgr.AddReadyzCheck("ready", webhook.ReadinessCheck{CertDir: c.flagCertDir}.Ready); err != nil {
 		setupLog.Error(err, "unable to create readiness check", "controller", endpoints.Controller{})
@@ -572,12 +647,40 @@ func (c *Command) Run(args []string) int {
 	}
 
 	if c.flagEnablePeering {
+		var vaultSecretBackend peering.SecretBackend
+		if c.flagPeeringVaultAddress != "" {
+			vaultConfig := vaultapi.DefaultConfig()
+			vaultConfig.Address = c.flagPeeringVaultAddress
+			if c.flagPeeringVaultCACertFile != "" {
+				if err := vaultConfig.ConfigureTLS(&vaultapi.TLSConfig{CACert: c.flagPeeringVaultCACertFile}); err != nil {
+					setupLog.Error(err, "unable to configure Vault TLS")
+					return 1
+				}
+			}
+			vaultClient, err := vaultapi.NewClient(vaultConfig)
+			if err != nil {
+				setupLog.Error(err, "unable to create Vault client")
+				return 1
+			}
+			vaultSecretBackend = &peering.VaultSecretBackend{
+				Client:         vaultClient,
+				Mount:          c.flagPeeringVaultKVMount,
+				Partition:      c.consul.Partition,
+				AuthMethodPath: c.flagPeeringVaultAuthMethodPath,
+				Role:           c.flagPeeringVaultRole,
+			}
+		}
+
 		if err = (&peering.AcceptorController{
 			Client:                   mgr.GetClient(),
 			ConsulClientConfig:       consulConfig,
 			ConsulServerConnMgr:      watcher,
 			ExposeServersServiceName: c.flagResourcePrefix + "-expose-servers",
 			ReleaseNamespace:         c.flagReleaseNamespace,
+			VaultSecretBackend:       vaultSecretBackend,
+			SecretPollInterval:       c.flagPeeringSecretPollInterval,
+			HealthCheckInterval:      c.flagPeeringHealthCheckInterval,
+			EventRecorder:            mgr.GetEventRecorderFor("consul-peering-acceptor-controller"),
 			Log:                      ctrl.Log.WithName("controller").WithName("peering-acceptor"),
 			Scheme:                   mgr.GetScheme(),
 			Context:                  ctx,
@@ -589,6 +692,13 @@ func (c *Command) Run(args []string) int {
 			Client:              mgr.GetClient(),
 			ConsulClientConfig:  consulConfig,
 			ConsulServerConnMgr: watcher,
+			VaultSecretBackend:  vaultSecretBackend,
+			SecretPollInterval:  c.flagPeeringSecretPollInterval,
+			HealthCheckInterval: c.flagPeeringHealthCheckInterval,
+			AutoRedial:          c.flagEnablePeeringAutoRedial,
+			RedialBackoff:       c.flagPeeringRedialBackoff,
+			MaxRedialBackoff:    c.flagPeeringMaxRedialBackoff,
+			EventRecorder:       mgr.GetEventRecorderFor("consul-peering-dialer-controller"),
 			Log:                 ctrl.Log.WithName("controller").WithName("peering-dialer"),
 			Scheme:              mgr.GetScheme(),
 			Context:             ctx,
@@ -645,6 +755,7 @@ func (c *Command) Run(args []string) int {
 			CrossNamespaceACLPolicy:      c.flagCrossNamespaceACLPolicy,
 			EnableTransparentProxy:       c.flagDefaultEnableTransparentProxy,
 			EnableCNI:                    c.flagEnableCNI,
+			EnableCNINodeAffinity:        c.flagEnableCNINodeAffinity,
 			TProxyOverwriteProbes:        c.flagTransparentProxyDefaultOverwriteProbes,
 			EnableConsulDNS:              c.flagEnableConsulDNS,
 			EnableOpenShift:              c.flagEnableOpenShift,
@@ -721,6 +832,12 @@ func (c *Command) Run(args []string) int {
 			Logger:     ctrl.Log.WithName("webhooks").WithName(apicommon.SamenessGroup),
 			ConsulMeta: consulMeta,
 		}})
+	mgr.GetWebhookServer().Register("/mutate-v1alpha1-configentry",
+		&ctrlRuntimeWebhook.Admission{Handler: &v1alpha1.ConfigEntryWebhook{
+			Client:     mgr.GetClient(),
+			Logger:     ctrl.Log.WithName("webhooks").WithName(apicommon.ConfigEntry),
+			ConsulMeta: consulMeta,
+		}})
 
 	if c.flagEnableWebhookCAUpdate {
 		err = c.updateWebhookCABundle(ctx)
@@ -775,6 +892,30 @@ func (c *Command) validateFlags() error {
 		return errors.New("-default-envoy-proxy-concurrency must be >= 0 if set")
 	}
 
+	if c.flagConfigEntryOrphanSweepInterval < 0 {
+		return errors.New("-config-entry-orphan-sweep-interval must be >= 0 if set")
+	}
+
+	if c.flagConfigEntryOrphanSweepGracePeriod < 0 {
+		return errors.New("-config-entry-orphan-sweep-grace-period must be >= 0 if set")
+	}
+
+	if c.flagPeeringSecretPollInterval < 0 {
+		return errors.New("-peering-secret-poll-interval must be >= 0 if set")
+	}
+
+	if c.flagPeeringHealthCheckInterval < 0 {
+		return errors.New("-peering-health-check-interval must be >= 0 if set")
+	}
+
+	if c.flagPeeringRedialBackoff < 0 {
+		return errors.New("-peering-redial-backoff must be >= 0 if set")
+	}
+
+	if c.flagPeeringMaxRedialBackoff < c.flagPeeringRedialBackoff {
+		return errors.New("-peering-max-redial-backoff must be >= -peering-redial-backoff")
+	}
+
 	return nil
 }
 
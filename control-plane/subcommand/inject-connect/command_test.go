@@ -132,6 +132,42 @@ func TestRun_FlagValidation(t *testing.T) {
 			},
 			expErr: "-default-envoy-proxy-concurrency must be >= 0 if set",
 		},
+		{
+			flags: []string{"-consul-k8s-image", "foo", "-consul-image", "foo", "-consul-dataplane-image", "consul-dataplane:1.14.0",
+				"-config-entry-orphan-sweep-interval=-1m",
+			},
+			expErr: "-config-entry-orphan-sweep-interval must be >= 0 if set",
+		},
+		{
+			flags: []string{"-consul-k8s-image", "foo", "-consul-image", "foo", "-consul-dataplane-image", "consul-dataplane:1.14.0",
+				"-config-entry-orphan-sweep-grace-period=-1m",
+			},
+			expErr: "-config-entry-orphan-sweep-grace-period must be >= 0 if set",
+		},
+		{
+			flags: []string{"-consul-k8s-image", "foo", "-consul-image", "foo", "-consul-dataplane-image", "consul-dataplane:1.14.0",
+				"-peering-secret-poll-interval=-1m",
+			},
+			expErr: "-peering-secret-poll-interval must be >= 0 if set",
+		},
+		{
+			flags: []string{"-consul-k8s-image", "foo", "-consul-image", "foo", "-consul-dataplane-image", "consul-dataplane:1.14.0",
+				"-peering-health-check-interval=-1m",
+			},
+			expErr: "-peering-health-check-interval must be >= 0 if set",
+		},
+		{
+			flags: []string{"-consul-k8s-image", "foo", "-consul-image", "foo", "-consul-dataplane-image", "consul-dataplane:1.14.0",
+				"-peering-redial-backoff=-1m",
+			},
+			expErr: "-peering-redial-backoff must be >= 0 if set",
+		},
+		{
+			flags: []string{"-consul-k8s-image", "foo", "-consul-image", "foo", "-consul-dataplane-image", "consul-dataplane:1.14.0",
+				"-peering-redial-backoff=10m", "-peering-max-redial-backoff=1m",
+			},
+			expErr: "-peering-max-redial-backoff must be >= -peering-redial-backoff",
+		},
 	}
 
 	for _, c := range cases {
@@ -0,0 +1,441 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package inject
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/consul-k8s/control-plane/connect-inject/webhook"
+	"github.com/hashicorp/consul-k8s/control-plane/subcommand/flags"
+	"github.com/mitchellh/cli"
+	"gomodules.xyz/jsonpatch/v2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	k8syaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	outputYAML      = "yaml"
+	outputJSONPatch = "json-patch"
+
+	serviceAccountTokenVolumeName = "kube-api-access"
+	serviceAccountTokenMountPath  = "/var/run/secrets/kubernetes.io/serviceaccount"
+)
+
+// podTemplatePaths are the paths of the pod templates of the kinds that can be injected. Pods are injected directly
+// so their path is empty.
+var podTemplatePaths = map[string][]string{
+	"Pod":         {},
+	"Deployment":  {"spec", "template"},
+	"StatefulSet": {"spec", "template"},
+	"DaemonSet":   {"spec", "template"},
+	"ReplicaSet":  {"spec", "template"},
+	"Job":         {"spec", "template"},
+	"CronJob":     {"spec", "jobTemplate", "spec", "template"},
+}
+
+// Command renders the changes the connect injector makes to pods without a Kubernetes cluster.
+type Command struct {
+	UI cli.Ui
+
+	flagSet *flag.FlagSet
+
+	flagFile             string
+	flagValues           []string
+	flagNamespace        string
+	flagNamespaceLabels  map[string]string
+	flagReleaseName      string
+	flagReleaseNamespace string
+	flagCACertFile       string
+	flagResolvConf       string
+	flagOutput           string
+
+	// stdin is read when the file is "-". It's set in tests.
+	stdin io.Reader
+
+	once sync.Once
+	help string
+}
+
+func (c *Command) init() {
+	c.flagSet = flag.NewFlagSet("", flag.ContinueOnError)
+	c.flagSet.StringVar(&c.flagFile, "f", "",
+		"Path to the file with the Kubernetes manifests to inject, or \"-\" to read them from stdin. "+
+			"Pods, Deployments, StatefulSets, DaemonSets, ReplicaSets, Jobs and CronJobs are injected, "+
+			"other resources are written out unchanged.")
+	c.flagSet.Var((*flags.AppendSliceValue)(&c.flagValues), "values",
+		"Path to a Helm values file of the Consul installation. May be specified multiple times, "+
+			"values in later files take precedence. Unset values default to those of the Helm chart.")
+	c.flagSet.StringVar(&c.flagNamespace, "namespace", "default",
+		"Kubernetes namespace of the resources that don't set one.")
+	c.flagSet.Var((*flags.FlagMapValue)(&c.flagNamespaceLabels), "namespace-label",
+		"Label of the Kubernetes namespace of the resources in the form key=value. May be specified multiple times.")
+	c.flagSet.StringVar(&c.flagReleaseName, "release-name", "consul",
+		"The Consul Helm installation release name, e.g 'helm install <RELEASE-NAME>'.")
+	c.flagSet.StringVar(&c.flagReleaseNamespace, "release-namespace", "consul",
+		"The Consul Helm installation namespace, e.g 'helm install <RELEASE-NAME> --namespace <RELEASE-NAMESPACE>'.")
+	c.flagSet.StringVar(&c.flagCACertFile, "ca-cert-file", "",
+		"Path to the PEM-encoded CA certificate of the Consul servers. Only used if TLS is enabled.")
+	c.flagSet.StringVar(&c.flagResolvConf, "resolv-conf", "",
+		"Path to the resolv.conf file with the nameservers of the cluster. Only used if DNS redirection is enabled. "+
+			"Defaults to /etc/resolv.conf.")
+	c.flagSet.StringVar(&c.flagOutput, "output", outputYAML,
+		fmt.Sprintf("Output format, one of %q or %q. %q writes the JSON patches of the injected resources.",
+			outputYAML, outputJSONPatch, outputJSONPatch))
+
+	c.help = flags.Usage(help, c.flagSet)
+}
+
+// Run renders the injected manifests.
+func (c *Command) Run(args []string) int {
+	c.once.Do(c.init)
+
+	if err := c.flagSet.Parse(args); err != nil {
+		c.UI.Error(fmt.Sprintf("Error parsing flags: %s", err))
+		return 1
+	}
+	if c.flagFile == "" {
+		c.UI.Error("-f must be set")
+		return 1
+	}
+	if c.flagOutput != outputYAML && c.flagOutput != outputJSONPatch {
+		c.UI.Error(fmt.Sprintf("-output must be one of %q or %q", outputYAML, outputJSONPatch))
+		return 1
+	}
+
+	v, err := readValues(c.flagValues)
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+	w, err := v.meshWebhook(c.flagReleaseName, c.flagReleaseNamespace)
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Error configuring injector from values: %s", err))
+		return 1
+	}
+	w.EtcResolvFile = c.flagResolvConf
+	if c.flagCACertFile != "" {
+		caCert, err := os.ReadFile(c.flagCACertFile)
+		if err != nil {
+			c.UI.Error(fmt.Sprintf("Error reading CA certificate file: %s", err))
+			return 1
+		}
+		w.ConsulCACert = string(caCert)
+	}
+
+	docs, err := c.readManifests()
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	var out []string
+	var patches []objectPatch
+	for i, doc := range docs {
+		patch, err := c.inject(w, doc)
+		if err != nil {
+			c.UI.Error(fmt.Sprintf("Error injecting resource %d: %s", i+1, err))
+			return 1
+		}
+		if patch != nil {
+			patches = append(patches, *patch)
+		}
+
+		b, err := yaml.Marshal(doc)
+		if err != nil {
+			c.UI.Error(fmt.Sprintf("Error marshalling resource %d: %s", i+1, err))
+			return 1
+		}
+		out = append(out, string(b))
+	}
+
+	if c.flagOutput == outputJSONPatch {
+		if patches == nil {
+			patches = []objectPatch{}
+		}
+		b, err := json.MarshalIndent(patches, "", "  ")
+		if err != nil {
+			c.UI.Error(fmt.Sprintf("Error marshalling patches: %s", err))
+			return 1
+		}
+		c.UI.Output(string(b))
+		return 0
+	}
+	c.UI.Output(strings.TrimSuffix(strings.Join(out, "---\n"), "\n"))
+	return 0
+}
+
+// objectPatch is the JSON patch of an injected resource.
+type objectPatch struct {
+	APIVersion string                `json:"apiVersion"`
+	Kind       string                `json:"kind"`
+	Name       string                `json:"name"`
+	Namespace  string                `json:"namespace"`
+	Patch      []jsonpatch.Operation `json:"patch"`
+}
+
+// readManifests returns the documents of the manifests file. Empty documents are skipped.
+func (c *Command) readManifests() ([]map[string]interface{}, error) {
+	var r io.Reader
+	if c.flagFile == "-" {
+		r = c.stdin
+		if r == nil {
+			r = os.Stdin
+		}
+	} else {
+		f, err := os.Open(c.flagFile)
+		if err != nil {
+			return nil, fmt.Errorf("error opening manifests file: %s", err)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var docs []map[string]interface{}
+	reader := k8syaml.NewYAMLReader(bufio.NewReader(r))
+	for {
+		b, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading manifests: %s", err)
+		}
+		if len(bytes.TrimSpace(b)) == 0 {
+			continue
+		}
+
+		var doc map[string]interface{}
+		if err := yaml.Unmarshal(b, &doc); err != nil {
+			return nil, fmt.Errorf("error parsing manifest %d: %s", len(docs)+1, err)
+		}
+		if doc == nil {
+			continue
+		}
+		docs = append(docs, doc)
+	}
+	return docs, nil
+}
+
+// inject mutates the pod template of the resource in place the same way the webhook mutates pods created from it. It
+// returns the JSON patch of the resource if it was injected, or nil if it's not a resource with a pod template or
+// its pods aren't injected.
+func (c *Command) inject(w *webhook.MeshWebhook, doc map[string]interface{}) (*objectPatch, error) {
+	obj := unstructured.Unstructured{Object: doc}
+	path, ok := podTemplatePaths[obj.GetKind()]
+	if !ok {
+		return nil, nil
+	}
+
+	template := doc
+	if len(path) > 0 {
+		var found bool
+		var err error
+		template, found, err = unstructured.NestedMap(doc, path...)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			return nil, fmt.Errorf("%s %q has no %s", obj.GetKind(), obj.GetName(), strings.Join(path, "."))
+		}
+	}
+
+	// The pod template is round tripped through a pod so that the patch has the same paths as the one created by
+	// the webhook.
+	templateJSON, err := json.Marshal(template)
+	if err != nil {
+		return nil, err
+	}
+	var pod corev1.Pod
+	if err := json.Unmarshal(templateJSON, &pod); err != nil {
+		return nil, fmt.Errorf("error parsing pod template: %s", err)
+	}
+	origPodJSON, err := json.Marshal(podTemplate(pod))
+	if err != nil {
+		return nil, err
+	}
+
+	namespace := obj.GetNamespace()
+	if namespace == "" {
+		namespace = c.flagNamespace
+	}
+	if shouldInject, err := w.ShouldInject(&pod, namespace); err != nil {
+		return nil, err
+	} else if !shouldInject {
+		return nil, nil
+	}
+
+	// Pods are mutated by the service account admission controller before the webhook, which needs the service
+	// account token to log in with the auth method.
+	if w.AuthMethod != "" {
+		mountServiceAccountToken(&pod)
+	}
+
+	ns := corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   namespace,
+			Labels: c.flagNamespaceLabels,
+		},
+	}
+	if err := w.Mutate(context.Background(), &pod, ns); err != nil {
+		return nil, err
+	}
+
+	updatedPodJSON, err := json.Marshal(podTemplate(pod))
+	if err != nil {
+		return nil, err
+	}
+	patch, err := jsonpatch.CreatePatch(origPodJSON, updatedPodJSON)
+	if err != nil {
+		return nil, err
+	}
+	prefix := ""
+	if len(path) > 0 {
+		prefix = "/" + strings.Join(path, "/")
+	}
+	for i := range patch {
+		patch[i].Path = prefix + patch[i].Path
+	}
+
+	var updated map[string]interface{}
+	if err := json.Unmarshal(updatedPodJSON, &updated); err != nil {
+		return nil, err
+	}
+	for k, v := range updated {
+		template[k] = v
+	}
+	if len(path) > 0 {
+		if err := unstructured.SetNestedMap(doc, template, path...); err != nil {
+			return nil, err
+		}
+	}
+
+	return &objectPatch{
+		APIVersion: obj.GetAPIVersion(),
+		Kind:       obj.GetKind(),
+		Name:       obj.GetName(),
+		Namespace:  namespace,
+		Patch:      patch,
+	}, nil
+}
+
+// mountServiceAccountToken mounts the service account token into the containers of the pod the same way the service
+// account admission controller does, unless automounting is disabled or a container already mounts it. Because the
+// containers mount the token themselves afterwards, the admission controller leaves the pods created from the
+// injected template unchanged.
+func mountServiceAccountToken(pod *corev1.Pod) {
+	if pod.Spec.AutomountServiceAccountToken != nil && !*pod.Spec.AutomountServiceAccountToken {
+		return
+	}
+	for _, container := range append(pod.Spec.InitContainers, pod.Spec.Containers...) {
+		for _, vm := range container.VolumeMounts {
+			if vm.MountPath == serviceAccountTokenMountPath {
+				return
+			}
+		}
+	}
+
+	pod.Spec.Volumes = append(pod.Spec.Volumes, corev1.Volume{
+		Name: serviceAccountTokenVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			Projected: &corev1.ProjectedVolumeSource{
+				DefaultMode: pointer.Int32(0644),
+				Sources: []corev1.VolumeProjection{
+					{
+						ServiceAccountToken: &corev1.ServiceAccountTokenProjection{
+							ExpirationSeconds: pointer.Int64(3607),
+							Path:              "token",
+						},
+					},
+					{
+						ConfigMap: &corev1.ConfigMapProjection{
+							LocalObjectReference: corev1.LocalObjectReference{Name: "kube-root-ca.crt"},
+							Items:                []corev1.KeyToPath{{Key: "ca.crt", Path: "ca.crt"}},
+						},
+					},
+					{
+						DownwardAPI: &corev1.DownwardAPIProjection{
+							Items: []corev1.DownwardAPIVolumeFile{
+								{
+									Path:     "namespace",
+									FieldRef: &corev1.ObjectFieldSelector{APIVersion: "v1", FieldPath: "metadata.namespace"},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	})
+	mount := corev1.VolumeMount{
+		Name:      serviceAccountTokenVolumeName,
+		ReadOnly:  true,
+		MountPath: serviceAccountTokenMountPath,
+	}
+	for i := range pod.Spec.InitContainers {
+		pod.Spec.InitContainers[i].VolumeMounts = append(pod.Spec.InitContainers[i].VolumeMounts, mount)
+	}
+	for i := range pod.Spec.Containers {
+		pod.Spec.Containers[i].VolumeMounts = append(pod.Spec.Containers[i].VolumeMounts, mount)
+	}
+}
+
+// podTemplate returns the fields of the pod that are part of a pod template. The creation timestamp is dropped from
+// the metadata because it's always empty in manifests.
+func podTemplate(pod corev1.Pod) map[string]interface{} {
+	metadata := map[string]interface{}{}
+	if b, err := json.Marshal(pod.ObjectMeta); err == nil {
+		_ = json.Unmarshal(b, &metadata)
+	}
+	delete(metadata, "creationTimestamp")
+
+	template := map[string]interface{}{
+		"spec": pod.Spec,
+	}
+	if len(metadata) > 0 {
+		template["metadata"] = metadata
+	}
+	return template
+}
+
+// Synopsis returns the summary of the inject command.
+func (c *Command) Synopsis() string { return synopsis }
+
+// Help returns the help output of the command.
+func (c *Command) Help() string {
+	c.once.Do(c.init)
+	return c.help
+}
+
+const synopsis = "Render the connect injector's changes to Kubernetes manifests."
+const help = `
+Usage: consul-k8s-control-plane inject -f <manifests> [options]
+
+  Injects the Consul dataplane sidecar and connect-init container into the
+  pod templates of the Kubernetes manifests the same way the connect injector
+  webhook does, without a Kubernetes cluster or Consul servers. The injector
+  is configured from the Helm values of the Consul installation.
+
+  Mutated manifests are written to stdout. With -output=json-patch the JSON
+  patches of the injected resources are written instead.
+
+  When ACLs are enabled, the service account token is mounted into the
+  containers of the pod template the same way the service account admission
+  controller mounts it. Multi-port pods mount the secret with the same name
+  as each service's service account since secrets can't be looked up
+  offline.
+`
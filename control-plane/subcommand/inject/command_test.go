@@ -0,0 +1,285 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package inject
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/mitchellh/cli"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+func TestRun_FlagValidation(t *testing.T) {
+	cases := []struct {
+		args   []string
+		expErr string
+	}{
+		{
+			args:   []string{},
+			expErr: "-f must be set",
+		},
+		{
+			args:   []string{"-f", "testdata/manifests.yaml", "-output", "table"},
+			expErr: `-output must be one of "yaml" or "json-patch"`,
+		},
+		{
+			args:   []string{"-f", "testdata/does-not-exist.yaml"},
+			expErr: "error opening manifests file",
+		},
+		{
+			args:   []string{"-f", "testdata/manifests.yaml", "-values", "testdata/does-not-exist.yaml"},
+			expErr: "error reading values file",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.expErr, func(t *testing.T) {
+			ui := cli.NewMockUi()
+			cmd := Command{UI: ui}
+			code := cmd.Run(c.args)
+			require.Equal(t, 1, code)
+			require.Contains(t, ui.ErrorWriter.String(), c.expErr)
+		})
+	}
+}
+
+func TestRun_YAML(t *testing.T) {
+	ui := cli.NewMockUi()
+	cmd := Command{UI: ui}
+	code := cmd.Run([]string{
+		"-f", "testdata/manifests.yaml",
+		"-values", "testdata/values.yaml",
+		"-resolv-conf", "testdata/resolv.conf",
+	})
+	require.Equal(t, 0, code, ui.ErrorWriter.String())
+
+	docs := strings.Split(ui.OutputWriter.String(), "---\n")
+	require.Len(t, docs, 3)
+
+	// Resources without pod templates are unchanged.
+	var svc corev1.Service
+	require.NoError(t, yaml.Unmarshal([]byte(docs[0]), &svc))
+	require.Equal(t, "web", svc.Name)
+	require.Equal(t, map[string]string{"app": "web"}, svc.Spec.Selector)
+
+	var deployment appsv1.Deployment
+	require.NoError(t, yaml.Unmarshal([]byte(docs[1]), &deployment))
+	requireInjected(t, deployment.Spec.Template)
+	require.Equal(t, "web", deployment.Spec.Template.Spec.ServiceAccountName)
+	require.Equal(t, map[string]string{"app": "web"}, deployment.Spec.Selector.MatchLabels)
+	for _, container := range append(deployment.Spec.Template.Spec.InitContainers, deployment.Spec.Template.Spec.Containers...) {
+		require.Contains(t, container.VolumeMounts, corev1.VolumeMount{
+			Name:      serviceAccountTokenVolumeName,
+			ReadOnly:  true,
+			MountPath: serviceAccountTokenMountPath,
+		})
+	}
+
+	var cronJob batchv1.CronJob
+	require.NoError(t, yaml.Unmarshal([]byte(docs[2]), &cronJob))
+	requireInjected(t, cronJob.Spec.JobTemplate.Spec.Template)
+	require.Equal(t, "0 * * * *", cronJob.Spec.Schedule)
+}
+
+func TestRun_DNS(t *testing.T) {
+	ui := cli.NewMockUi()
+	cmd := Command{UI: ui}
+	code := cmd.Run([]string{
+		"-f", "testdata/manifests.yaml",
+		"-resolv-conf", "testdata/resolv.conf",
+	})
+	require.Equal(t, 0, code, ui.ErrorWriter.String())
+
+	docs := strings.Split(ui.OutputWriter.String(), "---\n")
+	require.Len(t, docs, 3)
+	var deployment appsv1.Deployment
+	require.NoError(t, yaml.Unmarshal([]byte(docs[1]), &deployment))
+	podSpec := deployment.Spec.Template.Spec
+	require.Equal(t, corev1.DNSNone, podSpec.DNSPolicy)
+	require.NotNil(t, podSpec.DNSConfig)
+	require.Equal(t, []string{"127.0.0.1", "10.96.0.10"}, podSpec.DNSConfig.Nameservers)
+	// The search domain of the release namespace is replaced with the pod's namespace.
+	require.Equal(t, []string{"default.svc.cluster.local", "svc.cluster.local", "cluster.local"}, podSpec.DNSConfig.Searches)
+}
+
+func TestRun_NotInjected(t *testing.T) {
+	cases := map[string]struct {
+		manifest string
+		args     []string
+	}{
+		"no annotation and injection isn't the default": {
+			manifest: `apiVersion: v1
+kind: Pod
+metadata:
+  name: web
+spec:
+  containers:
+  - image: web
+    name: web
+`,
+		},
+		"injection disabled by annotation": {
+			manifest: `apiVersion: v1
+kind: Pod
+metadata:
+  annotations:
+    consul.hashicorp.com/connect-inject: "false"
+  name: web
+spec:
+  containers:
+  - image: web
+    name: web
+`,
+		},
+		"system namespace": {
+			manifest: `apiVersion: v1
+kind: Pod
+metadata:
+  annotations:
+    consul.hashicorp.com/connect-inject: "true"
+  name: web
+  namespace: kube-system
+spec:
+  containers:
+  - image: web
+    name: web
+`,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			ui := cli.NewMockUi()
+			cmd := Command{UI: ui, stdin: strings.NewReader(c.manifest)}
+			code := cmd.Run(append([]string{"-f", "-"}, c.args...))
+			require.Equal(t, 0, code, ui.ErrorWriter.String())
+			require.Equal(t, c.manifest, ui.OutputWriter.String())
+		})
+	}
+}
+
+func TestRun_JSONPatch(t *testing.T) {
+	ui := cli.NewMockUi()
+	cmd := Command{UI: ui}
+	code := cmd.Run([]string{
+		"-f", "testdata/manifests.yaml",
+		"-values", "testdata/values.yaml",
+		"-output", "json-patch",
+	})
+	require.Equal(t, 0, code, ui.ErrorWriter.String())
+
+	var patches []objectPatch
+	require.NoError(t, json.Unmarshal(ui.OutputWriter.Bytes(), &patches))
+	require.Len(t, patches, 2)
+
+	expPrefixes := map[string]string{
+		"Deployment": "/spec/template/",
+		"CronJob":    "/spec/jobTemplate/spec/template/",
+	}
+	expNamespaces := map[string]string{
+		"Deployment": "default",
+		"CronJob":    "jobs",
+	}
+	for _, p := range patches {
+		require.Equal(t, expNamespaces[p.Kind], p.Namespace)
+		require.NotEmpty(t, p.Patch)
+		var addsSidecar bool
+		for _, op := range p.Patch {
+			require.True(t, strings.HasPrefix(op.Path, expPrefixes[p.Kind]), op.Path)
+			if op.Path == expPrefixes[p.Kind]+"spec/containers/1" {
+				addsSidecar = true
+			}
+		}
+		require.True(t, addsSidecar, "patch of %s doesn't add the sidecar", p.Kind)
+	}
+}
+
+func TestRun_NamespaceLabels(t *testing.T) {
+	manifest := `apiVersion: v1
+kind: Pod
+metadata:
+  annotations:
+    consul.hashicorp.com/connect-inject: "true"
+  name: web
+spec:
+  containers:
+  - image: web
+    name: web
+`
+	ui := cli.NewMockUi()
+	cmd := Command{UI: ui, stdin: strings.NewReader(manifest)}
+	code := cmd.Run([]string{
+		"-f", "-",
+		"-namespace-label", "consul.hashicorp.com/transparent-proxy=false",
+	})
+	require.Equal(t, 0, code, ui.ErrorWriter.String())
+
+	var pod corev1.Pod
+	require.NoError(t, yaml.Unmarshal(ui.OutputWriter.Bytes(), &pod))
+	require.Equal(t, "web", pod.Name)
+	require.Equal(t, "injected", pod.Annotations["consul.hashicorp.com/connect-inject-status"])
+	require.NotContains(t, pod.Annotations, "consul.hashicorp.com/transparent-proxy-status")
+	require.Nil(t, pod.Spec.DNSConfig)
+}
+
+func TestMountServiceAccountToken(t *testing.T) {
+	existingMount := corev1.VolumeMount{Name: "token", MountPath: serviceAccountTokenMountPath}
+	cases := map[string]struct {
+		pod       corev1.Pod
+		expMounts bool
+	}{
+		"mounts token": {
+			pod: corev1.Pod{Spec: corev1.PodSpec{
+				InitContainers: []corev1.Container{{Name: "init"}},
+				Containers:     []corev1.Container{{Name: "web"}},
+			}},
+			expMounts: true,
+		},
+		"automount disabled": {
+			pod: corev1.Pod{Spec: corev1.PodSpec{
+				AutomountServiceAccountToken: new(bool),
+				Containers:                   []corev1.Container{{Name: "web"}},
+			}},
+		},
+		"already mounted": {
+			pod: corev1.Pod{Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{Name: "web", VolumeMounts: []corev1.VolumeMount{existingMount}}},
+			}},
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			pod := c.pod.DeepCopy()
+			mountServiceAccountToken(pod)
+			if !c.expMounts {
+				require.Equal(t, c.pod, *pod)
+				return
+			}
+			require.Len(t, pod.Spec.Volumes, 1)
+			require.Equal(t, serviceAccountTokenVolumeName, pod.Spec.Volumes[0].Name)
+			require.NotNil(t, pod.Spec.Volumes[0].Projected)
+			for _, container := range append(pod.Spec.InitContainers, pod.Spec.Containers...) {
+				require.Equal(t, []corev1.VolumeMount{{
+					Name:      serviceAccountTokenVolumeName,
+					ReadOnly:  true,
+					MountPath: serviceAccountTokenMountPath,
+				}}, container.VolumeMounts)
+			}
+		})
+	}
+}
+
+func requireInjected(t *testing.T, template corev1.PodTemplateSpec) {
+	t.Helper()
+	require.Equal(t, "injected", template.Annotations["consul.hashicorp.com/connect-inject-status"])
+	require.Equal(t, "injected", template.Labels["consul.hashicorp.com/connect-inject-status"])
+	require.Len(t, template.Spec.InitContainers, 1)
+	require.Equal(t, "consul-connect-inject-init", template.Spec.InitContainers[0].Name)
+	require.Len(t, template.Spec.Containers, 2)
+	require.Equal(t, "consul-dataplane", template.Spec.Containers[1].Name)
+}
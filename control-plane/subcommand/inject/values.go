@@ -0,0 +1,369 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package inject
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	mapset "github.com/deckarep/golang-set"
+	"github.com/go-logr/logr"
+	"github.com/hashicorp/consul-k8s/control-plane/connect-inject/metrics"
+	"github.com/hashicorp/consul-k8s/control-plane/connect-inject/webhook"
+	"github.com/hashicorp/consul-k8s/control-plane/consul"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/yaml"
+)
+
+// dashDefault is the value used in the Helm chart for settings that default to the value of another setting.
+const dashDefault = "-"
+
+// values is the subset of the Helm chart values that configures the connect injector.
+type values struct {
+	FullnameOverride string `json:"fullnameOverride"`
+	NameOverride     string `json:"nameOverride"`
+
+	Global struct {
+		Enabled                bool   `json:"enabled"`
+		Name                   string `json:"name"`
+		Domain                 string `json:"domain"`
+		Datacenter             string `json:"datacenter"`
+		Image                  string `json:"image"`
+		ImageK8S               string `json:"imageK8S"`
+		ImageConsulDataplane   string `json:"imageConsulDataplane"`
+		ConsulAPITimeout       string `json:"consulAPITimeout"`
+		EnableConsulNamespaces bool   `json:"enableConsulNamespaces"`
+		LogLevel               string `json:"logLevel"`
+		LogJSON                bool   `json:"logJSON"`
+
+		AdminPartitions struct {
+			Enabled bool   `json:"enabled"`
+			Name    string `json:"name"`
+		} `json:"adminPartitions"`
+		ACLs struct {
+			ManageSystemACLs bool `json:"manageSystemACLs"`
+		} `json:"acls"`
+		TLS struct {
+			Enabled bool `json:"enabled"`
+		} `json:"tls"`
+		Metrics struct {
+			Enabled              bool `json:"enabled"`
+			EnableGatewayMetrics bool `json:"enableGatewayMetrics"`
+		} `json:"metrics"`
+		OpenShift struct {
+			Enabled bool `json:"enabled"`
+		} `json:"openshift"`
+		Cloud struct {
+			Enabled bool `json:"enabled"`
+		} `json:"cloud"`
+	} `json:"global"`
+
+	ExternalServers struct {
+		Enabled         bool     `json:"enabled"`
+		Hosts           []string `json:"hosts"`
+		HTTPSPort       int      `json:"httpsPort"`
+		GRPCPort        int      `json:"grpcPort"`
+		TLSServerName   string   `json:"tlsServerName"`
+		SkipServerWatch bool     `json:"skipServerWatch"`
+	} `json:"externalServers"`
+
+	DNS struct {
+		Enabled           interface{} `json:"enabled"`
+		EnableRedirection interface{} `json:"enableRedirection"`
+	} `json:"dns"`
+
+	ConnectInject struct {
+		Default                bool     `json:"default"`
+		Image                  string   `json:"image"`
+		ImageConsul            string   `json:"imageConsul"`
+		LogLevel               string   `json:"logLevel"`
+		EnvoyExtraArgs         string   `json:"envoyExtraArgs"`
+		OverrideAuthMethodName string   `json:"overrideAuthMethodName"`
+		K8sAllowNamespaces     []string `json:"k8sAllowNamespaces"`
+		K8sDenyNamespaces      []string `json:"k8sDenyNamespaces"`
+
+		TransparentProxy struct {
+			DefaultEnabled         bool `json:"defaultEnabled"`
+			DefaultOverwriteProbes bool `json:"defaultOverwriteProbes"`
+		} `json:"transparentProxy"`
+		CNI struct {
+			Enabled      bool `json:"enabled"`
+			NodeAffinity bool `json:"nodeAffinity"`
+		} `json:"cni"`
+		Metrics struct {
+			DefaultEnabled              interface{}        `json:"defaultEnabled"`
+			DefaultEnableMerging        bool               `json:"defaultEnableMerging"`
+			DefaultMergedMetricsPort    intstr.IntOrString `json:"defaultMergedMetricsPort"`
+			DefaultPrometheusScrapePort intstr.IntOrString `json:"defaultPrometheusScrapePort"`
+			DefaultPrometheusScrapePath string             `json:"defaultPrometheusScrapePath"`
+		} `json:"metrics"`
+		ConsulNamespaces struct {
+			ConsulDestinationNamespace string `json:"consulDestinationNamespace"`
+			MirroringK8S               bool   `json:"mirroringK8S"`
+			MirroringK8SPrefix         string `json:"mirroringK8SPrefix"`
+		} `json:"consulNamespaces"`
+		SidecarProxy struct {
+			Concurrency int                  `json:"concurrency"`
+			Resources   resourceRequirements `json:"resources"`
+		} `json:"sidecarProxy"`
+		InitContainer struct {
+			Resources resourceRequirements `json:"resources"`
+		} `json:"initContainer"`
+	} `json:"connectInject"`
+}
+
+// resourceRequirements are the resources of a container in the Helm values. Unset values are nil.
+type resourceRequirements struct {
+	Requests resourceList `json:"requests"`
+	Limits   resourceList `json:"limits"`
+}
+
+type resourceList struct {
+	CPU    *resource.Quantity `json:"cpu"`
+	Memory *resource.Quantity `json:"memory"`
+}
+
+// defaultValues returns the default values of the Helm chart.
+func defaultValues() *values {
+	v := &values{}
+	v.Global.Enabled = true
+	v.Global.Domain = "consul"
+	v.Global.Datacenter = "dc1"
+	v.Global.Image = "hashicorp/consul:1.15.1"
+	v.Global.ImageK8S = "docker.mirror.hashicorp.services/hashicorppreview/consul-k8s-control-plane:1.2.0-dev"
+	v.Global.ImageConsulDataplane = "hashicorp/consul-dataplane:1.1.0"
+	v.Global.ConsulAPITimeout = "5s"
+	v.Global.LogLevel = "info"
+
+	v.ExternalServers.HTTPSPort = 8501
+	v.ExternalServers.GRPCPort = 8502
+
+	v.DNS.Enabled = dashDefault
+	v.DNS.EnableRedirection = dashDefault
+
+	v.ConnectInject.K8sAllowNamespaces = []string{"*"}
+	v.ConnectInject.TransparentProxy.DefaultEnabled = true
+	v.ConnectInject.TransparentProxy.DefaultOverwriteProbes = true
+	v.ConnectInject.Metrics.DefaultEnabled = dashDefault
+	v.ConnectInject.Metrics.DefaultMergedMetricsPort = intstr.FromInt(20100)
+	v.ConnectInject.Metrics.DefaultPrometheusScrapePort = intstr.FromInt(20200)
+	v.ConnectInject.Metrics.DefaultPrometheusScrapePath = "/metrics"
+	v.ConnectInject.ConsulNamespaces.ConsulDestinationNamespace = "default"
+	v.ConnectInject.ConsulNamespaces.MirroringK8S = true
+	v.ConnectInject.SidecarProxy.Concurrency = 2
+	v.ConnectInject.InitContainer.Resources = resourceRequirements{
+		Requests: resourceList{CPU: quantity("50m"), Memory: quantity("25Mi")},
+		Limits:   resourceList{Memory: quantity("150Mi")},
+	}
+	return v
+}
+
+// readValues returns the default values of the Helm chart merged with the values files. Like with Helm, the values
+// of later files take precedence.
+func readValues(files []string) (*values, error) {
+	v := defaultValues()
+	for _, file := range files {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("error reading values file: %s", err)
+		}
+		if err := yaml.Unmarshal(b, v); err != nil {
+			return nil, fmt.Errorf("error parsing values file %s: %s", file, err)
+		}
+	}
+	return v, nil
+}
+
+// fullname returns the name prefix of the resources of the Helm release. It mirrors the consul.fullname helper in
+// the chart.
+func (v *values) fullname(releaseName string) string {
+	name := v.FullnameOverride
+	if name == "" {
+		name = v.Global.Name
+	}
+	if name == "" {
+		chartName := v.NameOverride
+		if chartName == "" {
+			chartName = "consul"
+		}
+		name = fmt.Sprintf("%s-%s", releaseName, chartName)
+	}
+	if len(name) > 63 {
+		name = name[:63]
+	}
+	return strings.TrimSuffix(name, "-")
+}
+
+// meshWebhook returns the webhook configured the way the connect-inject deployment of the Helm chart configures it.
+// The webhook has no Kubernetes or Consul clients so it can only be used to mutate pods.
+func (v *values) meshWebhook(releaseName, releaseNamespace string) (*webhook.MeshWebhook, error) {
+	apiTimeout, err := time.ParseDuration(v.Global.ConsulAPITimeout)
+	if err != nil {
+		return nil, fmt.Errorf("global.consulAPITimeout %q is not a valid duration: %s", v.Global.ConsulAPITimeout, err)
+	}
+	consulConfig := &consul.Config{
+		GRPCPort:   8502,
+		HTTPPort:   8500,
+		APITimeout: apiTimeout,
+	}
+	address := fmt.Sprintf("%s-server.%s.svc", v.fullname(releaseName), releaseNamespace)
+	if v.ExternalServers.Enabled {
+		if len(v.ExternalServers.Hosts) == 0 {
+			return nil, fmt.Errorf("externalServers.hosts must be set if externalServers.enabled is true")
+		}
+		address = v.ExternalServers.Hosts[0]
+		consulConfig.GRPCPort = v.ExternalServers.GRPCPort
+		consulConfig.HTTPPort = v.ExternalServers.HTTPSPort
+	} else if v.Global.TLS.Enabled {
+		consulConfig.HTTPPort = 8501
+	}
+
+	var tlsServerName string
+	if v.ExternalServers.Enabled && v.ExternalServers.TLSServerName != "" {
+		tlsServerName = v.ExternalServers.TLSServerName
+	} else if v.Global.Cloud.Enabled {
+		tlsServerName = fmt.Sprintf("server.%s.%s", v.Global.Datacenter, v.Global.Domain)
+	}
+
+	var authMethod string
+	if v.ConnectInject.OverrideAuthMethodName != "" {
+		authMethod = v.ConnectInject.OverrideAuthMethodName
+	} else if v.Global.ACLs.ManageSystemACLs {
+		authMethod = fmt.Sprintf("%s-k8s-auth-method", v.fullname(releaseName))
+	}
+
+	var partition string
+	if v.Global.AdminPartitions.Enabled {
+		partition = v.Global.AdminPartitions.Name
+	}
+
+	var crossNamespaceACLPolicy string
+	if v.Global.EnableConsulNamespaces && v.Global.ACLs.ManageSystemACLs {
+		crossNamespaceACLPolicy = "cross-namespace-policy"
+	}
+
+	allowNamespaces := mapset.NewSet()
+	for _, ns := range v.ConnectInject.K8sAllowNamespaces {
+		allowNamespaces.Add(ns)
+	}
+	denyNamespaces := mapset.NewSet()
+	for _, ns := range v.ConnectInject.K8sDenyNamespaces {
+		denyNamespaces.Add(ns)
+	}
+
+	imageConsul := v.ConnectInject.ImageConsul
+	if imageConsul == "" {
+		imageConsul = v.Global.Image
+	}
+	imageConsulK8S := v.ConnectInject.Image
+	if imageConsulK8S == "" {
+		imageConsulK8S = v.Global.ImageK8S
+	}
+	logLevel := v.ConnectInject.LogLevel
+	if logLevel == "" {
+		logLevel = v.Global.LogLevel
+	}
+
+	sidecarResources := v.ConnectInject.SidecarProxy.Resources
+	w := &webhook.MeshWebhook{
+		ConsulConfig:                 consulConfig,
+		ImageConsul:                  imageConsul,
+		ImageConsulDataplane:         v.Global.ImageConsulDataplane,
+		EnvoyExtraArgs:               v.ConnectInject.EnvoyExtraArgs,
+		ImageConsulK8S:               imageConsulK8S,
+		RequireAnnotation:            !v.ConnectInject.Default,
+		AuthMethod:                   authMethod,
+		TLSEnabled:                   v.Global.TLS.Enabled,
+		ConsulAddress:                address,
+		SkipServerWatch:              v.ExternalServers.Enabled && v.ExternalServers.SkipServerWatch,
+		ConsulTLSServerName:          tlsServerName,
+		DefaultProxyCPURequest:       quantityOrZero(sidecarResources.Requests.CPU),
+		DefaultProxyCPULimit:         quantityOrZero(sidecarResources.Limits.CPU),
+		DefaultProxyMemoryRequest:    quantityOrZero(sidecarResources.Requests.Memory),
+		DefaultProxyMemoryLimit:      quantityOrZero(sidecarResources.Limits.Memory),
+		DefaultEnvoyProxyConcurrency: v.ConnectInject.SidecarProxy.Concurrency,
+		MetricsConfig: metrics.Config{
+			DefaultEnableMetrics:        dashBool(v.ConnectInject.Metrics.DefaultEnabled, v.Global.Metrics.Enabled),
+			EnableGatewayMetrics:        v.Global.Metrics.EnableGatewayMetrics,
+			DefaultEnableMetricsMerging: v.ConnectInject.Metrics.DefaultEnableMerging,
+			DefaultMergedMetricsPort:    v.ConnectInject.Metrics.DefaultMergedMetricsPort.String(),
+			DefaultPrometheusScrapePort: v.ConnectInject.Metrics.DefaultPrometheusScrapePort.String(),
+			DefaultPrometheusScrapePath: v.ConnectInject.Metrics.DefaultPrometheusScrapePath,
+		},
+		InitContainerResources:     v.initContainerResources(),
+		ConsulPartition:            partition,
+		AllowK8sNamespacesSet:      allowNamespaces,
+		DenyK8sNamespacesSet:       denyNamespaces,
+		EnableNamespaces:           v.Global.EnableConsulNamespaces,
+		ConsulDestinationNamespace: v.ConnectInject.ConsulNamespaces.ConsulDestinationNamespace,
+		EnableK8SNSMirroring:       v.Global.EnableConsulNamespaces && v.ConnectInject.ConsulNamespaces.MirroringK8S,
+		K8SNSMirroringPrefix:       v.ConnectInject.ConsulNamespaces.MirroringK8SPrefix,
+		CrossNamespaceACLPolicy:    crossNamespaceACLPolicy,
+		EnableTransparentProxy:     v.ConnectInject.TransparentProxy.DefaultEnabled,
+		EnableCNI:                  v.ConnectInject.CNI.Enabled,
+		EnableCNINodeAffinity:      v.ConnectInject.CNI.NodeAffinity,
+		TProxyOverwriteProbes:      v.ConnectInject.TransparentProxy.DefaultOverwriteProbes,
+		EnableConsulDNS: dashBool(v.DNS.Enabled, v.ConnectInject.TransparentProxy.DefaultEnabled) &&
+			dashBool(v.DNS.EnableRedirection, v.ConnectInject.TransparentProxy.DefaultEnabled),
+		EnableOpenShift:  v.Global.OpenShift.Enabled,
+		ReleaseNamespace: releaseNamespace,
+		Log:              logr.Discard(),
+		LogLevel:         logLevel,
+		LogJSON:          v.Global.LogJSON,
+	}
+	return w, nil
+}
+
+// initContainerResources returns the resources of the connect-init container. Unset values default to the same
+// values as the flags of the inject-connect command.
+func (v *values) initContainerResources() corev1.ResourceRequirements {
+	r := v.ConnectInject.InitContainer.Resources
+	return corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{
+			corev1.ResourceCPU:    quantityOrDefault(r.Requests.CPU, "50m"),
+			corev1.ResourceMemory: quantityOrDefault(r.Requests.Memory, "25Mi"),
+		},
+		Limits: corev1.ResourceList{
+			corev1.ResourceCPU:    quantityOrDefault(r.Limits.CPU, "50m"),
+			corev1.ResourceMemory: quantityOrDefault(r.Limits.Memory, "150Mi"),
+		},
+	}
+}
+
+// dashBool returns the boolean value of a setting that can be set to "-" to use the value of another setting.
+func dashBool(value interface{}, dashValue bool) bool {
+	switch v := value.(type) {
+	case bool:
+		return v
+	case string:
+		if v == dashDefault {
+			return dashValue
+		}
+		return v == "true"
+	}
+	return false
+}
+
+func quantity(s string) *resource.Quantity {
+	q := resource.MustParse(s)
+	return &q
+}
+
+func quantityOrZero(q *resource.Quantity) resource.Quantity {
+	if q == nil {
+		return resource.Quantity{}
+	}
+	return *q
+}
+
+func quantityOrDefault(q *resource.Quantity, def string) resource.Quantity {
+	if q == nil {
+		return resource.MustParse(def)
+	}
+	return *q
+}
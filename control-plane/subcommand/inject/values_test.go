@@ -0,0 +1,160 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package inject
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/consul-k8s/control-plane/connect-inject/webhook"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValues_MeshWebhook(t *testing.T) {
+	cases := map[string]struct {
+		values string
+		verify func(t *testing.T, w *webhook.MeshWebhook)
+	}{
+		"defaults": {
+			verify: func(t *testing.T, w *webhook.MeshWebhook) {
+				require.Equal(t, "release-consul-server.consul.svc", w.ConsulAddress)
+				require.Equal(t, 8502, w.ConsulConfig.GRPCPort)
+				require.Equal(t, 8500, w.ConsulConfig.HTTPPort)
+				require.Equal(t, "hashicorp/consul-dataplane:1.1.0", w.ImageConsulDataplane)
+				require.True(t, w.RequireAnnotation)
+				require.Empty(t, w.AuthMethod)
+				require.True(t, w.EnableTransparentProxy)
+				require.True(t, w.EnableConsulDNS)
+				require.False(t, w.MetricsConfig.DefaultEnableMetrics)
+				require.Equal(t, "20100", w.MetricsConfig.DefaultMergedMetricsPort)
+				require.True(t, w.AllowK8sNamespacesSet.Contains("*"))
+				require.True(t, w.DefaultProxyCPURequest.IsZero())
+				require.Equal(t, "50m", w.InitContainerResources.Limits.Cpu().String())
+				require.Equal(t, "info", w.LogLevel)
+			},
+		},
+		"name overrides": {
+			values: `
+global:
+  name: custom
+`,
+			verify: func(t *testing.T, w *webhook.MeshWebhook) {
+				require.Equal(t, "custom-server.consul.svc", w.ConsulAddress)
+			},
+		},
+		"acls, tls and namespaces": {
+			values: `
+global:
+  enableConsulNamespaces: true
+  tls:
+    enabled: true
+  acls:
+    manageSystemACLs: true
+connectInject:
+  consulNamespaces:
+    mirroringK8SPrefix: k8s-
+`,
+			verify: func(t *testing.T, w *webhook.MeshWebhook) {
+				require.Equal(t, "release-consul-k8s-auth-method", w.AuthMethod)
+				require.True(t, w.TLSEnabled)
+				require.Equal(t, 8501, w.ConsulConfig.HTTPPort)
+				require.True(t, w.EnableNamespaces)
+				require.True(t, w.EnableK8SNSMirroring)
+				require.Equal(t, "k8s-", w.K8SNSMirroringPrefix)
+				require.Equal(t, "cross-namespace-policy", w.CrossNamespaceACLPolicy)
+			},
+		},
+		"external servers": {
+			values: `
+global:
+  tls:
+    enabled: true
+externalServers:
+  enabled: true
+  hosts: ["consul.example.com", "consul2.example.com"]
+  httpsPort: 443
+  tlsServerName: server.dc1.consul
+  skipServerWatch: true
+`,
+			verify: func(t *testing.T, w *webhook.MeshWebhook) {
+				require.Equal(t, "consul.example.com", w.ConsulAddress)
+				require.Equal(t, 443, w.ConsulConfig.HTTPPort)
+				require.Equal(t, "server.dc1.consul", w.ConsulTLSServerName)
+				require.True(t, w.SkipServerWatch)
+			},
+		},
+		"dash defaults": {
+			values: `
+global:
+  metrics:
+    enabled: true
+connectInject:
+  transparentProxy:
+    defaultEnabled: false
+dns:
+  enableRedirection: true
+`,
+			verify: func(t *testing.T, w *webhook.MeshWebhook) {
+				require.True(t, w.MetricsConfig.DefaultEnableMetrics)
+				require.False(t, w.EnableTransparentProxy)
+				// dns.enabled defaults to the transparent proxy default.
+				require.False(t, w.EnableConsulDNS)
+			},
+		},
+		"resources": {
+			values: `
+connectInject:
+  sidecarProxy:
+    concurrency: 4
+    resources:
+      requests:
+        cpu: 1
+        memory: 100Mi
+  initContainer:
+    resources:
+      limits:
+        cpu: 200m
+        memory: null
+`,
+			verify: func(t *testing.T, w *webhook.MeshWebhook) {
+				require.Equal(t, 4, w.DefaultEnvoyProxyConcurrency)
+				require.Equal(t, "1", w.DefaultProxyCPURequest.String())
+				require.Equal(t, "100Mi", w.DefaultProxyMemoryRequest.String())
+				require.True(t, w.DefaultProxyMemoryLimit.IsZero())
+				require.Equal(t, "200m", w.InitContainerResources.Limits.Cpu().String())
+				// Unset values default to the inject-connect flag defaults.
+				require.Equal(t, "150Mi", w.InitContainerResources.Limits.Memory().String())
+				require.Equal(t, "25Mi", w.InitContainerResources.Requests.Memory().String())
+			},
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			var files []string
+			if c.values != "" {
+				file := filepath.Join(t.TempDir(), "values.yaml")
+				require.NoError(t, os.WriteFile(file, []byte(c.values), 0600))
+				files = append(files, file)
+			}
+			v, err := readValues(files)
+			require.NoError(t, err)
+			w, err := v.meshWebhook("release", "consul")
+			require.NoError(t, err)
+			c.verify(t, w)
+		})
+	}
+}
+
+func TestValues_MeshWebhookErrors(t *testing.T) {
+	v := defaultValues()
+	v.ExternalServers.Enabled = true
+	_, err := v.meshWebhook("release", "consul")
+	require.EqualError(t, err, "externalServers.hosts must be set if externalServers.enabled is true")
+
+	v = defaultValues()
+	v.Global.ConsulAPITimeout = "five seconds"
+	_, err = v.meshWebhook("release", "consul")
+	require.ErrorContains(t, err, `global.consulAPITimeout "five seconds" is not a valid duration`)
+}
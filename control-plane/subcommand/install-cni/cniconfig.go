@@ -31,42 +31,47 @@ func defaultCNIConfigFile(dir string) (string, error) {
 
 	sort.Strings(files)
 	for _, confFile := range files {
-		var confList *libcni.NetworkConfigList
-		if strings.HasSuffix(confFile, ".conflist") {
-			confList, err = libcni.ConfListFromFile(confFile)
-			if err != nil {
-				// Error loading CNI config list file.
-				continue
-			}
-		} else {
-			conf, err := libcni.ConfFromFile(confFile)
-			if err != nil {
-				// Error loading CNI config file.
-				continue
-			}
-			// Ensure the config has a "type" so we know what plugin to run.
-			// Also catches the case where somebody put a conflist into a conf file.
-			if conf.Network.Type == "" {
-				// Error loading CNI config file: no 'type'.
-				continue
-			}
-
-			confList, err = libcni.ConfListFromConf(conf)
-			if err != nil {
-				// Error converting CNI config file to list.
-				continue
-			}
-		}
-		if len(confList.Plugins) == 0 {
-			// CNI config list has no networks, skipping".
-			continue
+		if validCNIConfigFile(confFile) {
+			return confFile, nil
 		}
-		return confFile, nil
 	}
 	// There were files but none of them were valid
 	return "", fmt.Errorf("no valid config files found in %s", dir)
 }
 
+// validCNIConfigFile returns true if the file is a config or config list file with at least one plugin.
+func validCNIConfigFile(confFile string) bool {
+	var confList *libcni.NetworkConfigList
+	var err error
+	if strings.HasSuffix(confFile, ".conflist") {
+		confList, err = libcni.ConfListFromFile(confFile)
+		if err != nil {
+			// Error loading CNI config list file.
+			return false
+		}
+	} else {
+		conf, err := libcni.ConfFromFile(confFile)
+		if err != nil {
+			// Error loading CNI config file.
+			return false
+		}
+		// Ensure the config has a "type" so we know what plugin to run.
+		// Also catches the case where somebody put a conflist into a conf file.
+		if conf.Network.Type == "" {
+			// Error loading CNI config file: no 'type'.
+			return false
+		}
+
+		confList, err = libcni.ConfListFromConf(conf)
+		if err != nil {
+			// Error converting CNI config file to list.
+			return false
+		}
+	}
+	// A CNI config list with no networks is skipped.
+	return len(confList.Plugins) > 0
+}
+
 // confListFileFromConfFile converts a .conf file into a .conflist file. Chained plugins use .conflist files.
 func confListFileFromConfFile(cfgFile string) (string, error) {
 	if !strings.HasSuffix(cfgFile, ".conf") {
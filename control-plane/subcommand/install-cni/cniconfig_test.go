@@ -267,6 +267,17 @@ func TestConsulMapFromConfig(t *testing.T) {
 	require.Equal(t, expectedMap, actualMap)
 }
 
+// The redirect backend is only written to the config when it's set so that
+// existing configs stay valid.
+func TestConsulMapFromConfig_RedirectBackend(t *testing.T) {
+	consulConfig := config.NewDefaultCNIConfig()
+	consulConfig.RedirectBackend = "nftables"
+
+	actualMap, err := consulMapFromConfig(consulConfig)
+	require.NoError(t, err)
+	require.Equal(t, "nftables", actualMap["redirect_backend"])
+}
+
 // TestRemoveCNIConfig tests the writing of the config file.
 // Doing the opposite of the TestAppendCNIConfig test. We start with a proper golden file and should
 // end up with an empty cfg file.
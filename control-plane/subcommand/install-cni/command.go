@@ -7,25 +7,33 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
 	"strings"
 	"sync"
 	"syscall"
+	"time"
 
 	"github.com/fsnotify/fsnotify"
 	"github.com/hashicorp/consul-k8s/control-plane/cni/config"
+	"github.com/hashicorp/consul-k8s/control-plane/cni/nftables"
+	"github.com/hashicorp/consul-k8s/control-plane/subcommand"
 	"github.com/hashicorp/consul-k8s/control-plane/subcommand/common"
 	"github.com/hashicorp/consul-k8s/control-plane/subcommand/flags"
 	"github.com/hashicorp/go-hclog"
 	"github.com/mitchellh/cli"
+	"k8s.io/client-go/kubernetes"
 )
 
 const (
 	defaultCNIBinSourceDir = "/bin"
 	consulCNIName          = "consul-cni" // Name of the plugin and binary. They must be the same as per the CNI spec.
 	defaultLogJSON         = false
+	// defaultRetryInterval is how long to wait before installing the plugin again when the config file of a CNI
+	// that rewrites it can't be read.
+	defaultRetryInterval = 1 * time.Second
 )
 
 // Command flags and structure.
@@ -47,9 +55,34 @@ type Command struct {
 	flagLogJSON bool
 	// flagMultus is a boolean flag for multus support.
 	flagMultus bool
+	// flagRedirectBackend is the backend the plugin uses to apply traffic redirection rules.
+	flagRedirectBackend string
+	// flagCNIConfigPriority is a comma-separated list of config file name patterns in order of preference for
+	// the config file to chain consul-cni into.
+	flagCNIConfigPriority string
+	// flagHealthAddr is the address of the health endpoint. It's disabled if empty.
+	flagHealthAddr string
+	// flagNodeName is the name of the node to annotate with the status of the plugin.
+	flagNodeName string
 
 	flagSet *flag.FlagSet
 
+	// cniConfigPriority is the parsed flagCNIConfigPriority.
+	cniConfigPriority []string
+	// profile is the profile of the CNI in the active config file.
+	profile cniProfile
+	// retryInterval is how long to wait before installing the plugin again when the config file of a CNI that
+	// rewrites it can't be read.
+	retryInterval time.Duration
+
+	k8sClient kubernetes.Interface
+
+	// statusMu guards status, which is read by the health endpoint.
+	statusMu sync.Mutex
+	status   cniStatus
+	// annotated is true once the node annotation has been set for the current status.
+	annotated bool
+
 	once   sync.Once
 	help   string
 	logger hclog.Logger
@@ -67,9 +100,25 @@ func (c *Command) init() {
 			"\"debug\", \"info\", \"warn\", and \"error\".")
 	c.flagSet.BoolVar(&c.flagLogJSON, "log-json", defaultLogJSON, "Enable or disable JSON output format for logging.")
 	c.flagSet.BoolVar(&c.flagMultus, "multus", config.DefaultMultus, "If the plugin is a multus plugin (default = false)")
+	c.flagSet.StringVar(&c.flagRedirectBackend, "redirect-backend", "",
+		"Backend the plugin uses to apply traffic redirection rules: \"iptables\" or \"nftables\". "+
+			"If empty, the plugin probes the node for it.")
+	c.flagSet.StringVar(&c.flagCNIConfigPriority, "cni-config-priority", "",
+		"Comma-separated list of config file name patterns, such as \"05-cilium.conflist,10-calico.conflist\", in "+
+			"order of preference for the config file to chain the plugin into. If no file matches, the file the "+
+			"container runtime uses is chosen.")
+	c.flagSet.StringVar(&c.flagHealthAddr, "health-addr", "",
+		"Address of the health endpoint that reports whether the plugin is installed in the active config file. "+
+			"Disabled if empty.")
+	c.flagSet.StringVar(&c.flagNodeName, "node-name", os.Getenv("NODE_NAME"),
+		"Name of the node to annotate with whether the plugin is installed. Defaults to the value of the NODE_NAME environment variable.")
 
 	c.help = flags.Usage(help, c.flagSet)
 
+	if c.retryInterval == 0 {
+		c.retryInterval = defaultRetryInterval
+	}
+
 	// Wait on an interrupt or terminate to exit. This channel must be initialized before
 	// Run() is called so that there are no race conditions where the channel
 	// is not defined.
@@ -87,9 +136,22 @@ func (c *Command) Run(args []string) int {
 		return 1
 	}
 
+	switch c.flagRedirectBackend {
+	case "", nftables.BackendAuto, nftables.BackendIptables, nftables.BackendNftables:
+	default:
+		c.UI.Error(fmt.Sprintf("-redirect-backend must be one of %q, %q or %q",
+			nftables.BackendAuto, nftables.BackendIptables, nftables.BackendNftables))
+		return 1
+	}
+	var err error
+	c.cniConfigPriority, err = parsePriority(c.flagCNIConfigPriority)
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("-cni-config-priority is invalid: %s", err))
+		return 1
+	}
+
 	// Set up logging.
 	if c.logger == nil {
-		var err error
 		c.logger, err = common.Logger(c.flagLogLevel, c.flagLogJSON)
 		if err != nil {
 			c.UI.Error(err.Error())
@@ -99,13 +161,14 @@ func (c *Command) Run(args []string) int {
 
 	// Create the CNI Config from command flags.
 	cfg := &config.CNIConfig{
-		Name:       config.DefaultPluginName,
-		Type:       config.DefaultPluginType,
-		CNIBinDir:  c.flagCNIBinDir,
-		CNINetDir:  c.flagCNINetDir,
-		Kubeconfig: c.flagKubeconfig,
-		LogLevel:   c.flagLogLevel,
-		Multus:     c.flagMultus,
+		Name:            config.DefaultPluginName,
+		Type:            config.DefaultPluginType,
+		CNIBinDir:       c.flagCNIBinDir,
+		CNINetDir:       c.flagCNINetDir,
+		Kubeconfig:      c.flagKubeconfig,
+		LogLevel:        c.flagLogLevel,
+		Multus:          c.flagMultus,
+		RedirectBackend: c.flagRedirectBackend,
 	}
 
 	c.logger.Info("Running CNI install with configuration",
@@ -115,14 +178,40 @@ func (c *Command) Run(args []string) int {
 		"cni_net_dir", cfg.CNINetDir,
 		"multus", cfg.Multus,
 		"kubeconfig", cfg.Kubeconfig,
-		"log_level", cfg.LogLevel)
+		"log_level", cfg.LogLevel,
+		"redirect_backend", cfg.RedirectBackend)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	if c.flagNodeName != "" && c.k8sClient == nil {
+		restConfig, err := subcommand.K8SConfig("")
+		if err != nil {
+			c.logger.Error("could not create Kubernetes config", "error", err)
+			return 1
+		}
+		c.k8sClient, err = kubernetes.NewForConfig(restConfig)
+		if err != nil {
+			c.logger.Error("could not create Kubernetes client", "error", err)
+			return 1
+		}
+	}
+	c.setStatus(ctx, cniStatus{Reason: "consul-cni is being installed"})
+
+	if c.flagHealthAddr != "" {
+		go func() {
+			mux := http.NewServeMux()
+			mux.HandleFunc("/health", c.healthHandler)
+			c.logger.Info("Serving health endpoint", "address", c.flagHealthAddr)
+			if err := http.ListenAndServe(c.flagHealthAddr, mux); err != nil {
+				c.logger.Error("error serving health endpoint", "error", err)
+			}
+		}()
+	}
+
 	// Generate the kubeconfig file that will be used by the plugin to communicate with the kubernetes api.
 	c.logger.Info("Creating kubeconfig", "file", cfg.Kubeconfig)
-	err := createKubeConfig(cfg.CNINetDir, cfg.Kubeconfig)
+	err = createKubeConfig(cfg.CNINetDir, cfg.Kubeconfig)
 	if err != nil {
 		c.logger.Error("could not create kube config", "error", err)
 		return 1
@@ -137,23 +226,14 @@ func (c *Command) Run(args []string) int {
 		return 1
 	}
 
-	// Get the config file that is on the host.
-	c.logger.Info("Getting default config file from", "destination", cfg.CNINetDir)
-	cfgFile, err := defaultCNIConfigFile(cfg.CNINetDir)
-	if err != nil {
-		c.logger.Error("could not get default CNI config file", "error", err)
-		return 1
-	}
-
+	var cfgFile string
 	// Install as a chained plugin.
 	if !cfg.Multus {
-		if strings.HasSuffix(cfgFile, ".conf") {
-			c.logger.Info("Converting .conf file to .conflist file", "file", cfgFile)
-			cfgFile, err = confListFileFromConfFile(cfgFile)
-			if err != nil {
-				c.logger.Error("could convert .conf file to .conflist file", "error", err)
-				return 1
-			}
+		c.logger.Info("Getting active config file from", "destination", cfg.CNINetDir)
+		cfgFile, err = c.activeConfigFileInDir(cfg.CNINetDir)
+		if err != nil {
+			c.logger.Error("could not get active CNI config file", "error", err)
+			return 1
 		}
 
 		// The config file does not exist and it probably means that the consul-cni plugin was installed or scheduled
@@ -161,27 +241,17 @@ func (c *Command) Run(args []string) int {
 		// be installed.
 		if cfgFile == "" {
 			c.logger.Info("CNI config file not found. Consul-cni is a chained plugin and another plugin must be installed first. Waiting...", "directory", cfg.CNINetDir)
-		} else {
-			// Check if there is valid config in the config file. It is invalid if no consul-cni config exists,
-			// the consul-cni config is not the last in the plugin chain or the consul-cni config is different from
-			// what is passed into helm (it could happen in a helm upgrade).
-			c.logger.Info("Using config file", "file", cfgFile)
-			err := validConfig(cfg, cfgFile)
-			if err != nil {
-				// The invalid config is not critical and we can recover from it.
-				c.logger.Info("Installing plugin", "reason", err)
-				err = appendCNIConfig(cfg, cfgFile)
-				if err != nil {
-					c.logger.Error("could not append configuration to config file", "error", err)
-					return 1
-				}
-			}
+			c.setStatus(ctx, cniStatus{Reason: "no CNI config file found in " + cfg.CNINetDir})
+		} else if err := c.installConfig(ctx, cfg, cfgFile); err != nil {
+			c.logger.Error("could not append configuration to config file", "error", err)
+			return 1
 		}
 	} else {
 		// When multus is enabled, the plugin configuration is set in a NetworkAttachementDefinition CRD and multus
 		// handles the configuration and running of the consul-cni plugin. Also, we add a `k8s.v1.cni.cncf.io/networks: consul-cni`
 		// annotation during connect inject so that multus knows to run the consul-cni plugin.
 		c.logger.Info("Multus enabled, using multus NetworkAttachementDefinition for configuration")
+		c.setStatus(ctx, cniStatus{Installed: true, Profile: "multus"})
 	}
 
 	// Watch for changes in the cniNetDir directory and fix/install the config file if need be.
@@ -197,6 +267,7 @@ func (c *Command) Run(args []string) int {
 func (c *Command) cleanup(cfg *config.CNIConfig, cfgFile string) {
 	var err error
 	c.logger.Info("Shutdown received, cleaning up")
+	c.clearStatus(context.Background())
 	if cfgFile != "" {
 		err = removeCNIConfig(cfgFile)
 		if err != nil {
@@ -232,6 +303,17 @@ func (c *Command) directoryWatcher(ctx context.Context, cfg *config.CNIConfig, d
 		_ = watcher.Close()
 	}()
 
+	// retry fires when installing the plugin should be retried.
+	var retry <-chan time.Time
+	reconcile := func() error {
+		var retryInstall bool
+		cfgFile, retryInstall, err = c.reconcile(ctx, cfg, dir)
+		if retryInstall {
+			retry = time.After(c.retryInterval)
+		}
+		return err
+	}
+
 	for {
 		select {
 		case event, ok := <-watcher.Events:
@@ -246,41 +328,16 @@ func (c *Command) directoryWatcher(ctx context.Context, cfg *config.CNIConfig, d
 				// than chained plugins
 				if !cfg.Multus {
 					c.logger.Info("Modified event", "event", event)
-					// Always get the config file that is on the host as we do not know if it was deleted
-					// or not.
-					cfgFile, err = defaultCNIConfigFile(dir)
-					if err != nil {
-						c.logger.Error("Unable get default config file", "error", err)
-						break
-					}
-
-					if strings.HasSuffix(cfgFile, ".conf") {
-						cfgFile, err = confListFileFromConfFile(cfgFile)
-						if err != nil {
-							c.logger.Error("could convert .conf file to .conflist file", "error", err)
-							break
-						}
-					}
-
-					if cfgFile != "" {
-						c.logger.Info("Using config file", "file", cfgFile)
-
-						err = validConfig(cfg, cfgFile)
-						if err != nil {
-							// The invalid config is not critical and we can recover from it.
-							c.logger.Info("Installing plugin", "reason", err)
-							err = appendCNIConfig(cfg, cfgFile)
-							if err != nil {
-								c.logger.Error("Unable to install consul-cni config", "error", err)
-								return err
-							}
-						} else {
-							c.logger.Info("Valid config file detected, nothing to do")
-							break
-						}
+					if err := reconcile(); err != nil {
+						return err
 					}
 				}
 			}
+		case <-retry:
+			retry = nil
+			if err := reconcile(); err != nil {
+				return err
+			}
 		case err, ok := <-watcher.Errors:
 			if !ok {
 				c.logger.Error("Event watcher event is not ok", "error", err)
@@ -295,6 +352,90 @@ func (c *Command) directoryWatcher(ctx context.Context, cfg *config.CNIConfig, d
 	}
 }
 
+// reconcile gets the active config file in the directory and installs the plugin into it. Errors getting the file
+// are logged because the next change to the directory fixes them. Errors installing the plugin are returned unless
+// the CNI rewrites its config file, in which case it returns true to retry installing it.
+func (c *Command) reconcile(ctx context.Context, cfg *config.CNIConfig, dir string) (string, bool, error) {
+	// Always get the config file that is on the host as we do not know if it was deleted
+	// or not.
+	cfgFile, err := c.activeConfigFileInDir(dir)
+	if err != nil {
+		c.logger.Error("Unable get active config file", "error", err)
+		c.setStatus(ctx, cniStatus{Reason: err.Error()})
+		return "", false, nil
+	}
+	if cfgFile == "" {
+		c.setStatus(ctx, cniStatus{Reason: "no CNI config file found in " + dir})
+		return "", false, nil
+	}
+
+	if err := c.installConfig(ctx, cfg, cfgFile); err != nil {
+		if !c.profile.rewritesConfig {
+			c.logger.Error("Unable to install consul-cni config", "error", err)
+			return cfgFile, false, err
+		}
+		c.logger.Info("Unable to install consul-cni config while the CNI rewrites its config file, retrying",
+			"profile", c.profile.name, "error", err)
+		return cfgFile, true, nil
+	}
+	return cfgFile, false, nil
+}
+
+// activeConfigFileInDir returns the config file in the directory to chain the plugin into, converting .conf files
+// to .conflist files. It returns an empty file name if there are no config files yet.
+func (c *Command) activeConfigFileInDir(dir string) (string, error) {
+	cfgFile, err := activeCNIConfigFile(dir, c.cniConfigPriority)
+	if err != nil {
+		return "", err
+	}
+	if strings.HasSuffix(cfgFile, ".conf") {
+		c.logger.Info("Converting .conf file to .conflist file", "file", cfgFile)
+		cfgFile, err = confListFileFromConfFile(cfgFile)
+		if err != nil {
+			return "", fmt.Errorf("could convert .conf file to .conflist file: %w", err)
+		}
+	}
+	return cfgFile, nil
+}
+
+// installConfig appends the consul-cni config to the config file unless it's already valid, and records the
+// status.
+func (c *Command) installConfig(ctx context.Context, cfg *config.CNIConfig, cfgFile string) error {
+	c.logger.Info("Using config file", "file", cfgFile)
+	status := cniStatus{ConfigFile: cfgFile}
+
+	profile, err := detectProfile(cfgFile)
+	if err != nil {
+		status.Reason = err.Error()
+		c.setStatus(ctx, status)
+		return err
+	}
+	if profile.name != c.profile.name {
+		c.profile = profile
+		c.logger.Info("Detected CNI profile", "profile", profile.name, "notes", profile.notes)
+	}
+	status.Profile = profile.name
+	status.Notes = profile.notes
+
+	// Check if there is valid config in the config file. It is invalid if no consul-cni config exists,
+	// the consul-cni config is not the last in the plugin chain or the consul-cni config is different from
+	// what is passed into helm (it could happen in a helm upgrade).
+	if err := validConfig(cfg, cfgFile); err != nil {
+		// The invalid config is not critical and we can recover from it.
+		c.logger.Info("Installing plugin", "reason", err)
+		if err := appendCNIConfig(cfg, cfgFile); err != nil {
+			status.Reason = err.Error()
+			c.setStatus(ctx, status)
+			return err
+		}
+	} else {
+		c.logger.Info("Valid config file detected, nothing to do")
+	}
+	status.Installed = true
+	c.setStatus(ctx, status)
+	return nil
+}
+
 // Synopsis returns the summary of the cni install command.
 func (c *Command) Synopsis() string { return synopsis }
 
@@ -139,3 +139,38 @@ func replaceFile(srcFile, destFile string) error {
 	}
 	return nil
 }
+
+func TestReconcile_PartlyWrittenConfig(t *testing.T) {
+	consulConfig := config.NewDefaultCNIConfig()
+	tempDir := t.TempDir()
+	cfgFile := filepath.Join(tempDir, "10-calico.conflist")
+	require.NoError(t, replaceFile("testdata/10-calico.conflist", cfgFile))
+
+	cmd := &Command{UI: cli.NewMockUi()}
+	cmd.init()
+	var err error
+	cmd.logger, err = common.Logger("info", false)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	actual, retryInstall, err := cmd.reconcile(ctx, consulConfig, tempDir)
+	require.NoError(t, err)
+	require.False(t, retryInstall)
+	require.Equal(t, cfgFile, actual)
+	require.Equal(t, "calico", cmd.profile.name)
+	require.True(t, cmd.status.Installed)
+
+	// Calico writes its config file again, which can be read while it's only partly written. The file is skipped
+	// until it's complete rather than treated as fatal.
+	require.NoError(t, os.WriteFile(cfgFile, []byte(`{"cniVersion": "0.3.1", "name": "k8s-pod-network"}`), 0644))
+	actual, retryInstall, err = cmd.reconcile(ctx, consulConfig, tempDir)
+	require.NoError(t, err)
+	require.False(t, retryInstall)
+	require.Empty(t, actual)
+	require.False(t, cmd.status.Installed)
+
+	require.NoError(t, replaceFile("testdata/10-calico.conflist", cfgFile))
+	_, _, err = cmd.reconcile(ctx, consulConfig, tempDir)
+	require.NoError(t, err)
+	require.True(t, cmd.status.Installed)
+}
@@ -0,0 +1,112 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package installcni
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/containernetworking/cni/libcni"
+)
+
+// cniProfile describes a primary CNI plugin that consul-cni is chained with.
+type cniProfile struct {
+	// name of the CNI.
+	name string
+	// pluginTypes are the types of the plugins in a config file that identify the CNI.
+	pluginTypes []string
+	// rewritesConfig is true if the CNI rewrites its config file when it restarts, which removes consul-cni from
+	// the plugin chain. The file can be read part way through being written, so installing consul-cni is retried
+	// instead of treated as fatal.
+	rewritesConfig bool
+	// notes is logged and reported when the CNI is detected. It explains what the CNI needs for the traffic
+	// redirection rules that consul-cni applies to take effect.
+	notes string
+}
+
+// cniProfiles are the CNIs that need special handling. Config files that don't match any of them use
+// genericProfile.
+var cniProfiles = []cniProfile{
+	{
+		name:           "cilium",
+		pluginTypes:    []string{"cilium-cni"},
+		rewritesConfig: true,
+		notes: "Cilium must run with cni.exclusive=false so that it doesn't remove the consul-cni config, and with " +
+			"socketLB.hostNamespaceOnly=true because its eBPF socket load balancer translates service addresses " +
+			"in the pod before the traffic redirection rules apply.",
+	},
+	{
+		name:           "calico",
+		pluginTypes:    []string{"calico"},
+		rewritesConfig: true,
+		notes: "With the Calico eBPF dataplane, bpfConnectTimeLoadBalancing must be Disabled because it translates " +
+			"service addresses in the pod before the traffic redirection rules apply.",
+	},
+}
+
+var genericProfile = cniProfile{name: "generic"}
+
+// detectProfile returns the profile of the CNI whose plugins are in the config file.
+func detectProfile(cfgFile string) (cniProfile, error) {
+	cfgMap, err := configFileToMap(cfgFile)
+	if err != nil {
+		return genericProfile, fmt.Errorf("could not convert config file to map: %w", err)
+	}
+	plugins, err := pluginsFromMap(cfgMap)
+	if err != nil {
+		return genericProfile, err
+	}
+
+	for _, p := range plugins {
+		plugin, ok := p.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for _, profile := range cniProfiles {
+			for _, pluginType := range profile.pluginTypes {
+				if plugin["type"] == pluginType {
+					return profile, nil
+				}
+			}
+		}
+	}
+	return genericProfile, nil
+}
+
+// activeCNIConfigFile returns the config file in the directory that consul-cni is chained into. The first valid
+// file that matches a pattern in priority is used, otherwise the file that the container runtime uses, which is
+// the first valid one in lexical order.
+func activeCNIConfigFile(dir string, priority []string) (string, error) {
+	if len(priority) > 0 {
+		files, err := libcni.ConfFiles(dir, []string{".conf", ".conflist"})
+		if err != nil {
+			return "", fmt.Errorf("error while trying to find files in %s: %w", dir, err)
+		}
+		for _, pattern := range priority {
+			for _, file := range files {
+				if match, _ := filepath.Match(pattern, filepath.Base(file)); match && validCNIConfigFile(file) {
+					return file, nil
+				}
+			}
+		}
+	}
+	return defaultCNIConfigFile(dir)
+}
+
+// parsePriority parses the comma-separated list of config file patterns.
+func parsePriority(value string) ([]string, error) {
+	var priority []string
+	for _, pattern := range strings.Split(value, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid config file pattern %q: %w", pattern, err)
+		}
+		priority = append(priority, pattern)
+	}
+	return priority, nil
+}
@@ -0,0 +1,82 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package installcni
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectProfile(t *testing.T) {
+	cases := map[string]string{
+		"testdata/05-cilium.conflist":  "cilium",
+		"testdata/10-calico.conflist":  "calico",
+		"testdata/10-kindnet.conflist": "generic",
+	}
+	for cfgFile, expected := range cases {
+		t.Run(cfgFile, func(t *testing.T) {
+			profile, err := detectProfile(cfgFile)
+			require.NoError(t, err)
+			require.Equal(t, expected, profile.name)
+		})
+	}
+}
+
+func TestActiveCNIConfigFile(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, file := range []string{"testdata/05-cilium.conflist", "testdata/10-calico.conflist", "testdata/10-fake-cni.conf", "testdata/10-kindnet.conflist"} {
+		require.NoError(t, copyFile(file, tempDir))
+	}
+
+	cases := []struct {
+		name         string
+		priority     string
+		expectedFile string
+	}{
+		{
+			name:         "no priority uses the file the runtime uses",
+			expectedFile: "05-cilium.conflist",
+		},
+		{
+			name:         "first matching pattern is used",
+			priority:     "10-calico.conflist, 05-cilium.conflist",
+			expectedFile: "10-calico.conflist",
+		},
+		{
+			name:         "patterns can be globs",
+			priority:     "*-kind*",
+			expectedFile: "10-kindnet.conflist",
+		},
+		{
+			name:         "invalid files are skipped",
+			priority:     "10-fake-cni.conf, 10-calico.conflist",
+			expectedFile: "10-calico.conflist",
+		},
+		{
+			name:         "no matching pattern uses the file the runtime uses",
+			priority:     "99-missing.conflist",
+			expectedFile: "05-cilium.conflist",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			priority, err := parsePriority(c.priority)
+			require.NoError(t, err)
+			actual, err := activeCNIConfigFile(tempDir, priority)
+			require.NoError(t, err)
+			require.Equal(t, filepath.Join(tempDir, c.expectedFile), actual)
+		})
+	}
+}
+
+func TestParsePriority(t *testing.T) {
+	priority, err := parsePriority(" 05-cilium.conflist,,10-*.conflist ")
+	require.NoError(t, err)
+	require.Equal(t, []string{"05-cilium.conflist", "10-*.conflist"}, priority)
+
+	_, err = parsePriority("[-.conflist")
+	require.EqualError(t, err, `invalid config file pattern "[-.conflist": syntax error in pattern`)
+}
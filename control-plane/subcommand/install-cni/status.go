@@ -0,0 +1,113 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package installcni
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/hashicorp/consul-k8s/control-plane/connect-inject/constants"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// cniStatus reports whether the consul-cni plugin is installed in the active CNI config file on the node. It is
+// served on the health endpoint and summarized in the node annotation.
+type cniStatus struct {
+	// Installed is true if consul-cni is the last plugin in the active config file and its config is up-to-date.
+	Installed bool `json:"installed"`
+	// ConfigFile is the active config file.
+	ConfigFile string `json:"configFile,omitempty"`
+	// Profile is the name of the CNI profile detected from the config file.
+	Profile string `json:"profile,omitempty"`
+	// Reason explains why consul-cni isn't installed.
+	Reason string `json:"reason,omitempty"`
+	// Notes are the notes of the detected CNI profile.
+	Notes string `json:"notes,omitempty"`
+}
+
+// setStatus records the status and updates the node annotation and label if whether consul-cni is installed has
+// changed. Failing to update them isn't fatal because it's retried on the next change.
+func (c *Command) setStatus(ctx context.Context, status cniStatus) {
+	c.statusMu.Lock()
+	previous := c.status
+	c.status = status
+	c.statusMu.Unlock()
+
+	if c.k8sClient == nil || (c.annotated && previous.Installed == status.Installed) {
+		return
+	}
+	value := constants.CNIStatusNotInstalled
+	if status.Installed {
+		value = constants.CNIStatusInstalled
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{constants.AnnotationCNIStatus: value},
+			"labels":      map[string]string{constants.LabelCNIStatus: value},
+		},
+	})
+	if err != nil {
+		c.logger.Error("Unable to create node status patch", "error", err)
+		return
+	}
+	if _, err := c.k8sClient.CoreV1().Nodes().Patch(ctx, c.flagNodeName, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		c.logger.Error("Unable to update node status", "node", c.flagNodeName, "annotation", constants.AnnotationCNIStatus, "error", err)
+		c.annotated = false
+		return
+	}
+	c.annotated = true
+	c.logger.Info("Updated node status", "node", c.flagNodeName, "annotation", constants.AnnotationCNIStatus, "value", value)
+}
+
+// clearStatus removes the node annotation and label when the installer shuts down, so that the node isn't reported
+// as having or lacking consul-cni while nothing keeps the status up-to-date.
+func (c *Command) clearStatus(ctx context.Context) {
+	c.statusMu.Lock()
+	c.status = cniStatus{Reason: "consul-cni installer is not running"}
+	c.statusMu.Unlock()
+
+	if c.k8sClient == nil {
+		return
+	}
+	// Null values remove the keys in a merge patch.
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{constants.AnnotationCNIStatus: nil},
+			"labels":      map[string]interface{}{constants.LabelCNIStatus: nil},
+		},
+	})
+	if err != nil {
+		c.logger.Error("Unable to create node status patch", "error", err)
+		return
+	}
+	if _, err := c.k8sClient.CoreV1().Nodes().Patch(ctx, c.flagNodeName, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		c.logger.Error("Unable to remove node status", "node", c.flagNodeName, "annotation", constants.AnnotationCNIStatus, "error", err)
+		return
+	}
+	c.annotated = false
+	c.logger.Info("Removed node status", "node", c.flagNodeName, "annotation", constants.AnnotationCNIStatus)
+}
+
+// healthHandler serves the status. It responds with 503 if consul-cni isn't installed so that it can be used as a
+// readiness probe.
+func (c *Command) healthHandler(w http.ResponseWriter, _ *http.Request) {
+	c.statusMu.Lock()
+	status := c.status
+	c.statusMu.Unlock()
+
+	body, err := json.Marshal(status)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = fmt.Fprint(w, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if !status.Installed {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_, _ = w.Write(body)
+}
@@ -0,0 +1,82 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package installcni
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hashicorp/consul-k8s/control-plane/connect-inject/constants"
+	"github.com/hashicorp/consul-k8s/control-plane/subcommand/common"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestSetStatus_NodeAnnotationAndLabel(t *testing.T) {
+	ctx := context.Background()
+	k8sClient := fake.NewSimpleClientset(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}})
+
+	cmd := &Command{k8sClient: k8sClient, flagNodeName: "node-1"}
+	var err error
+	cmd.logger, err = common.Logger("info", false)
+	require.NoError(t, err)
+
+	requireAnnotation := func(expected string) {
+		t.Helper()
+		node, err := k8sClient.CoreV1().Nodes().Get(ctx, "node-1", metav1.GetOptions{})
+		require.NoError(t, err)
+		require.Equal(t, expected, node.Annotations[constants.AnnotationCNIStatus])
+		require.Equal(t, expected, node.Labels[constants.LabelCNIStatus])
+	}
+
+	cmd.setStatus(ctx, cniStatus{Reason: "consul-cni is being installed"})
+	requireAnnotation(constants.CNIStatusNotInstalled)
+
+	cmd.setStatus(ctx, cniStatus{Installed: true, ConfigFile: "/etc/cni/net.d/10-calico.conflist", Profile: "calico"})
+	requireAnnotation(constants.CNIStatusInstalled)
+
+	cmd.setStatus(ctx, cniStatus{Reason: "no CNI config file found in /etc/cni/net.d"})
+	requireAnnotation(constants.CNIStatusNotInstalled)
+
+	// The status is removed when the installer shuts down.
+	cmd.clearStatus(ctx)
+	node, err := k8sClient.CoreV1().Nodes().Get(ctx, "node-1", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.NotContains(t, node.Annotations, constants.AnnotationCNIStatus)
+	require.NotContains(t, node.Labels, constants.LabelCNIStatus)
+}
+
+func TestHealthHandler(t *testing.T) {
+	cases := map[string]struct {
+		status     cniStatus
+		expectCode int
+	}{
+		"installed": {
+			status:     cniStatus{Installed: true, ConfigFile: "/etc/cni/net.d/05-cilium.conflist", Profile: "cilium"},
+			expectCode: http.StatusOK,
+		},
+		"not installed": {
+			status:     cniStatus{Reason: "no CNI config file found in /etc/cni/net.d"},
+			expectCode: http.StatusServiceUnavailable,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			cmd := &Command{status: c.status}
+			rec := httptest.NewRecorder()
+			cmd.healthHandler(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+
+			require.Equal(t, c.expectCode, rec.Code)
+			require.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+			var actual cniStatus
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &actual))
+			require.Equal(t, c.status, actual)
+		})
+	}
+}
@@ -15,7 +15,6 @@ import (
 	"github.com/hashicorp/consul-k8s/control-plane/subcommand/common"
 	"github.com/hashicorp/consul-k8s/control-plane/subcommand/flags"
 	"github.com/hashicorp/consul-server-connection-manager/discovery"
-	"github.com/hashicorp/consul/api"
 	"github.com/hashicorp/go-hclog"
 	"github.com/mitchellh/cli"
 )
@@ -30,6 +29,12 @@ type Command struct {
 	flagLogJSON  bool
 	flagTimeout  time.Duration
 
+	flagConfigFile           string
+	flagDescription          string
+	flagAdditionalNamespaces []string
+
+	watcher consul.ServerConnectionManager
+
 	// ctx is cancelled when the command timeout is reached.
 	ctx           context.Context
 	retryDuration time.Duration
@@ -51,6 +56,13 @@ func (c *Command) init() {
 			"\"debug\", \"info\", \"warn\", and \"error\".")
 	c.flags.BoolVar(&c.flagLogJSON, "log-json", false,
 		"Enable or disable JSON output format for logging.")
+	c.flags.StringVar(&c.flagConfigFile, "config-file", "",
+		"Path to a JSON file with the configuration of the partition: its description, namespaces, "+
+			"ACL policies and exported services.")
+	c.flags.StringVar(&c.flagDescription, "description", "",
+		"Description of the partition. Overrides the description in -config-file.")
+	c.flags.Var((*flags.AppendSliceValue)(&c.flagAdditionalNamespaces), "additional-namespace",
+		"Name of a Consul namespace to create in the partition. May be specified multiple times.")
 
 	c.consul = &flags.ConsulFlags{}
 	flags.Merge(c.flags, c.consul.Flags())
@@ -98,17 +110,26 @@ func (c *Command) Run(args []string) int {
 		return 1
 	}
 
-	// Start Consul server Connection manager
-	serverConnMgrCfg, err := c.consul.ConsulServerConnMgrConfig()
-	serverConnMgrCfg.ServerWatchDisabled = true
+	config, err := c.loadConfig()
 	if err != nil {
-		c.UI.Error(fmt.Sprintf("unable to create config for consul-server-connection-manager: %s", err))
+		c.UI.Error(err.Error())
 		return 1
 	}
-	watcher, err := discovery.NewWatcher(c.ctx, serverConnMgrCfg, c.log.Named("consul-server-connection-manager"))
-	if err != nil {
-		c.UI.Error(fmt.Sprintf("unable to create Consul server watcher: %s", err))
-		return 1
+
+	// Start Consul server Connection manager
+	watcher := c.watcher
+	if watcher == nil {
+		serverConnMgrCfg, err := c.consul.ConsulServerConnMgrConfig()
+		if err != nil {
+			c.UI.Error(fmt.Sprintf("unable to create config for consul-server-connection-manager: %s", err))
+			return 1
+		}
+		serverConnMgrCfg.ServerWatchDisabled = true
+		watcher, err = discovery.NewWatcher(c.ctx, serverConnMgrCfg, c.log.Named("consul-server-connection-manager"))
+		if err != nil {
+			c.UI.Error(fmt.Sprintf("unable to create Consul server watcher: %s", err))
+			return 1
+		}
 	}
 
 	go watcher.Run()
@@ -127,25 +148,13 @@ func (c *Command) Run(args []string) int {
 	}
 
 	for {
-		partition, _, err := consulClient.Partitions().Read(c.ctx, c.consul.Partition, nil)
-		// The API does not return an error if the Partition does not exist. It returns a nil Partition.
-		if err != nil {
-			c.log.Error("Error reading Partition from Consul", "name", c.consul.Partition, "error", err.Error())
-		} else if partition == nil {
-			// Retry Admin Partition creation until it succeeds, or we reach the command timeout.
-			_, _, err = consulClient.Partitions().Create(c.ctx, &api.Partition{
-				Name:        c.consul.Partition,
-				Description: "Created by Helm installation",
-			}, nil)
-			if err == nil {
-				c.log.Info("Successfully created Admin Partition", "name", c.consul.Partition)
-				return 0
-			}
-			c.log.Error("Error creating partition", "name", c.consul.Partition, "error", err.Error())
-		} else {
-			c.log.Info("Admin Partition already exists", "name", c.consul.Partition)
+		// Retry reconciling the partition until it succeeds, or we reach the command timeout.
+		err := c.reconcile(consulClient, config)
+		if err == nil {
 			return 0
 		}
+		c.log.Error("Error reconciling partition", "name", c.consul.Partition, "error", err.Error())
+
 		// Wait on either the retry duration (in which case we continue) or the
 		// overall command timeout.
 		c.log.Info("Retrying in " + c.retryDuration.String())
@@ -153,7 +162,7 @@ func (c *Command) Run(args []string) int {
 		case <-time.After(c.retryDuration):
 			continue
 		case <-c.ctx.Done():
-			c.log.Error("Timed out attempting to create partition", "name", c.consul.Partition)
+			c.log.Error("Timed out attempting to reconcile partition", "name", c.consul.Partition)
 			return 1
 		}
 	}
@@ -182,4 +191,8 @@ Usage: consul-k8s-control-plane partition-init [options]
   It will run until the partition has been created or the operation times out. It is idempotent
   and safe to run multiple times.
 
+  With -config-file, it also reconciles the description, namespaces, ACL policies and
+  exported services of the partition so that changes to the config update existing
+  partitions. Namespaces and policies that aren't in the config are left as they are.
+
 `
@@ -0,0 +1,255 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package partition_init
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul-k8s/control-plane/helper/test"
+	"github.com/hashicorp/consul/api"
+	"github.com/mitchellh/cli"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun_ConfigValidation(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		config string
+		expErr string
+	}{
+		{
+			config: `{`,
+			expErr: "error parsing config file",
+		},
+		{
+			config: `{"namespaces": [{"description": "no name"}]}`,
+			expErr: "namespaces[0].name must be set",
+		},
+		{
+			config: `{"namespaces": [{"name": "ns"}, {"name": "ns"}]}`,
+			expErr: `namespace "ns" is configured more than once`,
+		},
+		{
+			config: `{"exportedServices": [{"name": "web", "consumers": [{"partition": "p", "peer": "p"}]}]}`,
+			expErr: "exportedServices[0].consumers[0] must set exactly one of partition, peer or samenessGroup",
+		},
+		{
+			config: `{"aclPolicies": [{"name": "policy"}]}`,
+			expErr: "aclPolicies[0].rules must be set",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.expErr, func(t *testing.T) {
+			configFile := filepath.Join(t.TempDir(), "config.json")
+			require.NoError(t, os.WriteFile(configFile, []byte(c.config), 0600))
+
+			ui := cli.NewMockUi()
+			cmd := Command{UI: ui}
+			exitCode := cmd.Run([]string{
+				"-addresses", "foo",
+				"-partition", "bar",
+				"-config-file", configFile,
+			})
+			require.Equal(t, 1, exitCode, ui.ErrorWriter.String())
+			require.Contains(t, ui.ErrorWriter.String(), c.expErr)
+		})
+	}
+}
+
+func TestRun_ReconcilesConfig(t *testing.T) {
+	t.Parallel()
+
+	consulServer := newFakeConsul()
+	config := `{
+  "description": "Team A",
+  "namespaces": [
+    {"name": "default", "aclDefaults": {"policies": ["cross-namespace"]}},
+    {"name": "web", "description": "Web services", "meta": {"team": "a"}}
+  ],
+  "exportedServices": [
+    {"name": "web", "namespace": "web", "consumers": [{"partition": "default"}, {"peer": "dc2"}]}
+  ],
+  "aclPolicies": [
+    {"name": "cross-namespace", "rules": "namespace_prefix \"\" { service_prefix \"\" { policy = \"read\" } }"}
+  ]
+}`
+	code, ui := runCommand(t, consulServer, config, "-additional-namespace", "api")
+	require.Equal(t, 0, code, ui.ErrorWriter.String())
+
+	require.Equal(t, "Team A", consulServer.partitions["team-a"].Description)
+	require.Contains(t, consulServer.policies, "cross-namespace")
+	require.Equal(t, []api.ACLLink{{Name: "cross-namespace"}}, consulServer.namespaces["default"].ACLs.PolicyDefaults)
+	require.Equal(t, "Web services", consulServer.namespaces["web"].Description)
+	require.Equal(t, map[string]string{"team": "a"}, consulServer.namespaces["web"].Meta)
+	require.Contains(t, consulServer.namespaces, "api")
+	require.Equal(t, []api.ExportedService{{
+		Name:      "web",
+		Namespace: "web",
+		Consumers: []api.ServiceConsumer{{Partition: "default"}, {Peer: "dc2"}},
+	}}, consulServer.exportedServices.Services)
+
+	// Running again with the same config doesn't write anything.
+	writes := consulServer.writes
+	code, ui = runCommand(t, consulServer, config, "-additional-namespace", "api")
+	require.Equal(t, 0, code, ui.ErrorWriter.String())
+	require.Equal(t, writes, consulServer.writes)
+
+	// Changing the config updates the existing partition.
+	updatedConfig := `{
+  "description": "Team B",
+  "namespaces": [{"name": "web", "description": "Web services", "aclDefaults": {"policies": ["cross-namespace"]}}],
+  "exportedServices": [],
+  "aclPolicies": [{"name": "cross-namespace", "rules": "operator = \"read\""}]
+}`
+	code, ui = runCommand(t, consulServer, updatedConfig)
+	require.Equal(t, 0, code, ui.ErrorWriter.String())
+
+	require.Equal(t, "Team B", consulServer.partitions["team-a"].Description)
+	require.Equal(t, `operator = "read"`, consulServer.policies["cross-namespace"].Rules)
+	require.Equal(t, []api.ACLLink{{Name: "cross-namespace"}}, consulServer.namespaces["web"].ACLs.PolicyDefaults)
+	// Fields that aren't set are left unchanged.
+	require.Equal(t, map[string]string{"team": "a"}, consulServer.namespaces["web"].Meta)
+	require.Contains(t, consulServer.namespaces, "api")
+	require.Empty(t, consulServer.exportedServices.Services)
+}
+
+func TestRun_DefaultDescription(t *testing.T) {
+	t.Parallel()
+
+	consulServer := newFakeConsul()
+	code, ui := runCommand(t, consulServer, "")
+	require.Equal(t, 0, code, ui.ErrorWriter.String())
+	require.Equal(t, defaultPartitionDescription, consulServer.partitions["team-a"].Description)
+	// The exported-services config entry isn't managed without exportedServices.
+	require.Nil(t, consulServer.exportedServices)
+}
+
+func runCommand(t *testing.T, consulServer *fakeConsul, config string, args ...string) (int, *cli.MockUi) {
+	server := httptest.NewServer(consulServer)
+	t.Cleanup(server.Close)
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	port, err := strconv.Atoi(serverURL.Port())
+	require.NoError(t, err)
+
+	if config != "" {
+		configFile := filepath.Join(t.TempDir(), "config.json")
+		require.NoError(t, os.WriteFile(configFile, []byte(config), 0600))
+		args = append(args, "-config-file", configFile)
+	}
+
+	ui := cli.NewMockUi()
+	cmd := Command{
+		UI:            ui,
+		watcher:       test.MockConnMgrForIPAndPort(serverURL.Hostname(), port),
+		retryDuration: 10 * time.Millisecond,
+	}
+	return cmd.Run(append([]string{
+		"-timeout=5s",
+		"-addresses=" + serverURL.Hostname(),
+		"-http-port=" + serverURL.Port(),
+		"-partition=team-a",
+	}, args...)), ui
+}
+
+// fakeConsul is a fake of the Consul HTTP API endpoints for partitions,
+// namespaces, ACL policies and config entries in a single partition.
+type fakeConsul struct {
+	mu               sync.Mutex
+	partitions       map[string]*api.Partition
+	namespaces       map[string]*api.Namespace
+	policies         map[string]*api.ACLPolicy
+	exportedServices *api.ExportedServicesConfigEntry
+	// writes is the number of write requests.
+	writes int
+}
+
+func newFakeConsul() *fakeConsul {
+	return &fakeConsul{
+		partitions: make(map[string]*api.Partition),
+		namespaces: map[string]*api.Namespace{"default": {Name: "default"}},
+		policies:   make(map[string]*api.ACLPolicy),
+	}
+}
+
+func (f *fakeConsul) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	path := r.URL.Path
+	if r.Method == http.MethodGet {
+		var resp interface{}
+		switch {
+		case strings.HasPrefix(path, "/v1/partition/"):
+			resp = f.partitions[strings.TrimPrefix(path, "/v1/partition/")]
+		case strings.HasPrefix(path, "/v1/namespace/"):
+			resp = f.namespaces[strings.TrimPrefix(path, "/v1/namespace/")]
+		case strings.HasPrefix(path, "/v1/acl/policy/name/"):
+			resp = f.policies[strings.TrimPrefix(path, "/v1/acl/policy/name/")]
+		case path == "/v1/config/exported-services/team-a" && f.exportedServices != nil:
+			resp = f.exportedServices
+		}
+		// Nil pointers in interfaces aren't nil so check the JSON.
+		body, _ := json.Marshal(resp)
+		if string(body) == "null" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(body)
+		return
+	}
+
+	f.writes++
+	switch {
+	case strings.HasPrefix(path, "/v1/partition"):
+		var partition api.Partition
+		if err := json.NewDecoder(r.Body).Decode(&partition); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.partitions[partition.Name] = &partition
+		_ = json.NewEncoder(w).Encode(partition)
+	case strings.HasPrefix(path, "/v1/namespace"):
+		var ns api.Namespace
+		if err := json.NewDecoder(r.Body).Decode(&ns); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.namespaces[ns.Name] = &ns
+		_ = json.NewEncoder(w).Encode(ns)
+	case strings.HasPrefix(path, "/v1/acl/policy"):
+		var policy api.ACLPolicy
+		if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if policy.ID == "" {
+			policy.ID = "policy-" + policy.Name
+		}
+		f.policies[policy.Name] = &policy
+		_ = json.NewEncoder(w).Encode(policy)
+	case path == "/v1/config":
+		var entry api.ExportedServicesConfigEntry
+		if err := json.NewDecoder(r.Body).Decode(&entry); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.exportedServices = &entry
+		_, _ = w.Write([]byte("true"))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package partition_init
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// partitionConfig is the declarative configuration of an Admin Partition.
+// Fields that aren't set are left unchanged on existing partitions.
+type partitionConfig struct {
+	// Description is the description of the partition.
+	Description string `json:"description,omitempty"`
+	// Namespaces are the Consul namespaces in the partition. The "default"
+	// namespace always exists but can be listed to configure it.
+	Namespaces []namespaceConfig `json:"namespaces,omitempty"`
+	// ExportedServices are the services the partition exports. If nil, the
+	// exported-services config entry of the partition isn't managed. If
+	// empty, no services are exported.
+	ExportedServices []exportedServiceConfig `json:"exportedServices"`
+	// ACLPolicies are ACL policies to create in the partition.
+	ACLPolicies []aclPolicyConfig `json:"aclPolicies,omitempty"`
+}
+
+// namespaceConfig configures a Consul namespace in the partition.
+type namespaceConfig struct {
+	Name        string                `json:"name"`
+	Description string                `json:"description,omitempty"`
+	Meta        map[string]string     `json:"meta,omitempty"`
+	ACLDefaults *namespaceACLDefaults `json:"aclDefaults,omitempty"`
+}
+
+// namespaceACLDefaults are the names of the policies and roles that are the
+// defaults for all tokens in a namespace.
+type namespaceACLDefaults struct {
+	Policies []string `json:"policies,omitempty"`
+	Roles    []string `json:"roles,omitempty"`
+}
+
+// exportedServiceConfig configures a service exported from the partition.
+type exportedServiceConfig struct {
+	Name string `json:"name"`
+	// Namespace defaults to "default".
+	Namespace string           `json:"namespace,omitempty"`
+	Consumers []consumerConfig `json:"consumers"`
+}
+
+// consumerConfig is a consumer of an exported service. Exactly one of the
+// fields must be set.
+type consumerConfig struct {
+	Partition     string `json:"partition,omitempty"`
+	Peer          string `json:"peer,omitempty"`
+	SamenessGroup string `json:"samenessGroup,omitempty"`
+}
+
+// aclPolicyConfig configures an ACL policy in the partition.
+type aclPolicyConfig struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Rules       string `json:"rules"`
+}
+
+// loadConfig returns the partition config from the config file, if set,
+// with the values of the flags applied on top.
+func (c *Command) loadConfig() (partitionConfig, error) {
+	var config partitionConfig
+	if c.flagConfigFile != "" {
+		file, err := os.ReadFile(c.flagConfigFile)
+		if err != nil {
+			return config, fmt.Errorf("error reading config file: %s", err)
+		}
+		if err := json.Unmarshal(file, &config); err != nil {
+			return config, fmt.Errorf("error parsing config file: %s", err)
+		}
+	}
+
+	if c.flagDescription != "" {
+		config.Description = c.flagDescription
+	}
+	for _, name := range c.flagAdditionalNamespaces {
+		if !config.hasNamespace(name) {
+			config.Namespaces = append(config.Namespaces, namespaceConfig{Name: name})
+		}
+	}
+	return config, config.validate()
+}
+
+func (c partitionConfig) hasNamespace(name string) bool {
+	for _, ns := range c.Namespaces {
+		if ns.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (c partitionConfig) validate() error {
+	namespaces := make(map[string]bool)
+	for i, ns := range c.Namespaces {
+		if ns.Name == "" {
+			return fmt.Errorf("namespaces[%d].name must be set", i)
+		}
+		if namespaces[ns.Name] {
+			return fmt.Errorf("namespace %q is configured more than once", ns.Name)
+		}
+		namespaces[ns.Name] = true
+	}
+
+	for i, svc := range c.ExportedServices {
+		if svc.Name == "" {
+			return fmt.Errorf("exportedServices[%d].name must be set", i)
+		}
+		for j, consumer := range svc.Consumers {
+			set := 0
+			for _, v := range []string{consumer.Partition, consumer.Peer, consumer.SamenessGroup} {
+				if v != "" {
+					set++
+				}
+			}
+			if set != 1 {
+				return fmt.Errorf("exportedServices[%d].consumers[%d] must set exactly one of partition, peer or samenessGroup", i, j)
+			}
+		}
+	}
+
+	policies := make(map[string]bool)
+	for i, policy := range c.ACLPolicies {
+		if policy.Name == "" {
+			return fmt.Errorf("aclPolicies[%d].name must be set", i)
+		}
+		if policy.Rules == "" {
+			return fmt.Errorf("aclPolicies[%d].rules must be set", i)
+		}
+		if policies[policy.Name] {
+			return fmt.Errorf("ACL policy %q is configured more than once", policy.Name)
+		}
+		policies[policy.Name] = true
+	}
+	return nil
+}
@@ -0,0 +1,262 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package partition_init
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// defaultPartitionDescription is the description of partitions created
+// without one configured.
+const defaultPartitionDescription = "Created by Helm installation"
+
+// reconcile creates or updates the partition and its namespaces, ACL policies
+// and exported services so that they match the config.
+func (c *Command) reconcile(consulClient *api.Client, config partitionConfig) error {
+	if err := c.reconcilePartition(consulClient, config); err != nil {
+		return err
+	}
+	// Policies are reconciled before namespaces because namespace ACL
+	// defaults refer to them.
+	for _, policy := range config.ACLPolicies {
+		if err := c.reconcileACLPolicy(consulClient, policy); err != nil {
+			return err
+		}
+	}
+	for _, ns := range config.Namespaces {
+		if err := c.reconcileNamespace(consulClient, ns); err != nil {
+			return err
+		}
+	}
+	if config.ExportedServices != nil {
+		if err := c.reconcileExportedServices(consulClient, config.ExportedServices); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Command) reconcilePartition(consulClient *api.Client, config partitionConfig) error {
+	partition, _, err := consulClient.Partitions().Read(c.ctx, c.consul.Partition, nil)
+	// The API does not return an error if the Partition does not exist. It returns a nil Partition.
+	if err != nil {
+		return fmt.Errorf("reading partition %q: %w", c.consul.Partition, err)
+	}
+
+	if partition == nil {
+		description := config.Description
+		if description == "" {
+			description = defaultPartitionDescription
+		}
+		_, _, err = consulClient.Partitions().Create(c.ctx, &api.Partition{
+			Name:        c.consul.Partition,
+			Description: description,
+		}, nil)
+		if err != nil {
+			return fmt.Errorf("creating partition %q: %w", c.consul.Partition, err)
+		}
+		c.log.Info("Successfully created Admin Partition", "name", c.consul.Partition)
+		return nil
+	}
+
+	if config.Description == "" || config.Description == partition.Description {
+		c.log.Info("Admin Partition already exists", "name", c.consul.Partition)
+		return nil
+	}
+	partition.Description = config.Description
+	if _, _, err := consulClient.Partitions().Update(c.ctx, partition, nil); err != nil {
+		return fmt.Errorf("updating partition %q: %w", c.consul.Partition, err)
+	}
+	c.log.Info("Successfully updated Admin Partition", "name", c.consul.Partition)
+	return nil
+}
+
+func (c *Command) reconcileACLPolicy(consulClient *api.Client, config aclPolicyConfig) error {
+	queryOpts := &api.QueryOptions{Partition: c.consul.Partition}
+	writeOpts := &api.WriteOptions{Partition: c.consul.Partition}
+
+	policy, _, err := consulClient.ACL().PolicyReadByName(config.Name, queryOpts.WithContext(c.ctx))
+	if err != nil {
+		return fmt.Errorf("reading ACL policy %q: %w", config.Name, err)
+	}
+	if policy == nil {
+		_, _, err := consulClient.ACL().PolicyCreate(&api.ACLPolicy{
+			Name:        config.Name,
+			Description: config.Description,
+			Rules:       config.Rules,
+			Partition:   c.consul.Partition,
+		}, writeOpts.WithContext(c.ctx))
+		if err != nil {
+			return fmt.Errorf("creating ACL policy %q: %w", config.Name, err)
+		}
+		c.log.Info("Successfully created ACL policy", "name", config.Name)
+		return nil
+	}
+
+	if policy.Description == config.Description && policy.Rules == config.Rules {
+		return nil
+	}
+	policy.Description = config.Description
+	policy.Rules = config.Rules
+	if _, _, err := consulClient.ACL().PolicyUpdate(policy, writeOpts.WithContext(c.ctx)); err != nil {
+		return fmt.Errorf("updating ACL policy %q: %w", config.Name, err)
+	}
+	c.log.Info("Successfully updated ACL policy", "name", config.Name)
+	return nil
+}
+
+func (c *Command) reconcileNamespace(consulClient *api.Client, config namespaceConfig) error {
+	queryOpts := &api.QueryOptions{Partition: c.consul.Partition}
+	writeOpts := &api.WriteOptions{Partition: c.consul.Partition}
+
+	ns, _, err := consulClient.Namespaces().Read(config.Name, queryOpts.WithContext(c.ctx))
+	if err != nil {
+		return fmt.Errorf("reading namespace %q: %w", config.Name, err)
+	}
+	if ns == nil {
+		ns = &api.Namespace{
+			Name:        config.Name,
+			Description: config.Description,
+			Meta:        config.Meta,
+			ACLs:        namespaceACLs(config.ACLDefaults),
+			Partition:   c.consul.Partition,
+		}
+		if _, _, err := consulClient.Namespaces().Create(ns, writeOpts.WithContext(c.ctx)); err != nil {
+			return fmt.Errorf("creating namespace %q: %w", config.Name, err)
+		}
+		c.log.Info("Successfully created namespace", "name", config.Name)
+		return nil
+	}
+
+	changed := false
+	if config.Description != "" && config.Description != ns.Description {
+		ns.Description = config.Description
+		changed = true
+	}
+	if config.Meta != nil && !reflect.DeepEqual(config.Meta, ns.Meta) {
+		ns.Meta = config.Meta
+		changed = true
+	}
+	if config.ACLDefaults != nil && !aclDefaultsEqual(config.ACLDefaults, ns.ACLs) {
+		ns.ACLs = namespaceACLs(config.ACLDefaults)
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	if _, _, err := consulClient.Namespaces().Update(ns, writeOpts.WithContext(c.ctx)); err != nil {
+		return fmt.Errorf("updating namespace %q: %w", config.Name, err)
+	}
+	c.log.Info("Successfully updated namespace", "name", config.Name)
+	return nil
+}
+
+func (c *Command) reconcileExportedServices(consulClient *api.Client, config []exportedServiceConfig) error {
+	queryOpts := &api.QueryOptions{Partition: c.consul.Partition}
+	writeOpts := &api.WriteOptions{Partition: c.consul.Partition}
+
+	desired := &api.ExportedServicesConfigEntry{
+		Name:      c.consul.Partition,
+		Partition: c.consul.Partition,
+		Services:  make([]api.ExportedService, 0, len(config)),
+	}
+	for _, svc := range config {
+		exported := api.ExportedService{
+			Name:      svc.Name,
+			Namespace: svc.Namespace,
+			Consumers: make([]api.ServiceConsumer, 0, len(svc.Consumers)),
+		}
+		if exported.Namespace == "" {
+			exported.Namespace = "default"
+		}
+		for _, consumer := range svc.Consumers {
+			exported.Consumers = append(exported.Consumers, api.ServiceConsumer{
+				Partition:     consumer.Partition,
+				Peer:          consumer.Peer,
+				SamenessGroup: consumer.SamenessGroup,
+			})
+		}
+		desired.Services = append(desired.Services, exported)
+	}
+
+	entry, _, err := consulClient.ConfigEntries().Get(api.ExportedServices, c.consul.Partition, queryOpts.WithContext(c.ctx))
+	if err != nil && !isNotFoundErr(err) {
+		return fmt.Errorf("reading exported-services config entry: %w", err)
+	}
+	if existing, ok := entry.(*api.ExportedServicesConfigEntry); ok && exportedServicesEqual(existing.Services, desired.Services) {
+		return nil
+	}
+	if _, _, err := consulClient.ConfigEntries().Set(desired, writeOpts.WithContext(c.ctx)); err != nil {
+		return fmt.Errorf("writing exported-services config entry: %w", err)
+	}
+	c.log.Info("Successfully wrote exported-services config entry", "name", c.consul.Partition)
+	return nil
+}
+
+// namespaceACLs returns the ACL config of a namespace with the defaults.
+func namespaceACLs(defaults *namespaceACLDefaults) *api.NamespaceACLConfig {
+	acls := &api.NamespaceACLConfig{
+		PolicyDefaults: []api.ACLLink{},
+		RoleDefaults:   []api.ACLLink{},
+	}
+	if defaults == nil {
+		return acls
+	}
+	for _, name := range defaults.Policies {
+		acls.PolicyDefaults = append(acls.PolicyDefaults, api.ACLLink{Name: name})
+	}
+	for _, name := range defaults.Roles {
+		acls.RoleDefaults = append(acls.RoleDefaults, api.ACLLink{Name: name})
+	}
+	return acls
+}
+
+// aclDefaultsEqual returns true if the namespace ACL config links exactly the
+// policies and roles in the defaults.
+func aclDefaultsEqual(defaults *namespaceACLDefaults, acls *api.NamespaceACLConfig) bool {
+	if acls == nil {
+		acls = &api.NamespaceACLConfig{}
+	}
+	return linkNamesEqual(defaults.Policies, acls.PolicyDefaults) && linkNamesEqual(defaults.Roles, acls.RoleDefaults)
+}
+
+func linkNamesEqual(names []string, links []api.ACLLink) bool {
+	if len(names) != len(links) {
+		return false
+	}
+	for i := range names {
+		if names[i] != links[i].Name {
+			return false
+		}
+	}
+	return true
+}
+
+// exportedServicesEqual compares the exported services ignoring the fields
+// Consul fills in, such as the partition of peer consumers.
+func exportedServicesEqual(a, b []api.ExportedService) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Name != b[i].Name || a[i].Namespace != b[i].Namespace || len(a[i].Consumers) != len(b[i].Consumers) {
+			return false
+		}
+		for j := range a[i].Consumers {
+			x, y := a[i].Consumers[j], b[i].Consumers[j]
+			if x.Partition != y.Partition || x.Peer != y.Peer || x.SamenessGroup != y.SamenessGroup {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func isNotFoundErr(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "404")
+}
@@ -0,0 +1,628 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package rotateacltokens
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/consul-k8s/control-plane/consul"
+	"github.com/hashicorp/consul-k8s/control-plane/subcommand"
+	"github.com/hashicorp/consul-k8s/control-plane/subcommand/common"
+	"github.com/hashicorp/consul-k8s/control-plane/subcommand/flags"
+	"github.com/hashicorp/consul-server-connection-manager/discovery"
+	"github.com/hashicorp/consul/api"
+	"github.com/hashicorp/go-hclog"
+	vaultApi "github.com/hashicorp/vault/api"
+	"github.com/mitchellh/cli"
+	"github.com/mitchellh/mapstructure"
+	"k8s.io/client-go/kubernetes"
+)
+
+type Command struct {
+	UI cli.Ui
+
+	flags       *flag.FlagSet
+	k8s         *flags.K8SFlags
+	consulFlags *flags.ConsulFlags
+
+	flagResourcePrefix  string
+	flagK8sNamespace    string
+	flagTokenNames      []string
+	flagSecretsBackend  SecretsBackendType
+	flagRollouts        []string
+	flagPropagationWait time.Duration
+	flagMinTokenAge     time.Duration
+
+	flagLogLevel string
+	flagLogJSON  bool
+	flagTimeout  time.Duration
+
+	tokens   []tokenSpec
+	rollouts []rollout
+
+	backend     SecretsBackend // for unit testing.
+	clientset   kubernetes.Interface
+	vaultClient *vaultApi.Client
+
+	watcher consul.ServerConnectionManager
+
+	// ctx is cancelled when the command timeout is reached.
+	ctx           context.Context
+	retryDuration time.Duration
+
+	log hclog.Logger
+
+	once sync.Once
+	help string
+}
+
+// tokenSpec is a token to rotate and the secret it is stored in.
+type tokenSpec struct {
+	Name       string
+	SecretName string
+	SecretKey  string
+}
+
+// rotation is a token that was replaced by a new token.
+type rotation struct {
+	spec tokenSpec
+	old  *api.ACLToken
+	new  *api.ACLToken
+	// writeOptions target the datacenter the tokens are written in.
+	writeOptions *api.WriteOptions
+}
+
+func (c *Command) init() {
+	c.flags = flag.NewFlagSet("", flag.ContinueOnError)
+	c.flags.StringVar(&c.flagResourcePrefix, "resource-prefix", "",
+		"Prefix to use for Kubernetes resources.")
+	c.flags.StringVar(&c.flagK8sNamespace, "k8s-namespace", "",
+		"Name of Kubernetes namespace where the token secrets and rollouts are.")
+	c.flags.Var((*flags.AppendSliceValue)(&c.flagTokenNames), "token-name",
+		"Name of a token created by server-acl-init to rotate, e.g. \"partitions\", \"enterprise-license\" or "+
+			"\"acl-replication\". May be specified multiple times. The token is read from and written to the "+
+			"<resource-prefix>-<name>-acl-token secret unless the secret is given as <name>=<secret-name>[:<secret-key>].")
+	c.flags.StringVar((*string)(&c.flagSecretsBackend), "secrets-backend", string(SecretsBackendTypeKubernetes),
+		`The secrets backend the tokens are stored in. Either "vault" or "kubernetes". Defaults to "kubernetes".`)
+	c.flags.Var((*flags.AppendSliceValue)(&c.flagRollouts), "rollout",
+		"A workload that consumes the tokens, of the form <kind>/<name> where kind is one of \"deployment\", "+
+			"\"statefulset\" or \"daemonset\". Its pods are restarted after the tokens are rotated and the old "+
+			"tokens are revoked once the rollout completes. May be specified multiple times.")
+	c.flags.DurationVar(&c.flagPropagationWait, "propagation-wait", 2*time.Minute,
+		"How long to wait for consumers to pick up the new tokens from their secrets before revoking the old "+
+			"tokens when no -rollout is set.")
+	c.flags.DurationVar(&c.flagMinTokenAge, "min-token-age", 0,
+		"Only rotate tokens that were created at least this long ago, e.g. 2160h. Defaults to rotating all tokens.")
+	c.flags.DurationVar(&c.flagTimeout, "timeout", 30*time.Minute,
+		"How long we'll try to rotate tokens for before timing out, e.g. 1ms, 2s, 3m")
+	c.flags.StringVar(&c.flagLogLevel, "log-level", "info",
+		"Log verbosity level. Supported values (in order of detail) are \"trace\", "+
+			"\"debug\", \"info\", \"warn\", and \"error\".")
+	c.flags.BoolVar(&c.flagLogJSON, "log-json", false,
+		"Enable or disable JSON output format for logging.")
+
+	c.k8s = &flags.K8SFlags{}
+	c.consulFlags = &flags.ConsulFlags{}
+	flags.Merge(c.flags, c.k8s.Flags())
+	flags.Merge(c.flags, c.consulFlags.Flags())
+	c.help = flags.Usage(help, c.flags)
+
+	// Default retry to 1s. This is exposed for setting in tests.
+	if c.retryDuration == 0 {
+		c.retryDuration = 1 * time.Second
+	}
+}
+
+func (c *Command) Synopsis() string { return synopsis }
+func (c *Command) Help() string {
+	c.once.Do(c.init)
+	return c.help
+}
+
+// Run rotates the ACL tokens of control plane components. For each token, it
+// clones the token, writes the clone to the token's secret, waits for the
+// consumers of the secret to pick up the new token and then revokes the old
+// token.
+func (c *Command) Run(args []string) int {
+	c.once.Do(c.init)
+	defer c.quitVaultAgent()
+	if err := c.flags.Parse(args); err != nil {
+		return 1
+	}
+	if len(c.flags.Args()) > 0 {
+		c.UI.Error("Should have no non-flag arguments.")
+		return 1
+	}
+	if err := c.validateFlags(); err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	var cancel context.CancelFunc
+	c.ctx, cancel = context.WithTimeout(context.Background(), c.flagTimeout)
+	// The context will only ever be intentionally ended by the timeout.
+	defer cancel()
+
+	var err error
+	c.log, err = common.Logger(c.flagLogLevel, c.flagLogJSON)
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	// The ClientSet might already be set if we're in a test.
+	if c.clientset == nil && (c.flagSecretsBackend == SecretsBackendTypeKubernetes || len(c.rollouts) > 0) {
+		if err := c.configureKubeClient(); err != nil {
+			c.log.Error(err.Error())
+			return 1
+		}
+	}
+	if err := c.configureSecretsBackend(); err != nil {
+		c.log.Error(err.Error())
+		return 1
+	}
+
+	// Start Consul server Connection manager
+	watcher := c.watcher
+	if watcher == nil {
+		serverConnMgrCfg, err := c.consulFlags.ConsulServerConnMgrConfig()
+		if err != nil {
+			c.UI.Error(fmt.Sprintf("unable to create config for consul-server-connection-manager: %s", err))
+			return 1
+		}
+		watcher, err = discovery.NewWatcher(c.ctx, serverConnMgrCfg, c.log.Named("consul-server-connection-manager"))
+		if err != nil {
+			c.UI.Error(fmt.Sprintf("unable to create Consul server watcher: %s", err))
+			return 1
+		}
+	}
+	go watcher.Run()
+	defer watcher.Stop()
+
+	state, err := watcher.State()
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("unable to get Consul server addresses from watcher: %s", err))
+		return 1
+	}
+	consulClient, err := consul.NewClientFromConnMgrState(c.consulFlags.ConsulClientConfig(), state)
+	if err != nil {
+		c.log.Error(fmt.Sprintf("Error creating Consul client for addr %q: %s", state.Address, err))
+		return 1
+	}
+	dc, primaryDC, err := c.consulDatacenterList(consulClient)
+	if err != nil {
+		c.log.Error("Error getting datacenter name", "err", err)
+		return 1
+	}
+	c.log.Info("Current datacenter", "datacenter", dc, "primaryDC", primaryDC)
+
+	// Replace each token with a new token. If replacing a token fails, the
+	// tokens that were already replaced are still revoked once their
+	// consumers picked up the new tokens.
+	var rotations []*rotation
+	failed := false
+	for _, spec := range c.tokens {
+		r, err := c.replaceToken(consulClient, spec, dc, primaryDC)
+		if err != nil {
+			c.log.Error(fmt.Sprintf("Error rotating %s token", spec.Name), "err", err)
+			failed = true
+			break
+		}
+		if r != nil {
+			rotations = append(rotations, r)
+		}
+	}
+
+	if len(rotations) > 0 {
+		if err := c.waitForConsumers(); err != nil {
+			// The old tokens are still valid and are revoked by the next run.
+			c.log.Error("Error waiting for consumers to pick up the new tokens; the old tokens were not revoked", "err", err)
+			return 1
+		}
+		for _, r := range rotations {
+			if err := c.revokeOldToken(consulClient, r); err != nil {
+				c.log.Error(fmt.Sprintf("Error revoking old %s token", r.spec.Name), "err", err)
+				failed = true
+			}
+		}
+	}
+
+	if failed {
+		return 1
+	}
+	c.log.Info("rotate-acl-tokens completed successfully", "rotated", len(rotations))
+	return 0
+}
+
+// replaceToken clones the token stored in the secret of spec and writes the
+// clone to the secret. It returns nil if the token doesn't need rotating.
+func (c *Command) replaceToken(consulClient *api.Client, spec tokenSpec, dc, primaryDC string) (*rotation, error) {
+	var stored tokenSecret
+	err := c.untilSucceeds(fmt.Sprintf("reading %s token from secret %q", spec.Name, spec.SecretName),
+		func() error {
+			var err error
+			stored, err = c.backend.ReadToken(spec.SecretName, spec.SecretKey)
+			return err
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	var old *api.ACLToken
+	err = c.untilSucceeds(fmt.Sprintf("reading %s token from Consul", spec.Name),
+		func() error {
+			var err error
+			old, _, err = consulClient.ACL().TokenReadSelf(&api.QueryOptions{Token: stored.SecretID})
+			return err
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	// Global tokens can only be written in the primary datacenter.
+	writeOptions := &api.WriteOptions{}
+	if !old.Local && dc != primaryDC {
+		writeOptions.Datacenter = primaryDC
+	}
+
+	// Revoke the token replaced by the previous rotation if that rotation
+	// was interrupted before revoking it.
+	if stored.PreviousAccessorID != "" && stored.PreviousAccessorID != old.AccessorID {
+		if err := c.revokeToken(consulClient, stored.PreviousAccessorID, writeOptions); err != nil {
+			return nil, fmt.Errorf("revoking token replaced by a previous rotation: %w", err)
+		}
+	}
+
+	if c.flagMinTokenAge > 0 && time.Since(old.CreateTime) < c.flagMinTokenAge {
+		c.log.Info(fmt.Sprintf("Skipping %s token created less than %s ago", spec.Name, c.flagMinTokenAge), "accessor-id", old.AccessorID)
+		return nil, nil
+	}
+
+	newToken, _, err := consulClient.ACL().TokenClone(old.AccessorID, old.Description, writeOptions)
+	if err != nil {
+		return nil, fmt.Errorf("cloning token %s: %w", old.AccessorID, err)
+	}
+	c.log.Info(fmt.Sprintf("Created new %s token", spec.Name), "accessor-id", newToken.AccessorID)
+
+	_, err = c.backend.WriteToken(spec.SecretName, spec.SecretKey, tokenSecret{
+		SecretID:           newToken.SecretID,
+		PreviousAccessorID: old.AccessorID,
+		Version:            stored.Version,
+	})
+	if err != nil {
+		// Nothing can be using the new token yet so it's safe to revoke.
+		if revokeErr := c.revokeToken(consulClient, newToken.AccessorID, writeOptions); revokeErr != nil {
+			c.log.Error("Error revoking new token after failing to write it", "accessor-id", newToken.AccessorID, "err", revokeErr)
+		}
+		return nil, fmt.Errorf("writing new token to secret %q: %w", spec.SecretName, err)
+	}
+	c.log.Info(fmt.Sprintf("Wrote new %s token to secret %q", spec.Name, spec.SecretName))
+
+	return &rotation{
+		spec:         spec,
+		old:          old,
+		new:          newToken,
+		writeOptions: writeOptions,
+	}, nil
+}
+
+// waitForConsumers waits for the consumers of the tokens to pick up the new
+// tokens. If rollouts are set, their pods are restarted and it waits until
+// the rollouts complete. Otherwise, it waits for secrets to propagate to the
+// pods that mount them.
+func (c *Command) waitForConsumers() error {
+	if len(c.rollouts) == 0 {
+		c.log.Info("Waiting for the new tokens to propagate", "duration", c.flagPropagationWait)
+		select {
+		case <-time.After(c.flagPropagationWait):
+			return nil
+		case <-c.ctx.Done():
+			return errors.New("reached command timeout")
+		}
+	}
+
+	now := time.Now()
+	for _, r := range c.rollouts {
+		err := c.untilSucceeds(fmt.Sprintf("restarting %s", r), func() error {
+			return c.restart(r, now)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for _, r := range c.rollouts {
+		err := c.untilSucceeds(fmt.Sprintf("waiting for %s to roll out", r), func() error {
+			done, err := c.rolledOut(r)
+			if err != nil {
+				return err
+			}
+			if !done {
+				return fmt.Errorf("%s has not rolled out yet", r)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// revokeOldToken revokes the token replaced by r once the new token is in
+// use. The old token is kept if the secret no longer holds the new token.
+func (c *Command) revokeOldToken(consulClient *api.Client, r *rotation) error {
+	var stored tokenSecret
+	err := c.untilSucceeds(fmt.Sprintf("reading %s token from secret %q", r.spec.Name, r.spec.SecretName),
+		func() error {
+			var err error
+			stored, err = c.backend.ReadToken(r.spec.SecretName, r.spec.SecretKey)
+			return err
+		})
+	if err != nil {
+		return err
+	}
+	if stored.SecretID != r.new.SecretID {
+		return fmt.Errorf("secret %q was modified during rotation; not revoking token %s", r.spec.SecretName, r.old.AccessorID)
+	}
+
+	// Wait until the new token can be used in this datacenter. Global
+	// tokens created in the primary datacenter must first be replicated.
+	err = c.untilSucceeds(fmt.Sprintf("checking new %s token", r.spec.Name),
+		func() error {
+			_, _, err := consulClient.ACL().TokenReadSelf(&api.QueryOptions{Token: r.new.SecretID})
+			return err
+		})
+	if err != nil {
+		return err
+	}
+
+	if err := c.revokeToken(consulClient, r.old.AccessorID, r.writeOptions); err != nil {
+		return err
+	}
+	c.log.Info(fmt.Sprintf("Rotated %s token", r.spec.Name), "old-accessor-id", r.old.AccessorID, "new-accessor-id", r.new.AccessorID)
+	return nil
+}
+
+// revokeToken deletes the token if it still exists.
+func (c *Command) revokeToken(consulClient *api.Client, accessorID string, writeOptions *api.WriteOptions) error {
+	return c.untilSucceeds(fmt.Sprintf("revoking token %s", accessorID),
+		func() error {
+			token, _, err := consulClient.ACL().TokenRead(accessorID, &api.QueryOptions{Datacenter: writeOptions.Datacenter})
+			if err != nil {
+				if isTokenNotFound(err) {
+					return nil
+				}
+				return err
+			}
+			if token == nil {
+				return nil
+			}
+			_, err = consulClient.ACL().TokenDelete(accessorID, writeOptions)
+			return err
+		})
+}
+
+// isTokenNotFound returns whether err is the error Consul returns when
+// reading a token that doesn't exist.
+func isTokenNotFound(err error) bool {
+	return strings.Contains(err.Error(), "ACL not found") ||
+		strings.Contains(err.Error(), "Token not found")
+}
+
+func (c *Command) validateFlags() error {
+	if c.consulFlags.Addresses == "" {
+		return errors.New("-addresses must be set")
+	}
+	if len(c.flagTokenNames) == 0 {
+		return errors.New("-token-name must be set")
+	}
+	switch c.flagSecretsBackend {
+	case SecretsBackendTypeKubernetes, SecretsBackendTypeVault:
+	default:
+		return fmt.Errorf("-secrets-backend must be one of %q or %q", SecretsBackendTypeKubernetes, SecretsBackendTypeVault)
+	}
+
+	c.tokens = nil
+	for _, name := range c.flagTokenNames {
+		spec, err := c.parseTokenSpec(name)
+		if err != nil {
+			return err
+		}
+		c.tokens = append(c.tokens, spec)
+	}
+	c.rollouts = nil
+	for _, s := range c.flagRollouts {
+		r, err := parseRollout(s)
+		if err != nil {
+			return err
+		}
+		c.rollouts = append(c.rollouts, r)
+	}
+
+	if c.flagK8sNamespace == "" && (c.flagSecretsBackend == SecretsBackendTypeKubernetes || len(c.rollouts) > 0) {
+		return errors.New("-k8s-namespace must be set")
+	}
+	if c.flagPropagationWait < 0 {
+		return errors.New("-propagation-wait must be >= 0 if set")
+	}
+	if c.flagMinTokenAge < 0 {
+		return errors.New("-min-token-age must be >= 0 if set")
+	}
+	if c.consulFlags.APITimeout <= 0 {
+		return errors.New("-consul-api-timeout must be set to a value greater than 0")
+	}
+	return nil
+}
+
+// parseTokenSpec parses a token of the form <name>[=<secret-name>[:<secret-key>]].
+func (c *Command) parseTokenSpec(s string) (tokenSpec, error) {
+	spec := tokenSpec{SecretKey: common.ACLTokenSecretKey}
+	name, secret, hasSecret := strings.Cut(s, "=")
+	spec.Name = strings.TrimSpace(name)
+	if spec.Name == "" {
+		return tokenSpec{}, fmt.Errorf("-token-name %q must have a name", s)
+	}
+	if hasSecret {
+		secretName, secretKey, hasKey := strings.Cut(secret, ":")
+		if secretName == "" || (hasKey && secretKey == "") {
+			return tokenSpec{}, fmt.Errorf("-token-name %q must be of the form <name>[=<secret-name>[:<secret-key>]]", s)
+		}
+		spec.SecretName = secretName
+		if hasKey {
+			spec.SecretKey = secretKey
+		}
+		return spec, nil
+	}
+	if c.flagSecretsBackend == SecretsBackendTypeVault {
+		return tokenSpec{}, fmt.Errorf("-token-name %q must include the Vault secret name when -secrets-backend=vault", s)
+	}
+	if c.flagResourcePrefix == "" {
+		return tokenSpec{}, fmt.Errorf("-resource-prefix must be set if -token-name %q does not include a secret name", s)
+	}
+	spec.SecretName = fmt.Sprintf("%s-%s-acl-token", c.flagResourcePrefix, spec.Name)
+	return spec, nil
+}
+
+func (c *Command) configureKubeClient() error {
+	config, err := subcommand.K8SConfig(c.k8s.KubeConfig())
+	if err != nil {
+		return fmt.Errorf("error retrieving Kubernetes auth: %s", err)
+	}
+	c.clientset, err = kubernetes.NewForConfig(config)
+	if err != nil {
+		return fmt.Errorf("error initializing Kubernetes client: %s", err)
+	}
+	return nil
+}
+
+// configureSecretsBackend configures either the Kubernetes or Vault
+// secrets backend based on flags.
+func (c *Command) configureSecretsBackend() error {
+	if c.backend != nil {
+		// support a fake backend in unit tests
+		return nil
+	}
+	switch c.flagSecretsBackend {
+	case SecretsBackendTypeKubernetes:
+		c.backend = &KubernetesSecretsBackend{
+			ctx:          c.ctx,
+			clientset:    c.clientset,
+			k8sNamespace: c.flagK8sNamespace,
+		}
+		return nil
+	case SecretsBackendTypeVault:
+		cfg := vaultApi.DefaultConfig()
+		cfg.Address = ""
+		cfg.AgentAddress = "http://127.0.0.1:8200"
+		vaultClient, err := vaultApi.NewClient(cfg)
+		if err != nil {
+			return fmt.Errorf("Error initializing Vault client: %w", err)
+		}
+		c.vaultClient = vaultClient // must set this for c.quitVaultAgent.
+		c.backend = &VaultSecretsBackend{vaultClient: c.vaultClient}
+		return nil
+	}
+	return fmt.Errorf("Invalid value for -secrets-backend: %q", c.flagSecretsBackend)
+}
+
+// consulDatacenterList returns the current datacenter name and the primary
+// datacenter using the /agent/self API.
+func (c *Command) consulDatacenterList(client *api.Client) (string, string, error) {
+	var agentCfg map[string]map[string]interface{}
+	err := c.untilSucceeds("calling /agent/self to get datacenter",
+		func() error {
+			var opErr error
+			agentCfg, opErr = client.Agent().Self()
+			return opErr
+		})
+	if err != nil {
+		return "", "", err
+	}
+	var agentConfig struct {
+		Config struct {
+			Datacenter        string `mapstructure:"Datacenter"`
+			PrimaryDatacenter string `mapstructure:"PrimaryDatacenter"`
+		}
+	}
+	if err := mapstructure.Decode(agentCfg, &agentConfig); err != nil {
+		return "", "", err
+	}
+	if agentConfig.Config.Datacenter == "" {
+		return "", "", fmt.Errorf("/agent/self response did not contain Config.Datacenter key: %s", agentCfg)
+	}
+	primaryDC := agentConfig.Config.PrimaryDatacenter
+	if primaryDC == "" {
+		primaryDC = agentConfig.Config.Datacenter
+	}
+	return agentConfig.Config.Datacenter, primaryDC, nil
+}
+
+// untilSucceeds runs op until it returns a nil error.
+// If c.cmdTimeout is cancelled it will exit.
+func (c *Command) untilSucceeds(opName string, op func() error) error {
+	for {
+		err := op()
+		if err == nil {
+			c.log.Info(fmt.Sprintf("Success: %s", opName))
+			break
+		}
+		c.log.Error(fmt.Sprintf("Failure: %s", opName), "err", err)
+		c.log.Info("Retrying in " + c.retryDuration.String())
+		// Wait on either the retry duration (in which case we continue) or the
+		// overall command timeout.
+		select {
+		case <-time.After(c.retryDuration):
+			continue
+		case <-c.ctx.Done():
+			return errors.New("reached command timeout")
+		}
+	}
+	return nil
+}
+
+func (c *Command) quitVaultAgent() {
+	if c.vaultClient == nil {
+		return
+	}
+
+	// Tell the Vault agent sidecar to quit. Without this, the Job does not
+	// complete because the Vault agent does not stop. This retries because it
+	// does not know exactly when the Vault agent sidecar will start.
+	err := c.untilSucceeds("tell Vault agent to quit", func() error {
+		// nolint:staticcheck // SA1004 ignore
+		_, err := c.vaultClient.RawRequest(
+			c.vaultClient.NewRequest("POST", "/agent/v1/quit"),
+		)
+		return err
+	})
+	if err != nil {
+		c.log.Error("Error telling Vault agent to quit", "error", err)
+	}
+}
+
+const synopsis = "Rotate the ACL tokens of Consul control plane components."
+const help = `
+Usage: consul-k8s-control-plane rotate-acl-tokens [options]
+
+  Rotates ACL tokens created by server-acl-init that are stored in
+  Kubernetes or Vault secrets, such as the partition, enterprise license
+  and ACL replication tokens. Components that log in with an auth method
+  get short-lived tokens and don't need rotating.
+
+  For each token, a new token with the same policies is created and
+  written to the token's secret. Once the consumers of the secrets have
+  picked up the new tokens, either by waiting for secrets to propagate or
+  by restarting the given rollouts, the old tokens are revoked. Global
+  tokens are rotated in the primary datacenter.
+
+  If a run is interrupted before the old tokens are revoked, they are
+  revoked by the next run, so it is safe to run as a CronJob.
+
+`
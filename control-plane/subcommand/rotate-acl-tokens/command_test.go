@@ -0,0 +1,436 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package rotateacltokens
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul-k8s/control-plane/helper/test"
+	"github.com/hashicorp/consul/api"
+	"github.com/hashicorp/go-hclog"
+	"github.com/mitchellh/cli"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestRun_FlagValidation(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		Flags  []string
+		ExpErr string
+	}{
+		{
+			Flags:  []string{},
+			ExpErr: "-addresses must be set",
+		},
+		{
+			Flags:  []string{"-addresses=localhost"},
+			ExpErr: "-token-name must be set",
+		},
+		{
+			Flags:  []string{"-addresses=localhost", "-token-name=partitions", "-secrets-backend=foo"},
+			ExpErr: "-secrets-backend must be one of \"kubernetes\" or \"vault\"",
+		},
+		{
+			Flags:  []string{"-addresses=localhost", "-token-name=partitions"},
+			ExpErr: "-resource-prefix must be set if -token-name \"partitions\" does not include a secret name",
+		},
+		{
+			Flags:  []string{"-addresses=localhost", "-token-name=partitions", "-secrets-backend=vault"},
+			ExpErr: "-token-name \"partitions\" must include the Vault secret name when -secrets-backend=vault",
+		},
+		{
+			Flags:  []string{"-addresses=localhost", "-token-name=partitions=secret:"},
+			ExpErr: "-token-name \"partitions=secret:\" must be of the form <name>[=<secret-name>[:<secret-key>]]",
+		},
+		{
+			Flags:  []string{"-addresses=localhost", "-token-name=partitions=secret", "-rollout=job/foo"},
+			ExpErr: "-rollout \"job/foo\" has unsupported kind \"job\"",
+		},
+		{
+			Flags:  []string{"-addresses=localhost", "-token-name=partitions=secret"},
+			ExpErr: "-k8s-namespace must be set",
+		},
+		{
+			Flags:  []string{"-addresses=localhost", "-token-name=partitions=secret", "-k8s-namespace=default", "-propagation-wait=-1s"},
+			ExpErr: "-propagation-wait must be >= 0 if set",
+		},
+		{
+			Flags:  []string{"-addresses=localhost", "-token-name=partitions=secret", "-k8s-namespace=default", "-min-token-age=-1s"},
+			ExpErr: "-min-token-age must be >= 0 if set",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.ExpErr, func(t *testing.T) {
+			ui := cli.NewMockUi()
+			cmd := Command{
+				UI: ui,
+			}
+			responseCode := cmd.Run(c.Flags)
+			require.Equal(t, 1, responseCode, ui.ErrorWriter.String())
+			require.Contains(t, ui.ErrorWriter.String(), c.ExpErr)
+		})
+	}
+}
+
+func TestParseTokenSpec(t *testing.T) {
+	t.Parallel()
+
+	cmd := Command{flagResourcePrefix: "release-consul"}
+	cases := map[string]tokenSpec{
+		"partitions": {
+			Name:       "partitions",
+			SecretName: "release-consul-partitions-acl-token",
+			SecretKey:  "token",
+		},
+		"partitions=my-secret": {
+			Name:       "partitions",
+			SecretName: "my-secret",
+			SecretKey:  "token",
+		},
+		"acl-replication=consul/data/replication:key": {
+			Name:       "acl-replication",
+			SecretName: "consul/data/replication",
+			SecretKey:  "key",
+		},
+	}
+	for s, exp := range cases {
+		t.Run(s, func(t *testing.T) {
+			spec, err := cmd.parseTokenSpec(s)
+			require.NoError(t, err)
+			require.Equal(t, exp, spec)
+		})
+	}
+}
+
+func TestParseRollout(t *testing.T) {
+	t.Parallel()
+
+	r, err := parseRollout("StatefulSet/consul-server")
+	require.NoError(t, err)
+	require.Equal(t, rollout{Kind: rolloutKindStatefulSet, Name: "consul-server"}, r)
+
+	_, err = parseRollout("deployment")
+	require.EqualError(t, err, "-rollout \"deployment\" must be of the form <kind>/<name>")
+}
+
+func TestRolledOut(t *testing.T) {
+	t.Parallel()
+
+	replicas := int32(2)
+	cases := map[string]struct {
+		status appsv1.DeploymentStatus
+		exp    bool
+	}{
+		"rolled out": {
+			status: appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 2, UpdatedReplicas: 2, AvailableReplicas: 2},
+			exp:    true,
+		},
+		"generation not observed": {
+			status: appsv1.DeploymentStatus{ObservedGeneration: 1, Replicas: 2, UpdatedReplicas: 2, AvailableReplicas: 2},
+		},
+		"old pods remaining": {
+			status: appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 3, UpdatedReplicas: 2, AvailableReplicas: 2},
+		},
+		"pods not available": {
+			status: appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 2, UpdatedReplicas: 2, AvailableReplicas: 1},
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			cmd := Command{
+				clientset: fake.NewSimpleClientset(&appsv1.Deployment{
+					ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default", Generation: 2},
+					Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+					Status:     c.status,
+				}),
+				flagK8sNamespace: "default",
+				ctx:              context.Background(),
+			}
+			done, err := cmd.rolledOut(rollout{Kind: rolloutKindDeployment, Name: "web"})
+			require.NoError(t, err)
+			require.Equal(t, c.exp, done)
+		})
+	}
+}
+
+// Test that tokens are replaced in their secrets and the old tokens are
+// revoked. Global tokens are rotated in the primary datacenter.
+func TestRun_RotatesTokens(t *testing.T) {
+	t.Parallel()
+
+	consul := newFakeConsulTokens("dc2", "dc1",
+		&api.ACLToken{AccessorID: "partitions-accessor", SecretID: "partitions-secret", Description: "partitions Token"},
+		&api.ACLToken{AccessorID: "license-accessor", SecretID: "license-secret", Description: "enterprise-license Token", Local: true},
+	)
+	k8s := fake.NewSimpleClientset(
+		tokenK8sSecret("release-consul-partitions-acl-token", "partitions-secret", ""),
+		tokenK8sSecret("release-consul-enterprise-license-acl-token", "license-secret", ""),
+	)
+
+	responseCode, ui := runCommand(t, consul, k8s,
+		"-token-name=partitions",
+		"-token-name=enterprise-license",
+		"-propagation-wait=0s",
+	)
+	require.Equal(t, 0, responseCode, ui.ErrorWriter.String())
+
+	for name, secretName := range map[string]string{
+		"partitions": "release-consul-partitions-acl-token",
+		"license":    "release-consul-enterprise-license-acl-token",
+	} {
+		secret, err := k8s.CoreV1().Secrets("default").Get(context.Background(), secretName, metav1.GetOptions{})
+		require.NoError(t, err)
+		newToken := consul.bySecret(string(secret.Data["token"]))
+		require.NotNil(t, newToken, "secret %s has no valid token", secretName)
+		require.NotEqual(t, name+"-secret", newToken.SecretID)
+		require.Equal(t, name+"-accessor", secret.Annotations[previousAccessorIDAnnotation])
+		require.Nil(t, consul.token(name+"-accessor"), "old %s token was not revoked", name)
+	}
+
+	// The global token is cloned and deleted in the primary datacenter and
+	// the local token in the current datacenter.
+	require.Equal(t, []string{
+		"clone partitions-accessor dc=dc1",
+		"clone license-accessor dc=",
+		"delete partitions-accessor dc=dc1",
+		"delete license-accessor dc=",
+	}, consul.writes)
+}
+
+// Test that a token replaced by an interrupted rotation is revoked and that
+// tokens younger than -min-token-age are not rotated.
+func TestRun_RevokesPreviousTokenAndSkipsNewTokens(t *testing.T) {
+	t.Parallel()
+
+	consul := newFakeConsulTokens("dc1", "dc1",
+		&api.ACLToken{AccessorID: "old-accessor", SecretID: "old-secret"},
+		&api.ACLToken{AccessorID: "current-accessor", SecretID: "current-secret", CreateTime: time.Now()},
+	)
+	k8s := fake.NewSimpleClientset(
+		tokenK8sSecret("release-consul-partitions-acl-token", "current-secret", "old-accessor"),
+	)
+
+	responseCode, ui := runCommand(t, consul, k8s,
+		"-token-name=partitions",
+		"-min-token-age=24h",
+	)
+	require.Equal(t, 0, responseCode, ui.ErrorWriter.String())
+	require.Equal(t, []string{"delete old-accessor dc="}, consul.writes)
+
+	secret, err := k8s.CoreV1().Secrets("default").Get(context.Background(), "release-consul-partitions-acl-token", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Equal(t, "current-secret", string(secret.Data["token"]))
+}
+
+// Test that rollouts are restarted before the old tokens are revoked.
+func TestRun_RestartsRollouts(t *testing.T) {
+	t.Parallel()
+
+	consul := newFakeConsulTokens("dc1", "dc1",
+		&api.ACLToken{AccessorID: "partitions-accessor", SecretID: "partitions-secret"},
+	)
+	replicas := int32(1)
+	k8s := fake.NewSimpleClientset(
+		tokenK8sSecret("release-consul-partitions-acl-token", "partitions-secret", ""),
+		&appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "consul-server", Namespace: "default"},
+			Spec:       appsv1.StatefulSetSpec{Replicas: &replicas},
+			Status:     appsv1.StatefulSetStatus{UpdatedReplicas: 1, ReadyReplicas: 1},
+		},
+	)
+
+	responseCode, ui := runCommand(t, consul, k8s,
+		"-token-name=partitions",
+		"-rollout=statefulset/consul-server",
+	)
+	require.Equal(t, 0, responseCode, ui.ErrorWriter.String())
+
+	sts, err := k8s.AppsV1().StatefulSets("default").Get(context.Background(), "consul-server", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.NotEmpty(t, sts.Spec.Template.Annotations[rotatedAtAnnotation])
+	require.Nil(t, consul.token("partitions-accessor"))
+}
+
+// Test that the old token isn't revoked if the secret is changed while
+// waiting for consumers.
+func TestRevokeOldToken_SecretModified(t *testing.T) {
+	t.Parallel()
+
+	consul := newFakeConsulTokens("dc1", "dc1",
+		&api.ACLToken{AccessorID: "old-accessor", SecretID: "old-secret"},
+	)
+	server := httptest.NewServer(consul)
+	defer server.Close()
+	client, err := api.NewClient(&api.Config{Address: server.URL})
+	require.NoError(t, err)
+
+	k8s := fake.NewSimpleClientset(tokenK8sSecret("secret", "other-secret", ""))
+	cmd := Command{
+		log:           hclog.NewNullLogger(),
+		ctx:           context.Background(),
+		retryDuration: 10 * time.Millisecond,
+		backend:       &KubernetesSecretsBackend{ctx: context.Background(), clientset: k8s, k8sNamespace: "default"},
+	}
+	err = cmd.revokeOldToken(client, &rotation{
+		spec:         tokenSpec{Name: "partitions", SecretName: "secret", SecretKey: "token"},
+		old:          &api.ACLToken{AccessorID: "old-accessor"},
+		new:          &api.ACLToken{AccessorID: "new-accessor", SecretID: "new-secret"},
+		writeOptions: &api.WriteOptions{},
+	})
+	require.EqualError(t, err, "secret \"secret\" was modified during rotation; not revoking token old-accessor")
+	require.NotNil(t, consul.token("old-accessor"))
+}
+
+func TestKubernetesSecretsBackend_WriteTokenConflict(t *testing.T) {
+	t.Parallel()
+
+	secret := tokenK8sSecret("secret", "token", "")
+	secret.ResourceVersion = "2"
+	backend := &KubernetesSecretsBackend{
+		ctx:          context.Background(),
+		clientset:    fake.NewSimpleClientset(secret),
+		k8sNamespace: "default",
+	}
+	_, err := backend.WriteToken("secret", "token", tokenSecret{SecretID: "new", Version: "1"})
+	require.EqualError(t, err, "secret \"secret\" was modified: expected resourceVersion \"1\" but found \"2\"")
+}
+
+func runCommand(t *testing.T, consul *fakeConsulTokens, k8s *fake.Clientset, args ...string) (int, *cli.MockUi) {
+	server := httptest.NewServer(consul)
+	t.Cleanup(server.Close)
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	port, err := strconv.Atoi(serverURL.Port())
+	require.NoError(t, err)
+
+	ui := cli.NewMockUi()
+	cmd := Command{
+		UI:            ui,
+		clientset:     k8s,
+		watcher:       test.MockConnMgrForIPAndPort(serverURL.Hostname(), port),
+		retryDuration: 10 * time.Millisecond,
+	}
+	return cmd.Run(append([]string{
+		"-timeout=10s",
+		"-resource-prefix=release-consul",
+		"-k8s-namespace=default",
+		"-addresses=" + serverURL.Hostname(),
+		"-http-port=" + serverURL.Port(),
+	}, args...)), ui
+}
+
+func tokenK8sSecret(name, token, previousAccessorID string) *v1.Secret {
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Data:       map[string][]byte{"token": []byte(token)},
+	}
+	if previousAccessorID != "" {
+		secret.Annotations = map[string]string{previousAccessorIDAnnotation: previousAccessorID}
+	}
+	return secret
+}
+
+// fakeConsulTokens serves the ACL token APIs used to rotate tokens and
+// records writes with the datacenter they were made in.
+type fakeConsulTokens struct {
+	dc, primaryDC string
+
+	mu     sync.Mutex
+	tokens map[string]*api.ACLToken
+	writes []string
+	next   int
+}
+
+func newFakeConsulTokens(dc, primaryDC string, tokens ...*api.ACLToken) *fakeConsulTokens {
+	f := &fakeConsulTokens{dc: dc, primaryDC: primaryDC, tokens: make(map[string]*api.ACLToken)}
+	for _, token := range tokens {
+		f.tokens[token.AccessorID] = token
+	}
+	return f
+}
+
+func (f *fakeConsulTokens) token(accessorID string) *api.ACLToken {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.tokens[accessorID]
+}
+
+func (f *fakeConsulTokens) bySecret(secretID string) *api.ACLToken {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, token := range f.tokens {
+		if token.SecretID == secretID {
+			return token
+		}
+	}
+	return nil
+}
+
+func (f *fakeConsulTokens) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var resp interface{}
+	switch {
+	case r.URL.Path == "/v1/agent/self":
+		resp = map[string]interface{}{
+			"Config": map[string]interface{}{"Datacenter": f.dc, "PrimaryDatacenter": f.primaryDC},
+		}
+	case r.URL.Path == "/v1/acl/token/self":
+		resp = f.bySecret(r.Header.Get("X-Consul-Token"))
+	case strings.HasSuffix(r.URL.Path, "/clone") && r.Method == http.MethodPut:
+		accessorID := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/v1/acl/token/"), "/clone")
+		if old := f.token(accessorID); old != nil {
+			f.mu.Lock()
+			f.next++
+			clone := *old
+			clone.AccessorID = fmt.Sprintf("new-accessor-%d", f.next)
+			clone.SecretID = fmt.Sprintf("new-secret-%d", f.next)
+			clone.CreateTime = time.Now()
+			f.tokens[clone.AccessorID] = &clone
+			f.writes = append(f.writes, fmt.Sprintf("clone %s dc=%s", accessorID, r.URL.Query().Get("dc")))
+			f.mu.Unlock()
+			resp = &clone
+		}
+	case strings.HasPrefix(r.URL.Path, "/v1/acl/token/"):
+		accessorID := strings.TrimPrefix(r.URL.Path, "/v1/acl/token/")
+		token := f.token(accessorID)
+		if token == nil {
+			break
+		}
+		if r.Method == http.MethodDelete {
+			f.mu.Lock()
+			delete(f.tokens, accessorID)
+			f.writes = append(f.writes, fmt.Sprintf("delete %s dc=%s", accessorID, r.URL.Query().Get("dc")))
+			f.mu.Unlock()
+			resp = true
+		} else {
+			resp = token
+		}
+	default:
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintln(w, "Mock Server not configured for this route: "+r.URL.Path)
+		return
+	}
+	if resp == nil || resp == (*api.ACLToken)(nil) {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, "ACL not found")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
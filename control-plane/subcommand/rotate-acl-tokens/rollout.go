@@ -0,0 +1,111 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package rotateacltokens
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// rotatedAtAnnotation is the pod template annotation that is set to restart
+// the pods of a workload after its tokens are rotated.
+const rotatedAtAnnotation = "consul.hashicorp.com/acl-tokens-rotated-at"
+
+const (
+	rolloutKindDeployment  = "deployment"
+	rolloutKindStatefulSet = "statefulset"
+	rolloutKindDaemonSet   = "daemonset"
+)
+
+// rollout is a workload whose pods consume rotated tokens and are restarted
+// to pick them up.
+type rollout struct {
+	Kind string
+	Name string
+}
+
+func (r rollout) String() string {
+	return fmt.Sprintf("%s/%s", r.Kind, r.Name)
+}
+
+// parseRollout parses a rollout of the form <kind>/<name>.
+func parseRollout(s string) (rollout, error) {
+	parts := strings.SplitN(s, "/", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return rollout{}, fmt.Errorf("-rollout %q must be of the form <kind>/<name>", s)
+	}
+	r := rollout{Kind: strings.ToLower(parts[0]), Name: parts[1]}
+	switch r.Kind {
+	case rolloutKindDeployment, rolloutKindStatefulSet, rolloutKindDaemonSet:
+		return r, nil
+	default:
+		return rollout{}, fmt.Errorf("-rollout %q has unsupported kind %q: must be one of %q, %q or %q",
+			s, parts[0], rolloutKindDeployment, rolloutKindStatefulSet, rolloutKindDaemonSet)
+	}
+}
+
+// restart restarts the pods of the workload by setting an annotation on its
+// pod template, the same way `kubectl rollout restart` does.
+func (c *Command) restart(r rollout, now time.Time) error {
+	patch := []byte(fmt.Sprintf(`{"spec":{"template":{"metadata":{"annotations":{%q:%q}}}}}`,
+		rotatedAtAnnotation, now.UTC().Format(time.RFC3339)))
+	var err error
+	apps := c.clientset.AppsV1()
+	switch r.Kind {
+	case rolloutKindDeployment:
+		_, err = apps.Deployments(c.flagK8sNamespace).Patch(c.ctx, r.Name, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+	case rolloutKindStatefulSet:
+		_, err = apps.StatefulSets(c.flagK8sNamespace).Patch(c.ctx, r.Name, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+	case rolloutKindDaemonSet:
+		_, err = apps.DaemonSets(c.flagK8sNamespace).Patch(c.ctx, r.Name, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+	}
+	return err
+}
+
+// rolledOut returns whether all pods of the workload have been updated and
+// are available.
+func (c *Command) rolledOut(r rollout) (bool, error) {
+	apps := c.clientset.AppsV1()
+	switch r.Kind {
+	case rolloutKindDeployment:
+		d, err := apps.Deployments(c.flagK8sNamespace).Get(c.ctx, r.Name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		replicas := int32(1)
+		if d.Spec.Replicas != nil {
+			replicas = *d.Spec.Replicas
+		}
+		return d.Status.ObservedGeneration >= d.Generation &&
+			d.Status.UpdatedReplicas == replicas &&
+			d.Status.Replicas == replicas &&
+			d.Status.AvailableReplicas == replicas, nil
+	case rolloutKindStatefulSet:
+		s, err := apps.StatefulSets(c.flagK8sNamespace).Get(c.ctx, r.Name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		replicas := int32(1)
+		if s.Spec.Replicas != nil {
+			replicas = *s.Spec.Replicas
+		}
+		return s.Status.ObservedGeneration >= s.Generation &&
+			s.Status.UpdatedReplicas == replicas &&
+			s.Status.ReadyReplicas == replicas &&
+			s.Status.CurrentRevision == s.Status.UpdateRevision, nil
+	case rolloutKindDaemonSet:
+		ds, err := apps.DaemonSets(c.flagK8sNamespace).Get(c.ctx, r.Name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		return ds.Status.ObservedGeneration >= ds.Generation &&
+			ds.Status.UpdatedNumberScheduled == ds.Status.DesiredNumberScheduled &&
+			ds.Status.NumberAvailable == ds.Status.DesiredNumberScheduled, nil
+	}
+	return false, fmt.Errorf("unsupported rollout kind %q", r.Kind)
+}
@@ -0,0 +1,174 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package rotateacltokens
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	vaultApi "github.com/hashicorp/vault/api"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+type SecretsBackendType string
+
+const (
+	SecretsBackendTypeKubernetes SecretsBackendType = "kubernetes"
+	SecretsBackendTypeVault      SecretsBackendType = "vault"
+)
+
+// previousAccessorIDAnnotation is the annotation on a Kubernetes secret with
+// the accessor ID of the token that was replaced by the token in the secret.
+const previousAccessorIDAnnotation = "consul.hashicorp.com/previous-token-accessor-id"
+
+// tokenSecret is a token stored in a secrets backend.
+type tokenSecret struct {
+	// SecretID is the secret ID of the token.
+	SecretID string
+	// PreviousAccessorID is the accessor ID of the token this token replaced.
+	// It's revoked by the next rotation if a previous rotation was
+	// interrupted before revoking it.
+	PreviousAccessorID string
+	// Version is the version of the secret, e.g. the resourceVersion of a
+	// Kubernetes secret.
+	Version string
+}
+
+// SecretsBackend reads and writes the tokens of components.
+type SecretsBackend interface {
+	// ReadToken reads the token stored under key in the secret. It returns
+	// an error if the secret or key don't exist.
+	ReadToken(secretName, secretKey string) (tokenSecret, error)
+
+	// WriteToken writes the token under key in the secret and returns the
+	// new version of the secret. The write fails if the secret's version is
+	// no longer token.Version.
+	WriteToken(secretName, secretKey string, token tokenSecret) (string, error)
+}
+
+// KubernetesSecretsBackend stores tokens in Kubernetes secrets.
+type KubernetesSecretsBackend struct {
+	ctx          context.Context
+	clientset    kubernetes.Interface
+	k8sNamespace string
+}
+
+var _ SecretsBackend = (*KubernetesSecretsBackend)(nil)
+
+func (b *KubernetesSecretsBackend) ReadToken(secretName, secretKey string) (tokenSecret, error) {
+	secret, err := b.clientset.CoreV1().Secrets(b.k8sNamespace).Get(b.ctx, secretName, metav1.GetOptions{})
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			return tokenSecret{}, fmt.Errorf("secret %q not found", secretName)
+		}
+		return tokenSecret{}, err
+	}
+	token, ok := secret.Data[secretKey]
+	if !ok || len(token) == 0 {
+		return tokenSecret{}, fmt.Errorf("secret %q does not have data key %q", secretName, secretKey)
+	}
+	return tokenSecret{
+		SecretID:           string(token),
+		PreviousAccessorID: secret.Annotations[previousAccessorIDAnnotation],
+		Version:            secret.ResourceVersion,
+	}, nil
+}
+
+func (b *KubernetesSecretsBackend) WriteToken(secretName, secretKey string, token tokenSecret) (string, error) {
+	secret, err := b.clientset.CoreV1().Secrets(b.k8sNamespace).Get(b.ctx, secretName, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	if secret.ResourceVersion != token.Version {
+		return "", fmt.Errorf("secret %q was modified: expected resourceVersion %q but found %q", secretName, token.Version, secret.ResourceVersion)
+	}
+	if secret.Annotations == nil {
+		secret.Annotations = make(map[string]string)
+	}
+	secret.Annotations[previousAccessorIDAnnotation] = token.PreviousAccessorID
+	secret.Data[secretKey] = []byte(token.SecretID)
+	// The update fails with a conflict if the secret was modified since it
+	// was read because its resourceVersion is set.
+	updated, err := b.clientset.CoreV1().Secrets(b.k8sNamespace).Update(b.ctx, secret, metav1.UpdateOptions{})
+	if err != nil {
+		return "", err
+	}
+	return updated.ResourceVersion, nil
+}
+
+// VaultSecretsBackend stores tokens in Vault KV version 2 secrets.
+type VaultSecretsBackend struct {
+	vaultClient *vaultApi.Client
+}
+
+var _ SecretsBackend = (*VaultSecretsBackend)(nil)
+
+func (b *VaultSecretsBackend) ReadToken(secretName, secretKey string) (tokenSecret, error) {
+	data, version, err := b.read(secretName)
+	if err != nil {
+		return tokenSecret{}, err
+	}
+	token, ok := data[secretKey].(string)
+	if !ok || token == "" {
+		return tokenSecret{}, fmt.Errorf("secret %q does not have data key %q", secretName, secretKey)
+	}
+	previous, _ := data[previousAccessorIDKey(secretKey)].(string)
+	return tokenSecret{
+		SecretID:           token,
+		PreviousAccessorID: previous,
+		Version:            version,
+	}, nil
+}
+
+func (b *VaultSecretsBackend) WriteToken(secretName, secretKey string, token tokenSecret) (string, error) {
+	// Keep the other keys in the secret.
+	data, _, err := b.read(secretName)
+	if err != nil {
+		return "", err
+	}
+	data[secretKey] = token.SecretID
+	data[previousAccessorIDKey(secretKey)] = token.PreviousAccessorID
+	secret, err := b.vaultClient.Logical().Write(secretName, map[string]interface{}{
+		"options": map[string]interface{}{
+			"cas": json.Number(token.Version),
+		},
+		"data": data,
+	})
+	if err != nil {
+		return "", err
+	}
+	if secret == nil || secret.Data == nil {
+		return "", fmt.Errorf("writing secret %q returned no version", secretName)
+	}
+	return fmt.Sprint(secret.Data["version"]), nil
+}
+
+// read returns the data and version of a KV version 2 secret.
+func (b *VaultSecretsBackend) read(secretName string) (map[string]interface{}, string, error) {
+	secret, err := b.vaultClient.Logical().Read(secretName)
+	if err != nil {
+		return nil, "", err
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, "", fmt.Errorf("secret %q not found", secretName)
+	}
+	data, ok := secret.Data["data"].(map[string]interface{})
+	if !ok {
+		return nil, "", fmt.Errorf("secret %q is not a KV version 2 secret", secretName)
+	}
+	version := "0"
+	if metadata, ok := secret.Data["metadata"].(map[string]interface{}); ok && metadata["version"] != nil {
+		version = fmt.Sprint(metadata["version"])
+	}
+	return data, version, nil
+}
+
+// previousAccessorIDKey is the key of a Vault secret with the accessor ID of
+// the token that was replaced by the token under secretKey.
+func previousAccessorIDKey(secretKey string) string {
+	return secretKey + "_previous_accessor_id"
+}
@@ -40,6 +40,9 @@ func (c *Command) configureAnonymousPolicy(consulClient *api.Client) error {
 	// Update anonymous token to include this policy
 	return c.untilSucceeds("updating anonymous token with policy",
 		func() error {
+			if c.plan != nil {
+				return c.planAnonymousToken(consulClient, aToken)
+			}
 			_, _, err := consulClient.ACL().TokenUpdate(&aToken, &api.WriteOptions{})
 			return err
 		})
@@ -92,6 +92,8 @@ type Command struct {
 	flagSecretsBackend           SecretsBackendType
 	flagBootstrapTokenSecretName string
 	flagBootstrapTokenSecretKey  string
+	flagBootstrapTokenWritePath  string
+	flagBootstrapTokenWriteCmd   string
 
 	flagLogLevel string
 	flagLogJSON  bool
@@ -102,6 +104,20 @@ type Command struct {
 	// flagFederation indicates if federation has been enabled in the cluster.
 	flagFederation bool
 
+	// Flags to customize component policies.
+	flagPolicyOverridesDir    string
+	flagPolicyAllowlistFile   string
+	flagStrictPolicyAllowlist bool
+
+	policyOverrides policyOverrides
+	policyAllowlist *policyAllowlist
+
+	flagDryRun       bool
+	flagDryRunFormat string
+
+	// plan records the changes that would be made when -dry-run is set.
+	plan *aclPlan
+
 	backend     SecretsBackend // for unit testing.
 	clientset   kubernetes.Interface
 	vaultClient *vaultApi.Client
@@ -200,14 +216,43 @@ func (c *Command) init() {
 
 	c.flags.BoolVar(&c.flagFederation, "federation", false, "Toggle for when federation has been enabled.")
 
+	c.flags.StringVar(&c.flagPolicyOverridesDir, "policy-overrides-dir", "",
+		"Path to a directory of component policy overrides, usually a mounted ConfigMap. A <component>.hcl file "+
+			"replaces the rules of the component's policy, <component>.additional.hcl creates an additional policy "+
+			"for the component's role, and <component>.policies and <component>.roles list existing policies and "+
+			"roles, one per line, to attach to the component's role and bind to its service account.")
+	c.flags.StringVar(&c.flagPolicyAllowlistFile, "policy-allowlist-file", "",
+		"Path to a file of ACL rules that are the most privileged rules component policies may grant. The "+
+			"attach_policies and attach_roles lists in the file are the existing policies and roles that policy "+
+			"overrides may attach to components. Rules, policies and roles that exceed the allowlist are logged "+
+			"as warnings unless -strict-policy-allowlist is set.")
+	c.flags.BoolVar(&c.flagStrictPolicyAllowlist, "strict-policy-allowlist", false,
+		"Toggle for failing if component policies grant rules, or policy overrides attach policies or roles, "+
+			"that exceed the -policy-allowlist-file.")
+
+	c.flags.BoolVar(&c.flagDryRun, "dry-run", false,
+		"Toggle for printing the ACL policies, roles, binding rules, auth methods and tokens that would be "+
+			"created or updated without making any changes. ACLs must already be bootstrapped.")
+	c.flags.StringVar(&c.flagDryRunFormat, "dry-run-format", dryRunFormatText,
+		`The format of the -dry-run output. Either "text" or "json". Defaults to "text".`)
+
 	c.flags.StringVar((*string)(&c.flagSecretsBackend), "secrets-backend", "kubernetes",
-		`The secrets backend to use. Either "vault" or "kubernetes". Defaults to "kubernetes"`)
+		`The secrets backend to use. One of "vault", "kubernetes" or "file". Defaults to "kubernetes"`)
 	c.flags.StringVar(&c.flagBootstrapTokenSecretName, "bootstrap-token-secret-name", "",
 		"The name of the Vault or Kuberenetes secret for the bootstrap token. This token must have `ac::write` permission "+
 			"in order to create policies and tokens. If not provided or if the secret is empty, then this command will "+
-			"bootstrap ACLs and write the bootstrap token to this secret.")
+			"bootstrap ACLs and write the bootstrap token to this secret. With -secrets-backend=file, this is the "+
+			"directory the secret is mounted at.")
 	c.flags.StringVar(&c.flagBootstrapTokenSecretKey, "bootstrap-token-secret-key", "",
-		"The key within the Vault or Kuberenetes secret containing the bootstrap token.")
+		"The key within the Vault or Kuberenetes secret containing the bootstrap token. With -secrets-backend=file, "+
+			"this is the name of the file in the secret's directory.")
+	c.flags.StringVar(&c.flagBootstrapTokenWritePath, "bootstrap-token-write-path", "",
+		"With -secrets-backend=file, the file the bootstrap token is written to after bootstrapping ACLs, "+
+			"e.g. a file watched by a sidecar. Defaults to the file the token is read from.")
+	c.flags.StringVar(&c.flagBootstrapTokenWriteCmd, "bootstrap-token-write-command", "",
+		"With -secrets-backend=file, a shell command that is run with the bootstrap token on stdin to store it "+
+			"after bootstrapping ACLs, e.g. in an external secrets manager. The secret name and key are set in the "+
+			"CONSUL_BOOTSTRAP_TOKEN_SECRET_NAME and CONSUL_BOOTSTRAP_TOKEN_SECRET_KEY environment variables.")
 
 	c.flags.DurationVar(&c.flagTimeout, "timeout", 10*time.Minute,
 		"How long we'll try to bootstrap ACLs for before timing out, e.g. 1ms, 2s, 3m")
@@ -276,6 +321,23 @@ func (c *Command) Run(args []string) int {
 		}
 	}
 
+	if c.flagPolicyOverridesDir != "" {
+		var err error
+		c.policyOverrides, err = loadPolicyOverrides(c.flagPolicyOverridesDir)
+		if err != nil {
+			c.UI.Error(err.Error())
+			return 1
+		}
+	}
+	if c.flagPolicyAllowlistFile != "" {
+		var err error
+		c.policyAllowlist, err = loadPolicyAllowlist(c.flagPolicyAllowlistFile)
+		if err != nil {
+			c.UI.Error(err.Error())
+			return 1
+		}
+	}
+
 	var cancel context.CancelFunc
 	c.ctx, cancel = context.WithTimeout(context.Background(), c.flagTimeout)
 	// The context will only ever be intentionally ended by the timeout.
@@ -321,6 +383,18 @@ func (c *Command) Run(args []string) int {
 		// has permissions to create policies and tokens.
 		c.log.Info("ACL replication is enabled so skipping Consul server ACL bootstrapping")
 		bootstrapToken = aclReplicationToken
+	} else if c.flagDryRun {
+		// A dry run can't bootstrap ACLs or set server tokens so the bootstrap
+		// token must already exist.
+		bootstrapToken, err = c.backend.BootstrapToken()
+		if err != nil {
+			c.log.Error(fmt.Sprintf("Unexpected error fetching bootstrap token secret: %s", err))
+			return 1
+		}
+		if bootstrapToken == "" {
+			c.UI.Error(fmt.Sprintf("-dry-run requires ACLs to be bootstrapped but no bootstrap token was found in %q", c.backend.BootstrapTokenSecretName()))
+			return 1
+		}
 	} else {
 		bootstrapToken, err = c.bootstrapServers(ipAddrs, c.backend)
 		if err != nil {
@@ -370,6 +444,11 @@ func (c *Command) Run(args []string) int {
 	c.log.Info("Current datacenter", "datacenter", consulDC, "primaryDC", primaryDC)
 	primary := consulDC == primaryDC
 
+	if c.flagDryRun {
+		c.log.Info("Dry run: reading ACLs without making any changes")
+		c.plan = &aclPlan{}
+	}
+
 	if c.consulFlags.Partition == consulDefaultPartition && primary {
 		// Partition token is local because only the Primary datacenter can have Admin Partitions.
 		if c.flagPartitionTokenFile != "" {
@@ -419,7 +498,11 @@ func (c *Command) Run(args []string) int {
 			Name: consulDefaultNamespace,
 			ACLs: &aclConfig,
 		}
-		_, _, err = consulClient.Namespaces().Update(&consulNamespace, &api.WriteOptions{})
+		if c.plan != nil {
+			err = c.planNamespace(consulClient, consulNamespace.Name, policyTmpl.Name)
+		} else {
+			_, _, err = consulClient.Namespaces().Update(&consulNamespace, &api.WriteOptions{})
+		}
 		if err != nil {
 			if strings.Contains(strings.ToLower(err.Error()), "unexpected response code: 404") {
 				// If this returns a 404 it's most likely because they're not running
@@ -663,6 +746,16 @@ func (c *Command) Run(args []string) int {
 		}
 	}
 
+	if c.plan != nil {
+		var out strings.Builder
+		if err := c.plan.write(&out, c.flagDryRunFormat); err != nil {
+			c.log.Error("Error writing plan", "err", err)
+			return 1
+		}
+		c.UI.Output(strings.TrimSuffix(out.String(), "\n"))
+		return 0
+	}
+
 	c.log.Info("server-acl-init completed successfully")
 	return 0
 }
@@ -705,6 +798,9 @@ func (c *Command) configureLocalComponentAuthMethod(consulClient *api.Client, au
 func (c *Command) createAuthMethod(consulClient *api.Client, authMethod *api.ACLAuthMethod, writeOptions *api.WriteOptions) error {
 	return c.untilSucceeds(fmt.Sprintf("creating auth method %s", authMethod.Name),
 		func() error {
+			if c.plan != nil {
+				return c.planAuthMethod(consulClient, authMethod, writeOptions)
+			}
 			var err error
 			// `AuthMethodCreate` will also be able to update an existing
 			// AuthMethod based on the name provided. This means that any
@@ -810,7 +906,7 @@ func (c *Command) configureKubeClient() error {
 	return nil
 }
 
-// configureSecretsBackend configures either the Kubernetes or Vault
+// configureSecretsBackend configures either the Kubernetes, Vault or file
 // secrets backend based on flags.
 func (c *Command) configureSecretsBackend() error {
 	if c.backend != nil {
@@ -853,8 +949,17 @@ func (c *Command) configureSecretsBackend() error {
 			secretKey:   secretKey,
 		}
 		return nil
+	case SecretsBackendTypeFile:
+		c.backend = &FileSecretsBackend{
+			ctx:          c.ctx,
+			secretName:   secretName,
+			secretKey:    secretKey,
+			writePath:    c.flagBootstrapTokenWritePath,
+			writeCommand: c.flagBootstrapTokenWriteCmd,
+		}
+		return nil
 	default:
-		validValues := []SecretsBackendType{SecretsBackendTypeKubernetes, SecretsBackendTypeVault}
+		validValues := []SecretsBackendType{SecretsBackendTypeKubernetes, SecretsBackendTypeVault, SecretsBackendTypeFile}
 		return fmt.Errorf("Invalid value for -secrets-backend: %q. Valid values are %v.", c.flagSecretsBackend, validValues)
 	}
 }
@@ -985,6 +1090,24 @@ func (c *Command) validateFlags() error {
 		return errors.New("-consul-api-timeout must be set to a value greater than 0")
 	}
 
+	if c.flagDryRunFormat != dryRunFormatText && c.flagDryRunFormat != dryRunFormatJSON {
+		return fmt.Errorf("-dry-run-format must be one of %q or %q", dryRunFormatText, dryRunFormatJSON)
+	}
+
+	if c.flagStrictPolicyAllowlist && c.flagPolicyAllowlistFile == "" {
+		return errors.New("-policy-allowlist-file must be set if -strict-policy-allowlist is set")
+	}
+
+	if c.flagSecretsBackend == SecretsBackendTypeFile && c.flagBootstrapTokenSecretName == "" {
+		return errors.New("-bootstrap-token-secret-name must be set if -secrets-backend=file")
+	}
+	if c.flagSecretsBackend != SecretsBackendTypeFile && (c.flagBootstrapTokenWritePath != "" || c.flagBootstrapTokenWriteCmd != "") {
+		return errors.New("-bootstrap-token-write-path and -bootstrap-token-write-command are only supported with -secrets-backend=file")
+	}
+	if c.flagBootstrapTokenWritePath != "" && c.flagBootstrapTokenWriteCmd != "" {
+		return errors.New("only one of -bootstrap-token-write-path or -bootstrap-token-write-command may be set")
+	}
+
 	//if c.flagVaultNamespace != "" && c.flagSecretsBackend != SecretsBackendTypeVault {
 	//	return fmt.Errorf("-vault-namespace not supported for -secrets-backend=%q", c.flagSecretsBackend)
 	//}
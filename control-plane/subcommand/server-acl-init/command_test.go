@@ -13,6 +13,7 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"testing"
@@ -81,6 +82,66 @@ func TestRun_FlagValidation(t *testing.T) {
 			ExpErr: "-sync-consul-node-name=5r9OPGfSRXUdGzNjBdAwmhCBrzHDNYs4XjZVR4wp7lSLIzqwS0ta51nBLIN0TMPV-too-long is invalid: node name will not be discoverable " +
 				"via DNS due to it being too long. Valid lengths are between 1 and 63 bytes",
 		},
+		{
+			Flags: []string{
+				"-addresses=localhost",
+				"-resource-prefix=prefix",
+				"-strict-policy-allowlist",
+			},
+			ExpErr: "-policy-allowlist-file must be set if -strict-policy-allowlist is set",
+		},
+		{
+			Flags: []string{
+				"-addresses=localhost",
+				"-resource-prefix=prefix",
+				"-dry-run",
+				"-dry-run-format=yaml",
+			},
+			ExpErr: "-dry-run-format must be one of \"text\" or \"json\"",
+		},
+		{
+			Flags: []string{
+				"-addresses=localhost",
+				"-resource-prefix=prefix",
+				"-secrets-backend=file",
+			},
+			ExpErr: "-bootstrap-token-secret-name must be set if -secrets-backend=file",
+		},
+		{
+			Flags: []string{
+				"-addresses=localhost",
+				"-resource-prefix=prefix",
+				"-bootstrap-token-write-command=cat",
+			},
+			ExpErr: "-bootstrap-token-write-path and -bootstrap-token-write-command are only supported with -secrets-backend=file",
+		},
+		{
+			Flags: []string{
+				"-addresses=localhost",
+				"-resource-prefix=prefix",
+				"-secrets-backend=file",
+				"-bootstrap-token-secret-name=/mnt/secrets-store",
+				"-bootstrap-token-write-path=/tmp/token",
+				"-bootstrap-token-write-command=cat",
+			},
+			ExpErr: "only one of -bootstrap-token-write-path or -bootstrap-token-write-command may be set",
+		},
+		{
+			Flags: []string{
+				"-addresses=localhost",
+				"-resource-prefix=prefix",
+				"-policy-overrides-dir=/notexist",
+			},
+			ExpErr: "reading policy overrides directory: open /notexist: no such file or directory",
+		},
+		{
+			Flags: []string{
+				"-addresses=localhost",
+				"-resource-prefix=prefix",
+				"-policy-allowlist-file=/notexist",
+			},
+			ExpErr: "reading policy allowlist: open /notexist: no such file or directory",
+		},
 	}
 
 	for _, c := range cases {
@@ -898,6 +959,80 @@ func TestRun_SyncPolicyUpdates(t *testing.T) {
 	}
 }
 
+// Test that removing policy overrides on upgrade reverts the component's
+// policy to the rendered rules and removes the binding rules to extra roles.
+func TestRun_PolicyOverridesRemoved(t *testing.T) {
+	t.Parallel()
+	bootToken := "aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee"
+	k8s, testClient := completeBootstrappedSetup(t, bootToken)
+	setUpK8sServiceAccount(t, k8s, ns)
+
+	consul, err := api.NewClient(&api.Config{
+		Address: testClient.TestServer.HTTPAddr,
+		Token:   bootToken,
+	})
+	require.NoError(t, err)
+	_, _, err = consul.ACL().RoleCreate(&api.ACLRole{Name: "team-role"}, nil)
+	require.NoError(t, err)
+
+	overridesDir := t.TempDir()
+	overrideRules := `operator = "read"`
+	require.NoError(t, os.WriteFile(filepath.Join(overridesDir, "connect-inject.hcl"), []byte(overrideRules), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(overridesDir, "connect-inject.roles"), []byte("team-role\n"), 0600))
+
+	commonArgs := []string{
+		"-resource-prefix=" + resourcePrefix,
+		"-k8s-namespace=" + ns,
+		"-addresses", strings.Split(testClient.TestServer.HTTPAddr, ":")[0],
+		"-http-port", strings.Split(testClient.TestServer.HTTPAddr, ":")[1],
+		"-grpc-port", strings.Split(testClient.TestServer.GRPCAddr, ":")[1],
+		"-connect-inject",
+	}
+	// On the second run, the overrides are removed.
+	firstRunArgs := append(commonArgs, "-policy-overrides-dir="+overridesDir)
+	secondRunArgs := commonArgs
+
+	ui := cli.NewMockUi()
+	cmd := Command{
+		UI:        ui,
+		clientset: k8s,
+		backend:   &FakeSecretsBackend{bootstrapToken: bootToken},
+	}
+	responseCode := cmd.Run(firstRunArgs)
+	require.Equal(t, 0, responseCode, ui.ErrorWriter.String())
+
+	authMethodName := resourcePrefix + "-k8s-component-auth-method"
+	roleDescription := fmt.Sprintf("Binding Rule for %s-connect-injector to role team-role", resourcePrefix)
+	policy, _, err := consul.ACL().PolicyReadByName("connect-inject-policy", nil)
+	require.NoError(t, err)
+	require.Equal(t, overrideRules, policy.Rules)
+	rules, _, err := consul.ACL().BindingRuleList(authMethodName, nil)
+	require.NoError(t, err)
+	require.Len(t, rules, 2)
+
+	// Re-run the command without the overrides.
+	// NOTE: We're redefining the command so that the old flag values are
+	// reset.
+	cmd = Command{
+		UI:        ui,
+		clientset: k8s,
+		backend:   &FakeSecretsBackend{bootstrapToken: bootToken},
+	}
+	responseCode = cmd.Run(secondRunArgs)
+	require.Equal(t, 0, responseCode, ui.ErrorWriter.String())
+
+	injectRules, err := cmd.injectRules()
+	require.NoError(t, err)
+	policy, _, err = consul.ACL().PolicyReadByName("connect-inject-policy", nil)
+	require.NoError(t, err)
+	require.Equal(t, injectRules, policy.Rules)
+	rules, _, err = consul.ACL().BindingRuleList(authMethodName, nil)
+	require.NoError(t, err)
+	require.Len(t, rules, 1)
+	require.NotEqual(t, roleDescription, rules[0].Description)
+	require.Equal(t, resourcePrefix+"-connect-inject-acl-role", rules[0].BindName)
+}
+
 // Test that we give an error if an ACL policy we were going to create
 // already exists but it has a different description than what consul-k8s
 // expected. In this case, it's likely that a user manually created an ACL
@@ -46,6 +46,9 @@ func (c *Command) configureConnectInjectAuthMethod(consulClient *api.Client, aut
 			err = c.untilSucceeds(fmt.Sprintf("checking or creating namespace %s",
 				c.flagConsulInjectDestinationNamespace),
 				func() error {
+					if c.plan != nil {
+						return c.planEnsureNamespace(consulClient, c.flagConsulInjectDestinationNamespace, "cross-namespace-policy")
+					}
 					_, err := namespaces.EnsureExists(consulClient, c.flagConsulInjectDestinationNamespace, "cross-namespace-policy")
 					return err
 				})
@@ -55,15 +58,7 @@ func (c *Command) configureConnectInjectAuthMethod(consulClient *api.Client, aut
 		}
 	}
 
-	err = c.untilSucceeds(fmt.Sprintf("creating auth method %s", authMethodTmpl.Name),
-		func() error {
-			var err error
-			// `AuthMethodCreate` will also be able to update an existing
-			// AuthMethod based on the name provided. This means that any
-			// configuration changes will correctly update the AuthMethod.
-			_, _, err = consulClient.ACL().AuthMethodCreate(&authMethodTmpl, &writeOptions)
-			return err
-		})
+	err = c.createAuthMethod(consulClient, &authMethodTmpl, &writeOptions)
 	if err != nil {
 		return err
 	}
@@ -16,14 +16,22 @@ import (
 // createACLPolicyRoleAndBindingRule will create the ACL Policy for the component
 // then create a set of ACLRole and ACLBindingRule which tie the component's serviceaccount
 // to the authMethod, allowing the serviceaccount to later be allowed to issue a Consul Login.
+// Any policy overrides for the component replace its rules and add policies and roles.
 func (c *Command) createACLPolicyRoleAndBindingRule(componentName, rules, dc, primaryDC string, global, primary bool, authMethodName, serviceAccountName string, client *api.Client) error {
-	// Create policy with the given rules.
-	policyName := fmt.Sprintf("%s-policy", componentName)
-	if c.flagFederation && !primary {
-		// If performing ACL replication, we must ensure policy names are
-		// globally unique so we append the datacenter name but only in secondary datacenters..
-		policyName += fmt.Sprintf("-%s", dc)
+	override := c.policyOverrides.forComponent(componentName)
+	if override.Rules != "" {
+		c.log.Info(fmt.Sprintf("Using policy override for %s", componentName))
+		rules = override.Rules
+	}
+	if err := c.checkPolicyAllowlist(componentName, rules); err != nil {
+		return err
 	}
+	if err := c.checkAttachmentAllowlist(componentName, override.Policies, override.Roles); err != nil {
+		return err
+	}
+
+	// Create policy with the given rules.
+	policyName := c.componentPolicyName(fmt.Sprintf("%s-policy", componentName), dc, primary)
 	var datacenters []string
 	if !global && dc != "" {
 		datacenters = append(datacenters, dc)
@@ -36,7 +44,7 @@ func (c *Command) createACLPolicyRoleAndBindingRule(componentName, rules, dc, pr
 	}
 	err := c.untilSucceeds(fmt.Sprintf("creating %s policy", policyTmpl.Name),
 		func() error {
-			return c.createOrUpdateACLPolicy(policyTmpl, client)
+			return c.createOrUpdateACLPolicyWithOverride(policyTmpl, client, override.Rules != "")
 		})
 	if err != nil {
 		return err
@@ -49,11 +57,83 @@ func (c *Command) createACLPolicyRoleAndBindingRule(componentName, rules, dc, pr
 	var apl []*api.ACLRolePolicyLink
 	apl = append(apl, ap)
 
+	// Create the additional policy from the overrides and attach it to the role
+	// along with any existing policies.
+	if override.AdditionalRules != "" {
+		if err := c.checkPolicyAllowlist(componentName, override.AdditionalRules); err != nil {
+			return err
+		}
+		additionalPolicyName := c.componentPolicyName(fmt.Sprintf("%s-additional-policy", componentName), dc, primary)
+		additionalPolicyTmpl := api.ACLPolicy{
+			Name:        additionalPolicyName,
+			Description: fmt.Sprintf("%s Token Policy", additionalPolicyName),
+			Rules:       override.AdditionalRules,
+			Datacenters: datacenters,
+		}
+		err := c.untilSucceeds(fmt.Sprintf("creating %s policy", additionalPolicyTmpl.Name),
+			func() error {
+				return c.createOrUpdateACLPolicyWithOverride(additionalPolicyTmpl, client, true)
+			})
+		if err != nil {
+			return err
+		}
+		apl = append(apl, &api.ACLRolePolicyLink{Name: additionalPolicyName})
+	}
+	for _, name := range override.Policies {
+		apl = append(apl, &api.ACLRolePolicyLink{Name: name})
+	}
+
 	// Add the ACLRole and ACLBindingRule.
 	return c.addRoleAndBindingRule(client, componentName, serviceAccountName, authMethodName, apl, global, primary, primaryDC, dc)
 }
 
+// componentPolicyName returns the name of a component's policy in dc.
+func (c *Command) componentPolicyName(name, dc string, primary bool) string {
+	if c.flagFederation && !primary {
+		// If performing ACL replication, we must ensure policy names are
+		// globally unique so we append the datacenter name but only in secondary datacenters..
+		name += fmt.Sprintf("-%s", dc)
+	}
+	return name
+}
+
+// checkPolicyAllowlist checks that rules don't exceed the policy allowlist.
+func (c *Command) checkPolicyAllowlist(componentName, rules string) error {
+	if c.policyAllowlist == nil {
+		return nil
+	}
+	violations, err := c.policyAllowlist.violations(rules)
+	if err != nil {
+		return fmt.Errorf("parsing %s rules: %w", componentName, err)
+	}
+	return c.allowlistViolations(fmt.Sprintf("%s rules", componentName), violations)
+}
+
+// checkAttachmentAllowlist checks that the existing policies and roles that
+// the policy overrides attach to a component are in the policy allowlist.
+func (c *Command) checkAttachmentAllowlist(componentName string, policies, roles []string) error {
+	if c.policyAllowlist == nil {
+		return nil
+	}
+	return c.allowlistViolations(fmt.Sprintf("%s policies and roles", componentName),
+		c.policyAllowlist.attachmentViolations(policies, roles))
+}
+
+// allowlistViolations logs the violations of the policy allowlist as warnings
+// unless the allowlist is strict, in which case they are returned as an error.
+func (c *Command) allowlistViolations(what string, violations []string) error {
+	if len(violations) == 0 {
+		return nil
+	}
+	if c.flagStrictPolicyAllowlist {
+		return fmt.Errorf("%s exceed the policy allowlist: %s", what, strings.Join(violations, ", "))
+	}
+	c.log.Warn(fmt.Sprintf("%s exceed the policy allowlist", what), "violations", strings.Join(violations, ", "))
+	return nil
+}
+
 // addRoleAndBindingRule adds an ACLRole and ACLBindingRule which reference the authMethod.
+// The serviceaccount is also bound to any roles in the component's policy overrides.
 func (c *Command) addRoleAndBindingRule(client *api.Client, componentName, serviceAccountName, authMethodName string, policies []*api.ACLRolePolicyLink, global, primary bool, primaryDC, dc string) error {
 	// This is the ACLRole which will allow the component which uses the serviceaccount
 	// to be able to do a consul login.
@@ -86,7 +166,76 @@ func (c *Command) addRoleAndBindingRule(client *api.Client, componentName, servi
 	if global && dc != primaryDC {
 		writeOptions.Datacenter = primaryDC
 	}
-	return c.createOrUpdateBindingRule(client, authMethodName, abr, &api.QueryOptions{}, writeOptions)
+	// The binding rules are listed once to find the rules to update and the
+	// stale rules to delete.
+	existingRules, err := c.listBindingRules(client, authMethodName, &api.QueryOptions{})
+	if err != nil {
+		return err
+	}
+	writeBindingRule := func(rule *api.ACLBindingRule) error {
+		if c.plan != nil {
+			return c.createOrUpdateBindingRule(client, authMethodName, rule, &api.QueryOptions{}, writeOptions)
+		}
+		return c.writeBindingRule(client, authMethodName, rule, existingRules, writeOptions)
+	}
+	if err := writeBindingRule(abr); err != nil {
+		return err
+	}
+
+	// Bind the serviceaccount to the existing roles from the overrides. A
+	// binding rule can only bind a single role so each role gets its own.
+	extraRoles := c.policyOverrides.forComponent(componentName).Roles
+	for _, extraRole := range extraRoles {
+		extraAbr := &api.ACLBindingRule{
+			Description: extraRoleBindingRuleDescription(serviceAccountName, extraRole),
+			AuthMethod:  authMethodName,
+			Selector:    abr.Selector,
+			BindType:    api.BindingRuleBindTypeRole,
+			BindName:    extraRole,
+		}
+		if err := writeBindingRule(extraAbr); err != nil {
+			return err
+		}
+	}
+	return c.deleteStaleRoleBindingRules(client, existingRules, serviceAccountName, abr.Selector, extraRoles, writeOptions)
+}
+
+// extraRoleBindingRuleDescription returns the description of the binding rule
+// that binds serviceAccountName to a role from the policy overrides. The
+// description marks the binding rules created for overrides so that they can
+// be found and deleted once the role is removed from the overrides.
+func extraRoleBindingRuleDescription(serviceAccountName, role string) string {
+	return fmt.Sprintf("Binding Rule for %s to role %s", serviceAccountName, role)
+}
+
+// deleteStaleRoleBindingRules deletes the binding rules in existingRules that
+// were created for roles in the policy overrides that are no longer in roles.
+func (c *Command) deleteStaleRoleBindingRules(client *api.Client, existingRules []*api.ACLBindingRule, serviceAccountName, selector string, roles []string, writeOptions *api.WriteOptions) error {
+	current := make(map[string]bool)
+	for _, role := range roles {
+		current[role] = true
+	}
+	for _, existingRule := range existingRules {
+		if existingRule.BindType != api.BindingRuleBindTypeRole || existingRule.Selector != selector ||
+			existingRule.Description != extraRoleBindingRuleDescription(serviceAccountName, existingRule.BindName) ||
+			current[existingRule.BindName] {
+			continue
+		}
+		if c.plan != nil {
+			c.planDeleteBindingRule(existingRule, writeOptions)
+			continue
+		}
+		rule := existingRule
+		err := c.untilSucceeds(fmt.Sprintf("deleting acl binding rule %q", rule.Description),
+			func() error {
+				_, err := client.ACL().BindingRuleDelete(rule.ID, writeOptions)
+				return err
+			})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // updateOrCreateACLRole will query to see if existing role is in place and update them
@@ -94,6 +243,9 @@ func (c *Command) addRoleAndBindingRule(client *api.Client, componentName, servi
 func (c *Command) updateOrCreateACLRole(client *api.Client, role *api.ACLRole) error {
 	err := c.untilSucceeds(fmt.Sprintf("update or create acl role for %s", role.Name),
 		func() error {
+			if c.plan != nil {
+				return c.planACLRole(client, role)
+			}
 			var err error
 			aclRole, _, err := client.ACL().RoleReadByName(role.Name, &api.QueryOptions{})
 			if err != nil {
@@ -101,6 +253,10 @@ func (c *Command) updateOrCreateACLRole(client *api.Client, role *api.ACLRole) e
 				return err
 			}
 			if aclRole != nil {
+				// Update the policy links so that policies added through
+				// policy overrides are attached to existing roles.
+				aclRole.Description = role.Description
+				aclRole.Policies = role.Policies
 				_, _, err := client.ACL().RoleUpdate(aclRole, &api.WriteOptions{})
 				if err != nil {
 					c.log.Error("unable to update role", err)
@@ -136,6 +292,22 @@ func (c *Command) createConnectBindingRule(client *api.Client, authMethodName st
 }
 
 func (c *Command) createOrUpdateBindingRule(client *api.Client, authMethodName string, abr *api.ACLBindingRule, queryOptions *api.QueryOptions, writeOptions *api.WriteOptions) error {
+	if c.plan != nil {
+		return c.untilSucceeds(fmt.Sprintf("planning binding rules for auth method %s", authMethodName),
+			func() error {
+				return c.planBindingRule(client, authMethodName, abr, queryOptions, writeOptions)
+			})
+	}
+
+	existingRules, err := c.listBindingRules(client, authMethodName, queryOptions)
+	if err != nil {
+		return err
+	}
+	return c.writeBindingRule(client, authMethodName, abr, existingRules, writeOptions)
+}
+
+// listBindingRules lists the binding rules of the auth method.
+func (c *Command) listBindingRules(client *api.Client, authMethodName string, queryOptions *api.QueryOptions) ([]*api.ACLBindingRule, error) {
 	var existingRules []*api.ACLBindingRule
 	err := c.untilSucceeds(fmt.Sprintf("listing binding rules for auth method %s", authMethodName),
 		func() error {
@@ -143,10 +315,13 @@ func (c *Command) createOrUpdateBindingRule(client *api.Client, authMethodName s
 			existingRules, _, err = client.ACL().BindingRuleList(authMethodName, queryOptions)
 			return err
 		})
-	if err != nil {
-		return err
-	}
+	return existingRules, err
+}
 
+// writeBindingRule updates the binding rule in existingRules that matches abr,
+// or creates abr if there isn't one.
+func (c *Command) writeBindingRule(client *api.Client, authMethodName string, abr *api.ACLBindingRule, existingRules []*api.ACLBindingRule, writeOptions *api.WriteOptions) error {
+	var err error
 	// If the binding rule already exists, update it
 	// This updates the binding rule any time the acl bootstrapping
 	// command is rerun, which is a bit of extra overhead, but is
@@ -271,6 +446,14 @@ func (c *Command) createACL(name, rules string, localToken bool, dc string, isPr
 		}
 	}
 
+	if c.plan != nil {
+		if secretID != "" {
+			secretName = ""
+		}
+		c.planToken(tokenTmpl, secretName)
+		return nil
+	}
+
 	var token string
 	err = c.untilSucceeds(fmt.Sprintf("creating token for policy %s", policyTmpl.Name),
 		func() error {
@@ -304,9 +487,45 @@ func (c *Command) createACL(name, rules string, localToken bool, dc string, isPr
 	return nil
 }
 
+// createOrUpdateACLPolicy creates the policy, or updates it if it already
+// exists and namespaces or catalog sync are enabled.
 func (c *Command) createOrUpdateACLPolicy(policy api.ACLPolicy, consulClient *api.Client) error {
+	return c.createOrUpdateACLPolicyWithOverride(policy, consulClient, false)
+}
+
+// createOrUpdateACLPolicyWithOverride creates the policy, or updates it if it
+// already exists and namespaces or catalog sync are enabled. If overridden is
+// true, the policy's rules come from a policy override, so the existing policy
+// is always updated and its description is marked. A marked policy is updated
+// even once the override is removed so that its rules are reverted.
+func (c *Command) createOrUpdateACLPolicyWithOverride(policy api.ACLPolicy, consulClient *api.Client, overridden bool) error {
+	description := policy.Description
+	if overridden {
+		policy.Description = overriddenPolicyDescription(description)
+	}
+	if c.plan != nil {
+		return c.planACLPolicy(policy, description, overridden, consulClient)
+	}
+
 	// Attempt to create the ACL policy.
 	_, _, err := consulClient.ACL().PolicyCreate(&policy, &api.WriteOptions{})
+	if !isPolicyExistsErr(err, policy.Name) {
+		return err
+	}
+
+	// The policy ID is required in any PolicyUpdate call, so first we need to
+	// get the existing policy to extract its ID.
+	existingPolicies, _, err := consulClient.ACL().PolicyList(&api.QueryOptions{})
+	if err != nil {
+		return err
+	}
+	var existing *api.ACLPolicyListEntry
+	for _, existingPolicy := range existingPolicies {
+		if existingPolicy.Name == policy.Name {
+			existing = existingPolicy
+		}
+	}
+	wasOverridden := existing != nil && existing.Description == overriddenPolicyDescription(description)
 
 	// With the introduction of Consul namespaces, if someone upgrades into a
 	// Consul version with namespace support or changes any of their namespace
@@ -314,45 +533,39 @@ func (c *Command) createOrUpdateACLPolicy(policy api.ACLPolicy, consulClient *ap
 	// updated to be namespace aware.
 	// Allowing the Consul node name to be configurable also requires any sync
 	// policy to be updated in case the node name has changed.
-	if isPolicyExistsErr(err, policy.Name) {
-		if c.flagEnableNamespaces || c.flagSyncCatalog {
-			c.log.Info(fmt.Sprintf("Policy %q already exists, updating", policy.Name))
+	if !c.updatesExistingPolicy(overridden, wasOverridden) {
+		c.log.Info(fmt.Sprintf("Policy %q already exists, skipping update", policy.Name))
+		return nil
+	}
+	c.log.Info(fmt.Sprintf("Policy %q already exists, updating", policy.Name))
 
-			// The policy ID is required in any PolicyUpdate call, so first we need to
-			// get the existing policy to extract its ID.
-			existingPolicies, _, err := consulClient.ACL().PolicyList(&api.QueryOptions{})
-			if err != nil {
-				return err
-			}
+	// This shouldn't happen, because we're looking for a policy
+	// only after we've hit a `Policy already exists` error.
+	// The only time it might happen is if a user has manually created a policy
+	// with this name but used a different description. In this case,
+	// we don't want to overwrite the policy so we just error.
+	if existing == nil || (existing.Description != description && !wasOverridden) {
+		return fmt.Errorf("policy found with name %q but not with expected description %q; "+
+			"if this policy was created manually it must be renamed to something else because this name is reserved by consul-k8s",
+			policy.Name, description)
+	}
 
-			// Find the policy that matches our name and description
-			// and that's the ID we need
-			for _, existingPolicy := range existingPolicies {
-				if existingPolicy.Name == policy.Name && existingPolicy.Description == policy.Description {
-					policy.ID = existingPolicy.ID
-				}
-			}
+	// Update the policy now that we've found its ID
+	policy.ID = existing.ID
+	_, _, err = consulClient.ACL().PolicyUpdate(&policy, &api.WriteOptions{})
+	return err
+}
 
-			// This shouldn't happen, because we're looking for a policy
-			// only after we've hit a `Policy already exists` error.
-			// The only time it might happen is if a user has manually created a policy
-			// with this name but used a different description. In this case,
-			// we don't want to overwrite the policy so we just error.
-			if policy.ID == "" {
-				return fmt.Errorf("policy found with name %q but not with expected description %q; "+
-					"if this policy was created manually it must be renamed to something else because this name is reserved by consul-k8s",
-					policy.Name, policy.Description)
-			}
+// updatesExistingPolicy returns whether a policy that already exists is
+// updated with the rendered rules.
+func (c *Command) updatesExistingPolicy(overridden, wasOverridden bool) bool {
+	return c.flagEnableNamespaces || c.flagSyncCatalog || overridden || wasOverridden
+}
 
-			// Update the policy now that we've found its ID
-			_, _, err = consulClient.ACL().PolicyUpdate(&policy, &api.WriteOptions{})
-			return err
-		} else {
-			c.log.Info(fmt.Sprintf("Policy %q already exists, skipping update", policy.Name))
-			return nil
-		}
-	}
-	return err
+// overriddenPolicyDescription returns the description of a policy whose rules
+// come from a policy override.
+func overriddenPolicyDescription(description string) string {
+	return description + " (policy override)"
 }
 
 // isPolicyExistsErr returns true if err is due to trying to call the
@@ -0,0 +1,103 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package serveraclinit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const SecretsBackendTypeFile SecretsBackendType = "file"
+
+// FileSecretsBackend reads the bootstrap token from a file, such as a secret
+// mounted by the Secrets Store CSI driver. Each key of the secret is a file
+// in the secret's directory.
+//
+// Because these mounts are usually read-only, the bootstrap token is written
+// either by running writeCommand with the token on stdin, so it can be stored
+// in an external secrets manager, or by writing it to writePath for a sidecar
+// to pick up.
+type FileSecretsBackend struct {
+	ctx context.Context
+	// secretName is the directory the secret is mounted at.
+	secretName string
+	// secretKey is the name of the file in secretName with the token.
+	secretKey string
+	// writePath is the file the token is written to. It defaults to
+	// secretName/secretKey.
+	writePath string
+	// writeCommand is a shell command that writes the token it reads on
+	// stdin. If set, it is run instead of writing to writePath.
+	writeCommand string
+}
+
+var _ SecretsBackend = (*FileSecretsBackend)(nil)
+
+// BootstrapToken returns the bootstrap token in the secret's file. If the
+// file doesn't exist or is empty, then it returns an empty string (not an
+// error).
+func (b *FileSecretsBackend) BootstrapToken() (string, error) {
+	token, err := os.ReadFile(b.path())
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", nil
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(token)), nil
+}
+
+// WriteBootstrapToken writes the bootstrap token with the write command or
+// to the write path.
+func (b *FileSecretsBackend) WriteBootstrapToken(bootstrapToken string) error {
+	if b.writeCommand != "" {
+		cmd := exec.CommandContext(b.ctx, "/bin/sh", "-c", b.writeCommand)
+		cmd.Stdin = strings.NewReader(bootstrapToken)
+		cmd.Env = append(os.Environ(),
+			"CONSUL_BOOTSTRAP_TOKEN_SECRET_NAME="+b.secretName,
+			"CONSUL_BOOTSTRAP_TOKEN_SECRET_KEY="+b.secretKey,
+		)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("running bootstrap token write command: %w: %s", err, strings.TrimSpace(stderr.String()))
+		}
+		return nil
+	}
+
+	writePath := b.writePath
+	if writePath == "" {
+		writePath = b.path()
+	}
+	// Write to a temporary file and rename it so a sidecar watching the
+	// file never reads a partially written token.
+	tmp, err := os.CreateTemp(filepath.Dir(writePath), "."+filepath.Base(writePath)+"-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(bootstrapToken); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), writePath)
+}
+
+// BootstrapTokenSecretName returns the path of the bootstrap token file.
+func (b *FileSecretsBackend) BootstrapTokenSecretName() string {
+	return b.path()
+}
+
+func (b *FileSecretsBackend) path() string {
+	return filepath.Join(b.secretName, b.secretKey)
+}
@@ -0,0 +1,526 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package serveraclinit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/consul/api"
+)
+
+const (
+	// dryRunFormatText prints the plan in a human readable format.
+	dryRunFormatText = "text"
+	// dryRunFormatJSON prints the plan as JSON.
+	dryRunFormatJSON = "json"
+)
+
+// planAction is what server-acl-init would do to a resource.
+type planAction string
+
+const (
+	planActionCreate planAction = "create"
+	planActionUpdate planAction = "update"
+	planActionDelete planAction = "delete"
+)
+
+// Kinds of resources in a plan.
+const (
+	planKindPolicy      = "policy"
+	planKindRole        = "role"
+	planKindBindingRule = "binding-rule"
+	planKindAuthMethod  = "auth-method"
+	planKindToken       = "token"
+	planKindNamespace   = "namespace"
+)
+
+// sensitiveValue replaces sensitive values in a plan.
+const sensitiveValue = "(sensitive value)"
+
+// aclPlan is the set of changes server-acl-init would make when run with
+// -dry-run.
+type aclPlan struct {
+	Changes []planChange `json:"changes"`
+	Summary planSummary  `json:"summary"`
+}
+
+// planSummary counts the resources in a plan by action.
+type planSummary struct {
+	Create    int `json:"create"`
+	Update    int `json:"update"`
+	Delete    int `json:"delete"`
+	Unchanged int `json:"unchanged"`
+}
+
+// planChange is a change to a single resource.
+type planChange struct {
+	Action     planAction        `json:"action"`
+	Kind       string            `json:"kind"`
+	Name       string            `json:"name"`
+	Namespace  string            `json:"namespace,omitempty"`
+	Datacenter string            `json:"datacenter,omitempty"`
+	Fields     []planFieldChange `json:"fields,omitempty"`
+}
+
+// planFieldChange is a change to a single field of a resource. Changes to
+// multi-line values like policy rules are described by a line diff instead
+// of their old and new values.
+type planFieldChange struct {
+	Field string   `json:"field"`
+	Old   string   `json:"old,omitempty"`
+	New   string   `json:"new,omitempty"`
+	Diff  []string `json:"diff,omitempty"`
+}
+
+// add adds change to the plan. Updates without any field changes are counted
+// as unchanged.
+func (p *aclPlan) add(change planChange) {
+	switch {
+	case change.Action == planActionCreate:
+		p.Summary.Create++
+	case change.Action == planActionDelete:
+		p.Summary.Delete++
+	case len(change.Fields) == 0:
+		p.Summary.Unchanged++
+		return
+	default:
+		p.Summary.Update++
+	}
+	p.Changes = append(p.Changes, change)
+}
+
+// unchanged counts a resource that would not be changed.
+func (p *aclPlan) unchanged() {
+	p.Summary.Unchanged++
+}
+
+// write writes the plan to w in format.
+func (p *aclPlan) write(w io.Writer, format string) error {
+	if format == dryRunFormatJSON {
+		if p.Changes == nil {
+			p.Changes = []planChange{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(p)
+	}
+
+	var b strings.Builder
+	for _, change := range p.Changes {
+		symbol := "~"
+		switch change.Action {
+		case planActionCreate:
+			symbol = "+"
+		case planActionDelete:
+			symbol = "-"
+		}
+		fmt.Fprintf(&b, "%s %s %q", symbol, change.Kind, change.Name)
+		if change.Namespace != "" {
+			fmt.Fprintf(&b, " in namespace %q", change.Namespace)
+		}
+		if change.Datacenter != "" {
+			fmt.Fprintf(&b, " in datacenter %q", change.Datacenter)
+		}
+		b.WriteString("\n")
+		for _, field := range change.Fields {
+			switch {
+			case len(field.Diff) > 0:
+				fmt.Fprintf(&b, "    %s:\n", field.Field)
+				for _, line := range field.Diff {
+					fmt.Fprintf(&b, "      %s\n", line)
+				}
+			case change.Action == planActionCreate:
+				fmt.Fprintf(&b, "    %s: %q\n", field.Field, field.New)
+			case change.Action == planActionDelete:
+				fmt.Fprintf(&b, "    %s: %q\n", field.Field, field.Old)
+			default:
+				fmt.Fprintf(&b, "    %s: %q => %q\n", field.Field, field.Old, field.New)
+			}
+		}
+	}
+	if len(p.Changes) == 0 {
+		b.WriteString("No changes. ACLs are up to date.\n")
+	}
+	fmt.Fprintf(&b, "\nPlan: %d to create, %d to update, %d to delete, %d unchanged.\n", p.Summary.Create, p.Summary.Update, p.Summary.Delete, p.Summary.Unchanged)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// diffFields returns the changes between the old and new values of fields.
+// Fields whose values are equal are omitted.
+func diffFields(fields ...planFieldChange) []planFieldChange {
+	var changes []planFieldChange
+	for _, field := range fields {
+		if field.Old == field.New {
+			continue
+		}
+		if strings.Contains(field.Old, "\n") || strings.Contains(field.New, "\n") {
+			field.Diff = diffLines(field.Old, field.New)
+			field.Old, field.New = "", ""
+		}
+		changes = append(changes, field)
+	}
+	return changes
+}
+
+// diffLines returns a line diff of old and new. Lines are prefixed with "+"
+// if added, "-" if removed and " " if unchanged.
+func diffLines(old, new string) []string {
+	a := splitLines(old)
+	b := splitLines(new)
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var diff []string
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			diff = append(diff, "  "+a[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			diff = append(diff, "- "+a[i])
+			i++
+		default:
+			diff = append(diff, "+ "+b[j])
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		diff = append(diff, "- "+a[i])
+	}
+	for ; j < len(b); j++ {
+		diff = append(diff, "+ "+b[j])
+	}
+	return diff
+}
+
+func splitLines(s string) []string {
+	s = strings.TrimRight(s, "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+// planACLPolicy adds the changes createOrUpdateACLPolicyWithOverride would
+// make to the plan. description is the policy's description without the
+// policy override mark.
+func (c *Command) planACLPolicy(policy api.ACLPolicy, description string, overridden bool, consulClient *api.Client) error {
+	existing, _, err := consulClient.ACL().PolicyReadByName(policy.Name, &api.QueryOptions{})
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		c.plan.add(planChange{
+			Action: planActionCreate,
+			Kind:   planKindPolicy,
+			Name:   policy.Name,
+			Fields: diffFields(
+				planFieldChange{Field: "description", New: policy.Description},
+				planFieldChange{Field: "rules", New: policy.Rules},
+				planFieldChange{Field: "datacenters", New: strings.Join(policy.Datacenters, ", ")},
+			),
+		})
+		return nil
+	}
+	wasOverridden := existing.Description == overriddenPolicyDescription(description)
+	if !c.updatesExistingPolicy(overridden, wasOverridden) {
+		c.plan.unchanged()
+		return nil
+	}
+	if existing.Description != description && !wasOverridden {
+		return fmt.Errorf("policy found with name %q but not with expected description %q; "+
+			"if this policy was created manually it must be renamed to something else because this name is reserved by consul-k8s",
+			policy.Name, description)
+	}
+	c.plan.add(planChange{
+		Action: planActionUpdate,
+		Kind:   planKindPolicy,
+		Name:   policy.Name,
+		Fields: diffFields(
+			planFieldChange{Field: "description", Old: existing.Description, New: policy.Description},
+			planFieldChange{Field: "rules", Old: existing.Rules, New: policy.Rules},
+			planFieldChange{Field: "datacenters", Old: strings.Join(existing.Datacenters, ", "), New: strings.Join(policy.Datacenters, ", ")},
+		),
+	})
+	return nil
+}
+
+// planACLRole adds the changes updateOrCreateACLRole would make to the plan.
+func (c *Command) planACLRole(client *api.Client, role *api.ACLRole) error {
+	existing, _, err := client.ACL().RoleReadByName(role.Name, &api.QueryOptions{})
+	if err != nil {
+		return err
+	}
+	change := planChange{
+		Action: planActionCreate,
+		Kind:   planKindRole,
+		Name:   role.Name,
+	}
+	var oldDescription, oldPolicies string
+	if existing != nil {
+		change.Action = planActionUpdate
+		oldDescription = existing.Description
+		oldPolicies = rolePolicyNames(existing.Policies)
+	}
+	change.Fields = diffFields(
+		planFieldChange{Field: "description", Old: oldDescription, New: role.Description},
+		planFieldChange{Field: "policies", Old: oldPolicies, New: rolePolicyNames(role.Policies)},
+	)
+	c.plan.add(change)
+	return nil
+}
+
+// planBindingRule adds the changes createOrUpdateBindingRule would make to
+// the plan.
+func (c *Command) planBindingRule(client *api.Client, authMethodName string, abr *api.ACLBindingRule, queryOptions *api.QueryOptions, writeOptions *api.WriteOptions) error {
+	existingRules, _, err := client.ACL().BindingRuleList(authMethodName, queryOptions)
+	if err != nil {
+		return err
+	}
+	change := planChange{
+		Action:    planActionCreate,
+		Kind:      planKindBindingRule,
+		Name:      abr.Description,
+		Namespace: abr.Namespace,
+	}
+	if writeOptions != nil {
+		change.Datacenter = writeOptions.Datacenter
+	}
+	var existing api.ACLBindingRule
+	for _, existingRule := range existingRules {
+		if existingRule.BindName == abr.BindName && existingRule.Description == abr.Description {
+			existing = *existingRule
+			change.Action = planActionUpdate
+		}
+	}
+	change.Fields = diffFields(
+		planFieldChange{Field: "auth method", Old: existing.AuthMethod, New: abr.AuthMethod},
+		planFieldChange{Field: "selector", Old: existing.Selector, New: abr.Selector},
+		planFieldChange{Field: "bind type", Old: string(existing.BindType), New: string(abr.BindType)},
+		planFieldChange{Field: "bind name", Old: existing.BindName, New: abr.BindName},
+	)
+	c.plan.add(change)
+	return nil
+}
+
+// planDeleteBindingRule adds the deletion of a stale binding rule to the plan.
+func (c *Command) planDeleteBindingRule(rule *api.ACLBindingRule, writeOptions *api.WriteOptions) {
+	change := planChange{
+		Action:    planActionDelete,
+		Kind:      planKindBindingRule,
+		Name:      rule.Description,
+		Namespace: rule.Namespace,
+		Fields: diffFields(
+			planFieldChange{Field: "selector", Old: rule.Selector},
+			planFieldChange{Field: "bind name", Old: rule.BindName},
+		),
+	}
+	if writeOptions != nil {
+		change.Datacenter = writeOptions.Datacenter
+	}
+	c.plan.add(change)
+}
+
+// planAuthMethod adds the changes createAuthMethod would make to the plan.
+// The auth method's service account JWT and CA certificate are sensitive and
+// are not included in the plan.
+func (c *Command) planAuthMethod(consulClient *api.Client, authMethod *api.ACLAuthMethod, writeOptions *api.WriteOptions) error {
+	existing, _, err := consulClient.ACL().AuthMethodRead(authMethod.Name, &api.QueryOptions{
+		Namespace:  writeOptions.Namespace,
+		Datacenter: writeOptions.Datacenter,
+	})
+	if err != nil {
+		return err
+	}
+	change := planChange{
+		Action:     planActionCreate,
+		Kind:       planKindAuthMethod,
+		Name:       authMethod.Name,
+		Namespace:  writeOptions.Namespace,
+		Datacenter: writeOptions.Datacenter,
+	}
+	old := api.ACLAuthMethod{}
+	if existing != nil {
+		change.Action = planActionUpdate
+		old = *existing
+	}
+	fields := []planFieldChange{
+		{Field: "type", Old: old.Type, New: authMethod.Type},
+		{Field: "description", Old: old.Description, New: authMethod.Description},
+		{Field: "token locality", Old: old.TokenLocality, New: authMethod.TokenLocality},
+	}
+	keys := make(map[string]struct{})
+	for k := range old.Config {
+		keys[k] = struct{}{}
+	}
+	for k := range authMethod.Config {
+		keys[k] = struct{}{}
+	}
+	var sortedKeys []string
+	for k := range keys {
+		sortedKeys = append(sortedKeys, k)
+	}
+	sort.Strings(sortedKeys)
+	var sensitiveFields []planFieldChange
+	for _, k := range sortedKeys {
+		oldValue, newValue := old.Config[k], authMethod.Config[k]
+		switch k {
+		case "ServiceAccountJWT", "CACert":
+			// Sensitive values are compared but never included in the plan.
+			if reflect.DeepEqual(oldValue, newValue) {
+				continue
+			}
+			field := planFieldChange{Field: "config." + k}
+			if oldValue != nil {
+				field.Old = sensitiveValue
+			}
+			if newValue != nil {
+				field.New = sensitiveValue
+			}
+			sensitiveFields = append(sensitiveFields, field)
+		default:
+			fields = append(fields, planFieldChange{Field: "config." + k, Old: configValue(oldValue), New: configValue(newValue)})
+		}
+	}
+	change.Fields = append(diffFields(fields...), sensitiveFields...)
+	c.plan.add(change)
+	return nil
+}
+
+// planNamespace adds a Consul namespace with the given default policies to
+// the plan.
+func (c *Command) planNamespace(consulClient *api.Client, name string, policyDefaults ...string) error {
+	existing, _, err := consulClient.Namespaces().Read(name, &api.QueryOptions{})
+	if err != nil {
+		return err
+	}
+	change := planChange{
+		Action: planActionCreate,
+		Kind:   planKindNamespace,
+		Name:   name,
+	}
+	var oldDefaults []string
+	if existing != nil {
+		change.Action = planActionUpdate
+		if existing.ACLs != nil {
+			for _, link := range existing.ACLs.PolicyDefaults {
+				oldDefaults = append(oldDefaults, link.Name)
+			}
+		}
+	}
+	change.Fields = diffFields(planFieldChange{
+		Field: "policy defaults",
+		Old:   strings.Join(oldDefaults, ", "),
+		New:   strings.Join(policyDefaults, ", "),
+	})
+	c.plan.add(change)
+	return nil
+}
+
+// planEnsureNamespace adds the namespace namespaces.EnsureExists would create
+// to the plan.
+func (c *Command) planEnsureNamespace(consulClient *api.Client, name, crossNamespacePolicy string) error {
+	existing, _, err := consulClient.Namespaces().Read(name, &api.QueryOptions{})
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		c.plan.unchanged()
+		return nil
+	}
+	c.plan.add(planChange{
+		Action: planActionCreate,
+		Kind:   planKindNamespace,
+		Name:   name,
+		Fields: diffFields(planFieldChange{Field: "policy defaults", New: crossNamespacePolicy}),
+	})
+	return nil
+}
+
+// planToken adds the creation of a token and the Kubernetes secret it is
+// stored in to the plan. The secret is omitted if secretName is empty.
+func (c *Command) planToken(token api.ACLToken, secretName string) {
+	var policies []string
+	for _, link := range token.Policies {
+		policies = append(policies, link.Name)
+	}
+	fields := []planFieldChange{
+		{Field: "policies", New: strings.Join(policies, ", ")},
+		{Field: "local", New: fmt.Sprint(token.Local)},
+	}
+	if secretName != "" {
+		fields = append(fields, planFieldChange{Field: "secret", New: secretName})
+	}
+	c.plan.add(planChange{
+		Action: planActionCreate,
+		Kind:   planKindToken,
+		Name:   token.Description,
+		Fields: diffFields(fields...),
+	})
+}
+
+// planAnonymousToken adds the changes to the policies of the anonymous token
+// to the plan.
+func (c *Command) planAnonymousToken(consulClient *api.Client, token api.ACLToken) error {
+	existing, _, err := consulClient.ACL().TokenRead(token.AccessorID, &api.QueryOptions{})
+	if err != nil {
+		return err
+	}
+	var oldPolicies, newPolicies []string
+	for _, link := range existing.Policies {
+		oldPolicies = append(oldPolicies, link.Name)
+	}
+	for _, link := range token.Policies {
+		newPolicies = append(newPolicies, link.Name)
+	}
+	c.plan.add(planChange{
+		Action: planActionUpdate,
+		Kind:   planKindToken,
+		Name:   existing.Description,
+		Fields: diffFields(planFieldChange{
+			Field: "policies",
+			Old:   strings.Join(oldPolicies, ", "),
+			New:   strings.Join(newPolicies, ", "),
+		}),
+	})
+	return nil
+}
+
+func rolePolicyNames(links []*api.ACLRolePolicyLink) string {
+	var names []string
+	for _, link := range links {
+		names = append(names, link.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+func configValue(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,384 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package serveraclinit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffLines(t *testing.T) {
+	cases := map[string]struct {
+		old, new string
+		exp      []string
+	}{
+		"create": {
+			new: "a\nb\n",
+			exp: []string{"+ a", "+ b"},
+		},
+		"unchanged lines are kept": {
+			old: "a\nb\nc",
+			new: "a\nx\nc\nd",
+			exp: []string{"  a", "- b", "+ x", "  c", "+ d"},
+		},
+		"remove": {
+			old: "a\nb",
+			new: "b",
+			exp: []string{"- a", "  b"},
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, c.exp, diffLines(c.old, c.new))
+		})
+	}
+}
+
+func TestACLPlan_Write(t *testing.T) {
+	plan := &aclPlan{}
+	plan.add(planChange{
+		Action: planActionCreate,
+		Kind:   planKindPolicy,
+		Name:   "connect-inject-policy",
+		Fields: diffFields(planFieldChange{Field: "rules", New: "acl = \"read\"\noperator = \"read\""}),
+	})
+	plan.add(planChange{
+		Action:     planActionUpdate,
+		Kind:       planKindBindingRule,
+		Name:       "Binding Rule for sa",
+		Datacenter: "dc1",
+		Fields:     diffFields(planFieldChange{Field: "selector", Old: "old", New: "new"}),
+	})
+	plan.add(planChange{
+		Action: planActionDelete,
+		Kind:   planKindBindingRule,
+		Name:   "Binding Rule for sa to role team-role",
+		Fields: diffFields(planFieldChange{Field: "bind name", Old: "team-role"}),
+	})
+	plan.add(planChange{Action: planActionUpdate, Kind: planKindRole, Name: "unchanged-role"})
+	plan.unchanged()
+
+	var text strings.Builder
+	require.NoError(t, plan.write(&text, dryRunFormatText))
+	require.Equal(t, `+ policy "connect-inject-policy"
+    rules:
+      + acl = "read"
+      + operator = "read"
+~ binding-rule "Binding Rule for sa" in datacenter "dc1"
+    selector: "old" => "new"
+- binding-rule "Binding Rule for sa to role team-role"
+    bind name: "team-role"
+
+Plan: 1 to create, 1 to update, 1 to delete, 2 unchanged.
+`, text.String())
+
+	var out strings.Builder
+	require.NoError(t, plan.write(&out, dryRunFormatJSON))
+	var decoded aclPlan
+	require.NoError(t, json.Unmarshal([]byte(out.String()), &decoded))
+	require.Equal(t, *plan, decoded)
+
+	var empty strings.Builder
+	require.NoError(t, (&aclPlan{}).write(&empty, dryRunFormatJSON))
+	require.JSONEq(t, `{"changes": [], "summary": {"create": 0, "update": 0, "delete": 0, "unchanged": 0}}`, empty.String())
+}
+
+// Test that the create or update functions add changes to the plan instead
+// of writing to Consul when a plan is set.
+func TestPlan_DoesNotWrite(t *testing.T) {
+	consul := &fakeConsulACLs{
+		policies: map[string]*api.ACLPolicy{
+			"sync-catalog-policy": {
+				Name:        "sync-catalog-policy",
+				Description: "sync-catalog-policy Token Policy",
+				Rules:       "node \"k8s-sync\" {\n  policy = \"write\"\n}",
+			},
+		},
+		roles: map[string]*api.ACLRole{
+			"release-sync-catalog-acl-role": {
+				Name:        "release-sync-catalog-acl-role",
+				Description: "ACL Role for release-sync-catalog",
+				Policies:    []*api.ACLRolePolicyLink{{Name: "sync-catalog-policy"}},
+			},
+		},
+		bindingRules: []*api.ACLBindingRule{
+			{
+				Description: "Binding Rule for release-sync-catalog",
+				AuthMethod:  "release-k8s-component-auth-method",
+				Selector:    `serviceaccount.name=="release-sync-catalog"`,
+				BindType:    api.BindingRuleBindTypeRole,
+				BindName:    "release-sync-catalog-acl-role",
+			},
+			{
+				Description: "Binding Rule for release-sync-catalog to role old-team-role",
+				AuthMethod:  "release-k8s-component-auth-method",
+				Selector:    `serviceaccount.name=="release-sync-catalog"`,
+				BindType:    api.BindingRuleBindTypeRole,
+				BindName:    "old-team-role",
+			},
+		},
+		authMethods: map[string]*api.ACLAuthMethod{
+			"release-k8s-component-auth-method": {
+				Name:        "release-k8s-component-auth-method",
+				Type:        "kubernetes",
+				Description: "Kubernetes Auth Method",
+				Config: map[string]interface{}{
+					"Host":              "https://kubernetes.default.svc",
+					"CACert":            "ca",
+					"ServiceAccountJWT": "old-jwt",
+				},
+			},
+		},
+	}
+	server := httptest.NewServer(consul)
+	defer server.Close()
+	client, err := api.NewClient(&api.Config{Address: server.URL})
+	require.NoError(t, err)
+
+	cmd := Command{
+		log:                hclog.NewNullLogger(),
+		flagResourcePrefix: "release",
+		flagSyncCatalog:    true,
+		plan:               &aclPlan{},
+	}
+
+	// An existing policy with new rules is updated.
+	require.NoError(t, cmd.createOrUpdateACLPolicy(api.ACLPolicy{
+		Name:        "sync-catalog-policy",
+		Description: "sync-catalog-policy Token Policy",
+		Rules:       "node \"k8s-sync\" {\n  policy = \"write\"\n}\noperator = \"read\"",
+	}, client))
+	// A new policy is created.
+	require.NoError(t, cmd.createOrUpdateACLPolicy(api.ACLPolicy{
+		Name:        "connect-inject-policy",
+		Description: "connect-inject-policy Token Policy",
+		Rules:       `acl = "write"`,
+	}, client))
+	// A role with an additional policy is updated.
+	require.NoError(t, cmd.updateOrCreateACLRole(client, &api.ACLRole{
+		Name:        "release-sync-catalog-acl-role",
+		Description: "ACL Role for release-sync-catalog",
+		Policies:    []*api.ACLRolePolicyLink{{Name: "sync-catalog-policy"}, {Name: "team-policy"}},
+	}))
+	// An unchanged binding rule isn't part of the plan.
+	require.NoError(t, cmd.createOrUpdateBindingRule(client, "release-k8s-component-auth-method", &api.ACLBindingRule{
+		Description: "Binding Rule for release-sync-catalog",
+		AuthMethod:  "release-k8s-component-auth-method",
+		Selector:    `serviceaccount.name=="release-sync-catalog"`,
+		BindType:    api.BindingRuleBindTypeRole,
+		BindName:    "release-sync-catalog-acl-role",
+	}, &api.QueryOptions{}, &api.WriteOptions{}))
+	// A binding rule for a role that was removed from the overrides is deleted.
+	existingRules, err := cmd.listBindingRules(client, "release-k8s-component-auth-method", &api.QueryOptions{})
+	require.NoError(t, err)
+	require.NoError(t, cmd.deleteStaleRoleBindingRules(client, existingRules, "release-sync-catalog",
+		`serviceaccount.name=="release-sync-catalog"`, nil, &api.WriteOptions{}))
+	// Sensitive auth method config is redacted.
+	require.NoError(t, cmd.createAuthMethod(client, &api.ACLAuthMethod{
+		Name:        "release-k8s-component-auth-method",
+		Type:        "kubernetes",
+		Description: "Kubernetes Auth Method",
+		Config: map[string]interface{}{
+			"Host":              "https://kubernetes.example.com",
+			"CACert":            "ca",
+			"ServiceAccountJWT": "new-jwt",
+		},
+	}, &api.WriteOptions{}))
+
+	require.Empty(t, consul.writes)
+	require.Equal(t, planSummary{Create: 1, Update: 3, Delete: 1, Unchanged: 1}, cmd.plan.Summary)
+	require.Equal(t, []planChange{
+		{
+			Action: planActionUpdate,
+			Kind:   planKindPolicy,
+			Name:   "sync-catalog-policy",
+			Fields: []planFieldChange{{
+				Field: "rules",
+				Diff:  []string{`  node "k8s-sync" {`, `    policy = "write"`, `  }`, `+ operator = "read"`},
+			}},
+		},
+		{
+			Action: planActionCreate,
+			Kind:   planKindPolicy,
+			Name:   "connect-inject-policy",
+			Fields: []planFieldChange{
+				{Field: "description", New: "connect-inject-policy Token Policy"},
+				{Field: "rules", New: `acl = "write"`},
+			},
+		},
+		{
+			Action: planActionUpdate,
+			Kind:   planKindRole,
+			Name:   "release-sync-catalog-acl-role",
+			Fields: []planFieldChange{{Field: "policies", Old: "sync-catalog-policy", New: "sync-catalog-policy, team-policy"}},
+		},
+		{
+			Action: planActionDelete,
+			Kind:   planKindBindingRule,
+			Name:   "Binding Rule for release-sync-catalog to role old-team-role",
+			Fields: []planFieldChange{
+				{Field: "selector", Old: `serviceaccount.name=="release-sync-catalog"`},
+				{Field: "bind name", Old: "old-team-role"},
+			},
+		},
+		{
+			Action: planActionUpdate,
+			Kind:   planKindAuthMethod,
+			Name:   "release-k8s-component-auth-method",
+			Fields: []planFieldChange{
+				{Field: "config.Host", Old: "https://kubernetes.default.svc", New: "https://kubernetes.example.com"},
+				{Field: "config.ServiceAccountJWT", Old: sensitiveValue, New: sensitiveValue},
+			},
+		},
+	}, cmd.plan.Changes)
+}
+
+// Test that existing policies are only updated with namespaces, catalog sync
+// or a policy override, and that policies whose description doesn't match are
+// skipped unless they must be updated.
+func TestPlan_ExistingPolicy(t *testing.T) {
+	const (
+		description = "client-policy Token Policy"
+		rules       = `node_prefix "" { policy = "write" }`
+		newRules    = `operator = "read"`
+	)
+	cases := map[string]struct {
+		existingDescription string
+		syncCatalog         bool
+		overridden          bool
+		expErr              string
+		expSummary          planSummary
+		expChanges          []planChange
+	}{
+		"not updated by default": {
+			existingDescription: description,
+			expSummary:          planSummary{Unchanged: 1},
+		},
+		"manually created policy skipped": {
+			existingDescription: "created manually",
+			expSummary:          planSummary{Unchanged: 1},
+		},
+		"updated with catalog sync": {
+			existingDescription: description,
+			syncCatalog:         true,
+			expSummary:          planSummary{Update: 1},
+			expChanges: []planChange{{
+				Action: planActionUpdate,
+				Kind:   planKindPolicy,
+				Name:   "client-policy",
+				Fields: []planFieldChange{{Field: "rules", Old: rules, New: newRules}},
+			}},
+		},
+		"overridden": {
+			existingDescription: description,
+			overridden:          true,
+			expSummary:          planSummary{Update: 1},
+			expChanges: []planChange{{
+				Action: planActionUpdate,
+				Kind:   planKindPolicy,
+				Name:   "client-policy",
+				Fields: []planFieldChange{
+					{Field: "description", Old: description, New: overriddenPolicyDescription(description)},
+					{Field: "rules", Old: rules, New: newRules},
+				},
+			}},
+		},
+		"override removed": {
+			existingDescription: overriddenPolicyDescription(description),
+			expSummary:          planSummary{Update: 1},
+			expChanges: []planChange{{
+				Action: planActionUpdate,
+				Kind:   planKindPolicy,
+				Name:   "client-policy",
+				Fields: []planFieldChange{
+					{Field: "description", Old: overriddenPolicyDescription(description), New: description},
+					{Field: "rules", Old: rules, New: newRules},
+				},
+			}},
+		},
+		"overridden manually created policy": {
+			existingDescription: "created manually",
+			overridden:          true,
+			expErr:              `policy found with name "client-policy" but not with expected description "client-policy Token Policy"`,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			consul := &fakeConsulACLs{
+				policies: map[string]*api.ACLPolicy{
+					"client-policy": {Name: "client-policy", Description: c.existingDescription, Rules: rules},
+				},
+			}
+			server := httptest.NewServer(consul)
+			defer server.Close()
+			client, err := api.NewClient(&api.Config{Address: server.URL})
+			require.NoError(t, err)
+
+			cmd := Command{log: hclog.NewNullLogger(), flagSyncCatalog: c.syncCatalog, plan: &aclPlan{}}
+			err = cmd.createOrUpdateACLPolicyWithOverride(api.ACLPolicy{Name: "client-policy", Description: description, Rules: newRules}, client, c.overridden)
+			if c.expErr != "" {
+				require.ErrorContains(t, err, c.expErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Empty(t, consul.writes)
+			require.Equal(t, c.expSummary, cmd.plan.Summary)
+			require.Equal(t, c.expChanges, cmd.plan.Changes)
+		})
+	}
+}
+
+// fakeConsulACLs serves reads of ACL resources and records any writes.
+type fakeConsulACLs struct {
+	policies     map[string]*api.ACLPolicy
+	roles        map[string]*api.ACLRole
+	bindingRules []*api.ACLBindingRule
+	authMethods  map[string]*api.ACLAuthMethod
+
+	writes []string
+}
+
+func (f *fakeConsulACLs) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		f.writes = append(f.writes, r.Method+" "+r.URL.Path)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	var resp interface{}
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/v1/acl/policy/name/"):
+		if p, ok := f.policies[strings.TrimPrefix(r.URL.Path, "/v1/acl/policy/name/")]; ok {
+			resp = p
+		}
+	case strings.HasPrefix(r.URL.Path, "/v1/acl/role/name/"):
+		if role, ok := f.roles[strings.TrimPrefix(r.URL.Path, "/v1/acl/role/name/")]; ok {
+			resp = role
+		}
+	case r.URL.Path == "/v1/acl/binding-rules":
+		var rules []*api.ACLBindingRule
+		for _, rule := range f.bindingRules {
+			if rule.AuthMethod == r.URL.Query().Get("authmethod") {
+				rules = append(rules, rule)
+			}
+		}
+		resp = rules
+	case strings.HasPrefix(r.URL.Path, "/v1/acl/auth-method/"):
+		if m, ok := f.authMethods[strings.TrimPrefix(r.URL.Path, "/v1/acl/auth-method/")]; ok {
+			resp = m
+		}
+	}
+	if resp == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,378 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package serveraclinit
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/hcl/hcl/ast"
+	"github.com/hashicorp/hcl/hcl/parser"
+	"github.com/hashicorp/hcl/hcl/token"
+)
+
+const (
+	// policyOverrideRulesSuffix is the suffix of a file that replaces the
+	// rules of a component's policy.
+	policyOverrideRulesSuffix = ".hcl"
+	// policyOverrideAdditionalRulesSuffix is the suffix of a file with rules
+	// for an additional policy that is attached to a component's role.
+	policyOverrideAdditionalRulesSuffix = ".additional.hcl"
+	// policyOverridePoliciesSuffix is the suffix of a file listing existing
+	// policies to attach to a component's role.
+	policyOverridePoliciesSuffix = ".policies"
+	// policyOverrideRolesSuffix is the suffix of a file listing existing roles
+	// to bind a component's service account to.
+	policyOverrideRolesSuffix = ".roles"
+)
+
+// componentPolicyOverride customizes the ACL policy and role created for a
+// component.
+type componentPolicyOverride struct {
+	// Rules replaces the rules rendered for the component's policy.
+	Rules string
+	// AdditionalRules are the rules of an additional policy that is attached
+	// to the component's role.
+	AdditionalRules string
+	// Policies are the names of existing policies to attach to the
+	// component's role.
+	Policies []string
+	// Roles are the names of existing roles that the component's service
+	// account is also bound to.
+	Roles []string
+}
+
+// policyOverrides are the component policy overrides keyed by component name,
+// e.g. "connect-inject", "mesh-gateway" or the name of an ingress or
+// terminating gateway.
+type policyOverrides map[string]*componentPolicyOverride
+
+// loadPolicyOverrides loads the policy overrides from the files in dir, which
+// is usually a mounted ConfigMap. Files are named after the component they
+// apply to:
+//
+//   - <component>.hcl replaces the rules of the component's policy.
+//   - <component>.additional.hcl are the rules of an additional policy named
+//     <component>-additional-policy that is attached to the component's role.
+//   - <component>.policies lists existing policies, one per line, to attach to
+//     the component's role.
+//   - <component>.roles lists existing roles, one per line, that the
+//     component's service account is also bound to.
+func loadPolicyOverrides(dir string) (policyOverrides, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading policy overrides directory: %w", err)
+	}
+
+	overrides := make(policyOverrides)
+	for _, entry := range entries {
+		// Skip the hidden files and directories Kubernetes creates when
+		// mounting a ConfigMap.
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		if info, err := os.Stat(path); err != nil {
+			return nil, err
+		} else if info.IsDir() {
+			continue
+		}
+		contents, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading policy override %q: %w", entry.Name(), err)
+		}
+
+		component, suffix := splitPolicyOverrideFileName(entry.Name())
+		if component == "" {
+			return nil, fmt.Errorf("unrecognized policy override file %q: must be named <component>%s, <component>%s, <component>%s or <component>%s",
+				entry.Name(), policyOverrideRulesSuffix, policyOverrideAdditionalRulesSuffix, policyOverridePoliciesSuffix, policyOverrideRolesSuffix)
+		}
+		override, ok := overrides[component]
+		if !ok {
+			override = &componentPolicyOverride{}
+			overrides[component] = override
+		}
+		switch suffix {
+		case policyOverrideRulesSuffix, policyOverrideAdditionalRulesSuffix:
+			rules := string(contents)
+			if _, err := parseACLGrants(rules); err != nil {
+				return nil, fmt.Errorf("parsing policy override %q: %w", entry.Name(), err)
+			}
+			if suffix == policyOverrideRulesSuffix {
+				override.Rules = rules
+			} else {
+				override.AdditionalRules = rules
+			}
+		case policyOverridePoliciesSuffix:
+			override.Policies = splitNames(string(contents))
+		case policyOverrideRolesSuffix:
+			override.Roles = splitNames(string(contents))
+		}
+	}
+	return overrides, nil
+}
+
+// forComponent returns the overrides for component. It returns an empty
+// override if there are none.
+func (o policyOverrides) forComponent(component string) *componentPolicyOverride {
+	if override, ok := o[component]; ok {
+		return override
+	}
+	return &componentPolicyOverride{}
+}
+
+// splitPolicyOverrideFileName returns the component and suffix of a policy
+// override file name. The component is empty if the name isn't recognized.
+func splitPolicyOverrideFileName(name string) (string, string) {
+	// The additional rules suffix must be checked before the rules suffix
+	// since it ends with it.
+	for _, suffix := range []string{policyOverrideAdditionalRulesSuffix, policyOverrideRulesSuffix, policyOverridePoliciesSuffix, policyOverrideRolesSuffix} {
+		if strings.HasSuffix(name, suffix) {
+			return strings.TrimSuffix(name, suffix), suffix
+		}
+	}
+	return "", ""
+}
+
+// splitNames returns the non-empty lines of s, ignoring comments starting
+// with #.
+func splitNames(s string) []string {
+	var names []string
+	for _, line := range strings.Split(s, "\n") {
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		if line = strings.TrimSpace(line); line != "" {
+			names = append(names, line)
+		}
+	}
+	return names
+}
+
+// aclGrant is a single permission granted by ACL rules. For example, the rule
+//
+//	namespace "default" {
+//	  service "web" {
+//	    policy = "write"
+//	  }
+//	}
+//
+// grants the permission "policy" on the resource `namespace "default" service "web"`
+// at the level "write".
+type aclGrant struct {
+	Resource   string
+	Permission string
+	Level      string
+}
+
+func (g aclGrant) String() string {
+	if g.Resource == "" {
+		return fmt.Sprintf("%s = %q", g.Permission, g.Level)
+	}
+	return fmt.Sprintf("%s { %s = %q }", g.Resource, g.Permission, g.Level)
+}
+
+// aclLevels orders ACL access levels from least to most privileged.
+var aclLevels = map[string]int{
+	"deny":  0,
+	"read":  1,
+	"list":  2,
+	"write": 3,
+}
+
+// parseACLGrants returns the permissions granted by ACL rules.
+func parseACLGrants(rules string) ([]aclGrant, error) {
+	file, err := parser.Parse([]byte(rules))
+	if err != nil {
+		return nil, err
+	}
+	list, ok := file.Node.(*ast.ObjectList)
+	if !ok {
+		return nil, errors.New("rules must be a list of ACL rules")
+	}
+	var grants []aclGrant
+	if err := collectACLGrants(list, nil, &grants); err != nil {
+		return nil, err
+	}
+	return grants, nil
+}
+
+func collectACLGrants(list *ast.ObjectList, resource []string, grants *[]aclGrant) error {
+	for _, item := range list.Items {
+		var keys []string
+		for _, key := range item.Keys {
+			if key.Token.Type == token.STRING {
+				keys = append(keys, strconv.Quote(key.Token.Value().(string)))
+			} else {
+				keys = append(keys, key.Token.Text)
+			}
+		}
+		switch val := item.Val.(type) {
+		case *ast.ObjectType:
+			if err := collectACLGrants(val.List, append(resource, keys...), grants); err != nil {
+				return err
+			}
+		case *ast.LiteralType:
+			level, ok := val.Token.Value().(string)
+			if !ok {
+				return fmt.Errorf("%s must be a string", strings.Join(keys, " "))
+			}
+			*grants = append(*grants, aclGrant{
+				Resource:   strings.Join(resource, " "),
+				Permission: strings.Join(keys, " "),
+				Level:      level,
+			})
+		default:
+			return fmt.Errorf("unsupported value for %s", strings.Join(keys, " "))
+		}
+	}
+	return nil
+}
+
+const (
+	// allowlistAttachPoliciesKey and allowlistAttachRolesKey are the keys of
+	// the lists of existing policies and roles in the allowlist that policy
+	// overrides may attach to components.
+	allowlistAttachPoliciesKey = "attach_policies"
+	allowlistAttachRolesKey    = "attach_roles"
+)
+
+// policyAllowlist limits the rules that component policies may grant and the
+// existing policies and roles that may be attached to components.
+type policyAllowlist struct {
+	// levels is the most privileged level each permission may be granted at,
+	// keyed by resource and permission.
+	levels map[aclGrant]string
+	// policies and roles are the names of the existing policies and roles
+	// that may be attached to components.
+	policies map[string]bool
+	roles    map[string]bool
+}
+
+// loadPolicyAllowlist loads the allowlist from a file of ACL rules. Each rule
+// in the file is the most privileged level the permission may be granted at.
+// The attach_policies and attach_roles lists in the file are the existing
+// policies and roles that policy overrides may attach to components.
+func loadPolicyAllowlist(path string) (*policyAllowlist, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading policy allowlist: %w", err)
+	}
+	file, err := parser.Parse(contents)
+	if err != nil {
+		return nil, fmt.Errorf("parsing policy allowlist: %w", err)
+	}
+	list, ok := file.Node.(*ast.ObjectList)
+	if !ok {
+		return nil, errors.New("parsing policy allowlist: rules must be a list of ACL rules")
+	}
+
+	allowlist := &policyAllowlist{
+		levels:   make(map[aclGrant]string),
+		policies: make(map[string]bool),
+		roles:    make(map[string]bool),
+	}
+	rules := &ast.ObjectList{}
+	for _, item := range list.Items {
+		var names map[string]bool
+		if len(item.Keys) == 1 {
+			switch item.Keys[0].Token.Value() {
+			case allowlistAttachPoliciesKey:
+				names = allowlist.policies
+			case allowlistAttachRolesKey:
+				names = allowlist.roles
+			}
+		}
+		if names == nil {
+			rules.Add(item)
+			continue
+		}
+		if err := collectNames(item, names); err != nil {
+			return nil, fmt.Errorf("parsing policy allowlist: %w", err)
+		}
+	}
+
+	var grants []aclGrant
+	if err := collectACLGrants(rules, nil, &grants); err != nil {
+		return nil, fmt.Errorf("parsing policy allowlist: %w", err)
+	}
+	for _, grant := range grants {
+		allowlist.levels[aclGrant{Resource: grant.Resource, Permission: grant.Permission}] = grant.Level
+	}
+	return allowlist, nil
+}
+
+// collectNames adds the strings in the list value of item to names.
+func collectNames(item *ast.ObjectItem, names map[string]bool) error {
+	key := item.Keys[0].Token.Text
+	list, ok := item.Val.(*ast.ListType)
+	if !ok {
+		return fmt.Errorf("%s must be a list of names", key)
+	}
+	for _, node := range list.List {
+		literal, ok := node.(*ast.LiteralType)
+		if !ok {
+			return fmt.Errorf("%s must be a list of names", key)
+		}
+		name, ok := literal.Token.Value().(string)
+		if !ok {
+			return fmt.Errorf("%s must be a list of names", key)
+		}
+		names[name] = true
+	}
+	return nil
+}
+
+// attachmentViolations returns the existing policies and roles that aren't
+// in the allowlist.
+func (a *policyAllowlist) attachmentViolations(policies, roles []string) []string {
+	var violations []string
+	for _, name := range policies {
+		if !a.policies[name] {
+			violations = append(violations, fmt.Sprintf("policy %q", name))
+		}
+	}
+	for _, name := range roles {
+		if !a.roles[name] {
+			violations = append(violations, fmt.Sprintf("role %q", name))
+		}
+	}
+	sort.Strings(violations)
+	return violations
+}
+
+// violations returns the grants in rules that exceed the allowlist. A grant
+// exceeds the allowlist if the allowlist doesn't contain the same permission
+// on the same resource at the same or a more privileged level. Resources are
+// matched exactly, so a prefix rule in the allowlist does not allow rules for
+// the resources it matches.
+func (a *policyAllowlist) violations(rules string) ([]string, error) {
+	grants, err := parseACLGrants(rules)
+	if err != nil {
+		return nil, err
+	}
+	var violations []string
+	for _, grant := range grants {
+		if grant.Level == "deny" {
+			continue
+		}
+		allowed, ok := a.levels[aclGrant{Resource: grant.Resource, Permission: grant.Permission}]
+		if ok && allowed == grant.Level {
+			continue
+		}
+		allowedLevel, allowedKnown := aclLevels[allowed]
+		level, known := aclLevels[grant.Level]
+		if ok && allowedKnown && known && level <= allowedLevel {
+			continue
+		}
+		violations = append(violations, grant.String())
+	}
+	sort.Strings(violations)
+	return violations, nil
+}
@@ -0,0 +1,220 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package serveraclinit
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadPolicyOverrides(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"connect-inject.hcl":            `operator = "read"`,
+		"connect-inject.additional.hcl": `service_prefix "" { policy = "read" }`,
+		"connect-inject.policies":       "team-policy\n\n# comment\n  other-policy  \n",
+		"mesh-gateway.roles":            "gateway-role\n",
+	}
+	for name, contents := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(contents), 0600))
+	}
+	// Kubernetes mounts ConfigMaps with hidden files and directories that
+	// must be skipped.
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "..2023_01_01"), 0700))
+	require.NoError(t, os.Symlink("..2023_01_01", filepath.Join(dir, "..data")))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "subdir"), 0700))
+
+	overrides, err := loadPolicyOverrides(dir)
+	require.NoError(t, err)
+	require.Equal(t, policyOverrides{
+		"connect-inject": {
+			Rules:           `operator = "read"`,
+			AdditionalRules: `service_prefix "" { policy = "read" }`,
+			Policies:        []string{"team-policy", "other-policy"},
+		},
+		"mesh-gateway": {
+			Roles: []string{"gateway-role"},
+		},
+	}, overrides)
+	require.Equal(t, &componentPolicyOverride{}, overrides.forComponent("sync-catalog"))
+}
+
+func TestLoadPolicyOverrides_Errors(t *testing.T) {
+	cases := map[string]struct {
+		fileName string
+		contents string
+		expErr   string
+	}{
+		"unrecognized file": {
+			fileName: "connect-inject.json",
+			contents: "{}",
+			expErr:   `unrecognized policy override file "connect-inject.json"`,
+		},
+		"invalid rules": {
+			fileName: "connect-inject.hcl",
+			contents: `service "web" {`,
+			expErr:   `parsing policy override "connect-inject.hcl"`,
+		},
+		"invalid additional rules": {
+			fileName: "connect-inject.additional.hcl",
+			contents: `service "web" { policy = ["write"] }`,
+			expErr:   `parsing policy override "connect-inject.additional.hcl": unsupported value for policy`,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			require.NoError(t, os.WriteFile(filepath.Join(dir, c.fileName), []byte(c.contents), 0600))
+			_, err := loadPolicyOverrides(dir)
+			require.Error(t, err)
+			require.Contains(t, err.Error(), c.expErr)
+		})
+	}
+}
+
+func TestParseACLGrants(t *testing.T) {
+	grants, err := parseACLGrants(`
+operator = "read"
+acl = "write"
+namespace "default" {
+  service "web" {
+    policy     = "write"
+    intentions = "read"
+  }
+}
+partition_prefix "" {
+  namespace_prefix "" {
+    node_prefix "" {
+      policy = "read"
+    }
+  }
+}
+`)
+	require.NoError(t, err)
+	require.Equal(t, []aclGrant{
+		{Permission: "operator", Level: "read"},
+		{Permission: "acl", Level: "write"},
+		{Resource: `namespace "default" service "web"`, Permission: "policy", Level: "write"},
+		{Resource: `namespace "default" service "web"`, Permission: "intentions", Level: "read"},
+		{Resource: `partition_prefix "" namespace_prefix "" node_prefix ""`, Permission: "policy", Level: "read"},
+	}, grants)
+}
+
+func TestPolicyAllowlist_Violations(t *testing.T) {
+	allowlistFile := filepath.Join(t.TempDir(), "allowlist.hcl")
+	require.NoError(t, os.WriteFile(allowlistFile, []byte(`
+operator = "read"
+node_prefix "" {
+  policy = "write"
+}
+service_prefix "" {
+  policy     = "read"
+  intentions = "read"
+}
+`), 0600))
+	allowlist, err := loadPolicyAllowlist(allowlistFile)
+	require.NoError(t, err)
+
+	cases := map[string]struct {
+		rules         string
+		expViolations []string
+	}{
+		"within allowlist": {
+			rules: `
+operator = "read"
+node_prefix "" { policy = "read" }
+service_prefix "" { policy = "read" }
+`,
+		},
+		"deny is always allowed": {
+			rules: `acl = "deny"`,
+		},
+		"more privileged level": {
+			rules:         `operator = "write"`,
+			expViolations: []string{`operator = "write"`},
+		},
+		"permission not in allowlist": {
+			rules:         `service_prefix "" { policy = "read" } acl = "read"`,
+			expViolations: []string{`acl = "read"`},
+		},
+		"resource matched exactly": {
+			rules: `
+service "web" { policy = "read" }
+service_prefix "" { intentions = "write" }
+`,
+			expViolations: []string{
+				`service "web" { policy = "read" }`,
+				`service_prefix "" { intentions = "write" }`,
+			},
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			violations, err := allowlist.violations(c.rules)
+			require.NoError(t, err)
+			require.Equal(t, c.expViolations, violations)
+		})
+	}
+}
+
+func TestPolicyAllowlist_AttachmentViolations(t *testing.T) {
+	allowlistFile := filepath.Join(t.TempDir(), "allowlist.hcl")
+	require.NoError(t, os.WriteFile(allowlistFile, []byte(`
+operator        = "read"
+attach_policies = ["team-policy"]
+attach_roles    = ["team-role"]
+`), 0600))
+	allowlist, err := loadPolicyAllowlist(allowlistFile)
+	require.NoError(t, err)
+
+	violations, err := allowlist.violations(`operator = "read"`)
+	require.NoError(t, err)
+	require.Empty(t, violations)
+	require.Empty(t, allowlist.attachmentViolations([]string{"team-policy"}, []string{"team-role"}))
+	require.Equal(t, []string{`policy "global-management"`, `role "team-policy"`},
+		allowlist.attachmentViolations([]string{"team-policy", "global-management"}, []string{"team-policy"}))
+}
+
+func TestLoadPolicyAllowlist_InvalidAttachments(t *testing.T) {
+	allowlistFile := filepath.Join(t.TempDir(), "allowlist.hcl")
+	require.NoError(t, os.WriteFile(allowlistFile, []byte(`attach_policies = "team-policy"`), 0600))
+	_, err := loadPolicyAllowlist(allowlistFile)
+	require.EqualError(t, err, "parsing policy allowlist: attach_policies must be a list of names")
+}
+
+func TestCreateACLPolicyRoleAndBindingRule_StrictAllowlistAttachments(t *testing.T) {
+	allowlistFile := filepath.Join(t.TempDir(), "allowlist.hcl")
+	require.NoError(t, os.WriteFile(allowlistFile, []byte(`
+operator        = "read"
+attach_policies = ["team-policy"]
+attach_roles    = ["team-role"]
+`), 0600))
+	allowlist, err := loadPolicyAllowlist(allowlistFile)
+	require.NoError(t, err)
+
+	consul := &fakeConsulACLs{}
+	server := httptest.NewServer(consul)
+	defer server.Close()
+	client, err := api.NewClient(&api.Config{Address: server.URL})
+	require.NoError(t, err)
+
+	cmd := Command{
+		log: hclog.NewNullLogger(),
+		policyOverrides: policyOverrides{
+			"sync-catalog": {Policies: []string{"team-policy", "global-management"}, Roles: []string{"admin-role"}},
+		},
+		policyAllowlist:           allowlist,
+		flagStrictPolicyAllowlist: true,
+	}
+	err = cmd.createACLPolicyRoleAndBindingRule("sync-catalog", `operator = "read"`, "dc1", "dc1", false, true,
+		"release-k8s-component-auth-method", "release-sync-catalog", client)
+	require.EqualError(t, err, `sync-catalog policies and roles exceed the policy allowlist: policy "global-management", role "admin-role"`)
+	require.Empty(t, consul.writes)
+}
@@ -0,0 +1,165 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package serveraclinit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	vaultApi "github.com/hashicorp/vault/api"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// Test that all secrets backends behave the same way. New backends should
+// be added here.
+func TestSecretsBackend_Conformance(t *testing.T) {
+	t.Parallel()
+
+	backends := map[string]func(t *testing.T) SecretsBackend{
+		"kubernetes": func(t *testing.T) SecretsBackend {
+			return &KubernetesSecretsBackend{
+				ctx:          context.Background(),
+				clientset:    fake.NewSimpleClientset(),
+				k8sNamespace: "default",
+				secretName:   "release-consul-bootstrap-acl-token",
+				secretKey:    "token",
+			}
+		},
+		"vault": func(t *testing.T) SecretsBackend {
+			return &VaultSecretsBackend{
+				vaultClient: newFakeVaultKV(t),
+				secretName:  "secret/data/consul/bootstrap-token",
+				secretKey:   "token",
+			}
+		},
+		"file": func(t *testing.T) SecretsBackend {
+			return &FileSecretsBackend{
+				ctx:        context.Background(),
+				secretName: t.TempDir(),
+				secretKey:  "token",
+			}
+		},
+		"file with write command": func(t *testing.T) SecretsBackend {
+			return &FileSecretsBackend{
+				ctx:          context.Background(),
+				secretName:   t.TempDir(),
+				secretKey:    "token",
+				writeCommand: `cat > "$CONSUL_BOOTSTRAP_TOKEN_SECRET_NAME/$CONSUL_BOOTSTRAP_TOKEN_SECRET_KEY"`,
+			}
+		},
+		"fake": func(t *testing.T) SecretsBackend {
+			return &FakeSecretsBackend{}
+		},
+	}
+
+	for name, newBackend := range backends {
+		newBackend := newBackend
+		t.Run(name, func(t *testing.T) {
+			t.Run("no bootstrap token", func(t *testing.T) {
+				token, err := newBackend(t).BootstrapToken()
+				require.NoError(t, err)
+				require.Empty(t, token)
+			})
+			t.Run("write and read bootstrap token", func(t *testing.T) {
+				backend := newBackend(t)
+				require.NoError(t, backend.WriteBootstrapToken("bootstrap-token"))
+				token, err := backend.BootstrapToken()
+				require.NoError(t, err)
+				require.Equal(t, "bootstrap-token", token)
+			})
+			t.Run("secret name", func(t *testing.T) {
+				require.NotEmpty(t, newBackend(t).BootstrapTokenSecretName())
+			})
+		})
+	}
+}
+
+func TestFileSecretsBackend(t *testing.T) {
+	t.Parallel()
+
+	t.Run("trims whitespace", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "token"), []byte("bootstrap-token\n"), 0600))
+		backend := &FileSecretsBackend{secretName: dir, secretKey: "token"}
+		token, err := backend.BootstrapToken()
+		require.NoError(t, err)
+		require.Equal(t, "bootstrap-token", token)
+		require.Equal(t, filepath.Join(dir, "token"), backend.BootstrapTokenSecretName())
+	})
+
+	t.Run("writes to write path", func(t *testing.T) {
+		writePath := filepath.Join(t.TempDir(), "bootstrap-token")
+		backend := &FileSecretsBackend{secretName: t.TempDir(), secretKey: "token", writePath: writePath}
+		require.NoError(t, backend.WriteBootstrapToken("bootstrap-token"))
+
+		written, err := os.ReadFile(writePath)
+		require.NoError(t, err)
+		require.Equal(t, "bootstrap-token", string(written))
+		info, err := os.Stat(writePath)
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+		// The token isn't read from the write path.
+		token, err := backend.BootstrapToken()
+		require.NoError(t, err)
+		require.Empty(t, token)
+	})
+
+	t.Run("write command fails", func(t *testing.T) {
+		backend := &FileSecretsBackend{
+			ctx:          context.Background(),
+			secretName:   t.TempDir(),
+			secretKey:    "token",
+			writeCommand: "echo unauthorized >&2; exit 1",
+		}
+		err := backend.WriteBootstrapToken("bootstrap-token")
+		require.EqualError(t, err, "running bootstrap token write command: exit status 1: unauthorized")
+	})
+}
+
+// newFakeVaultKV returns a Vault client for a fake Vault server that serves
+// KV version 2 secrets.
+func newFakeVaultKV(t *testing.T) *vaultApi.Client {
+	var mu sync.Mutex
+	secrets := make(map[string]interface{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		name := strings.TrimPrefix(r.URL.Path, "/v1/")
+		switch r.Method {
+		case http.MethodGet:
+			data, ok := secrets[name]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"data": data}})
+		case http.MethodPut, http.MethodPost:
+			var body map[string]interface{}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			secrets[name] = body["data"]
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	client, err := vaultApi.NewClient(&vaultApi.Config{Address: server.URL})
+	require.NoError(t, err)
+	client.SetToken("root")
+	return client
+}
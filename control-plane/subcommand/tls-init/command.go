@@ -5,6 +5,7 @@ package tls_init
 
 import (
 	"context"
+	"crypto/x509"
 	"errors"
 	"flag"
 	"fmt"
@@ -33,19 +34,21 @@ type Command struct {
 	k8sFlags *flags.K8SFlags
 
 	// flags that support the CA/key as files on disk.
-	flagCaFile  string
-	flagKeyFile string
+	flagCaFile      string
+	flagKeyFile     string
+	flagCaChainFile string
 
 	// value that support the CA/key as secrets in Kubernetes.
 	caCertSecret *corev1.Secret
 	caKeySecret  *corev1.Secret
 
 	// flags that dictate the specifications of the created certs.
-	flagDays        int
-	flagDomain      string
-	flagDC          string
-	flagDNSNames    flags.AppendSliceValue
-	flagIPAddresses flags.AppendSliceValue
+	flagDays         int
+	flagDomain       string
+	flagDC           string
+	flagDNSNames     flags.AppendSliceValue
+	flagIPAddresses  flags.AppendSliceValue
+	flagKeyAlgorithm string
 
 	// flags that dictate specifics for the secret name and namespace
 	// that are created by the command.
@@ -128,7 +131,7 @@ func (c *Command) Run(args []string) int {
 	// Only create a CA certificate/key pair if it doesn't exist or hasn't been provided
 	if !c.caExists() {
 		c.log.Info("no existing CA found; generating new CA certificate and key")
-		_, pk, ca, _, err = cert.GenerateCA("Consul Agent CA")
+		_, pk, ca, _, err = cert.GenerateCAWithKeyAlgorithm("Consul Agent CA", cert.KeyAlgorithm(c.flagKeyAlgorithm))
 		if err != nil {
 			c.log.Error("error generating Consul Agent CA certificate and private key", "err", err)
 			return 1
@@ -199,6 +202,47 @@ func (c *Command) Run(args []string) int {
 	ca = string(caBytes)
 	pk = string(keyBytes)
 
+	c.log.Info("parsing certificate signer from CA private key")
+	signer, err := cert.ParseSigner(pk)
+	if err != nil {
+		c.log.Error("error parsing signer from private key", "err", err)
+		return 1
+	}
+
+	// The CA certificate may be followed by the certificates that issued it
+	// if it's an intermediate CA.
+	c.log.Info("parsing CA certificate from PEM string")
+	caCerts, err := cert.ParseCerts([]byte(ca))
+	if err != nil {
+		c.log.Error("error parsing CA certificate from PEM string", "err", err)
+		return 1
+	}
+	caCert := caCerts[0]
+	candidates := caCerts[1:]
+	if c.flagCaChainFile != "" {
+		c.log.Info("reading CA chain from provided file")
+		chainBytes, err := os.ReadFile(c.flagCaChainFile)
+		if err != nil {
+			c.log.Error("error reading provided CA chain file", "err", err)
+			return 1
+		}
+		chainCerts, err := cert.ParseCerts(chainBytes)
+		if err != nil {
+			c.log.Error("error parsing CA chain", "err", err)
+			return 1
+		}
+		candidates = append(candidates, chainCerts...)
+	}
+	if err := cert.ValidateCA(caCert, signer, time.Now()); err != nil {
+		c.log.Error("invalid CA", "err", err)
+		return 1
+	}
+	chain := cert.BuildChain(caCert, candidates)
+	issuers := append([]*x509.Certificate{caCert}, chain...)
+	if !cert.IsSelfSigned(caCert) {
+		c.log.Info("using intermediate CA", "chain-length", len(chain))
+	}
+
 	for _, d := range c.flagDNSNames {
 		if len(d) > 0 {
 			hosts = append(hosts, strings.TrimSpace(d))
@@ -212,28 +256,38 @@ func (c *Command) Run(args []string) int {
 	}
 
 	name = fmt.Sprintf("server.%s.%s", c.flagDC, c.flagDomain)
-	hosts = append(hosts, name, "localhost", "127.0.0.1")
-
-	c.log.Info("parsing certificate signer from CA private key")
-	signer, err := cert.ParseSigner(pk)
-	if err != nil {
-		c.log.Error("error parsing signer from private key", "err", err)
-		return 1
+	hosts = append(hosts, name)
+	for _, h := range hosts {
+		if err := cert.CheckNameConstraints(h, issuers...); err != nil {
+			c.log.Error("error checking server certificate names against CA", "err", err)
+			return 1
+		}
+	}
+	// localhost and 127.0.0.1 are only added if the CA permits them.
+	for _, h := range []string{"localhost", "127.0.0.1"} {
+		if err := cert.CheckNameConstraints(h, issuers...); err != nil {
+			c.log.Warn("not adding name to server certificate", "name", h, "err", err)
+			continue
+		}
+		hosts = append(hosts, h)
 	}
 
-	c.log.Info("parsing CA certificate from PEM string")
-	caCert, err := cert.ParseCert([]byte(ca))
-	if err != nil {
-		c.log.Error("error parsing CA certificate from PEM string", "err", err)
-		return 1
+	// The server certificate can't outlive its CA.
+	expiry := c.getDaysAsDuration()
+	if notAfter := cert.NotAfter(issuers...); time.Now().Add(expiry).After(notAfter) {
+		c.log.Warn("limiting server certificate validity to the expiry of its CA", "expiry", notAfter.Format(time.RFC3339))
+		expiry = time.Until(notAfter)
 	}
 
 	c.log.Info("generating server certificate and private key")
-	serverCert, serverKey, err := cert.GenerateCert(name, c.getDaysAsDuration(), caCert, signer, hosts)
+	serverCert, serverKey, err := cert.GenerateCertWithKeyAlgorithm(name, expiry, caCert, signer, hosts, cert.KeyAlgorithm(c.flagKeyAlgorithm))
 	if err != nil {
 		c.log.Error("error generating server certificate and private key", "err", err)
 		return 1
 	}
+	// Servers present the intermediate CAs so clients that only trust the
+	// root can verify the server certificate.
+	serverCert += cert.IntermediatesPEM(caCert, chain)
 
 	serverCertSecret, err := c.clientset.CoreV1().Secrets(c.flagK8sNamespace).Get(c.ctx, fmt.Sprintf("%s-server-cert", c.flagNamePrefix), metav1.GetOptions{})
 	if err != nil && k8serrors.IsNotFound(err) {
@@ -297,6 +351,10 @@ func (c *Command) init() {
 	c.flags.StringVar(&c.flagDomain, "domain", "consul", "Domain of consul cluster. Only used in combination with -name-constraint. Defaults to consul.")
 	c.flags.StringVar(&c.flagCaFile, "ca", "", "Path to the CA certificate file.")
 	c.flags.StringVar(&c.flagKeyFile, "key", "", "Path to the CA key file.")
+	c.flags.StringVar(&c.flagCaChainFile, "ca-chain", "", "Path to a file with the certificates that issued the CA certificate if it's "+
+		"an intermediate CA. The chain may also follow the CA certificate in the -ca file or the CA certificate secret.")
+	c.flags.StringVar(&c.flagKeyAlgorithm, "key-algorithm", string(cert.DefaultKeyAlgorithm), fmt.Sprintf(
+		"The algorithm of generated private keys. One of %s. Defaults to %q.", keyAlgorithmsString(), cert.DefaultKeyAlgorithm))
 	c.flags.StringVar(&c.flagDC, "dc", "dc1", "Datacenter of the Consul cluster. Defaults to dc1.")
 	c.flags.StringVar(&c.flagNamePrefix, "name-prefix", "", "Name prefix for secrets containing the CA, server certificate and private key")
 	c.flags.StringVar(&c.flagK8sNamespace, "k8s-namespace", "default", "Name of Kubernetes namespace where secrets should be created and read from.")
@@ -360,10 +418,30 @@ func (c *Command) validateFlags() error {
 	if c.flagDays <= 0 {
 		return errors.New("-days must be a positive integer")
 	}
+	if c.flagCaChainFile != "" && c.flagCaFile == "" {
+		return errors.New("-ca-chain can only be set with -ca and -key")
+	}
+	validAlgorithm := false
+	for _, alg := range cert.KeyAlgorithms {
+		if cert.KeyAlgorithm(c.flagKeyAlgorithm) == alg {
+			validAlgorithm = true
+		}
+	}
+	if !validAlgorithm {
+		return fmt.Errorf("-key-algorithm must be one of %s", keyAlgorithmsString())
+	}
 
 	return nil
 }
 
+func keyAlgorithmsString() string {
+	var algs []string
+	for _, alg := range cert.KeyAlgorithms {
+		algs = append(algs, fmt.Sprintf("%q", alg))
+	}
+	return strings.Join(algs, ", ")
+}
+
 const synopsis = "Initialize CA and Server Certificates during Consul install."
 const help = `
 Usage: consul-k8s-control-plane tls-init [options]
@@ -372,4 +450,7 @@ Usage: consul-k8s-control-plane tls-init [options]
   for the Consul server. It manages the rotation of the Server certificates on subsequent
   runs. It can be provided with the CA certificate and key files on disk or can manage it's own CA.
 
+  The provided CA may be an intermediate CA, in which case the server certificate secret
+  includes the intermediate CAs so clients that only trust the root can verify it.
+
 `
@@ -12,6 +12,8 @@ import (
 	"testing"
 	"time"
 
+	"github.com/hashicorp/consul-k8s/control-plane/helper/cert"
+	"github.com/hashicorp/consul-k8s/control-plane/helper/test"
 	"github.com/mitchellh/cli"
 	"github.com/stretchr/testify/require"
 	corev1 "k8s.io/api/core/v1"
@@ -46,6 +48,14 @@ func TestRun_FlagValidation(t *testing.T) {
 			flags:  []string{"-name-prefix", "consul", "-days", "-3"},
 			expErr: "-days must be a positive integer",
 		},
+		{
+			flags:  []string{"-name-prefix", "consul", "-ca-chain", "/foo"},
+			expErr: "-ca-chain can only be set with -ca and -key",
+		},
+		{
+			flags:  []string{"-name-prefix", "consul", "-key-algorithm", "dsa"},
+			expErr: "-key-algorithm must be one of",
+		},
 	}
 
 	for _, c := range cases {
@@ -540,6 +550,125 @@ func TestRun_CreatesServerCertificatesInSpecifiedNamespace(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestRun_FailsWithExpiredCA(t *testing.T) {
+	ui := cli.NewMockUi()
+	cmd := Command{UI: ui}
+	cmd.clientset = fake.NewSimpleClientset()
+
+	ca := writeTempFile(t, caCertRSAExpired)
+	key := writeTempFile(t, caKeyRSA)
+
+	exitCode := cmd.Run([]string{"-name-prefix", "consul", "-ca", ca, "-key", key})
+	require.Equal(t, 1, exitCode)
+}
+
+func TestRun_CreatesServerCertificatesWithKeyAlgorithm(t *testing.T) {
+	ui := cli.NewMockUi()
+	cmd := Command{UI: ui}
+	k8s := fake.NewSimpleClientset()
+	cmd.clientset = k8s
+
+	exitCode := cmd.Run([]string{"-name-prefix", "consul", "-key-algorithm", "rsa-2048"})
+	require.Equal(t, 0, exitCode, ui.ErrorWriter.String())
+
+	caCertSecret, err := k8s.CoreV1().Secrets("default").Get(context.Background(), "consul-ca-cert", metav1.GetOptions{})
+	require.NoError(t, err)
+	caCertificate, err := cert.ParseCert(caCertSecret.Data[corev1.TLSCertKey])
+	require.NoError(t, err)
+	require.Equal(t, x509.RSA, caCertificate.PublicKeyAlgorithm)
+
+	serverCertSecret, err := k8s.CoreV1().Secrets("default").Get(context.Background(), "consul-server-cert", metav1.GetOptions{})
+	require.NoError(t, err)
+	certificate, err := cert.ParseCert(serverCertSecret.Data[corev1.TLSCertKey])
+	require.NoError(t, err)
+	require.Equal(t, x509.RSA, certificate.PublicKeyAlgorithm)
+	require.NoError(t, certificate.CheckSignatureFrom(caCertificate))
+
+	keyBlock, _ := pem.Decode(serverCertSecret.Data[corev1.TLSPrivateKeyKey])
+	privateKey, err := x509.ParsePKCS1PrivateKey(keyBlock.Bytes)
+	require.NoError(t, err)
+	require.Equal(t, 2048, privateKey.N.BitLen())
+}
+
+// Test that the server certificate issued by an intermediate CA is served
+// with the intermediate so that it can be verified by clients trusting the
+// root, and that names the intermediate doesn't permit aren't added.
+func TestRun_CreatesServerCertificatesWithIntermediateCA(t *testing.T) {
+	rootSigner, _, rootPEM, _, err := cert.GenerateCA("Root CA")
+	require.NoError(t, err)
+	root, err := cert.ParseCert([]byte(rootPEM))
+	require.NoError(t, err)
+	intermediatePEM, intermediateKeyPEM := test.GenerateIntermediateCA(t, root, rootSigner, []string{"consul", "svc"})
+	intermediate, err := cert.ParseCert([]byte(intermediatePEM))
+	require.NoError(t, err)
+
+	cases := map[string]struct {
+		ca    string
+		chain string
+	}{
+		"chain in CA file": {
+			ca: intermediatePEM + rootPEM,
+		},
+		"chain in separate file": {
+			ca:    intermediatePEM,
+			chain: rootPEM,
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			ui := cli.NewMockUi()
+			cmd := Command{UI: ui}
+			k8s := fake.NewSimpleClientset()
+			cmd.clientset = k8s
+
+			flags := []string{"-name-prefix", "consul", "-ca", writeTempFile(t, c.ca), "-key", writeTempFile(t, intermediateKeyPEM),
+				"-additional-dnsname", "consul-server.default.svc"}
+			if c.chain != "" {
+				flags = append(flags, "-ca-chain", writeTempFile(t, c.chain))
+			}
+			exitCode := cmd.Run(flags)
+			require.Equal(t, 0, exitCode, ui.ErrorWriter.String())
+
+			serverCertSecret, err := k8s.CoreV1().Secrets("default").Get(context.Background(), "consul-server-cert", metav1.GetOptions{})
+			require.NoError(t, err)
+			certs, err := cert.ParseCerts(serverCertSecret.Data[corev1.TLSCertKey])
+			require.NoError(t, err)
+			require.Len(t, certs, 2)
+			require.True(t, certs[1].Equal(intermediate))
+			require.Equal(t, []string{"consul-server.default.svc", "server.dc1.consul"}, certs[0].DNSNames)
+			// The intermediate only constrains DNS names.
+			require.Equal(t, []net.IP{net.ParseIP("127.0.0.1").To4()}, certs[0].IPAddresses)
+
+			roots := x509.NewCertPool()
+			roots.AddCert(root)
+			intermediates := x509.NewCertPool()
+			intermediates.AddCert(certs[1])
+			_, err = certs[0].Verify(x509.VerifyOptions{DNSName: "server.dc1.consul", Roots: roots, Intermediates: intermediates})
+			require.NoError(t, err)
+		})
+	}
+
+	t.Run("name not permitted", func(t *testing.T) {
+		ui := cli.NewMockUi()
+		cmd := Command{UI: ui}
+		cmd.clientset = fake.NewSimpleClientset()
+
+		exitCode := cmd.Run([]string{"-name-prefix", "consul", "-ca", writeTempFile(t, intermediatePEM), "-key", writeTempFile(t, intermediateKeyPEM),
+			"-additional-dnsname", "consul.example.com"})
+		require.Equal(t, 1, exitCode)
+	})
+}
+
+func writeTempFile(t *testing.T, contents string) string {
+	f, err := os.CreateTemp(t.TempDir(), "")
+	require.NoError(t, err)
+	_, err = f.WriteString(contents)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	return f.Name()
+}
+
 const (
 	caCertEC string = `-----BEGIN CERTIFICATE-----
 MIIDPjCCAuWgAwIBAgIRAOjdIMIYBXgeoXBDydhFImcwCgYIKoZIzj0EAwIwgZEx
@@ -595,6 +724,27 @@ tdsZa0jHMVkDIrNoL8nmxu6X578xNY304w==
 -----END EC PRIVATE KEY-----`
 
 	caCertRSA string = `-----BEGIN CERTIFICATE-----
+MIIDJzCCAg+gAwIBAgIUBWcQ17G0NUfUrnKix1f622Yi/MEwDQYJKoZIhvcNAQEL
+BQAwGjEYMBYGA1UEAwwPQ29uc3VsIEFnZW50IENBMCAXDTI2MTAxOTE1MjEwMVoY
+DzIxMjYwOTI1MTUyMTAxWjAaMRgwFgYDVQQDDA9Db25zdWwgQWdlbnQgQ0EwggEi
+MA0GCSqGSIb3DQEBAQUAA4IBDwAwggEKAoIBAQDFNV3mwUa5U5nGQ+/e0Tr2SFRO
+hVxFvzk1FZZ5YFLKtMThRavTqQbit5JNWsaBHaGiOs/ifNXKe7sSyUIkhNvoN/my
+ffhspUOmpYmAMUmgRihPNqNHEQONKTBq76I+G5onqkH3v4mKY6DQmep7RBVnY22P
+CCldhIaR6+eJXFkdq6svGeEOvLkrIMnv2njxztoo3EDFTazKuEqStY0loKDhZVM5
+z95BTh6VRltPBghn9mLiA6RL6/PRx6CBGZeDkzNhPpwGVxwdGsDsFpJGSgPts1sO
+H6ZFPPrtSA4pSMiL6jVOxSGa87YqejD7MgZ3WZ8B/2oVP7gpc8WHfI3kN4yRAgMB
+AAGjYzBhMB0GA1UdDgQWBBTlGg6v90DgG+RAKjzcTE22FBJ+4zAfBgNVHSMEGDAW
+gBTlGg6v90DgG+RAKjzcTE22FBJ+4zAPBgNVHRMBAf8EBTADAQH/MA4GA1UdDwEB
+/wQEAwIBhjANBgkqhkiG9w0BAQsFAAOCAQEAcYKcqn2Aa0h/L9wH9gn7xXU/fxK6
+RLyYXLYJlGOMKZv1jVUAiAq3tbejDBlrmZjYBW8XP7AjCFTu9WQb+6KzmyaQT9p/
+FVynErEq3SKiJdEqsvIck+JLBQ1/MSbnBOC0bagoky0EWi+h3NHpSlF+GGTY0kZk
+Vp13SB1AAr8tZnN5eC32mEhYcLqVKrIiq5PT0fYHIlosq6bl713pQDSKqUxeoQKV
+Rh+uAqIo8HVqHqyG96+1geX0Keq8c37K66BjilKfVc5q1bg3Kh0BatpCiZCdvG9s
+snHN2mRITFs0Ngm4KaIYgL9vAqWwS76/mu7sXzu+xtek39LoWm3+eCBjpQ==
+-----END CERTIFICATE-----`
+
+	// caCertRSAExpired is a certificate for caKeyRSA that expired in 2021.
+	caCertRSAExpired string = `-----BEGIN CERTIFICATE-----
 MIIDGjCCAgICCQC9IJfDAbKSIjANBgkqhkiG9w0BAQsFADBPMQswCQYDVQQGEwJD
 QTEZMBcGA1UECAwQQnJpdGlzaCBDb2x1bWJpYTERMA8GA1UEBwwIVmFuY292ZXIx
 EjAQBgNVBAoMCUhhc2hpQ29ycDAeFw0yMTExMDQyMjQ0MjJaFw0yMTEyMDQyMjQ0
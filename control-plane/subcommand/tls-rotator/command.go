@@ -0,0 +1,294 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package tlsrotator
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/hashicorp/consul-k8s/control-plane/subcommand"
+	"github.com/hashicorp/consul-k8s/control-plane/subcommand/common"
+	"github.com/hashicorp/consul-k8s/control-plane/subcommand/flags"
+	"github.com/hashicorp/go-hclog"
+	"github.com/mitchellh/cli"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+)
+
+type Command struct {
+	UI        cli.Ui
+	clientset kubernetes.Interface
+
+	flags    *flag.FlagSet
+	k8sFlags *flags.K8SFlags
+
+	// flags that dictate the specifications of the issued certs.
+	flagDays        int
+	flagDomain      string
+	flagDC          string
+	flagDNSNames    flags.AppendSliceValue
+	flagIPAddresses flags.AppendSliceValue
+
+	// flags that dictate specifics for the secret name and namespace
+	// that are read and written by the command.
+	flagK8sNamespace string
+	flagNamePrefix   string
+
+	// flags that dictate when certificates are reissued.
+	flagRenewWithin     time.Duration
+	flagCheckInterval   time.Duration
+	flagCARotationStage string
+	flagOnce            bool
+
+	flagListen string
+
+	// log
+	log          hclog.Logger
+	flagLogLevel string
+	flagLogJSON  bool
+
+	metrics *metrics
+
+	ctx   context.Context
+	sigCh chan os.Signal
+
+	once sync.Once
+	help string
+}
+
+func (c *Command) init() {
+	c.flags = flag.NewFlagSet("", flag.ContinueOnError)
+	c.flags.IntVar(&c.flagDays, "days", 1825, "The number of days the Consul server certificate is valid for when it's issued. Defaults to 5 years.")
+	c.flags.StringVar(&c.flagDomain, "domain", "consul", "Domain of consul cluster. Defaults to consul.")
+	c.flags.StringVar(&c.flagDC, "dc", "dc1", "Datacenter of the Consul cluster. Defaults to dc1.")
+	c.flags.StringVar(&c.flagNamePrefix, "name-prefix", "", "Name prefix for secrets containing the CA, server certificate and private key")
+	c.flags.StringVar(&c.flagK8sNamespace, "k8s-namespace", "default", "Name of Kubernetes namespace where secrets should be created and read from.")
+	c.flags.Var(&c.flagDNSNames, "additional-dnsname", "Additional DNS name to add to the Consul server certificate as Subject Alternative Name. "+
+		"localhost is always included. This flag may be provided multiple times.")
+	c.flags.Var(&c.flagIPAddresses, "additional-ipaddress", "Additional IP address to add to the Consul server certificate as the Subject Alternative Name. "+
+		"127.0.0.1 is always included. This flag may be provided multiple times.")
+	c.flags.DurationVar(&c.flagRenewWithin, "renew-within", 30*24*time.Hour,
+		"Reissue the server certificate when it expires within this duration. Defaults to 30 days.")
+	c.flags.DurationVar(&c.flagCheckInterval, "check-interval", time.Hour,
+		"How often to check the server certificate in addition to when its secret changes. Defaults to 1h.")
+	c.flags.StringVar(&c.flagCARotationStage, "ca-rotation-stage", "",
+		"The stage of a CA rotation. One of \"trust\", \"issue\" or \"finalize\". In the \"trust\" stage, a new CA "+
+			"cross-signed by the current CA is created and both CAs are served in the CA bundle. In the \"issue\" stage, "+
+			"the server certificate is issued by the new CA. In the \"finalize\" stage, the new CA replaces the current CA. "+
+			"Each stage should be rolled out to all agents before moving to the next stage.")
+	c.flags.BoolVar(&c.flagOnce, "once", false,
+		"Check the certificates once and exit instead of running continuously.")
+	c.flags.StringVar(&c.flagListen, "listen", ":8080", "Address to bind the metrics listener to.")
+	c.flags.StringVar(&c.flagLogLevel, "log-level", "info",
+		"Log verbosity level. Supported values (in order of detail) are \"trace\", "+
+			"\"debug\", \"info\", \"warn\", and \"error\".")
+	c.flags.BoolVar(&c.flagLogJSON, "log-json", false,
+		"Enable or disable JSON output format for logging.")
+	c.k8sFlags = &flags.K8SFlags{}
+	flags.Merge(c.flags, c.k8sFlags.Flags())
+	c.help = flags.Usage(help, c.flags)
+
+	// Wait on an interrupt or terminate to exit. This channel must be initialized before
+	// Run() is called so that there are no race conditions where the channel
+	// is not defined.
+	if c.sigCh == nil {
+		c.sigCh = make(chan os.Signal, 1)
+		signal.Notify(c.sigCh, syscall.SIGINT, syscall.SIGTERM)
+	}
+}
+
+func (c *Command) Run(args []string) int {
+	c.once.Do(c.init)
+	if err := c.flags.Parse(args); err != nil {
+		c.UI.Error(fmt.Sprintf("Failed to parse args: %v", err))
+		return 1
+	}
+
+	if len(c.flags.Args()) > 0 {
+		c.UI.Error("Should have no non-flag arguments.")
+		return 1
+	}
+
+	if err := c.validateFlags(); err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	var err error
+	c.log, err = common.Logger(c.flagLogLevel, c.flagLogJSON)
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	if c.clientset == nil {
+		if err := c.configureKubeClient(); err != nil {
+			c.UI.Error(fmt.Sprintf("error configuring kubernetes: %v", err))
+			return 1
+		}
+	}
+
+	var cancel context.CancelFunc
+	c.ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+
+	registry := prometheus.NewRegistry()
+	c.metrics = newMetrics(registry)
+
+	if c.flagOnce {
+		if err := c.reconcile(); err != nil {
+			c.log.Error("error rotating certificates", "err", err)
+			return 1
+		}
+		return 0
+	}
+
+	go func() {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+
+		c.UI.Info(fmt.Sprintf("Listening on %q...", c.flagListen))
+		if err := http.ListenAndServe(c.flagListen, mux); err != nil {
+			c.UI.Error(fmt.Sprintf("Error listening: %s", err))
+		}
+	}()
+
+	go c.watchServerCertSecret()
+
+	// We define a signal handler for OS interrupts, and when an SIGINT or SIGTERM is received,
+	// we gracefully shut down by cancelling the context of the watch.
+	sig := <-c.sigCh
+	c.log.Info(fmt.Sprintf("%s received, shutting down", sig))
+	return 0
+}
+
+// watchServerCertSecret reconciles the certificates every check interval and
+// whenever the server certificate secret changes.
+func (c *Command) watchServerCertSecret() {
+	ticker := time.NewTicker(c.flagCheckInterval)
+	defer ticker.Stop()
+	for {
+		if err := c.reconcile(); err != nil {
+			c.metrics.errors.Inc()
+			c.log.Error("error rotating certificates", "err", err)
+		}
+
+		// Watch from the current version of the secret so that the watch
+		// doesn't start with an event for the existing secret.
+		selector := fields.OneTermEqualSelector("metadata.name", c.serverCertSecretName()).String()
+		var watcher watch.Interface
+		list, err := c.clientset.CoreV1().Secrets(c.flagK8sNamespace).List(c.ctx, metav1.ListOptions{FieldSelector: selector})
+		if err == nil {
+			watcher, err = c.clientset.CoreV1().Secrets(c.flagK8sNamespace).Watch(c.ctx, metav1.ListOptions{
+				FieldSelector:   selector,
+				ResourceVersion: list.ResourceVersion,
+			})
+		}
+		if err != nil {
+			c.log.Error("error watching server certificate secret", "err", err)
+			select {
+			case <-ticker.C:
+				continue
+			case <-c.ctx.Done():
+				return
+			}
+		}
+
+		// Wait for a change to the secret or the next check.
+		select {
+		case _, ok := <-watcher.ResultChan():
+			if ok {
+				c.log.Info("server certificate secret changed")
+			}
+		case <-ticker.C:
+		case <-c.ctx.Done():
+			watcher.Stop()
+			return
+		}
+		watcher.Stop()
+	}
+}
+
+// configureKubeClient initialized the K8s clientset.
+func (c *Command) configureKubeClient() error {
+	config, err := subcommand.K8SConfig(c.k8sFlags.KubeConfig())
+	if err != nil {
+		return fmt.Errorf("error retrieving Kubernetes auth: %s", err)
+	}
+	c.clientset, err = kubernetes.NewForConfig(config)
+	if err != nil {
+		return fmt.Errorf("error initializing Kubernetes client: %s", err)
+	}
+	return nil
+}
+
+func (c *Command) Help() string {
+	c.once.Do(c.init)
+	return c.help
+}
+
+func (c *Command) Synopsis() string {
+	return synopsis
+}
+
+// validateFlags returns an error if an invalid combination of
+// flags are utilized.
+func (c *Command) validateFlags() error {
+	if c.flagNamePrefix == "" {
+		return errors.New("-name-prefix must be set")
+	}
+	if c.flagDays <= 0 {
+		return errors.New("-days must be a positive integer")
+	}
+	if c.flagRenewWithin < 0 {
+		return errors.New("-renew-within must be >= 0")
+	}
+	if c.flagRenewWithin >= c.validity() {
+		return errors.New("-renew-within must be less than -days")
+	}
+	if c.flagCheckInterval <= 0 {
+		return errors.New("-check-interval must be greater than 0")
+	}
+	switch c.flagCARotationStage {
+	case "", caRotationStageTrust, caRotationStageIssue, caRotationStageFinalize:
+	default:
+		return fmt.Errorf("-ca-rotation-stage must be one of %q, %q or %q",
+			caRotationStageTrust, caRotationStageIssue, caRotationStageFinalize)
+	}
+	return nil
+}
+
+// interrupt sends os.Interrupt signal to the command
+// so it can exit gracefully. This function is needed for tests.
+func (c *Command) interrupt() {
+	c.sigCh <- syscall.SIGINT
+}
+
+const synopsis = "Continuously renew the Consul server certificate and rotate the CA."
+const help = `
+Usage: consul-k8s-control-plane tls-rotator [options]
+
+  Watches the Consul server certificate created by tls-init and reissues
+  it from the CA when it is about to expire or its Subject Alternative
+  Names change. The expiry of the certificates is exposed as Prometheus
+  metrics on /metrics.
+
+  The CA can be rotated without downtime in stages with -ca-rotation-stage.
+  First, "trust" adds a new CA cross-signed by the current CA to the CA
+  bundle. Then, "issue" issues the server certificate from the new CA.
+  Finally, "finalize" replaces the current CA with the new CA.
+
+`
@@ -0,0 +1,288 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package tlsrotator
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul-k8s/control-plane/helper/cert"
+	"github.com/mitchellh/cli"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const (
+	namePrefix = "consul"
+	namespace  = "default"
+)
+
+func TestRun_FlagValidation(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		flags  []string
+		expErr string
+	}{
+		{
+			flags:  []string{},
+			expErr: "-name-prefix must be set",
+		},
+		{
+			flags:  []string{"-name-prefix=consul", "-days=0"},
+			expErr: "-days must be a positive integer",
+		},
+		{
+			flags:  []string{"-name-prefix=consul", "-days=30", "-renew-within=720h"},
+			expErr: "-renew-within must be less than -days",
+		},
+		{
+			flags:  []string{"-name-prefix=consul", "-check-interval=0s"},
+			expErr: "-check-interval must be greater than 0",
+		},
+		{
+			flags:  []string{"-name-prefix=consul", "-ca-rotation-stage=foo"},
+			expErr: "-ca-rotation-stage must be one of \"trust\", \"issue\" or \"finalize\"",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.expErr, func(t *testing.T) {
+			ui := cli.NewMockUi()
+			cmd := Command{UI: ui, clientset: fake.NewSimpleClientset()}
+			responseCode := cmd.Run(c.flags)
+			require.Equal(t, 1, responseCode)
+			require.Contains(t, ui.ErrorWriter.String(), c.expErr)
+		})
+	}
+}
+
+func TestRun_CASecretsMissing(t *testing.T) {
+	t.Parallel()
+
+	ui := cli.NewMockUi()
+	cmd := Command{UI: ui, clientset: fake.NewSimpleClientset()}
+	require.Equal(t, 1, cmd.Run([]string{"-name-prefix=" + namePrefix, "-once"}))
+}
+
+func TestRun_IssuesServerCert(t *testing.T) {
+	t.Parallel()
+
+	k8s := fake.NewSimpleClientset()
+	caCert := createCA(t, k8s)
+
+	cmd := runOnce(t, k8s, "-additional-dnsname=consul-server", "-additional-ipaddress=10.0.0.1")
+	serverCert := serverCert(t, k8s)
+	require.NoError(t, serverCert.CheckSignatureFrom(caCert))
+	require.ElementsMatch(t, []string{"consul-server", "server.dc1.consul", "localhost"}, serverCert.DNSNames)
+	require.Len(t, serverCert.IPAddresses, 2)
+	require.Equal(t, float64(1), testutil.ToFloat64(cmd.metrics.renewals.WithLabelValues("consul-server-cert", reasonMissing)))
+	require.Equal(t, float64(serverCert.NotAfter.Unix()), testutil.ToFloat64(cmd.metrics.expiry.WithLabelValues("consul-server-cert", "server")))
+	require.Equal(t, float64(caCert.NotAfter.Unix()), testutil.ToFloat64(cmd.metrics.expiry.WithLabelValues("consul-ca-cert", "ca")))
+
+	// The certificate isn't reissued if nothing changed.
+	runOnce(t, k8s, "-additional-dnsname=consul-server", "-additional-ipaddress=10.0.0.1")
+	require.Equal(t, serverCert.SerialNumber, serverCertSerial(t, k8s))
+}
+
+func TestRun_ReissuesServerCert(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		flags  []string
+		reason string
+	}{
+		"expiring": {
+			flags:  []string{"-days=3", "-renew-within=48h"},
+			reason: reasonExpiring,
+		},
+		"SANs changed": {
+			flags:  []string{"-days=1", "-renew-within=1h", "-additional-dnsname=consul-server"},
+			reason: reasonSANsChanged,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			k8s := fake.NewSimpleClientset()
+			createCA(t, k8s)
+			runOnce(t, k8s, "-days=1", "-renew-within=1h")
+			serial := serverCertSerial(t, k8s)
+
+			cmd := runOnce(t, k8s, c.flags...)
+			require.NotEqual(t, serial, serverCertSerial(t, k8s))
+			require.Equal(t, float64(1), testutil.ToFloat64(cmd.metrics.renewals.WithLabelValues("consul-server-cert", c.reason)))
+		})
+	}
+}
+
+// Test that the CA is rotated in stages and that the server certificate can
+// be verified by clients at every stage.
+func TestRun_CARotation(t *testing.T) {
+	t.Parallel()
+
+	k8s := fake.NewSimpleClientset()
+	oldCA := createCA(t, k8s)
+	runOnce(t, k8s)
+
+	// In the trust stage, the bundle has both CAs and the server
+	// certificate is still issued by the old CA.
+	runOnce(t, k8s, "-ca-rotation-stage=trust")
+	bundle := caBundle(t, k8s)
+	require.Len(t, bundle, 2)
+	require.True(t, bundle[0].Equal(oldCA))
+	newCA := bundle[1]
+	require.NoError(t, serverCert(t, k8s).CheckSignatureFrom(oldCA))
+	requireVerifies(t, k8s, oldCA)
+	requireVerifies(t, k8s, bundle...)
+
+	// The trust stage is idempotent.
+	runOnce(t, k8s, "-ca-rotation-stage=trust")
+	require.Equal(t, bundle, caBundle(t, k8s))
+
+	// In the issue stage, the server certificate is issued by the new CA
+	// and chains to the old CA through the cross-signed certificate.
+	cmd := runOnce(t, k8s, "-ca-rotation-stage=issue")
+	require.Equal(t, bundle, caBundle(t, k8s))
+	require.NoError(t, serverCert(t, k8s).CheckSignatureFrom(newCA))
+	requireVerifies(t, k8s, oldCA)
+	requireVerifies(t, k8s, newCA)
+	require.Equal(t, float64(1), testutil.ToFloat64(cmd.metrics.renewals.WithLabelValues("consul-server-cert", reasonCAChanged)))
+	require.Equal(t, float64(newCA.NotAfter.Unix()), testutil.ToFloat64(cmd.metrics.expiry.WithLabelValues("consul-next-ca-cert", "ca")))
+
+	// In the finalize stage, the new CA replaces the old CA.
+	runOnce(t, k8s, "-ca-rotation-stage=finalize")
+	bundle = caBundle(t, k8s)
+	require.Len(t, bundle, 1)
+	require.True(t, bundle[0].Equal(newCA))
+	certs, err := cert.ParseCerts(secret(t, k8s, "consul-server-cert").Data[corev1.TLSCertKey])
+	require.NoError(t, err)
+	require.Len(t, certs, 1, "server certificate should no longer have the cross-signed certificate")
+	requireVerifies(t, k8s, newCA)
+
+	caKey, err := cert.ParseSigner(string(secret(t, k8s, "consul-ca-key").Data[corev1.TLSPrivateKeyKey]))
+	require.NoError(t, err)
+	require.True(t, caKey.Public().(interface{ Equal(crypto.PublicKey) bool }).Equal(newCA.PublicKey))
+	for _, name := range []string{"consul-next-ca-cert", "consul-next-ca-key"} {
+		_, err := k8s.CoreV1().Secrets(namespace).Get(context.Background(), name, metav1.GetOptions{})
+		require.Error(t, err, "secret %s should be deleted", name)
+	}
+}
+
+// Test that the server certificate is issued when running continuously.
+func TestRun_Continuous(t *testing.T) {
+	t.Parallel()
+
+	k8s := fake.NewSimpleClientset()
+	createCA(t, k8s)
+
+	ui := cli.NewMockUi()
+	cmd := Command{UI: ui, clientset: k8s}
+	exitCh := runCommandAsynchronously(&cmd, []string{"-name-prefix=" + namePrefix, "-listen=127.0.0.1:0"})
+	defer stopCommand(t, &cmd, exitCh)
+
+	require.Eventually(t, func() bool {
+		_, err := k8s.CoreV1().Secrets(namespace).Get(context.Background(), "consul-server-cert", metav1.GetOptions{})
+		return err == nil
+	}, 5*time.Second, 50*time.Millisecond)
+}
+
+func runOnce(t *testing.T, k8s kubernetes.Interface, flags ...string) *Command {
+	t.Helper()
+	ui := cli.NewMockUi()
+	cmd := Command{UI: ui, clientset: k8s}
+	responseCode := cmd.Run(append([]string{"-name-prefix=" + namePrefix, "-once"}, flags...))
+	require.Equal(t, 0, responseCode, ui.ErrorWriter.String())
+	return &cmd
+}
+
+func runCommandAsynchronously(cmd *Command, args []string) chan int {
+	exitChan := make(chan int, 1)
+	go func() {
+		exitChan <- cmd.Run(args)
+	}()
+	return exitChan
+}
+
+func stopCommand(t *testing.T, cmd *Command, exitChan chan int) {
+	if len(exitChan) == 0 {
+		cmd.interrupt()
+	}
+	select {
+	case c := <-exitChan:
+		require.Equal(t, 0, c, string(cmd.UI.(*cli.MockUi).ErrorWriter.Bytes()))
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "command did not exit")
+	}
+}
+
+// createCA creates the CA secrets the way tls-init does.
+func createCA(t *testing.T, k8s kubernetes.Interface) *x509.Certificate {
+	_, keyPEM, certPEM, _, err := cert.GenerateCA("Consul Agent CA")
+	require.NoError(t, err)
+	for name, data := range map[string]map[string][]byte{
+		"consul-ca-cert": {corev1.TLSCertKey: []byte(certPEM)},
+		"consul-ca-key":  {corev1.TLSPrivateKeyKey: []byte(keyPEM)},
+	} {
+		_, err := k8s.CoreV1().Secrets(namespace).Create(context.Background(), &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Data:       data,
+		}, metav1.CreateOptions{})
+		require.NoError(t, err)
+	}
+	caCert, err := cert.ParseCert([]byte(certPEM))
+	require.NoError(t, err)
+	return caCert
+}
+
+func secret(t *testing.T, k8s kubernetes.Interface, name string) *corev1.Secret {
+	s, err := k8s.CoreV1().Secrets(namespace).Get(context.Background(), name, metav1.GetOptions{})
+	require.NoError(t, err)
+	return s
+}
+
+func caBundle(t *testing.T, k8s kubernetes.Interface) []*x509.Certificate {
+	certs, err := cert.ParseCerts(secret(t, k8s, "consul-ca-cert").Data[corev1.TLSCertKey])
+	require.NoError(t, err)
+	return certs
+}
+
+func serverCert(t *testing.T, k8s kubernetes.Interface) *x509.Certificate {
+	c, err := cert.ParseCert(secret(t, k8s, "consul-server-cert").Data[corev1.TLSCertKey])
+	require.NoError(t, err)
+	return c
+}
+
+func serverCertSerial(t *testing.T, k8s kubernetes.Interface) *big.Int {
+	return serverCert(t, k8s).SerialNumber
+}
+
+// requireVerifies checks that a client trusting roots can verify the server
+// certificate chain served from the server certificate secret.
+func requireVerifies(t *testing.T, k8s kubernetes.Interface, roots ...*x509.Certificate) {
+	t.Helper()
+	certs, err := cert.ParseCerts(secret(t, k8s, "consul-server-cert").Data[corev1.TLSCertKey])
+	require.NoError(t, err)
+	rootPool := x509.NewCertPool()
+	for _, r := range roots {
+		rootPool.AddCert(r)
+	}
+	intermediates := x509.NewCertPool()
+	for _, c := range certs[1:] {
+		intermediates.AddCert(c)
+	}
+	_, err = certs[0].Verify(x509.VerifyOptions{
+		DNSName:       "server.dc1.consul",
+		Roots:         rootPool,
+		Intermediates: intermediates,
+	})
+	require.NoError(t, err)
+}
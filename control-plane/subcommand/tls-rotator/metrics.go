@@ -0,0 +1,45 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package tlsrotator
+
+import (
+	"crypto/x509"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type metrics struct {
+	expiry   *prometheus.GaugeVec
+	renewals *prometheus.CounterVec
+	errors   prometheus.Counter
+}
+
+func newMetrics(registry prometheus.Registerer) *metrics {
+	m := &metrics{
+		expiry: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "consul_tls_certificate_expiry_timestamp_seconds",
+			Help: "Unix time when the certificate expires.",
+		}, []string{"secret", "type"}),
+		renewals: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "consul_tls_certificate_renewals_total",
+			Help: "Number of times the certificate was issued, by reason.",
+		}, []string{"secret", "reason"}),
+		errors: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "consul_tls_rotation_errors_total",
+			Help: "Number of certificate checks that failed.",
+		}),
+	}
+	registry.MustRegister(m.expiry, m.renewals, m.errors)
+	return m
+}
+
+// observe records the expiry of the certificate stored in the secret.
+func (m *metrics) observe(secret, certType string, cert *x509.Certificate) {
+	m.expiry.WithLabelValues(secret, certType).Set(float64(cert.NotAfter.Unix()))
+}
+
+// forget removes the expiry of a certificate that no longer exists.
+func (m *metrics) forget(secret, certType string) {
+	m.expiry.DeleteLabelValues(secret, certType)
+}
@@ -0,0 +1,452 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package tlsrotator
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/consul-k8s/control-plane/helper/cert"
+	"github.com/hashicorp/consul-k8s/control-plane/subcommand/common"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	caRotationStageTrust    = "trust"
+	caRotationStageIssue    = "issue"
+	caRotationStageFinalize = "finalize"
+)
+
+// crossSignedCertKey is the key in the next CA certificate secret with the
+// next CA certificate cross-signed by the current CA.
+const crossSignedCertKey = "cross-signed.crt"
+
+// Reasons the server certificate is issued.
+const (
+	reasonMissing      = "missing"
+	reasonInvalid      = "invalid"
+	reasonExpiring     = "expiring"
+	reasonCAChanged    = "ca-changed"
+	reasonSANsChanged  = "sans-changed"
+	reasonChainChanged = "chain-changed"
+)
+
+// ca is a CA certificate and its private key.
+type ca struct {
+	cert    *x509.Certificate
+	certPEM string
+	keyPEM  string
+	signer  crypto.Signer
+	// chain is the certificates that issued an intermediate CA, from the
+	// issuer of the CA to the root.
+	chain []*x509.Certificate
+	// crossSignedPEM is the CA certificate signed by the current CA. It's
+	// only set for the next CA during a CA rotation.
+	crossSignedPEM string
+}
+
+// reconcile brings the CA bundle and server certificate in line with the
+// CA rotation stage and flags, and reissues the server certificate if it's
+// about to expire.
+func (c *Command) reconcile() error {
+	if c.flagCARotationStage == caRotationStageFinalize {
+		if err := c.promoteNextCA(); err != nil {
+			return err
+		}
+	}
+
+	current, err := c.readCA(c.caCertSecretName(), c.caKeySecretName())
+	if err != nil {
+		return err
+	}
+	if current == nil {
+		return fmt.Errorf("CA secrets %q and %q not found", c.caCertSecretName(), c.caKeySecretName())
+	}
+
+	var next *ca
+	if c.flagCARotationStage == caRotationStageTrust || c.flagCARotationStage == caRotationStageIssue {
+		next, err = c.ensureNextCA(current)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Both CAs are trusted while the CA is rotated. The chain of an
+	// intermediate CA is kept in the bundle and served with the server
+	// certificate.
+	signing := current
+	bundle := current.certPEM
+	for _, chainCert := range current.chain {
+		bundle += encodeCert(chainCert)
+	}
+	chain := cert.IntermediatesPEM(current.cert, current.chain)
+	if next != nil {
+		bundle += next.certPEM
+		if c.flagCARotationStage == caRotationStageIssue {
+			signing = next
+			chain = next.crossSignedPEM + chain
+		}
+	}
+	if err := c.writeCABundle(bundle); err != nil {
+		return err
+	}
+
+	serverCert, err := c.issueServerCert(signing, chain)
+	if err != nil {
+		return err
+	}
+
+	c.metrics.observe(c.caCertSecretName(), "ca", current.cert)
+	if next != nil {
+		c.metrics.observe(c.nextCACertSecretName(), "ca", next.cert)
+	} else {
+		c.metrics.forget(c.nextCACertSecretName(), "ca")
+	}
+	c.metrics.observe(c.serverCertSecretName(), "server", serverCert)
+	return nil
+}
+
+// readCA reads the CA from the certificate and key secrets. The CA
+// certificate is the first certificate in the certificate secret, optionally
+// followed by its chain. It returns nil if either secret doesn't exist.
+func (c *Command) readCA(certSecretName, keySecretName string) (*ca, error) {
+	certSecret, err := c.getSecret(certSecretName)
+	if err != nil || certSecret == nil {
+		return nil, err
+	}
+	keySecret, err := c.getSecret(keySecretName)
+	if err != nil || keySecret == nil {
+		return nil, err
+	}
+
+	certs, err := cert.ParseCerts(certSecret.Data[corev1.TLSCertKey])
+	if err != nil {
+		return nil, fmt.Errorf("error parsing CA certificate from secret %q: %w", certSecretName, err)
+	}
+	keyPEM := string(keySecret.Data[corev1.TLSPrivateKeyKey])
+	signer, err := cert.ParseSigner(keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing CA private key from secret %q: %w", keySecretName, err)
+	}
+	return &ca{
+		cert:           certs[0],
+		certPEM:        encodeCert(certs[0]),
+		keyPEM:         keyPEM,
+		signer:         signer,
+		chain:          cert.BuildChain(certs[0], certs[1:]),
+		crossSignedPEM: string(certSecret.Data[crossSignedCertKey]),
+	}, nil
+}
+
+// ensureNextCA returns the CA that will replace the current CA, creating it
+// and cross-signing it with the current CA if it doesn't exist yet.
+func (c *Command) ensureNextCA(current *ca) (*ca, error) {
+	next, err := c.readCA(c.nextCACertSecretName(), c.nextCAKeySecretName())
+	if err != nil || next != nil {
+		return next, err
+	}
+
+	c.log.Info("generating new CA certificate and key for CA rotation")
+	signer, keyPEM, certPEM, _, err := cert.GenerateCA("Consul Agent CA")
+	if err != nil {
+		return nil, fmt.Errorf("error generating CA certificate and private key: %w", err)
+	}
+	nextCert, err := cert.ParseCert([]byte(certPEM))
+	if err != nil {
+		return nil, err
+	}
+	crossSignedPEM, err := cert.CrossSign(nextCert, current.cert, current.signer)
+	if err != nil {
+		return nil, fmt.Errorf("error cross-signing new CA certificate: %w", err)
+	}
+
+	// Write the key first so that a new key is generated if writing the
+	// certificate fails.
+	err = c.writeSecret(c.nextCAKeySecretName(), corev1.SecretTypeOpaque, map[string][]byte{
+		corev1.TLSPrivateKeyKey: []byte(keyPEM),
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = c.writeSecret(c.nextCACertSecretName(), corev1.SecretTypeOpaque, map[string][]byte{
+		corev1.TLSCertKey:  []byte(certPEM),
+		crossSignedCertKey: []byte(crossSignedPEM),
+	})
+	if err != nil {
+		return nil, err
+	}
+	c.log.Info("saved new CA certificate and private key", "secret", c.nextCACertSecretName())
+	return &ca{
+		cert:           nextCert,
+		certPEM:        certPEM,
+		keyPEM:         keyPEM,
+		signer:         signer,
+		crossSignedPEM: crossSignedPEM,
+	}, nil
+}
+
+// promoteNextCA replaces the current CA with the next CA, if there is one,
+// and deletes the next CA secrets.
+func (c *Command) promoteNextCA() error {
+	next, err := c.readCA(c.nextCACertSecretName(), c.nextCAKeySecretName())
+	if err != nil || next == nil {
+		return err
+	}
+
+	c.log.Info("replacing CA with new CA")
+	err = c.writeSecret(c.caKeySecretName(), corev1.SecretTypeOpaque, map[string][]byte{
+		corev1.TLSPrivateKeyKey: []byte(next.keyPEM),
+	})
+	if err != nil {
+		return err
+	}
+	err = c.writeSecret(c.caCertSecretName(), corev1.SecretTypeOpaque, map[string][]byte{
+		corev1.TLSCertKey: []byte(next.certPEM),
+	})
+	if err != nil {
+		return err
+	}
+
+	// The next CA secrets are deleted last so that an interrupted
+	// promotion is completed by the next reconcile.
+	for _, name := range []string{c.nextCACertSecretName(), c.nextCAKeySecretName()} {
+		err := c.clientset.CoreV1().Secrets(c.flagK8sNamespace).Delete(c.ctx, name, metav1.DeleteOptions{})
+		if err != nil && !k8serrors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeCABundle writes the bundle of trusted CA certificates to the CA
+// certificate secret. The current CA certificate is always first.
+func (c *Command) writeCABundle(bundle string) error {
+	secret, err := c.getSecret(c.caCertSecretName())
+	if err != nil {
+		return err
+	}
+	if secret == nil {
+		return fmt.Errorf("CA secret %q not found", c.caCertSecretName())
+	}
+	if string(secret.Data[corev1.TLSCertKey]) == bundle {
+		return nil
+	}
+	c.log.Info("updating CA bundle", "secret", c.caCertSecretName())
+	secret.Data[corev1.TLSCertKey] = []byte(bundle)
+	_, err = c.clientset.CoreV1().Secrets(c.flagK8sNamespace).Update(c.ctx, secret, metav1.UpdateOptions{})
+	return err
+}
+
+// issueServerCert issues the server certificate from the signing CA if
+// needed and returns the server certificate. The chain is appended to the
+// server certificate so clients that only trust the current CA can verify
+// a certificate issued by the next CA.
+func (c *Command) issueServerCert(signing *ca, chain string) (*x509.Certificate, error) {
+	secret, err := c.getSecret(c.serverCertSecretName())
+	if err != nil {
+		return nil, err
+	}
+	var existing []byte
+	if secret != nil {
+		existing = secret.Data[corev1.TLSCertKey]
+	}
+	hosts := c.hosts()
+	reason, serverCert := c.reissueReason(existing, signing, chain, hosts)
+	if reason == "" {
+		return serverCert, nil
+	}
+
+	c.log.Info("issuing server certificate", "reason", reason, "secret", c.serverCertSecretName())
+	certPEM, keyPEM, err := cert.GenerateCert(fmt.Sprintf("server.%s.%s", c.flagDC, c.flagDomain), c.validity(), signing.cert, signing.signer, hosts)
+	if err != nil {
+		return nil, fmt.Errorf("error generating server certificate and private key: %w", err)
+	}
+	err = c.writeSecret(c.serverCertSecretName(), corev1.SecretTypeTLS, map[string][]byte{
+		corev1.TLSCertKey:       []byte(certPEM + chain),
+		corev1.TLSPrivateKeyKey: []byte(keyPEM),
+	})
+	if err != nil {
+		return nil, err
+	}
+	c.metrics.renewals.WithLabelValues(c.serverCertSecretName(), reason).Inc()
+	return cert.ParseCert([]byte(certPEM))
+}
+
+// reissueReason returns why the server certificate in existing needs to be
+// issued, or an empty string if it doesn't, along with the parsed
+// certificate.
+func (c *Command) reissueReason(existing []byte, signing *ca, chain string, hosts []string) (string, *x509.Certificate) {
+	if len(existing) == 0 {
+		return reasonMissing, nil
+	}
+	block, rest := pem.Decode(existing)
+	if block == nil {
+		return reasonInvalid, nil
+	}
+	serverCert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return reasonInvalid, nil
+	}
+	if time.Until(serverCert.NotAfter) < c.flagRenewWithin {
+		return reasonExpiring, serverCert
+	}
+	if err := serverCert.CheckSignatureFrom(signing.cert); err != nil {
+		return reasonCAChanged, serverCert
+	}
+	if !sameSANs(serverCert, hosts) {
+		return reasonSANsChanged, serverCert
+	}
+	if !bytes.Equal(bytes.TrimSpace(rest), bytes.TrimSpace([]byte(chain))) {
+		return reasonChainChanged, serverCert
+	}
+	return "", serverCert
+}
+
+// hosts returns the Subject Alternative Names of the server certificate.
+func (c *Command) hosts() []string {
+	var hosts []string
+	for _, d := range c.flagDNSNames {
+		if len(d) > 0 {
+			hosts = append(hosts, strings.TrimSpace(d))
+		}
+	}
+	for _, i := range c.flagIPAddresses {
+		if len(i) > 0 {
+			hosts = append(hosts, strings.TrimSpace(i))
+		}
+	}
+	return append(hosts, fmt.Sprintf("server.%s.%s", c.flagDC, c.flagDomain), "localhost", "127.0.0.1")
+}
+
+// sameSANs returns whether the certificate has exactly the hosts as
+// Subject Alternative Names.
+func sameSANs(c *x509.Certificate, hosts []string) bool {
+	var dnsNames, ips []string
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			ips = append(ips, ip.String())
+		} else {
+			dnsNames = append(dnsNames, h)
+		}
+	}
+	var certIPs []string
+	for _, ip := range c.IPAddresses {
+		certIPs = append(certIPs, ip.String())
+	}
+	return sameSet(dnsNames, c.DNSNames) && sameSet(ips, certIPs)
+}
+
+func sameSet(a, b []string) bool {
+	a = dedupe(a)
+	b = dedupe(b)
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// dedupe returns the sorted unique values of s.
+func dedupe(s []string) []string {
+	seen := make(map[string]struct{}, len(s))
+	var out []string
+	for _, v := range s {
+		if _, ok := seen[v]; !ok {
+			seen[v] = struct{}{}
+			out = append(out, v)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// getSecret returns the secret or nil if it doesn't exist.
+func (c *Command) getSecret(name string) (*corev1.Secret, error) {
+	secret, err := c.clientset.CoreV1().Secrets(c.flagK8sNamespace).Get(c.ctx, name, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading secret %q from kubernetes: %w", name, err)
+	}
+	if secret.Data == nil {
+		secret.Data = make(map[string][]byte)
+	}
+	return secret, nil
+}
+
+// writeSecret creates the secret or replaces its data if it exists.
+func (c *Command) writeSecret(name string, secretType corev1.SecretType, data map[string][]byte) error {
+	secret, err := c.getSecret(name)
+	if err != nil {
+		return err
+	}
+	if secret == nil {
+		_, err = c.clientset.CoreV1().Secrets(c.flagK8sNamespace).Create(c.ctx, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: c.flagK8sNamespace,
+				Labels:    map[string]string{common.CLILabelKey: common.CLILabelValue},
+			},
+			Data: data,
+			Type: secretType,
+		}, metav1.CreateOptions{})
+		if err != nil {
+			return fmt.Errorf("error creating secret %q in kubernetes: %w", name, err)
+		}
+		return nil
+	}
+
+	secret.Data = data
+	if secret.Labels == nil {
+		secret.Labels = make(map[string]string)
+	}
+	secret.Labels[common.CLILabelKey] = common.CLILabelValue
+	if _, err := c.clientset.CoreV1().Secrets(c.flagK8sNamespace).Update(c.ctx, secret, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("error updating secret %q in kubernetes: %w", name, err)
+	}
+	return nil
+}
+
+func encodeCert(c *x509.Certificate) string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Raw}))
+}
+
+// validity returns how long issued server certificates are valid for.
+func (c *Command) validity() time.Duration {
+	return time.Duration(c.flagDays) * 24 * time.Hour
+}
+
+func (c *Command) caCertSecretName() string {
+	return fmt.Sprintf("%s-ca-cert", c.flagNamePrefix)
+}
+
+func (c *Command) caKeySecretName() string {
+	return fmt.Sprintf("%s-ca-key", c.flagNamePrefix)
+}
+
+func (c *Command) nextCACertSecretName() string {
+	return fmt.Sprintf("%s-next-ca-cert", c.flagNamePrefix)
+}
+
+func (c *Command) nextCAKeySecretName() string {
+	return fmt.Sprintf("%s-next-ca-key", c.flagNamePrefix)
+}
+
+func (c *Command) serverCertSecretName() string {
+	return fmt.Sprintf("%s-server-cert", c.flagNamePrefix)
+}
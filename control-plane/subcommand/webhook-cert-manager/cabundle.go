@@ -0,0 +1,143 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package webhookcertmanager
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/hashicorp/consul-k8s/control-plane/helper/cert"
+	mutatingwebhookconfiguration "github.com/hashicorp/consul-k8s/control-plane/helper/mutating-webhook-configuration"
+	apiextclientset "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	kindMutatingWebhookConfiguration   = "MutatingWebhookConfiguration"
+	kindValidatingWebhookConfiguration = "ValidatingWebhookConfiguration"
+)
+
+type jsonPatch struct {
+	Op    string `json:"op,omitempty"`
+	Path  string `json:"path,omitempty"`
+	Value []byte `json:"value,omitempty"`
+}
+
+// updateCABundles updates the caBundle of every webhook on the webhook
+// configuration in the bundle and of the conversion webhooks of its CRDs.
+func (c *Command) updateCABundles(ctx context.Context, clientset kubernetes.Interface, bundle cert.MetaBundle) error {
+	var err error
+	if bundle.WebhookConfigKind == kindValidatingWebhookConfiguration {
+		err = updateValidatingWebhookCABundle(ctx, clientset, bundle.WebhookConfigName, bundle.CACert)
+	} else {
+		err = mutatingwebhookconfiguration.UpdateWithCABundle(ctx, clientset, bundle.WebhookConfigName, bundle.CACert)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, name := range bundle.ConversionCRDNames {
+		if err := updateConversionCABundle(ctx, c.apiextClientset, name, bundle.CACert); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateValidatingWebhookCABundle iterates over every webhook on the specified
+// validating webhook configuration and updates their caBundle with the
+// specified CA.
+func updateValidatingWebhookCABundle(ctx context.Context, clientset kubernetes.Interface, webhookConfigName string, caCert []byte) error {
+	if len(caCert) == 0 {
+		return errors.New("no CA certificate in the bundle")
+	}
+	webhookCfg, err := clientset.AdmissionregistrationV1().ValidatingWebhookConfigurations().Get(ctx, webhookConfigName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	var patches []jsonPatch
+	for i := range webhookCfg.Webhooks {
+		patches = append(patches, jsonPatch{
+			Op:    "add",
+			Path:  fmt.Sprintf("/webhooks/%d/clientConfig/caBundle", i),
+			Value: caCert,
+		})
+	}
+	patchesJSON, err := json.Marshal(patches)
+	if err != nil {
+		return err
+	}
+
+	_, err = clientset.AdmissionregistrationV1().ValidatingWebhookConfigurations().Patch(ctx, webhookConfigName, types.JSONPatchType, patchesJSON, metav1.PatchOptions{})
+	return err
+}
+
+// updateConversionCABundle updates the caBundle of the conversion webhook of
+// the specified CustomResourceDefinition with the specified CA.
+func updateConversionCABundle(ctx context.Context, clientset apiextclientset.Interface, crdName string, caCert []byte) error {
+	if len(caCert) == 0 {
+		return errors.New("no CA certificate in the bundle")
+	}
+	if clientset == nil {
+		return errors.New("no Kubernetes API extensions client")
+	}
+	crd, err := clientset.ApiextensionsV1().CustomResourceDefinitions().Get(ctx, crdName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if crd.Spec.Conversion == nil || crd.Spec.Conversion.Webhook == nil || crd.Spec.Conversion.Webhook.ClientConfig == nil {
+		return fmt.Errorf("CustomResourceDefinition %q does not have a conversion webhook", crdName)
+	}
+
+	patchesJSON, err := json.Marshal([]jsonPatch{{
+		Op:    "add",
+		Path:  "/spec/conversion/webhook/clientConfig/caBundle",
+		Value: caCert,
+	}})
+	if err != nil {
+		return err
+	}
+
+	_, err = clientset.ApiextensionsV1().CustomResourceDefinitions().Patch(ctx, crdName, types.JSONPatchType, patchesJSON, metav1.PatchOptions{})
+	return err
+}
+
+// caBundlesUpdated verifies if every caBundle on the webhook configuration and
+// conversion webhooks in the bundle matches the desired CA certificate.
+// It returns true if the CA is up-to date and false if it needs to be updated.
+func (c *Command) caBundlesUpdated(ctx context.Context, bundle cert.MetaBundle, clientset kubernetes.Interface) bool {
+	if bundle.WebhookConfigKind == kindValidatingWebhookConfiguration {
+		webhookCfg, err := clientset.AdmissionregistrationV1().ValidatingWebhookConfigurations().Get(ctx, bundle.WebhookConfigName, metav1.GetOptions{})
+		if err != nil {
+			return false
+		}
+		for _, webhook := range webhookCfg.Webhooks {
+			if !bytes.Equal(webhook.ClientConfig.CABundle, bundle.CACert) {
+				return false
+			}
+		}
+	} else if !c.webhookUpdated(ctx, bundle, clientset) {
+		return false
+	}
+
+	for _, name := range bundle.ConversionCRDNames {
+		if c.apiextClientset == nil {
+			return false
+		}
+		crd, err := c.apiextClientset.ApiextensionsV1().CustomResourceDefinitions().Get(ctx, name, metav1.GetOptions{})
+		if err != nil || crd.Spec.Conversion == nil || crd.Spec.Conversion.Webhook == nil || crd.Spec.Conversion.Webhook.ClientConfig == nil {
+			return false
+		}
+		if !bytes.Equal(crd.Spec.Conversion.Webhook.ClientConfig.CABundle, bundle.CACert) {
+			return false
+		}
+	}
+	return true
+}
@@ -18,7 +18,6 @@ import (
 	"time"
 
 	"github.com/hashicorp/consul-k8s/control-plane/helper/cert"
-	mutatingwebhookconfiguration "github.com/hashicorp/consul-k8s/control-plane/helper/mutating-webhook-configuration"
 	"github.com/hashicorp/consul-k8s/control-plane/subcommand"
 	"github.com/hashicorp/consul-k8s/control-plane/subcommand/common"
 	"github.com/hashicorp/consul-k8s/control-plane/subcommand/flags"
@@ -26,6 +25,7 @@ import (
 	"github.com/hashicorp/go-multierror"
 	"github.com/mitchellh/cli"
 	corev1 "k8s.io/api/core/v1"
+	apiextclientset "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
@@ -49,7 +49,8 @@ type Command struct {
 	flagDeploymentName      string
 	flagDeploymentNamespace string
 
-	clientset kubernetes.Interface
+	clientset       kubernetes.Interface
+	apiextClientset apiextclientset.Interface
 
 	once   sync.Once
 	help   string
@@ -57,7 +58,7 @@ type Command struct {
 	logger hclog.Logger
 
 	certExpiry *time.Duration // override default cert expiry of 24 hours if set (only set in tests)
-	source     cert.Source    // override default cert source of cert.GenSource if set (only in tests)
+	source     cert.Source    // override the cert source from the config file if set (only in tests)
 }
 
 func (c *Command) init() {
@@ -125,6 +126,11 @@ func (c *Command) Run(args []string) int {
 			c.UI.Error(fmt.Sprintf("Error initializing Kubernetes client: %s", err))
 			return 1
 		}
+		c.apiextClientset, err = apiextclientset.NewForConfig(config)
+		if err != nil {
+			c.UI.Error(fmt.Sprintf("Error initializing Kubernetes API extensions client: %s", err))
+			return 1
+		}
 	}
 
 	if c.logger == nil {
@@ -167,20 +173,26 @@ func (c *Command) Run(args []string) int {
 	} else {
 		expiry = defaultCertExpiry
 	}
-	var certSource cert.Source
-	for _, config := range configs {
-		if c.source != nil {
-			certSource = c.source
-		} else {
-			certSource = &cert.GenSource{
-				Name:   "Consul Webhook Certificates",
-				Hosts:  config.TLSAutoHosts,
-				Expiry: expiry,
+	for i, config := range configs {
+		certSource := c.source
+		if certSource == nil {
+			certSource, err = c.certSource(config, expiry)
+			if err != nil {
+				c.UI.Error(fmt.Sprintf("Error creating certificate source for config at index %d: %s", i, err))
+				return 1
 			}
 		}
 
 		certCh := make(chan cert.MetaBundle)
-		certNotify := &cert.Notify{Source: certSource, Ch: certCh, WebhookConfigName: config.Name, SecretName: config.SecretName, SecretNamespace: config.SecretNamespace}
+		certNotify := &cert.Notify{
+			Source:             certSource,
+			Ch:                 certCh,
+			WebhookConfigName:  config.Name,
+			WebhookConfigKind:  config.Kind,
+			ConversionCRDNames: config.ConversionCRDs,
+			SecretName:         config.SecretName,
+			SecretNamespace:    config.SecretNamespace,
+		}
 		notifiers = append(notifiers, certNotify)
 		go certNotify.Start(ctx)
 		go c.certWatcher(ctx, certCh, c.clientset, c.logger)
@@ -199,7 +211,7 @@ func (c *Command) Run(args []string) int {
 }
 
 // certWatcher listens for a new MetaBundle on the ch channel for all webhooks and updates
-// MutatingWebhooksConfigs and Secrets when a new Bundle is available on the channel.
+// webhook configurations, CRD conversion webhooks and Secrets when a new Bundle is available on the channel.
 func (c *Command) certWatcher(ctx context.Context, ch <-chan cert.MetaBundle, clientset kubernetes.Interface, log hclog.Logger) {
 	var bundle cert.MetaBundle
 	for {
@@ -227,10 +239,10 @@ func (c *Command) certWatcher(ctx context.Context, ch <-chan cert.MetaBundle, cl
 }
 
 // reconcileCertificates ensures the secret in the MetaBundle has the latest certificate from the MetaBundle and the caBundles on the
-// MutatingWebhookConfiguration have the latest CA certificate from the MetaBundle. It updates them if they are outdated and exits early
-// if they are up-to date.
+// webhook configuration and CRD conversion webhooks have the latest CA certificate from the MetaBundle. It updates them if they are
+// outdated and exits early if they are up-to date.
 func (c *Command) reconcileCertificates(ctx context.Context, clientset kubernetes.Interface, bundle cert.MetaBundle, log hclog.Logger) error {
-	iterLog := log.With("mutatingwebhookconfig", bundle.WebhookConfigName, "secret", bundle.SecretName, "secretNS", bundle.SecretNamespace)
+	iterLog := log.With("webhookconfig", bundle.WebhookConfigName, "secret", bundle.SecretName, "secretNS", bundle.SecretNamespace)
 
 	deployment, err := clientset.AppsV1().Deployments(c.flagDeploymentNamespace).Get(ctx, c.flagDeploymentName, metav1.GetOptions{})
 	if err != nil {
@@ -266,7 +278,7 @@ func (c *Command) reconcileCertificates(ctx context.Context, clientset kubernete
 		}
 
 		iterLog.Info("Updating webhook configuration")
-		err = mutatingwebhookconfiguration.UpdateWithCABundle(ctx, c.clientset, bundle.WebhookConfigName, bundle.CACert)
+		err = c.updateCABundles(ctx, clientset, bundle)
 		if err != nil {
 			iterLog.Error("Error updating webhook configuration")
 			return err
@@ -278,7 +290,7 @@ func (c *Command) reconcileCertificates(ctx context.Context, clientset kubernete
 	}
 
 	// Don't update secret if the certificate and key are unchanged.
-	if bytes.Equal(certSecret.Data[corev1.TLSCertKey], bundle.Cert) && bytes.Equal(certSecret.Data[corev1.TLSPrivateKeyKey], bundle.Key) && c.webhookUpdated(ctx, bundle, clientset) {
+	if bytes.Equal(certSecret.Data[corev1.TLSCertKey], bundle.Cert) && bytes.Equal(certSecret.Data[corev1.TLSPrivateKeyKey], bundle.Key) && c.caBundlesUpdated(ctx, bundle, clientset) {
 		return nil
 	}
 
@@ -309,7 +321,7 @@ func (c *Command) reconcileCertificates(ctx context.Context, clientset kubernete
 	}
 
 	iterLog.Info("Updating webhook configuration with new CA")
-	err = mutatingwebhookconfiguration.UpdateWithCABundle(ctx, clientset, bundle.WebhookConfigName, bundle.CACert)
+	err = c.updateCABundles(ctx, clientset, bundle)
 	if err != nil {
 		iterLog.Error("Error updating webhook configuration", "err", err)
 		return err
@@ -317,7 +329,7 @@ func (c *Command) reconcileCertificates(ctx context.Context, clientset kubernete
 	return nil
 }
 
-// webhookUpdated verifies if every caBundle on the specified webhook configuration matches the desired CA certificate.
+// webhookUpdated verifies if every caBundle on the specified mutating webhook configuration matches the desired CA certificate.
 // It returns true if the CA is up-to date and false if it needs to be updated.
 func (c *Command) webhookUpdated(ctx context.Context, bundle cert.MetaBundle, clientset kubernetes.Interface) bool {
 	webhookCfg, err := clientset.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, bundle.WebhookConfigName, metav1.GetOptions{})
@@ -333,10 +345,18 @@ func (c *Command) webhookUpdated(ctx context.Context, bundle cert.MetaBundle, cl
 }
 
 type webhookConfig struct {
-	Name            string   `json:"name,omitempty"`
-	TLSAutoHosts    []string `json:"tlsAutoHosts,omitempty"`
-	SecretName      string   `json:"secretName,omitempty"`
-	SecretNamespace string   `json:"secretNamespace,omitempty"`
+	Name string `json:"name,omitempty"`
+	// Kind is the kind of the webhook configuration named Name, either
+	// MutatingWebhookConfiguration or ValidatingWebhookConfiguration.
+	// Defaults to MutatingWebhookConfiguration.
+	Kind string `json:"kind,omitempty"`
+	// ConversionCRDs are the names of CustomResourceDefinitions whose
+	// conversion webhooks are served with the same certificate.
+	ConversionCRDs  []string      `json:"conversionCRDs,omitempty"`
+	TLSAutoHosts    []string      `json:"tlsAutoHosts,omitempty"`
+	SecretName      string        `json:"secretName,omitempty"`
+	SecretNamespace string        `json:"secretNamespace,omitempty"`
+	Source          *sourceConfig `json:"source,omitempty"`
 }
 
 func (c webhookConfig) validate(ctx context.Context, client kubernetes.Interface) error {
@@ -344,8 +364,17 @@ func (c webhookConfig) validate(ctx context.Context, client kubernetes.Interface
 	if c.Name == "" {
 		err = multierror.Append(err, errors.New(`config.Name cannot be ""`))
 	} else {
-		if _, err2 := client.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, c.Name, metav1.GetOptions{}); err2 != nil && k8serrors.IsNotFound(err2) {
-			err = multierror.Append(err, fmt.Errorf("MutatingWebhookConfiguration with name \"%s\" must exist in cluster", c.Name))
+		switch c.Kind {
+		case "", kindMutatingWebhookConfiguration:
+			if _, err2 := client.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, c.Name, metav1.GetOptions{}); err2 != nil && k8serrors.IsNotFound(err2) {
+				err = multierror.Append(err, fmt.Errorf("MutatingWebhookConfiguration with name \"%s\" must exist in cluster", c.Name))
+			}
+		case kindValidatingWebhookConfiguration:
+			if _, err2 := client.AdmissionregistrationV1().ValidatingWebhookConfigurations().Get(ctx, c.Name, metav1.GetOptions{}); err2 != nil && k8serrors.IsNotFound(err2) {
+				err = multierror.Append(err, fmt.Errorf("ValidatingWebhookConfiguration with name \"%s\" must exist in cluster", c.Name))
+			}
+		default:
+			err = multierror.Append(err, fmt.Errorf("config.Kind must be %q or %q", kindMutatingWebhookConfiguration, kindValidatingWebhookConfiguration))
 		}
 	}
 	if c.SecretName == "" {
@@ -354,6 +383,9 @@ func (c webhookConfig) validate(ctx context.Context, client kubernetes.Interface
 	if c.SecretNamespace == "" {
 		err = multierror.Append(err, errors.New(`config.SecretNameSpace cannot be ""`))
 	}
+	if sourceErrs := c.validateSource(); len(sourceErrs) > 0 {
+		err = multierror.Append(err, sourceErrs...)
+	}
 
 	if err != nil {
 		err.ErrorFormat = func(errs []error) string {
@@ -393,4 +425,11 @@ Usage: consul-k8s-control-plane webhook-cert-manager [options]
 
   Starts the Consul Kubernetes webhook-cert-manager that manages the lifecycle for webhook TLS certificates.
 
+  Each webhook in the config file is served a certificate from its "source":
+  a self-signed CA ("self-signed", the default), a secret issued by
+  cert-manager ("cert-manager"), Vault PKI ("vault") or files on disk
+  ("file"). The CA is kept up to date on the caBundles of the mutating or
+  validating webhook configuration and of the conversion webhooks of
+  "conversionCRDs".
+
 `
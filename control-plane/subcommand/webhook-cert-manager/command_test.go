@@ -5,11 +5,14 @@ package webhookcertmanager
 
 import (
 	"context"
+	"fmt"
 	"os"
+	"path/filepath"
 	"syscall"
 	"testing"
 	"time"
 
+	"github.com/hashicorp/consul-k8s/control-plane/helper/cert"
 	"github.com/hashicorp/consul-k8s/control-plane/subcommand/common"
 	"github.com/hashicorp/consul-k8s/control-plane/subcommand/webhook-cert-manager/mocks"
 	"github.com/hashicorp/consul/sdk/testutil/retry"
@@ -18,6 +21,8 @@ import (
 	admissionv1 "k8s.io/api/admissionregistration/v1"
 	appsv1 "k8s.io/api/apps/v1"
 	v1 "k8s.io/api/core/v1"
+	apiextv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apiextfake "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/fake"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
@@ -669,6 +674,203 @@ func TestCertWatcher(t *testing.T) {
 	})
 }
 
+// Test that the caBundles of validating webhook configurations and CRD
+// conversion webhooks are updated with the certificates from a file source.
+func TestRun_ValidatingWebhookAndConversionCRDs(t *testing.T) {
+	t.Parallel()
+
+	deploymentName := "deployment"
+	deploymentNamespace := "deploy-ns"
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      deploymentName,
+			Namespace: deploymentNamespace,
+			UID:       types.UID("this-is-a-uid"),
+		},
+	}
+	webhook := &admissionv1.ValidatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "webhookOne",
+		},
+		Webhooks: []admissionv1.ValidatingWebhook{
+			{Name: "webhookOne-under-test"},
+			{Name: "webhookTwo-under-test"},
+		},
+	}
+	crd := &apiextv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "servicedefaults.consul.hashicorp.com",
+		},
+		Spec: apiextv1.CustomResourceDefinitionSpec{
+			Conversion: &apiextv1.CustomResourceConversion{
+				Strategy: apiextv1.WebhookConverter,
+				Webhook: &apiextv1.WebhookConversion{
+					ClientConfig: &apiextv1.WebhookClientConfig{},
+				},
+			},
+		},
+	}
+
+	// Serve the certificates from files.
+	dir := t.TempDir()
+	bundle, err := (&cert.GenSource{Name: "Test", Hosts: []string{"webhook"}}).Certificate(context.Background(), nil)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "tls.crt"), bundle.Cert, 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "tls.key"), bundle.Key, 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "ca.crt"), bundle.CACert, 0600))
+
+	k8s := fake.NewSimpleClientset(webhook, deployment)
+	apiext := apiextfake.NewSimpleClientset(crd)
+	cmd := Command{
+		UI:              cli.NewMockUi(),
+		clientset:       k8s,
+		apiextClientset: apiext,
+	}
+
+	configFile := common.WriteTempFile(t, fmt.Sprintf(`[
+  {
+    "name": "webhookOne",
+    "kind": "ValidatingWebhookConfiguration",
+    "conversionCRDs": ["servicedefaults.consul.hashicorp.com"],
+    "secretName": "secret-deploy-1",
+    "secretNamespace": "default",
+    "source": {
+      "type": "file",
+      "file": {
+        "certFile": %q,
+        "keyFile": %q,
+        "caFile": %q
+      }
+    }
+  }
+]`, filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"), filepath.Join(dir, "ca.crt")))
+	exitCh := runCommandAsynchronously(&cmd, []string{
+		"-config-file", configFile,
+		"-deployment-name", deploymentName,
+		"-deployment-namespace", deploymentNamespace,
+	})
+	defer stopCommand(t, &cmd, exitCh)
+
+	ctx := context.Background()
+	timer := &retry.Timer{Timeout: 10 * time.Second, Wait: 500 * time.Millisecond}
+	retry.RunWith(timer, t, func(r *retry.R) {
+		secret, err := k8s.CoreV1().Secrets("default").Get(ctx, "secret-deploy-1", metav1.GetOptions{})
+		require.NoError(r, err)
+		require.Equal(r, bundle.Cert, secret.Data[v1.TLSCertKey])
+		require.Equal(r, bundle.Key, secret.Data[v1.TLSPrivateKeyKey])
+
+		webhookConfig, err := k8s.AdmissionregistrationV1().ValidatingWebhookConfigurations().Get(ctx, "webhookOne", metav1.GetOptions{})
+		require.NoError(r, err)
+		require.Equal(r, bundle.CACert, webhookConfig.Webhooks[0].ClientConfig.CABundle)
+		require.Equal(r, bundle.CACert, webhookConfig.Webhooks[1].ClientConfig.CABundle)
+
+		crd, err := apiext.ApiextensionsV1().CustomResourceDefinitions().Get(ctx, "servicedefaults.consul.hashicorp.com", metav1.GetOptions{})
+		require.NoError(r, err)
+		require.Equal(r, bundle.CACert, crd.Spec.Conversion.Webhook.ClientConfig.CABundle)
+	})
+
+	// The caBundles are reset if they're changed.
+	_, err = k8s.AdmissionregistrationV1().ValidatingWebhookConfigurations().Update(ctx, webhook, metav1.UpdateOptions{})
+	require.NoError(t, err)
+	_, err = apiext.ApiextensionsV1().CustomResourceDefinitions().Update(ctx, crd, metav1.UpdateOptions{})
+	require.NoError(t, err)
+	retry.RunWith(timer, t, func(r *retry.R) {
+		webhookConfig, err := k8s.AdmissionregistrationV1().ValidatingWebhookConfigurations().Get(ctx, "webhookOne", metav1.GetOptions{})
+		require.NoError(r, err)
+		require.Equal(r, bundle.CACert, webhookConfig.Webhooks[0].ClientConfig.CABundle)
+
+		crd, err := apiext.ApiextensionsV1().CustomResourceDefinitions().Get(ctx, "servicedefaults.consul.hashicorp.com", metav1.GetOptions{})
+		require.NoError(r, err)
+		require.Equal(r, bundle.CACert, crd.Spec.Conversion.Webhook.ClientConfig.CABundle)
+	})
+}
+
+// Test that certificates issued by cert-manager are copied to the webhook
+// secret and that the webhook is updated when cert-manager renews them.
+func TestRun_CertManagerSource(t *testing.T) {
+	t.Parallel()
+
+	deploymentName := "deployment"
+	deploymentNamespace := "deploy-ns"
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      deploymentName,
+			Namespace: deploymentNamespace,
+			UID:       types.UID("this-is-a-uid"),
+		},
+	}
+	webhook := &admissionv1.MutatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "webhookOne",
+		},
+		Webhooks: []admissionv1.MutatingWebhook{
+			{Name: "webhook-under-test"},
+		},
+	}
+	issued := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "cert-manager-issued",
+			Namespace: "default",
+		},
+		Data: map[string][]byte{
+			v1.TLSCertKey:       []byte("certificate-1"),
+			v1.TLSPrivateKeyKey: []byte("private-key-1"),
+			cert.SecretCAKey:    []byte("ca-certificate-1"),
+		},
+		Type: v1.SecretTypeTLS,
+	}
+
+	k8s := fake.NewSimpleClientset(webhook, deployment, issued)
+	cmd := Command{
+		UI:        cli.NewMockUi(),
+		clientset: k8s,
+	}
+
+	configFile := common.WriteTempFile(t, `[
+  {
+    "name": "webhookOne",
+    "secretName": "secret-deploy-1",
+    "secretNamespace": "default",
+    "source": {
+      "type": "cert-manager",
+      "certManager": {
+        "secretName": "cert-manager-issued"
+      }
+    }
+  }
+]`)
+	exitCh := runCommandAsynchronously(&cmd, []string{
+		"-config-file", configFile,
+		"-deployment-name", deploymentName,
+		"-deployment-namespace", deploymentNamespace,
+	})
+	defer stopCommand(t, &cmd, exitCh)
+
+	ctx := context.Background()
+	requireCertificate := func(certificate, caCert string) {
+		timer := &retry.Timer{Timeout: 10 * time.Second, Wait: 500 * time.Millisecond}
+		retry.RunWith(timer, t, func(r *retry.R) {
+			secret, err := k8s.CoreV1().Secrets("default").Get(ctx, "secret-deploy-1", metav1.GetOptions{})
+			require.NoError(r, err)
+			require.Equal(r, certificate, string(secret.Data[v1.TLSCertKey]))
+
+			webhookConfig, err := k8s.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, "webhookOne", metav1.GetOptions{})
+			require.NoError(r, err)
+			require.Equal(r, caCert, string(webhookConfig.Webhooks[0].ClientConfig.CABundle))
+		})
+	}
+	requireCertificate("certificate-1", "ca-certificate-1")
+
+	issued.Data = map[string][]byte{
+		v1.TLSCertKey:       []byte("certificate-2"),
+		v1.TLSPrivateKeyKey: []byte("private-key-2"),
+		cert.SecretCAKey:    []byte("ca-certificate-2"),
+	}
+	_, err := k8s.CoreV1().Secrets("default").Update(ctx, issued, metav1.UpdateOptions{})
+	require.NoError(t, err)
+	requireCertificate("certificate-2", "ca-certificate-2")
+}
+
 func TestValidate(t *testing.T) {
 	t.Parallel()
 	webhook := &admissionv1.MutatingWebhookConfiguration{
@@ -723,6 +925,67 @@ func TestValidate(t *testing.T) {
 			clientset: client,
 			expErr:    `config.SecretNameSpace cannot be ""`,
 		},
+		"kind": {
+			config: webhookConfig{
+				Name:            "webhook-config-name",
+				Kind:            "Service",
+				SecretName:      "secret-name",
+				SecretNamespace: "default",
+			},
+			clientset: client,
+			expErr:    `config.Kind must be "MutatingWebhookConfiguration" or "ValidatingWebhookConfiguration"`,
+		},
+		"nonExistantVWC": {
+			config: webhookConfig{
+				Name:            "webhook-config-name",
+				Kind:            "ValidatingWebhookConfiguration",
+				SecretName:      "secret-name",
+				SecretNamespace: "default",
+			},
+			clientset: client,
+			expErr:    `ValidatingWebhookConfiguration with name "webhook-config-name" must exist in cluster`,
+		},
+		"source type": {
+			config: webhookConfig{
+				Name:            "webhook-config-name",
+				SecretName:      "secret-name",
+				SecretNamespace: "default",
+				Source:          &sourceConfig{Type: "acme"},
+			},
+			clientset: client,
+			expErr:    `config.Source.Type must be one of "self-signed", "cert-manager", "vault" or "file"`,
+		},
+		"cert-manager source": {
+			config: webhookConfig{
+				Name:            "webhook-config-name",
+				SecretName:      "secret-name",
+				SecretNamespace: "default",
+				Source:          &sourceConfig{Type: "cert-manager"},
+			},
+			clientset: client,
+			expErr:    `config.Source.CertManager.SecretName cannot be ""`,
+		},
+		"vault source": {
+			config: webhookConfig{
+				Name:            "webhook-config-name",
+				SecretName:      "secret-name",
+				SecretNamespace: "default",
+				Source:          &sourceConfig{Type: "vault", Vault: &vaultSourceConfig{TTL: "1"}},
+			},
+			clientset: client,
+			expErr: `config.Source.Vault.Address cannot be "", config.Source.Vault.PKIRole cannot be "", ` +
+				`config.Source.Vault.TTL is invalid: time: missing unit in duration "1", config.TLSAutoHosts cannot be empty with a vault source`,
+		},
+		"file source": {
+			config: webhookConfig{
+				Name:            "webhook-config-name",
+				SecretName:      "secret-name",
+				SecretNamespace: "default",
+				Source:          &sourceConfig{Type: "file", File: &fileSourceConfig{CertFile: "tls.crt"}},
+			},
+			clientset: client,
+			expErr:    `config.Source.File.CertFile, KeyFile and CAFile cannot be ""`,
+		},
 		"multi-error": {
 			config: webhookConfig{
 				Name:            "",
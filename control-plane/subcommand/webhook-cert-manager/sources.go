@@ -0,0 +1,176 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package webhookcertmanager
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/consul-k8s/control-plane/helper/cert"
+	vaultapi "github.com/hashicorp/vault/api"
+)
+
+const (
+	sourceTypeSelfSigned  = "self-signed"
+	sourceTypeCertManager = "cert-manager"
+	sourceTypeVault       = "vault"
+	sourceTypeFile        = "file"
+
+	defaultVaultAuthMethodPath = "kubernetes"
+	defaultVaultPKIPath        = "pki"
+)
+
+// sourceConfig configures where the certificates for a webhook come from.
+// Type selects the source and only the config for that source is used.
+type sourceConfig struct {
+	// Type is one of "self-signed", "cert-manager", "vault" or "file".
+	// Defaults to "self-signed".
+	Type        string                   `json:"type,omitempty"`
+	CertManager *certManagerSourceConfig `json:"certManager,omitempty"`
+	Vault       *vaultSourceConfig       `json:"vault,omitempty"`
+	File        *fileSourceConfig        `json:"file,omitempty"`
+}
+
+// certManagerSourceConfig configures reading certificates from a secret
+// issued by cert-manager.
+type certManagerSourceConfig struct {
+	SecretName string `json:"secretName,omitempty"`
+	// SecretNamespace defaults to the namespace of the webhook secret.
+	SecretNamespace string `json:"secretNamespace,omitempty"`
+}
+
+// vaultSourceConfig configures issuing certificates from Vault PKI.
+type vaultSourceConfig struct {
+	Address    string `json:"address,omitempty"`
+	CACertFile string `json:"caCertFile,omitempty"`
+	Namespace  string `json:"namespace,omitempty"`
+	// AuthMethodPath defaults to "kubernetes".
+	AuthMethodPath string `json:"authMethodPath,omitempty"`
+	Role           string `json:"role,omitempty"`
+	// PKIPath defaults to "pki".
+	PKIPath string `json:"pkiPath,omitempty"`
+	PKIRole string `json:"pkiRole,omitempty"`
+	// TTL defaults to the TTL of the PKI role.
+	TTL string `json:"ttl,omitempty"`
+}
+
+// fileSourceConfig configures reading certificates from files.
+type fileSourceConfig struct {
+	CertFile string `json:"certFile,omitempty"`
+	KeyFile  string `json:"keyFile,omitempty"`
+	CAFile   string `json:"caFile,omitempty"`
+}
+
+// validateSource returns the errors in the source config of the webhook
+// config.
+func (c webhookConfig) validateSource() []error {
+	if c.Source == nil {
+		return nil
+	}
+	var errs []error
+	switch c.Source.Type {
+	case "", sourceTypeSelfSigned:
+	case sourceTypeCertManager:
+		if c.Source.CertManager == nil || c.Source.CertManager.SecretName == "" {
+			errs = append(errs, errors.New(`config.Source.CertManager.SecretName cannot be ""`))
+		}
+	case sourceTypeVault:
+		v := c.Source.Vault
+		if v == nil {
+			v = &vaultSourceConfig{}
+		}
+		if v.Address == "" {
+			errs = append(errs, errors.New(`config.Source.Vault.Address cannot be ""`))
+		}
+		if v.PKIRole == "" {
+			errs = append(errs, errors.New(`config.Source.Vault.PKIRole cannot be ""`))
+		}
+		if v.TTL != "" {
+			if _, err := time.ParseDuration(v.TTL); err != nil {
+				errs = append(errs, fmt.Errorf("config.Source.Vault.TTL is invalid: %s", err))
+			}
+		}
+		if len(c.TLSAutoHosts) == 0 {
+			errs = append(errs, errors.New("config.TLSAutoHosts cannot be empty with a vault source"))
+		}
+	case sourceTypeFile:
+		f := c.Source.File
+		if f == nil || f.CertFile == "" || f.KeyFile == "" || f.CAFile == "" {
+			errs = append(errs, errors.New(`config.Source.File.CertFile, KeyFile and CAFile cannot be ""`))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("config.Source.Type must be one of %q, %q, %q or %q",
+			sourceTypeSelfSigned, sourceTypeCertManager, sourceTypeVault, sourceTypeFile))
+	}
+	return errs
+}
+
+// certSource returns the source of certificates for the webhook config. The
+// config must have been validated.
+func (c *Command) certSource(config webhookConfig, expiry time.Duration) (cert.Source, error) {
+	sourceType := sourceTypeSelfSigned
+	if config.Source != nil && config.Source.Type != "" {
+		sourceType = config.Source.Type
+	}
+
+	switch sourceType {
+	case sourceTypeCertManager:
+		namespace := config.Source.CertManager.SecretNamespace
+		if namespace == "" {
+			namespace = config.SecretNamespace
+		}
+		return &cert.SecretSource{
+			Clientset: c.clientset,
+			Name:      config.Source.CertManager.SecretName,
+			Namespace: namespace,
+		}, nil
+	case sourceTypeVault:
+		v := config.Source.Vault
+		vaultConfig := vaultapi.DefaultConfig()
+		vaultConfig.Address = v.Address
+		if v.CACertFile != "" {
+			if err := vaultConfig.ConfigureTLS(&vaultapi.TLSConfig{CACert: v.CACertFile}); err != nil {
+				return nil, fmt.Errorf("configuring Vault TLS: %w", err)
+			}
+		}
+		vaultClient, err := vaultapi.NewClient(vaultConfig)
+		if err != nil {
+			return nil, fmt.Errorf("creating Vault client: %w", err)
+		}
+		if v.Namespace != "" {
+			vaultClient.SetNamespace(v.Namespace)
+		}
+		source := &cert.VaultSource{
+			Client:         vaultClient,
+			AuthMethodPath: v.AuthMethodPath,
+			Role:           v.Role,
+			PKIPath:        v.PKIPath,
+			PKIRole:        v.PKIRole,
+			Hosts:          config.TLSAutoHosts,
+		}
+		if source.AuthMethodPath == "" {
+			source.AuthMethodPath = defaultVaultAuthMethodPath
+		}
+		if source.PKIPath == "" {
+			source.PKIPath = defaultVaultPKIPath
+		}
+		if v.TTL != "" {
+			source.TTL, _ = time.ParseDuration(v.TTL)
+		}
+		return source, nil
+	case sourceTypeFile:
+		return &cert.FileSource{
+			CertFile: config.Source.File.CertFile,
+			KeyFile:  config.Source.File.KeyFile,
+			CAFile:   config.Source.File.CAFile,
+		}, nil
+	default:
+		return &cert.GenSource{
+			Name:   "Consul Webhook Certificates",
+			Hosts:  config.TLSAutoHosts,
+			Expiry: expiry,
+		}, nil
+	}
+}